@@ -0,0 +1,97 @@
+// Package analyzer содержит клиентов сервиса распознавания поз
+package analyzer
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/kktjss/dance-flow/models"
+)
+
+// DefaultURL - адрес Python сервера анализа по умолчанию
+const DefaultURL = "http://127.0.0.1:8000"
+
+// Сколько ждать после ответа 429 без заголовка Retry-After. Сервер анализа
+// сбрасывает счётчик запросов раз в минуту.
+const rateLimitRetryAfter = 5 * time.Second
+
+// Analyzer распознаёт позы на одном кадре (JPEG или PNG)
+type Analyzer interface {
+	ProcessFrame(ctx context.Context, image []byte) (*models.PoseData, error)
+}
+
+// ProcessFrame отправляет кадр на /process-frame и возвращает проверенные данные позы.
+// Распознавание не меняет состояние сервера, поэтому запрос повторяется при сбоях.
+func (c *Client) ProcessFrame(ctx context.Context, image []byte) (*models.PoseData, error) {
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	part, err := writer.CreateFormFile("file", "frame.jpg")
+	if err != nil {
+		return nil, err
+	}
+	if _, err := part.Write(image); err != nil {
+		return nil, err
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+
+	// Изображение с разметкой не нужно: запрашиваем только координаты.
+	// Сервер принимает флаги только как 0/1, на false отвечает 422.
+	resp, err := c.Do(ctx, Request{
+		Method:     http.MethodPost,
+		Path:       "/process-frame",
+		Query:      url.Values{"image": {"0"}, "draw": {"0"}, "overlay": {"0"}},
+		Header:     http.Header{"Content-Type": {writer.FormDataContentType()}},
+		Body:       body.Bytes(),
+		Idempotent: true,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusTooManyRequests {
+		// Превышен лимит запросов: сервер исправен, кадр можно отправить позже
+		return nil, &UnavailableError{
+			RetryAfter: retryAfterHeader(resp.Header, rateLimitRetryAfter),
+			Err:        fmt.Errorf("%s: rate limit exceeded", resp.Backend),
+		}
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("analyzer returned status %d: %s", resp.StatusCode, truncate(string(resp.Body), 200))
+	}
+
+	return parseResponse(resp.Body)
+}
+
+func parseResponse(data []byte) (*models.PoseData, error) {
+	pd, err := models.ParsePoseData(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid analyzer response: %w", err)
+	}
+	if err := pd.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid analyzer response: %w", err)
+	}
+	return pd, nil
+}
+
+// retryAfterHeader читает задержку в секундах из заголовка Retry-After
+func retryAfterHeader(h http.Header, fallback time.Duration) time.Duration {
+	seconds, err := strconv.Atoi(h.Get("Retry-After"))
+	if err != nil || seconds < 0 {
+		return fallback
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n] + "..."
+}
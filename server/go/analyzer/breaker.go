@@ -0,0 +1,90 @@
+package analyzer
+
+import (
+	"sync"
+	"time"
+)
+
+// Состояния автоматического выключателя
+const (
+	breakerClosed   = "closed"
+	breakerOpen     = "open"
+	breakerHalfOpen = "half-open"
+)
+
+// breaker размыкается после threshold ошибок подряд и не пропускает запросы
+// в течение cooldown. Затем пропускает один пробный запрос: успех замыкает
+// выключатель, ошибка снова размыкает его.
+type breaker struct {
+	threshold int
+	cooldown  time.Duration
+
+	mu       sync.Mutex
+	state    string
+	failures int
+	openedAt time.Time
+	probing  bool
+}
+
+func newBreaker(threshold int, cooldown time.Duration) *breaker {
+	if threshold < 1 {
+		threshold = 1
+	}
+	return &breaker{threshold: threshold, cooldown: cooldown, state: breakerClosed}
+}
+
+// allow сообщает, можно ли отправить запрос; иначе возвращает время до следующей попытки
+func (b *breaker) allow(now time.Time) (bool, time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case breakerOpen:
+		if wait := b.openedAt.Add(b.cooldown).Sub(now); wait > 0 {
+			return false, wait
+		}
+		b.state = breakerHalfOpen
+		b.probing = true
+		return true, 0
+	case breakerHalfOpen:
+		// Пока пробный запрос не завершён, остальные ждут
+		if b.probing {
+			return false, b.cooldown / 10
+		}
+		b.probing = true
+		return true, 0
+	}
+	return true, 0
+}
+
+func (b *breaker) success() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.state = breakerClosed
+	b.failures = 0
+	b.probing = false
+}
+
+func (b *breaker) failure(now time.Time) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failures++
+	b.probing = false
+	if b.state == breakerHalfOpen || b.failures >= b.threshold {
+		b.state = breakerOpen
+		b.openedAt = now
+	}
+}
+
+// release снимает резерв пробного запроса, если запрос не дошёл до сервера
+func (b *breaker) release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.probing = false
+}
+
+func (b *breaker) currentState() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state
+}
@@ -0,0 +1,417 @@
+package analyzer
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Максимальный размер ответа анализатора (изображение с разметкой в base64)
+const maxResponseSize = 64 << 20
+
+// Options задаёт параметры клиента серверов анализа
+type Options struct {
+	URLs             []string
+	Timeout          time.Duration
+	MaxConcurrency   int
+	MaxRetries       int
+	RetryBackoff     time.Duration
+	HealthInterval   time.Duration
+	BreakerThreshold int
+	BreakerCooldown  time.Duration
+	HTTPClient       *http.Client
+}
+
+// UnavailableError означает, что ни один сервер анализа не может принять запрос
+type UnavailableError struct {
+	RetryAfter time.Duration
+	Err        error
+}
+
+func (e *UnavailableError) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("analyzer unavailable: %v", e.Err)
+	}
+	return "analyzer unavailable"
+}
+
+func (e *UnavailableError) Unwrap() error {
+	return e.Err
+}
+
+// Request - запрос к серверу анализа. Тело буферизуется, чтобы его можно было повторить.
+type Request struct {
+	Method string
+	Path   string
+	Query  url.Values
+	Header http.Header
+	Body   []byte
+	// Idempotent разрешает повтор запроса на том же или другом сервере
+	Idempotent bool
+}
+
+// Response - ответ сервера анализа
+type Response struct {
+	StatusCode int
+	Header     http.Header
+	Body       []byte
+	Backend    string
+}
+
+// BackendStatus описывает состояние одного сервера анализа
+type BackendStatus struct {
+	URL       string    `json:"url"`
+	Healthy   bool      `json:"healthy"`
+	Breaker   string    `json:"breaker"`
+	InFlight  int32     `json:"inFlight"`
+	CheckedAt time.Time `json:"checkedAt,omitempty"`
+}
+
+type backend struct {
+	url       string
+	healthy   atomic.Bool
+	inFlight  atomic.Int32
+	breaker   *breaker
+	mu        sync.Mutex
+	checkedAt time.Time
+}
+
+// Client распределяет запросы между серверами анализа, ограничивает число
+// одновременных запросов, повторяет идемпотентные запросы и быстро отказывает,
+// если все серверы недоступны
+type Client struct {
+	opts     Options
+	http     *http.Client
+	backends []*backend
+	slots    chan struct{}
+	next     atomic.Uint32
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+// NewClient создает клиента. Проверка здоровья запускается методом Start.
+func NewClient(opts Options) *Client {
+	if opts.Timeout <= 0 {
+		opts.Timeout = 30 * time.Second
+	}
+	if opts.MaxConcurrency <= 0 {
+		opts.MaxConcurrency = 8
+	}
+	if opts.RetryBackoff <= 0 {
+		opts.RetryBackoff = 200 * time.Millisecond
+	}
+	if opts.HealthInterval <= 0 {
+		opts.HealthInterval = 10 * time.Second
+	}
+	if opts.BreakerCooldown <= 0 {
+		opts.BreakerCooldown = 30 * time.Second
+	}
+	if len(opts.URLs) == 0 {
+		opts.URLs = []string{DefaultURL}
+	}
+
+	httpClient := opts.HTTPClient
+	if httpClient == nil {
+		httpClient = &http.Client{}
+	}
+
+	c := &Client{
+		opts:  opts,
+		http:  httpClient,
+		slots: make(chan struct{}, opts.MaxConcurrency),
+		stop:  make(chan struct{}),
+	}
+	for _, u := range opts.URLs {
+		b := &backend{
+			url:     strings.TrimRight(u, "/"),
+			breaker: newBreaker(opts.BreakerThreshold, opts.BreakerCooldown),
+		}
+		// До первой проверки считаем сервер доступным
+		b.healthy.Store(true)
+		c.backends = append(c.backends, b)
+	}
+	return c
+}
+
+// Start запускает периодическую проверку /health всех серверов
+func (c *Client) Start() {
+	go func() {
+		ticker := time.NewTicker(c.opts.HealthInterval)
+		defer ticker.Stop()
+		for {
+			c.CheckHealth(context.Background())
+			select {
+			case <-ticker.C:
+			case <-c.stop:
+				return
+			}
+		}
+	}()
+}
+
+// Close останавливает проверку здоровья
+func (c *Client) Close() {
+	c.stopOnce.Do(func() { close(c.stop) })
+}
+
+// CheckHealth опрашивает /health всех серверов параллельно
+func (c *Client) CheckHealth(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, b := range c.backends {
+		wg.Add(1)
+		go func(b *backend) {
+			defer wg.Done()
+			b.healthy.Store(c.ping(ctx, b))
+			b.mu.Lock()
+			b.checkedAt = time.Now()
+			b.mu.Unlock()
+		}(b)
+	}
+	wg.Wait()
+}
+
+func (c *Client) ping(ctx context.Context, b *backend) bool {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, b.url+"/health", nil)
+	if err != nil {
+		return false
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return false
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+	return resp.StatusCode == http.StatusOK
+}
+
+// Status возвращает состояние всех серверов
+func (c *Client) Status() []BackendStatus {
+	statuses := make([]BackendStatus, 0, len(c.backends))
+	for _, b := range c.backends {
+		b.mu.Lock()
+		checkedAt := b.checkedAt
+		b.mu.Unlock()
+		statuses = append(statuses, BackendStatus{
+			URL:       b.url,
+			Healthy:   b.healthy.Load(),
+			Breaker:   b.breaker.currentState(),
+			InFlight:  b.inFlight.Load(),
+			CheckedAt: checkedAt,
+		})
+	}
+	return statuses
+}
+
+// Do отправляет запрос на один из доступных серверов. Ответы 5xx от шлюза
+// и сетевые ошибки считаются отказом сервера: идемпотентный запрос повторяется
+// с экспоненциальной задержкой, предпочтительно на другом сервере.
+func (c *Client) Do(ctx context.Context, req Request) (*Response, error) {
+	// Ограничиваем число одновременных запросов к анализатору: запрос ждёт
+	// свободного места не дольше таймаута, затем получает отказ
+	wait := time.NewTimer(c.opts.Timeout)
+	select {
+	case c.slots <- struct{}{}:
+		wait.Stop()
+		defer func() { <-c.slots }()
+	case <-wait.C:
+		return nil, &UnavailableError{RetryAfter: time.Second, Err: errors.New("too many concurrent analyzer requests")}
+	case <-ctx.Done():
+		wait.Stop()
+		return nil, ctx.Err()
+	}
+
+	attempts := 1
+	if req.Idempotent {
+		attempts += c.opts.MaxRetries
+	}
+
+	tried := make(map[*backend]bool)
+	var lastErr error
+	var lastResp *Response
+	for attempt := 0; attempt < attempts; attempt++ {
+		if attempt > 0 {
+			if err := c.backoff(ctx, attempt); err != nil {
+				return nil, err
+			}
+		}
+
+		b, retryAfter := c.pick(tried)
+		if b == nil {
+			if lastResp != nil {
+				return lastResp, nil
+			}
+			return nil, &UnavailableError{RetryAfter: retryAfter, Err: lastErr}
+		}
+		tried[b] = true
+
+		resp, err := c.send(ctx, b, req)
+		if err == nil && !isBackendFailure(resp.StatusCode) {
+			b.breaker.success()
+			return resp, nil
+		}
+		if ctx.Err() != nil {
+			// Отмена вызывающей стороной не является ошибкой сервера
+			b.breaker.release()
+			return nil, ctx.Err()
+		}
+
+		b.breaker.failure(time.Now())
+		if err != nil {
+			lastErr = fmt.Errorf("%s: %w", b.url, err)
+			lastResp = nil
+		} else {
+			lastErr = fmt.Errorf("%s: status %d", b.url, resp.StatusCode)
+			lastResp = resp
+		}
+	}
+
+	if lastResp != nil {
+		return lastResp, nil
+	}
+	return nil, &UnavailableError{RetryAfter: c.retryAfter(), Err: lastErr}
+}
+
+// pick выбирает сервер с наименьшим числом запросов в работе, начиная обход
+// с очередного по кругу. Серверы, на которые уже отправлялся запрос, выбираются
+// только если других нет.
+func (c *Client) pick(tried map[*backend]bool) (*backend, time.Duration) {
+	now := time.Now()
+	start := int(c.next.Add(1))
+	retryAfter := time.Duration(0)
+
+	for _, allowTried := range []bool{false, true} {
+		var best *backend
+		for i := range c.backends {
+			b := c.backends[(start+i)%len(c.backends)]
+			if tried[b] != allowTried || !b.healthy.Load() {
+				continue
+			}
+			if best == nil || b.inFlight.Load() < best.inFlight.Load() {
+				best = b
+			}
+		}
+		if best == nil {
+			continue
+		}
+
+		ok, wait := best.breaker.allow(now)
+		if ok {
+			return best, 0
+		}
+		if retryAfter == 0 || wait < retryAfter {
+			retryAfter = wait
+		}
+		// Выбранный сервер разомкнут: пробуем остальные
+		for _, b := range c.backends {
+			if b == best || tried[b] != allowTried || !b.healthy.Load() {
+				continue
+			}
+			if ok, wait := b.breaker.allow(now); ok {
+				return b, 0
+			} else if wait < retryAfter {
+				retryAfter = wait
+			}
+		}
+	}
+
+	if retryAfter == 0 {
+		// Все серверы не прошли проверку здоровья
+		retryAfter = c.opts.HealthInterval
+	}
+	return nil, retryAfter
+}
+
+func (c *Client) send(ctx context.Context, b *backend, req Request) (*Response, error) {
+	b.inFlight.Add(1)
+	defer b.inFlight.Add(-1)
+
+	ctx, cancel := context.WithTimeout(ctx, c.opts.Timeout)
+	defer cancel()
+
+	target := b.url + req.Path
+	if len(req.Query) > 0 {
+		target += "?" + req.Query.Encode()
+	}
+	method := req.Method
+	if method == "" {
+		method = http.MethodGet
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, method, target, bytes.NewReader(req.Body))
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range req.Header {
+		httpReq.Header[k] = v
+	}
+
+	resp, err := c.http.Do(httpReq)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseSize))
+	if err != nil {
+		return nil, err
+	}
+	return &Response{StatusCode: resp.StatusCode, Header: resp.Header, Body: body, Backend: b.url}, nil
+}
+
+// backoff ждёт перед повтором: RetryBackoff * 2^(attempt-1) со случайным разбросом
+func (c *Client) backoff(ctx context.Context, attempt int) error {
+	delay := c.opts.RetryBackoff << (attempt - 1)
+	delay += time.Duration(rand.Int63n(int64(delay)/2 + 1))
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// retryAfter оценивает, когда появится доступный сервер
+func (c *Client) retryAfter() time.Duration {
+	now := time.Now()
+	best := c.opts.HealthInterval
+	for _, b := range c.backends {
+		if !b.healthy.Load() {
+			continue
+		}
+		b.breaker.mu.Lock()
+		if b.breaker.state == breakerOpen {
+			if wait := b.breaker.openedAt.Add(b.breaker.cooldown).Sub(now); wait < best {
+				best = wait
+			}
+		} else {
+			best = time.Second
+		}
+		b.breaker.mu.Unlock()
+	}
+	if best < time.Second {
+		best = time.Second
+	}
+	return best
+}
+
+// isBackendFailure отличает недоступность сервера от ошибки в самом запросе
+func isBackendFailure(status int) bool {
+	return status == http.StatusBadGateway ||
+		status == http.StatusServiceUnavailable ||
+		status == http.StatusGatewayTimeout
+}
@@ -0,0 +1,86 @@
+package analyzer
+
+import (
+	"context"
+	"hash/fnv"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/kktjss/dance-flow/models"
+)
+
+// Fake - детерминированный анализатор без Python сервера для тестов и локальной разработки.
+// Поза вычисляется из хеша кадра, поэтому одинаковые кадры дают одинаковый результат.
+type Fake struct {
+	// Delay имитирует время обработки кадра
+	Delay time.Duration
+	// Persons - число людей в кадре (по умолчанию 1)
+	Persons int
+	// FailOn позволяет вернуть ошибку для выбранного вызова (нумерация с 1)
+	FailOn func(call int) error
+
+	mu    sync.Mutex
+	calls int
+}
+
+// Calls возвращает число обработанных вызовов
+func (f *Fake) Calls() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.calls
+}
+
+// ProcessFrame возвращает синтетическую позу
+func (f *Fake) ProcessFrame(ctx context.Context, image []byte) (*models.PoseData, error) {
+	f.mu.Lock()
+	f.calls++
+	call := f.calls
+	f.mu.Unlock()
+
+	if f.Delay > 0 {
+		select {
+		case <-time.After(f.Delay):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	if f.FailOn != nil {
+		if err := f.FailOn(call); err != nil {
+			return nil, err
+		}
+	}
+
+	hash := fnv.New32a()
+	hash.Write(image)
+	phase := float64(hash.Sum32()%1000) / 1000 * 2 * math.Pi
+
+	persons := f.Persons
+	if persons <= 0 {
+		persons = 1
+	}
+
+	skeleton, _ := models.GetSkeleton(models.SkeletonMediaPipe33)
+	pd := &models.PoseData{
+		SchemaVersion: models.PoseSchemaVersion,
+		Skeleton:      skeleton.Name,
+		FrameWidth:    1280,
+		FrameHeight:   720,
+	}
+	for p := 0; p < persons; p++ {
+		centerX := (float64(p) + 0.5) / float64(persons)
+		joints := make([]models.Joint, len(skeleton.Joints))
+		for i, name := range skeleton.Joints {
+			// Суставы расположены по вертикали и покачиваются в зависимости от кадра
+			joints[i] = models.Joint{
+				Name:       name,
+				X:          centerX + 0.05*math.Sin(phase+float64(i)/5),
+				Y:          0.1 + 0.8*float64(i)/float64(len(skeleton.Joints)),
+				Visibility: 0.95,
+			}
+		}
+		pd.Poses = append(pd.Poses, models.Pose{PersonIndex: p, Score: 0.9, Joints: joints})
+	}
+
+	return pd, nil
+}
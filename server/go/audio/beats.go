@@ -0,0 +1,284 @@
+package audio
+
+import (
+	"errors"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/kktjss/dance-flow/models"
+)
+
+// Значения параметров анализа по умолчанию и ограничения
+const (
+	DefaultMinBPM      = 60.0
+	DefaultMaxBPM      = 200.0
+	DefaultBeatsPerBar = 4
+	MinDuration        = 3.0
+	MaxOnsets          = 10000
+
+	// Предпочтительный темп и ширина предпочтения в октавах: из кратных
+	// темпов выбирается ближайший к обычному танцевальному
+	preferredBPM   = 120.0
+	tempoSpread    = 1.0
+	beatTightness  = 100.0
+	onsetMinGap    = 0.05
+	onsetThreshold = 0.1
+)
+
+// Ошибки анализа
+var (
+	ErrTooShort     = errors.New("audio is too short to detect beats")
+	ErrNoBeats      = errors.New("no beats found in audio")
+	ErrInvalidRange = errors.New("invalid tempo range")
+)
+
+// Options задаёт анализ: диапазон темпа и число долей в такте
+type Options struct {
+	MinBPM      float64
+	MaxBPM      float64
+	BeatsPerBar int
+}
+
+// DetectBeats находит в записи начала звуков, темп, доли и сильные доли.
+// Темп оценивается автокорреляцией огибающей ударов, доли расставляются
+// динамическим программированием: каждая следующая доля - на ударе и на
+// расстоянии, близком к периоду. Сильной считается та доля такта, на которую
+// в среднем приходится больше низкочастотных ударов.
+func DetectBeats(clip *Clip, opts Options) (*models.BeatGrid, error) {
+	if opts.MinBPM == 0 {
+		opts.MinBPM = DefaultMinBPM
+	}
+	if opts.MaxBPM == 0 {
+		opts.MaxBPM = DefaultMaxBPM
+	}
+	if opts.BeatsPerBar == 0 {
+		opts.BeatsPerBar = DefaultBeatsPerBar
+	}
+	if !(opts.MinBPM >= models.MinTempoBPM && opts.MaxBPM <= models.MaxTempoBPM && opts.MinBPM < opts.MaxBPM) ||
+		opts.BeatsPerBar < 1 || opts.BeatsPerBar > models.MaxBeatsPerBar {
+		return nil, ErrInvalidRange
+	}
+	if clip.Duration() < MinDuration {
+		return nil, ErrTooShort
+	}
+
+	env := onsetEnvelope(clip)
+	period, confidence := estimatePeriod(env, opts)
+	if period == 0 {
+		return nil, ErrNoBeats
+	}
+	frames := trackBeats(env.values, period)
+	if len(frames) < 2 {
+		return nil, ErrNoBeats
+	}
+
+	grid := &models.BeatGrid{
+		BeatsPerBar: opts.BeatsPerBar,
+		Confidence:  confidence,
+		Duration:    clip.Duration(),
+		Beats:       make([]float64, len(frames)),
+		Downbeats:   []float64{},
+		Onsets:      pickOnsets(env),
+		AnalyzedAt:  time.Now(),
+	}
+	for i, frame := range frames {
+		grid.Beats[i] = roundTime(env.time(float64(frame)))
+	}
+	grid.BPM = 60 / beatInterval(grid.Beats)
+
+	phase := downbeatPhase(env, frames, opts.BeatsPerBar)
+	for i := phase; i < len(grid.Beats); i += opts.BeatsPerBar {
+		grid.Downbeats = append(grid.Downbeats, grid.Beats[i])
+	}
+	grid.Offset = grid.Beats[phase]
+	return grid, nil
+}
+
+// estimatePeriod выбирает период долей (в кадрах огибающей) по максимуму
+// автокорреляции, взвешенной предпочтением темпа, и уточняет его параболой
+// по соседним задержкам. Вторым значением возвращается доля автокорреляции
+// на этом периоде от её значения в нуле.
+func estimatePeriod(env envelope, opts Options) (float64, float64) {
+	values := env.values
+	minLag := int(math.Floor(60 * env.rate / opts.MaxBPM))
+	maxLag := int(math.Ceil(60 * env.rate / opts.MinBPM))
+	if minLag < 1 {
+		minLag = 1
+	}
+	if maxLag+1 >= len(values) {
+		return 0, 0
+	}
+
+	acf := make([]float64, maxLag+2)
+	for lag := range acf {
+		sum := 0.0
+		for i := 0; i+lag < len(values); i++ {
+			sum += values[i] * values[i+lag]
+		}
+		acf[lag] = sum / float64(len(values)-lag)
+	}
+	if acf[0] == 0 {
+		return 0, 0
+	}
+
+	best, bestScore := 0, 0.0
+	for lag := minLag; lag <= maxLag; lag++ {
+		bpm := 60 * env.rate / float64(lag)
+		octaves := math.Log2(bpm/preferredBPM) / tempoSpread
+		if score := acf[lag] * math.Exp(-0.5*octaves*octaves); score > bestScore {
+			best, bestScore = lag, score
+		}
+	}
+	if best == 0 {
+		return 0, 0
+	}
+
+	period := float64(best)
+	if a, b, c := acf[best-1], acf[best], acf[best+1]; a-2*b+c < 0 {
+		period += 0.5 * (a - c) / (a - 2*b + c)
+	}
+	return period, math.Min(acf[best]/acf[0], 1)
+}
+
+// trackBeats расставляет доли по огибающей: оценка кадра - сила удара плюс
+// лучшая оценка предыдущей доли со штрафом за отклонение интервала от
+// периода. Доли в тишине в начале и в конце записи отбрасываются.
+func trackBeats(values []float64, period float64) []int {
+	n := len(values)
+	score := make([]float64, n)
+	backlink := make([]int, n)
+	minGap, maxGap := int(math.Round(period/2)), int(math.Round(2*period))
+	for i := range values {
+		score[i], backlink[i] = values[i], -1
+		bestPrev := math.Inf(-1)
+		for j := i - maxGap; j <= i-minGap; j++ {
+			if j < 0 {
+				continue
+			}
+			deviation := math.Log(float64(i-j) / period)
+			if candidate := score[j] - beatTightness*deviation*deviation; candidate > bestPrev {
+				bestPrev, backlink[i] = candidate, j
+			}
+		}
+		if backlink[i] >= 0 {
+			score[i] += bestPrev
+		}
+	}
+
+	// Последняя доля - лучшая оценка в последнем периоде записи
+	last := n - 1
+	for i := n - 1; i >= 0 && i >= n-int(math.Ceil(period)); i-- {
+		if score[i] > score[last] {
+			last = i
+		}
+	}
+	var beats []int
+	for i := last; i >= 0; i = backlink[i] {
+		beats = append(beats, i)
+	}
+	for a, b := 0, len(beats)-1; a < b; a, b = a+1, b-1 {
+		beats[a], beats[b] = beats[b], beats[a]
+	}
+	return trimSilentBeats(values, beats)
+}
+
+// trimSilentBeats убирает крайние доли, рядом с которыми нет ударов
+func trimSilentBeats(values []float64, beats []int) []int {
+	strength := func(frame int) float64 {
+		peak := 0.0
+		for i := frame - 2; i <= frame+2; i++ {
+			if i >= 0 && i < len(values) {
+				peak = math.Max(peak, values[i])
+			}
+		}
+		return peak
+	}
+	strengths := make([]float64, len(beats))
+	for i, frame := range beats {
+		strengths[i] = strength(frame)
+	}
+	sorted := append([]float64(nil), strengths...)
+	sort.Float64s(sorted)
+	if len(sorted) == 0 {
+		return beats
+	}
+	threshold := sorted[len(sorted)/2] / 4
+
+	from, to := 0, len(beats)
+	for from < to && strengths[from] < threshold {
+		from++
+	}
+	for to > from && strengths[to-1] < threshold {
+		to--
+	}
+	return beats[from:to]
+}
+
+// downbeatPhase выбирает номер первой сильной доли среди первых beatsPerBar
+// долей по средней силе ударов на долях с тем же положением в такте
+func downbeatPhase(env envelope, frames []int, beatsPerBar int) int {
+	if beatsPerBar == 1 || len(frames) < beatsPerBar {
+		return 0
+	}
+	best, bestScore := 0, math.Inf(-1)
+	for phase := 0; phase < beatsPerBar; phase++ {
+		sum, count := 0.0, 0
+		for i := phase; i < len(frames); i += beatsPerBar {
+			sum += env.low[frames[i]] + 0.5*env.values[frames[i]]
+			count++
+		}
+		if score := sum / float64(count); score > bestScore+1e-9 {
+			best, bestScore = phase, score
+		}
+	}
+	return best
+}
+
+// beatInterval оценивает интервал между долями наклоном прямой,
+// проведённой по моментам долей методом наименьших квадратов
+func beatInterval(beats []float64) float64 {
+	n := float64(len(beats))
+	var sumX, sumY, sumXY, sumXX float64
+	for i, t := range beats {
+		x := float64(i)
+		sumX += x
+		sumY += t
+		sumXY += x * t
+		sumXX += x * x
+	}
+	return (n*sumXY - sumX*sumY) / (n*sumXX - sumX*sumX)
+}
+
+// pickOnsets выбирает начала звуков - локальные максимумы огибающей выше порога
+func pickOnsets(env envelope) []float64 {
+	onsets := []float64{}
+	radius := int(math.Ceil(onsetMinGap * env.rate / 2))
+	lastTime := math.Inf(-1)
+	for i, v := range env.values {
+		if v < onsetThreshold {
+			continue
+		}
+		peak := true
+		for j := i - radius; j <= i+radius && peak; j++ {
+			if j >= 0 && j < len(env.values) && j != i && (env.values[j] > v || (env.values[j] == v && j < i)) {
+				peak = false
+			}
+		}
+		t := env.time(float64(i))
+		if !peak || t-lastTime < onsetMinGap {
+			continue
+		}
+		onsets = append(onsets, roundTime(t))
+		lastTime = t
+		if len(onsets) == MaxOnsets {
+			break
+		}
+	}
+	return onsets
+}
+
+// roundTime округляет момент до миллисекунды
+func roundTime(t float64) float64 {
+	return math.Round(t*1000) / 1000
+}
@@ -0,0 +1,146 @@
+package audio
+
+import (
+	"math"
+	"math/cmplx"
+)
+
+// Окно и шаг спектрального анализа в отсчётах. При частоте анализа
+// 11025 Гц окно - 46 мс, шаг - 11.6 мс.
+const (
+	frameSize = 512
+	hopSize   = 128
+)
+
+// Верхняя граница низкочастотной полосы, по ударам в которой (бочка, бас)
+// определяются сильные доли
+const lowBandHz = 200.0
+
+// envelope - огибающая начал звуков: рост спектра от кадра к кадру.
+// low - то же только для низких частот.
+type envelope struct {
+	rate   float64 // кадров в секунду
+	offset float64 // момент кадра 0, с
+	values []float64
+	low    []float64
+}
+
+// time возвращает момент кадра i
+func (e *envelope) time(i float64) float64 {
+	return e.offset + i/e.rate
+}
+
+// onsetEnvelope считает спектральный поток записи: сумму роста логарифма
+// амплитуд по частотам. Из потока вычитается скользящее среднее, чтобы
+// выделить удары на фоне плавных изменений громкости.
+func onsetEnvelope(clip *Clip) envelope {
+	// Рост логарифма амплитуд заметен, как только удар входит в окно,
+	// поэтому кадр относится к концу своего окна
+	env := envelope{
+		rate:   clip.SampleRate / hopSize,
+		offset: frameSize / clip.SampleRate,
+	}
+	frames := (len(clip.Samples)-frameSize)/hopSize + 1
+	if frames < 2 {
+		return env
+	}
+
+	window := make([]float64, frameSize)
+	for i := range window {
+		window[i] = 0.5 - 0.5*math.Cos(2*math.Pi*float64(i)/frameSize)
+	}
+	lowBins := int(lowBandHz * frameSize / clip.SampleRate)
+
+	flux := make([]float64, frames)
+	lowFlux := make([]float64, frames)
+	spectrum := make([]complex128, frameSize)
+	prev := make([]float64, frameSize/2+1)
+	magnitudes := make([]float64, frameSize/2+1)
+	for frame := 0; frame < frames; frame++ {
+		start := frame * hopSize
+		for i := range spectrum {
+			spectrum[i] = complex(clip.Samples[start+i]*window[i], 0)
+		}
+		fft(spectrum)
+		for k := range magnitudes {
+			magnitudes[k] = math.Log1p(100 * cmplx.Abs(spectrum[k]))
+		}
+		if frame > 0 {
+			for k := 1; k < len(magnitudes); k++ {
+				if rise := magnitudes[k] - prev[k]; rise > 0 {
+					flux[frame] += rise
+					if k <= lowBins {
+						lowFlux[frame] += rise
+					}
+				}
+			}
+		}
+		prev, magnitudes = magnitudes, prev
+	}
+
+	env.values = normalize(detrend(flux, int(env.rate/4)))
+	env.low = normalize(detrend(lowFlux, int(env.rate/4)))
+	return env
+}
+
+// detrend вычитает из ряда скользящее среднее по radius соседям с каждой
+// стороны и оставляет только положительную часть
+func detrend(values []float64, radius int) []float64 {
+	prefix := make([]float64, len(values)+1)
+	for i, v := range values {
+		prefix[i+1] = prefix[i] + v
+	}
+	result := make([]float64, len(values))
+	for i, v := range values {
+		from, to := i-radius, i+radius+1
+		if from < 0 {
+			from = 0
+		}
+		if to > len(values) {
+			to = len(values)
+		}
+		mean := (prefix[to] - prefix[from]) / float64(to-from)
+		result[i] = math.Max(v-mean, 0)
+	}
+	return result
+}
+
+// normalize делит ряд на его максимум
+func normalize(values []float64) []float64 {
+	peak := 0.0
+	for _, v := range values {
+		peak = math.Max(peak, v)
+	}
+	if peak > 0 {
+		for i := range values {
+			values[i] /= peak
+		}
+	}
+	return values
+}
+
+// fft - быстрое преобразование Фурье на месте, длина - степень двойки
+func fft(x []complex128) {
+	n := len(x)
+	for i, j := 1, 0; i < n; i++ {
+		bit := n >> 1
+		for ; j&bit != 0; bit >>= 1 {
+			j ^= bit
+		}
+		j ^= bit
+		if i < j {
+			x[i], x[j] = x[j], x[i]
+		}
+	}
+	for size := 2; size <= n; size <<= 1 {
+		step := cmplx.Exp(complex(0, -2*math.Pi/float64(size)))
+		for start := 0; start < n; start += size {
+			w := complex(1, 0)
+			for k := 0; k < size/2; k++ {
+				a, b := x[start+k], x[start+k+size/2]*w
+				x[start+k], x[start+k+size/2] = a+b, a-b
+				w *= step
+			}
+		}
+	}
+}
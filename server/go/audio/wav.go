@@ -0,0 +1,231 @@
+// Package audio декодирует загруженные аудиофайлы и находит в них доли,
+// темп и сильные доли тактов для сетки счёта проекта
+package audio
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+)
+
+// MaxDuration - наибольшая длительность анализируемой записи, с
+const MaxDuration = 20 * 60
+
+// Частота, до которой прореживается запись перед анализом. Для поиска
+// ударов достаточно полосы до 5 кГц.
+const analysisRate = 11025
+
+// Форматы отсчётов в заголовке WAV
+const (
+	wavFormatPCM        = 1
+	wavFormatFloat      = 3
+	wavFormatExtensible = 0xFFFE
+)
+
+// Ошибки декодирования
+var (
+	ErrUnsupportedFormat = errors.New("unsupported audio format")
+	ErrInvalidWAV        = errors.New("invalid WAV file")
+	ErrTooLong           = errors.New("audio is too long")
+	ErrNoAudio           = errors.New("audio has no samples")
+)
+
+// Clip - моно-запись с частотой SampleRate отсчётов в секунду
+type Clip struct {
+	SampleRate float64
+	Samples    []float64
+}
+
+// Duration возвращает длительность записи в секундах
+func (c *Clip) Duration() float64 {
+	if c.SampleRate <= 0 {
+		return 0
+	}
+	return float64(len(c.Samples)) / c.SampleRate
+}
+
+// wavFormat - содержимое блока fmt
+type wavFormat struct {
+	format     uint16
+	channels   int
+	sampleRate int
+	blockAlign int
+	bits       int
+}
+
+// Decode определяет формат по сигнатуре и декодирует запись в моно,
+// прореживая её до частоты анализа. Поддерживается WAV (PCM 8/16/24/32 бит
+// и float 32/64 бит); для MP3, FLAC и Ogg возвращается ErrUnsupportedFormat.
+func Decode(r io.Reader) (*Clip, error) {
+	br := bufio.NewReaderSize(r, 64*1024)
+	head, _ := br.Peek(12)
+	switch {
+	case len(head) == 12 && string(head[:4]) == "RIFF" && string(head[8:12]) == "WAVE":
+		return decodeWAV(br)
+	case bytes.HasPrefix(head, []byte("ID3")) || (len(head) >= 2 && head[0] == 0xFF && head[1]&0xE0 == 0xE0):
+		return nil, fmt.Errorf("%w: MP3", ErrUnsupportedFormat)
+	case bytes.HasPrefix(head, []byte("fLaC")):
+		return nil, fmt.Errorf("%w: FLAC", ErrUnsupportedFormat)
+	case bytes.HasPrefix(head, []byte("OggS")):
+		return nil, fmt.Errorf("%w: Ogg", ErrUnsupportedFormat)
+	}
+	return nil, ErrUnsupportedFormat
+}
+
+// decodeWAV читает блоки RIFF до блока данных и декодирует отсчёты
+func decodeWAV(r io.Reader) (*Clip, error) {
+	var header [12]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return nil, ErrInvalidWAV
+	}
+
+	var format *wavFormat
+	for {
+		var chunk [8]byte
+		if _, err := io.ReadFull(r, chunk[:]); err != nil {
+			return nil, fmt.Errorf("%w: no data chunk", ErrInvalidWAV)
+		}
+		id, size := string(chunk[:4]), int64(binary.LittleEndian.Uint32(chunk[4:]))
+
+		switch id {
+		case "fmt ":
+			if size < 16 || size > 1024 {
+				return nil, fmt.Errorf("%w: bad fmt chunk", ErrInvalidWAV)
+			}
+			data := make([]byte, size+size%2)
+			if _, err := io.ReadFull(r, data); err != nil {
+				return nil, ErrInvalidWAV
+			}
+			parsed, err := parseWAVFormat(data[:size])
+			if err != nil {
+				return nil, err
+			}
+			format = parsed
+		case "data":
+			if format == nil {
+				return nil, fmt.Errorf("%w: data chunk before fmt chunk", ErrInvalidWAV)
+			}
+			// Размер 0 или 0xFFFFFFFF пишут программы, записывающие поток: данные идут до конца файла
+			if size == 0 || size == 0xFFFFFFFF {
+				size = -1
+			} else if float64(size/int64(format.blockAlign))/float64(format.sampleRate) > MaxDuration {
+				return nil, ErrTooLong
+			}
+			return readWAVSamples(r, format, size)
+		default:
+			if _, err := io.CopyN(io.Discard, r, size+size%2); err != nil {
+				return nil, fmt.Errorf("%w: truncated %q chunk", ErrInvalidWAV, id)
+			}
+		}
+	}
+}
+
+func parseWAVFormat(data []byte) (*wavFormat, error) {
+	f := &wavFormat{
+		format:     binary.LittleEndian.Uint16(data[0:]),
+		channels:   int(binary.LittleEndian.Uint16(data[2:])),
+		sampleRate: int(binary.LittleEndian.Uint32(data[4:])),
+		blockAlign: int(binary.LittleEndian.Uint16(data[12:])),
+		bits:       int(binary.LittleEndian.Uint16(data[14:])),
+	}
+	if f.format == wavFormatExtensible {
+		if len(data) < 26 {
+			return nil, fmt.Errorf("%w: bad extensible fmt chunk", ErrInvalidWAV)
+		}
+		// Первые два байта GUID подформата совпадают с кодом формата
+		f.format = binary.LittleEndian.Uint16(data[24:])
+	}
+
+	switch {
+	case f.format == wavFormatPCM && (f.bits == 8 || f.bits == 16 || f.bits == 24 || f.bits == 32):
+	case f.format == wavFormatFloat && (f.bits == 32 || f.bits == 64):
+	default:
+		return nil, fmt.Errorf("%w: WAV format %d with %d bits", ErrUnsupportedFormat, f.format, f.bits)
+	}
+	if f.channels < 1 || f.channels > 32 || f.sampleRate < 1000 || f.sampleRate > 768000 ||
+		f.blockAlign != f.channels*f.bits/8 {
+		return nil, fmt.Errorf("%w: bad fmt chunk", ErrInvalidWAV)
+	}
+	return f, nil
+}
+
+// readWAVSamples декодирует size байт отсчётов (до конца файла, если size < 0),
+// сводит каналы в моно и усредняет соседние отсчёты до частоты анализа
+func readWAVSamples(r io.Reader, f *wavFormat, size int64) (*Clip, error) {
+	factor := f.sampleRate / analysisRate
+	if factor < 1 {
+		factor = 1
+	}
+	clip := &Clip{SampleRate: float64(f.sampleRate) / float64(factor)}
+	if size > 0 {
+		clip.Samples = make([]float64, 0, size/int64(f.blockAlign)/int64(factor)+1)
+	}
+	maxSamples := int(MaxDuration*clip.SampleRate) + 1
+
+	bytesPerSample := f.bits / 8
+	buf := make([]byte, f.blockAlign*4096)
+	var sum float64
+	var count int
+	var read int64
+	for size < 0 || read < size {
+		chunk := buf
+		if size > 0 && size-read < int64(len(chunk)) {
+			chunk = chunk[:size-read]
+		}
+		n, err := io.ReadFull(r, chunk)
+		n -= n % f.blockAlign
+		read += int64(n)
+		for frame := 0; frame < n; frame += f.blockAlign {
+			var value float64
+			for ch := 0; ch < f.channels; ch++ {
+				value += decodeSample(chunk[frame+ch*bytesPerSample:], f)
+			}
+			sum += value / float64(f.channels)
+			if count++; count == factor {
+				clip.Samples = append(clip.Samples, sum/float64(factor))
+				sum, count = 0, 0
+			}
+		}
+		if len(clip.Samples) > maxSamples {
+			return nil, ErrTooLong
+		}
+		if err != nil || n < len(chunk) {
+			// Обрезанный блок данных или хвост короче кадра декодируется до последнего
+			// целого кадра; дальше читать нельзя - за блоком data идут другие блоки
+			break
+		}
+	}
+	if len(clip.Samples) == 0 {
+		return nil, ErrNoAudio
+	}
+	return clip, nil
+}
+
+// decodeSample переводит отсчёт в диапазон [-1, 1]
+func decodeSample(b []byte, f *wavFormat) float64 {
+	if f.format == wavFormatFloat {
+		value := float64(math.Float32frombits(binary.LittleEndian.Uint32(b)))
+		if f.bits == 64 {
+			value = math.Float64frombits(binary.LittleEndian.Uint64(b))
+		}
+		if math.IsNaN(value) || math.IsInf(value, 0) {
+			return 0
+		}
+		return value
+	}
+	switch f.bits {
+	case 8:
+		return (float64(b[0]) - 128) / 128
+	case 16:
+		return float64(int16(binary.LittleEndian.Uint16(b))) / 32768
+	case 24:
+		value := int32(b[0]) | int32(b[1])<<8 | int32(int8(b[2]))<<16
+		return float64(value) / 8388608
+	default:
+		return float64(int32(binary.LittleEndian.Uint32(b))) / 2147483648
+	}
+}
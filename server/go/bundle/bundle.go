@@ -0,0 +1,298 @@
+// Package bundle упаковывает проект со всеми данными и файлами в zip архив
+// для резервного копирования и переноса между серверами
+package bundle
+
+import (
+	"archive/zip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Формат архива. Version увеличивается при несовместимых изменениях содержимого.
+const (
+	Format  = "dance-flow-project"
+	Version = 1
+
+	ManifestPath = "manifest.json"
+)
+
+// Ограничения на содержимое импортируемого архива. Размеры проверяются по
+// заголовкам zip до распаковки: archive/zip не даёт прочитать из файла
+// больше заявленного размера, поэтому сжатая "бомба" отклоняется сразу.
+const (
+	MaxEntries = 10000
+	// MaxEntrySize - самый большой файл архива, обычно видео репетиции
+	MaxEntrySize = 1 << 30
+	// MaxTotalSize - суммарный размер файлов после распаковки
+	MaxTotalSize = 4 << 30
+)
+
+// Ошибки разбора архива
+var (
+	ErrInvalidBundle      = errors.New("invalid project bundle")
+	ErrUnsupportedVersion = errors.New("unsupported project bundle version")
+	ErrChecksumMismatch   = errors.New("project bundle checksum mismatch")
+)
+
+// FileEntry описывает файл архива и его контрольную сумму
+type FileEntry struct {
+	Path   string `json:"path"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// MediaEntry связывает URL файла в данных проекта с путём в архиве
+type MediaEntry struct {
+	URL  string `json:"url"`
+	Path string `json:"path"`
+}
+
+// Manifest описывает содержимое архива
+type Manifest struct {
+	Format      string       `json:"format"`
+	Version     int          `json:"version"`
+	CreatedAt   time.Time    `json:"createdAt"`
+	ProjectID   string       `json:"projectId"`
+	ProjectName string       `json:"projectName"`
+	Files       []FileEntry  `json:"files"`
+	Media       []MediaEntry `json:"media"`
+}
+
+// Writer последовательно записывает файлы архива, считая их контрольные суммы.
+// Манифест записывается последним при Close.
+type Writer struct {
+	zw       *zip.Writer
+	manifest Manifest
+	paths    map[string]bool
+}
+
+// NewWriter создаёт архив проекта в w
+func NewWriter(w io.Writer, projectID, projectName string) *Writer {
+	return &Writer{
+		zw: zip.NewWriter(w),
+		manifest: Manifest{
+			Format:      Format,
+			Version:     Version,
+			CreatedAt:   time.Now().UTC(),
+			ProjectID:   projectID,
+			ProjectName: projectName,
+			Files:       []FileEntry{},
+			Media:       []MediaEntry{},
+		},
+		paths: make(map[string]bool),
+	}
+}
+
+// WriteFile добавляет в архив файл с содержимым из r
+func (w *Writer) WriteFile(path string, r io.Reader) error {
+	if path == ManifestPath || w.paths[path] {
+		return fmt.Errorf("duplicate bundle entry %q", path)
+	}
+	out, err := w.zw.Create(path)
+	if err != nil {
+		return err
+	}
+	hash := sha256.New()
+	size, err := io.Copy(io.MultiWriter(out, hash), r)
+	if err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+
+	w.paths[path] = true
+	w.manifest.Files = append(w.manifest.Files, FileEntry{
+		Path:   path,
+		Size:   size,
+		SHA256: hex.EncodeToString(hash.Sum(nil)),
+	})
+	return nil
+}
+
+// WriteJSON добавляет в архив значение v в формате JSON
+func (w *Writer) WriteJSON(path string, v interface{}) error {
+	pr, pw := io.Pipe()
+	go func() {
+		encoder := json.NewEncoder(pw)
+		encoder.SetIndent("", "  ")
+		pw.CloseWithError(encoder.Encode(v))
+	}()
+	err := w.WriteFile(path, pr)
+	pr.Close()
+	return err
+}
+
+// WriteMedia добавляет файл, на который ссылается URL в данных проекта
+func (w *Writer) WriteMedia(url, path string, r io.Reader) error {
+	if err := w.WriteFile(path, r); err != nil {
+		return err
+	}
+	w.manifest.Media = append(w.manifest.Media, MediaEntry{URL: url, Path: path})
+	return nil
+}
+
+// Close записывает манифест и завершает архив
+func (w *Writer) Close() error {
+	out, err := w.zw.Create(ManifestPath)
+	if err != nil {
+		return err
+	}
+	encoder := json.NewEncoder(out)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(w.manifest); err != nil {
+		return err
+	}
+	return w.zw.Close()
+}
+
+// Reader читает проверенный архив
+type Reader struct {
+	Manifest Manifest
+	files    map[string]*zip.File
+}
+
+// Open открывает архив, проверяет формат, версию и контрольные суммы всех файлов
+func Open(r io.ReaderAt, size int64) (*Reader, error) {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidBundle, err)
+	}
+	if len(zr.File) > MaxEntries {
+		return nil, fmt.Errorf("%w: too many entries", ErrInvalidBundle)
+	}
+
+	files := make(map[string]*zip.File, len(zr.File))
+	var total uint64
+	for _, f := range zr.File {
+		if _, ok := files[f.Name]; ok {
+			return nil, fmt.Errorf("%w: duplicate entry %q", ErrInvalidBundle, f.Name)
+		}
+		if f.UncompressedSize64 > MaxEntrySize {
+			return nil, fmt.Errorf("%w: %s is too large", ErrInvalidBundle, f.Name)
+		}
+		total += f.UncompressedSize64
+		if total > MaxTotalSize {
+			return nil, fmt.Errorf("%w: unpacked size exceeds %d bytes", ErrInvalidBundle, int64(MaxTotalSize))
+		}
+		files[f.Name] = f
+	}
+
+	manifestFile, ok := files[ManifestPath]
+	if !ok {
+		return nil, fmt.Errorf("%w: manifest is missing", ErrInvalidBundle)
+	}
+	reader := &Reader{files: files}
+	if err := readJSON(manifestFile, &reader.Manifest); err != nil {
+		return nil, fmt.Errorf("%w: manifest: %v", ErrInvalidBundle, err)
+	}
+	manifest := &reader.Manifest
+	if manifest.Format != Format {
+		return nil, fmt.Errorf("%w: unknown format %q", ErrInvalidBundle, manifest.Format)
+	}
+	if manifest.Version < 1 || manifest.Version > Version {
+		return nil, fmt.Errorf("%w: version %d, supported up to %d", ErrUnsupportedVersion, manifest.Version, Version)
+	}
+
+	// Каждый файл архива должен быть описан в манифесте и совпадать с контрольной суммой
+	listed := make(map[string]bool, len(manifest.Files))
+	for _, entry := range manifest.Files {
+		f, ok := files[entry.Path]
+		if !ok {
+			return nil, fmt.Errorf("%w: %s is listed in manifest but missing", ErrInvalidBundle, entry.Path)
+		}
+		if listed[entry.Path] {
+			return nil, fmt.Errorf("%w: %s is listed twice", ErrInvalidBundle, entry.Path)
+		}
+		listed[entry.Path] = true
+		if err := verify(f, entry); err != nil {
+			return nil, err
+		}
+	}
+	for name := range files {
+		if name != ManifestPath && !listed[name] {
+			return nil, fmt.Errorf("%w: %s is not listed in manifest", ErrInvalidBundle, name)
+		}
+	}
+	for _, media := range manifest.Media {
+		if !listed[media.Path] {
+			return nil, fmt.Errorf("%w: media file %s is missing", ErrInvalidBundle, media.Path)
+		}
+	}
+
+	return reader, nil
+}
+
+// Has сообщает, есть ли в архиве файл
+func (r *Reader) Has(path string) bool {
+	_, ok := r.files[path]
+	return ok && path != ManifestPath
+}
+
+// Paths возвращает отсортированные пути файлов архива с заданным префиксом
+func (r *Reader) Paths(prefix string) []string {
+	var paths []string
+	for _, entry := range r.Manifest.Files {
+		if strings.HasPrefix(entry.Path, prefix) {
+			paths = append(paths, entry.Path)
+		}
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// Open открывает файл архива для чтения
+func (r *Reader) Open(path string) (io.ReadCloser, error) {
+	f, ok := r.files[path]
+	if !ok || path == ManifestPath {
+		return nil, fmt.Errorf("%w: %s is missing", ErrInvalidBundle, path)
+	}
+	return f.Open()
+}
+
+// ReadJSON разбирает JSON файл архива в v
+func (r *Reader) ReadJSON(path string, v interface{}) error {
+	f, ok := r.files[path]
+	if !ok || path == ManifestPath {
+		return fmt.Errorf("%w: %s is missing", ErrInvalidBundle, path)
+	}
+	if err := readJSON(f, v); err != nil {
+		return fmt.Errorf("%w: %s: %v", ErrInvalidBundle, path, err)
+	}
+	return nil
+}
+
+func readJSON(f *zip.File, v interface{}) error {
+	rc, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	return json.NewDecoder(io.LimitReader(rc, MaxEntrySize)).Decode(v)
+}
+
+// verify сверяет размер и контрольную сумму файла с манифестом
+func verify(f *zip.File, entry FileEntry) error {
+	if entry.Size > MaxEntrySize || f.UncompressedSize64 > MaxEntrySize {
+		return fmt.Errorf("%w: %s is too large", ErrInvalidBundle, entry.Path)
+	}
+	rc, err := f.Open()
+	if err != nil {
+		return fmt.Errorf("%w: %s: %v", ErrInvalidBundle, entry.Path, err)
+	}
+	defer rc.Close()
+
+	hash := sha256.New()
+	size, err := io.Copy(hash, io.LimitReader(rc, MaxEntrySize+1))
+	if err != nil {
+		return fmt.Errorf("%w: %s: %v", ErrInvalidBundle, entry.Path, err)
+	}
+	if size != entry.Size || hex.EncodeToString(hash.Sum(nil)) != entry.SHA256 {
+		return fmt.Errorf("%w: %s", ErrChecksumMismatch, entry.Path)
+	}
+	return nil
+}
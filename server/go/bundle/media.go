@@ -0,0 +1,72 @@
+package bundle
+
+import (
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Ссылки на загруженные на сервер файлы: видео, аудио, прочие файлы и GLB модели
+var mediaURLPattern = regexp.MustCompile(`/uploads/(?:videos|audio|files|models)/[A-Za-z0-9][A-Za-z0-9._-]*|/models/file/[A-Za-z0-9][A-Za-z0-9._-]*`)
+
+// MediaURLs находит в данных проекта ссылки на загруженные файлы.
+// Ссылки ищутся в тексте, поэтому находятся и внутри вложенных JSON строк (keyframesJson).
+func MediaURLs(data []byte) []string {
+	seen := make(map[string]bool)
+	var urls []string
+	for _, match := range mediaURLPattern.FindAll(data, -1) {
+		url := string(match)
+		if !seen[url] {
+			seen[url] = true
+			urls = append(urls, url)
+		}
+	}
+	sort.Strings(urls)
+	return urls
+}
+
+// LocalPath возвращает путь файла относительно рабочего каталога сервера
+func LocalPath(url string) string {
+	if strings.HasPrefix(url, "/models/file/") {
+		return path.Join("uploads/models", path.Base(url))
+	}
+	return strings.TrimPrefix(url, "/")
+}
+
+// MediaPath возвращает путь файла внутри архива
+func MediaPath(url string) string {
+	return path.Join("media", strings.TrimPrefix(LocalPath(url), "uploads/"))
+}
+
+// Replace заменяет в данных все вхождения ключей replacements на значения.
+// Используется для подмены ссылок на файлы и идентификаторов при импорте.
+func Replace(data []byte, replacements map[string]string) []byte {
+	if len(replacements) == 0 {
+		return data
+	}
+	// Длинные ключи первыми, чтобы ключ-префикс не перехватил более длинное совпадение
+	keys := make([]string, 0, len(replacements))
+	for key := range replacements {
+		if key != "" {
+			keys = append(keys, key)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if len(keys[i]) != len(keys[j]) {
+			return len(keys[i]) > len(keys[j])
+		}
+		return keys[i] < keys[j]
+	})
+	pairs := make([]string, 0, len(keys)*2)
+	for _, key := range keys {
+		pairs = append(pairs, key, replacements[key])
+	}
+	return []byte(strings.NewReplacer(pairs...).Replace(string(data)))
+}
+
+// IsMediaURL сообщает, является ли строка ссылкой на загруженный файл
+func IsMediaURL(url string) bool {
+	match := mediaURLPattern.FindString(url)
+	return match != "" && match == url
+}
@@ -0,0 +1,363 @@
+// Package bvh читает и записывает движение в формате Biovision Hierarchy,
+// с которым работают Blender, MotionBuilder и другие пакеты анимации
+package bvh
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Ограничения на размер импортируемого файла
+const (
+	MaxJoints   = 256
+	MaxFrames   = 100000
+	MaxFileSize = 64 << 20
+)
+
+// ErrInvalidFormat возвращается для файлов, которые не удаётся разобрать как BVH
+var ErrInvalidFormat = errors.New("invalid BVH file")
+
+// Joint - сустав иерархии. Смещение задаётся относительно родителя в позе покоя.
+type Joint struct {
+	Name     string
+	Offset   Vec3
+	Channels []string
+	Children []*Joint
+	// EndSite - смещение конечной точки для суставов без дочерних суставов
+	EndSite *Vec3
+
+	// Индекс первого канала сустава в строке кадра
+	channelIndex int
+}
+
+// Motion - иерархия суставов и значения каналов по кадрам
+type Motion struct {
+	Root      *Joint
+	FrameTime float64
+	Frames    [][]float64
+}
+
+// Joints возвращает суставы в порядке обхода иерархии (порядок каналов в кадре)
+func (m *Motion) Joints() []*Joint {
+	var joints []*Joint
+	var walk func(*Joint)
+	walk = func(j *Joint) {
+		joints = append(joints, j)
+		for _, child := range j.Children {
+			walk(child)
+		}
+	}
+	if m.Root != nil {
+		walk(m.Root)
+	}
+	return joints
+}
+
+// ChannelCount возвращает число значений в одном кадре и расставляет индексы каналов
+func (m *Motion) ChannelCount() int {
+	count := 0
+	for _, joint := range m.Joints() {
+		joint.channelIndex = count
+		count += len(joint.Channels)
+	}
+	return count
+}
+
+// Positions вычисляет мировые координаты суставов в кадре frame
+func (m *Motion) Positions(frame int) map[string]Vec3 {
+	m.ChannelCount()
+	values := m.Frames[frame]
+	positions := make(map[string]Vec3)
+
+	var walk func(j *Joint, parentPos Vec3, parentRot mat3)
+	walk = func(j *Joint, parentPos Vec3, parentRot mat3) {
+		offset := j.Offset
+		local := identity
+		for i, channel := range j.Channels {
+			value := values[j.channelIndex+i]
+			switch channel {
+			case "Xposition":
+				offset[0] += value
+			case "Yposition":
+				offset[1] += value
+			case "Zposition":
+				offset[2] += value
+			default:
+				local = local.mul(axisRotation(channel[0], value))
+			}
+		}
+		position := parentPos.add(parentRot.apply(offset))
+		rotation := parentRot.mul(local)
+		positions[j.Name] = position
+		for _, child := range j.Children {
+			walk(child, position, rotation)
+		}
+	}
+	if m.Root != nil {
+		walk(m.Root, Vec3{}, identity)
+	}
+	return positions
+}
+
+// Parse читает BVH файл; читается не больше MaxFileSize байт
+func Parse(r io.Reader) (*Motion, error) {
+	p := &parser{scanner: bufio.NewScanner(io.LimitReader(r, MaxFileSize))}
+	p.scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	p.scanner.Split(bufio.ScanWords)
+
+	if err := p.expect("HIERARCHY"); err != nil {
+		return nil, err
+	}
+	if err := p.expect("ROOT"); err != nil {
+		return nil, err
+	}
+	motion := &Motion{}
+	root, err := p.joint()
+	if err != nil {
+		return nil, err
+	}
+	motion.Root = root
+
+	if err := p.expect("MOTION"); err != nil {
+		return nil, err
+	}
+	if err := p.expect("Frames:"); err != nil {
+		return nil, err
+	}
+	frameCount, err := p.int()
+	if err != nil {
+		return nil, err
+	}
+	if frameCount < 0 || frameCount > MaxFrames {
+		return nil, fmt.Errorf("%w: frame count must be between 0 and %d", ErrInvalidFormat, MaxFrames)
+	}
+	if err := p.expect("Frame"); err != nil {
+		return nil, err
+	}
+	if err := p.expect("Time:"); err != nil {
+		return nil, err
+	}
+	if motion.FrameTime, err = p.float(); err != nil {
+		return nil, err
+	}
+	if motion.FrameTime <= 0 {
+		return nil, fmt.Errorf("%w: frame time must be positive", ErrInvalidFormat)
+	}
+
+	// Каждое значение занимает хотя бы цифру и разделитель, поэтому заголовок
+	// с большим числом кадров, чем помещается в файл, отклоняется сразу
+	channels := motion.ChannelCount()
+	if frameCount*channels*2 > MaxFileSize {
+		return nil, fmt.Errorf("%w: %d frames of %d channels exceed the file size limit", ErrInvalidFormat, frameCount, channels)
+	}
+
+	// Кадры добавляются по мере чтения: память выделяется под данные, а не под заголовок
+	for i := 0; i < frameCount; i++ {
+		frame := make([]float64, channels)
+		for c := range frame {
+			if frame[c], err = p.float(); err != nil {
+				return nil, fmt.Errorf("frame %d: %w", i, err)
+			}
+		}
+		motion.Frames = append(motion.Frames, frame)
+	}
+	return motion, nil
+}
+
+type parser struct {
+	scanner *bufio.Scanner
+	joints  int
+}
+
+func (p *parser) next() (string, error) {
+	if !p.scanner.Scan() {
+		if err := p.scanner.Err(); err != nil {
+			return "", err
+		}
+		return "", fmt.Errorf("%w: unexpected end of file", ErrInvalidFormat)
+	}
+	return p.scanner.Text(), nil
+}
+
+func (p *parser) expect(token string) error {
+	got, err := p.next()
+	if err != nil {
+		return err
+	}
+	if !strings.EqualFold(got, token) {
+		return fmt.Errorf("%w: expected %q, got %q", ErrInvalidFormat, token, got)
+	}
+	return nil
+}
+
+func (p *parser) float() (float64, error) {
+	token, err := p.next()
+	if err != nil {
+		return 0, err
+	}
+	value, err := strconv.ParseFloat(token, 64)
+	if err != nil || math.IsNaN(value) || math.IsInf(value, 0) {
+		return 0, fmt.Errorf("%w: expected a number, got %q", ErrInvalidFormat, token)
+	}
+	return value, nil
+}
+
+func (p *parser) int() (int, error) {
+	token, err := p.next()
+	if err != nil {
+		return 0, err
+	}
+	value, err := strconv.Atoi(token)
+	if err != nil {
+		return 0, fmt.Errorf("%w: expected an integer, got %q", ErrInvalidFormat, token)
+	}
+	return value, nil
+}
+
+func (p *parser) vector() (Vec3, error) {
+	var v Vec3
+	for i := range v {
+		value, err := p.float()
+		if err != nil {
+			return v, err
+		}
+		v[i] = value
+	}
+	return v, nil
+}
+
+// joint разбирает сустав после ключевого слова ROOT или JOINT
+func (p *parser) joint() (*Joint, error) {
+	p.joints++
+	if p.joints > MaxJoints {
+		return nil, fmt.Errorf("%w: more than %d joints", ErrInvalidFormat, MaxJoints)
+	}
+
+	name, err := p.next()
+	if err != nil {
+		return nil, err
+	}
+	joint := &Joint{Name: name}
+	if err := p.expect("{"); err != nil {
+		return nil, err
+	}
+
+	for {
+		token, err := p.next()
+		if err != nil {
+			return nil, err
+		}
+		switch strings.ToUpper(token) {
+		case "OFFSET":
+			if joint.Offset, err = p.vector(); err != nil {
+				return nil, err
+			}
+		case "CHANNELS":
+			count, err := p.int()
+			if err != nil {
+				return nil, err
+			}
+			if count < 0 || count > 6 {
+				return nil, fmt.Errorf("%w: joint %s has %d channels", ErrInvalidFormat, name, count)
+			}
+			joint.Channels = make([]string, count)
+			for i := range joint.Channels {
+				channel, err := p.next()
+				if err != nil {
+					return nil, err
+				}
+				if !validChannel(channel) {
+					return nil, fmt.Errorf("%w: unknown channel %q", ErrInvalidFormat, channel)
+				}
+				joint.Channels[i] = channel
+			}
+		case "JOINT":
+			child, err := p.joint()
+			if err != nil {
+				return nil, err
+			}
+			joint.Children = append(joint.Children, child)
+		case "END":
+			if err := p.expect("Site"); err != nil {
+				return nil, err
+			}
+			if err := p.expect("{"); err != nil {
+				return nil, err
+			}
+			if err := p.expect("OFFSET"); err != nil {
+				return nil, err
+			}
+			site, err := p.vector()
+			if err != nil {
+				return nil, err
+			}
+			joint.EndSite = &site
+			if err := p.expect("}"); err != nil {
+				return nil, err
+			}
+		case "}":
+			return joint, nil
+		default:
+			return nil, fmt.Errorf("%w: unexpected %q in joint %s", ErrInvalidFormat, token, name)
+		}
+	}
+}
+
+func validChannel(channel string) bool {
+	switch channel {
+	case "Xposition", "Yposition", "Zposition", "Xrotation", "Yrotation", "Zrotation":
+		return true
+	}
+	return false
+}
+
+// Write записывает движение в формате BVH
+func (m *Motion) Write(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	channels := m.ChannelCount()
+
+	fmt.Fprintln(bw, "HIERARCHY")
+	var writeJoint func(j *Joint, depth int, keyword string)
+	writeJoint = func(j *Joint, depth int, keyword string) {
+		indent := strings.Repeat("\t", depth)
+		fmt.Fprintf(bw, "%s%s %s\n%s{\n", indent, keyword, j.Name, indent)
+		fmt.Fprintf(bw, "%s\tOFFSET %s\n", indent, formatVector(j.Offset))
+		fmt.Fprintf(bw, "%s\tCHANNELS %d %s\n", indent, len(j.Channels), strings.Join(j.Channels, " "))
+		for _, child := range j.Children {
+			writeJoint(child, depth+1, "JOINT")
+		}
+		if j.EndSite != nil {
+			fmt.Fprintf(bw, "%s\tEnd Site\n%s\t{\n%s\t\tOFFSET %s\n%s\t}\n", indent, indent, indent, formatVector(*j.EndSite), indent)
+		}
+		fmt.Fprintf(bw, "%s}\n", indent)
+	}
+	if m.Root != nil {
+		writeJoint(m.Root, 0, "ROOT")
+	}
+
+	fmt.Fprintln(bw, "MOTION")
+	fmt.Fprintf(bw, "Frames: %d\n", len(m.Frames))
+	fmt.Fprintf(bw, "Frame Time: %s\n", strconv.FormatFloat(m.FrameTime, 'f', 6, 64))
+	for i, frame := range m.Frames {
+		if len(frame) != channels {
+			return fmt.Errorf("frame %d has %d values, expected %d", i, len(frame), channels)
+		}
+		for c, value := range frame {
+			if c > 0 {
+				bw.WriteByte(' ')
+			}
+			bw.WriteString(strconv.FormatFloat(value, 'f', 4, 64))
+		}
+		bw.WriteByte('\n')
+	}
+	return bw.Flush()
+}
+
+func formatVector(v Vec3) string {
+	return fmt.Sprintf("%.4f %.4f %.4f", v[0], v[1], v[2])
+}
@@ -0,0 +1,139 @@
+package bvh
+
+import "math"
+
+// Vec3 - точка или направление в пространстве BVH (ось Y направлена вверх)
+type Vec3 [3]float64
+
+func (a Vec3) add(b Vec3) Vec3 { return Vec3{a[0] + b[0], a[1] + b[1], a[2] + b[2]} }
+func (a Vec3) sub(b Vec3) Vec3 { return Vec3{a[0] - b[0], a[1] - b[1], a[2] - b[2]} }
+func (a Vec3) scale(k float64) Vec3 {
+	return Vec3{a[0] * k, a[1] * k, a[2] * k}
+}
+func (a Vec3) dot(b Vec3) float64 { return a[0]*b[0] + a[1]*b[1] + a[2]*b[2] }
+func (a Vec3) cross(b Vec3) Vec3 {
+	return Vec3{a[1]*b[2] - a[2]*b[1], a[2]*b[0] - a[0]*b[2], a[0]*b[1] - a[1]*b[0]}
+}
+func (a Vec3) length() float64 { return math.Sqrt(a.dot(a)) }
+
+// normalize возвращает единичный вектор; для нулевого вектора ok=false
+func (a Vec3) normalize() (Vec3, bool) {
+	l := a.length()
+	if l < 1e-9 {
+		return Vec3{}, false
+	}
+	return a.scale(1 / l), true
+}
+
+// mat3 - матрица поворота, mat3[row][col]
+type mat3 [3][3]float64
+
+var identity = mat3{{1, 0, 0}, {0, 1, 0}, {0, 0, 1}}
+
+func (m mat3) mul(n mat3) mat3 {
+	var r mat3
+	for i := 0; i < 3; i++ {
+		for j := 0; j < 3; j++ {
+			r[i][j] = m[i][0]*n[0][j] + m[i][1]*n[1][j] + m[i][2]*n[2][j]
+		}
+	}
+	return r
+}
+
+func (m mat3) apply(v Vec3) Vec3 {
+	return Vec3{
+		m[0][0]*v[0] + m[0][1]*v[1] + m[0][2]*v[2],
+		m[1][0]*v[0] + m[1][1]*v[1] + m[1][2]*v[2],
+		m[2][0]*v[0] + m[2][1]*v[1] + m[2][2]*v[2],
+	}
+}
+
+func (m mat3) transpose() mat3 {
+	var r mat3
+	for i := 0; i < 3; i++ {
+		for j := 0; j < 3; j++ {
+			r[i][j] = m[j][i]
+		}
+	}
+	return r
+}
+
+// axisRotation - поворот на angle градусов вокруг оси BVH-канала ('X', 'Y' или 'Z')
+func axisRotation(axis byte, angle float64) mat3 {
+	s, c := math.Sincos(angle * math.Pi / 180)
+	switch axis {
+	case 'X':
+		return mat3{{1, 0, 0}, {0, c, -s}, {0, s, c}}
+	case 'Y':
+		return mat3{{c, 0, s}, {0, 1, 0}, {-s, 0, c}}
+	default:
+		return mat3{{c, -s, 0}, {s, c, 0}, {0, 0, 1}}
+	}
+}
+
+// basis строит поворот, переводящий оси X и Y в направления x и y.
+// Направление y ортогонализуется к x.
+func basis(x, y Vec3) (mat3, bool) {
+	x, ok := x.normalize()
+	if !ok {
+		return identity, false
+	}
+	y, ok = y.sub(x.scale(x.dot(y))).normalize()
+	if !ok {
+		return identity, false
+	}
+	z := x.cross(y)
+	return mat3{
+		{x[0], y[0], z[0]},
+		{x[1], y[1], z[1]},
+		{x[2], y[2], z[2]},
+	}, true
+}
+
+// swing - минимальный поворот, переводящий направление from в направление to
+func swing(from, to Vec3) mat3 {
+	a, ok1 := from.normalize()
+	b, ok2 := to.normalize()
+	if !ok1 || !ok2 {
+		return identity
+	}
+	v := a.cross(b)
+	c := a.dot(b)
+	if c < -1+1e-9 {
+		// Противоположные направления: поворот на 180° вокруг любой перпендикулярной оси
+		axis, ok := a.cross(Vec3{1, 0, 0}).normalize()
+		if !ok {
+			axis, _ = a.cross(Vec3{0, 1, 0}).normalize()
+		}
+		var r mat3
+		for i := 0; i < 3; i++ {
+			for j := 0; j < 3; j++ {
+				r[i][j] = 2 * axis[i] * axis[j]
+			}
+			r[i][i]--
+		}
+		return r
+	}
+	k := 1 / (1 + c)
+	return mat3{
+		{1 - k*(v[1]*v[1]+v[2]*v[2]), -v[2] + k*v[0]*v[1], v[1] + k*v[0]*v[2]},
+		{v[2] + k*v[0]*v[1], 1 - k*(v[0]*v[0]+v[2]*v[2]), -v[0] + k*v[1]*v[2]},
+		{-v[1] + k*v[0]*v[2], v[0] + k*v[1]*v[2], 1 - k*(v[0]*v[0]+v[1]*v[1])},
+	}
+}
+
+// eulerZXY раскладывает поворот m = Rz(z)·Rx(x)·Ry(y) на углы в градусах
+func eulerZXY(m mat3) (z, x, y float64) {
+	sx := math.Max(-1, math.Min(1, m[2][1]))
+	x = math.Asin(sx)
+	if math.Abs(sx) < 1-1e-9 {
+		z = math.Atan2(-m[0][1], m[1][1])
+		y = math.Atan2(-m[2][0], m[2][2])
+	} else {
+		// Вырожденный случай: поворот вокруг Y неотличим от поворота вокруг Z
+		z = math.Atan2(m[1][0], m[0][0])
+		y = 0
+	}
+	const deg = 180 / math.Pi
+	return z * deg, x * deg, y * deg
+}
@@ -0,0 +1,443 @@
+package bvh
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/kktjss/dance-flow/models"
+	"github.com/kktjss/dance-flow/poseanalysis"
+)
+
+// Параметры преобразования по умолчанию
+const (
+	// DefaultFrameRate - частота кадров экспортируемого файла
+	DefaultFrameRate = 30.0
+	// DefaultScale - число единиц BVH на высоту кадра видео
+	DefaultScale = 100.0
+	// MaxFrameRate - максимальная частота кадров экспорта
+	MaxFrameRate = 120.0
+)
+
+// ErrNoMappedJoints возвращается, если ни один сустав BVH не удалось сопоставить суставам позы
+var ErrNoMappedJoints = errors.New("BVH skeleton has no joints that match pose joints")
+
+// bone описывает сустав экспортируемого скелета: сустав позы, в котором он находится,
+// направление кости в позе покоя и длину кости по умолчанию (в единицах DefaultScale)
+type bone struct {
+	name      string
+	joint     string
+	parent    string
+	direction Vec3
+	length    float64
+}
+
+// Скелет экспорта в позе T: танцор смотрит на камеру (вдоль -Z), левая сторона
+// танцора направлена по +X. Корень Hips находится между тазобедренными суставами,
+// Chest - между плечевыми.
+var exportBones = []bone{
+	{name: "Hips", joint: "mid_hip"},
+	{name: "LeftUpLeg", joint: "left_hip", parent: "Hips", direction: Vec3{1, 0, 0}, length: 8},
+	{name: "LeftLeg", joint: "left_knee", parent: "LeftUpLeg", direction: Vec3{0, -1, 0}, length: 22},
+	{name: "LeftFoot", joint: "left_ankle", parent: "LeftLeg", direction: Vec3{0, -1, 0}, length: 22},
+	{name: "RightUpLeg", joint: "right_hip", parent: "Hips", direction: Vec3{-1, 0, 0}, length: 8},
+	{name: "RightLeg", joint: "right_knee", parent: "RightUpLeg", direction: Vec3{0, -1, 0}, length: 22},
+	{name: "RightFoot", joint: "right_ankle", parent: "RightLeg", direction: Vec3{0, -1, 0}, length: 22},
+	{name: "Chest", joint: "mid_shoulder", parent: "Hips", direction: Vec3{0, 1, 0}, length: 28},
+	{name: "Head", joint: "nose", parent: "Chest", direction: Vec3{0, 1, 0}, length: 12},
+	{name: "LeftArm", joint: "left_shoulder", parent: "Chest", direction: Vec3{1, 0, 0}, length: 10},
+	{name: "LeftForeArm", joint: "left_elbow", parent: "LeftArm", direction: Vec3{1, 0, 0}, length: 15},
+	{name: "LeftHand", joint: "left_wrist", parent: "LeftForeArm", direction: Vec3{1, 0, 0}, length: 14},
+	{name: "RightArm", joint: "right_shoulder", parent: "Chest", direction: Vec3{-1, 0, 0}, length: 10},
+	{name: "RightForeArm", joint: "right_elbow", parent: "RightArm", direction: Vec3{-1, 0, 0}, length: 15},
+	{name: "RightHand", joint: "right_wrist", parent: "RightForeArm", direction: Vec3{-1, 0, 0}, length: 14},
+}
+
+// Конечные точки суставов без потомков (в единицах DefaultScale)
+var exportEndSites = map[string]Vec3{
+	"LeftFoot":  {0, -3, 8},
+	"RightFoot": {0, -3, 8},
+	"Head":      {0, 10, 0},
+	"LeftHand":  {8, 0, 0},
+	"RightHand": {-8, 0, 0},
+}
+
+// Синонимы суставов BVH из распространённых пакетов (Blender, MotionBuilder,
+// Mixamo, CMU) в нижнем регистре без префиксов
+var jointAliases = map[string]string{
+	"head":      "nose",
+	"leftupleg": "left_hip", "leftthigh": "left_hip", "leftupperleg": "left_hip", "lefthip": "left_hip",
+	"leftleg": "left_knee", "leftshin": "left_knee", "leftlowerleg": "left_knee", "leftknee": "left_knee",
+	"leftfoot": "left_ankle", "leftankle": "left_ankle",
+	"lefttoebase": "left_foot_index", "lefttoe": "left_foot_index",
+	"leftarm": "left_shoulder", "leftupperarm": "left_shoulder",
+	"leftforearm": "left_elbow", "leftlowerarm": "left_elbow", "leftelbow": "left_elbow",
+	"lefthand": "left_wrist", "leftwrist": "left_wrist",
+	"rightupleg": "right_hip", "rightthigh": "right_hip", "rightupperleg": "right_hip", "righthip": "right_hip",
+	"rightleg": "right_knee", "rightshin": "right_knee", "rightlowerleg": "right_knee", "rightknee": "right_knee",
+	"rightfoot": "right_ankle", "rightankle": "right_ankle",
+	"righttoebase": "right_foot_index", "righttoe": "right_foot_index",
+	"rightarm": "right_shoulder", "rightupperarm": "right_shoulder",
+	"rightforearm": "right_elbow", "rightlowerarm": "right_elbow", "rightelbow": "right_elbow",
+	"righthand": "right_wrist", "rightwrist": "right_wrist",
+}
+
+// poseJointName сопоставляет имя сустава BVH суставу позы
+func poseJointName(name string) (string, bool) {
+	if i := strings.LastIndexAny(name, ":|"); i >= 0 {
+		name = name[i+1:]
+	}
+	key := strings.ToLower(strings.NewReplacer("_", "", "-", "", " ", "", ".", "").Replace(name))
+	joint, ok := jointAliases[key]
+	return joint, ok
+}
+
+// ExportOptions - параметры экспорта последовательности поз
+type ExportOptions struct {
+	// FrameRate - частота кадров файла; позы интерполируются на равномерную сетку
+	FrameRate float64
+	// Scale - число единиц BVH на высоту кадра видео
+	Scale float64
+}
+
+// FromSequence строит BVH движение по последовательности поз. Длины костей
+// берутся как медиана по кадрам, повороты суставов - так, чтобы кости
+// смотрели в сторону дочерних суставов.
+func FromSequence(sequence *models.PoseSequence, opts ExportOptions) (*Motion, error) {
+	if opts.FrameRate <= 0 {
+		opts.FrameRate = DefaultFrameRate
+	}
+	if opts.Scale <= 0 {
+		opts.Scale = DefaultScale
+	}
+	if len(sequence.Frames) == 0 {
+		return nil, errors.New("pose sequence is empty")
+	}
+	skeleton, err := models.GetSkeleton(sequence.Skeleton)
+	if err != nil {
+		return nil, err
+	}
+
+	frames := resample(sequence.Frames, opts.FrameRate)
+	aspect := sequence.Aspect()
+	positions := make([]map[string]Vec3, len(frames))
+	for i, frame := range frames {
+		positions[i] = worldPositions(frame.Joints, skeleton, aspect, opts.Scale)
+	}
+
+	// Строим иерархию с длинами костей по данным
+	joints := make(map[string]*Joint, len(exportBones))
+	for _, b := range exportBones {
+		joint := &Joint{Name: b.name, Channels: []string{"Zrotation", "Xrotation", "Yrotation"}}
+		if b.parent == "" {
+			joint.Channels = []string{"Xposition", "Yposition", "Zposition", "Zrotation", "Xrotation", "Yrotation"}
+		} else {
+			length := boneLength(positions, parentJoint(b), b.joint)
+			if length == 0 {
+				length = b.length * opts.Scale / DefaultScale
+			}
+			joint.Offset = b.direction.scale(length)
+			joints[b.parent].Children = append(joints[b.parent].Children, joint)
+		}
+		if site, ok := exportEndSites[b.name]; ok {
+			site = site.scale(opts.Scale / DefaultScale)
+			joint.EndSite = &site
+		}
+		joints[b.name] = joint
+	}
+
+	motion := &Motion{Root: joints[exportBones[0].name], FrameTime: 1 / opts.FrameRate}
+	channels := motion.ChannelCount()
+
+	var previous []float64
+	leading := 0
+	for _, p := range positions {
+		values, ok := frameChannels(p, joints, channels)
+		if !ok {
+			if previous == nil {
+				// Танцор ещё не появился: кадр заполнится первой видимой позой
+				leading++
+				continue
+			}
+			// Танцора не видно: повторяем предыдущий кадр
+			values = append([]float64(nil), previous...)
+		}
+		motion.Frames = append(motion.Frames, values)
+		previous = values
+	}
+	if previous == nil {
+		return nil, errors.New("dancer is not visible in any frame")
+	}
+
+	// Начальные кадры без танцора повторяют первую видимую позу, а не стоят в начале координат
+	if leading > 0 {
+		filled := make([][]float64, leading, leading+len(motion.Frames))
+		for i := range filled {
+			filled[i] = append([]float64(nil), motion.Frames[0]...)
+		}
+		motion.Frames = append(filled, motion.Frames...)
+	}
+	return motion, nil
+}
+
+// frameChannels вычисляет значения каналов одного кадра. ok=false, если не виден корень.
+func frameChannels(p map[string]Vec3, joints map[string]*Joint, channels int) ([]float64, bool) {
+	values := make([]float64, channels)
+	root, ok := p["mid_hip"]
+	if !ok {
+		return values, false
+	}
+
+	global := make(map[string]mat3, len(exportBones))
+	for _, b := range exportBones {
+		joint := joints[b.name]
+		parentRot := identity
+		if b.parent != "" {
+			parentRot = global[b.parent]
+		}
+
+		var rotation mat3
+		switch b.name {
+		case "Hips":
+			rotation = frameBasis(p, "left_hip", "right_hip", "mid_shoulder", identity)
+		case "Chest":
+			rotation = frameBasis(p, "left_shoulder", "right_shoulder", "nose", parentRot)
+		default:
+			rotation = parentRot
+			if len(joint.Children) == 1 {
+				child := boneByName(joint.Children[0].Name)
+				from, ok1 := p[b.joint]
+				to, ok2 := p[child.joint]
+				if ok1 && ok2 {
+					rest := parentRot.apply(joint.Children[0].Offset)
+					rotation = swing(rest, to.sub(from)).mul(parentRot)
+				}
+			}
+		}
+		global[b.name] = rotation
+
+		z, x, y := eulerZXY(parentRot.transpose().mul(rotation))
+		i := joint.channelIndex
+		if b.parent == "" {
+			values[i], values[i+1], values[i+2] = root[0], root[1], root[2]
+			i += 3
+		}
+		values[i], values[i+1], values[i+2] = z, x, y
+	}
+	return values, true
+}
+
+// frameBasis строит поворот по паре боковых суставов (ось X - от правого к левому)
+// и суставу сверху (ось Y). Если суставов не видно, возвращается fallback.
+func frameBasis(p map[string]Vec3, left, right, up string, fallback mat3) mat3 {
+	l, ok1 := p[left]
+	r, ok2 := p[right]
+	if !ok1 || !ok2 {
+		return fallback
+	}
+	center := l.add(r).scale(0.5)
+	upDirection := fallback.apply(Vec3{0, 1, 0})
+	if top, ok := p[up]; ok {
+		upDirection = top.sub(center)
+	}
+	rotation, ok := basis(l.sub(r), upDirection)
+	if !ok {
+		return fallback
+	}
+	return rotation
+}
+
+func boneByName(name string) bone {
+	for _, b := range exportBones {
+		if b.name == name {
+			return b
+		}
+	}
+	return bone{}
+}
+
+func parentJoint(b bone) string {
+	return boneByName(b.parent).joint
+}
+
+// boneLength возвращает медиану расстояния между суставами по кадрам или 0
+func boneLength(positions []map[string]Vec3, from, to string) float64 {
+	var lengths []float64
+	for _, p := range positions {
+		a, ok1 := p[from]
+		b, ok2 := p[to]
+		if ok1 && ok2 {
+			lengths = append(lengths, b.sub(a).length())
+		}
+	}
+	if len(lengths) == 0 {
+		return 0
+	}
+	sort.Float64s(lengths)
+	return lengths[len(lengths)/2]
+}
+
+// worldPositions переводит видимые суставы в координаты BVH. Центр кадра по
+// горизонтали - начало координат, нижний край кадра - пол.
+func worldPositions(joints []models.Joint, skeleton *models.Skeleton, aspect, scale float64) map[string]Vec3 {
+	positions := make(map[string]Vec3)
+	for _, joint := range joints {
+		if joint.Visibility < poseanalysis.MinVisibility {
+			continue
+		}
+		positions[joint.Name] = Vec3{
+			(joint.X - 0.5) * aspect * scale,
+			(1 - joint.Y) * scale,
+			-joint.Z * aspect * scale,
+		}
+	}
+	for _, mid := range [][3]string{
+		{"mid_hip", "left_hip", "right_hip"},
+		{"mid_shoulder", "left_shoulder", "right_shoulder"},
+	} {
+		l, ok1 := positions[mid[1]]
+		r, ok2 := positions[mid[2]]
+		if ok1 && ok2 {
+			positions[mid[0]] = l.add(r).scale(0.5)
+		}
+	}
+	return positions
+}
+
+// resample интерполирует позы на равномерную сетку времени с частотой rate
+func resample(frames []models.PoseFrame, rate float64) []models.PoseFrame {
+	start, end := frames[0].Time, frames[len(frames)-1].Time
+	count := int(math.Floor((end-start)*rate+1e-9)) + 1
+	result := make([]models.PoseFrame, 0, count)
+
+	next := 0
+	for i := 0; i < count; i++ {
+		t := start + float64(i)/rate
+		for next < len(frames)-1 && frames[next+1].Time <= t {
+			next++
+		}
+		if next == len(frames)-1 || frames[next].Time >= t {
+			frame := frames[next]
+			frame.Time = t
+			result = append(result, frame)
+			continue
+		}
+		a, b := frames[next], frames[next+1]
+		k := (t - a.Time) / (b.Time - a.Time)
+		result = append(result, models.PoseFrame{Time: t, Joints: interpolateJoints(a.Joints, b.Joints, k)})
+	}
+	return result
+}
+
+// interpolateJoints интерполирует суставы, видимые в обоих кадрах; остальные берутся из ближайшего кадра
+func interpolateJoints(a, b []models.Joint, k float64) []models.Joint {
+	joints := make([]models.Joint, len(a))
+	copy(joints, a)
+	if k >= 0.5 {
+		copy(joints, b)
+	}
+	if len(a) != len(b) {
+		return joints
+	}
+	for i := range joints {
+		if a[i].Name != b[i].Name || a[i].Visibility < poseanalysis.MinVisibility || b[i].Visibility < poseanalysis.MinVisibility {
+			continue
+		}
+		joints[i] = models.Joint{
+			Name:       a[i].Name,
+			X:          a[i].X + (b[i].X-a[i].X)*k,
+			Y:          a[i].Y + (b[i].Y-a[i].Y)*k,
+			Z:          a[i].Z + (b[i].Z-a[i].Z)*k,
+			Visibility: math.Min(a[i].Visibility, b[i].Visibility),
+		}
+	}
+	return joints
+}
+
+// ImportOptions - параметры импорта BVH в позы
+type ImportOptions struct {
+	// Skeleton - формат скелета результата (по умолчанию MediaPipe)
+	Skeleton string
+	// Aspect - отношение ширины кадра к высоте (по умолчанию 1)
+	Aspect float64
+	// Scale - число единиц BVH на высоту кадра. Если 0, движение вписывается в кадр.
+	Scale float64
+}
+
+// ToFrames переводит движение в кадры поз. Суставы позы, которым нет
+// соответствия в BVH, получают нулевую видимость.
+func ToFrames(motion *Motion, opts ImportOptions) ([]models.PoseFrame, error) {
+	if opts.Skeleton == "" {
+		opts.Skeleton = models.SkeletonMediaPipe33
+	}
+	if opts.Aspect <= 0 {
+		opts.Aspect = 1
+	}
+	skeleton, err := models.GetSkeleton(opts.Skeleton)
+	if err != nil {
+		return nil, err
+	}
+
+	mapping := make(map[string]string)
+	for _, joint := range motion.Joints() {
+		if name, ok := poseJointName(joint.Name); ok && skeleton.JointIndex(name) >= 0 {
+			if _, taken := mapping[name]; !taken {
+				mapping[name] = joint.Name
+			}
+		}
+	}
+	if len(mapping) == 0 {
+		return nil, ErrNoMappedJoints
+	}
+
+	all := make([]map[string]Vec3, len(motion.Frames))
+	for i := range motion.Frames {
+		all[i] = motion.Positions(i)
+	}
+
+	// Без масштаба вписываем движение в кадр с полями по 10%
+	scale, centerX, floorY := opts.Scale, 0.0, 0.0
+	if scale <= 0 {
+		minX, maxX, minY, maxY := math.Inf(1), math.Inf(-1), math.Inf(1), math.Inf(-1)
+		for _, positions := range all {
+			for _, name := range mapping {
+				p := positions[name]
+				minX, maxX = math.Min(minX, p[0]), math.Max(maxX, p[0])
+				minY, maxY = math.Min(minY, p[1]), math.Max(maxY, p[1])
+			}
+		}
+		scale = math.Max((maxY-minY)/0.8, (maxX-minX)/(0.8*opts.Aspect))
+		if scale <= 0 || math.IsInf(scale, 0) {
+			scale = DefaultScale
+		}
+		centerX = (minX + maxX) / 2
+		floorY = minY - 0.1*scale
+	}
+
+	frames := make([]models.PoseFrame, len(motion.Frames))
+	for i, positions := range all {
+		joints := make([]models.Joint, 0, len(mapping))
+		for _, name := range skeleton.Joints {
+			source, ok := mapping[name]
+			if !ok {
+				continue
+			}
+			p := positions[source]
+			joints = append(joints, models.Joint{
+				Name:       name,
+				X:          (p[0]-centerX)/(opts.Aspect*scale) + 0.5,
+				Y:          1 - (p[1]-floorY)/scale,
+				Z:          -p[2] / (opts.Aspect * scale),
+				Visibility: 1,
+			})
+		}
+		frame := models.PoseFrame{Time: float64(i) * motion.FrameTime, Joints: joints}
+		if err := frame.Validate(skeleton); err != nil {
+			return nil, fmt.Errorf("frame %d: %w", i, err)
+		}
+		frames[i] = frame
+	}
+	return frames, nil
+}
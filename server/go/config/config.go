@@ -4,6 +4,8 @@ import (
 	"log"
 	"os"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
 )
@@ -14,6 +16,21 @@ type Config struct {
 	JWTSecret      string
 	JWTExpiration  string
 	AllowedOrigins []string
+	// Параметры фонового анализа видео
+	AnalysisWorkers int
+	UseFakeAnalyzer bool
+	// Параметры клиента Python сервера анализа
+	AnalyzerURLs             []string
+	AnalyzerTimeout          time.Duration
+	AnalyzerMaxConcurrency   int
+	AnalyzerMaxRetries       int
+	AnalyzerHealthInterval   time.Duration
+	AnalyzerBreakerThreshold int
+	AnalyzerBreakerCooldown  time.Duration
+	// Параметры исходящих вебхуков
+	WebhookWorkers      int
+	WebhookTimeout      time.Duration
+	WebhookAllowPrivate bool
 }
 
 // Load возвращает конфигурацию
@@ -67,14 +84,77 @@ func Load() *Config {
 	allowedOrigins := []string{"http://localhost:3000", "http://127.0.0.1:3000"}
 	log.Printf("Allowed CORS origins: %v", allowedOrigins)
 
+	// Устанавливаем число параллельных задач анализа видео
+	analysisWorkers := 2
+	if value, err := strconv.Atoi(os.Getenv("ANALYSIS_WORKERS")); err == nil && value > 0 {
+		analysisWorkers = value
+	}
+
+	// Фейковый анализатор позволяет работать без Python сервера
+	useFakeAnalyzer := os.Getenv("ANALYZER_FAKE") == "true"
+	if useFakeAnalyzer {
+		log.Println("Warning: ANALYZER_FAKE is set, video analysis jobs will produce synthetic poses")
+	}
+
+	// Устанавливаем адреса серверов анализа (через запятую)
+	analyzerURLs := splitList(os.Getenv("ANALYZER_URLS"))
+	if len(analyzerURLs) == 0 {
+		analyzerURLs = []string{"http://127.0.0.1:8000"}
+	}
+	log.Printf("Analyzer backends: %v", analyzerURLs)
+
 	config := &Config{
-		Port:           port,
-		MongoURI:       mongoURI,
-		JWTSecret:      jwtSecret,
-		JWTExpiration:  jwtExpiration,
-		AllowedOrigins: allowedOrigins,
+		Port:            port,
+		MongoURI:        mongoURI,
+		JWTSecret:       jwtSecret,
+		JWTExpiration:   jwtExpiration,
+		AllowedOrigins:  allowedOrigins,
+		AnalysisWorkers: analysisWorkers,
+		UseFakeAnalyzer: useFakeAnalyzer,
+
+		AnalyzerURLs:             analyzerURLs,
+		AnalyzerTimeout:          envDuration("ANALYZER_TIMEOUT", 30*time.Second),
+		AnalyzerMaxConcurrency:   envInt("ANALYZER_MAX_CONCURRENCY", 8),
+		AnalyzerMaxRetries:       envInt("ANALYZER_MAX_RETRIES", 2),
+		AnalyzerHealthInterval:   envDuration("ANALYZER_HEALTH_INTERVAL", 10*time.Second),
+		AnalyzerBreakerThreshold: envInt("ANALYZER_BREAKER_THRESHOLD", 5),
+		AnalyzerBreakerCooldown:  envDuration("ANALYZER_BREAKER_COOLDOWN", 30*time.Second),
+
+		WebhookWorkers: envInt("WEBHOOK_WORKERS", 4),
+		WebhookTimeout: envDuration("WEBHOOK_TIMEOUT", 10*time.Second),
+		// Вебхуки на адреса локальной сети разрешаются только для разработки
+		WebhookAllowPrivate: os.Getenv("WEBHOOK_ALLOW_PRIVATE") == "true",
 	}
 	
 	log.Printf("Configuration loaded successfully")
 	return config
-} 
\ No newline at end of file
+}
+
+// envInt читает неотрицательное целое из переменной окружения
+func envInt(name string, fallback int) int {
+	value, err := strconv.Atoi(os.Getenv(name))
+	if err != nil || value < 0 {
+		return fallback
+	}
+	return value
+}
+
+// envDuration читает длительность вида "10s" из переменной окружения
+func envDuration(name string, fallback time.Duration) time.Duration {
+	value, err := time.ParseDuration(os.Getenv(name))
+	if err != nil || value <= 0 {
+		return fallback
+	}
+	return value
+}
+
+// splitList разбирает список значений через запятую
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
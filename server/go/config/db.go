@@ -16,11 +16,21 @@ var DB *mongo.Database
 
 // Коллекции
 var (
-	UsersCollection      *mongo.Collection
-	ProjectsCollection   *mongo.Collection
-	TeamsCollection      *mongo.Collection
-	KeyframesCollection  *mongo.Collection
-	HistoryCollection    *mongo.Collection
+	UsersCollection         *mongo.Collection
+	ProjectsCollection      *mongo.Collection
+	TeamsCollection         *mongo.Collection
+	KeyframesCollection     *mongo.Collection
+	HistoryCollection       *mongo.Collection
+	PoseTracksCollection    *mongo.Collection
+	PoseChunksCollection    *mongo.Collection
+	AnalysisJobsCollection  *mongo.Collection
+	CommentsCollection      *mongo.Collection
+	NotificationsCollection *mongo.Collection
+	WebhooksCollection      *mongo.Collection
+	// Доставки вебхуков
+	WebhookDeliveriesCollection *mongo.Collection
+	// Неизменяемый журнал аудита
+	AuditLogCollection *mongo.Collection
 )
 
 // Connect устанавливает соединение с MongoDB
@@ -45,15 +55,28 @@ func Connect(mongoURI string) error {
 
 	log.Println("Подключено к MongoDB")
 
-	// Установка базы данных и коллекций
-	DB = client.Database("dance-platform")
+	UseDatabase(client.Database("dance-platform"))
+
+	return nil
+}
+
+// UseDatabase устанавливает базу данных и коллекции. Вызывается из Connect,
+// а в тестах - с базой на заглушке драйвера.
+func UseDatabase(db *mongo.Database) {
+	DB = db
 	UsersCollection = DB.Collection("users")
 	ProjectsCollection = DB.Collection("projects")
 	TeamsCollection = DB.Collection("teams")
 	KeyframesCollection = DB.Collection("keyframes")
-	HistoryCollection = DB.Collection("history")
-
-	return nil
+	HistoryCollection = DB.Collection("histories")
+	PoseTracksCollection = DB.Collection("poseTracks")
+	PoseChunksCollection = DB.Collection("poseTrackChunks")
+	AnalysisJobsCollection = DB.Collection("analysisJobs")
+	CommentsCollection = DB.Collection("comments")
+	NotificationsCollection = DB.Collection("notifications")
+	WebhooksCollection = DB.Collection("webhooks")
+	WebhookDeliveriesCollection = DB.Collection("webhookDeliveries")
+	AuditLogCollection = DB.Collection("auditLog")
 }
 
 // Close закрывает соединение с MongoDB
@@ -0,0 +1,73 @@
+package formation
+
+import "math"
+
+// Assign решает задачу о назначениях венгерским алгоритмом: каждой строке
+// матрицы стоимостей сопоставляется свой столбец так, чтобы сумма была
+// минимальной. Строк должно быть не больше, чем столбцов. Возвращает номер
+// столбца для каждой строки.
+func Assign(cost [][]float64) []int {
+	n := len(cost)
+	if n == 0 {
+		return []int{}
+	}
+	m := len(cost[0])
+
+	// Потенциалы строк u и столбцов v, way - предыдущий столбец в дополняющей цепи.
+	// Индексы с единицы, нулевой столбец - фиктивный.
+	u := make([]float64, n+1)
+	v := make([]float64, m+1)
+	match := make([]int, m+1) // match[j] - строка, назначенная столбцу j
+	way := make([]int, m+1)
+
+	for i := 1; i <= n; i++ {
+		match[0] = i
+		j0 := 0
+		minv := make([]float64, m+1)
+		used := make([]bool, m+1)
+		for j := range minv {
+			minv[j] = math.Inf(1)
+		}
+		for {
+			used[j0] = true
+			i0, delta, j1 := match[j0], math.Inf(1), 0
+			for j := 1; j <= m; j++ {
+				if used[j] {
+					continue
+				}
+				if current := cost[i0-1][j-1] - u[i0] - v[j]; current < minv[j] {
+					minv[j], way[j] = current, j0
+				}
+				if minv[j] < delta {
+					delta, j1 = minv[j], j
+				}
+			}
+			for j := 0; j <= m; j++ {
+				if used[j] {
+					u[match[j]] += delta
+					v[j] -= delta
+				} else {
+					minv[j] -= delta
+				}
+			}
+			j0 = j1
+			if match[j0] == 0 {
+				break
+			}
+		}
+		// Переназначаем столбцы вдоль найденной цепи
+		for j0 != 0 {
+			j1 := way[j0]
+			match[j0] = match[j1]
+			j0 = j1
+		}
+	}
+
+	assignment := make([]int, n)
+	for j := 1; j <= m; j++ {
+		if match[j] != 0 {
+			assignment[match[j]-1] = j - 1
+		}
+	}
+	return assignment
+}
@@ -0,0 +1,87 @@
+package formation
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Color - цвет элемента в RGB
+type Color struct {
+	R, G, B uint8
+}
+
+// DefaultColor - цвет фона элемента по умолчанию, как при нормализации элементов
+var DefaultColor = Color{0xcc, 0xcc, 0xcc}
+
+// Цвета, которые редактор задаёт по имени
+var namedColors = map[string]Color{
+	"black":  {0, 0, 0},
+	"white":  {255, 255, 255},
+	"red":    {255, 0, 0},
+	"green":  {0, 128, 0},
+	"blue":   {0, 0, 255},
+	"yellow": {255, 255, 0},
+	"orange": {255, 165, 0},
+	"purple": {128, 0, 128},
+	"pink":   {255, 192, 203},
+	"gray":   {128, 128, 128},
+	"grey":   {128, 128, 128},
+}
+
+// ParseColor разбирает цвет CSS в форматах #rgb, #rrggbb, #rrggbbaa,
+// rgb()/rgba() и основные имена цветов. Прозрачность не учитывается.
+func ParseColor(value string) (Color, bool) {
+	value = strings.ToLower(strings.TrimSpace(value))
+	if color, ok := namedColors[value]; ok {
+		return color, true
+	}
+
+	if strings.HasPrefix(value, "#") {
+		hex := value[1:]
+		switch len(hex) {
+		case 3, 4:
+			hex = string([]byte{hex[0], hex[0], hex[1], hex[1], hex[2], hex[2]})
+		case 6, 8:
+			hex = hex[:6]
+		default:
+			return Color{}, false
+		}
+		n, err := strconv.ParseUint(hex, 16, 32)
+		if err != nil {
+			return Color{}, false
+		}
+		return Color{uint8(n >> 16), uint8(n >> 8), uint8(n)}, true
+	}
+
+	for _, prefix := range []string{"rgba(", "rgb("} {
+		if !strings.HasPrefix(value, prefix) || !strings.HasSuffix(value, ")") {
+			continue
+		}
+		parts := strings.Split(value[len(prefix):len(value)-1], ",")
+		if len(parts) < 3 || len(parts) > 4 {
+			return Color{}, false
+		}
+		var channels [3]uint8
+		for i := range channels {
+			n, err := strconv.ParseFloat(strings.TrimSpace(parts[i]), 64)
+			if err != nil || n < 0 || n > 255 {
+				return Color{}, false
+			}
+			channels[i] = uint8(n + 0.5)
+		}
+		return Color{channels[0], channels[1], channels[2]}, true
+	}
+	return Color{}, false
+}
+
+// Hex возвращает цвет в формате #rrggbb
+func (c Color) Hex() string {
+	return fmt.Sprintf("#%02x%02x%02x", c.R, c.G, c.B)
+}
+
+// MarshalJSON записывает цвет в формате #rrggbb
+func (c Color) MarshalJSON() ([]byte, error) {
+	return json.Marshal(c.Hex())
+}
@@ -0,0 +1,294 @@
+package formation
+
+import (
+	"errors"
+	"math"
+	"sort"
+)
+
+// Ограничения проверки расстановки
+const (
+	DefaultConflictStep = 0.1
+	MinConflictStep     = 0.01
+	MaxConflictSamples  = 20000
+	MaxConflictElements = 100
+)
+
+// Виды конфликтов
+const (
+	ConflictOverlap  = "overlap"
+	ConflictCrossing = "crossing"
+)
+
+// Ошибки проверки расстановки
+var (
+	ErrTooManySamples  = errors.New("too many timeline samples")
+	ErrTooManyElements = errors.New("too many elements to check")
+)
+
+// ConflictOptions задаёт проверку расстановки. MinDistance - минимальное
+// расстояние между центрами элементов; если 0, конфликтом считается
+// пересечение самих элементов. Step - шаг выборки времени; моменты ключевых
+// кадров добавляются всегда, поэтому движение между выборками линейно и
+// сближение между ними находится точно. Если To не больше From, проверяется
+// весь интервал ключевых кадров.
+type ConflictOptions struct {
+	MinDistance float64
+	Step        float64
+	From        float64
+	To          float64
+	// ElementIDs ограничивает проверку элементами; по умолчанию проверяются
+	// все элементы, кроме текстовых подписей
+	ElementIDs []string
+}
+
+// Conflict - интервал, в котором два элемента находятся ближе допустимого.
+// Time - момент наибольшего сближения, Distance - расстояние в этот момент,
+// Position - середина между элементами. Crossing означает, что пути элементов
+// пересекаются в одно и то же время.
+type Conflict struct {
+	Type       string    `json:"type"`
+	ElementIDs [2]string `json:"elementIds"`
+	StartTime  float64   `json:"startTime"`
+	EndTime    float64   `json:"endTime"`
+	Time       float64   `json:"time"`
+	Distance   float64   `json:"distance"`
+	Required   float64   `json:"required"`
+	Position   Point     `json:"position"`
+}
+
+// sample - положение элемента в момент выборки
+type sample struct {
+	center  Point
+	size    float64
+	visible bool
+}
+
+// FindConflicts находит сближения и пересечения путей элементов.
+// Результат упорядочен по времени начала конфликта.
+func FindConflicts(elements []interface{}, opts ConflictOptions) ([]Conflict, error) {
+	if opts.Step == 0 {
+		opts.Step = DefaultConflictStep
+	}
+	if opts.Step < MinConflictStep || math.IsNaN(opts.Step) {
+		opts.Step = MinConflictStep
+	}
+
+	parsed := selectElements(parseElements(elements), opts.ElementIDs)
+	if len(parsed) > MaxConflictElements {
+		return nil, ErrTooManyElements
+	}
+	times, err := sampleTimes(parsed, opts)
+	if err != nil {
+		return nil, err
+	}
+	if len(parsed) < 2 || len(times) == 0 {
+		return []Conflict{}, nil
+	}
+
+	samples := make([][]sample, len(parsed))
+	for i := range parsed {
+		samples[i] = make([]sample, len(times))
+		for k, t := range times {
+			state := parsed[i].at(t)
+			samples[i][k] = sample{
+				center:  parsed[i].center(state),
+				size:    (parsed[i].width + parsed[i].height) / 2 * state.scale,
+				visible: state.opacity > 0,
+			}
+		}
+	}
+
+	conflicts := []Conflict{}
+	for i := 0; i < len(parsed); i++ {
+		for j := i + 1; j < len(parsed); j++ {
+			ids := [2]string{parsed[i].id, parsed[j].id}
+			conflicts = append(conflicts, pairConflicts(ids, samples[i], samples[j], times, opts.MinDistance)...)
+		}
+	}
+	sort.SliceStable(conflicts, func(a, b int) bool { return conflicts[a].StartTime < conflicts[b].StartTime })
+	return conflicts, nil
+}
+
+// pairConflicts проверяет пару элементов по интервалам между выборками
+// и объединяет соседние интервалы сближения в один конфликт
+func pairConflicts(ids [2]string, a, b []sample, times []float64, minDistance float64) []Conflict {
+	var conflicts []Conflict
+	var current *Conflict
+	closeCurrent := func() {
+		if current != nil {
+			conflicts = append(conflicts, *current)
+			current = nil
+		}
+	}
+
+	for k := range times {
+		if !a[k].visible || !b[k].visible {
+			closeCurrent()
+			continue
+		}
+		required := minDistance
+		if required == 0 {
+			required = (a[k].size + b[k].size) / 2
+		}
+
+		// Без следующей выборки (или если элемент в ней скрыт) проверяется только текущий момент
+		next := k + 1
+		if next == len(times) || !a[next].visible || !b[next].visible {
+			next = k
+		} else if minDistance == 0 {
+			required = math.Max(required, (a[next].size+b[next].size)/2)
+		}
+
+		ratio, distance := closestApproach(a[k].center, a[next].center, b[k].center, b[next].center)
+		if distance >= required {
+			closeCurrent()
+			continue
+		}
+
+		duration := times[next] - times[k]
+		enter, leave := contactInterval(a[k].center, a[next].center, b[k].center, b[next].center, required)
+		crossing := next != k && segmentsCross(a[k].center, a[next].center, b[k].center, b[next].center)
+		if current == nil {
+			current = &Conflict{
+				Type:       ConflictOverlap,
+				ElementIDs: ids,
+				StartTime:  times[k] + duration*enter,
+				Distance:   math.Inf(1),
+			}
+		}
+		current.EndTime = times[k] + duration*leave
+		current.Required = math.Max(current.Required, required)
+		if crossing {
+			current.Type = ConflictCrossing
+		}
+		if distance < current.Distance {
+			pa, pb := lerpPoint(a[k].center, a[next].center, ratio), lerpPoint(b[k].center, b[next].center, ratio)
+			current.Time = times[k] + duration*ratio
+			current.Distance = distance
+			current.Position = Point{X: (pa.X + pb.X) / 2, Y: (pa.Y + pb.Y) / 2}
+		}
+		// Конфликт продолжается, только если элементы близки и в конце интервала
+		if next == k || leave < 1 {
+			closeCurrent()
+		}
+	}
+	closeCurrent()
+	return conflicts
+}
+
+// closestApproach находит момент (долю интервала) наименьшего расстояния между
+// точками, равномерно движущимися из a0 в a1 и из b0 в b1, и само расстояние
+func closestApproach(a0, a1, b0, b1 Point) (float64, float64) {
+	dx, dy := b0.X-a0.X, b0.Y-a0.Y
+	vx, vy := (b1.X-a1.X)-dx, (b1.Y-a1.Y)-dy
+	ratio := 0.0
+	if speed := vx*vx + vy*vy; speed > 0 {
+		ratio = math.Max(0, math.Min(1, -(dx*vx+dy*vy)/speed))
+	}
+	return ratio, math.Hypot(dx+vx*ratio, dy+vy*ratio)
+}
+
+// contactInterval возвращает долю интервала, в которой расстояние между
+// равномерно движущимися точками меньше required
+func contactInterval(a0, a1, b0, b1 Point, required float64) (float64, float64) {
+	dx, dy := b0.X-a0.X, b0.Y-a0.Y
+	vx, vy := (b1.X-a1.X)-dx, (b1.Y-a1.Y)-dy
+	// |d + v*s|^2 = required^2
+	qa := vx*vx + vy*vy
+	if qa == 0 {
+		return 0, 1
+	}
+	qb := 2 * (dx*vx + dy*vy)
+	qc := dx*dx + dy*dy - required*required
+	root := math.Sqrt(math.Max(qb*qb-4*qa*qc, 0))
+	enter := math.Max(0, (-qb-root)/(2*qa))
+	leave := math.Min(1, (-qb+root)/(2*qa))
+	return enter, leave
+}
+
+// segmentsCross сообщает, что отрезки p1p2 и q1q2 пересекаются или касаются
+// под углом. Отрезки на одной прямой не считаются пересекающимися: это
+// встречное движение, а не пересечение путей.
+func segmentsCross(p1, p2, q1, q2 Point) bool {
+	cross := func(o, a, b Point) float64 {
+		return (a.X-o.X)*(b.Y-o.Y) - (a.Y-o.Y)*(b.X-o.X)
+	}
+	d1, d2 := cross(q1, q2, p1), cross(q1, q2, p2)
+	d3, d4 := cross(p1, p2, q1), cross(p1, p2, q2)
+	if d1 == 0 && d2 == 0 {
+		return false
+	}
+	return d1*d2 <= 0 && d3*d4 <= 0
+}
+
+func lerpPoint(from, to Point, ratio float64) Point {
+	return Point{X: from.X + (to.X-from.X)*ratio, Y: from.Y + (to.Y-from.Y)*ratio}
+}
+
+// selectElements оставляет указанные элементы или все, кроме текстовых подписей
+func selectElements(elements []element, ids []string) []element {
+	selected := make([]element, 0, len(elements))
+	wanted := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		wanted[id] = true
+	}
+	for _, el := range elements {
+		if (len(ids) == 0 && el.shape != "text") || wanted[el.id] {
+			selected = append(selected, el)
+		}
+	}
+	return selected
+}
+
+// sampleTimes возвращает моменты выборки: равномерную сетку с шагом Step
+// и моменты ключевых кадров внутри интервала
+func sampleTimes(elements []element, opts ConflictOptions) ([]float64, error) {
+	from, to := opts.From, opts.To
+	if !(to > from) {
+		from, to = math.Inf(1), math.Inf(-1)
+		for _, el := range elements {
+			for _, kf := range el.keyframes {
+				from, to = math.Min(from, kf.time), math.Max(to, kf.time)
+			}
+		}
+		if math.IsInf(from, 1) {
+			// Без ключевых кадров элементы неподвижны, достаточно одного момента
+			from, to = 0, 0
+		}
+	}
+	if (to-from)/opts.Step >= MaxConflictSamples {
+		return nil, ErrTooManySamples
+	}
+
+	times := []float64{}
+	for k := 0; ; k++ {
+		t := from + float64(k)*opts.Step
+		if t > to {
+			break
+		}
+		times = append(times, t)
+	}
+	if times[len(times)-1] < to {
+		times = append(times, to)
+	}
+	for _, el := range elements {
+		for _, kf := range el.keyframes {
+			if kf.time > from && kf.time < to {
+				times = append(times, kf.time)
+			}
+		}
+	}
+	sort.Float64s(times)
+
+	unique := times[:1]
+	for _, t := range times[1:] {
+		if t-unique[len(unique)-1] > 1e-9 {
+			unique = append(unique, t)
+		}
+	}
+	if len(unique) > MaxConflictSamples {
+		return nil, ErrTooManySamples
+	}
+	return unique, nil
+}
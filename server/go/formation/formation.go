@@ -0,0 +1,283 @@
+// Package formation строит схемы расстановки танцоров на сцене в заданные
+// моменты времени и выводит их в SVG и многостраничный PDF для печати
+package formation
+
+import (
+	"errors"
+	"math"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/kktjss/dance-flow/models"
+)
+
+// MaxCharts ограничивает число схем в одном документе
+const MaxCharts = 200
+
+// Максимальная длина подписи элемента в символах
+const maxLabelLength = 24
+
+// Ошибки построения схем
+var (
+	ErrTooManyCharts = errors.New("too many formation charts")
+	ErrNoCharts      = errors.New("no formation charts to render")
+	ErrInvalidStage  = errors.New("stage size must be positive")
+)
+
+// Point - точка на сцене в координатах холста
+type Point struct {
+	X float64 `json:"x"`
+	Y float64 `json:"y"`
+}
+
+// Marker - элемент проекта на схеме. Center - центр элемента, Next - центр
+// в следующем ключевом кадре, если элемент после этого момента сдвигается.
+type Marker struct {
+	ID      string  `json:"id"`
+	Label   string  `json:"label"`
+	Shape   string  `json:"shape"`
+	Color   Color   `json:"color"`
+	Center  Point   `json:"center"`
+	Width   float64 `json:"width"`
+	Height  float64 `json:"height"`
+	Opacity float64 `json:"opacity"`
+	Next    *Point  `json:"next,omitempty"`
+}
+
+// Chart - расстановка элементов в момент Time
+type Chart struct {
+	Time    float64  `json:"time"`
+	Markers []Marker `json:"markers"`
+}
+
+// Stage - сцена в координатах холста, на котором расставлены элементы.
+// Wing - ширина кулис с каждой стороны, Grid - шаг сетки (0 - без сетки).
+type Stage struct {
+	Width      float64 `json:"width"`
+	Height     float64 `json:"height"`
+	Wing       float64 `json:"wing,omitempty"`
+	Grid       float64 `json:"grid,omitempty"`
+	CenterLine bool    `json:"centerLine"`
+}
+
+// Document - набор схем проекта для вывода
+type Document struct {
+	Title  string
+	Stage  Stage
+	Charts []Chart
+}
+
+// validate проверяет, что документ можно вывести
+func (doc *Document) validate() error {
+	if len(doc.Charts) == 0 {
+		return ErrNoCharts
+	}
+	if len(doc.Charts) > MaxCharts {
+		return ErrTooManyCharts
+	}
+	stage := doc.Stage
+	if !(stage.Width > 0 && stage.Height > 0) || math.IsInf(stage.Width, 0) || math.IsInf(stage.Height, 0) ||
+		!(stage.Wing >= 0 && stage.Grid >= 0) || math.IsInf(stage.Wing, 0) || math.IsInf(stage.Grid, 0) {
+		return ErrInvalidStage
+	}
+	return nil
+}
+
+// keyframe - состояние элемента в ключевом кадре
+type keyframe struct {
+	time     float64
+	position Point
+	opacity  float64
+	scale    float64
+}
+
+// element - элемент проекта, разобранный из карты
+type element struct {
+	id        string
+	label     string
+	shape     string
+	color     Color
+	position  Point
+	width     float64
+	height    float64
+	opacity   float64
+	keyframes []keyframe
+}
+
+// KeyframeTimes возвращает отсортированные моменты всех ключевых кадров элементов
+func KeyframeTimes(elements []interface{}) []float64 {
+	seen := make(map[float64]bool)
+	times := []float64{}
+	for _, el := range parseElements(elements) {
+		for _, kf := range el.keyframes {
+			if !seen[kf.time] {
+				seen[kf.time] = true
+				times = append(times, kf.time)
+			}
+		}
+	}
+	sort.Float64s(times)
+	return times
+}
+
+// Build строит схемы расстановки элементов в указанные моменты времени.
+// Положение между ключевыми кадрами интерполируется линейно, как в редакторе.
+func Build(elements []interface{}, times []float64, stage Stage) ([]Chart, error) {
+	if len(times) > MaxCharts {
+		return nil, ErrTooManyCharts
+	}
+	parsed := parseElements(elements)
+	// Смещения меньше этого порога не считаются движением
+	threshold := math.Hypot(stage.Width, stage.Height) * 1e-3
+
+	charts := make([]Chart, 0, len(times))
+	for _, t := range times {
+		chart := Chart{Time: t, Markers: []Marker{}}
+		for _, el := range parsed {
+			state := el.at(t)
+			if state.opacity <= 0 {
+				continue
+			}
+			marker := Marker{
+				ID:      el.id,
+				Label:   el.label,
+				Shape:   el.shape,
+				Color:   el.color,
+				Center:  el.center(state),
+				Width:   el.width * state.scale,
+				Height:  el.height * state.scale,
+				Opacity: state.opacity,
+			}
+			for _, kf := range el.keyframes {
+				if kf.time <= t {
+					continue
+				}
+				next := el.center(kf)
+				if math.Hypot(next.X-marker.Center.X, next.Y-marker.Center.Y) > threshold {
+					marker.Next = &next
+					break
+				}
+			}
+			chart.Markers = append(chart.Markers, marker)
+		}
+		charts = append(charts, chart)
+	}
+	return charts, nil
+}
+
+// at возвращает состояние элемента в момент t
+func (el *element) at(t float64) keyframe {
+	kfs := el.keyframes
+	if len(kfs) == 0 {
+		return keyframe{time: t, position: el.position, opacity: el.opacity, scale: 1}
+	}
+	if t <= kfs[0].time {
+		return kfs[0]
+	}
+	last := kfs[len(kfs)-1]
+	if t >= last.time {
+		return last
+	}
+	i := sort.Search(len(kfs), func(i int) bool { return kfs[i].time > t })
+	a, b := kfs[i-1], kfs[i]
+	ratio := (t - a.time) / (b.time - a.time)
+	lerp := func(from, to float64) float64 { return from + (to-from)*ratio }
+	return keyframe{
+		time:     t,
+		position: Point{X: lerp(a.position.X, b.position.X), Y: lerp(a.position.Y, b.position.Y)},
+		opacity:  lerp(a.opacity, b.opacity),
+		scale:    lerp(a.scale, b.scale),
+	}
+}
+
+// center возвращает центр элемента: позиция в данных - левый верхний угол
+func (el *element) center(state keyframe) Point {
+	return Point{
+		X: state.position.X + el.width*state.scale/2,
+		Y: state.position.Y + el.height*state.scale/2,
+	}
+}
+
+// parseElements разбирает элементы проекта, пропуская некорректные
+func parseElements(elements []interface{}) []element {
+	parsed := make([]element, 0, len(elements))
+	for _, raw := range elements {
+		data, ok := raw.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		el := element{
+			id:      stringField(data, "id"),
+			shape:   stringField(data, "type"),
+			width:   100,
+			height:  100,
+			opacity: 1,
+		}
+		el.label = elementLabel(data, el.shape)
+		if position, ok := data["position"].(map[string]interface{}); ok {
+			el.position.X = models.ConvertToFloat64(position["x"], 100)
+			el.position.Y = models.ConvertToFloat64(position["y"], 100)
+		}
+		if size, ok := data["size"].(map[string]interface{}); ok {
+			el.width = math.Max(models.ConvertToFloat64(size["width"], 100), 0)
+			el.height = math.Max(models.ConvertToFloat64(size["height"], 100), 0)
+		}
+		el.color = DefaultColor
+		if style, ok := data["style"].(map[string]interface{}); ok {
+			if color, ok := ParseColor(stringField(style, "backgroundColor")); ok {
+				el.color = color
+			}
+			el.opacity = models.ConvertToFloat64(style["opacity"], 1)
+		}
+
+		if keyframes, ok := data["keyframes"].([]interface{}); ok {
+			for _, rawKeyframe := range keyframes {
+				kfData, ok := rawKeyframe.(map[string]interface{})
+				if !ok {
+					continue
+				}
+				kf := keyframe{
+					time:     models.ConvertToFloat64(kfData["time"], math.NaN()),
+					position: el.position,
+					opacity:  models.ConvertToFloat64(kfData["opacity"], 1),
+					scale:    models.ConvertToFloat64(kfData["scale"], 1),
+				}
+				if math.IsNaN(kf.time) || math.IsInf(kf.time, 0) {
+					continue
+				}
+				if position, ok := kfData["position"].(map[string]interface{}); ok {
+					kf.position.X = models.ConvertToFloat64(position["x"], el.position.X)
+					kf.position.Y = models.ConvertToFloat64(position["y"], el.position.Y)
+				}
+				el.keyframes = append(el.keyframes, kf)
+			}
+			sort.SliceStable(el.keyframes, func(i, j int) bool { return el.keyframes[i].time < el.keyframes[j].time })
+		}
+		parsed = append(parsed, el)
+	}
+	return parsed
+}
+
+// elementLabel выбирает подпись элемента: название или текст фигуры.
+// У изображений и моделей содержимым служит ссылка, поэтому она не выводится.
+func elementLabel(data map[string]interface{}, shape string) string {
+	label := stringField(data, "title")
+	if label == "" {
+		label = stringField(data, "name")
+	}
+	if label == "" && shape != "image" && shape != "3d" {
+		label = stringField(data, "content")
+	}
+	label = strings.Join(strings.Fields(label), " ")
+	if utf8.RuneCountInString(label) > maxLabelLength {
+		runes := []rune(label)
+		label = string(runes[:maxLabelLength-1]) + "…"
+	}
+	return label
+}
+
+func stringField(data map[string]interface{}, key string) string {
+	value, _ := data[key].(string)
+	return value
+}
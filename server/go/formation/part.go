@@ -0,0 +1,181 @@
+package formation
+
+import (
+	"fmt"
+	"math"
+	"sort"
+
+	"github.com/kktjss/dance-flow/models"
+)
+
+// Число ближайших соседей в партии танцора
+const (
+	DefaultPartNeighbours = 3
+	MaxPartNeighbours     = 10
+)
+
+// PartOptions задаёт партию: элемент танцора, число соседей в каждом шаге
+// и подписи элементов (например, имена назначенных танцоров)
+type PartOptions struct {
+	ElementID  string
+	Neighbours int
+	Labels     map[string]string
+}
+
+// Neighbour - соседний элемент в момент шага. Direction - сторона, с
+// которой он стоит, если смотреть из зала: left, right, upstage, downstage
+// или их сочетание.
+type Neighbour struct {
+	ID        string  `json:"id"`
+	Label     string  `json:"label"`
+	Center    Point   `json:"center"`
+	Distance  float64 `json:"distance"`
+	Direction string  `json:"direction"`
+}
+
+// PartStep - ключевой кадр танцора: где он стоит, куда идёт дальше и кто
+// рядом. Visible - false, если элемент в этот момент скрыт.
+type PartStep struct {
+	Time       float64     `json:"time"`
+	Center     Point       `json:"center"`
+	Next       *Point      `json:"next,omitempty"`
+	Visible    bool        `json:"visible"`
+	Notes      string      `json:"notes,omitempty"`
+	Neighbours []Neighbour `json:"neighbours"`
+}
+
+// BuildPart строит партию танцора по ключевым кадрам его элемента. Для
+// элемента без ключевых кадров возвращается один шаг в момент 0.
+// Координаты - на холсте со зрителями у нижнего края.
+func BuildPart(elements []interface{}, opts PartOptions) ([]PartStep, error) {
+	parsed := parseElements(elements)
+	index := -1
+	for i := range parsed {
+		if parsed[i].id == opts.ElementID {
+			index = i
+			break
+		}
+	}
+	if index < 0 {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownElement, opts.ElementID)
+	}
+	limit := opts.Neighbours
+	if limit <= 0 {
+		limit = DefaultPartNeighbours
+	}
+	if limit > MaxPartNeighbours {
+		limit = MaxPartNeighbours
+	}
+
+	dancer := &parsed[index]
+	times := []float64{0}
+	if len(dancer.keyframes) > 0 {
+		times = times[:0]
+		for _, kf := range dancer.keyframes {
+			if len(times) == 0 || kf.time != times[len(times)-1] {
+				times = append(times, kf.time)
+			}
+		}
+	}
+	notes := keyframeNotes(elements, opts.ElementID)
+
+	steps := make([]PartStep, 0, len(times))
+	for i, t := range times {
+		state := dancer.at(t)
+		step := PartStep{
+			Time:       t,
+			Center:     dancer.center(state),
+			Visible:    state.opacity > 0,
+			Notes:      notes[t],
+			Neighbours: []Neighbour{},
+		}
+		if i+1 < len(times) {
+			next := dancer.center(dancer.at(times[i+1]))
+			if next != step.Center {
+				step.Next = &next
+			}
+		}
+		if step.Visible {
+			step.Neighbours = nearestNeighbours(parsed, index, t, step.Center, limit, opts.Labels)
+		}
+		steps = append(steps, step)
+	}
+	return steps, nil
+}
+
+// nearestNeighbours возвращает limit ближайших видимых элементов к center
+func nearestNeighbours(parsed []element, self int, t float64, center Point, limit int, labels map[string]string) []Neighbour {
+	neighbours := []Neighbour{}
+	for i := range parsed {
+		if i == self {
+			continue
+		}
+		state := parsed[i].at(t)
+		if state.opacity <= 0 {
+			continue
+		}
+		other := parsed[i].center(state)
+		label := labels[parsed[i].id]
+		if label == "" {
+			label = parsed[i].label
+		}
+		neighbours = append(neighbours, Neighbour{
+			ID:        parsed[i].id,
+			Label:     label,
+			Center:    other,
+			Distance:  math.Hypot(other.X-center.X, other.Y-center.Y),
+			Direction: stageDirection(other.X-center.X, other.Y-center.Y),
+		})
+	}
+	sort.SliceStable(neighbours, func(i, j int) bool { return neighbours[i].Distance < neighbours[j].Distance })
+	if len(neighbours) > limit {
+		neighbours = neighbours[:limit]
+	}
+	return neighbours
+}
+
+// stageDirection называет направление смещения (dx, dy) на холсте, где
+// зрители находятся внизу. Вторая составляющая указывается, если она не
+// меньше 40% основной.
+func stageDirection(dx, dy float64) string {
+	horizontal := "right"
+	if dx < 0 {
+		horizontal = "left"
+	}
+	vertical := "downstage"
+	if dy < 0 {
+		vertical = "upstage"
+	}
+	ax, ay := math.Abs(dx), math.Abs(dy)
+	switch {
+	case ax == 0 && ay == 0:
+		return "same spot"
+	case ay < ax*0.4:
+		return horizontal
+	case ax < ay*0.4:
+		return vertical
+	}
+	return vertical + "-" + horizontal
+}
+
+// keyframeNotes возвращает заметки ключевых кадров элемента по моментам
+func keyframeNotes(elements []interface{}, id string) map[float64]string {
+	notes := map[float64]string{}
+	for _, raw := range elements {
+		data, ok := raw.(map[string]interface{})
+		if !ok || stringField(data, "id") != id {
+			continue
+		}
+		keyframes, _ := data["keyframes"].([]interface{})
+		for _, rawKeyframe := range keyframes {
+			kf, ok := rawKeyframe.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			if note := stringField(kf, "notes"); note != "" {
+				notes[models.ConvertToFloat64(kf["time"], math.NaN())] = note
+			}
+		}
+	}
+	return notes
+}
@@ -0,0 +1,210 @@
+package formation
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf16"
+)
+
+// Коэффициент аппроксимации четверти окружности кубической кривой Безье
+const bezierCircle = 0.5523
+
+// pdfSurface собирает поток содержимого страницы PDF. Ось Y в PDF направлена
+// вверх, поэтому координаты страницы отражаются относительно её высоты.
+type pdfSurface struct {
+	buf bytes.Buffer
+}
+
+// WritePDF выводит схемы документа в PDF, по одной схеме на лист A4.
+// Используется стандартный шрифт Helvetica без встраивания: кириллица в
+// подписях транслитерируется, остальные символы вне Windows-1252 заменяются на "?".
+func WritePDF(w io.Writer, doc *Document) error {
+	if err := doc.validate(); err != nil {
+		return err
+	}
+
+	out := &pdfWriter{w: bufio.NewWriter(w)}
+	total := len(doc.Charts)
+	// Объекты 1-4 - каталог, дерево страниц, шрифт и сведения о документе,
+	// далее для каждой страницы - сама страница и поток её содержимого
+	pageObject := func(i int) int { return 5 + 2*i }
+
+	out.header()
+	out.object(1, "<< /Type /Catalog /Pages 2 0 R >>")
+	kids := make([]string, total)
+	for i := range kids {
+		kids[i] = fmt.Sprintf("%d 0 R", pageObject(i))
+	}
+	out.object(2, fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), total))
+	out.object(3, "<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>")
+	out.object(4, fmt.Sprintf("<< /Title %s /Producer (Dance Flow) >>", pdfTextString(doc.Title)))
+
+	for i, chart := range doc.Charts {
+		s := &pdfSurface{}
+		drawPage(s, doc, chart, i+1, total)
+
+		var content bytes.Buffer
+		zw := zlib.NewWriter(&content)
+		zw.Write(s.buf.Bytes())
+		if err := zw.Close(); err != nil {
+			return err
+		}
+
+		out.object(pageObject(i), fmt.Sprintf(
+			"<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %s %s] /Resources << /Font << /F1 3 0 R >> >> /Contents %d 0 R >>",
+			pdfNumber(PageWidth), pdfNumber(PageHeight), pageObject(i)+1))
+		out.stream(pageObject(i)+1, content.Bytes())
+	}
+	return out.finish(4 + 2*total)
+}
+
+// pdfWriter записывает объекты PDF, запоминая их смещения для таблицы xref
+type pdfWriter struct {
+	w       *bufio.Writer
+	offset  int
+	offsets map[int]int
+}
+
+func (p *pdfWriter) write(format string, args ...interface{}) {
+	n, _ := fmt.Fprintf(p.w, format, args...)
+	p.offset += n
+}
+
+func (p *pdfWriter) header() {
+	p.offsets = make(map[int]int)
+	// Двоичный комментарий сообщает программам, что файл содержит не только ASCII
+	p.write("%%PDF-1.4\n%%\xe2\xe3\xcf\xd3\n")
+}
+
+func (p *pdfWriter) object(id int, body string) {
+	p.offsets[id] = p.offset
+	p.write("%d 0 obj\n%s\nendobj\n", id, body)
+}
+
+func (p *pdfWriter) stream(id int, data []byte) {
+	p.offsets[id] = p.offset
+	p.write("%d 0 obj\n<< /Length %d /Filter /FlateDecode >>\nstream\n", id, len(data))
+	n, _ := p.w.Write(data)
+	p.offset += n
+	p.write("\nendstream\nendobj\n")
+}
+
+func (p *pdfWriter) finish(count int) error {
+	xref := p.offset
+	p.write("xref\n0 %d\n0000000000 65535 f \n", count+1)
+	for id := 1; id <= count; id++ {
+		p.write("%010d 00000 n \n", p.offsets[id])
+	}
+	p.write("trailer\n<< /Size %d /Root 1 0 R /Info 4 0 R >>\nstartxref\n%d\n%%%%EOF\n", count+1, xref)
+	return p.w.Flush()
+}
+
+func (s *pdfSurface) rect(x, y, w, h float64, fill *Color, stroke Color, lineWidth float64) {
+	s.paint(fill, stroke, lineWidth)
+	fmt.Fprintf(&s.buf, "%s %s %s %s re %s\n", pdfNumber(x), pdfNumber(PageHeight-y-h), pdfNumber(w), pdfNumber(h), pdfPaintOp(fill))
+}
+
+func (s *pdfSurface) ellipse(cx, cy, rx, ry float64, fill *Color, stroke Color, lineWidth float64) {
+	s.paint(fill, stroke, lineWidth)
+	cy = PageHeight - cy
+	kx, ky := rx*bezierCircle, ry*bezierCircle
+	n := pdfNumber
+	fmt.Fprintf(&s.buf, "%s %s m\n", n(cx+rx), n(cy))
+	fmt.Fprintf(&s.buf, "%s %s %s %s %s %s c\n", n(cx+rx), n(cy+ky), n(cx+kx), n(cy+ry), n(cx), n(cy+ry))
+	fmt.Fprintf(&s.buf, "%s %s %s %s %s %s c\n", n(cx-kx), n(cy+ry), n(cx-rx), n(cy+ky), n(cx-rx), n(cy))
+	fmt.Fprintf(&s.buf, "%s %s %s %s %s %s c\n", n(cx-rx), n(cy-ky), n(cx-kx), n(cy-ry), n(cx), n(cy-ry))
+	fmt.Fprintf(&s.buf, "%s %s %s %s %s %s c\n", n(cx+kx), n(cy-ry), n(cx+rx), n(cy-ky), n(cx+rx), n(cy))
+	fmt.Fprintf(&s.buf, "h %s\n", pdfPaintOp(fill))
+}
+
+func (s *pdfSurface) line(x1, y1, x2, y2 float64, stroke Color, lineWidth float64, dashed bool) {
+	s.paint(nil, stroke, lineWidth)
+	if dashed {
+		s.buf.WriteString("[4 3] 0 d\n")
+	}
+	fmt.Fprintf(&s.buf, "%s %s m %s %s l S\n", pdfNumber(x1), pdfNumber(PageHeight-y1), pdfNumber(x2), pdfNumber(PageHeight-y2))
+	if dashed {
+		s.buf.WriteString("[] 0 d\n")
+	}
+}
+
+func (s *pdfSurface) polygon(points []Point, fill Color) {
+	fmt.Fprintf(&s.buf, "%s rg\n", pdfColor(fill))
+	for i, p := range points {
+		op := "l"
+		if i == 0 {
+			op = "m"
+		}
+		fmt.Fprintf(&s.buf, "%s %s %s\n", pdfNumber(p.X), pdfNumber(PageHeight-p.Y), op)
+	}
+	s.buf.WriteString("h f\n")
+}
+
+func (s *pdfSurface) text(x, y, size float64, value string, align anchor, color Color) {
+	encoded := winAnsi(value)
+	switch align {
+	case anchorMiddle:
+		x -= helveticaWidth(encoded) * size / 2
+	case anchorEnd:
+		x -= helveticaWidth(encoded) * size
+	}
+	fmt.Fprintf(&s.buf, "BT %s rg /F1 %s Tf %s %s Td (%s) Tj ET\n",
+		pdfColor(color), pdfNumber(size), pdfNumber(x), pdfNumber(PageHeight-y), pdfEscape(encoded))
+}
+
+// paint задаёт цвета заливки и обводки и толщину линии
+func (s *pdfSurface) paint(fill *Color, stroke Color, lineWidth float64) {
+	if fill != nil {
+		fmt.Fprintf(&s.buf, "%s rg ", pdfColor(*fill))
+	}
+	fmt.Fprintf(&s.buf, "%s RG %s w\n", pdfColor(stroke), pdfNumber(lineWidth))
+}
+
+func pdfPaintOp(fill *Color) string {
+	if fill != nil {
+		return "B"
+	}
+	return "S"
+}
+
+func pdfColor(c Color) string {
+	return fmt.Sprintf("%s %s %s", pdfNumber(float64(c.R)/255), pdfNumber(float64(c.G)/255), pdfNumber(float64(c.B)/255))
+}
+
+// pdfNumber форматирует число так же, как координаты в SVG
+func pdfNumber(v float64) string {
+	return svgNumber(v)
+}
+
+// pdfEscape экранирует строку PDF в круглых скобках
+func pdfEscape(value []byte) string {
+	var b strings.Builder
+	for _, c := range value {
+		switch c {
+		case '(', ')', '\\':
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		case '\r', '\n':
+			b.WriteByte(' ')
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+// pdfTextString записывает строку сведений о документе в UTF-16BE,
+// чтобы название проекта сохранялось без транслитерации
+func pdfTextString(value string) string {
+	var b strings.Builder
+	b.WriteString("<FEFF")
+	for _, unit := range utf16.Encode([]rune(value)) {
+		fmt.Fprintf(&b, "%04X", unit)
+	}
+	b.WriteString(">")
+	return b.String()
+}
@@ -0,0 +1,142 @@
+package formation
+
+import (
+	"fmt"
+	"math"
+)
+
+// Размер страницы - A4 в альбомной ориентации, в пунктах
+const (
+	PageWidth  = 842.0
+	PageHeight = 595.0
+
+	pageMargin    = 36.0
+	headerHeight  = 28.0
+	footerHeight  = 24.0
+	labelSize     = 8.0
+	titleSize     = 14.0
+	minMarkerSize = 8.0
+	arrowHeadSize = 7.0
+	maxGridLines  = 200
+)
+
+// Цвета оформления схемы
+var (
+	inkColor   = Color{0x22, 0x22, 0x22}
+	stageColor = Color{0x88, 0x88, 0x88}
+	arrowColor = Color{0x55, 0x55, 0x55}
+	gridColor  = Color{0xdd, 0xdd, 0xdd}
+	wingColor  = Color{0xf2, 0xf2, 0xf2}
+)
+
+// Подписи на странице
+const (
+	audienceLabel = "Зрители"
+	pageLabel     = "Лист %d из %d"
+)
+
+// anchor - выравнивание текста относительно точки
+type anchor int
+
+const (
+	anchorStart anchor = iota
+	anchorMiddle
+	anchorEnd
+)
+
+// surface - поверхность для рисования страницы. Координаты задаются
+// в пунктах от левого верхнего угла страницы, ось Y направлена вниз.
+type surface interface {
+	rect(x, y, w, h float64, fill *Color, stroke Color, lineWidth float64)
+	ellipse(cx, cy, rx, ry float64, fill *Color, stroke Color, lineWidth float64)
+	line(x1, y1, x2, y2 float64, stroke Color, lineWidth float64, dashed bool)
+	polygon(points []Point, fill Color)
+	text(x, y, size float64, value string, align anchor, color Color)
+}
+
+// drawPage рисует схему chart на странице с номером page из total
+func drawPage(s surface, doc *Document, chart Chart, page, total int) {
+	s.text(pageMargin, pageMargin+titleSize, titleSize, doc.Title, anchorStart, inkColor)
+	s.text(PageWidth-pageMargin, pageMargin+titleSize, titleSize, FormatTime(chart.Time), anchorEnd, inkColor)
+	s.text(PageWidth-pageMargin, PageHeight-pageMargin/2, labelSize, fmt.Sprintf(pageLabel, page, total), anchorEnd, stageColor)
+
+	// Вписываем сцену с кулисами в свободную область страницы с сохранением пропорций
+	stage := doc.Stage
+	areaX, areaY := pageMargin, pageMargin+headerHeight
+	areaWidth := PageWidth - 2*pageMargin
+	areaHeight := PageHeight - 2*pageMargin - headerHeight - footerHeight
+	scale := math.Min(areaWidth/(stage.Width+2*stage.Wing), areaHeight/stage.Height)
+	stageWidth, stageHeight, wing := stage.Width*scale, stage.Height*scale, stage.Wing*scale
+	originX := areaX + (areaWidth-stageWidth)/2
+	originY := areaY + (areaHeight-stageHeight)/2
+	toPage := func(p Point) Point {
+		return Point{X: originX + p.X*scale, Y: originY + p.Y*scale}
+	}
+
+	if wing > 0 {
+		s.rect(originX-wing, originY, wing, stageHeight, &wingColor, gridColor, 0.5)
+		s.rect(originX+stageWidth, originY, wing, stageHeight, &wingColor, gridColor, 0.5)
+	}
+	// Сетка отсчитывается от центральной линии и от авансцены
+	if grid := stage.Grid * scale; grid > 0 && stageWidth/grid <= maxGridLines && stageHeight/grid <= maxGridLines {
+		for x := grid; x < stageWidth/2; x += grid {
+			s.line(originX+stageWidth/2-x, originY, originX+stageWidth/2-x, originY+stageHeight, gridColor, 0.5, false)
+			s.line(originX+stageWidth/2+x, originY, originX+stageWidth/2+x, originY+stageHeight, gridColor, 0.5, false)
+		}
+		for y := grid; y < stageHeight; y += grid {
+			s.line(originX, originY+stageHeight-y, originX+stageWidth, originY+stageHeight-y, gridColor, 0.5, false)
+		}
+	}
+	s.rect(originX, originY, stageWidth, stageHeight, nil, stageColor, 1)
+	if stage.CenterLine {
+		s.line(originX+stageWidth/2, originY, originX+stageWidth/2, originY+stageHeight, stageColor, 0.5, true)
+	}
+	s.text(originX+stageWidth/2, originY+stageHeight+footerHeight/2+labelSize/2, labelSize+2, audienceLabel, anchorMiddle, stageColor)
+
+	// Стрелки рисуются под элементами, чтобы не закрывать их
+	for _, marker := range chart.Markers {
+		if marker.Next == nil {
+			continue
+		}
+		from, to := toPage(marker.Center), toPage(*marker.Next)
+		drawArrow(s, from, to)
+	}
+
+	for _, marker := range chart.Markers {
+		center := toPage(marker.Center)
+		width := math.Max(marker.Width*scale, minMarkerSize)
+		height := math.Max(marker.Height*scale, minMarkerSize)
+		fill := marker.Color
+		if marker.Shape == "circle" {
+			s.ellipse(center.X, center.Y, width/2, height/2, &fill, inkColor, 0.75)
+		} else {
+			s.rect(center.X-width/2, center.Y-height/2, width, height, &fill, inkColor, 0.75)
+		}
+		if marker.Label != "" {
+			s.text(center.X, center.Y+height/2+labelSize+2, labelSize, marker.Label, anchorMiddle, inkColor)
+		}
+	}
+}
+
+// drawArrow рисует пунктирную стрелку движения к следующей позиции
+func drawArrow(s surface, from, to Point) {
+	dx, dy := to.X-from.X, to.Y-from.Y
+	length := math.Hypot(dx, dy)
+	if length < arrowHeadSize {
+		return
+	}
+	ux, uy := dx/length, dy/length
+	base := Point{X: to.X - ux*arrowHeadSize, Y: to.Y - uy*arrowHeadSize}
+	s.line(from.X, from.Y, base.X, base.Y, arrowColor, 1, true)
+	s.polygon([]Point{
+		to,
+		{X: base.X - uy*arrowHeadSize/2, Y: base.Y + ux*arrowHeadSize/2},
+		{X: base.X + uy*arrowHeadSize/2, Y: base.Y - ux*arrowHeadSize/2},
+	}, arrowColor)
+}
+
+// FormatTime форматирует момент времени как м:сс.сс
+func FormatTime(seconds float64) string {
+	hundredths := int(math.Round(math.Max(seconds, 0) * 100))
+	return fmt.Sprintf("%d:%02d.%02d", hundredths/6000, hundredths/100%60, hundredths%100)
+}
@@ -0,0 +1,99 @@
+package formation
+
+import (
+	"bufio"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Промежуток между листами в SVG документе
+const svgPageGap = 20.0
+
+// svgSurface рисует страницу элементами SVG
+type svgSurface struct {
+	w *bufio.Writer
+}
+
+// WriteSVG выводит схемы документа в один SVG, располагая листы друг под другом
+func WriteSVG(w io.Writer, doc *Document) error {
+	if err := doc.validate(); err != nil {
+		return err
+	}
+	out := bufio.NewWriter(w)
+	total := len(doc.Charts)
+	height := float64(total)*PageHeight + float64(total-1)*svgPageGap
+
+	fmt.Fprintf(out, `<?xml version="1.0" encoding="UTF-8"?>`+"\n")
+	fmt.Fprintf(out, `<svg xmlns="http://www.w3.org/2000/svg" width="%s" height="%s" viewBox="0 0 %s %s" font-family="Helvetica, Arial, sans-serif">`+"\n",
+		svgNumber(PageWidth), svgNumber(height), svgNumber(PageWidth), svgNumber(height))
+	fmt.Fprintf(out, "<title>%s</title>\n", svgEscape(doc.Title))
+
+	s := &svgSurface{w: out}
+	for i, chart := range doc.Charts {
+		fmt.Fprintf(out, `<g id="chart-%d" transform="translate(0 %s)">`+"\n", i+1, svgNumber(float64(i)*(PageHeight+svgPageGap)))
+		s.rect(0, 0, PageWidth, PageHeight, &Color{255, 255, 255}, Color{0xdd, 0xdd, 0xdd}, 0.5)
+		drawPage(s, doc, chart, i+1, total)
+		fmt.Fprintf(out, "</g>\n")
+	}
+	fmt.Fprintf(out, "</svg>\n")
+	return out.Flush()
+}
+
+func (s *svgSurface) rect(x, y, w, h float64, fill *Color, stroke Color, lineWidth float64) {
+	fmt.Fprintf(s.w, `<rect x="%s" y="%s" width="%s" height="%s" %s/>`+"\n",
+		svgNumber(x), svgNumber(y), svgNumber(w), svgNumber(h), svgPaint(fill, stroke, lineWidth))
+}
+
+func (s *svgSurface) ellipse(cx, cy, rx, ry float64, fill *Color, stroke Color, lineWidth float64) {
+	fmt.Fprintf(s.w, `<ellipse cx="%s" cy="%s" rx="%s" ry="%s" %s/>`+"\n",
+		svgNumber(cx), svgNumber(cy), svgNumber(rx), svgNumber(ry), svgPaint(fill, stroke, lineWidth))
+}
+
+func (s *svgSurface) line(x1, y1, x2, y2 float64, stroke Color, lineWidth float64, dashed bool) {
+	dash := ""
+	if dashed {
+		dash = ` stroke-dasharray="4 3"`
+	}
+	fmt.Fprintf(s.w, `<line x1="%s" y1="%s" x2="%s" y2="%s" stroke="%s" stroke-width="%s"%s/>`+"\n",
+		svgNumber(x1), svgNumber(y1), svgNumber(x2), svgNumber(y2), stroke.Hex(), svgNumber(lineWidth), dash)
+}
+
+func (s *svgSurface) polygon(points []Point, fill Color) {
+	coords := make([]string, len(points))
+	for i, p := range points {
+		coords[i] = svgNumber(p.X) + "," + svgNumber(p.Y)
+	}
+	fmt.Fprintf(s.w, `<polygon points="%s" fill="%s"/>`+"\n", strings.Join(coords, " "), fill.Hex())
+}
+
+func (s *svgSurface) text(x, y, size float64, value string, align anchor, color Color) {
+	anchors := [...]string{"start", "middle", "end"}
+	fmt.Fprintf(s.w, `<text x="%s" y="%s" font-size="%s" text-anchor="%s" fill="%s">%s</text>`+"\n",
+		svgNumber(x), svgNumber(y), svgNumber(size), anchors[align], color.Hex(), svgEscape(value))
+}
+
+func svgPaint(fill *Color, stroke Color, lineWidth float64) string {
+	paint := `fill="none"`
+	if fill != nil {
+		paint = fmt.Sprintf(`fill="%s"`, fill.Hex())
+	}
+	return fmt.Sprintf(`%s stroke="%s" stroke-width="%s"`, paint, stroke.Hex(), svgNumber(lineWidth))
+}
+
+// svgNumber форматирует координату с точностью до сотых без лишних нулей
+func svgNumber(v float64) string {
+	s := strings.TrimRight(fmt.Sprintf("%.2f", v), "0")
+	s = strings.TrimSuffix(s, ".")
+	if s == "-0" {
+		return "0"
+	}
+	return s
+}
+
+func svgEscape(value string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(value))
+	return b.String()
+}
@@ -0,0 +1,85 @@
+package formation
+
+import "strings"
+
+// Транслитерация кириллицы для стандартного шрифта PDF
+var cyrillicLatin = map[rune]string{
+	'а': "a", 'б': "b", 'в': "v", 'г': "g", 'д': "d", 'е': "e", 'ё': "e", 'ж': "zh",
+	'з': "z", 'и': "i", 'й': "y", 'к': "k", 'л': "l", 'м': "m", 'н': "n", 'о': "o",
+	'п': "p", 'р': "r", 'с': "s", 'т': "t", 'у': "u", 'ф': "f", 'х': "kh", 'ц': "ts",
+	'ч': "ch", 'ш': "sh", 'щ': "shch", 'ъ': "", 'ы': "y", 'ь': "", 'э': "e", 'ю': "yu",
+	'я': "ya", 'і': "i", 'ї': "yi", 'є': "ye", 'ґ': "g",
+}
+
+// Символы Windows-1252 вне Latin-1, которые встречаются в подписях
+var winAnsiExtra = map[rune]byte{
+	'€': 0x80, '‚': 0x82, '„': 0x84, '…': 0x85, '‘': 0x91, '’': 0x92,
+	'“': 0x93, '”': 0x94, '•': 0x95, '–': 0x96, '—': 0x97, '™': 0x99,
+}
+
+// Ширина символов ASCII 32-126 шрифта Helvetica в тысячных долях кегля
+var helveticaASCII = [...]int{
+	278, 278, 355, 556, 556, 889, 667, 191, 333, 333, 389, 584, 278, 333, 278, 278,
+	556, 556, 556, 556, 556, 556, 556, 556, 556, 556, 278, 278, 584, 584, 584, 556,
+	1015, 667, 667, 722, 722, 667, 611, 778, 722, 278, 500, 667, 556, 833, 722, 778,
+	667, 778, 722, 667, 611, 722, 667, 944, 667, 667, 611, 278, 278, 278, 469, 556,
+	333, 556, 556, 500, 556, 556, 278, 556, 556, 222, 222, 500, 222, 833, 556, 556,
+	556, 556, 333, 500, 278, 556, 500, 722, 500, 500, 500, 334, 260, 334, 584,
+}
+
+// winAnsi переводит строку в кодировку WinAnsiEncoding стандартных шрифтов PDF
+func winAnsi(value string) []byte {
+	encoded := make([]byte, 0, len(value))
+	for _, r := range value {
+		switch {
+		case r >= 0x20 && r < 0x7f, r >= 0xa0 && r <= 0xff:
+			encoded = append(encoded, byte(r))
+		case cyrillicLatin[toLowerCyrillic(r)] != "" || isSilentCyrillic(r):
+			latin := cyrillicLatin[toLowerCyrillic(r)]
+			if latin != "" && toLowerCyrillic(r) != r {
+				latin = strings.ToUpper(latin[:1]) + latin[1:]
+			}
+			encoded = append(encoded, latin...)
+		case winAnsiExtra[r] != 0:
+			encoded = append(encoded, winAnsiExtra[r])
+		case r == '\t' || r == '\n':
+			encoded = append(encoded, ' ')
+		default:
+			encoded = append(encoded, '?')
+		}
+	}
+	return encoded
+}
+
+func toLowerCyrillic(r rune) rune {
+	switch {
+	case r >= 'А' && r <= 'Я':
+		return r + ('а' - 'А')
+	case r >= 'Ѐ' && r <= 'Џ':
+		return r + ('ѐ' - 'Ѐ')
+	case r == 'Ґ':
+		return 'ґ'
+	}
+	return r
+}
+
+func isSilentCyrillic(r rune) bool {
+	r = toLowerCyrillic(r)
+	return r == 'ъ' || r == 'ь'
+}
+
+// helveticaWidth возвращает ширину закодированной строки в долях кегля
+func helveticaWidth(encoded []byte) float64 {
+	total := 0
+	for _, c := range encoded {
+		switch {
+		case c >= 32 && c <= 126:
+			total += helveticaASCII[c-32]
+		case c == 0x85 || c == 0x97:
+			total += 1000
+		default:
+			total += 556
+		}
+	}
+	return float64(total) / 1000
+}
@@ -0,0 +1,340 @@
+package formation
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+
+	"github.com/kktjss/dance-flow/models"
+)
+
+// MaxTransitionDancers ограничивает число танцоров в одном переходе
+const MaxTransitionDancers = 100
+
+// Ошибки планирования перехода
+var (
+	ErrInvalidTransition = errors.New("transition must end after it starts")
+	ErrNotEnoughTargets  = errors.New("fewer target positions than dancers")
+	ErrTooManyDancers    = errors.New("too many dancers in transition")
+	ErrUnknownElement    = errors.New("element not found")
+)
+
+// Варианты пути: задержки выхода и раннего прихода (доли длительности
+// перехода) и боковые отступы в размерах танцора
+var (
+	transitionTimings = [][2]float64{{0, 0}, {0.25, 0}, {0, 0.25}, {0.5, 0}, {0, 0.5}, {0.25, 0.25}}
+	transitionDetours = []float64{1, -1, 2, -2, 3, -3}
+)
+
+// TransitionOptions задаёт переход из расстановки в момент From в расстановку
+// в момент To. Targets - центры точек новой расстановки; если не заданы,
+// точками служат положения самих танцоров в момент To и переход только
+// перераспределяет их. MinDistance - минимальное расстояние между центрами
+// (0 - танцоры не должны пересекаться).
+type TransitionOptions struct {
+	From        float64
+	To          float64
+	Targets     []Point
+	MinDistance float64
+	// ElementIDs - танцоры; по умолчанию все элементы, кроме текстовых подписей
+	ElementIDs []string
+}
+
+// Assignment - точка новой расстановки, назначенная танцору
+type Assignment struct {
+	ElementID string  `json:"elementId"`
+	From      Point   `json:"from"`
+	To        Point   `json:"to"`
+	Distance  float64 `json:"distance"`
+}
+
+// Waypoint - положение центра танцора на пути перехода
+type Waypoint struct {
+	Time     float64 `json:"time"`
+	Position Point   `json:"position"`
+}
+
+// Transition - назначения с наименьшим суммарным путём и пути танцоров.
+// Пути содержат крайние точки и промежуточные ключевые кадры, которыми
+// танцоры расходятся друг с другом.
+type Transition struct {
+	From          float64               `json:"from"`
+	To            float64               `json:"to"`
+	Assignments   []Assignment          `json:"assignments"`
+	TotalDistance float64               `json:"totalDistance"`
+	Paths         map[string][]Waypoint `json:"paths"`
+	// Unresolved - танцоры, для которых не нашлось пути без сближений
+	Unresolved []string `json:"unresolved"`
+}
+
+// dancerPlan - танцор в планируемом переходе
+type dancerPlan struct {
+	id       string
+	from, to Point
+	size     float64
+	path     []Waypoint
+}
+
+// PlanTransition назначает танцорам точки новой расстановки венгерским
+// алгоритмом по длине пути и строит пути без сближений. Танцоры планируются
+// по очереди, от самых дальних переходов; каждому подбирается первый
+// свободный вариант: прямо, с задержкой выхода или ранним приходом, затем
+// с обходом в сторону. Если свободного варианта нет, выбирается вариант
+// с наименьшим сближением, а танцор попадает в Unresolved.
+func PlanTransition(elements []interface{}, opts TransitionOptions) (*Transition, error) {
+	if !(opts.To > opts.From) || math.IsInf(opts.To, 0) || math.IsInf(opts.From, 0) {
+		return nil, ErrInvalidTransition
+	}
+
+	parsed := parseElements(elements)
+	selected := selectElements(parsed, opts.ElementIDs)
+	for _, id := range opts.ElementIDs {
+		if !containsElement(selected, id) {
+			return nil, fmt.Errorf("%w: %s", ErrUnknownElement, id)
+		}
+	}
+	if len(selected) > MaxTransitionDancers || len(opts.Targets) > MaxTransitionDancers {
+		return nil, ErrTooManyDancers
+	}
+
+	dancers := make([]*dancerPlan, len(selected))
+	for i := range selected {
+		el := &selected[i]
+		start, end := el.at(opts.From), el.at(opts.To)
+		dancers[i] = &dancerPlan{
+			id:   el.id,
+			from: el.center(start),
+			to:   el.center(end),
+			size: (el.width + el.height) / 2 * math.Max(start.scale, end.scale),
+		}
+	}
+
+	targets := opts.Targets
+	if len(targets) == 0 {
+		targets = make([]Point, len(dancers))
+		for i, d := range dancers {
+			targets[i] = d.to
+		}
+	}
+	if len(targets) < len(dancers) {
+		return nil, ErrNotEnoughTargets
+	}
+
+	cost := make([][]float64, len(dancers))
+	for i, d := range dancers {
+		cost[i] = make([]float64, len(targets))
+		for j, target := range targets {
+			cost[i][j] = distance(d.from, target)
+		}
+	}
+	transition := &Transition{
+		From:        opts.From,
+		To:          opts.To,
+		Assignments: make([]Assignment, len(dancers)),
+		Paths:       make(map[string][]Waypoint, len(dancers)),
+		Unresolved:  []string{},
+	}
+	for i, j := range Assign(cost) {
+		dancers[i].to = targets[j]
+		transition.Assignments[i] = Assignment{
+			ElementID: dancers[i].id,
+			From:      dancers[i].from,
+			To:        targets[j],
+			Distance:  cost[i][j],
+		}
+		transition.TotalDistance += cost[i][j]
+	}
+
+	// Неподвижные танцоры планируются первыми, остальные - от дальних к ближним
+	order := make([]*dancerPlan, len(dancers))
+	copy(order, dancers)
+	sort.SliceStable(order, func(a, b int) bool {
+		return distance(order[a].from, order[a].to) > distance(order[b].from, order[b].to)
+	})
+	sort.SliceStable(order, func(a, b int) bool {
+		return order[a].from == order[a].to && order[b].from != order[b].to
+	})
+
+	required := func(a, b *dancerPlan) float64 {
+		if opts.MinDistance > 0 {
+			return opts.MinDistance
+		}
+		return (a.size + b.size) / 2
+	}
+	var planned []*dancerPlan
+	for _, d := range order {
+		clearance := 0.0
+		for _, other := range dancers {
+			if other != d {
+				clearance = math.Max(clearance, required(d, other))
+			}
+		}
+
+		bestGap := math.Inf(-1)
+		for _, path := range candidatePaths(d.from, d.to, opts.From, opts.To, clearance) {
+			gap := math.Inf(1)
+			for _, other := range planned {
+				gap = math.Min(gap, pathDistance(path, other.path)-required(d, other))
+			}
+			if gap > bestGap {
+				bestGap, d.path = gap, path
+			}
+			if gap >= 0 {
+				break
+			}
+		}
+		if bestGap < 0 {
+			transition.Unresolved = append(transition.Unresolved, d.id)
+		}
+		planned = append(planned, d)
+		transition.Paths[d.id] = d.path
+	}
+	return transition, nil
+}
+
+// ApplyTransition записывает пути перехода в ключевые кадры элементов:
+// кадры между From и To заменяются точками пути. Позиции в кадрах - левый
+// верхний угол, масштаб и прозрачность интерполируются между крайними кадрами.
+func ApplyTransition(elements []interface{}, transition *Transition) {
+	for _, raw := range elements {
+		data, ok := raw.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		path, ok := transition.Paths[stringField(data, "id")]
+		if !ok || len(path) == 0 {
+			continue
+		}
+		parsed := parseElements([]interface{}{data})
+		el := &parsed[0]
+		start, end := el.at(transition.From), el.at(transition.To)
+
+		keyframes := []interface{}{}
+		if existing, ok := data["keyframes"].([]interface{}); ok {
+			for _, rawKeyframe := range existing {
+				kf, ok := rawKeyframe.(map[string]interface{})
+				if !ok {
+					continue
+				}
+				if t := models.ConvertToFloat64(kf["time"], -1); t < transition.From || t > transition.To {
+					keyframes = append(keyframes, kf)
+				}
+			}
+		}
+		for _, point := range path {
+			ratio := (point.Time - transition.From) / (transition.To - transition.From)
+			scale := start.scale + (end.scale-start.scale)*ratio
+			keyframes = append(keyframes, map[string]interface{}{
+				"time": point.Time,
+				"position": map[string]interface{}{
+					"x": point.Position.X - el.width*scale/2,
+					"y": point.Position.Y - el.height*scale/2,
+				},
+				"opacity": start.opacity + (end.opacity-start.opacity)*ratio,
+				"scale":   scale,
+			})
+		}
+		sort.SliceStable(keyframes, func(i, j int) bool {
+			a := models.ConvertToFloat64(keyframes[i].(map[string]interface{})["time"], 0)
+			b := models.ConvertToFloat64(keyframes[j].(map[string]interface{})["time"], 0)
+			return a < b
+		})
+
+		data["keyframes"] = keyframes
+		data["position"] = keyframes[0].(map[string]interface{})["position"]
+	}
+}
+
+// candidatePaths перечисляет варианты пути от простых к сложным. Танцор стоит
+// на месте до выхода, идёт равномерно и после прихода ждёт до конца перехода;
+// при обходе путь проходит через точку, отнесённую от середины в сторону.
+func candidatePaths(from, to Point, start, end, clearance float64) [][]Waypoint {
+	length := distance(from, to)
+	if length == 0 {
+		return [][]Waypoint{{{Time: start, Position: from}, {Time: end, Position: to}}}
+	}
+	// Единичная нормаль к направлению движения
+	normal := Point{X: -(to.Y - from.Y) / length, Y: (to.X - from.X) / length}
+	duration := end - start
+
+	detours := append([]float64{0}, transitionDetours...)
+	candidates := make([][]Waypoint, 0, len(detours)*len(transitionTimings))
+	for _, detour := range detours {
+		for _, timing := range transitionTimings {
+			leave, arrive := start+duration*timing[0], end-duration*timing[1]
+			path := []Waypoint{{Time: start, Position: from}}
+			if leave > start {
+				path = append(path, Waypoint{Time: leave, Position: from})
+			}
+			if detour != 0 {
+				middle := lerpPoint(from, to, 0.5)
+				offset := detour * clearance
+				path = append(path, Waypoint{
+					Time:     (leave + arrive) / 2,
+					Position: Point{X: middle.X + normal.X*offset, Y: middle.Y + normal.Y*offset},
+				})
+			}
+			path = append(path, Waypoint{Time: arrive, Position: to})
+			if arrive < end {
+				path = append(path, Waypoint{Time: end, Position: to})
+			}
+			candidates = append(candidates, path)
+		}
+	}
+	return candidates
+}
+
+// pathDistance возвращает наименьшее расстояние между танцорами, идущими
+// по путям a и b. Между соседними моментами обоих путей движение равномерно.
+func pathDistance(a, b []Waypoint) float64 {
+	times := make([]float64, 0, len(a)+len(b))
+	for _, p := range a {
+		times = append(times, p.Time)
+	}
+	for _, p := range b {
+		times = append(times, p.Time)
+	}
+	sort.Float64s(times)
+
+	closest := math.Inf(1)
+	for k := range times {
+		next := k
+		if k+1 < len(times) {
+			next = k + 1
+		}
+		_, d := closestApproach(pathAt(a, times[k]), pathAt(a, times[next]), pathAt(b, times[k]), pathAt(b, times[next]))
+		closest = math.Min(closest, d)
+	}
+	return closest
+}
+
+// pathAt возвращает положение на пути в момент t
+func pathAt(path []Waypoint, t float64) Point {
+	if t <= path[0].Time {
+		return path[0].Position
+	}
+	for i := 1; i < len(path); i++ {
+		if t <= path[i].Time {
+			a, b := path[i-1], path[i]
+			if b.Time == a.Time {
+				return b.Position
+			}
+			return lerpPoint(a.Position, b.Position, (t-a.Time)/(b.Time-a.Time))
+		}
+	}
+	return path[len(path)-1].Position
+}
+
+func containsElement(elements []element, id string) bool {
+	for _, el := range elements {
+		if el.id == id {
+			return true
+		}
+	}
+	return false
+}
+
+func distance(a, b Point) float64 {
+	return math.Hypot(b.X-a.X, b.Y-a.Y)
+}
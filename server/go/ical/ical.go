@@ -0,0 +1,114 @@
+// Package ical выводит события в формате iCalendar (RFC 5545) для
+// подписки из календарных приложений
+package ical
+
+import (
+	"bufio"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Максимальная длина строки без переноса в октетах
+const maxLineOctets = 75
+
+// Статусы событий
+const (
+	StatusConfirmed = "CONFIRMED"
+	StatusCancelled = "CANCELLED"
+)
+
+// Event - событие календаря. Время хранится в UTC.
+type Event struct {
+	UID         string
+	Summary     string
+	Description string
+	Location    string
+	Start       time.Time
+	End         time.Time
+	Status      string
+	Updated     time.Time
+	// Sequence растёт при каждом изменении события
+	Sequence int
+}
+
+// Calendar - календарь с названием и событиями
+type Calendar struct {
+	Name   string
+	Events []Event
+}
+
+// Write выводит календарь. Строки разделяются CRLF и переносятся по 75
+// октетов, как требует RFC 5545.
+func Write(w io.Writer, cal Calendar, now time.Time) error {
+	out := bufio.NewWriter(w)
+	line := func(name, value string) {
+		writeFolded(out, name+":"+value)
+	}
+	line("BEGIN", "VCALENDAR")
+	line("VERSION", "2.0")
+	line("PRODID", "-//Dance Flow//Rehearsals//EN")
+	line("CALSCALE", "GREGORIAN")
+	line("METHOD", "PUBLISH")
+	if cal.Name != "" {
+		line("X-WR-CALNAME", escapeText(cal.Name))
+	}
+	for _, event := range cal.Events {
+		line("BEGIN", "VEVENT")
+		line("UID", escapeText(event.UID))
+		line("DTSTAMP", formatTime(now))
+		line("DTSTART", formatTime(event.Start))
+		line("DTEND", formatTime(event.End))
+		line("SUMMARY", escapeText(event.Summary))
+		if event.Location != "" {
+			line("LOCATION", escapeText(event.Location))
+		}
+		if event.Description != "" {
+			line("DESCRIPTION", escapeText(event.Description))
+		}
+		if event.Status != "" {
+			line("STATUS", event.Status)
+		}
+		if !event.Updated.IsZero() {
+			line("LAST-MODIFIED", formatTime(event.Updated))
+		}
+		if event.Sequence > 0 {
+			line("SEQUENCE", strconv.Itoa(event.Sequence))
+		}
+		line("END", "VEVENT")
+	}
+	line("END", "VCALENDAR")
+	return out.Flush()
+}
+
+func formatTime(t time.Time) string {
+	return t.UTC().Format("20060102T150405Z")
+}
+
+// escapeText экранирует значение типа TEXT
+func escapeText(value string) string {
+	value = strings.ReplaceAll(value, "\r\n", "\n")
+	replacer := strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\n", `\n`, "\r", `\n`)
+	return replacer.Replace(value)
+}
+
+// writeFolded пишет строку содержимого, перенося её продолжения с пробелом
+// в начале и не разрывая символы UTF-8
+func writeFolded(w *bufio.Writer, content string) {
+	limit := maxLineOctets
+	for len(content) > limit {
+		cut := limit
+		for cut > 0 && !utf8.RuneStart(content[cut]) {
+			cut--
+		}
+		w.WriteString(content[:cut])
+		w.WriteString("\r\n ")
+		content = content[cut:]
+		// Пробел в начале продолжения входит в длину строки
+		limit = maxLineOctets - 1
+	}
+	w.WriteString(content)
+	w.WriteString("\r\n")
+}
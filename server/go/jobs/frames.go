@@ -0,0 +1,151 @@
+// Package jobs выполняет фоновые задачи покадрового анализа видео
+package jobs
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// Frame - кадр видео в JPEG и его время в секундах
+type Frame struct {
+	Time  float64
+	Image []byte
+}
+
+// FrameSource извлекает кадры из видео с заданной частотой (кадров в секунду)
+type FrameSource interface {
+	Duration(ctx context.Context, path string) (float64, error)
+	Extract(ctx context.Context, path string, sampleRate float64, emit func(Frame) error) error
+}
+
+// FFmpegSource извлекает кадры с помощью ffmpeg и ffprobe
+type FFmpegSource struct {
+	FFmpegPath  string
+	FFprobePath string
+}
+
+// NewFFmpegSource создает источник кадров, использующий ffmpeg из PATH
+func NewFFmpegSource() *FFmpegSource {
+	return &FFmpegSource{FFmpegPath: "ffmpeg", FFprobePath: "ffprobe"}
+}
+
+// Duration возвращает длительность видео в секундах
+func (s *FFmpegSource) Duration(ctx context.Context, path string) (float64, error) {
+	out, err := exec.CommandContext(ctx, s.FFprobePath,
+		"-v", "error",
+		"-show_entries", "format=duration",
+		"-of", "default=noprint_wrappers=1:nokey=1",
+		path,
+	).Output()
+	if err != nil {
+		return 0, fmt.Errorf("ffprobe failed: %w", err)
+	}
+
+	duration, err := strconv.ParseFloat(strings.TrimSpace(string(out)), 64)
+	if err != nil {
+		return 0, fmt.Errorf("ffprobe returned invalid duration %q", strings.TrimSpace(string(out)))
+	}
+	return duration, nil
+}
+
+// Extract декодирует видео и передаёт кадры в emit по одному
+func (s *FFmpegSource) Extract(ctx context.Context, path string, sampleRate float64, emit func(Frame) error) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, s.FFmpegPath,
+		"-v", "error",
+		"-i", path,
+		"-vf", "fps="+strconv.FormatFloat(sampleRate, 'f', -1, 64),
+		"-f", "image2pipe",
+		"-c:v", "mjpeg",
+		"-q:v", "3",
+		"-",
+	)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("failed to start ffmpeg: %w", err)
+	}
+
+	index := 0
+	splitErr := SplitJPEGStream(stdout, func(image []byte) error {
+		frame := Frame{Time: float64(index) / sampleRate, Image: image}
+		index++
+		return emit(frame)
+	})
+	if splitErr != nil {
+		// Останавливаем ffmpeg, чтобы Wait не блокировался на заполненном канале
+		cancel()
+		cmd.Wait()
+		return splitErr
+	}
+
+	if err := cmd.Wait(); err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return fmt.Errorf("ffmpeg failed: %v: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
+
+// Максимальный размер одного кадра в потоке
+const maxFrameSize = 32 << 20
+
+// SplitJPEGStream разбивает поток склеенных JPEG изображений на отдельные кадры
+// по маркерам начала (FFD8) и конца (FFD9) изображения
+func SplitJPEGStream(r io.Reader, emit func([]byte) error) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 256<<10), maxFrameSize)
+	scanner.Split(splitJPEG)
+
+	for scanner.Scan() {
+		image := make([]byte, len(scanner.Bytes()))
+		copy(image, scanner.Bytes())
+		if err := emit(image); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+var (
+	jpegStart = []byte{0xFF, 0xD8}
+	jpegEnd   = []byte{0xFF, 0xD9}
+)
+
+func splitJPEG(data []byte, atEOF bool) (int, []byte, error) {
+	start := bytes.Index(data, jpegStart)
+	if start < 0 {
+		if atEOF {
+			return len(data), nil, nil
+		}
+		// Отбрасываем мусор, но сохраняем последний байт: он может быть началом маркера
+		if len(data) > 1 {
+			return len(data) - 1, nil, nil
+		}
+		return 0, nil, nil
+	}
+
+	end := bytes.Index(data[start+len(jpegStart):], jpegEnd)
+	if end < 0 {
+		if atEOF {
+			return len(data), nil, fmt.Errorf("truncated JPEG frame")
+		}
+		return start, nil, nil
+	}
+
+	stop := start + len(jpegStart) + end + len(jpegEnd)
+	return stop, data[start:stop], nil
+}
@@ -0,0 +1,406 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/kktjss/dance-flow/analyzer"
+	"github.com/kktjss/dance-flow/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Ошибки управления задачами
+var (
+	ErrJobFinished     = errors.New("analysis job is already finished")
+	ErrJobNotRetryable = errors.New("only failed or cancelled jobs can be retried")
+)
+
+// Число кадров, после которого результаты сохраняются и обновляется прогресс
+const defaultBatchSize = 30
+
+// Сколько раз задача ждёт восстановления анализатора, прежде чем завершиться ошибкой
+const maxUnavailableWaits = 5
+
+// Предел ожидания анализатора между попытками
+const maxUnavailableWait = time.Minute
+
+// Runner выполняет задачи анализа в пуле воркеров
+type Runner struct {
+	store    Store
+	analyzer analyzer.Analyzer
+	source   FrameSource
+	sink     Sink
+
+	// BatchSize задаёт, как часто сохраняются результаты и прогресс
+	BatchSize int
+	// OnFinish вызывается после сохранения задачи, завершённой успешно,
+	// с ошибкой или отменённой
+	OnFinish func(job *models.AnalysisJob)
+
+	queue chan primitive.ObjectID
+	ctx   context.Context
+	stop  context.CancelFunc
+	wg    sync.WaitGroup
+	// mu защищает только running: состояние задач меняется в хранилище
+	// условными обновлениями, без удержания блокировки на время запросов
+	mu      sync.Mutex
+	running map[primitive.ObjectID]runningJob
+}
+
+// runningJob - выполняющаяся попытка задачи. Номер попытки отличает её от
+// повтора, запущенного до того, как прежний воркер успел остановиться.
+type runningJob struct {
+	attempt int
+	cancel  context.CancelFunc
+}
+
+// NewRunner создает исполнителя и запускает workers воркеров
+func NewRunner(store Store, a analyzer.Analyzer, source FrameSource, sink Sink, workers int) *Runner {
+	if workers < 1 {
+		workers = 1
+	}
+
+	ctx, stop := context.WithCancel(context.Background())
+	r := &Runner{
+		store:     store,
+		analyzer:  a,
+		source:    source,
+		sink:      sink,
+		BatchSize: defaultBatchSize,
+		queue:     make(chan primitive.ObjectID, 256),
+		ctx:       ctx,
+		stop:      stop,
+		running:   make(map[primitive.ObjectID]runningJob),
+	}
+
+	for i := 0; i < workers; i++ {
+		r.wg.Add(1)
+		go r.worker()
+	}
+	return r
+}
+
+// Stop останавливает воркеров. Выполнявшиеся задачи возвращаются в очередь
+// и продолжатся после Recover при следующем запуске.
+func (r *Runner) Stop() {
+	r.stop()
+	r.wg.Wait()
+}
+
+// Submit сохраняет новую задачу и ставит её в очередь
+func (r *Runner) Submit(ctx context.Context, job *models.AnalysisJob) error {
+	now := time.Now()
+	job.Status = models.JobStatusQueued
+	job.CreatedAt = now
+	job.UpdatedAt = now
+	if err := r.store.Create(ctx, job); err != nil {
+		return err
+	}
+	r.enqueue(job.ID)
+	return nil
+}
+
+// Cancel отменяет задачу в очереди или останавливает выполняющуюся.
+// Статус сохраняется сразу; воркер остановленной задачи его уже не перезапишет.
+func (r *Runner) Cancel(ctx context.Context, id primitive.ObjectID) (*models.AnalysisJob, error) {
+	for {
+		job, err := r.store.Get(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		if job.IsFinished() {
+			return job, ErrJobFinished
+		}
+
+		status, attempts := job.Status, job.Attempts
+		now := time.Now()
+		job.Status = models.JobStatusCancelled
+		job.FinishedAt = &now
+		job.UpdatedAt = now
+		err = r.store.UpdateIf(ctx, job, status, attempts)
+		if errors.Is(err, ErrJobStateChanged) {
+			// Воркер успел взять или завершить задачу: перечитываем её
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		r.mu.Lock()
+		if running, ok := r.running[id]; ok && running.attempt == attempts {
+			running.cancel()
+		}
+		r.mu.Unlock()
+
+		if r.OnFinish != nil {
+			r.OnFinish(job)
+		}
+		return job, nil
+	}
+}
+
+// Retry повторно ставит в очередь упавшую или отменённую задачу.
+// Уже сохранённые кадры перезаписываются, поэтому трек не дублируется.
+func (r *Runner) Retry(ctx context.Context, id primitive.ObjectID) (*models.AnalysisJob, error) {
+	for {
+		job, err := r.store.Get(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		if job.Status != models.JobStatusFailed && job.Status != models.JobStatusCancelled {
+			return job, ErrJobNotRetryable
+		}
+
+		status, attempts := job.Status, job.Attempts
+		resetJob(job)
+		err = r.store.UpdateIf(ctx, job, status, attempts)
+		if errors.Is(err, ErrJobStateChanged) {
+			// Задачу уже перезапустили параллельным запросом
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		r.enqueue(job.ID)
+		return job, nil
+	}
+}
+
+// Recover ставит в очередь задачи, не завершённые до перезапуска сервера
+func (r *Runner) Recover(ctx context.Context) error {
+	jobs, err := r.store.ListUnfinished(ctx)
+	if err != nil {
+		return err
+	}
+
+	for i := range jobs {
+		job := &jobs[i]
+		r.mu.Lock()
+		_, running := r.running[job.ID]
+		r.mu.Unlock()
+		if running {
+			continue
+		}
+		if job.Status == models.JobStatusRunning {
+			attempts := job.Attempts
+			resetJob(job)
+			err := r.store.UpdateIf(ctx, job, models.JobStatusRunning, attempts)
+			if errors.Is(err, ErrJobStateChanged) {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+		}
+		r.enqueue(job.ID)
+	}
+	return nil
+}
+
+func resetJob(job *models.AnalysisJob) {
+	job.Status = models.JobStatusQueued
+	job.Progress = 0
+	job.FramesProcessed = 0
+	job.PosesDetected = 0
+	job.Error = ""
+	job.StartedAt = nil
+	job.FinishedAt = nil
+	job.UpdatedAt = time.Now()
+}
+
+func (r *Runner) enqueue(id primitive.ObjectID) {
+	select {
+	case r.queue <- id:
+	default:
+		// Очередь заполнена: не блокируем обработчик запроса
+		go func() {
+			select {
+			case r.queue <- id:
+			case <-r.ctx.Done():
+			}
+		}()
+	}
+}
+
+func (r *Runner) worker() {
+	defer r.wg.Done()
+	for {
+		select {
+		case <-r.ctx.Done():
+			return
+		case id := <-r.queue:
+			r.process(id)
+		}
+	}
+}
+
+func (r *Runner) process(id primitive.ObjectID) {
+	job, err := r.store.Get(r.ctx, id)
+	if err != nil || job.Status != models.JobStatusQueued {
+		// Задача отменена, пока ждала в очереди, или уже взята другим воркером
+		return
+	}
+
+	ctx, cancel := context.WithCancel(r.ctx)
+	defer cancel()
+
+	queuedAttempts := job.Attempts
+	now := time.Now()
+	job.Status = models.JobStatusRunning
+	job.Attempts++
+	job.StartedAt = &now
+	job.UpdatedAt = now
+
+	// Регистрируем попытку до захвата задачи, чтобы Cancel, увидевший
+	// статус running, мог её остановить
+	r.mu.Lock()
+	r.running[id] = runningJob{attempt: job.Attempts, cancel: cancel}
+	r.mu.Unlock()
+	defer func() {
+		r.mu.Lock()
+		if running, ok := r.running[id]; ok && running.attempt == job.Attempts {
+			delete(r.running, id)
+		}
+		r.mu.Unlock()
+	}()
+
+	if err := r.store.UpdateIf(ctx, job, models.JobStatusQueued, queuedAttempts); err != nil {
+		if !errors.Is(err, ErrJobStateChanged) {
+			// Задача остаётся в очереди и продолжится после Recover
+			log.Printf("[ANALYSIS_JOB] Failed to start job %s: %v", id.Hex(), err)
+		}
+		return
+	}
+
+	r.finish(ctx, job, r.run(ctx, job))
+}
+
+// save сохраняет выполняющуюся задачу, если её не отменили и не перезапустили
+func (r *Runner) save(ctx context.Context, job *models.AnalysisJob) error {
+	return r.store.UpdateIf(ctx, job, models.JobStatusRunning, job.Attempts)
+}
+
+// run извлекает кадры, отправляет их на анализ и сохраняет позы выбранного танцора
+func (r *Runner) run(ctx context.Context, job *models.AnalysisJob) error {
+	duration, err := r.source.Duration(ctx, job.VideoPath)
+	if err != nil {
+		return err
+	}
+	job.FramesTotal = int(math.Max(1, math.Round(duration*job.SampleRate)))
+
+	if err := r.sink.Prepare(ctx, job); err != nil {
+		return err
+	}
+	if err := r.save(ctx, job); err != nil {
+		return err
+	}
+
+	var batch []models.PoseFrame
+	flush := func() error {
+		if len(batch) > 0 {
+			if err := r.sink.Write(ctx, job, batch); err != nil {
+				return err
+			}
+			batch = nil
+		}
+		// Прогресс достигает 100% только после успешного завершения
+		job.Progress = math.Min(99, math.Floor(float64(job.FramesProcessed)/float64(job.FramesTotal)*1000)/10)
+		job.UpdatedAt = time.Now()
+		return r.save(ctx, job)
+	}
+
+	err = r.source.Extract(ctx, job.VideoPath, job.SampleRate, func(frame Frame) error {
+		pd, err := r.analyze(ctx, frame.Image)
+		if err != nil {
+			return fmt.Errorf("frame at %.2fs: %w", frame.Time, err)
+		}
+		job.FramesProcessed++
+
+		if pd.Skeleton != models.SkeletonMediaPipe33 {
+			if pd, err = pd.ConvertSkeleton(models.SkeletonMediaPipe33); err != nil {
+				return err
+			}
+		}
+		if pose, ok := pd.Pose(job.PersonIndex); ok {
+			batch = append(batch, models.PoseFrame{Time: frame.Time, Joints: pose.Joints})
+			job.PosesDetected++
+		}
+
+		if job.FramesProcessed%r.BatchSize == 0 {
+			return flush()
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return flush()
+}
+
+// analyze распознаёт позы на кадре. Если анализатор временно недоступен или
+// превышен его лимит запросов, задача ждёт указанное время, удваивая его с
+// каждой попыткой, вместо того чтобы сразу упасть.
+func (r *Runner) analyze(ctx context.Context, image []byte) (*models.PoseData, error) {
+	for attempt := 0; ; attempt++ {
+		pd, err := r.analyzer.ProcessFrame(ctx, image)
+		var unavailable *analyzer.UnavailableError
+		if err == nil || !errors.As(err, &unavailable) || attempt >= maxUnavailableWaits {
+			return pd, err
+		}
+
+		wait := unavailable.RetryAfter << attempt
+		if wait > maxUnavailableWait {
+			wait = maxUnavailableWait
+		}
+		log.Printf("[ANALYSIS_JOB] Analyzer unavailable, waiting %s: %v", wait, err)
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// finish записывает итоговый статус задачи. Отменённую во время выполнения
+// задачу не трогает: её статус уже сохранил Cancel.
+func (r *Runner) finish(ctx context.Context, job *models.AnalysisJob, err error) {
+	now := time.Now()
+	job.UpdatedAt = now
+
+	switch {
+	case err == nil:
+		job.Status = models.JobStatusCompleted
+		job.Progress = 100
+		job.FinishedAt = &now
+	case r.ctx.Err() != nil:
+		// Сервер останавливается: задача продолжится после перезапуска
+		resetJob(job)
+	case ctx.Err() != nil:
+		job.Status = models.JobStatusCancelled
+		job.FinishedAt = &now
+	default:
+		job.Status = models.JobStatusFailed
+		job.Error = err.Error()
+		job.FinishedAt = &now
+		log.Printf("[ANALYSIS_JOB] Job %s failed: %v", job.ID.Hex(), err)
+	}
+
+	saveCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := r.save(saveCtx, job); err != nil {
+		if !errors.Is(err, ErrJobStateChanged) {
+			log.Printf("[ANALYSIS_JOB] Failed to save job %s: %v", job.ID.Hex(), err)
+		}
+		return
+	}
+	if job.IsFinished() && r.OnFinish != nil {
+		r.OnFinish(job)
+	}
+}
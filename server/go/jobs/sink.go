@@ -0,0 +1,99 @@
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/kktjss/dance-flow/config"
+	"github.com/kktjss/dance-flow/models"
+	"github.com/kktjss/dance-flow/posetrack"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Sink сохраняет результаты анализа
+type Sink interface {
+	// Prepare создает хранилище результатов задачи и записывает его ID в job.TrackID
+	Prepare(ctx context.Context, job *models.AnalysisJob) error
+	Write(ctx context.Context, job *models.AnalysisJob, frames []models.PoseFrame) error
+}
+
+// TrackSink записывает позы в трек поз проекта. Повторный запуск задачи
+// перезаписывает кадры с тем же временем, поэтому повтор идемпотентен.
+type TrackSink struct{}
+
+// Prepare создает трек для задачи, если его ещё нет
+func (TrackSink) Prepare(ctx context.Context, job *models.AnalysisJob) error {
+	if !job.TrackID.IsZero() {
+		count, err := config.PoseTracksCollection.CountDocuments(ctx, bson.M{"_id": job.TrackID})
+		if err != nil {
+			return err
+		}
+		if count > 0 {
+			return nil
+		}
+	}
+
+	now := time.Now()
+	track := models.PoseTrack{
+		ID:             primitive.NewObjectID(),
+		ProjectID:      job.ProjectID,
+		Name:           fmt.Sprintf("Analysis %s (person %d)", now.Format("2006-01-02 15:04"), job.PersonIndex),
+		PersonIndex:    job.PersonIndex,
+		Skeleton:       models.SkeletonMediaPipe33,
+		SourceVideoURL: job.VideoURL,
+		CreatedBy:      job.CreatedBy,
+		CreatedAt:      now,
+		UpdatedAt:      now,
+	}
+	if _, err := config.PoseTracksCollection.InsertOne(ctx, track); err != nil {
+		return fmt.Errorf("failed to create pose track: %w", err)
+	}
+	job.TrackID = track.ID
+	return nil
+}
+
+// Write дописывает кадры в трек
+func (TrackSink) Write(ctx context.Context, job *models.AnalysisJob, frames []models.PoseFrame) error {
+	var track models.PoseTrack
+	if err := config.PoseTracksCollection.FindOne(ctx, bson.M{"_id": job.TrackID}).Decode(&track); err != nil {
+		return fmt.Errorf("failed to load pose track: %w", err)
+	}
+	return posetrack.AppendFrames(ctx, &track, frames)
+}
+
+// MemorySink собирает результаты в памяти; используется в тестах
+type MemorySink struct {
+	mu     sync.Mutex
+	frames map[primitive.ObjectID][]models.PoseFrame
+}
+
+// NewMemorySink создает пустой приёмник результатов
+func NewMemorySink() *MemorySink {
+	return &MemorySink{frames: make(map[primitive.ObjectID][]models.PoseFrame)}
+}
+
+// Prepare выделяет ID трека
+func (s *MemorySink) Prepare(ctx context.Context, job *models.AnalysisJob) error {
+	if job.TrackID.IsZero() {
+		job.TrackID = primitive.NewObjectID()
+	}
+	return nil
+}
+
+// Write сохраняет кадры с заменой кадров с тем же временем
+func (s *MemorySink) Write(ctx context.Context, job *models.AnalysisJob, frames []models.PoseFrame) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.frames[job.TrackID] = posetrack.Merge(s.frames[job.TrackID], frames)
+	return nil
+}
+
+// Frames возвращает сохранённые кадры трека
+func (s *MemorySink) Frames(trackID primitive.ObjectID) []models.PoseFrame {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.frames[trackID]
+}
@@ -0,0 +1,145 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/kktjss/dance-flow/config"
+	"github.com/kktjss/dance-flow/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// ErrJobNotFound возвращается, если задачи нет в хранилище
+var ErrJobNotFound = errors.New("analysis job not found")
+
+// ErrJobStateChanged возвращается, если задачу успели изменить: отменить,
+// перезапустить или взять другим воркером
+var ErrJobStateChanged = errors.New("analysis job state changed")
+
+// Store хранит состояние задач анализа
+type Store interface {
+	Create(ctx context.Context, job *models.AnalysisJob) error
+	Get(ctx context.Context, id primitive.ObjectID) (*models.AnalysisJob, error)
+	// UpdateIf сохраняет задачу, только если в хранилище она всё ещё в статусе
+	// status и с числом попыток attempts, иначе возвращает ErrJobStateChanged
+	UpdateIf(ctx context.Context, job *models.AnalysisJob, status string, attempts int) error
+	// ListUnfinished возвращает задачи в очереди и выполняющиеся задачи
+	ListUnfinished(ctx context.Context) ([]models.AnalysisJob, error)
+}
+
+// MongoStore хранит задачи в коллекции analysisJobs
+type MongoStore struct{}
+
+// Create сохраняет новую задачу
+func (MongoStore) Create(ctx context.Context, job *models.AnalysisJob) error {
+	if job.ID.IsZero() {
+		job.ID = primitive.NewObjectID()
+	}
+	_, err := config.AnalysisJobsCollection.InsertOne(ctx, job)
+	return err
+}
+
+// Get загружает задачу по ID
+func (MongoStore) Get(ctx context.Context, id primitive.ObjectID) (*models.AnalysisJob, error) {
+	var job models.AnalysisJob
+	err := config.AnalysisJobsCollection.FindOne(ctx, bson.M{"_id": id}).Decode(&job)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrJobNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// UpdateIf сохраняет состояние задачи целиком условной заменой
+func (MongoStore) UpdateIf(ctx context.Context, job *models.AnalysisJob, status string, attempts int) error {
+	result, err := config.AnalysisJobsCollection.ReplaceOne(ctx, bson.M{
+		"_id":      job.ID,
+		"status":   status,
+		"attempts": attempts,
+	}, job)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrJobStateChanged
+	}
+	return nil
+}
+
+// ListUnfinished возвращает незавершённые задачи
+func (MongoStore) ListUnfinished(ctx context.Context) ([]models.AnalysisJob, error) {
+	cursor, err := config.AnalysisJobsCollection.Find(ctx, bson.M{
+		"status": bson.M{"$in": []string{models.JobStatusQueued, models.JobStatusRunning}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	var jobs []models.AnalysisJob
+	if err := cursor.All(ctx, &jobs); err != nil {
+		return nil, err
+	}
+	return jobs, nil
+}
+
+// MemoryStore хранит задачи в памяти; используется в тестах
+type MemoryStore struct {
+	mu   sync.Mutex
+	jobs map[primitive.ObjectID]models.AnalysisJob
+}
+
+// NewMemoryStore создает пустое хранилище в памяти
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{jobs: make(map[primitive.ObjectID]models.AnalysisJob)}
+}
+
+// Create сохраняет новую задачу
+func (s *MemoryStore) Create(ctx context.Context, job *models.AnalysisJob) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if job.ID.IsZero() {
+		job.ID = primitive.NewObjectID()
+	}
+	s.jobs[job.ID] = *job
+	return nil
+}
+
+// Get возвращает копию задачи
+func (s *MemoryStore) Get(ctx context.Context, id primitive.ObjectID) (*models.AnalysisJob, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	job, ok := s.jobs[id]
+	if !ok {
+		return nil, ErrJobNotFound
+	}
+	return &job, nil
+}
+
+// UpdateIf сохраняет состояние задачи, если оно не изменилось
+func (s *MemoryStore) UpdateIf(ctx context.Context, job *models.AnalysisJob, status string, attempts int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stored, ok := s.jobs[job.ID]
+	if !ok || stored.Status != status || stored.Attempts != attempts {
+		return ErrJobStateChanged
+	}
+	s.jobs[job.ID] = *job
+	return nil
+}
+
+// ListUnfinished возвращает незавершённые задачи
+func (s *MemoryStore) ListUnfinished(ctx context.Context) ([]models.AnalysisJob, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var jobs []models.AnalysisJob
+	for _, job := range s.jobs {
+		if !job.IsFinished() {
+			jobs = append(jobs, job)
+		}
+	}
+	return jobs, nil
+}
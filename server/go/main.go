@@ -12,6 +12,7 @@ import (
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
 	"github.com/kktjss/dance-flow/config"
+	"github.com/kktjss/dance-flow/middleware"
 	"github.com/kktjss/dance-flow/routes"
 )
 
@@ -115,6 +116,8 @@ func main() {
 
 	// Create API group
 	api := router.Group("/api")
+	// Журнал аудита для всех изменяющих маршрутов
+	api.Use(middleware.AuditLog(api.BasePath(), routes.AuditedRoutes))
 
 	// Register routes
 	log.Println("Registering API routes...")
@@ -130,6 +133,26 @@ func main() {
 	routes.RegisterTeamRoutes(api, cfg)
 	routes.RegisterUserRoutes(api, cfg)
 	routes.RegisterModelRoutes(api, cfg)
+	routes.RegisterPoseTrackRoutes(api, cfg)
+	routes.RegisterAnalysisJobRoutes(api, cfg)
+	routes.RegisterPoseAnalysisRoutes(api, cfg)
+	routes.RegisterBVHRoutes(api, cfg)
+	routes.RegisterProjectBundleRoutes(api, cfg)
+	routes.RegisterFormationRoutes(api, cfg)
+	routes.RegisterStageRoutes(api, cfg)
+	routes.RegisterTempoRoutes(api, cfg)
+	routes.RegisterBeatRoutes(api, cfg)
+	routes.RegisterTimelineRoutes(api, cfg)
+	routes.RegisterTransformRoutes(api, cfg)
+	routes.RegisterRosterRoutes(api, cfg)
+	routes.RegisterCastingRoutes(api, cfg)
+	routes.RegisterPartRoutes(api, cfg)
+	routes.RegisterRehearsalRoutes(api, cfg)
+	routes.RegisterCalendarRoutes(api, cfg)
+	routes.RegisterCommentRoutes(api, cfg)
+	routes.RegisterNotificationRoutes(api, cfg)
+	routes.RegisterWebhookRoutes(api, cfg)
+	routes.RegisterActivityRoutes(api, cfg)
 	
 	log.Println("All routes registered successfully!")
 
@@ -153,6 +176,9 @@ func main() {
 	config.Log("MAIN", "Shutting down server...")
 	log.Println("Shutting down server...")
 
+	// Stop background analysis while the MongoDB connection is still open
+	routes.StopAnalysisJobs()
+
 	// Implement graceful shutdown here if needed
 	config.Log("MAIN", "Server stopped")
 	log.Println("Server stopped")
@@ -0,0 +1,196 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kktjss/dance-flow/config"
+	"github.com/kktjss/dance-flow/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Тела запросов больше этого размера не разбираются для списка полей
+const maxAuditBody = 1 << 20
+
+const auditContextKey = "audit"
+
+// AuditRoute описывает, какое действие журнала аудита записывает маршрут.
+// Param - параметр пути с ID объекта; без него объектом считается проект
+// или команда из пути, а для /users/me - сам пользователь.
+type AuditRoute struct {
+	Action string
+	Target string
+	Param  string
+}
+
+// AuditDetails - сведения, которые обработчик передаёт в журнал аудита
+// через Audit. Незаполненные поля определяются по маршруту.
+type AuditDetails struct {
+	TargetID  string
+	ProjectID primitive.ObjectID
+	TeamID    primitive.ObjectID
+	// ActorID задаётся, если автора нет в контексте (регистрация), а
+	// ActorName - если автор удаляется этим же запросом
+	ActorID   primitive.ObjectID
+	ActorName string
+	Summary   string
+	Before    interface{}
+	After     interface{}
+	// Skip отменяет запись, если запрос ничего не изменил
+	Skip bool
+}
+
+// Audit возвращает сведения журнала аудита текущего запроса. Для маршрутов
+// без аудита изменения сведений ни на что не влияют.
+func Audit(c *gin.Context) *AuditDetails {
+	if details, ok := c.Get(auditContextKey); ok {
+		return details.(*AuditDetails)
+	}
+	details := &AuditDetails{}
+	c.Set(auditContextKey, details)
+	return details
+}
+
+// AuditLog записывает в журнал аудита каждый успешный запрос к маршрутам
+// из routes. Ключ routes - метод и путь маршрута без basePath, например
+// "PUT /projects/:id".
+func AuditLog(basePath string, routes map[string]AuditRoute) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		route, ok := routes[c.Request.Method+" "+strings.TrimPrefix(c.FullPath(), basePath)]
+		if !ok {
+			c.Next()
+			return
+		}
+		details := Audit(c)
+		fields := requestFields(c)
+
+		c.Next()
+
+		if details.Skip || c.IsAborted() || c.Writer.Status() >= http.StatusBadRequest {
+			return
+		}
+		event := auditEvent(c, basePath, route, details)
+		if event.After == nil && len(fields) > 0 {
+			event.After = bson.M{"fields": fields}
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := RecordAudit(ctx, event); err != nil {
+			config.LogError("AUDIT", fmt.Errorf("failed to record %s: %w", event.Action, err))
+		}
+	}
+}
+
+// auditEvent собирает запись из маршрута, пути запроса и сведений обработчика
+func auditEvent(c *gin.Context, basePath string, route AuditRoute, details *AuditDetails) *models.AuditEvent {
+	event := &models.AuditEvent{
+		ActorID:    details.ActorID,
+		ActorName:  details.ActorName,
+		Action:     route.Action,
+		TargetType: route.Target,
+		TargetID:   details.TargetID,
+		ProjectID:  details.ProjectID,
+		TeamID:     details.TeamID,
+		Summary:    details.Summary,
+		Before:     details.Before,
+		After:      details.After,
+		IP:         c.ClientIP(),
+		UserAgent:  c.Request.UserAgent(),
+	}
+	if userID, err := GetUserID(c); err == nil {
+		event.ActorID = userID
+	}
+
+	path := strings.TrimPrefix(c.FullPath(), basePath)
+	scopeID, _ := primitive.ObjectIDFromHex(c.Param("id"))
+	switch {
+	case strings.HasPrefix(path, "/projects/:id") && event.ProjectID.IsZero():
+		event.ProjectID = scopeID
+	case strings.HasPrefix(path, "/teams/:id") && event.TeamID.IsZero():
+		event.TeamID = scopeID
+	}
+	// Проект, добавленный в команду или убранный из неё
+	if route.Target == models.AuditTargetProject && route.Param != "" && event.ProjectID.IsZero() {
+		event.ProjectID, _ = primitive.ObjectIDFromHex(c.Param(route.Param))
+	}
+
+	if event.TargetID == "" {
+		switch {
+		case route.Param != "":
+			event.TargetID = c.Param(route.Param)
+		case route.Target == models.AuditTargetProject && !event.ProjectID.IsZero():
+			event.TargetID = event.ProjectID.Hex()
+		case route.Target == models.AuditTargetTeam && !event.TeamID.IsZero():
+			event.TargetID = event.TeamID.Hex()
+		case route.Target == models.AuditTargetUser && !event.ActorID.IsZero():
+			event.TargetID = event.ActorID.Hex()
+		}
+	}
+	return event
+}
+
+// RecordAudit сохраняет запись журнала. Имя автора и команда проекта
+// дополняются из базы, чтобы запись оставалась читаемой после удаления
+// пользователя и попадала в ленту команды.
+func RecordAudit(ctx context.Context, event *models.AuditEvent) error {
+	if event.CreatedAt.IsZero() {
+		event.CreatedAt = time.Now()
+	}
+	if !event.ActorID.IsZero() && event.ActorName == "" {
+		var actor models.User
+		err := config.UsersCollection.FindOne(ctx, bson.M{"_id": event.ActorID},
+			options.FindOne().SetProjection(bson.M{"username": 1, "name": 1})).Decode(&actor)
+		if err == nil {
+			event.ActorName = actor.Name
+			if event.ActorName == "" {
+				event.ActorName = actor.Username
+			}
+		}
+	}
+	if !event.ProjectID.IsZero() && event.TeamID.IsZero() {
+		var project models.Project
+		err := config.ProjectsCollection.FindOne(ctx, bson.M{"_id": event.ProjectID},
+			options.FindOne().SetProjection(bson.M{"teamId": 1})).Decode(&project)
+		if err == nil {
+			event.TeamID = project.TeamID
+		}
+	}
+	event.ID = primitive.NewObjectID()
+	_, err := config.AuditLogCollection.InsertOne(ctx, event)
+	return err
+}
+
+// requestFields возвращает имена полей JSON тела запроса, не трогая само
+// тело: значения в журнал не попадают, чтобы не сохранять пароли и секреты
+func requestFields(c *gin.Context) []string {
+	if c.Request.Body == nil || c.ContentType() != "application/json" ||
+		c.Request.ContentLength < 0 || c.Request.ContentLength > maxAuditBody {
+		return nil
+	}
+	body, err := io.ReadAll(c.Request.Body)
+	c.Request.Body = io.NopCloser(bytes.NewReader(body))
+	if err != nil {
+		return nil
+	}
+	var input map[string]json.RawMessage
+	if json.Unmarshal(body, &input) != nil {
+		return nil
+	}
+	fields := make([]string, 0, len(input))
+	for field := range input {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	return fields
+}
@@ -7,6 +7,7 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/kktjss/dance-flow/config"
+	"github.com/kktjss/dance-flow/models"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
@@ -142,4 +143,34 @@ func CheckTeamAccess() gin.HandlerFunc {
 		// Доступ к команде разрешен
 		c.Next()
 	}
-} 
\ No newline at end of file
+} 
+
+// IsTeamMember проверяет, является ли пользователь владельцем или участником команды
+func IsTeamMember(ctx context.Context, userID, teamID primitive.ObjectID) bool {
+	if teamID.IsZero() {
+		return false
+	}
+
+	count, err := config.TeamsCollection.CountDocuments(ctx, bson.M{
+		"_id": teamID,
+		"$or": []bson.M{
+			{"owner": userID},          // Пользователь является владельцем команды
+			{"members.userId": userID}, // Пользователь является участником команды
+		},
+	})
+	return err == nil && count > 0
+}
+
+// CanEditProject проверяет, может ли пользователь изменять проект: как
+// CheckProjectAccess, это владелец проекта и участники его команды
+func CanEditProject(ctx context.Context, userID primitive.ObjectID, project *models.Project) bool {
+	return project.Owner == userID || IsTeamMember(ctx, userID, project.TeamID)
+}
+
+// CanReadProject проверяет, может ли пользователь просматривать проект
+func CanReadProject(ctx context.Context, userID primitive.ObjectID, project *models.Project) bool {
+	if !project.IsPrivate || project.Owner == userID {
+		return true
+	}
+	return IsTeamMember(ctx, userID, project.TeamID)
+}
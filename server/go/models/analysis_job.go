@@ -0,0 +1,56 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Статусы задачи анализа видео
+const (
+	JobStatusQueued    = "queued"
+	JobStatusRunning   = "running"
+	JobStatusCompleted = "completed"
+	JobStatusFailed    = "failed"
+	JobStatusCancelled = "cancelled"
+)
+
+// AnalysisJob представляет фоновую задачу покадрового анализа видео.
+// Результаты записываются в трек поз проекта.
+type AnalysisJob struct {
+	ID              primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	ProjectID       primitive.ObjectID `json:"projectId" bson:"projectId"`
+	VideoURL        string             `json:"videoUrl" bson:"videoUrl"`
+	VideoPath       string             `json:"-" bson:"videoPath"`
+	SampleRate      float64            `json:"sampleRate" bson:"sampleRate"`
+	PersonIndex     int                `json:"personIndex" bson:"personIndex"`
+	TrackID         primitive.ObjectID `json:"trackId,omitempty" bson:"trackId,omitempty"`
+	Status          string             `json:"status" bson:"status"`
+	Progress        float64            `json:"progress" bson:"progress"`
+	FramesTotal     int                `json:"framesTotal" bson:"framesTotal"`
+	FramesProcessed int                `json:"framesProcessed" bson:"framesProcessed"`
+	PosesDetected   int                `json:"posesDetected" bson:"posesDetected"`
+	Error           string             `json:"error,omitempty" bson:"error,omitempty"`
+	Attempts        int                `json:"attempts" bson:"attempts"`
+	CreatedBy       primitive.ObjectID `json:"createdBy" bson:"createdBy"`
+	CreatedAt       time.Time          `json:"createdAt" bson:"createdAt"`
+	StartedAt       *time.Time         `json:"startedAt,omitempty" bson:"startedAt,omitempty"`
+	FinishedAt      *time.Time         `json:"finishedAt,omitempty" bson:"finishedAt,omitempty"`
+	UpdatedAt       time.Time          `json:"updatedAt" bson:"updatedAt"`
+}
+
+// IsFinished сообщает, завершена ли задача (успешно или нет)
+func (j *AnalysisJob) IsFinished() bool {
+	switch j.Status {
+	case JobStatusCompleted, JobStatusFailed, JobStatusCancelled:
+		return true
+	}
+	return false
+}
+
+// AnalysisJobCreateInput представляет параметры запуска анализа уже загруженного видео
+type AnalysisJobCreateInput struct {
+	VideoURL    string  `json:"videoUrl" form:"videoUrl"`
+	SampleRate  float64 `json:"sampleRate" form:"sampleRate"`
+	PersonIndex int     `json:"personIndex" form:"personIndex"`
+}
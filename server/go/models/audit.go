@@ -0,0 +1,201 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Действия журнала аудита
+const (
+	AuditProjectCreated   = "project.created"
+	AuditProjectUpdated   = "project.updated"
+	AuditProjectDeleted   = "project.deleted"
+	AuditProjectImported  = "project.imported"
+	AuditKeyframesUpdated = "keyframes.updated"
+	AuditKeyframesDeleted = "keyframes.deleted"
+	AuditStageUpdated     = "stage.updated"
+	AuditTempoUpdated     = "tempo.updated"
+	AuditTempoCleared     = "tempo.cleared"
+	AuditBeatsDetected    = "beats.detected"
+	AuditBeatsCleared     = "beats.cleared"
+	AuditCastingUpdated   = "casting.updated"
+	AuditCastingCleared   = "casting.cleared"
+	AuditSectionCreated   = "timeline.section_created"
+	AuditSectionUpdated   = "timeline.section_updated"
+	AuditSectionDeleted   = "timeline.section_deleted"
+	AuditCueCreated       = "timeline.cue_created"
+	AuditCueUpdated       = "timeline.cue_updated"
+	AuditCueDeleted       = "timeline.cue_deleted"
+	AuditFormationApplied = "formation.transition_applied"
+	AuditElementsMoved    = "elements.transformed"
+	AuditPoseTrackCreated = "pose_track.created"
+	AuditPoseTrackUpdated = "pose_track.updated"
+	AuditPoseTrackDeleted = "pose_track.deleted"
+	AuditAnalysisStarted  = "analysis_job.created"
+	AuditAnalysisCanceled = "analysis_job.cancelled"
+	AuditAnalysisRetried  = "analysis_job.retried"
+	AuditCommentCreated   = "comment.created"
+	AuditCommentUpdated   = "comment.updated"
+	AuditCommentDeleted   = "comment.deleted"
+	AuditCommentResolved  = "comment.resolved"
+	AuditCommentReopened  = "comment.unresolved"
+
+	AuditTeamCreated        = "team.created"
+	AuditTeamUpdated        = "team.updated"
+	AuditTeamDeleted        = "team.deleted"
+	AuditTeamMemberAdded    = "team.member_added"
+	AuditTeamMemberRemoved  = "team.member_removed"
+	AuditTeamProjectAdded   = "team.project_added"
+	AuditTeamProjectRemoved = "team.project_removed"
+	AuditDancerAdded        = "roster.dancer_added"
+	AuditDancerUpdated      = "roster.dancer_updated"
+	AuditDancerRemoved      = "roster.dancer_removed"
+	AuditRehearsalCreated   = "rehearsal.created"
+	AuditRehearsalUpdated   = "rehearsal.updated"
+	AuditRehearsalDeleted   = "rehearsal.deleted"
+	AuditRehearsalRSVP      = "rehearsal.rsvp"
+	AuditAttendanceMarked   = "rehearsal.attendance_marked"
+
+	AuditCalendarTokenCreated = "calendar_token.created"
+	AuditCalendarTokenRevoked = "calendar_token.revoked"
+	AuditWebhookCreated       = "webhook.created"
+	AuditWebhookUpdated       = "webhook.updated"
+	AuditWebhookDeleted       = "webhook.deleted"
+	AuditWebhookSecretRotated = "webhook.secret_rotated"
+	AuditWebhookTested        = "webhook.tested"
+	AuditWebhookRedelivered   = "webhook.redelivered"
+
+	AuditUserRegistered = "user.registered"
+	AuditUserUpdated    = "user.updated"
+	AuditUserDeleted    = "user.deleted"
+	AuditPreferencesSet = "user.notification_preferences_updated"
+	AuditModelUploaded  = "model.uploaded"
+	AuditModelUpdated   = "model.updated"
+	AuditModelDeleted   = "model.deleted"
+	AuditFileUploaded   = "file.uploaded"
+)
+
+// AuditActions - все действия журнала; по ним проверяется фильтр ленты
+var AuditActions = []string{
+	AuditProjectCreated,
+	AuditProjectUpdated,
+	AuditProjectDeleted,
+	AuditProjectImported,
+	AuditKeyframesUpdated,
+	AuditKeyframesDeleted,
+	AuditStageUpdated,
+	AuditTempoUpdated,
+	AuditTempoCleared,
+	AuditBeatsDetected,
+	AuditBeatsCleared,
+	AuditCastingUpdated,
+	AuditCastingCleared,
+	AuditSectionCreated,
+	AuditSectionUpdated,
+	AuditSectionDeleted,
+	AuditCueCreated,
+	AuditCueUpdated,
+	AuditCueDeleted,
+	AuditFormationApplied,
+	AuditElementsMoved,
+	AuditPoseTrackCreated,
+	AuditPoseTrackUpdated,
+	AuditPoseTrackDeleted,
+	AuditAnalysisStarted,
+	AuditAnalysisCanceled,
+	AuditAnalysisRetried,
+	AuditCommentCreated,
+	AuditCommentUpdated,
+	AuditCommentDeleted,
+	AuditCommentResolved,
+	AuditCommentReopened,
+	AuditTeamCreated,
+	AuditTeamUpdated,
+	AuditTeamDeleted,
+	AuditTeamMemberAdded,
+	AuditTeamMemberRemoved,
+	AuditTeamProjectAdded,
+	AuditTeamProjectRemoved,
+	AuditDancerAdded,
+	AuditDancerUpdated,
+	AuditDancerRemoved,
+	AuditRehearsalCreated,
+	AuditRehearsalUpdated,
+	AuditRehearsalDeleted,
+	AuditRehearsalRSVP,
+	AuditAttendanceMarked,
+	AuditCalendarTokenCreated,
+	AuditCalendarTokenRevoked,
+	AuditWebhookCreated,
+	AuditWebhookUpdated,
+	AuditWebhookDeleted,
+	AuditWebhookSecretRotated,
+	AuditWebhookTested,
+	AuditWebhookRedelivered,
+	AuditUserRegistered,
+	AuditUserUpdated,
+	AuditUserDeleted,
+	AuditPreferencesSet,
+	AuditModelUploaded,
+	AuditModelUpdated,
+	AuditModelDeleted,
+	AuditFileUploaded,
+}
+
+// Типы объектов журнала аудита
+const (
+	AuditTargetProject     = "project"
+	AuditTargetTeam        = "team"
+	AuditTargetUser        = "user"
+	AuditTargetComment     = "comment"
+	AuditTargetKeyframe    = "keyframe"
+	AuditTargetPoseTrack   = "pose_track"
+	AuditTargetAnalysisJob = "analysis_job"
+	AuditTargetSection     = "timeline_section"
+	AuditTargetCue         = "timeline_cue"
+	AuditTargetDancer      = "dancer"
+	AuditTargetRehearsal   = "rehearsal"
+	AuditTargetWebhook     = "webhook"
+	AuditTargetModel       = "model"
+	AuditTargetFile        = "file"
+)
+
+// Размер страницы ленты активности
+const (
+	DefaultAuditLimit = 50
+	MaxAuditLimit     = 200
+)
+
+// AuditEvent - неизменяемая запись журнала аудита. Сервер создаёт её после
+// успешного изменяющего запроса; записи не редактируются и не удаляются,
+// в том числе вместе с проектом или учётной записью, поэтому имя автора
+// сохраняется в самой записи.
+type AuditEvent struct {
+	ID         primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	ActorID    primitive.ObjectID `json:"actorId,omitempty" bson:"actorId,omitempty"`
+	ActorName  string             `json:"actorName,omitempty" bson:"actorName,omitempty"`
+	Action     string             `json:"action" bson:"action"`
+	TargetType string             `json:"targetType" bson:"targetType"`
+	TargetID   string             `json:"targetId,omitempty" bson:"targetId,omitempty"`
+	ProjectID  primitive.ObjectID `json:"projectId,omitempty" bson:"projectId,omitempty"`
+	TeamID     primitive.ObjectID `json:"teamId,omitempty" bson:"teamId,omitempty"`
+	// Summary - описание изменения для ленты
+	Summary string `json:"summary,omitempty" bson:"summary,omitempty"`
+	// Before и After - краткое состояние объекта до и после изменения
+	Before    interface{} `json:"before,omitempty" bson:"before,omitempty"`
+	After     interface{} `json:"after,omitempty" bson:"after,omitempty"`
+	IP        string      `json:"ip,omitempty" bson:"ip,omitempty"`
+	UserAgent string      `json:"userAgent,omitempty" bson:"userAgent,omitempty"`
+	CreatedAt time.Time   `json:"createdAt" bson:"createdAt"`
+}
+
+// IsAuditAction сообщает, что действие есть в журнале
+func IsAuditAction(action string) bool {
+	for _, a := range AuditActions {
+		if a == action {
+			return true
+		}
+	}
+	return false
+}
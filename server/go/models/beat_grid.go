@@ -0,0 +1,34 @@
+package models
+
+import (
+	"math"
+	"time"
+)
+
+// BeatGrid - доли и сильные доли, найденные в аудио проекта. Offset - момент
+// первой сильной доли, BPM - средний темп по найденным долям, Confidence -
+// выраженность периодичности ударов от 0 до 1.
+type BeatGrid struct {
+	AudioURL    string    `json:"audioUrl" bson:"audioUrl"`
+	BPM         float64   `json:"bpm" bson:"bpm"`
+	BeatsPerBar int       `json:"beatsPerBar" bson:"beatsPerBar"`
+	Offset      float64   `json:"offset" bson:"offset"`
+	Confidence  float64   `json:"confidence" bson:"confidence"`
+	Duration    float64   `json:"duration" bson:"duration"`
+	Beats       []float64 `json:"beats" bson:"beats"`
+	Downbeats   []float64 `json:"downbeats" bson:"downbeats"`
+	Onsets      []float64 `json:"onsets" bson:"onsets"`
+	AnalyzedAt  time.Time `json:"analyzedAt" bson:"analyzedAt"`
+}
+
+// TempoMap возвращает карту темпа с постоянным темпом сетки, начинающуюся
+// с первой сильной доли
+func (g *BeatGrid) TempoMap() TempoMap {
+	return TempoMap{
+		BPM:             math.Round(g.BPM*100) / 100,
+		BeatsPerBar:     g.BeatsPerBar,
+		BeatUnit:        4,
+		Offset:          g.Offset,
+		CountsPerPhrase: DefaultPhraseLen,
+	}
+}
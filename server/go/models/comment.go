@@ -0,0 +1,119 @@
+package models
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Ограничения комментариев
+const (
+	MaxCommentLength     = 5000
+	MaxCommentMentions   = 20
+	MaxThreadReplies     = 500
+	DefaultCommentsLimit = 100
+	MaxCommentsLimit     = 500
+)
+
+// Упоминание - @ и имя пользователя из букв, цифр, "_", "-" и "."
+var mentionPattern = regexp.MustCompile(`(?:^|[^\p{L}\p{N}_])@([\p{L}\p{N}_.\-]+)`)
+
+// Comment - комментарий к проекту. Ветку открывает корневой комментарий с
+// моментом времени и, если заданы, элементом и областью кадра видео;
+// ответы ссылаются на него через ThreadID.
+type Comment struct {
+	ID        primitive.ObjectID  `json:"id" bson:"_id,omitempty"`
+	ProjectID primitive.ObjectID  `json:"projectId" bson:"projectId"`
+	ThreadID  *primitive.ObjectID `json:"threadId,omitempty" bson:"threadId,omitempty"`
+	AuthorID  primitive.ObjectID  `json:"authorId" bson:"authorId"`
+	Body      string              `json:"body" bson:"body"`
+	// Time - момент постановки в секундах, к которому относится ветка
+	Time      float64        `json:"time" bson:"time"`
+	ElementID string         `json:"elementId,omitempty" bson:"elementId,omitempty"`
+	Region    *CommentRegion `json:"region,omitempty" bson:"region,omitempty"`
+	// Mentions - упомянутые участники команды проекта
+	Mentions   []primitive.ObjectID `json:"mentions" bson:"mentions"`
+	Resolved   bool                 `json:"resolved" bson:"resolved"`
+	ResolvedBy *primitive.ObjectID  `json:"resolvedBy,omitempty" bson:"resolvedBy,omitempty"`
+	ResolvedAt *time.Time           `json:"resolvedAt,omitempty" bson:"resolvedAt,omitempty"`
+	ReplyCount int                  `json:"replyCount" bson:"replyCount"`
+	// LastActivityAt - время последнего ответа или изменения ветки
+	LastActivityAt time.Time  `json:"lastActivityAt" bson:"lastActivityAt"`
+	EditedAt       *time.Time `json:"editedAt,omitempty" bson:"editedAt,omitempty"`
+	CreatedAt      time.Time  `json:"createdAt" bson:"createdAt"`
+}
+
+// CommentRegion - прямоугольник на кадре видео в долях его ширины и высоты
+type CommentRegion struct {
+	X      float64 `json:"x" bson:"x"`
+	Y      float64 `json:"y" bson:"y"`
+	Width  float64 `json:"width" bson:"width"`
+	Height float64 `json:"height" bson:"height"`
+}
+
+// CommentInput - поля комментария при создании. Time, ElementID и Region
+// задаются только для новой ветки.
+type CommentInput struct {
+	Body      string         `json:"body"`
+	Time      *float64       `json:"time"`
+	ElementID string         `json:"elementId"`
+	Region    *CommentRegion `json:"region"`
+}
+
+// IsThread сообщает, что комментарий открывает ветку
+func (c *Comment) IsThread() bool {
+	return c.ThreadID == nil
+}
+
+// ValidateCommentBody проверяет и обрезает текст комментария
+func ValidateCommentBody(body string) (string, error) {
+	body = strings.TrimSpace(body)
+	if body == "" {
+		return "", fmt.Errorf("comment body is required")
+	}
+	if utf8.RuneCountInString(body) > MaxCommentLength {
+		return "", fmt.Errorf("comment must be at most %d characters", MaxCommentLength)
+	}
+	return body, nil
+}
+
+// Validate проверяет привязку ветки ко времени и области кадра
+func (in *CommentInput) Validate() error {
+	if in.Time != nil && (math.IsNaN(*in.Time) || math.IsInf(*in.Time, 0) || *in.Time < 0) {
+		return fmt.Errorf("time must be a non-negative number of seconds")
+	}
+	if r := in.Region; r != nil {
+		for _, v := range []float64{r.X, r.Y, r.Width, r.Height} {
+			if math.IsNaN(v) || v < 0 || v > 1 {
+				return fmt.Errorf("region must be given in fractions of the video frame")
+			}
+		}
+		if r.Width == 0 || r.Height == 0 || r.X+r.Width > 1 || r.Y+r.Height > 1 {
+			return fmt.Errorf("region must be a non-empty rectangle inside the video frame")
+		}
+	}
+	return nil
+}
+
+// ParseMentions возвращает имена пользователей, упомянутых через @, без
+// повторов и в порядке появления. Точка в конце имени считается концом
+// предложения.
+func ParseMentions(body string) []string {
+	names := []string{}
+	seen := map[string]bool{}
+	for _, match := range mentionPattern.FindAllStringSubmatch(body, -1) {
+		name := strings.TrimRight(match[1], ".")
+		key := strings.ToLower(name)
+		if name == "" || seen[key] {
+			continue
+		}
+		seen[key] = true
+		names = append(names, name)
+	}
+	return names
+}
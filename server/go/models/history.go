@@ -15,7 +15,8 @@ const (
 	ActionTeamProjectUpdated = "TEAM_PROJECT_UPDATED"
 )
 
-// History представляет запись в истории действий пользователя
+// History представляет запись в истории действий пользователя. Записи
+// строятся из журнала аудита для прежнего формата GET /history.
 type History struct {
 	ID          primitive.ObjectID `bson:"_id,omitempty" json:"id"`
 	UserID      primitive.ObjectID `bson:"userId" json:"userId"`
@@ -25,13 +26,35 @@ type History struct {
 	Timestamp   time.Time          `bson:"timestamp" json:"timestamp"`
 }
 
-// CreateHistory создает новую запись в истории с текущей временной меткой
-func CreateHistory(userID, projectID primitive.ObjectID, action, description string) History {
+// HistoryFromAudit переводит запись журнала аудита в запись истории.
+// Действия, которых не было в прежней истории, остаются как есть.
+func HistoryFromAudit(event AuditEvent) History {
+	action := event.Action
+	switch event.Action {
+	case AuditProjectCreated, AuditProjectImported:
+		action = ActionProjectCreated
+	case AuditTeamMemberAdded:
+		action = ActionTeamMemberAdded
+	case AuditTeamMemberRemoved:
+		action = ActionTeamMemberRemoved
+	case AuditProjectDeleted:
+	default:
+		if !event.ProjectID.IsZero() && !event.TeamID.IsZero() {
+			action = ActionTeamProjectUpdated
+		} else if !event.ProjectID.IsZero() {
+			action = ActionProjectUpdated
+		}
+	}
+	description := event.Summary
+	if description == "" {
+		description = event.Action
+	}
 	return History{
-		UserID:      userID,
-		ProjectID:   projectID,
+		ID:          event.ID,
+		UserID:      event.ActorID,
+		ProjectID:   event.ProjectID,
 		Action:      action,
 		Description: description,
-		Timestamp:   time.Now(),
+		Timestamp:   event.CreatedAt,
 	}
-} 
\ No newline at end of file
+}
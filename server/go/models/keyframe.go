@@ -12,7 +12,7 @@ type Keyframe struct {
 	ProjectID   primitive.ObjectID `json:"projectId" bson:"projectId"`
 	Timestamp   float64            `json:"timestamp" bson:"timestamp"`
 	Label       string             `json:"label,omitempty" bson:"label,omitempty"`
-	PoseData    interface{}        `json:"poseData" bson:"poseData"`
+	PoseData    *PoseData          `json:"poseData" bson:"poseData"`
 	ImageData   string             `json:"imageData,omitempty" bson:"imageData,omitempty"`
 	CreatedBy   primitive.ObjectID `json:"createdBy" bson:"createdBy"`
 	CreatedAt   time.Time          `json:"createdAt" bson:"createdAt"`
@@ -24,13 +24,13 @@ type KeyframeCreateInput struct {
 	ProjectID string      `json:"projectId" binding:"required"`
 	Timestamp float64     `json:"timestamp" binding:"required"`
 	Label     string      `json:"label,omitempty"`
-	PoseData  interface{} `json:"poseData" binding:"required"`
+	PoseData  *PoseData   `json:"poseData" binding:"required"`
 	ImageData string      `json:"imageData,omitempty"`
 }
 
 // KeyframeUpdateInput представляет входные данные для обновления ключевого кадра
 type KeyframeUpdateInput struct {
 	Label     string      `json:"label,omitempty"`
-	PoseData  interface{} `json:"poseData,omitempty"`
+	PoseData  *PoseData   `json:"poseData,omitempty"`
 	ImageData string      `json:"imageData,omitempty"`
 } 
\ No newline at end of file
@@ -1,19 +1,82 @@
 package models
 
 import (
+	"path"
+	"strings"
 	"time"
 
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
+// Уровни видимости 3D модели
+const (
+	ModelVisibilityPrivate = "private"
+	ModelVisibilityTeam    = "team"
+	ModelVisibilityPublic  = "public"
+)
+
 // Model представляет 3D модель в системе
 type Model struct {
 	ID           primitive.ObjectID `json:"id" bson:"_id"`
 	Name         string             `json:"name" bson:"name"`
+	Description  string             `json:"description,omitempty" bson:"description,omitempty"`
 	Filename     string             `json:"filename" bson:"filename"`
 	OriginalName string             `json:"originalName" bson:"originalName"`
 	Size         int64              `json:"size" bson:"size"`
 	UserID       primitive.ObjectID `json:"userId" bson:"userId"`
+	TeamID       primitive.ObjectID `json:"teamId,omitempty" bson:"teamId,omitempty"`
+	Visibility   string             `json:"visibility" bson:"visibility,omitempty"`
+	Tags         []string           `json:"tags" bson:"tags,omitempty"`
 	CreatedAt    time.Time          `json:"createdAt" bson:"createdAt"`
+	UpdatedAt    time.Time          `json:"updatedAt,omitempty" bson:"updatedAt,omitempty"`
 	URL          string             `json:"url" bson:"-"` // URL не хранится в базе данных
-} 
\ No newline at end of file
+}
+
+// ModelUpdateInput представляет входные данные для обновления модели
+type ModelUpdateInput struct {
+	Name        string   `json:"name,omitempty"`
+	Description *string  `json:"description,omitempty"`
+	Tags        []string `json:"tags,omitempty"`
+	Visibility  string   `json:"visibility,omitempty"`
+	TeamID      *string  `json:"teamId,omitempty"`
+}
+
+// EffectiveVisibility возвращает видимость модели; старые записи без поля считаются приватными
+func (m *Model) EffectiveVisibility() string {
+	if m.Visibility == "" {
+		return ModelVisibilityPrivate
+	}
+	return m.Visibility
+}
+
+// IsValidModelVisibility проверяет допустимость значения видимости
+func IsValidModelVisibility(visibility string) bool {
+	switch visibility {
+	case ModelVisibilityPrivate, ModelVisibilityTeam, ModelVisibilityPublic:
+		return true
+	}
+	return false
+}
+
+// NormalizeTags приводит теги к нижнему регистру, убирает пробелы и дубликаты
+func NormalizeTags(tags []string) []string {
+	seen := make(map[string]bool)
+	result := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" || seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		result = append(result, tag)
+	}
+	return result
+}
+
+// ModelFilenameFromURL извлекает имя файла модели из URL анимации GLB
+func ModelFilenameFromURL(url string) string {
+	if i := strings.IndexAny(url, "?#"); i >= 0 {
+		url = url[:i]
+	}
+	return path.Base(url)
+}
@@ -0,0 +1,84 @@
+package models
+
+import (
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Типы уведомлений
+const (
+	NotificationTeamMemberAdded    = "team_member_added"
+	NotificationTeamProjectUpdated = "team_project_updated"
+	NotificationMention            = "mention"
+)
+
+// NotificationTypes - все типы уведомлений в порядке показа в настройках
+var NotificationTypes = []string{
+	NotificationTeamMemberAdded,
+	NotificationTeamProjectUpdated,
+	NotificationMention,
+}
+
+// Ограничения списка уведомлений
+const (
+	DefaultNotificationsLimit = 50
+	MaxNotificationsLimit     = 200
+)
+
+// Notification - уведомление пользователя о событии в командах и проектах.
+// Изменения проекта, пока уведомление не прочитано, копятся в одном
+// уведомлении: Count - сколько их было.
+type Notification struct {
+	ID        primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	UserID    primitive.ObjectID `json:"userId" bson:"userId"`
+	Type      string             `json:"type" bson:"type"`
+	ActorID   primitive.ObjectID `json:"actorId,omitempty" bson:"actorId,omitempty"`
+	ActorName string             `json:"actorName,omitempty" bson:"actorName,omitempty"`
+	TeamID    primitive.ObjectID `json:"teamId,omitempty" bson:"teamId,omitempty"`
+	ProjectID primitive.ObjectID `json:"projectId,omitempty" bson:"projectId,omitempty"`
+	CommentID primitive.ObjectID `json:"commentId,omitempty" bson:"commentId,omitempty"`
+	Message   string             `json:"message" bson:"message"`
+	Count     int                `json:"count" bson:"count"`
+	Read      bool               `json:"read" bson:"read"`
+	ReadAt    *time.Time         `json:"readAt,omitempty" bson:"readAt,omitempty"`
+	CreatedAt time.Time          `json:"createdAt" bson:"createdAt"`
+	UpdatedAt time.Time          `json:"updatedAt" bson:"updatedAt"`
+}
+
+// NotificationPreferences - включённые типы уведомлений пользователя.
+// Тип, которого нет в настройках, включён.
+type NotificationPreferences map[string]bool
+
+// Enabled сообщает, получает ли пользователь уведомления этого типа
+func (p NotificationPreferences) Enabled(kind string) bool {
+	enabled, ok := p[kind]
+	return !ok || enabled
+}
+
+// Resolved возвращает настройки для всех типов уведомлений
+func (p NotificationPreferences) Resolved() NotificationPreferences {
+	resolved := NotificationPreferences{}
+	for _, kind := range NotificationTypes {
+		resolved[kind] = p.Enabled(kind)
+	}
+	return resolved
+}
+
+// ValidateNotificationPreferences проверяет, что в настройках только известные типы
+func ValidateNotificationPreferences(prefs NotificationPreferences) error {
+	for kind := range prefs {
+		known := false
+		for _, candidate := range NotificationTypes {
+			if kind == candidate {
+				known = true
+				break
+			}
+		}
+		if !known {
+			return fmt.Errorf("unknown notification type %q", kind)
+		}
+	}
+	return nil
+}
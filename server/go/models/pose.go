@@ -0,0 +1,400 @@
+package models
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// PoseSchemaVersion - текущая версия схемы данных позы
+const PoseSchemaVersion = 1
+
+// Допустимый диапазон нормализованных координат: MediaPipe возвращает точки
+// чуть за пределами кадра, если танцор частично вышел из него
+const (
+	minNormalizedCoord = -1.0
+	maxNormalizedCoord = 2.0
+)
+
+// Joint представляет сустав с нормализованными координатами относительно кадра
+type Joint struct {
+	Name       string  `json:"name"`
+	X          float64 `json:"x"`
+	Y          float64 `json:"y"`
+	Z          float64 `json:"z"`
+	Visibility float64 `json:"visibility"`
+}
+
+// Pose представляет позу одного человека в кадре
+type Pose struct {
+	PersonIndex int     `json:"personIndex"`
+	Score       float64 `json:"score,omitempty"`
+	Joints      []Joint `json:"joints"`
+}
+
+// PoseData представляет все позы, обнаруженные в одном кадре
+type PoseData struct {
+	SchemaVersion int    `json:"schemaVersion"`
+	Skeleton      string `json:"skeleton"`
+	FrameWidth    int    `json:"frameWidth,omitempty"`
+	FrameHeight   int    `json:"frameHeight,omitempty"`
+	Poses         []Pose `json:"poses"`
+}
+
+// Validate проверяет данные позы и приводит суставы к порядку скелета.
+// Отсутствующие суставы добавляются с нулевой видимостью.
+func (pd *PoseData) Validate() error {
+	if pd.SchemaVersion == 0 {
+		pd.SchemaVersion = PoseSchemaVersion
+	}
+	if pd.SchemaVersion < 1 || pd.SchemaVersion > PoseSchemaVersion {
+		return fmt.Errorf("unsupported pose schema version %d (max %d)", pd.SchemaVersion, PoseSchemaVersion)
+	}
+	if pd.Skeleton == "" {
+		pd.Skeleton = SkeletonMediaPipe33
+	}
+
+	skeleton, err := GetSkeleton(pd.Skeleton)
+	if err != nil {
+		return err
+	}
+
+	if pd.FrameWidth < 0 || pd.FrameHeight < 0 {
+		return errors.New("frame size must not be negative")
+	}
+
+	seenPersons := make(map[int]bool)
+	for i := range pd.Poses {
+		pose := &pd.Poses[i]
+		if pose.PersonIndex < 0 {
+			return fmt.Errorf("pose %d: person index must not be negative", i)
+		}
+		if seenPersons[pose.PersonIndex] {
+			return fmt.Errorf("pose %d: duplicate person index %d", i, pose.PersonIndex)
+		}
+		seenPersons[pose.PersonIndex] = true
+
+		if !isFinite(pose.Score) || pose.Score < 0 || pose.Score > 1 {
+			return fmt.Errorf("pose %d: score must be between 0 and 1", i)
+		}
+
+		joints, err := canonicalJoints(skeleton, pose.Joints)
+		if err != nil {
+			return fmt.Errorf("pose %d: %w", i, err)
+		}
+		pose.Joints = joints
+	}
+
+	return nil
+}
+
+// Pose возвращает позу человека с указанным индексом
+func (pd *PoseData) Pose(personIndex int) (*Pose, bool) {
+	for i := range pd.Poses {
+		if pd.Poses[i].PersonIndex == personIndex {
+			return &pd.Poses[i], true
+		}
+	}
+	return nil, false
+}
+
+// Joint возвращает сустав позы по имени
+func (p *Pose) Joint(name string) (Joint, bool) {
+	for _, joint := range p.Joints {
+		if joint.Name == name {
+			return joint, true
+		}
+	}
+	return Joint{}, false
+}
+
+// canonicalJoints раскладывает суставы по порядку скелета и проверяет значения
+func canonicalJoints(skeleton *Skeleton, joints []Joint) ([]Joint, error) {
+	if len(joints) > len(skeleton.Joints) {
+		return nil, fmt.Errorf("too many joints for skeleton %s: %d", skeleton.Name, len(joints))
+	}
+
+	result := make([]Joint, len(skeleton.Joints))
+	for i, name := range skeleton.Joints {
+		result[i] = Joint{Name: name}
+	}
+
+	seen := make(map[string]bool, len(joints))
+	for i, joint := range joints {
+		// Безымянные суставы трактуются по порядку, как в ответе MediaPipe
+		if joint.Name == "" {
+			joint.Name = skeleton.Joints[i]
+		}
+
+		index := skeleton.JointIndex(joint.Name)
+		if index < 0 {
+			return nil, fmt.Errorf("joint %q is not part of skeleton %s", joint.Name, skeleton.Name)
+		}
+		if seen[joint.Name] {
+			return nil, fmt.Errorf("duplicate joint %q", joint.Name)
+		}
+		seen[joint.Name] = true
+
+		for _, v := range []float64{joint.X, joint.Y, joint.Z, joint.Visibility} {
+			if !isFinite(v) {
+				return nil, fmt.Errorf("joint %q has a non-finite value", joint.Name)
+			}
+		}
+		if joint.X < minNormalizedCoord || joint.X > maxNormalizedCoord ||
+			joint.Y < minNormalizedCoord || joint.Y > maxNormalizedCoord {
+			return nil, fmt.Errorf("joint %q coordinates must be normalized to the frame", joint.Name)
+		}
+		if joint.Visibility < 0 || joint.Visibility > 1 {
+			return nil, fmt.Errorf("joint %q visibility must be between 0 and 1", joint.Name)
+		}
+
+		result[index] = joint
+	}
+
+	return result, nil
+}
+
+func isFinite(v float64) bool {
+	return !math.IsNaN(v) && !math.IsInf(v, 0)
+}
+
+// UnmarshalJSON принимает как типизированную схему, так и ответ Python
+// анализатора (poses[].landmarks, frame_width/frame_height) или голый список точек
+func (pd *PoseData) UnmarshalJSON(data []byte) error {
+	parsed, err := ParsePoseData(data)
+	if err != nil {
+		return err
+	}
+	*pd = *parsed
+	return nil
+}
+
+// ParsePoseData разбирает данные позы в любом поддерживаемом JSON формате
+func ParsePoseData(data []byte) (*PoseData, error) {
+	var probe interface{}
+	if err := json.Unmarshal(data, &probe); err != nil {
+		return nil, err
+	}
+
+	switch value := probe.(type) {
+	case []interface{}:
+		// Голый список точек одной позы
+		var landmarks []Joint
+		if err := json.Unmarshal(data, &landmarks); err != nil {
+			return nil, fmt.Errorf("invalid landmark list: %w", err)
+		}
+		return &PoseData{
+			SchemaVersion: PoseSchemaVersion,
+			Skeleton:      SkeletonMediaPipe33,
+			Poses:         []Pose{{PersonIndex: 0, Joints: landmarks}},
+		}, nil
+	case map[string]interface{}:
+		_, versioned := value["schemaVersion"]
+		if versioned || hasTypedPoses(value) {
+			// Версия может отсутствовать, если клиент собрал позы сам: тогда
+			// схема распознаётся по суставам в joints
+			type plainPoseData PoseData
+			var typedData plainPoseData
+			if err := json.Unmarshal(data, &typedData); err != nil {
+				return nil, err
+			}
+			if versioned && typedData.SchemaVersion < 1 {
+				return nil, fmt.Errorf("pose schema version must be at least 1, got %d", typedData.SchemaVersion)
+			}
+			result := PoseData(typedData)
+			return &result, nil
+		}
+		return parseAnalyzerPoseData(data)
+	case nil:
+		return &PoseData{SchemaVersion: PoseSchemaVersion, Skeleton: SkeletonMediaPipe33}, nil
+	}
+
+	return nil, errors.New("pose data must be an object or a landmark list")
+}
+
+// hasTypedPoses сообщает, что позы записаны в типизированной схеме (joints),
+// а не в формате анализатора (landmarks)
+func hasTypedPoses(value map[string]interface{}) bool {
+	poses, _ := value["poses"].([]interface{})
+	for _, raw := range poses {
+		if pose, ok := raw.(map[string]interface{}); ok {
+			if _, typed := pose["joints"]; typed {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// parseAnalyzerPoseData переводит ответ /process-frame в типизированную схему
+func parseAnalyzerPoseData(data []byte) (*PoseData, error) {
+	var analyzer struct {
+		FrameWidth  int `json:"frame_width"`
+		FrameHeight int `json:"frame_height"`
+		Poses       []struct {
+			Landmarks       []Joint `json:"landmarks"`
+			VisibilityScore float64 `json:"visibility_score"`
+		} `json:"poses"`
+	}
+	if err := json.Unmarshal(data, &analyzer); err != nil {
+		return nil, fmt.Errorf("invalid analyzer pose data: %w", err)
+	}
+
+	result := &PoseData{
+		SchemaVersion: PoseSchemaVersion,
+		Skeleton:      SkeletonMediaPipe33,
+		FrameWidth:    analyzer.FrameWidth,
+		FrameHeight:   analyzer.FrameHeight,
+		Poses:         make([]Pose, 0, len(analyzer.Poses)),
+	}
+	for i, pose := range analyzer.Poses {
+		result.Poses = append(result.Poses, Pose{
+			PersonIndex: i,
+			Score:       pose.VisibilityScore,
+			Joints:      pose.Landmarks,
+		})
+	}
+	return result, nil
+}
+
+// Компактное представление позы в MongoDB: суставы хранятся в порядке скелета
+// упакованными float32 (x, y, z, visibility) без имён
+type storedPoseData struct {
+	Version     int          `bson:"v"`
+	Skeleton    string       `bson:"s"`
+	FrameWidth  int          `bson:"w,omitempty"`
+	FrameHeight int          `bson:"h,omitempty"`
+	Poses       []storedPose `bson:"p"`
+}
+
+type storedPose struct {
+	PersonIndex int              `bson:"i"`
+	Score       float64          `bson:"c,omitempty"`
+	Data        primitive.Binary `bson:"d"`
+}
+
+const valuesPerJoint = 4
+
+// Реестр, декодирующий вложенные документы как map, чтобы их можно было сериализовать в JSON
+var legacyPoseRegistry = bson.NewRegistryBuilder().
+	RegisterTypeMapEntry(bsontype.EmbeddedDocument, reflect.TypeOf(bson.M{})).
+	Build()
+
+// MarshalBSONValue сохраняет позу в компактном виде
+func (pd PoseData) MarshalBSONValue() (bsontype.Type, []byte, error) {
+	stored := storedPoseData{
+		Version:     pd.SchemaVersion,
+		Skeleton:    pd.Skeleton,
+		FrameWidth:  pd.FrameWidth,
+		FrameHeight: pd.FrameHeight,
+		Poses:       make([]storedPose, 0, len(pd.Poses)),
+	}
+
+	for _, pose := range pd.Poses {
+		packed := make([]byte, len(pose.Joints)*valuesPerJoint*4)
+		for i, joint := range pose.Joints {
+			offset := i * valuesPerJoint * 4
+			for k, v := range []float64{joint.X, joint.Y, joint.Z, joint.Visibility} {
+				binary.LittleEndian.PutUint32(packed[offset+k*4:], math.Float32bits(float32(v)))
+			}
+		}
+		stored.Poses = append(stored.Poses, storedPose{
+			PersonIndex: pose.PersonIndex,
+			Score:       pose.Score,
+			Data:        primitive.Binary{Data: packed},
+		})
+	}
+
+	data, err := bson.Marshal(stored)
+	return bsontype.EmbeddedDocument, data, err
+}
+
+// UnmarshalBSONValue читает компактный формат, а также старые документы,
+// где poseData хранился как произвольный JSON
+func (pd *PoseData) UnmarshalBSONValue(t bsontype.Type, data []byte) error {
+	switch t {
+	case bsontype.Null, bsontype.Undefined:
+		*pd = PoseData{}
+		return nil
+	case bsontype.EmbeddedDocument:
+		raw := bson.Raw(data)
+		if _, err := raw.LookupErr("v"); err == nil {
+			return pd.unmarshalStored(raw)
+		}
+	}
+
+	// Устаревший формат: переводим через JSON в типизированную схему
+	var legacy interface{}
+	rawValue := bson.RawValue{Type: t, Value: data}
+	if err := rawValue.UnmarshalWithRegistry(legacyPoseRegistry, &legacy); err != nil {
+		return err
+	}
+	jsonData, err := json.Marshal(legacy)
+	if err != nil {
+		return err
+	}
+	parsed, err := ParsePoseData(jsonData)
+	if err != nil {
+		return fmt.Errorf("invalid legacy pose data: %w", err)
+	}
+	*pd = *parsed
+	return nil
+}
+
+func (pd *PoseData) unmarshalStored(raw bson.Raw) error {
+	var stored storedPoseData
+	if err := bson.Unmarshal(raw, &stored); err != nil {
+		return err
+	}
+
+	skeleton, err := GetSkeleton(stored.Skeleton)
+	if err != nil {
+		return err
+	}
+
+	*pd = PoseData{
+		SchemaVersion: stored.Version,
+		Skeleton:      stored.Skeleton,
+		FrameWidth:    stored.FrameWidth,
+		FrameHeight:   stored.FrameHeight,
+		Poses:         make([]Pose, 0, len(stored.Poses)),
+	}
+
+	for _, sp := range stored.Poses {
+		count := len(sp.Data.Data) / (valuesPerJoint * 4)
+		if count > len(skeleton.Joints) {
+			return fmt.Errorf("stored pose has %d joints, skeleton %s has %d", count, skeleton.Name, len(skeleton.Joints))
+		}
+
+		joints := make([]Joint, count)
+		for i := range joints {
+			offset := i * valuesPerJoint * 4
+			values := make([]float64, valuesPerJoint)
+			for k := range values {
+				values[k] = float64(math.Float32frombits(binary.LittleEndian.Uint32(sp.Data.Data[offset+k*4:])))
+			}
+			joints[i] = Joint{
+				Name:       skeleton.Joints[i],
+				X:          values[0],
+				Y:          values[1],
+				Z:          values[2],
+				Visibility: values[3],
+			}
+		}
+
+		pd.Poses = append(pd.Poses, Pose{
+			PersonIndex: sp.PersonIndex,
+			Score:       sp.Score,
+			Joints:      joints,
+		})
+	}
+
+	return nil
+}
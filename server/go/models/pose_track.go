@@ -0,0 +1,123 @@
+package models
+
+import (
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// PoseTrack представляет последовательность поз одного танцора на видео.
+// Сами кадры хранятся сжатыми блоками в отдельной коллекции.
+type PoseTrack struct {
+	ID             primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	ProjectID      primitive.ObjectID `json:"projectId" bson:"projectId"`
+	Name           string             `json:"name" bson:"name"`
+	PersonIndex    int                `json:"personIndex" bson:"personIndex"`
+	Skeleton       string             `json:"skeleton" bson:"skeleton"`
+	FrameWidth     int                `json:"frameWidth,omitempty" bson:"frameWidth,omitempty"`
+	FrameHeight    int                `json:"frameHeight,omitempty" bson:"frameHeight,omitempty"`
+	SourceVideoURL string             `json:"sourceVideoUrl,omitempty" bson:"sourceVideoUrl,omitempty"`
+	FrameCount     int                `json:"frameCount" bson:"frameCount"`
+	StartTime      float64            `json:"startTime" bson:"startTime"`
+	EndTime        float64            `json:"endTime" bson:"endTime"`
+	// Для треков, полученных фильтрацией: исходный трек (пусто, если исходные
+	// позы взяты из ключевых кадров) и параметры, с которыми результат можно повторить
+	SourceTrackID primitive.ObjectID `json:"sourceTrackId,omitempty" bson:"sourceTrackId,omitempty"`
+	Filter        *PoseFilterParams  `json:"filter,omitempty" bson:"filter,omitempty"`
+	CreatedBy     primitive.ObjectID `json:"createdBy" bson:"createdBy"`
+	CreatedAt     time.Time          `json:"createdAt" bson:"createdAt"`
+	UpdatedAt     time.Time          `json:"updatedAt" bson:"updatedAt"`
+}
+
+// Методы сглаживания поз
+const (
+	SmoothingNone    = "none"
+	SmoothingOneEuro = "one-euro"
+	SmoothingKalman  = "kalman"
+)
+
+// PoseFilterParams описывает обработку трека: отбраковку выбросов по скорости,
+// заполнение коротких пропусков и сглаживание
+type PoseFilterParams struct {
+	Smoothing string `json:"smoothing" bson:"smoothing"`
+	// Параметры фильтра One-Euro: минимальная частота среза (Гц), коэффициент
+	// зависимости среза от скорости и частота среза для производной
+	MinCutoff float64 `json:"minCutoff,omitempty" bson:"minCutoff,omitempty"`
+	Beta      float64 `json:"beta,omitempty" bson:"beta,omitempty"`
+	DCutoff   float64 `json:"dCutoff,omitempty" bson:"dCutoff,omitempty"`
+	// Параметры фильтра Калмана с моделью постоянной скорости
+	ProcessNoise     float64 `json:"processNoise,omitempty" bson:"processNoise,omitempty"`
+	MeasurementNoise float64 `json:"measurementNoise,omitempty" bson:"measurementNoise,omitempty"`
+	// MaxGap - максимальная длительность пропуска (с), который заполняется интерполяцией
+	MaxGap float64 `json:"maxGap" bson:"maxGap"`
+	// MaxVelocity - максимальная скорость сустава (доля кадра в секунду); 0 отключает
+	// отбраковку, без значения используется скорость по умолчанию
+	MaxVelocity *float64 `json:"maxVelocity" bson:"maxVelocity"`
+	// MinVisibility - порог видимости, ниже которого сустав считается пропущенным;
+	// 0 учитывает все точки, без значения используется порог по умолчанию
+	MinVisibility *float64 `json:"minVisibility" bson:"minVisibility"`
+}
+
+// PoseTrackChunk представляет сжатый блок кадров трека
+type PoseTrackChunk struct {
+	ID         primitive.ObjectID `bson:"_id,omitempty"`
+	TrackID    primitive.ObjectID `bson:"trackId"`
+	StartTime  float64            `bson:"startTime"`
+	EndTime    float64            `bson:"endTime"`
+	FrameCount int                `bson:"frameCount"`
+	Data       []byte             `bson:"data"`
+}
+
+// PoseFrame представляет позу танцора в момент времени (в секундах от начала видео)
+type PoseFrame struct {
+	Time   float64 `json:"time"`
+	Joints []Joint `json:"joints"`
+}
+
+// Validate проверяет кадр и приводит суставы к порядку скелета
+func (f *PoseFrame) Validate(skeleton *Skeleton) error {
+	if !isFinite(f.Time) || f.Time < 0 {
+		return fmt.Errorf("frame time must be a non-negative number")
+	}
+
+	joints, err := canonicalJoints(skeleton, f.Joints)
+	if err != nil {
+		return fmt.Errorf("frame at %.3fs: %w", f.Time, err)
+	}
+	f.Joints = joints
+	return nil
+}
+
+// PoseTrackCreateInput представляет входные данные для создания трека
+type PoseTrackCreateInput struct {
+	Name           string `json:"name" binding:"required"`
+	PersonIndex    int    `json:"personIndex"`
+	Skeleton       string `json:"skeleton"`
+	FrameWidth     int    `json:"frameWidth"`
+	FrameHeight    int    `json:"frameHeight"`
+	SourceVideoURL string `json:"sourceVideoUrl"`
+}
+
+// PoseFramesInput представляет пакет кадров для записи в трек
+type PoseFramesInput struct {
+	Frames []PoseFrame `json:"frames" binding:"required"`
+}
+
+// PoseSequence - упорядоченные по времени позы одного танцора в одном формате скелета.
+// Используется для анализа независимо от того, хранятся ли позы в треке или в ключевых кадрах.
+type PoseSequence struct {
+	Skeleton    string      `json:"skeleton"`
+	FrameWidth  int         `json:"frameWidth,omitempty"`
+	FrameHeight int         `json:"frameHeight,omitempty"`
+	Frames      []PoseFrame `json:"frames"`
+}
+
+// Aspect возвращает отношение ширины кадра к высоте, чтобы углы считались
+// в пропорциях изображения, а не нормализованных координат. По умолчанию 1.
+func (s *PoseSequence) Aspect() float64 {
+	if s.FrameWidth > 0 && s.FrameHeight > 0 {
+		return float64(s.FrameWidth) / float64(s.FrameHeight)
+	}
+	return 1
+}
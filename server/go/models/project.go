@@ -28,6 +28,23 @@ type Project struct {
 	Duration      int                `json:"duration" bson:"duration"`
 	AudioURL      string             `json:"audioUrl,omitempty" bson:"audioUrl,omitempty"`
 	GlbAnimations []GlbAnimation     `json:"glbAnimations,omitempty" bson:"glbAnimations,omitempty"`
+	// Units - единицы позиций элементов: пиксели холста (пусто или "px") или метры сцены
+	Units string `json:"units,omitempty" bson:"units,omitempty"`
+	Stage *Stage `json:"stage,omitempty" bson:"stage,omitempty"`
+	// TempoMap - музыкальная сетка для перевода времени в такты и счёт
+	TempoMap *TempoMap `json:"tempoMap,omitempty" bson:"tempoMap,omitempty"`
+	// BeatGrid - доли, найденные в аудио проекта
+	BeatGrid *BeatGrid `json:"beatGrid,omitempty" bson:"beatGrid,omitempty"`
+	// Разметка шкалы времени: части постановки и отметки
+	Sections []TimelineSection `json:"sections,omitempty" bson:"sections,omitempty"`
+	Cues     []TimelineCue     `json:"cues,omitempty" bson:"cues,omitempty"`
+	// Casting - танцоры из состава команды, назначенные на элементы
+	Casting []CastingEntry `json:"casting,omitempty" bson:"casting,omitempty"`
+}
+
+// UsesStageUnits сообщает, что позиции элементов заданы в метрах сцены
+func (p *Project) UsesStageUnits() bool {
+	return p.Units == UnitsMetres && p.Stage != nil
 }
 
 // GlbAnimation представляет файл анимации GLB
@@ -80,6 +97,7 @@ func (p *Project) NormalizeElements() {
 
 	normalizedElements := make([]interface{}, 0)
 	idCounter := 1
+	defaults := p.elementDefaults()
 
 	for _, elem := range p.Elements {
 		if elem == nil {
@@ -97,7 +115,7 @@ func (p *Project) NormalizeElements() {
 			for _, arrayItem := range elemArray {
 				if itemMap, ok := arrayItem.(map[string]interface{}); ok {
 					// Обрабатываем этот элемент map и добавляем в нормализованные элементы
-					normalizedItem := normalizeElement(itemMap, &idCounter)
+					normalizedItem := normalizeElement(itemMap, &idCounter, defaults)
 					if normalizedItem != nil {
 						normalizedElements = append(normalizedElements, normalizedItem)
 					}
@@ -110,7 +128,7 @@ func (p *Project) NormalizeElements() {
 			for _, arrayItem := range elemArray {
 				if itemMap, ok := arrayItem.(map[string]interface{}); ok {
 					// Обрабатываем этот элемент map и добавляем в нормализованные элементы
-					normalizedItem := normalizeElement(itemMap, &idCounter)
+					normalizedItem := normalizeElement(itemMap, &idCounter, defaults)
 					if normalizedItem != nil {
 						normalizedElements = append(normalizedElements, normalizedItem)
 					}
@@ -134,7 +152,7 @@ func (p *Project) NormalizeElements() {
 		}
 
 		// Обрабатываем map элемента
-		normalizedElem := normalizeElement(elemMap, &idCounter)
+		normalizedElem := normalizeElement(elemMap, &idCounter, defaults)
 		if normalizedElem != nil {
 			normalizedElements = append(normalizedElements, normalizedElem)
 		}
@@ -144,8 +162,22 @@ func (p *Project) NormalizeElements() {
 	p.Elements = normalizedElements
 }
 
+// elementDefaults - позиция и размер, которые получает элемент без них
+type elementDefaults struct {
+	x, y, size float64
+}
+
+// elementDefaults возвращает значения по умолчанию в единицах проекта:
+// для сцены в метрах элемент ставится в её центр
+func (p *Project) elementDefaults() elementDefaults {
+	if p.UsesStageUnits() {
+		return elementDefaults{x: 0, y: p.Stage.Depth / 2, size: DefaultStageElementSize}
+	}
+	return elementDefaults{x: 100, y: 100, size: 100}
+}
+
 // Вспомогательная функция для нормализации одного элемента
-func normalizeElement(elemMap map[string]interface{}, idCounter *int) map[string]interface{} {
+func normalizeElement(elemMap map[string]interface{}, idCounter *int, defaults elementDefaults) map[string]interface{} {
 	if elemMap == nil {
 		return nil
 	}
@@ -185,21 +217,21 @@ func normalizeElement(elemMap map[string]interface{}, idCounter *int) map[string
 	position, hasPosition := elemMap["position"].(map[string]interface{})
 	if !hasPosition {
 		elemMap["position"] = map[string]interface{}{
-			"x": float64(100),
-			"y": float64(100),
+			"x": defaults.x,
+			"y": defaults.y,
 		}
 	} else {
 		// Преобразуем значения позиции в float64
 		if x, ok := position["x"]; ok {
-			position["x"] = convertToFloat64(x, 100)
+			position["x"] = ConvertToFloat64(x, defaults.x)
 		} else {
-			position["x"] = float64(100)
+			position["x"] = defaults.x
 		}
 
 		if y, ok := position["y"]; ok {
-			position["y"] = convertToFloat64(y, 100)
+			position["y"] = ConvertToFloat64(y, defaults.y)
 		} else {
-			position["y"] = float64(100)
+			position["y"] = defaults.y
 		}
 	}
 
@@ -207,21 +239,21 @@ func normalizeElement(elemMap map[string]interface{}, idCounter *int) map[string
 	size, hasSize := elemMap["size"].(map[string]interface{})
 	if !hasSize {
 		elemMap["size"] = map[string]interface{}{
-			"width":  float64(100),
-			"height": float64(100),
+			"width":  defaults.size,
+			"height": defaults.size,
 		}
 	} else {
 		// Преобразуем значения размера в float64
 		if width, ok := size["width"]; ok {
-			size["width"] = convertToFloat64(width, 100)
+			size["width"] = ConvertToFloat64(width, defaults.size)
 		} else {
-			size["width"] = float64(100)
+			size["width"] = defaults.size
 		}
 
 		if height, ok := size["height"]; ok {
-			size["height"] = convertToFloat64(height, 100)
+			size["height"] = ConvertToFloat64(height, defaults.size)
 		} else {
-			size["height"] = float64(100)
+			size["height"] = defaults.size
 		}
 	}
 
@@ -250,17 +282,17 @@ func normalizeElement(elemMap map[string]interface{}, idCounter *int) map[string
 		if _, ok := style["borderWidth"]; !ok {
 			style["borderWidth"] = float64(1)
 		} else {
-			style["borderWidth"] = convertToFloat64(style["borderWidth"], 1)
+			style["borderWidth"] = ConvertToFloat64(style["borderWidth"], 1)
 		}
 		if _, ok := style["opacity"]; !ok {
 			style["opacity"] = float64(1)
 		} else {
-			style["opacity"] = convertToFloat64(style["opacity"], 1)
+			style["opacity"] = ConvertToFloat64(style["opacity"], 1)
 		}
 		if _, ok := style["zIndex"]; !ok {
 			style["zIndex"] = float64(0)
 		} else {
-			style["zIndex"] = convertToFloat64(style["zIndex"], 0)
+			style["zIndex"] = ConvertToFloat64(style["zIndex"], 0)
 		}
 	}
 
@@ -277,8 +309,8 @@ func normalizeElement(elemMap map[string]interface{}, idCounter *int) map[string
 	return elemMap
 }
 
-// Helper function to convert various types to float64
-func convertToFloat64(value interface{}, defaultValue float64) float64 {
+// ConvertToFloat64 приводит числовое значение элемента (в том числе строку) к float64
+func ConvertToFloat64(value interface{}, defaultValue float64) float64 {
 	switch v := value.(type) {
 	case float64:
 		return v
@@ -316,6 +348,8 @@ type ProjectCreateInput struct {
 	VideoURL      string         `json:"videoUrl,omitempty"`
 	Elements      []interface{}  `json:"elements,omitempty"`
 	GlbAnimations []GlbAnimation `json:"glbAnimations,omitempty"`
+	// Stage - сцена проекта; если задана, позиции элементов указываются в метрах
+	Stage *Stage `json:"stage,omitempty"`
 }
 
 // ProjectUpdateInput представляет входные данные для обновления проекта
@@ -331,4 +365,8 @@ type ProjectUpdateInput struct {
 	Duration      *int           `json:"duration,omitempty"`
 	AudioURL      string         `json:"audioUrl,omitempty"`
 	GlbAnimations []GlbAnimation `json:"glbAnimations,omitempty"`
+	// SnapToCounts сдвигает ключевые кадры элементов к ближайшим счетам карты
+	// темпа проекта, SnapDivision делит счёт (2 - с «и» между счетами)
+	SnapToCounts bool `json:"snapToCounts,omitempty"`
+	SnapDivision int  `json:"snapDivision,omitempty"`
 } 
\ No newline at end of file
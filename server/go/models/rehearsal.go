@@ -0,0 +1,248 @@
+package models
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Ограничения репетиций
+const (
+	MaxTeamRehearsals       = 1000
+	MaxRehearsalAgenda      = 50
+	MaxRehearsalDuration    = 24 * time.Hour
+	maxRehearsalTitleLen    = 200
+	maxRehearsalLocationLen = 300
+	maxRehearsalNotesLen    = 5000
+	maxRSVPCommentLen       = 500
+)
+
+// Ответы на приглашение
+const (
+	RSVPGoing    = "going"
+	RSVPMaybe    = "maybe"
+	RSVPDeclined = "declined"
+)
+
+// Отметки посещаемости
+const (
+	AttendancePresent = "present"
+	AttendanceLate    = "late"
+	AttendanceAbsent  = "absent"
+	AttendanceExcused = "excused"
+)
+
+// Rehearsal - репетиция команды
+type Rehearsal struct {
+	ID       string    `json:"id" bson:"id"`
+	Title    string    `json:"title" bson:"title"`
+	Start    time.Time `json:"start" bson:"start"`
+	End      time.Time `json:"end" bson:"end"`
+	Location string    `json:"location,omitempty" bson:"location,omitempty"`
+	Notes    string    `json:"notes,omitempty" bson:"notes,omitempty"`
+	// Agenda - проекты и их части, которые репетируются
+	Agenda []RehearsalItem `json:"agenda" bson:"agenda"`
+	// Invited - приглашённые пользователи; пустой список - вся команда
+	Invited    []primitive.ObjectID `json:"invited" bson:"invited"`
+	Responses  []RSVP               `json:"responses" bson:"responses"`
+	Attendance []AttendanceRecord   `json:"attendance" bson:"attendance"`
+	Cancelled  bool                 `json:"cancelled" bson:"cancelled"`
+	// Sequence растёт при каждом изменении, чтобы календари обновили событие
+	Sequence  int                `json:"sequence" bson:"sequence"`
+	CreatedBy primitive.ObjectID `json:"createdBy" bson:"createdBy"`
+	CreatedAt time.Time          `json:"createdAt" bson:"createdAt"`
+	UpdatedAt time.Time          `json:"updatedAt" bson:"updatedAt"`
+}
+
+// RehearsalItem - проект и, если задана, его часть (секция шкалы времени)
+type RehearsalItem struct {
+	ProjectID primitive.ObjectID `json:"projectId" bson:"projectId"`
+	SectionID string             `json:"sectionId,omitempty" bson:"sectionId,omitempty"`
+}
+
+// RSVP - ответ участника на приглашение
+type RSVP struct {
+	UserID      primitive.ObjectID `json:"userId" bson:"userId"`
+	Status      string             `json:"status" bson:"status"`
+	Comment     string             `json:"comment,omitempty" bson:"comment,omitempty"`
+	RespondedAt time.Time          `json:"respondedAt" bson:"respondedAt"`
+}
+
+// AttendanceRecord - отметка о присутствии участника на репетиции
+type AttendanceRecord struct {
+	UserID   primitive.ObjectID `json:"userId" bson:"userId"`
+	Status   string             `json:"status" bson:"status"`
+	MarkedBy primitive.ObjectID `json:"markedBy" bson:"markedBy"`
+	MarkedAt time.Time          `json:"markedAt" bson:"markedAt"`
+}
+
+// RehearsalInput - поля репетиции при создании и изменении
+type RehearsalInput struct {
+	Title     string          `json:"title"`
+	Start     *time.Time      `json:"start"`
+	End       *time.Time      `json:"end"`
+	Location  *string         `json:"location"`
+	Notes     *string         `json:"notes"`
+	Agenda    []RehearsalItem `json:"agenda"`
+	Invited   []string        `json:"invited"`
+	Cancelled *bool           `json:"cancelled"`
+}
+
+// Apply переносит заданные поля в репетицию
+func (in *RehearsalInput) Apply(r *Rehearsal) error {
+	if in.Title != "" {
+		r.Title = in.Title
+	}
+	if in.Start != nil {
+		r.Start = in.Start.UTC()
+	}
+	if in.End != nil {
+		r.End = in.End.UTC()
+	}
+	if in.Location != nil {
+		r.Location = *in.Location
+	}
+	if in.Notes != nil {
+		r.Notes = *in.Notes
+	}
+	if in.Agenda != nil {
+		r.Agenda = in.Agenda
+	}
+	if in.Cancelled != nil {
+		r.Cancelled = *in.Cancelled
+	}
+	if in.Invited != nil {
+		invited := make([]primitive.ObjectID, 0, len(in.Invited))
+		seen := map[primitive.ObjectID]bool{}
+		for _, id := range in.Invited {
+			userID, err := primitive.ObjectIDFromHex(id)
+			if err != nil {
+				return fmt.Errorf("invalid invited user ID %q", id)
+			}
+			if !seen[userID] {
+				seen[userID] = true
+				invited = append(invited, userID)
+			}
+		}
+		r.Invited = invited
+	}
+	return nil
+}
+
+// Validate проверяет репетицию и заменяет пустые списки на пустые массивы
+func (r *Rehearsal) Validate() error {
+	r.Title = strings.TrimSpace(r.Title)
+	if r.Title == "" {
+		return fmt.Errorf("title is required")
+	}
+	if utf8.RuneCountInString(r.Title) > maxRehearsalTitleLen {
+		return fmt.Errorf("title must be at most %d characters", maxRehearsalTitleLen)
+	}
+	if utf8.RuneCountInString(r.Location) > maxRehearsalLocationLen {
+		return fmt.Errorf("location must be at most %d characters", maxRehearsalLocationLen)
+	}
+	if utf8.RuneCountInString(r.Notes) > maxRehearsalNotesLen {
+		return fmt.Errorf("notes must be at most %d characters", maxRehearsalNotesLen)
+	}
+	if r.Start.IsZero() || !r.End.After(r.Start) {
+		return fmt.Errorf("rehearsal must end after it starts")
+	}
+	if r.End.Sub(r.Start) > MaxRehearsalDuration {
+		return fmt.Errorf("rehearsal can last at most %s", MaxRehearsalDuration)
+	}
+	if len(r.Agenda) > MaxRehearsalAgenda {
+		return fmt.Errorf("agenda can have at most %d items", MaxRehearsalAgenda)
+	}
+	for _, item := range r.Agenda {
+		if item.ProjectID.IsZero() {
+			return fmt.Errorf("agenda items need a project")
+		}
+	}
+	if r.Agenda == nil {
+		r.Agenda = []RehearsalItem{}
+	}
+	if r.Invited == nil {
+		r.Invited = []primitive.ObjectID{}
+	}
+	if r.Responses == nil {
+		r.Responses = []RSVP{}
+	}
+	if r.Attendance == nil {
+		r.Attendance = []AttendanceRecord{}
+	}
+	return nil
+}
+
+// IsInvited сообщает, что участник команды приглашён на репетицию
+func (r *Rehearsal) IsInvited(userID primitive.ObjectID) bool {
+	if len(r.Invited) == 0 {
+		return true
+	}
+	for _, id := range r.Invited {
+		if id == userID {
+			return true
+		}
+	}
+	return false
+}
+
+// SetRSVP записывает ответ участника, заменяя предыдущий
+func (r *Rehearsal) SetRSVP(userID primitive.ObjectID, status, comment string, at time.Time) error {
+	if status != RSVPGoing && status != RSVPMaybe && status != RSVPDeclined {
+		return fmt.Errorf("status must be going, maybe or declined")
+	}
+	comment = strings.TrimSpace(comment)
+	if utf8.RuneCountInString(comment) > maxRSVPCommentLen {
+		return fmt.Errorf("comment must be at most %d characters", maxRSVPCommentLen)
+	}
+	response := RSVP{UserID: userID, Status: status, Comment: comment, RespondedAt: at}
+	for i := range r.Responses {
+		if r.Responses[i].UserID == userID {
+			r.Responses[i] = response
+			return nil
+		}
+	}
+	r.Responses = append(r.Responses, response)
+	return nil
+}
+
+// MarkAttendance записывает отметку о присутствии, заменяя предыдущую
+func (r *Rehearsal) MarkAttendance(userID primitive.ObjectID, status string, markedBy primitive.ObjectID, at time.Time) error {
+	switch status {
+	case AttendancePresent, AttendanceLate, AttendanceAbsent, AttendanceExcused:
+	default:
+		return fmt.Errorf("attendance status must be present, late, absent or excused")
+	}
+	record := AttendanceRecord{UserID: userID, Status: status, MarkedBy: markedBy, MarkedAt: at}
+	for i := range r.Attendance {
+		if r.Attendance[i].UserID == userID {
+			r.Attendance[i] = record
+			return nil
+		}
+	}
+	r.Attendance = append(r.Attendance, record)
+	return nil
+}
+
+// NewCalendarToken создаёт секретный токен подписки на календарь и его хеш.
+// В базе хранится только хеш, сам токен показывается один раз.
+func NewCalendarToken() (token, hash string, err error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", "", err
+	}
+	token = hex.EncodeToString(buf)
+	return token, HashCalendarToken(token), nil
+}
+
+// HashCalendarToken возвращает хеш токена подписки для поиска в базе
+func HashCalendarToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,133 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Ограничения состава команды
+const (
+	MaxRosterSize      = 500
+	maxDancerNameLen   = 100
+	maxDancerNotesLen  = 2000
+	MinDancerHeight    = 50.0
+	MaxDancerHeight    = 250.0
+	DefaultDancerColor = "#7b61ff"
+)
+
+// Dancer - танцор из состава команды. Танцор не обязательно имеет учётную
+// запись: UserID связывает его с пользователем, если тот есть в команде.
+type Dancer struct {
+	ID   string `json:"id" bson:"id"`
+	Name string `json:"name" bson:"name"`
+	// Height - рост в сантиметрах, 0 - не указан
+	Height    float64             `json:"height,omitempty" bson:"height,omitempty"`
+	Color     string              `json:"color" bson:"color"`
+	UserID    *primitive.ObjectID `json:"userId,omitempty" bson:"userId,omitempty"`
+	Notes     string              `json:"notes,omitempty" bson:"notes,omitempty"`
+	CreatedAt time.Time           `json:"createdAt" bson:"createdAt"`
+	UpdatedAt time.Time           `json:"updatedAt" bson:"updatedAt"`
+}
+
+// DancerInput - поля танцора при создании и изменении. Пустой userId
+// отвязывает танцора от пользователя.
+type DancerInput struct {
+	Name   string   `json:"name"`
+	Height *float64 `json:"height"`
+	Color  string   `json:"color"`
+	UserID *string  `json:"userId"`
+	Notes  *string  `json:"notes"`
+}
+
+// Apply переносит заданные поля в танцора
+func (in *DancerInput) Apply(dancer *Dancer) error {
+	if in.Name != "" {
+		dancer.Name = in.Name
+	}
+	if in.Height != nil {
+		dancer.Height = *in.Height
+	}
+	if in.Color != "" {
+		dancer.Color = in.Color
+	}
+	if in.Notes != nil {
+		dancer.Notes = *in.Notes
+	}
+	if in.UserID != nil {
+		if *in.UserID == "" {
+			dancer.UserID = nil
+		} else {
+			userID, err := primitive.ObjectIDFromHex(*in.UserID)
+			if err != nil {
+				return fmt.Errorf("invalid user ID format")
+			}
+			dancer.UserID = &userID
+		}
+	}
+	return nil
+}
+
+// Validate проверяет танцора и задаёт цвет по умолчанию
+func (d *Dancer) Validate() error {
+	d.Name = strings.TrimSpace(d.Name)
+	if d.Name == "" {
+		return fmt.Errorf("name is required")
+	}
+	if utf8.RuneCountInString(d.Name) > maxDancerNameLen {
+		return fmt.Errorf("name must be at most %d characters", maxDancerNameLen)
+	}
+	if utf8.RuneCountInString(d.Notes) > maxDancerNotesLen {
+		return fmt.Errorf("notes must be at most %d characters", maxDancerNotesLen)
+	}
+	if d.Height != 0 && (!isFinite(d.Height) || d.Height < MinDancerHeight || d.Height > MaxDancerHeight) {
+		return fmt.Errorf("height must be between %.0f and %.0f cm", MinDancerHeight, MaxDancerHeight)
+	}
+	return validateHexColor(&d.Color, DefaultDancerColor)
+}
+
+// CastingEntry назначает танцора из состава команды на элемент проекта
+type CastingEntry struct {
+	ElementID string `json:"elementId" bson:"elementId"`
+	DancerID  string `json:"dancerId" bson:"dancerId"`
+}
+
+// ValidateCasting проверяет, что элементы есть в проекте, танцоры - в
+// составе, и что каждый элемент и каждый танцор назначены не больше одного раза
+func ValidateCasting(casting []CastingEntry, elements []interface{}, roster []Dancer) error {
+	elementIDs := map[string]bool{}
+	for _, raw := range elements {
+		if element, ok := raw.(map[string]interface{}); ok {
+			if id, _ := element["id"].(string); id != "" {
+				elementIDs[id] = true
+			}
+		}
+	}
+	dancerIDs := map[string]bool{}
+	for _, dancer := range roster {
+		dancerIDs[dancer.ID] = true
+	}
+
+	castElements := map[string]bool{}
+	castDancers := map[string]bool{}
+	for _, entry := range casting {
+		if !elementIDs[entry.ElementID] {
+			return fmt.Errorf("element %q not found in the project", entry.ElementID)
+		}
+		if !dancerIDs[entry.DancerID] {
+			return fmt.Errorf("dancer %q not found in the team roster", entry.DancerID)
+		}
+		if castElements[entry.ElementID] {
+			return fmt.Errorf("element %q is cast more than once", entry.ElementID)
+		}
+		if castDancers[entry.DancerID] {
+			return fmt.Errorf("dancer %q is cast on more than one element", entry.DancerID)
+		}
+		castElements[entry.ElementID] = true
+		castDancers[entry.DancerID] = true
+	}
+	return nil
+}
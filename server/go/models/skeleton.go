@@ -0,0 +1,150 @@
+package models
+
+import "fmt"
+
+// Поддерживаемые форматы скелета
+const (
+	SkeletonMediaPipe33 = "mediapipe-33"
+	SkeletonCOCO17      = "coco-17"
+)
+
+// Skeleton описывает упорядоченный набор суставов одного формата
+type Skeleton struct {
+	Name   string
+	Joints []string
+	index  map[string]int
+}
+
+// JointIndex возвращает позицию сустава в скелете или -1, если сустава нет
+func (s *Skeleton) JointIndex(name string) int {
+	if i, ok := s.index[name]; ok {
+		return i
+	}
+	return -1
+}
+
+// Порядок суставов MediaPipe Pose Landmarker совпадает с индексами, которые возвращает Python сервер
+var mediaPipe33Joints = []string{
+	"nose",
+	"left_eye_inner", "left_eye", "left_eye_outer",
+	"right_eye_inner", "right_eye", "right_eye_outer",
+	"left_ear", "right_ear",
+	"mouth_left", "mouth_right",
+	"left_shoulder", "right_shoulder",
+	"left_elbow", "right_elbow",
+	"left_wrist", "right_wrist",
+	"left_pinky", "right_pinky",
+	"left_index", "right_index",
+	"left_thumb", "right_thumb",
+	"left_hip", "right_hip",
+	"left_knee", "right_knee",
+	"left_ankle", "right_ankle",
+	"left_heel", "right_heel",
+	"left_foot_index", "right_foot_index",
+}
+
+// Порядок ключевых точек COCO
+var coco17Joints = []string{
+	"nose",
+	"left_eye", "right_eye",
+	"left_ear", "right_ear",
+	"left_shoulder", "right_shoulder",
+	"left_elbow", "right_elbow",
+	"left_wrist", "right_wrist",
+	"left_hip", "right_hip",
+	"left_knee", "right_knee",
+	"left_ankle", "right_ankle",
+}
+
+// Суставы, которых нет в более бедном скелете, приближаются ближайшим родственным суставом
+var jointFallbacks = map[string]string{
+	"left_eye_inner":   "left_eye",
+	"left_eye_outer":   "left_eye",
+	"right_eye_inner":  "right_eye",
+	"right_eye_outer":  "right_eye",
+	"mouth_left":       "nose",
+	"mouth_right":      "nose",
+	"left_pinky":       "left_wrist",
+	"right_pinky":      "right_wrist",
+	"left_index":       "left_wrist",
+	"right_index":      "right_wrist",
+	"left_thumb":       "left_wrist",
+	"right_thumb":      "right_wrist",
+	"left_heel":        "left_ankle",
+	"right_heel":       "right_ankle",
+	"left_foot_index":  "left_ankle",
+	"right_foot_index": "right_ankle",
+}
+
+var skeletons = map[string]*Skeleton{
+	SkeletonMediaPipe33: newSkeleton(SkeletonMediaPipe33, mediaPipe33Joints),
+	SkeletonCOCO17:      newSkeleton(SkeletonCOCO17, coco17Joints),
+}
+
+func newSkeleton(name string, joints []string) *Skeleton {
+	index := make(map[string]int, len(joints))
+	for i, joint := range joints {
+		index[joint] = i
+	}
+	return &Skeleton{Name: name, Joints: joints, index: index}
+}
+
+// GetSkeleton возвращает описание скелета по имени
+func GetSkeleton(name string) (*Skeleton, error) {
+	skeleton, ok := skeletons[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown skeleton format %q", name)
+	}
+	return skeleton, nil
+}
+
+// ConvertSkeleton переводит данные позы в другой формат скелета.
+// Суставы, которых нет в исходном формате, приближаются родственным суставом
+// с нулевой видимостью, чтобы потребители могли их отличить.
+func (pd *PoseData) ConvertSkeleton(target string) (*PoseData, error) {
+	if pd.Skeleton == target {
+		converted := *pd
+		return &converted, nil
+	}
+
+	from, err := GetSkeleton(pd.Skeleton)
+	if err != nil {
+		return nil, err
+	}
+	to, err := GetSkeleton(target)
+	if err != nil {
+		return nil, err
+	}
+
+	converted := &PoseData{
+		SchemaVersion: pd.SchemaVersion,
+		Skeleton:      to.Name,
+		FrameWidth:    pd.FrameWidth,
+		FrameHeight:   pd.FrameHeight,
+		Poses:         make([]Pose, 0, len(pd.Poses)),
+	}
+
+	for _, pose := range pd.Poses {
+		joints := make([]Joint, len(to.Joints))
+		for i, name := range to.Joints {
+			joint := Joint{Name: name}
+			if j := from.JointIndex(name); j >= 0 && j < len(pose.Joints) {
+				joint = pose.Joints[j]
+			} else if fallback, ok := jointFallbacks[name]; ok {
+				if j := from.JointIndex(fallback); j >= 0 && j < len(pose.Joints) {
+					joint = pose.Joints[j]
+					joint.Visibility = 0
+				}
+			}
+			joint.Name = name
+			joints[i] = joint
+		}
+		converted.Poses = append(converted.Poses, Pose{
+			PersonIndex: pose.PersonIndex,
+			Score:       pose.Score,
+			Joints:      joints,
+		})
+	}
+
+	return converted, nil
+}
@@ -0,0 +1,263 @@
+package models
+
+import (
+	"fmt"
+	"math"
+)
+
+// Единицы координат элементов проекта. В старых проектах позиции заданы
+// в пикселях холста редактора, в новых - в метрах сцены.
+const (
+	UnitsPixels = "px"
+	UnitsMetres = "m"
+)
+
+// Сторона схемы, с которой находятся зрители
+const (
+	AudienceBottom = "bottom"
+	AudienceTop    = "top"
+	AudienceLeft   = "left"
+	AudienceRight  = "right"
+)
+
+// Ограничения на размеры сцены, м
+const (
+	MaxStageSize = 100.0
+	MaxWingWidth = 50.0
+
+	// DefaultStageElementSize - размер нового элемента на сцене в метрах
+	DefaultStageElementSize = 0.5
+)
+
+// Размер холста, на котором по умолчанию создавались старые проекты
+const (
+	DefaultCanvasWidth  = 800.0
+	DefaultCanvasHeight = 600.0
+)
+
+// Stage описывает сцену проекта в метрах.
+//
+// Координаты на сцене: X - расстояние от центральной линии (положительное -
+// справа, если смотреть из зала), Y - расстояние от авансцены вглубь сцены.
+// Позиция элемента в метрах - его центр, размер - ширина поперёк сцены и глубина.
+type Stage struct {
+	Width        float64 `json:"width" bson:"width"`
+	Depth        float64 `json:"depth" bson:"depth"`
+	GridSpacing  float64 `json:"gridSpacing" bson:"gridSpacing"`
+	CenterLine   bool    `json:"centerLine" bson:"centerLine"`
+	WingWidth    float64 `json:"wingWidth" bson:"wingWidth"`
+	AudienceSide string  `json:"audienceSide" bson:"audienceSide"`
+}
+
+// DefaultStage возвращает сцену среднего зала
+func DefaultStage() Stage {
+	return Stage{
+		Width:        10,
+		Depth:        8,
+		GridSpacing:  1,
+		CenterLine:   true,
+		WingWidth:    2,
+		AudienceSide: AudienceBottom,
+	}
+}
+
+// Validate проверяет размеры сцены и задаёт сторону зрителей по умолчанию
+func (s *Stage) Validate() error {
+	if !isFinite(s.Width) || !isFinite(s.Depth) || s.Width <= 0 || s.Depth <= 0 ||
+		s.Width > MaxStageSize || s.Depth > MaxStageSize {
+		return fmt.Errorf("stage width and depth must be between 0 and %.0f metres", MaxStageSize)
+	}
+	if !isFinite(s.GridSpacing) || s.GridSpacing < 0 || s.GridSpacing > math.Max(s.Width, s.Depth) {
+		return fmt.Errorf("grid spacing must be between 0 and the stage size")
+	}
+	if !isFinite(s.WingWidth) || s.WingWidth < 0 || s.WingWidth > MaxWingWidth {
+		return fmt.Errorf("wing width must be between 0 and %.0f metres", MaxWingWidth)
+	}
+	switch s.AudienceSide {
+	case "":
+		s.AudienceSide = AudienceBottom
+	case AudienceBottom, AudienceTop, AudienceLeft, AudienceRight:
+	default:
+		return fmt.Errorf("audience side must be bottom, top, left or right")
+	}
+	return nil
+}
+
+// Bounds возвращает границы сцены вместе с кулисами: X от minX до maxX, Y от 0 до Depth
+func (s Stage) Bounds() (minX, maxX, minY, maxY float64) {
+	return -s.Width/2 - s.WingWidth, s.Width/2 + s.WingWidth, 0, s.Depth
+}
+
+// CanvasView переводит координаты сцены в пиксели холста заданного размера.
+// Сцена вписывается в холст с сохранением пропорций и выравнивается по центру,
+// зрители находятся у стороны AudienceSide.
+type CanvasView struct {
+	Stage  Stage
+	Width  float64
+	Height float64
+	// Scale - число пикселей в метре
+	Scale float64
+	// Левый верхний угол сцены на холсте
+	Left, Top float64
+}
+
+// Canvas возвращает отображение сцены на холст width x height пикселей
+func (s Stage) Canvas(width, height float64) CanvasView {
+	spanX, spanY := s.Width, s.Depth
+	if s.sideways() {
+		spanX, spanY = s.Depth, s.Width
+	}
+	scale := math.Min(width/spanX, height/spanY)
+	return CanvasView{
+		Stage:  s,
+		Width:  width,
+		Height: height,
+		Scale:  scale,
+		Left:   (width - spanX*scale) / 2,
+		Top:    (height - spanY*scale) / 2,
+	}
+}
+
+// sideways сообщает, что ширина сцены идёт по вертикали холста
+func (s Stage) sideways() bool {
+	return s.AudienceSide == AudienceLeft || s.AudienceSide == AudienceRight
+}
+
+// ToCanvas переводит точку сцены (м) в точку холста (пиксели)
+func (v CanvasView) ToCanvas(p Position) Position {
+	across := p.X + v.Stage.Width/2 // от левого края сцены, если смотреть из зала
+	depth := p.Y
+	var u, w float64
+	switch v.Stage.AudienceSide {
+	case AudienceTop:
+		u, w = v.Stage.Width-across, depth
+	case AudienceLeft:
+		u, w = depth, across
+	case AudienceRight:
+		u, w = v.Stage.Depth-depth, v.Stage.Width-across
+	default:
+		u, w = across, v.Stage.Depth-depth
+	}
+	return Position{X: v.Left + u*v.Scale, Y: v.Top + w*v.Scale}
+}
+
+// ToStage переводит точку холста (пиксели) в точку сцены (м)
+func (v CanvasView) ToStage(p Position) Position {
+	u, w := (p.X-v.Left)/v.Scale, (p.Y-v.Top)/v.Scale
+	var across, depth float64
+	switch v.Stage.AudienceSide {
+	case AudienceTop:
+		across, depth = v.Stage.Width-u, w
+	case AudienceLeft:
+		across, depth = w, u
+	case AudienceRight:
+		across, depth = v.Stage.Width-w, v.Stage.Depth-u
+	default:
+		across, depth = u, v.Stage.Depth-w
+	}
+	return Position{X: across - v.Stage.Width/2, Y: depth}
+}
+
+// sizeToCanvas переводит размер элемента на сцене в размер на холсте
+func (v CanvasView) sizeToCanvas(s Size) Size {
+	if v.Stage.sideways() {
+		s.Width, s.Height = s.Height, s.Width
+	}
+	return Size{Width: s.Width * v.Scale, Height: s.Height * v.Scale}
+}
+
+// sizeToStage переводит размер элемента на холсте в размер на сцене
+func (v CanvasView) sizeToStage(s Size) Size {
+	s = Size{Width: s.Width / v.Scale, Height: s.Height / v.Scale}
+	if v.Stage.sideways() {
+		s.Width, s.Height = s.Height, s.Width
+	}
+	return s
+}
+
+// ElementsToStage переводит нормализованные элементы из пикселей холста в метры
+// сцены: левый верхний угол элемента и его ключевых кадров заменяется центром.
+// Элементы изменяются на месте.
+func ElementsToStage(elements []interface{}, view CanvasView) {
+	for _, raw := range elements {
+		element, ok := raw.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		size := elementSize(element)
+		convert := func(position map[string]interface{}, scale float64) Position {
+			return view.ToStage(Position{
+				X: ConvertToFloat64(position["x"], 0) + size.Width*scale/2,
+				Y: ConvertToFloat64(position["y"], 0) + size.Height*scale/2,
+			})
+		}
+		mapPositions(element, convert)
+		setSize(element, view.sizeToStage(size))
+	}
+}
+
+// ElementsToCanvas переводит элементы из метров сцены в пиксели холста,
+// обратно ElementsToStage. Элементы изменяются на месте.
+func ElementsToCanvas(elements []interface{}, view CanvasView) {
+	for _, raw := range elements {
+		element, ok := raw.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		size := view.sizeToCanvas(elementSize(element))
+		convert := func(position map[string]interface{}, scale float64) Position {
+			center := view.ToCanvas(Position{
+				X: ConvertToFloat64(position["x"], 0),
+				Y: ConvertToFloat64(position["y"], 0),
+			})
+			return Position{
+				X: center.X - size.Width*scale/2,
+				Y: center.Y - size.Height*scale/2,
+			}
+		}
+		mapPositions(element, convert)
+		setSize(element, size)
+	}
+}
+
+// mapPositions заменяет позицию элемента и позиции его ключевых кадров
+// результатом fn, которая получает масштаб элемента в этот момент. Позиции
+// записываются новыми картами, потому что элемент и его первый ключевой кадр
+// могут ссылаться на одну карту.
+func mapPositions(element map[string]interface{}, fn func(position map[string]interface{}, scale float64) Position) {
+	keyframes, _ := element["keyframes"].([]interface{})
+	converted := make([]map[string]interface{}, len(keyframes))
+	for i, raw := range keyframes {
+		keyframe, ok := raw.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if position, ok := keyframe["position"].(map[string]interface{}); ok {
+			converted[i] = positionMap(fn(position, ConvertToFloat64(keyframe["scale"], 1)))
+		}
+	}
+	if position, ok := element["position"].(map[string]interface{}); ok {
+		element["position"] = positionMap(fn(position, 1))
+	}
+	for i, position := range converted {
+		if position != nil {
+			keyframes[i].(map[string]interface{})["position"] = position
+		}
+	}
+}
+
+func elementSize(element map[string]interface{}) Size {
+	size, _ := element["size"].(map[string]interface{})
+	return Size{
+		Width:  ConvertToFloat64(size["width"], 0),
+		Height: ConvertToFloat64(size["height"], 0),
+	}
+}
+
+func setSize(element map[string]interface{}, size Size) {
+	element["size"] = map[string]interface{}{"width": size.Width, "height": size.Height}
+}
+
+func positionMap(p Position) map[string]interface{} {
+	return map[string]interface{}{"x": p.X, "y": p.Y}
+}
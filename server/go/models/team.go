@@ -16,6 +16,12 @@ type Team struct {
 	Projects    []string           `json:"projects,omitempty" bson:"projects,omitempty"`
 	CreatedAt   time.Time          `json:"createdAt" bson:"createdAt"`
 	UpdatedAt   time.Time          `json:"updatedAt" bson:"updatedAt"`
+	// Roster - танцоры команды, в том числе без учётных записей
+	Roster []Dancer `json:"roster,omitempty" bson:"roster,omitempty"`
+	// Rehearsals - запланированные репетиции команды
+	Rehearsals []Rehearsal `json:"rehearsals,omitempty" bson:"rehearsals,omitempty"`
+	// CalendarTokenHash - хеш токена подписки на календарь команды
+	CalendarTokenHash string `json:"-" bson:"calendarTokenHash,omitempty"`
 }
 
 // Member представляет участника команды
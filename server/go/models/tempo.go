@@ -0,0 +1,261 @@
+package models
+
+import (
+	"fmt"
+	"math"
+	"sort"
+)
+
+// Ограничения карты темпа
+const (
+	MinTempoBPM      = 20.0
+	MaxTempoBPM      = 400.0
+	MaxBeatsPerBar   = 32
+	MaxTempoChanges  = 1000
+	MaxSnapDivision  = 16
+	DefaultPhraseLen = 8
+)
+
+// TempoMap описывает музыкальную сетку проекта: темп, размер и момент первой
+// сильной доли (такт 1, доля 1). Танцевальный счёт идёт по долям восьмёрками
+// (CountsPerPhrase) от первой сильной доли. Смены темпа и размера происходят
+// с начала такта.
+type TempoMap struct {
+	BPM             float64       `json:"bpm" bson:"bpm"`
+	BeatsPerBar     int           `json:"beatsPerBar" bson:"beatsPerBar"`
+	BeatUnit        int           `json:"beatUnit" bson:"beatUnit"`
+	Offset          float64       `json:"offset" bson:"offset"`
+	CountsPerPhrase int           `json:"countsPerPhrase" bson:"countsPerPhrase"`
+	Changes         []TempoChange `json:"changes,omitempty" bson:"changes,omitempty"`
+}
+
+// TempoChange - смена темпа и размера с начала такта Bar (такты с единицы).
+// BeatsPerBar 0 оставляет прежний размер.
+type TempoChange struct {
+	Bar         int     `json:"bar" bson:"bar"`
+	BPM         float64 `json:"bpm" bson:"bpm"`
+	BeatsPerBar int     `json:"beatsPerBar,omitempty" bson:"beatsPerBar,omitempty"`
+}
+
+// MusicalPosition - момент времени в тактах и счёте. Beat - номер доли
+// от первой сильной доли (с нуля, дробный), Bar и BeatInBar - такт и доля
+// в нём (с единицы), Eight и Count - восьмёрка и счёт в ней (с единицы).
+// До первой сильной доли такты и восьмёрки нулевые и отрицательные.
+type MusicalPosition struct {
+	Seconds   float64 `json:"seconds"`
+	Beat      float64 `json:"beat"`
+	Bar       int     `json:"bar"`
+	BeatInBar float64 `json:"beatInBar"`
+	Eight     int     `json:"eight"`
+	Count     float64 `json:"count"`
+	BPM       float64 `json:"bpm"`
+}
+
+// tempoSegment - участок карты с постоянным темпом и размером
+type tempoSegment struct {
+	bar         int
+	beat        float64
+	seconds     float64
+	bpm         float64
+	beatsPerBar int
+}
+
+// Validate проверяет карту темпа и задаёт значения по умолчанию
+func (m *TempoMap) Validate() error {
+	if !validBPM(m.BPM) {
+		return fmt.Errorf("bpm must be between %.0f and %.0f", MinTempoBPM, MaxTempoBPM)
+	}
+	if m.BeatsPerBar == 0 {
+		m.BeatsPerBar = 4
+	}
+	if m.BeatsPerBar < 1 || m.BeatsPerBar > MaxBeatsPerBar {
+		return fmt.Errorf("beats per bar must be between 1 and %d", MaxBeatsPerBar)
+	}
+	switch m.BeatUnit {
+	case 0:
+		m.BeatUnit = 4
+	case 1, 2, 4, 8, 16, 32:
+	default:
+		return fmt.Errorf("beat unit must be a power of two up to 32")
+	}
+	if !isFinite(m.Offset) || m.Offset < 0 {
+		return fmt.Errorf("offset must be a non-negative number of seconds")
+	}
+	if m.CountsPerPhrase == 0 {
+		m.CountsPerPhrase = DefaultPhraseLen
+	}
+	if m.CountsPerPhrase < 1 || m.CountsPerPhrase > 4*MaxBeatsPerBar {
+		return fmt.Errorf("counts per phrase must be between 1 and %d", 4*MaxBeatsPerBar)
+	}
+	if len(m.Changes) > MaxTempoChanges {
+		return fmt.Errorf("at most %d tempo changes are allowed", MaxTempoChanges)
+	}
+	sort.SliceStable(m.Changes, func(i, j int) bool { return m.Changes[i].Bar < m.Changes[j].Bar })
+	for i, change := range m.Changes {
+		if change.Bar < 2 {
+			return fmt.Errorf("tempo changes must start at bar 2 or later")
+		}
+		if i > 0 && change.Bar == m.Changes[i-1].Bar {
+			return fmt.Errorf("several tempo changes at bar %d", change.Bar)
+		}
+		if !validBPM(change.BPM) {
+			return fmt.Errorf("bpm at bar %d must be between %.0f and %.0f", change.Bar, MinTempoBPM, MaxTempoBPM)
+		}
+		if change.BeatsPerBar < 0 || change.BeatsPerBar > MaxBeatsPerBar {
+			return fmt.Errorf("beats per bar at bar %d must be between 1 and %d", change.Bar, MaxBeatsPerBar)
+		}
+	}
+	return nil
+}
+
+// segments строит участки карты по сменам темпа
+func (m *TempoMap) segments() []tempoSegment {
+	segments := make([]tempoSegment, 1, len(m.Changes)+1)
+	segments[0] = tempoSegment{bar: 1, seconds: m.Offset, bpm: m.BPM, beatsPerBar: m.BeatsPerBar}
+	for _, change := range m.Changes {
+		prev := segments[len(segments)-1]
+		beats := float64((change.Bar - prev.bar) * prev.beatsPerBar)
+		next := tempoSegment{
+			bar:         change.Bar,
+			beat:        prev.beat + beats,
+			seconds:     prev.seconds + beats*60/prev.bpm,
+			bpm:         change.BPM,
+			beatsPerBar: prev.beatsPerBar,
+		}
+		if change.BeatsPerBar > 0 {
+			next.beatsPerBar = change.BeatsPerBar
+		}
+		segments = append(segments, next)
+	}
+	return segments
+}
+
+// BeatAt возвращает номер доли (с нуля, дробный) в момент seconds.
+// До первой сильной доли доли отсчитываются назад в начальном темпе.
+func (m *TempoMap) BeatAt(seconds float64) float64 {
+	segments := m.segments()
+	i := sort.Search(len(segments), func(i int) bool { return segments[i].seconds > seconds }) - 1
+	if i < 0 {
+		i = 0
+	}
+	seg := segments[i]
+	return seg.beat + (seconds-seg.seconds)*seg.bpm/60
+}
+
+// SecondsAt возвращает момент доли beat
+func (m *TempoMap) SecondsAt(beat float64) float64 {
+	segments := m.segments()
+	i := sort.Search(len(segments), func(i int) bool { return segments[i].beat > beat }) - 1
+	if i < 0 {
+		i = 0
+	}
+	seg := segments[i]
+	return seg.seconds + (beat-seg.beat)*60/seg.bpm
+}
+
+// Position переводит момент в секундах в такты и счёт
+func (m *TempoMap) Position(seconds float64) MusicalPosition {
+	return m.positionOfBeat(m.BeatAt(seconds), seconds)
+}
+
+// PositionOfBeat возвращает положение доли beat
+func (m *TempoMap) PositionOfBeat(beat float64) MusicalPosition {
+	return m.positionOfBeat(beat, m.SecondsAt(beat))
+}
+
+func (m *TempoMap) positionOfBeat(beat, seconds float64) MusicalPosition {
+	segments := m.segments()
+	i := sort.Search(len(segments), func(i int) bool { return segments[i].beat > beat }) - 1
+	if i < 0 {
+		i = 0
+	}
+	seg := segments[i]
+	bars := math.Floor((beat - seg.beat) / float64(seg.beatsPerBar))
+	phrase := float64(m.CountsPerPhrase)
+	eights := math.Floor(beat / phrase)
+	return MusicalPosition{
+		Seconds:   seconds,
+		Beat:      beat,
+		Bar:       seg.bar + int(bars),
+		BeatInBar: beat - seg.beat - bars*float64(seg.beatsPerBar) + 1,
+		Eight:     int(eights) + 1,
+		Count:     beat - eights*phrase + 1,
+		BPM:       seg.bpm,
+	}
+}
+
+// BarBeat возвращает номер доли для такта bar и доли в нём beatInBar (с единицы)
+func (m *TempoMap) BarBeat(bar int, beatInBar float64) float64 {
+	segments := m.segments()
+	i := sort.Search(len(segments), func(i int) bool { return segments[i].bar > bar }) - 1
+	if i < 0 {
+		i = 0
+	}
+	seg := segments[i]
+	return seg.beat + float64((bar-seg.bar)*seg.beatsPerBar) + beatInBar - 1
+}
+
+// CountBeat возвращает номер доли для восьмёрки eight и счёта count (с единицы)
+func (m *TempoMap) CountBeat(eight int, count float64) float64 {
+	return float64((eight-1)*m.CountsPerPhrase) + count - 1
+}
+
+// Snap возвращает ближайший к seconds момент счёта. division делит счёт:
+// 1 - только счета, 2 - счета и «и» между ними.
+func (m *TempoMap) Snap(seconds float64, division int) float64 {
+	if division < 1 {
+		division = 1
+	}
+	beat := math.Round(m.BeatAt(seconds)*float64(division)) / float64(division)
+	return m.SecondsAt(beat)
+}
+
+// SnapElementKeyframes сдвигает ключевые кадры нормализованных элементов
+// к ближайшим счетам. Если несколько кадров элемента попадают на один счёт,
+// остаётся последний по списку. Возвращает число изменённых кадров.
+func (m *TempoMap) SnapElementKeyframes(elements []interface{}, division int) int {
+	changed := 0
+	for _, raw := range elements {
+		element, ok := raw.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		keyframes, ok := element["keyframes"].([]interface{})
+		if !ok {
+			continue
+		}
+
+		snapped := make([]interface{}, 0, len(keyframes))
+		index := make(map[float64]int, len(keyframes))
+		for _, rawKeyframe := range keyframes {
+			keyframe, ok := rawKeyframe.(map[string]interface{})
+			if !ok {
+				snapped = append(snapped, rawKeyframe)
+				continue
+			}
+			t := ConvertToFloat64(keyframe["time"], math.NaN())
+			if !isFinite(t) {
+				snapped = append(snapped, keyframe)
+				continue
+			}
+			// Кадры до начала записи не уходят в отрицательное время
+			snappedTime := math.Max(m.Snap(t, division), 0)
+			if snappedTime != t {
+				keyframe["time"] = snappedTime
+				changed++
+			}
+			if i, ok := index[snappedTime]; ok {
+				snapped[i] = keyframe
+				continue
+			}
+			index[snappedTime] = len(snapped)
+			snapped = append(snapped, keyframe)
+		}
+		element["keyframes"] = snapped
+	}
+	return changed
+}
+
+func validBPM(bpm float64) bool {
+	return isFinite(bpm) && bpm >= MinTempoBPM && bpm <= MaxTempoBPM
+}
@@ -0,0 +1,138 @@
+package models
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// Ограничения разметки шкалы времени
+const (
+	MaxTimelineSections = 500
+	MaxTimelineCues     = 1000
+	maxTimelineNameLen  = 100
+	maxTimelineNotesLen = 5000
+	DefaultSectionColor = "#4a90e2"
+	DefaultCueColor     = "#f5a623"
+)
+
+var hexColorPattern = regexp.MustCompile(`^#([0-9a-fA-F]{3}|[0-9a-fA-F]{6}|[0-9a-fA-F]{8})$`)
+
+// TimelineSection - именованная часть постановки (вступление, куплет,
+// припев) от Start до End в секундах
+type TimelineSection struct {
+	ID    string  `json:"id" bson:"id"`
+	Name  string  `json:"name" bson:"name"`
+	Start float64 `json:"start" bson:"start"`
+	End   float64 `json:"end" bson:"end"`
+	Color string  `json:"color" bson:"color"`
+	Notes string  `json:"notes,omitempty" bson:"notes,omitempty"`
+}
+
+// TimelineCue - отметка на шкале времени: смена света, выход, акцент
+type TimelineCue struct {
+	ID    string  `json:"id" bson:"id"`
+	Name  string  `json:"name" bson:"name"`
+	Time  float64 `json:"time" bson:"time"`
+	Color string  `json:"color" bson:"color"`
+	Notes string  `json:"notes,omitempty" bson:"notes,omitempty"`
+}
+
+// TimelineSectionInput - поля секции при создании и изменении
+type TimelineSectionInput struct {
+	Name  string   `json:"name"`
+	Start *float64 `json:"start"`
+	End   *float64 `json:"end"`
+	Color string   `json:"color"`
+	Notes *string  `json:"notes"`
+}
+
+// TimelineCueInput - поля отметки при создании и изменении
+type TimelineCueInput struct {
+	Name  string   `json:"name"`
+	Time  *float64 `json:"time"`
+	Color string   `json:"color"`
+	Notes *string  `json:"notes"`
+}
+
+// Apply переносит заданные поля в секцию
+func (in *TimelineSectionInput) Apply(section *TimelineSection) {
+	if in.Name != "" {
+		section.Name = in.Name
+	}
+	if in.Start != nil {
+		section.Start = *in.Start
+	}
+	if in.End != nil {
+		section.End = *in.End
+	}
+	if in.Color != "" {
+		section.Color = in.Color
+	}
+	if in.Notes != nil {
+		section.Notes = *in.Notes
+	}
+}
+
+// Apply переносит заданные поля в отметку
+func (in *TimelineCueInput) Apply(cue *TimelineCue) {
+	if in.Name != "" {
+		cue.Name = in.Name
+	}
+	if in.Time != nil {
+		cue.Time = *in.Time
+	}
+	if in.Color != "" {
+		cue.Color = in.Color
+	}
+	if in.Notes != nil {
+		cue.Notes = *in.Notes
+	}
+}
+
+// Validate проверяет секцию и задаёт цвет по умолчанию
+func (s *TimelineSection) Validate() error {
+	if err := validateTimelineText(&s.Name, s.Notes); err != nil {
+		return err
+	}
+	if !isFinite(s.Start) || !isFinite(s.End) || s.Start < 0 || s.End <= s.Start {
+		return fmt.Errorf("section must end after it starts, at a non-negative time")
+	}
+	return validateHexColor(&s.Color, DefaultSectionColor)
+}
+
+// Validate проверяет отметку и задаёт цвет по умолчанию
+func (c *TimelineCue) Validate() error {
+	if err := validateTimelineText(&c.Name, c.Notes); err != nil {
+		return err
+	}
+	if !isFinite(c.Time) || c.Time < 0 {
+		return fmt.Errorf("cue time must be a non-negative number of seconds")
+	}
+	return validateHexColor(&c.Color, DefaultCueColor)
+}
+
+func validateTimelineText(name *string, notes string) error {
+	*name = strings.TrimSpace(*name)
+	if *name == "" {
+		return fmt.Errorf("name is required")
+	}
+	if utf8.RuneCountInString(*name) > maxTimelineNameLen {
+		return fmt.Errorf("name must be at most %d characters", maxTimelineNameLen)
+	}
+	if utf8.RuneCountInString(notes) > maxTimelineNotesLen {
+		return fmt.Errorf("notes must be at most %d characters", maxTimelineNotesLen)
+	}
+	return nil
+}
+
+func validateHexColor(color *string, fallback string) error {
+	if *color == "" {
+		*color = fallback
+	}
+	if !hexColorPattern.MatchString(*color) {
+		return fmt.Errorf("color must be a hex colour like #4a90e2")
+	}
+	return nil
+}
@@ -18,6 +18,10 @@ type User struct {
 	Teams        []primitive.ObjectID `json:"teams" bson:"teams"`
 	CreatedAt    time.Time          `json:"createdAt" bson:"createdAt"`
 	UpdatedAt    time.Time          `json:"updatedAt" bson:"updatedAt,omitempty"`
+	// CalendarTokenHash - хеш токена подписки на личный календарь репетиций
+	CalendarTokenHash string `json:"-" bson:"calendarTokenHash,omitempty"`
+	// NotificationPreferences - включённые типы уведомлений
+	NotificationPreferences NotificationPreferences `json:"-" bson:"notificationPreferences,omitempty"`
 }
 
 // TeamRef представляет ссылку на команду в модели User
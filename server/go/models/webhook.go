@@ -0,0 +1,180 @@
+package models
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// События вебхуков
+const (
+	WebhookProjectCreated      = "project.created"
+	WebhookProjectUpdated      = "project.updated"
+	WebhookProjectDeleted      = "project.deleted"
+	WebhookMemberAdded         = "team.member_added"
+	WebhookMemberRemoved       = "team.member_removed"
+	WebhookAnalysisJobFinished = "analysis_job.finished"
+	// WebhookPing отправляется только запросом тестового события
+	WebhookPing = "ping"
+)
+
+// WebhookEvents - события, на которые можно подписаться
+var WebhookEvents = []string{
+	WebhookProjectCreated,
+	WebhookProjectUpdated,
+	WebhookProjectDeleted,
+	WebhookMemberAdded,
+	WebhookMemberRemoved,
+	WebhookAnalysisJobFinished,
+}
+
+// Статусы доставки вебхука
+const (
+	DeliveryPending   = "pending"
+	DeliverySucceeded = "succeeded"
+	DeliveryFailed    = "failed"
+)
+
+// Ограничения вебхуков
+const (
+	MaxWebhooksPerOwner      = 20
+	maxWebhookURLLen         = 2000
+	maxWebhookDescriptionLen = 500
+)
+
+// Webhook - подписка внешнего сервиса на события команды (TeamID) или
+// проектов пользователя (UserID). Secret подписывает тело запроса и
+// показывается только при создании и смене.
+type Webhook struct {
+	ID          primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	TeamID      primitive.ObjectID `json:"teamId,omitempty" bson:"teamId,omitempty"`
+	UserID      primitive.ObjectID `json:"userId,omitempty" bson:"userId,omitempty"`
+	URL         string             `json:"url" bson:"url"`
+	Secret      string             `json:"-" bson:"secret"`
+	Events      []string           `json:"events" bson:"events"`
+	Active      bool               `json:"active" bson:"active"`
+	Description string             `json:"description,omitempty" bson:"description,omitempty"`
+	CreatedBy   primitive.ObjectID `json:"createdBy" bson:"createdBy"`
+	CreatedAt   time.Time          `json:"createdAt" bson:"createdAt"`
+	UpdatedAt   time.Time          `json:"updatedAt" bson:"updatedAt"`
+}
+
+// WebhookInput - поля вебхука при создании и изменении
+type WebhookInput struct {
+	URL         string   `json:"url"`
+	Events      []string `json:"events"`
+	Active      *bool    `json:"active"`
+	Description *string  `json:"description"`
+}
+
+// WebhookDelivery - доставка одного события одному вебхуку со всеми
+// попытками. Payload хранится как отправленный, чтобы повтор совпадал с
+// подписью.
+type WebhookDelivery struct {
+	ID            primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	WebhookID     primitive.ObjectID `json:"webhookId" bson:"webhookId"`
+	EventID       string             `json:"eventId" bson:"eventId"`
+	Event         string             `json:"event" bson:"event"`
+	Payload       string             `json:"payload" bson:"payload"`
+	Status        string             `json:"status" bson:"status"`
+	Attempts      []WebhookAttempt   `json:"attempts" bson:"attempts"`
+	NextAttemptAt *time.Time         `json:"nextAttemptAt,omitempty" bson:"nextAttemptAt,omitempty"`
+	CreatedAt     time.Time          `json:"createdAt" bson:"createdAt"`
+	UpdatedAt     time.Time          `json:"updatedAt" bson:"updatedAt"`
+}
+
+// WebhookAttempt - одна попытка доставки
+type WebhookAttempt struct {
+	At           time.Time `json:"at" bson:"at"`
+	StatusCode   int       `json:"statusCode,omitempty" bson:"statusCode,omitempty"`
+	Error        string    `json:"error,omitempty" bson:"error,omitempty"`
+	DurationMs   int64     `json:"durationMs" bson:"durationMs"`
+	ResponseBody string    `json:"responseBody,omitempty" bson:"responseBody,omitempty"`
+}
+
+// Apply переносит заданные поля в вебхук
+func (in *WebhookInput) Apply(w *Webhook) {
+	if in.URL != "" {
+		w.URL = strings.TrimSpace(in.URL)
+	}
+	if in.Events != nil {
+		w.Events = in.Events
+	}
+	if in.Active != nil {
+		w.Active = *in.Active
+	}
+	if in.Description != nil {
+		w.Description = strings.TrimSpace(*in.Description)
+	}
+}
+
+// Validate проверяет адрес и события вебхука
+func (w *Webhook) Validate() error {
+	if len(w.URL) > maxWebhookURLLen {
+		return fmt.Errorf("url must be at most %d characters", maxWebhookURLLen)
+	}
+	parsed, err := url.Parse(w.URL)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Hostname() == "" {
+		return fmt.Errorf("url must be an absolute http or https URL")
+	}
+	if parsed.User != nil {
+		return fmt.Errorf("url must not contain credentials")
+	}
+	if utf8.RuneCountInString(w.Description) > maxWebhookDescriptionLen {
+		return fmt.Errorf("description must be at most %d characters", maxWebhookDescriptionLen)
+	}
+	if len(w.Events) == 0 {
+		return fmt.Errorf("at least one event is required")
+	}
+	seen := map[string]bool{}
+	events := make([]string, 0, len(w.Events))
+	for _, event := range w.Events {
+		if !IsWebhookEvent(event) {
+			return fmt.Errorf("unknown webhook event %q", event)
+		}
+		if !seen[event] {
+			seen[event] = true
+			events = append(events, event)
+		}
+	}
+	w.Events = events
+	return nil
+}
+
+// Subscribed сообщает, что вебхук получает событие
+func (w *Webhook) Subscribed(event string) bool {
+	if event == WebhookPing {
+		return true
+	}
+	for _, e := range w.Events {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+// IsWebhookEvent сообщает, что на событие можно подписаться
+func IsWebhookEvent(event string) bool {
+	for _, e := range WebhookEvents {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+// NewWebhookSecret создаёт секрет для подписи тела запроса
+func NewWebhookSecret() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return "whsec_" + hex.EncodeToString(buf), nil
+}
@@ -0,0 +1,70 @@
+package notify
+
+import (
+	"sync"
+
+	"github.com/kktjss/dance-flow/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Размер очереди уведомлений одного потока. Если клиент не успевает
+// читать, лишние уведомления в поток не попадают - они остаются в списке.
+const streamBuffer = 16
+
+// Hub раздаёт новые уведомления открытым потокам пользователей в этом
+// процессе
+type Hub struct {
+	mu      sync.Mutex
+	streams map[primitive.ObjectID]map[chan models.Notification]struct{}
+}
+
+// DefaultHub - хаб потоков сервера
+var DefaultHub = NewHub()
+
+// NewHub создаёт пустой хаб
+func NewHub() *Hub {
+	return &Hub{streams: map[primitive.ObjectID]map[chan models.Notification]struct{}{}}
+}
+
+// Subscribe открывает поток уведомлений пользователя. Возвращённую функцию
+// нужно вызвать, когда поток закрыт.
+func (h *Hub) Subscribe(userID primitive.ObjectID) (<-chan models.Notification, func()) {
+	ch := make(chan models.Notification, streamBuffer)
+	h.mu.Lock()
+	if h.streams[userID] == nil {
+		h.streams[userID] = map[chan models.Notification]struct{}{}
+	}
+	h.streams[userID][ch] = struct{}{}
+	h.mu.Unlock()
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			h.mu.Lock()
+			delete(h.streams[userID], ch)
+			if len(h.streams[userID]) == 0 {
+				delete(h.streams, userID)
+			}
+			h.mu.Unlock()
+		})
+	}
+}
+
+// Publish отправляет уведомление во все потоки получателя без ожидания
+func (h *Hub) Publish(n models.Notification) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for ch := range h.streams[n.UserID] {
+		select {
+		case ch <- n:
+		default:
+		}
+	}
+}
+
+// Streams возвращает число открытых потоков пользователя
+func (h *Hub) Streams(userID primitive.ObjectID) int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return len(h.streams[userID])
+}
@@ -0,0 +1,195 @@
+// Package notify создаёт уведомления пользователей из событий команд и
+// проектов и раздаёт их открытым потокам. Уведомления доставляются по
+// возможности: ошибки записываются в лог и не прерывают запрос, который
+// вызвал событие.
+package notify
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/kktjss/dance-flow/config"
+	"github.com/kktjss/dance-flow/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// TeamMemberAdded сообщает пользователю, что его добавили в команду
+func TeamMemberAdded(ctx context.Context, actorID primitive.ObjectID, team *models.Team, userID primitive.ObjectID, role string) {
+	actor := userName(ctx, actorID)
+	deliver(ctx, models.Notification{
+		Type:      models.NotificationTeamMemberAdded,
+		ActorID:   actorID,
+		ActorName: actor,
+		TeamID:    team.ID,
+		Message:   fmt.Sprintf("%s added you to team %q as %s", actor, team.Name, role),
+	}, []primitive.ObjectID{userID})
+}
+
+// TeamProjectUpdated сообщает владельцу и участникам команды об изменении
+// её проекта. Для личного проекта ничего не делает.
+func TeamProjectUpdated(ctx context.Context, actorID, projectID primitive.ObjectID, description string) {
+	var project models.Project
+	err := config.ProjectsCollection.FindOne(ctx, bson.M{"_id": projectID},
+		options.FindOne().SetProjection(bson.M{"name": 1, "title": 1, "teamId": 1})).Decode(&project)
+	if err != nil {
+		config.LogError("NOTIFY", fmt.Errorf("failed to load project %s: %w", projectID.Hex(), err))
+		return
+	}
+	if project.TeamID.IsZero() {
+		return
+	}
+	var team models.Team
+	err = config.TeamsCollection.FindOne(ctx, bson.M{"_id": project.TeamID},
+		options.FindOne().SetProjection(bson.M{"owner": 1, "members": 1})).Decode(&team)
+	if err != nil {
+		config.LogError("NOTIFY", fmt.Errorf("failed to load team %s: %w", project.TeamID.Hex(), err))
+		return
+	}
+
+	recipients := []primitive.ObjectID{team.Owner}
+	for _, member := range team.Members {
+		recipients = append(recipients, member.UserID)
+	}
+	actor := userName(ctx, actorID)
+	message := fmt.Sprintf("%s updated project %q", actor, projectName(&project))
+	if description != "" {
+		message += ": " + description
+	}
+	deliver(ctx, models.Notification{
+		Type:      models.NotificationTeamProjectUpdated,
+		ActorID:   actorID,
+		ActorName: actor,
+		TeamID:    project.TeamID,
+		ProjectID: project.ID,
+		Message:   message,
+	}, recipients)
+}
+
+// Mentioned сообщает пользователям, что их упомянули в комментарии
+func Mentioned(ctx context.Context, comment *models.Comment, userIDs []primitive.ObjectID) {
+	if len(userIDs) == 0 {
+		return
+	}
+	var project models.Project
+	err := config.ProjectsCollection.FindOne(ctx, bson.M{"_id": comment.ProjectID},
+		options.FindOne().SetProjection(bson.M{"name": 1, "title": 1, "teamId": 1})).Decode(&project)
+	if err != nil {
+		config.LogError("NOTIFY", fmt.Errorf("failed to load project %s: %w", comment.ProjectID.Hex(), err))
+		return
+	}
+
+	commentID := comment.ID
+	if comment.ThreadID != nil {
+		commentID = *comment.ThreadID
+	}
+	actor := userName(ctx, comment.AuthorID)
+	deliver(ctx, models.Notification{
+		Type:      models.NotificationMention,
+		ActorID:   comment.AuthorID,
+		ActorName: actor,
+		TeamID:    project.TeamID,
+		ProjectID: project.ID,
+		CommentID: commentID,
+		Message:   fmt.Sprintf("%s mentioned you in a comment on %q", actor, projectName(&project)),
+	}, userIDs)
+}
+
+// deliver записывает уведомление каждому получателю, кроме автора события и
+// отключивших этот тип, и отправляет его в открытые потоки. Непрочитанное
+// уведомление об изменении проекта обновляется вместо создания нового.
+func deliver(ctx context.Context, base models.Notification, recipients []primitive.ObjectID) {
+	ids := []primitive.ObjectID{}
+	seen := map[primitive.ObjectID]bool{}
+	for _, id := range recipients {
+		if id.IsZero() || id == base.ActorID || seen[id] {
+			continue
+		}
+		seen[id] = true
+		ids = append(ids, id)
+	}
+	if len(ids) == 0 {
+		return
+	}
+
+	cursor, err := config.UsersCollection.Find(ctx, bson.M{"_id": bson.M{"$in": ids}},
+		options.Find().SetProjection(bson.M{"notificationPreferences": 1}))
+	if err != nil {
+		config.LogError("NOTIFY", fmt.Errorf("failed to load notification preferences: %w", err))
+		return
+	}
+	var users []models.User
+	if err := cursor.All(ctx, &users); err != nil {
+		config.LogError("NOTIFY", fmt.Errorf("failed to decode notification preferences: %w", err))
+		return
+	}
+
+	for _, user := range users {
+		if !user.NotificationPreferences.Enabled(base.Type) {
+			continue
+		}
+		n := base
+		n.UserID = user.ID
+		var err error
+		if n.Type == models.NotificationTeamProjectUpdated {
+			err = upsertProjectUpdate(ctx, &n)
+		} else {
+			err = insert(ctx, &n)
+		}
+		if err != nil {
+			config.LogError("NOTIFY", fmt.Errorf("failed to save %s notification for user %s: %w", n.Type, n.UserID.Hex(), err))
+			continue
+		}
+		DefaultHub.Publish(n)
+	}
+}
+
+func insert(ctx context.Context, n *models.Notification) error {
+	now := time.Now()
+	n.ID = primitive.NewObjectID()
+	n.Count = 1
+	n.CreatedAt, n.UpdatedAt = now, now
+	_, err := config.NotificationsCollection.InsertOne(ctx, n)
+	return err
+}
+
+// upsertProjectUpdate копит изменения проекта в непрочитанном уведомлении
+func upsertProjectUpdate(ctx context.Context, n *models.Notification) error {
+	now := time.Now()
+	filter := bson.M{"userId": n.UserID, "type": n.Type, "projectId": n.ProjectID, "read": false}
+	update := bson.M{
+		"$set": bson.M{
+			"actorId":   n.ActorID,
+			"actorName": n.ActorName,
+			"message":   n.Message,
+			"updatedAt": now,
+		},
+		"$inc":         bson.M{"count": 1},
+		"$setOnInsert": bson.M{"teamId": n.TeamID, "createdAt": now},
+	}
+	opts := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
+	return config.NotificationsCollection.FindOneAndUpdate(ctx, filter, update, opts).Decode(n)
+}
+
+// userName возвращает имя пользователя для текста уведомления
+func userName(ctx context.Context, userID primitive.ObjectID) string {
+	var user models.User
+	err := config.UsersCollection.FindOne(ctx, bson.M{"_id": userID},
+		options.FindOne().SetProjection(bson.M{"username": 1, "name": 1})).Decode(&user)
+	if err != nil {
+		return "Someone"
+	}
+	if user.Name != "" {
+		return user.Name
+	}
+	return user.Username
+}
+
+func projectName(project *models.Project) string {
+	if project.Name != "" {
+		return project.Name
+	}
+	return project.Title
+}
@@ -0,0 +1,91 @@
+// Package poseanalysis сравнивает и обрабатывает последовательности поз
+package poseanalysis
+
+import (
+	"math"
+
+	"github.com/kktjss/dance-flow/models"
+)
+
+// MinVisibility - минимальная видимость сустава, при которой он участвует в расчётах
+const MinVisibility = 0.3
+
+// AngleDef описывает угол в суставе Joint между направлениями на From и To
+type AngleDef struct {
+	Name  string
+	From  string
+	Joint string
+	To    string
+}
+
+// Углы, по которым сравниваются позы. Используются только суставы,
+// которые есть во всех поддерживаемых скелетах.
+var Angles = []AngleDef{
+	{Name: "left_elbow", From: "left_shoulder", Joint: "left_elbow", To: "left_wrist"},
+	{Name: "right_elbow", From: "right_shoulder", Joint: "right_elbow", To: "right_wrist"},
+	{Name: "left_shoulder", From: "left_elbow", Joint: "left_shoulder", To: "left_hip"},
+	{Name: "right_shoulder", From: "right_elbow", Joint: "right_shoulder", To: "right_hip"},
+	{Name: "left_hip", From: "left_shoulder", Joint: "left_hip", To: "left_knee"},
+	{Name: "right_hip", From: "right_shoulder", Joint: "right_hip", To: "right_knee"},
+	{Name: "left_knee", From: "left_hip", Joint: "left_knee", To: "left_ankle"},
+	{Name: "right_knee", From: "right_hip", Joint: "right_knee", To: "right_ankle"},
+}
+
+// FindJoint возвращает сустав кадра по имени. Суставы обычно лежат в порядке
+// скелета, поэтому сначала проверяется позиция по индексу.
+func FindJoint(joints []models.Joint, skeleton *models.Skeleton, name string) (models.Joint, bool) {
+	if i := skeleton.JointIndex(name); i >= 0 && i < len(joints) && joints[i].Name == name {
+		return joints[i], true
+	}
+	for _, joint := range joints {
+		if joint.Name == name {
+			return joint, true
+		}
+	}
+	return models.Joint{}, false
+}
+
+// FrameAngles вычисляет углы Angles в градусах. Если какой-то сустав не виден,
+// соответствующий угол равен NaN. aspect - отношение ширины кадра к высоте.
+func FrameAngles(joints []models.Joint, skeleton *models.Skeleton, aspect float64) []float64 {
+	angles := make([]float64, len(Angles))
+	for i, def := range Angles {
+		angles[i] = math.NaN()
+
+		from, ok1 := FindJoint(joints, skeleton, def.From)
+		center, ok2 := FindJoint(joints, skeleton, def.Joint)
+		to, ok3 := FindJoint(joints, skeleton, def.To)
+		if !ok1 || !ok2 || !ok3 ||
+			from.Visibility < MinVisibility || center.Visibility < MinVisibility || to.Visibility < MinVisibility {
+			continue
+		}
+
+		ux, uy := (from.X-center.X)*aspect, from.Y-center.Y
+		vx, vy := (to.X-center.X)*aspect, to.Y-center.Y
+		lu, lv := math.Hypot(ux, uy), math.Hypot(vx, vy)
+		if lu < 1e-9 || lv < 1e-9 {
+			continue
+		}
+
+		cos := (ux*vx + uy*vy) / (lu * lv)
+		angles[i] = math.Acos(math.Max(-1, math.Min(1, cos))) * 180 / math.Pi
+	}
+	return angles
+}
+
+// AngleDistance возвращает среднюю абсолютную разницу углов, видимых в обеих позах,
+// и число таких углов
+func AngleDistance(a, b []float64) (float64, int) {
+	sum, count := 0.0, 0
+	for i := range a {
+		if i >= len(b) || math.IsNaN(a[i]) || math.IsNaN(b[i]) {
+			continue
+		}
+		sum += math.Abs(a[i] - b[i])
+		count++
+	}
+	if count == 0 {
+		return 0, 0
+	}
+	return sum / float64(count), count
+}
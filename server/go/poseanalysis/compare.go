@@ -0,0 +1,298 @@
+package poseanalysis
+
+import (
+	"errors"
+	"math"
+	"sort"
+
+	"github.com/kktjss/dance-flow/models"
+)
+
+// MaxAngleDiff - средняя разница углов (в градусах), при которой сходство считается нулевым
+const MaxAngleDiff = 60.0
+
+// Section - часть хореографии на временной шкале студента (в секундах)
+type Section struct {
+	Name  string  `json:"name"`
+	Start float64 `json:"start"`
+	End   float64 `json:"end"`
+}
+
+// CompareOptions задаёт параметры сравнения
+type CompareOptions struct {
+	// Sections - секции для отдельной оценки; по умолчанию вся запись целиком
+	Sections []Section
+	// TopDeviations - число моментов с наибольшими отклонениями
+	TopDeviations int
+	// MinDeviationGap - минимальный интервал между возвращаемыми моментами в секундах
+	MinDeviationGap float64
+	// Window - ширина полосы DTW в доле длины последовательности
+	Window float64
+}
+
+// AngleScore - средняя разница одного угла
+type AngleScore struct {
+	Angle    string  `json:"angle"`
+	MeanDiff float64 `json:"meanDiff"`
+	Samples  int     `json:"samples"`
+}
+
+// SectionScore - оценка одной секции
+type SectionScore struct {
+	Section
+	Score         float64      `json:"score"`
+	MeanAngleDiff float64      `json:"meanAngleDiff"`
+	Frames        int          `json:"frames"`
+	Angles        []AngleScore `json:"angles"`
+}
+
+// AngleDeviation - разница одного угла в момент отклонения
+type AngleDeviation struct {
+	Angle     string  `json:"angle"`
+	Actual    float64 `json:"actual"`
+	Reference float64 `json:"reference"`
+	Diff      float64 `json:"diff"`
+}
+
+// Deviation - момент, где поза студента сильнее всего отличается от эталона
+type Deviation struct {
+	Time          float64          `json:"time"`
+	ReferenceTime float64          `json:"referenceTime"`
+	MeanAngleDiff float64          `json:"meanAngleDiff"`
+	Score         float64          `json:"score"`
+	Angles        []AngleDeviation `json:"angles"`
+}
+
+// Comparison - результат сравнения двух последовательностей
+type Comparison struct {
+	Score           float64        `json:"score"`
+	MeanAngleDiff   float64        `json:"meanAngleDiff"`
+	Angles          []AngleScore   `json:"angles"`
+	Sections        []SectionScore `json:"sections"`
+	Deviations      []Deviation    `json:"deviations"`
+	Frames          int            `json:"frames"`
+	ReferenceFrames int            `json:"referenceFrames"`
+	MatchedPairs    int            `json:"matchedPairs"`
+}
+
+// Similarity переводит среднюю разницу углов в оценку от 0 до 100
+func Similarity(meanAngleDiff float64) float64 {
+	return math.Round(math.Max(0, 1-meanAngleDiff/MaxAngleDiff)*1000) / 10
+}
+
+// Compare выравнивает запись студента с эталоном по времени (DTW по углам суставов)
+// и оценивает сходство по секциям
+func Compare(actual, reference *models.PoseSequence, opts CompareOptions) (*Comparison, error) {
+	if len(actual.Frames) == 0 || len(reference.Frames) == 0 {
+		return nil, errors.New("both sequences must contain frames")
+	}
+	actualSkeleton, err := models.GetSkeleton(actual.Skeleton)
+	if err != nil {
+		return nil, err
+	}
+	referenceSkeleton, err := models.GetSkeleton(reference.Skeleton)
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.TopDeviations <= 0 {
+		opts.TopDeviations = 5
+	}
+	if opts.MinDeviationGap <= 0 {
+		opts.MinDeviationGap = 0.5
+	}
+	if opts.Window <= 0 {
+		opts.Window = 0.1
+	}
+
+	actualAngles := sequenceAngles(actual, actualSkeleton)
+	referenceAngles := sequenceAngles(reference, referenceSkeleton)
+
+	// Кадры без общих видимых углов получают максимальную стоимость,
+	// чтобы путь по возможности их обходил
+	dist := func(i, j int) float64 {
+		d, count := AngleDistance(actualAngles[i], referenceAngles[j])
+		if count == 0 {
+			return MaxAngleDiff
+		}
+		return d
+	}
+
+	n, m := len(actual.Frames), len(reference.Frames)
+	window := int(math.Ceil(opts.Window * float64(max(n, m))))
+	path, _ := Align(n, m, window, dist)
+
+	sections := opts.Sections
+	if len(sections) == 0 {
+		sections = []Section{{
+			Name:  "full",
+			Start: actual.Frames[0].Time,
+			End:   actual.Frames[n-1].Time,
+		}}
+	}
+
+	overall := newAngleStats()
+	sectionStats := make([]*angleStats, len(sections))
+	for i := range sectionStats {
+		sectionStats[i] = newAngleStats()
+	}
+
+	type matched struct {
+		pair Pair
+		diff float64
+	}
+	var pairs []matched
+	for _, pair := range path {
+		a, r := actualAngles[pair.I], referenceAngles[pair.J]
+		diff, count := AngleDistance(a, r)
+		if count == 0 {
+			continue
+		}
+		pairs = append(pairs, matched{pair: pair, diff: diff})
+		overall.add(a, r, diff)
+
+		time := actual.Frames[pair.I].Time
+		for s, section := range sections {
+			if time >= section.Start && time <= section.End {
+				sectionStats[s].add(a, r, diff)
+			}
+		}
+	}
+
+	result := &Comparison{
+		Score:           Similarity(overall.mean()),
+		MeanAngleDiff:   round2(overall.mean()),
+		Angles:          overall.angles(),
+		Frames:          n,
+		ReferenceFrames: m,
+		MatchedPairs:    len(pairs),
+	}
+	if overall.pairs == 0 {
+		result.Score = 0
+	}
+
+	for s, section := range sections {
+		stats := sectionStats[s]
+		score := SectionScore{
+			Section:       section,
+			Score:         Similarity(stats.mean()),
+			MeanAngleDiff: round2(stats.mean()),
+			Frames:        stats.pairs,
+			Angles:        stats.angles(),
+		}
+		if stats.pairs == 0 {
+			score.Score = 0
+		}
+		result.Sections = append(result.Sections, score)
+	}
+
+	// Наибольшие отклонения: жадно берём худшие пары, пропуская соседние по времени
+	sort.SliceStable(pairs, func(i, j int) bool { return pairs[i].diff > pairs[j].diff })
+	result.Deviations = []Deviation{}
+	for _, p := range pairs {
+		if len(result.Deviations) >= opts.TopDeviations {
+			break
+		}
+		time := actual.Frames[p.pair.I].Time
+		tooClose := false
+		for _, d := range result.Deviations {
+			if math.Abs(d.Time-time) < opts.MinDeviationGap {
+				tooClose = true
+				break
+			}
+		}
+		if tooClose {
+			continue
+		}
+
+		result.Deviations = append(result.Deviations, Deviation{
+			Time:          time,
+			ReferenceTime: reference.Frames[p.pair.J].Time,
+			MeanAngleDiff: round2(p.diff),
+			Score:         Similarity(p.diff),
+			Angles:        worstAngles(actualAngles[p.pair.I], referenceAngles[p.pair.J], 3),
+		})
+	}
+
+	return result, nil
+}
+
+func sequenceAngles(sequence *models.PoseSequence, skeleton *models.Skeleton) [][]float64 {
+	aspect := sequence.Aspect()
+	angles := make([][]float64, len(sequence.Frames))
+	for i, frame := range sequence.Frames {
+		angles[i] = FrameAngles(frame.Joints, skeleton, aspect)
+	}
+	return angles
+}
+
+// worstAngles возвращает limit углов с наибольшей разницей
+func worstAngles(actual, reference []float64, limit int) []AngleDeviation {
+	var deviations []AngleDeviation
+	for i, def := range Angles {
+		if math.IsNaN(actual[i]) || math.IsNaN(reference[i]) {
+			continue
+		}
+		deviations = append(deviations, AngleDeviation{
+			Angle:     def.Name,
+			Actual:    round2(actual[i]),
+			Reference: round2(reference[i]),
+			Diff:      round2(math.Abs(actual[i] - reference[i])),
+		})
+	}
+	sort.SliceStable(deviations, func(i, j int) bool { return deviations[i].Diff > deviations[j].Diff })
+	if len(deviations) > limit {
+		deviations = deviations[:limit]
+	}
+	return deviations
+}
+
+// angleStats накапливает средние разницы по каждому углу
+type angleStats struct {
+	sum    []float64
+	counts []int
+	total  float64
+	pairs  int
+}
+
+func newAngleStats() *angleStats {
+	return &angleStats{sum: make([]float64, len(Angles)), counts: make([]int, len(Angles))}
+}
+
+func (s *angleStats) add(actual, reference []float64, diff float64) {
+	for i := range Angles {
+		if math.IsNaN(actual[i]) || math.IsNaN(reference[i]) {
+			continue
+		}
+		s.sum[i] += math.Abs(actual[i] - reference[i])
+		s.counts[i]++
+	}
+	s.total += diff
+	s.pairs++
+}
+
+func (s *angleStats) mean() float64 {
+	if s.pairs == 0 {
+		return 0
+	}
+	return s.total / float64(s.pairs)
+}
+
+func (s *angleStats) angles() []AngleScore {
+	scores := make([]AngleScore, 0, len(Angles))
+	for i, def := range Angles {
+		if s.counts[i] == 0 {
+			continue
+		}
+		scores = append(scores, AngleScore{
+			Angle:    def.Name,
+			MeanDiff: round2(s.sum[i] / float64(s.counts[i])),
+			Samples:  s.counts[i],
+		})
+	}
+	return scores
+}
+
+func round2(v float64) float64 {
+	return math.Round(v*100) / 100
+}
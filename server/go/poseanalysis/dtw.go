@@ -0,0 +1,83 @@
+package poseanalysis
+
+import "math"
+
+// Pair - пара сопоставленных кадров: I из первой последовательности, J из второй
+type Pair struct {
+	I int
+	J int
+}
+
+// Align выравнивает последовательности длины n и m динамической трансформацией
+// времени (DTW). dist возвращает стоимость сопоставления кадров i и j.
+// Поиск ограничен полосой шириной window кадров вокруг диагонали (Sakoe-Chiba),
+// поэтому память и время растут как O(n * window), а не O(n * m).
+// Возвращает путь от начала к концу и его суммарную стоимость.
+func Align(n, m, window int, dist func(i, j int) float64) ([]Pair, float64) {
+	if n == 0 || m == 0 {
+		return nil, 0
+	}
+
+	// Полоса должна покрывать разницу темпов, иначе путь может оборваться
+	minWindow := int(math.Ceil(float64(max(n, m))/float64(min(n, m)))) + 1
+	if window < minWindow {
+		window = minWindow
+	}
+
+	type row struct {
+		lo   int
+		cost []float64
+	}
+	rows := make([]row, n)
+	at := func(i, j int) float64 {
+		if i < 0 || j < 0 {
+			if i < 0 && j < 0 {
+				return 0
+			}
+			return math.Inf(1)
+		}
+		r := rows[i]
+		if j < r.lo || j >= r.lo+len(r.cost) {
+			return math.Inf(1)
+		}
+		return r.cost[j-r.lo]
+	}
+
+	for i := 0; i < n; i++ {
+		center := int(math.Round(float64(i) * float64(m-1) / math.Max(1, float64(n-1))))
+		lo := max(0, center-window)
+		hi := min(m-1, center+window)
+		rows[i] = row{lo: lo, cost: make([]float64, hi-lo+1)}
+
+		for j := lo; j <= hi; j++ {
+			best := math.Min(at(i-1, j-1), math.Min(at(i-1, j), at(i, j-1)))
+			if i == 0 && j == 0 {
+				best = 0
+			}
+			rows[i].cost[j-lo] = dist(i, j) + best
+		}
+	}
+
+	total := at(n-1, m-1)
+
+	// Восстанавливаем путь от конца к началу
+	path := []Pair{{I: n - 1, J: m - 1}}
+	i, j := n-1, m-1
+	for i > 0 || j > 0 {
+		diag, up, left := at(i-1, j-1), at(i-1, j), at(i, j-1)
+		switch {
+		case diag <= up && diag <= left:
+			i, j = i-1, j-1
+		case up <= left:
+			i--
+		default:
+			j--
+		}
+		path = append(path, Pair{I: i, J: j})
+	}
+	for l, r := 0, len(path)-1; l < r; l, r = l+1, r-1 {
+		path[l], path[r] = path[r], path[l]
+	}
+
+	return path, total
+}
@@ -0,0 +1,325 @@
+package poseanalysis
+
+import (
+	"errors"
+	"math"
+
+	"github.com/kktjss/dance-flow/models"
+)
+
+// Значения параметров фильтрации по умолчанию. Координаты нормализованы,
+// поэтому скорости малы (доли кадра в секунду) и beta заметно больше,
+// чем в рекомендациях для пиксельных координат.
+const (
+	defaultMinCutoff        = 1.5
+	defaultBeta             = 10.0
+	defaultDCutoff          = 1.0
+	defaultProcessNoise     = 1.0
+	defaultMeasurementNoise = 1e-4
+	defaultMaxGap           = 0.5
+	defaultMaxVelocity      = 5.0
+	maxFilterGap            = 5.0
+)
+
+// FilterReport описывает, что изменила фильтрация
+type FilterReport struct {
+	Frames          int `json:"frames"`
+	OutliersRemoved int `json:"outliersRemoved"`
+	GapsFilled      int `json:"gapsFilled"`
+	SamplesSmoothed int `json:"samplesSmoothed"`
+}
+
+// NormalizeFilterParams проверяет параметры и подставляет значения по умолчанию.
+// Нормализованные параметры сохраняются вместе с результатом, чтобы его можно было повторить.
+func NormalizeFilterParams(p *models.PoseFilterParams) error {
+	if p.Smoothing == "" {
+		p.Smoothing = models.SmoothingOneEuro
+	}
+	// Порог скорости и видимости без значения получает значение по умолчанию,
+	// а явный 0 отключает проверку
+	if p.MaxVelocity == nil {
+		maxVelocity := defaultMaxVelocity
+		p.MaxVelocity = &maxVelocity
+	}
+	if p.MinVisibility == nil {
+		minVisibility := MinVisibility
+		p.MinVisibility = &minVisibility
+	}
+	for _, v := range []float64{p.MinCutoff, p.Beta, p.DCutoff, p.ProcessNoise, p.MeasurementNoise, p.MaxGap, *p.MaxVelocity, *p.MinVisibility} {
+		if math.IsNaN(v) || math.IsInf(v, 0) || v < 0 {
+			return errors.New("filter parameters must be non-negative numbers")
+		}
+	}
+
+	switch p.Smoothing {
+	case models.SmoothingNone:
+	case models.SmoothingOneEuro:
+		if p.MinCutoff == 0 {
+			p.MinCutoff = defaultMinCutoff
+		}
+		if p.Beta == 0 {
+			p.Beta = defaultBeta
+		}
+		if p.DCutoff == 0 {
+			p.DCutoff = defaultDCutoff
+		}
+	case models.SmoothingKalman:
+		if p.ProcessNoise == 0 {
+			p.ProcessNoise = defaultProcessNoise
+		}
+		if p.MeasurementNoise == 0 {
+			p.MeasurementNoise = defaultMeasurementNoise
+		}
+	default:
+		return errors.New("smoothing must be one of: none, one-euro, kalman")
+	}
+
+	if p.MaxGap == 0 {
+		p.MaxGap = defaultMaxGap
+	}
+	if p.MaxGap > maxFilterGap {
+		return errors.New("maxGap must not exceed 5 seconds")
+	}
+	if *p.MinVisibility > 1 {
+		return errors.New("minVisibility must be between 0 and 1")
+	}
+	return nil
+}
+
+// FilterFrames возвращает обработанную копию кадров; исходные кадры не меняются.
+// Для каждого сустава по очереди выполняются отбраковка выбросов по скорости,
+// линейная интерполяция коротких пропусков и сглаживание.
+// Параметры должны быть нормализованы NormalizeFilterParams.
+func FilterFrames(frames []models.PoseFrame, params models.PoseFilterParams) ([]models.PoseFrame, FilterReport) {
+	result := make([]models.PoseFrame, len(frames))
+	jointCount := 0
+	for i, frame := range frames {
+		result[i] = models.PoseFrame{Time: frame.Time, Joints: append([]models.Joint(nil), frame.Joints...)}
+		jointCount = max(jointCount, len(frame.Joints))
+	}
+
+	maxVelocity, minVisibility := defaultMaxVelocity, MinVisibility
+	if params.MaxVelocity != nil {
+		maxVelocity = *params.MaxVelocity
+	}
+	if params.MinVisibility != nil {
+		minVisibility = *params.MinVisibility
+	}
+
+	report := FilterReport{Frames: len(frames)}
+	for j := 0; j < jointCount; j++ {
+		track := jointTrack{frames: result, joint: j, minVisibility: minVisibility}
+		report.OutliersRemoved += track.rejectOutliers(maxVelocity, params.MaxGap)
+		report.GapsFilled += track.fillGaps(params.MaxGap)
+		report.SamplesSmoothed += track.smooth(params)
+	}
+	return result, report
+}
+
+// jointTrack - траектория одного сустава в кадрах
+type jointTrack struct {
+	frames        []models.PoseFrame
+	joint         int
+	minVisibility float64
+}
+
+func (t *jointTrack) at(i int) *models.Joint {
+	if t.joint >= len(t.frames[i].Joints) {
+		return nil
+	}
+	return &t.frames[i].Joints[t.joint]
+}
+
+func (t *jointTrack) valid(i int) bool {
+	joint := t.at(i)
+	return joint != nil && joint.Visibility >= t.minVisibility
+}
+
+// rejectOutliers помечает пропущенными точки, до которых сустав должен был бы
+// двигаться быстрее maxVelocity. После долгого пропуска скорость не проверяется.
+func (t *jointTrack) rejectOutliers(maxVelocity, maxGap float64) int {
+	if maxVelocity <= 0 {
+		return 0
+	}
+	resetAfter := math.Max(maxGap, 0.5)
+
+	removed := 0
+	last := -1
+	for i := range t.frames {
+		if !t.valid(i) {
+			continue
+		}
+		if last >= 0 {
+			dt := t.frames[i].Time - t.frames[last].Time
+			a, b := t.at(last), t.at(i)
+			if dt > 0 && dt <= resetAfter && math.Hypot(b.X-a.X, b.Y-a.Y)/dt > maxVelocity {
+				b.Visibility = 0
+				removed++
+				continue
+			}
+		}
+		last = i
+	}
+	return removed
+}
+
+// fillGaps линейно интерполирует пропуски не длиннее maxGap секунд между видимыми точками
+func (t *jointTrack) fillGaps(maxGap float64) int {
+	filled := 0
+	last := -1
+	for i := range t.frames {
+		if !t.valid(i) {
+			continue
+		}
+		if last >= 0 && i-last > 1 && t.frames[i].Time-t.frames[last].Time <= maxGap {
+			a, b := *t.at(last), *t.at(i)
+			span := t.frames[i].Time - t.frames[last].Time
+			for k := last + 1; k < i; k++ {
+				joint := t.at(k)
+				if joint == nil {
+					continue
+				}
+				ratio := (t.frames[k].Time - t.frames[last].Time) / span
+				joint.X = a.X + (b.X-a.X)*ratio
+				joint.Y = a.Y + (b.Y-a.Y)*ratio
+				joint.Z = a.Z + (b.Z-a.Z)*ratio
+				joint.Visibility = math.Min(a.Visibility, b.Visibility)
+				filled++
+			}
+		}
+		last = i
+	}
+	return filled
+}
+
+// smooth сглаживает видимые точки. Состояние фильтра сбрасывается после пропуска,
+// который не удалось заполнить, чтобы не тянуть сустав через весь разрыв.
+func (t *jointTrack) smooth(params models.PoseFilterParams) int {
+	if params.Smoothing == models.SmoothingNone {
+		return 0
+	}
+	resetAfter := math.Max(params.MaxGap, 0.5)
+
+	var filters [3]scalarFilter
+	smoothed := 0
+	last := -1
+	for i := range t.frames {
+		if !t.valid(i) {
+			continue
+		}
+		if last < 0 || t.frames[i].Time-t.frames[last].Time > resetAfter {
+			for c := range filters {
+				filters[c] = newScalarFilter(params)
+			}
+		}
+
+		joint := t.at(i)
+		time := t.frames[i].Time
+		joint.X = filters[0].filter(joint.X, time)
+		joint.Y = filters[1].filter(joint.Y, time)
+		joint.Z = filters[2].filter(joint.Z, time)
+		smoothed++
+		last = i
+	}
+	return smoothed
+}
+
+// scalarFilter сглаживает одну координату во времени
+type scalarFilter interface {
+	filter(value, time float64) float64
+}
+
+func newScalarFilter(params models.PoseFilterParams) scalarFilter {
+	if params.Smoothing == models.SmoothingKalman {
+		return &kalmanFilter{q: params.ProcessNoise, r: params.MeasurementNoise}
+	}
+	return &oneEuroFilter{minCutoff: params.MinCutoff, beta: params.Beta, dCutoff: params.DCutoff}
+}
+
+// oneEuroFilter - адаптивный фильтр нижних частот (Casiez et al., 2012): при
+// медленном движении сильно сглаживает дрожание, при быстром уменьшает задержку
+type oneEuroFilter struct {
+	minCutoff, beta, dCutoff float64
+
+	initialized bool
+	prevValue   float64
+	prevDeriv   float64
+	prevTime    float64
+}
+
+func smoothingFactor(cutoff, dt float64) float64 {
+	tau := 1 / (2 * math.Pi * cutoff)
+	return 1 / (1 + tau/dt)
+}
+
+func (f *oneEuroFilter) filter(value, time float64) float64 {
+	if !f.initialized {
+		f.initialized = true
+		f.prevValue, f.prevTime = value, time
+		return value
+	}
+	dt := time - f.prevTime
+	if dt <= 0 {
+		return f.prevValue
+	}
+
+	deriv := (value - f.prevValue) / dt
+	alphaD := smoothingFactor(f.dCutoff, dt)
+	deriv = f.prevDeriv + alphaD*(deriv-f.prevDeriv)
+
+	cutoff := f.minCutoff + f.beta*math.Abs(deriv)
+	alpha := smoothingFactor(cutoff, dt)
+	filtered := f.prevValue + alpha*(value-f.prevValue)
+
+	f.prevValue, f.prevDeriv, f.prevTime = filtered, deriv, time
+	return filtered
+}
+
+// kalmanFilter - фильтр Калмана с моделью постоянной скорости.
+// q - спектральная плотность ускорения, r - дисперсия измерения.
+type kalmanFilter struct {
+	q, r float64
+
+	initialized bool
+	pos, vel    float64
+	p           [2][2]float64
+	prevTime    float64
+}
+
+func (f *kalmanFilter) filter(value, time float64) float64 {
+	if !f.initialized {
+		f.initialized = true
+		f.pos, f.vel, f.prevTime = value, 0, time
+		f.p = [2][2]float64{{f.r, 0}, {0, 1}}
+		return value
+	}
+	dt := time - f.prevTime
+	if dt <= 0 {
+		return f.pos
+	}
+	f.prevTime = time
+
+	// Прогноз
+	f.pos += f.vel * dt
+	p := f.p
+	dt2, dt3, dt4 := dt*dt, dt*dt*dt, dt*dt*dt*dt
+	f.p[0][0] = p[0][0] + dt*(p[1][0]+p[0][1]) + dt2*p[1][1] + f.q*dt4/4
+	f.p[0][1] = p[0][1] + dt*p[1][1] + f.q*dt3/2
+	f.p[1][0] = p[1][0] + dt*p[1][1] + f.q*dt3/2
+	f.p[1][1] = p[1][1] + f.q*dt2
+
+	// Коррекция по измерению позиции
+	s := f.p[0][0] + f.r
+	k0, k1 := f.p[0][0]/s, f.p[1][0]/s
+	residual := value - f.pos
+	f.pos += k0 * residual
+	f.vel += k1 * residual
+
+	p = f.p
+	f.p[0][0] = (1 - k0) * p[0][0]
+	f.p[0][1] = (1 - k0) * p[0][1]
+	f.p[1][0] = p[1][0] - k1*p[0][0]
+	f.p[1][1] = p[1][1] - k1*p[0][1]
+
+	return f.pos
+}
@@ -0,0 +1,115 @@
+package poseanalysis
+
+import (
+	"math"
+
+	"github.com/kktjss/dance-flow/models"
+)
+
+// TrajectoryPoint - положение танцора на сцене в момент времени
+type TrajectoryPoint struct {
+	Time float64 `json:"time"`
+	X    float64 `json:"x"`
+	Y    float64 `json:"y"`
+}
+
+// Суставы, по которым определяется точка опоры танцора: сначала стопы,
+// если их не видно - бёдра
+var anchorJointPairs = [][2]string{
+	{"left_ankle", "right_ankle"},
+	{"left_hip", "right_hip"},
+}
+
+// StagePosition возвращает точку опоры танцора в нормализованных координатах кадра.
+// Берётся середина видимой пары суставов или единственный видимый сустав пары.
+func StagePosition(joints []models.Joint, skeleton *models.Skeleton) (float64, float64, bool) {
+	for _, pair := range anchorJointPairs {
+		var x, y float64
+		count := 0
+		for _, name := range pair {
+			joint, ok := FindJoint(joints, skeleton, name)
+			if !ok || joint.Visibility < MinVisibility {
+				continue
+			}
+			x += joint.X
+			y += joint.Y
+			count++
+		}
+		if count > 0 {
+			return x / float64(count), y / float64(count), true
+		}
+	}
+	return 0, 0, false
+}
+
+// Trajectory строит путь танцора по последовательности поз. Кадры, где
+// танцора не видно, пропускаются.
+func Trajectory(sequence *models.PoseSequence) ([]TrajectoryPoint, error) {
+	skeleton, err := models.GetSkeleton(sequence.Skeleton)
+	if err != nil {
+		return nil, err
+	}
+
+	points := make([]TrajectoryPoint, 0, len(sequence.Frames))
+	for _, frame := range sequence.Frames {
+		if x, y, ok := StagePosition(frame.Joints, skeleton); ok {
+			points = append(points, TrajectoryPoint{Time: frame.Time, X: x, Y: y})
+		}
+	}
+	return points, nil
+}
+
+// SimplifyPath прореживает путь алгоритмом Рамера-Дугласа-Пекера. Отклонение
+// точки считается от положения на отрезке в тот же момент времени, поэтому
+// сохраняются не только повороты, но и остановки и смены скорости.
+// Первая и последняя точки сохраняются всегда.
+func SimplifyPath(points []TrajectoryPoint, tolerance float64) []TrajectoryPoint {
+	if len(points) < 3 {
+		result := make([]TrajectoryPoint, len(points))
+		copy(result, points)
+		return result
+	}
+
+	keep := make([]bool, len(points))
+	keep[0], keep[len(points)-1] = true, true
+
+	// Обходим отрезки через стек, чтобы длинные треки не упирались в глубину рекурсии
+	stack := [][2]int{{0, len(points) - 1}}
+	for len(stack) > 0 {
+		segment := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		first, last := segment[0], segment[1]
+
+		index, maxDistance := -1, tolerance
+		for i := first + 1; i < last; i++ {
+			if d := synchronizedDistance(points[i], points[first], points[last]); d > maxDistance {
+				index, maxDistance = i, d
+			}
+		}
+		if index < 0 {
+			continue
+		}
+		keep[index] = true
+		stack = append(stack, [2]int{first, index}, [2]int{index, last})
+	}
+
+	result := make([]TrajectoryPoint, 0)
+	for i, point := range points {
+		if keep[i] {
+			result = append(result, point)
+		}
+	}
+	return result
+}
+
+// synchronizedDistance - расстояние от точки до положения, интерполированного
+// между a и b на момент времени точки
+func synchronizedDistance(p, a, b TrajectoryPoint) float64 {
+	t := 0.0
+	if span := b.Time - a.Time; span > 0 {
+		t = (p.Time - a.Time) / span
+	}
+	x := a.X + (b.X-a.X)*t
+	y := a.Y + (b.Y-a.Y)*t
+	return math.Hypot(p.X-x, p.Y-y)
+}
@@ -0,0 +1,226 @@
+// Package posetrack хранит последовательности поз компактно: кадры квантуются,
+// кодируются разностями относительно предыдущего кадра и сжимаются DEFLATE.
+package posetrack
+
+import (
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+
+	"github.com/kktjss/dance-flow/models"
+)
+
+// Точность квантования
+const (
+	timeScale       = 1000.0  // миллисекунды
+	coordScale      = 10000.0 // 1e-4 от размера кадра
+	visibilityScale = 1000.0
+)
+
+var magic = []byte("PTK1")
+
+// ErrCorrupted возвращается при повреждённых данных блока
+var ErrCorrupted = errors.New("corrupted pose track data")
+
+// Encode сжимает кадры одного трека. Все кадры должны иметь одинаковое число суставов.
+func Encode(frames []models.PoseFrame) ([]byte, error) {
+	jointCount := 0
+	if len(frames) > 0 {
+		jointCount = len(frames[0].Joints)
+	}
+
+	var buf bytes.Buffer
+	buf.Write(magic)
+
+	zw, err := flate.NewWriter(&buf, flate.BestCompression)
+	if err != nil {
+		return nil, err
+	}
+	w := bufio.NewWriter(zw)
+
+	scratch := make([]byte, binary.MaxVarintLen64)
+	writeInt := func(v int64) {
+		n := binary.PutVarint(scratch, v)
+		w.Write(scratch[:n])
+	}
+
+	writeInt(int64(jointCount))
+	writeInt(int64(len(frames)))
+
+	prev := make([]int64, 1+jointCount*4)
+	current := make([]int64, len(prev))
+	for _, frame := range frames {
+		if len(frame.Joints) != jointCount {
+			return nil, fmt.Errorf("frame at %.3fs has %d joints, expected %d", frame.Time, len(frame.Joints), jointCount)
+		}
+
+		current[0] = quantize(frame.Time, timeScale)
+		for i, joint := range frame.Joints {
+			base := 1 + i*4
+			current[base] = quantize(joint.X, coordScale)
+			current[base+1] = quantize(joint.Y, coordScale)
+			current[base+2] = quantize(joint.Z, coordScale)
+			current[base+3] = quantize(joint.Visibility, visibilityScale)
+		}
+
+		for i := range current {
+			writeInt(current[i] - prev[i])
+		}
+		prev, current = current, prev
+	}
+
+	if err := w.Flush(); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Decode распаковывает кадры и восстанавливает имена суставов по скелету
+func Decode(data []byte, skeleton *models.Skeleton) ([]models.PoseFrame, error) {
+	if len(data) < len(magic) || !bytes.Equal(data[:len(magic)], magic) {
+		return nil, ErrCorrupted
+	}
+
+	r := bufio.NewReader(flate.NewReader(bytes.NewReader(data[len(magic):])))
+	readInt := func() (int64, error) {
+		v, err := binary.ReadVarint(r)
+		if err == io.EOF {
+			return 0, ErrCorrupted
+		}
+		return v, err
+	}
+
+	jointCount, err := readInt()
+	if err != nil {
+		return nil, err
+	}
+	frameCount, err := readInt()
+	if err != nil {
+		return nil, err
+	}
+	if jointCount < 0 || int(jointCount) > len(skeleton.Joints) || frameCount < 0 {
+		return nil, ErrCorrupted
+	}
+
+	frames := make([]models.PoseFrame, 0, frameCount)
+	values := make([]int64, 1+jointCount*4)
+	for f := int64(0); f < frameCount; f++ {
+		for i := range values {
+			delta, err := readInt()
+			if err != nil {
+				return nil, err
+			}
+			values[i] += delta
+		}
+
+		frame := models.PoseFrame{
+			Time:   float64(values[0]) / timeScale,
+			Joints: make([]models.Joint, jointCount),
+		}
+		for i := range frame.Joints {
+			base := 1 + i*4
+			frame.Joints[i] = models.Joint{
+				Name:       skeleton.Joints[i],
+				X:          float64(values[base]) / coordScale,
+				Y:          float64(values[base+1]) / coordScale,
+				Z:          float64(values[base+2]) / coordScale,
+				Visibility: float64(values[base+3]) / visibilityScale,
+			}
+		}
+		frames = append(frames, frame)
+	}
+
+	return frames, nil
+}
+
+func quantize(v, scale float64) int64 {
+	return int64(math.Round(v * scale))
+}
+
+// TimeKey возвращает время кадра с точностью хранения, чтобы сравнивать кадры
+func TimeKey(t float64) int64 {
+	return quantize(t, timeScale)
+}
+
+// Merge объединяет отсортированные кадры; при совпадении времени побеждает новый кадр
+func Merge(existing, incoming []models.PoseFrame) []models.PoseFrame {
+	byTime := make(map[int64]models.PoseFrame, len(existing)+len(incoming))
+	for _, frame := range existing {
+		byTime[TimeKey(frame.Time)] = frame
+	}
+	for _, frame := range incoming {
+		byTime[TimeKey(frame.Time)] = frame
+	}
+
+	merged := make([]models.PoseFrame, 0, len(byTime))
+	for _, frame := range byTime {
+		merged = append(merged, frame)
+	}
+	SortFrames(merged)
+	return merged
+}
+
+// SortFrames сортирует кадры по времени
+func SortFrames(frames []models.PoseFrame) {
+	sort.SliceStable(frames, func(i, j int) bool {
+		return frames[i].Time < frames[j].Time
+	})
+}
+
+// Split делит кадры на блоки не больше size кадров
+func Split(frames []models.PoseFrame, size int) [][]models.PoseFrame {
+	var chunks [][]models.PoseFrame
+	for start := 0; start < len(frames); start += size {
+		end := start + size
+		if end > len(frames) {
+			end = len(frames)
+		}
+		chunks = append(chunks, frames[start:end])
+	}
+	return chunks
+}
+
+// Downsample прореживает кадры до maxFrames, выбирая ближайший кадр к центру
+// каждого равного по времени интервала. Первый и последний кадры сохраняются.
+func Downsample(frames []models.PoseFrame, maxFrames int) []models.PoseFrame {
+	if maxFrames <= 0 || len(frames) <= maxFrames {
+		return frames
+	}
+	if maxFrames == 1 {
+		return frames[:1]
+	}
+
+	start := frames[0].Time
+	end := frames[len(frames)-1].Time
+	step := (end - start) / float64(maxFrames-1)
+
+	result := make([]models.PoseFrame, 0, maxFrames)
+	next := 0
+	for i := 0; i < maxFrames; i++ {
+		target := start + step*float64(i)
+		// Двигаемся вперёд, пока следующий кадр ближе к цели
+		for next+1 < len(frames) && math.Abs(frames[next+1].Time-target) <= math.Abs(frames[next].Time-target) {
+			next++
+		}
+		if len(result) == 0 || frames[next].Time != result[len(result)-1].Time {
+			result = append(result, frames[next])
+		}
+	}
+	return result
+}
+
+// Range возвращает кадры в интервале [from, to]
+func Range(frames []models.PoseFrame, from, to float64) []models.PoseFrame {
+	lo := sort.Search(len(frames), func(i int) bool { return frames[i].Time >= from })
+	hi := sort.Search(len(frames), func(i int) bool { return frames[i].Time > to })
+	return frames[lo:hi]
+}
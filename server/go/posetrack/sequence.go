@@ -0,0 +1,112 @@
+package posetrack
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+
+	"github.com/kktjss/dance-flow/config"
+	"github.com/kktjss/dance-flow/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Ошибки загрузки последовательности поз
+var (
+	ErrNoPoseData     = errors.New("no pose data found")
+	ErrInvalidTrackID = errors.New("invalid track ID format")
+)
+
+// Source указывает, откуда брать позы проекта: из трека (TrackID)
+// или из ключевых кадров проекта (позы танцора PersonIndex)
+type Source struct {
+	TrackID     string `json:"trackId,omitempty"`
+	PersonIndex int    `json:"personIndex"`
+}
+
+// LoadSequence загружает позы проекта из трека или ключевых кадров
+func LoadSequence(ctx context.Context, projectID primitive.ObjectID, source Source) (*models.PoseSequence, error) {
+	if source.TrackID != "" {
+		trackID, err := primitive.ObjectIDFromHex(source.TrackID)
+		if err != nil {
+			return nil, ErrInvalidTrackID
+		}
+		return LoadTrackSequence(ctx, projectID, trackID)
+	}
+	return LoadKeyframeSequence(ctx, projectID, source.PersonIndex)
+}
+
+// LoadTrackSequence загружает все кадры трека проекта
+func LoadTrackSequence(ctx context.Context, projectID, trackID primitive.ObjectID) (*models.PoseSequence, error) {
+	var track models.PoseTrack
+	err := config.PoseTracksCollection.FindOne(ctx, bson.M{"_id": trackID, "projectId": projectID}).Decode(&track)
+	if err == mongo.ErrNoDocuments {
+		return nil, fmt.Errorf("pose track not found: %w", ErrNoPoseData)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	frames, err := ReadFrames(ctx, &track, 0, math.MaxFloat64)
+	if err != nil {
+		return nil, err
+	}
+	if len(frames) == 0 {
+		return nil, ErrNoPoseData
+	}
+
+	return &models.PoseSequence{
+		Skeleton:    track.Skeleton,
+		FrameWidth:  track.FrameWidth,
+		FrameHeight: track.FrameHeight,
+		Frames:      frames,
+	}, nil
+}
+
+// LoadKeyframeSequence собирает позы танцора из ключевых кадров проекта по их времени.
+// Все позы приводятся к скелету первого ключевого кадра.
+func LoadKeyframeSequence(ctx context.Context, projectID primitive.ObjectID, personIndex int) (*models.PoseSequence, error) {
+	opts := options.Find().
+		SetSort(bson.M{"timestamp": 1}).
+		SetProjection(bson.M{"timestamp": 1, "poseData": 1})
+	cursor, err := config.KeyframesCollection.Find(ctx, bson.M{"projectId": projectID}, opts)
+	if err != nil {
+		return nil, err
+	}
+	var keyframes []models.Keyframe
+	if err := cursor.All(ctx, &keyframes); err != nil {
+		return nil, err
+	}
+
+	sequence := &models.PoseSequence{}
+	for _, keyframe := range keyframes {
+		pd := keyframe.PoseData
+		if pd == nil || len(pd.Poses) == 0 {
+			continue
+		}
+		if sequence.Skeleton == "" {
+			sequence.Skeleton = pd.Skeleton
+			sequence.FrameWidth = pd.FrameWidth
+			sequence.FrameHeight = pd.FrameHeight
+		}
+		if pd.Skeleton != sequence.Skeleton {
+			if pd, err = pd.ConvertSkeleton(sequence.Skeleton); err != nil {
+				return nil, err
+			}
+		}
+
+		if pose, ok := pd.Pose(personIndex); ok {
+			sequence.Frames = append(sequence.Frames, models.PoseFrame{Time: keyframe.Timestamp, Joints: pose.Joints})
+		}
+	}
+
+	if len(sequence.Frames) == 0 {
+		return nil, ErrNoPoseData
+	}
+	// Ключевые кадры с одинаковым временем объединяются, как и в треках
+	sequence.Frames = Merge(nil, sequence.Frames)
+	return sequence, nil
+}
@@ -0,0 +1,289 @@
+package posetrack
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/kktjss/dance-flow/config"
+	"github.com/kktjss/dance-flow/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ChunkSize - максимальное число кадров в одном блоке (около 20 секунд при 30 fps)
+const ChunkSize = 600
+
+// Запись кадров в трек идёт под блокировкой трека: поля appendLock и
+// appendLockedUntil документа трека. Блокировка истекает сама, если сервер
+// упал, не освободив её.
+const (
+	appendLockTTL   = 30 * time.Second
+	appendLockRetry = 50 * time.Millisecond
+)
+
+// ErrTrackNotFound - трек удалён
+var ErrTrackNotFound = errors.New("pose track not found")
+
+// AppendFrames записывает кадры в трек. Кадры с уже существующим временем заменяются.
+// Перекрывающиеся блоки перепаковываются, остальные не затрагиваются.
+// После записи track содержит сохранённый документ трека с новой статистикой.
+func AppendFrames(ctx context.Context, track *models.PoseTrack, frames []models.PoseFrame) error {
+	if len(frames) == 0 {
+		return nil
+	}
+
+	incoming := make([]models.PoseFrame, len(frames))
+	copy(incoming, frames)
+	SortFrames(incoming)
+	from := incoming[0].Time
+	to := incoming[len(incoming)-1].Time
+
+	skeleton, err := models.GetSkeleton(track.Skeleton)
+	if err != nil {
+		return err
+	}
+
+	// Параллельная запись прочитала бы те же блоки и вставила свои копии
+	unlock, err := lockTrack(ctx, track.ID)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	// Берём блоки, пересекающиеся с новым интервалом
+	cursor, err := config.PoseChunksCollection.Find(ctx, bson.M{
+		"trackId":   track.ID,
+		"startTime": bson.M{"$lte": to},
+		"endTime":   bson.M{"$gte": from},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to load chunks: %w", err)
+	}
+	var chunks []models.PoseTrackChunk
+	if err := cursor.All(ctx, &chunks); err != nil {
+		return fmt.Errorf("failed to decode chunks: %w", err)
+	}
+
+	// и последний блок перед ним, если он неполный, чтобы дописывание небольшими
+	// пакетами не плодило мелкие блоки. Более ранние блоки не трогаем: иначе
+	// перепакованный блок перекрыл бы оставленные между ними полные блоки.
+	var previous models.PoseTrackChunk
+	err = config.PoseChunksCollection.FindOne(ctx,
+		bson.M{"trackId": track.ID, "endTime": bson.M{"$lt": from}},
+		options.FindOne().SetSort(bson.M{"endTime": -1}),
+	).Decode(&previous)
+	if err != nil && err != mongo.ErrNoDocuments {
+		return fmt.Errorf("failed to load previous chunk: %w", err)
+	}
+	if err == nil && previous.FrameCount < ChunkSize {
+		chunks = append(chunks, previous)
+	}
+
+	var existing []models.PoseFrame
+	oldIDs := make([]primitive.ObjectID, 0, len(chunks))
+	for _, chunk := range chunks {
+		decoded, err := Decode(chunk.Data, skeleton)
+		if err != nil {
+			return fmt.Errorf("chunk %s: %w", chunk.ID.Hex(), err)
+		}
+		existing = append(existing, decoded...)
+		oldIDs = append(oldIDs, chunk.ID)
+	}
+	SortFrames(existing)
+
+	merged := Merge(existing, incoming)
+	docs := make([]interface{}, 0, len(merged)/ChunkSize+1)
+	for _, part := range Split(merged, ChunkSize) {
+		data, err := Encode(part)
+		if err != nil {
+			return err
+		}
+		docs = append(docs, models.PoseTrackChunk{
+			ID:         primitive.NewObjectID(),
+			TrackID:    track.ID,
+			StartTime:  part[0].Time,
+			EndTime:    part[len(part)-1].Time,
+			FrameCount: len(part),
+			Data:       data,
+		})
+	}
+
+	// Сначала вставляем новые блоки, затем удаляем старые: при сбое между шагами
+	// кадры дублируются, но не теряются, а Merge при чтении убирает дубликаты
+	if _, err := config.PoseChunksCollection.InsertMany(ctx, docs); err != nil {
+		return fmt.Errorf("failed to insert chunks: %w", err)
+	}
+	if len(oldIDs) > 0 {
+		if _, err := config.PoseChunksCollection.DeleteMany(ctx, bson.M{"_id": bson.M{"$in": oldIDs}}); err != nil {
+			return fmt.Errorf("failed to delete replaced chunks: %w", err)
+		}
+	}
+
+	return refreshTrackStats(ctx, track)
+}
+
+// lockTrack захватывает трек для записи кадров условным обновлением: оно
+// проходит, только если трек свободен или прежняя блокировка истекла. Пока
+// трек занят, попытки повторяются до отмены ctx. Возвращает функцию,
+// освобождающую блокировку.
+func lockTrack(ctx context.Context, trackID primitive.ObjectID) (func(), error) {
+	token := primitive.NewObjectID()
+	for {
+		now := time.Now()
+		result, err := config.PoseTracksCollection.UpdateOne(ctx, bson.M{
+			"_id": trackID,
+			"$or": []bson.M{
+				{"appendLock": bson.M{"$exists": false}},
+				{"appendLockedUntil": bson.M{"$lt": now}},
+			},
+		}, bson.M{"$set": bson.M{"appendLock": token, "appendLockedUntil": now.Add(appendLockTTL)}})
+		if err != nil {
+			return nil, fmt.Errorf("failed to lock track: %w", err)
+		}
+		if result.MatchedCount > 0 {
+			break
+		}
+
+		count, err := config.PoseTracksCollection.CountDocuments(ctx, bson.M{"_id": trackID}, options.Count().SetLimit(1))
+		if err != nil {
+			return nil, fmt.Errorf("failed to lock track: %w", err)
+		}
+		if count == 0 {
+			return nil, ErrTrackNotFound
+		}
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("failed to lock track: %w", ctx.Err())
+		case <-time.After(appendLockRetry):
+		}
+	}
+
+	return func() {
+		// Освобождаем и после отмены ctx запроса, иначе трек ждал бы истечения блокировки
+		releaseCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if _, err := config.PoseTracksCollection.UpdateOne(releaseCtx,
+			bson.M{"_id": trackID, "appendLock": token},
+			bson.M{"$unset": bson.M{"appendLock": "", "appendLockedUntil": ""}},
+		); err != nil {
+			config.LogError("POSE_TRACKS", fmt.Errorf("failed to unlock track %s: %w", trackID.Hex(), err))
+		}
+	}, nil
+}
+
+// ReadFrames возвращает кадры трека в интервале [from, to]
+func ReadFrames(ctx context.Context, track *models.PoseTrack, from, to float64) ([]models.PoseFrame, error) {
+	skeleton, err := models.GetSkeleton(track.Skeleton)
+	if err != nil {
+		return nil, err
+	}
+
+	filter := bson.M{
+		"trackId":   track.ID,
+		"startTime": bson.M{"$lte": to},
+		"endTime":   bson.M{"$gte": from},
+	}
+	opts := options.Find().SetSort(bson.M{"startTime": 1})
+	cursor, err := config.PoseChunksCollection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load chunks: %w", err)
+	}
+	var chunks []models.PoseTrackChunk
+	if err := cursor.All(ctx, &chunks); err != nil {
+		return nil, fmt.Errorf("failed to decode chunks: %w", err)
+	}
+
+	var frames []models.PoseFrame
+	for _, chunk := range chunks {
+		decoded, err := Decode(chunk.Data, skeleton)
+		if err != nil {
+			return nil, fmt.Errorf("chunk %s: %w", chunk.ID.Hex(), err)
+		}
+		frames = Merge(frames, Range(decoded, from, to))
+	}
+	if frames == nil {
+		frames = []models.PoseFrame{}
+	}
+	return frames, nil
+}
+
+// DeleteTracks удаляет треки и их блоки
+func DeleteTracks(ctx context.Context, trackIDs []primitive.ObjectID) error {
+	if len(trackIDs) == 0 {
+		return nil
+	}
+	if _, err := config.PoseChunksCollection.DeleteMany(ctx, bson.M{"trackId": bson.M{"$in": trackIDs}}); err != nil {
+		return err
+	}
+	_, err := config.PoseTracksCollection.DeleteMany(ctx, bson.M{"_id": bson.M{"$in": trackIDs}})
+	return err
+}
+
+// DeleteProjectTracks удаляет все треки проекта
+func DeleteProjectTracks(ctx context.Context, projectID primitive.ObjectID) error {
+	cursor, err := config.PoseTracksCollection.Find(ctx, bson.M{"projectId": projectID},
+		options.Find().SetProjection(bson.M{"_id": 1}))
+	if err != nil {
+		return err
+	}
+	var tracks []models.PoseTrack
+	if err := cursor.All(ctx, &tracks); err != nil {
+		return err
+	}
+
+	ids := make([]primitive.ObjectID, 0, len(tracks))
+	for _, track := range tracks {
+		ids = append(ids, track.ID)
+	}
+	return DeleteTracks(ctx, ids)
+}
+
+// refreshTrackStats пересчитывает число кадров и границы трека по блокам
+func refreshTrackStats(ctx context.Context, track *models.PoseTrack) error {
+	pipeline := []bson.M{
+		{"$match": bson.M{"trackId": track.ID}},
+		{"$group": bson.M{
+			"_id":        nil,
+			"frameCount": bson.M{"$sum": "$frameCount"},
+			"startTime":  bson.M{"$min": "$startTime"},
+			"endTime":    bson.M{"$max": "$endTime"},
+		}},
+	}
+	cursor, err := config.PoseChunksCollection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return err
+	}
+	var stats []struct {
+		FrameCount int     `bson:"frameCount"`
+		StartTime  float64 `bson:"startTime"`
+		EndTime    float64 `bson:"endTime"`
+	}
+	if err := cursor.All(ctx, &stats); err != nil {
+		return err
+	}
+
+	set := bson.M{"frameCount": 0, "startTime": 0.0, "endTime": 0.0, "updatedAt": time.Now()}
+	if len(stats) > 0 {
+		set["frameCount"] = stats[0].FrameCount
+		set["startTime"] = stats[0].StartTime
+		set["endTime"] = stats[0].EndTime
+	}
+
+	// Возвращаем сохранённый документ: вызывающий код отдаёт его клиенту
+	var updated models.PoseTrack
+	err = config.PoseTracksCollection.FindOneAndUpdate(ctx, bson.M{"_id": track.ID}, bson.M{"$set": set},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&updated)
+	if err == mongo.ErrNoDocuments {
+		return ErrTrackNotFound
+	}
+	if err != nil {
+		return err
+	}
+	*track = updated
+	return nil
+}
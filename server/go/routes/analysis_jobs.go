@@ -0,0 +1,295 @@
+package routes
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kktjss/dance-flow/analyzer"
+	"github.com/kktjss/dance-flow/config"
+	"github.com/kktjss/dance-flow/jobs"
+	"github.com/kktjss/dance-flow/middleware"
+	"github.com/kktjss/dance-flow/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Частота выборки кадров для анализа (кадров в секунду)
+const (
+	defaultSampleRate = 5.0
+	maxSampleRate     = 30.0
+)
+
+// analysisRunner выполняет фоновые задачи анализа видео
+var analysisRunner *jobs.Runner
+
+// Регистрирует маршруты фонового анализа видео
+func RegisterAnalysisJobRoutes(router *gin.RouterGroup, cfg *config.Config) {
+	var a analyzer.Analyzer = getAnalyzerClient(cfg)
+	if cfg.UseFakeAnalyzer {
+		a = &analyzer.Fake{}
+	}
+	analysisRunner = jobs.NewRunner(jobs.MongoStore{}, a, jobs.NewFFmpegSource(), jobs.TrackSink{}, cfg.AnalysisWorkers)
+	analysisRunner.OnFinish = publishAnalysisJobFinished
+
+	// Продолжаем задачи, прерванные перезапуском сервера
+	if config.DB != nil {
+		go func() {
+			ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+			defer cancel()
+			if err := analysisRunner.Recover(ctx); err != nil {
+				config.LogError("ANALYSIS_JOB", fmt.Errorf("failed to recover jobs: %w", err))
+			}
+		}()
+	}
+
+	analysisJobs := router.Group("/projects/:id/analysis-jobs")
+	analysisJobs.Use(middleware.JWTMiddleware(cfg))
+	{
+		analysisJobs.GET("", middleware.CheckProjectIsPrivate(), getAnalysisJobs)
+		analysisJobs.POST("", middleware.CheckProjectAccess(), createAnalysisJob)
+		analysisJobs.GET("/:jobId", middleware.CheckProjectIsPrivate(), getAnalysisJob)
+		analysisJobs.POST("/:jobId/cancel", middleware.CheckProjectAccess(), cancelAnalysisJob)
+		analysisJobs.POST("/:jobId/retry", middleware.CheckProjectAccess(), retryAnalysisJob)
+	}
+}
+
+// StopAnalysisJobs останавливает воркеров при остановке сервера. Выполнявшиеся
+// задачи возвращаются в очередь и продолжатся после перезапуска.
+func StopAnalysisJobs() {
+	if analysisRunner != nil {
+		analysisRunner.Stop()
+	}
+}
+
+// Запускает анализ видео. Видео передаётся файлом в поле "video" (multipart)
+// или ссылкой videoUrl на ранее загруженный файл; по умолчанию берётся видео проекта.
+func createAnalysisJob(c *gin.Context) {
+	projectID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid project ID format"})
+		return
+	}
+
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	var input models.AnalysisJobCreateInput
+	if err := c.ShouldBind(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if input.SampleRate == 0 {
+		input.SampleRate = defaultSampleRate
+	}
+	if input.SampleRate < 0 || input.SampleRate > maxSampleRate {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("sampleRate must be between 0 and %.0f frames per second", maxSampleRate)})
+		return
+	}
+	if input.PersonIndex < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "personIndex must not be negative"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// Определяем видео для анализа
+	if header, err := c.FormFile("video"); err == nil {
+		input.VideoURL, err = saveVideoFile(header)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	} else if input.VideoURL == "" {
+		var project models.Project
+		err := config.ProjectsCollection.FindOne(ctx, bson.M{"_id": projectID},
+			options.FindOne().SetProjection(bson.M{"videoUrl": 1})).Decode(&project)
+		if err != nil || project.VideoURL == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Video file or videoUrl is required"})
+			return
+		}
+		input.VideoURL = project.VideoURL
+	}
+
+	videoPath, err := videoPathFromURL(input.VideoURL)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	job := models.AnalysisJob{
+		ID:          primitive.NewObjectID(),
+		ProjectID:   projectID,
+		VideoURL:    input.VideoURL,
+		VideoPath:   videoPath,
+		SampleRate:  input.SampleRate,
+		PersonIndex: input.PersonIndex,
+		CreatedBy:   userID,
+	}
+	if err := analysisRunner.Submit(ctx, &job); err != nil {
+		config.LogError("ANALYSIS_JOB", fmt.Errorf("failed to create job: %w", err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create analysis job"})
+		return
+	}
+
+	log.Printf("[ANALYSIS_JOB] Job %s queued for project %s (%s at %.1f fps)",
+		job.ID.Hex(), projectID.Hex(), job.VideoURL, job.SampleRate)
+	middleware.Audit(c).TargetID = job.ID.Hex()
+	c.JSON(http.StatusAccepted, job)
+}
+
+// Возвращает задачи анализа проекта, новые первыми
+func getAnalysisJobs(c *gin.Context) {
+	projectID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid project ID format"})
+		return
+	}
+
+	filter := bson.M{"projectId": projectID}
+	if status := c.Query("status"); status != "" {
+		filter["status"] = status
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	opts := options.Find().SetSort(bson.M{"createdAt": -1}).SetLimit(100)
+	cursor, err := config.AnalysisJobsCollection.Find(ctx, filter, opts)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get analysis jobs"})
+		return
+	}
+	defer cursor.Close(ctx)
+
+	result := []models.AnalysisJob{}
+	if err := cursor.All(ctx, &result); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to decode analysis jobs"})
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+// Возвращает статус и прогресс задачи
+func getAnalysisJob(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	job, ok := findAnalysisJob(ctx, c)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, job)
+}
+
+// Отменяет задачу в очереди или останавливает выполняющуюся
+func cancelAnalysisJob(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	job, ok := findAnalysisJob(ctx, c)
+	if !ok {
+		return
+	}
+
+	job, err := analysisRunner.Cancel(ctx, job.ID)
+	if err == jobs.ErrJobFinished {
+		c.JSON(http.StatusConflict, gin.H{"error": "Job is already finished", "job": job})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to cancel analysis job"})
+		return
+	}
+
+	c.JSON(http.StatusOK, job)
+}
+
+// Повторно запускает упавшую или отменённую задачу
+func retryAnalysisJob(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	job, ok := findAnalysisJob(ctx, c)
+	if !ok {
+		return
+	}
+
+	job, err := analysisRunner.Retry(ctx, job.ID)
+	if err == jobs.ErrJobNotRetryable {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "job": job})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retry analysis job"})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, job)
+}
+
+// findAnalysisJob загружает задачу и проверяет, что она принадлежит проекту.
+// При ошибке ответ уже отправлен.
+func findAnalysisJob(ctx context.Context, c *gin.Context) (*models.AnalysisJob, bool) {
+	projectID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid project ID format"})
+		return nil, false
+	}
+	jobID, err := primitive.ObjectIDFromHex(c.Param("jobId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid job ID format"})
+		return nil, false
+	}
+
+	job, err := jobs.MongoStore{}.Get(ctx, jobID)
+	if err == jobs.ErrJobNotFound || (err == nil && job.ProjectID != projectID) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Analysis job not found"})
+		return nil, false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get analysis job"})
+		return nil, false
+	}
+
+	return job, true
+}
+
+// publishAnalysisJobFinished сообщает вебхукам проекта о завершении анализа
+func publishAnalysisJobFinished(job *models.AnalysisJob) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var project models.Project
+	err := config.ProjectsCollection.FindOne(ctx, bson.M{"_id": job.ProjectID},
+		options.FindOne().SetProjection(bson.M{"name": 1, "title": 1, "owner": 1, "teamId": 1})).Decode(&project)
+	if err != nil {
+		config.LogError("WEBHOOKS", fmt.Errorf("failed to load project %s: %w", job.ProjectID.Hex(), err))
+		return
+	}
+	data := bson.M{
+		"jobId":           job.ID,
+		"projectId":       job.ProjectID,
+		"status":          job.Status,
+		"framesProcessed": job.FramesProcessed,
+		"posesDetected":   job.PosesDetected,
+		"finishedAt":      job.FinishedAt,
+	}
+	if !job.TrackID.IsZero() {
+		data["trackId"] = job.TrackID
+	}
+	if job.Error != "" {
+		data["error"] = job.Error
+	}
+	publishWebhookEvent(ctx, projectWebhookEvent(models.WebhookAnalysisJobFinished, &project, job.CreatedBy, data))
+}
@@ -0,0 +1,73 @@
+package routes
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kktjss/dance-flow/analyzer"
+	"github.com/kktjss/dance-flow/config"
+)
+
+// Общий клиент серверов анализа для прокси и фоновых задач
+var (
+	analyzerClient     *analyzer.Client
+	analyzerClientOnce sync.Once
+)
+
+// getAnalyzerClient создает клиента при первом обращении и запускает проверку здоровья
+func getAnalyzerClient(cfg *config.Config) *analyzer.Client {
+	analyzerClientOnce.Do(func() {
+		analyzerClient = analyzer.NewClient(analyzer.Options{
+			URLs:             cfg.AnalyzerURLs,
+			Timeout:          cfg.AnalyzerTimeout,
+			MaxConcurrency:   cfg.AnalyzerMaxConcurrency,
+			MaxRetries:       cfg.AnalyzerMaxRetries,
+			HealthInterval:   cfg.AnalyzerHealthInterval,
+			BreakerThreshold: cfg.AnalyzerBreakerThreshold,
+			BreakerCooldown:  cfg.AnalyzerBreakerCooldown,
+		})
+		analyzerClient.Start()
+	})
+	return analyzerClient
+}
+
+// Возвращает состояние серверов анализа
+func getAnalyzerStatus(c *gin.Context) {
+	backends := analyzerClient.Status()
+
+	healthy := 0
+	for _, backend := range backends {
+		if backend.Healthy && backend.Breaker != "open" {
+			healthy++
+		}
+	}
+
+	status := http.StatusOK
+	if healthy == 0 {
+		status = http.StatusServiceUnavailable
+	}
+	c.JSON(status, gin.H{
+		"available": healthy > 0,
+		"backends":  backends,
+	})
+}
+
+// respondAnalyzerUnavailable отвечает 503 с заголовком Retry-After
+func respondAnalyzerUnavailable(c *gin.Context, err *analyzer.UnavailableError) {
+	seconds := int(math.Ceil(err.RetryAfter.Seconds()))
+	if seconds < 1 {
+		seconds = 1
+	}
+	c.Header("Retry-After", strconv.Itoa(seconds))
+	c.JSON(http.StatusServiceUnavailable, gin.H{
+		"message":    "Analyzer is temporarily unavailable",
+		"error":      err.Error(),
+		"retryAfter": seconds,
+	})
+}
+
+// Максимальный размер кадра, принимаемого прокси
+const maxProxyBodySize = 32 << 20
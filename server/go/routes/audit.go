@@ -0,0 +1,341 @@
+package routes
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kktjss/dance-flow/config"
+	"github.com/kktjss/dance-flow/middleware"
+	"github.com/kktjss/dance-flow/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// AuditedRoutes - действия журнала аудита для изменяющих маршрутов API.
+// Каждый новый POST, PUT или DELETE маршрут добавляется сюда или в
+// UnauditedRoutes.
+var AuditedRoutes = map[string]middleware.AuditRoute{
+	"POST /auth/register": {Action: models.AuditUserRegistered, Target: models.AuditTargetUser},
+	"PUT /users/me":       {Action: models.AuditUserUpdated, Target: models.AuditTargetUser},
+	"DELETE /users/me":    {Action: models.AuditUserDeleted, Target: models.AuditTargetUser},
+
+	"POST /projects":        {Action: models.AuditProjectCreated, Target: models.AuditTargetProject},
+	"POST /projects/import": {Action: models.AuditProjectImported, Target: models.AuditTargetProject},
+	"PUT /projects/:id":     {Action: models.AuditProjectUpdated, Target: models.AuditTargetProject},
+	"DELETE /projects/:id":  {Action: models.AuditProjectDeleted, Target: models.AuditTargetProject},
+
+	"POST /direct-keyframes":               {Action: models.AuditKeyframesUpdated, Target: models.AuditTargetKeyframe},
+	"POST /direct-keyframes/:id":           {Action: models.AuditKeyframesUpdated, Target: models.AuditTargetProject, Param: "id"},
+	"PUT /direct-keyframes/:id":            {Action: models.AuditKeyframesUpdated, Target: models.AuditTargetKeyframe, Param: "id"},
+	"DELETE /direct-keyframes/:id":         {Action: models.AuditKeyframesDeleted, Target: models.AuditTargetKeyframe, Param: "id"},
+	"POST /projects/:id/keyframes/extract": {Action: models.AuditKeyframesUpdated, Target: models.AuditTargetProject},
+
+	"PUT /projects/:id/stage":          {Action: models.AuditStageUpdated, Target: models.AuditTargetProject},
+	"PUT /projects/:id/stage/canvas":   {Action: models.AuditStageUpdated, Target: models.AuditTargetProject},
+	"POST /projects/:id/stage/migrate": {Action: models.AuditStageUpdated, Target: models.AuditTargetProject},
+	"PUT /projects/:id/tempo":          {Action: models.AuditTempoUpdated, Target: models.AuditTargetProject},
+	"DELETE /projects/:id/tempo":       {Action: models.AuditTempoCleared, Target: models.AuditTargetProject},
+	"POST /projects/:id/beats/detect":  {Action: models.AuditBeatsDetected, Target: models.AuditTargetProject},
+	"DELETE /projects/:id/beats":       {Action: models.AuditBeatsCleared, Target: models.AuditTargetProject},
+	"PUT /projects/:id/casting":        {Action: models.AuditCastingUpdated, Target: models.AuditTargetProject},
+	"DELETE /projects/:id/casting":     {Action: models.AuditCastingCleared, Target: models.AuditTargetProject},
+
+	"POST /projects/:id/timeline/sections":                   {Action: models.AuditSectionCreated, Target: models.AuditTargetSection},
+	"PUT /projects/:id/timeline/sections/:sectionId":         {Action: models.AuditSectionUpdated, Target: models.AuditTargetSection, Param: "sectionId"},
+	"DELETE /projects/:id/timeline/sections/:sectionId":      {Action: models.AuditSectionDeleted, Target: models.AuditTargetSection, Param: "sectionId"},
+	"POST /projects/:id/timeline/sections/:sectionId/copy":   {Action: models.AuditSectionCreated, Target: models.AuditTargetSection},
+	"POST /projects/:id/timeline/sections/:sectionId/repeat": {Action: models.AuditSectionCreated, Target: models.AuditTargetSection},
+	"POST /projects/:id/timeline/cues":                       {Action: models.AuditCueCreated, Target: models.AuditTargetCue},
+	"PUT /projects/:id/timeline/cues/:cueId":                 {Action: models.AuditCueUpdated, Target: models.AuditTargetCue, Param: "cueId"},
+	"POST /projects/:id/timeline/cues/:cueId/shift":          {Action: models.AuditCueUpdated, Target: models.AuditTargetCue, Param: "cueId"},
+	"DELETE /projects/:id/timeline/cues/:cueId":              {Action: models.AuditCueDeleted, Target: models.AuditTargetCue, Param: "cueId"},
+	"POST /projects/:id/formations/transition":               {Action: models.AuditFormationApplied, Target: models.AuditTargetProject},
+	"POST /projects/:id/transform":                           {Action: models.AuditElementsMoved, Target: models.AuditTargetProject},
+
+	"POST /projects/:id/pose-tracks":                 {Action: models.AuditPoseTrackCreated, Target: models.AuditTargetPoseTrack},
+	"POST /projects/:id/pose-tracks/:trackId/frames": {Action: models.AuditPoseTrackUpdated, Target: models.AuditTargetPoseTrack, Param: "trackId"},
+	"DELETE /projects/:id/pose-tracks/:trackId":      {Action: models.AuditPoseTrackDeleted, Target: models.AuditTargetPoseTrack, Param: "trackId"},
+	"POST /projects/:id/pose-filter":                 {Action: models.AuditPoseTrackCreated, Target: models.AuditTargetPoseTrack},
+	"POST /projects/:id/bvh":                         {Action: models.AuditPoseTrackCreated, Target: models.AuditTargetPoseTrack},
+	"POST /projects/:id/analysis-jobs":               {Action: models.AuditAnalysisStarted, Target: models.AuditTargetAnalysisJob},
+	"POST /projects/:id/analysis-jobs/:jobId/cancel": {Action: models.AuditAnalysisCanceled, Target: models.AuditTargetAnalysisJob, Param: "jobId"},
+	"POST /projects/:id/analysis-jobs/:jobId/retry":  {Action: models.AuditAnalysisRetried, Target: models.AuditTargetAnalysisJob, Param: "jobId"},
+
+	"POST /projects/:id/comments":                      {Action: models.AuditCommentCreated, Target: models.AuditTargetComment},
+	"PUT /projects/:id/comments/:commentId":            {Action: models.AuditCommentUpdated, Target: models.AuditTargetComment, Param: "commentId"},
+	"DELETE /projects/:id/comments/:commentId":         {Action: models.AuditCommentDeleted, Target: models.AuditTargetComment, Param: "commentId"},
+	"POST /projects/:id/comments/:commentId/replies":   {Action: models.AuditCommentCreated, Target: models.AuditTargetComment},
+	"POST /projects/:id/comments/:commentId/resolve":   {Action: models.AuditCommentResolved, Target: models.AuditTargetComment, Param: "commentId"},
+	"POST /projects/:id/comments/:commentId/unresolve": {Action: models.AuditCommentReopened, Target: models.AuditTargetComment, Param: "commentId"},
+
+	"POST /teams":                           {Action: models.AuditTeamCreated, Target: models.AuditTargetTeam},
+	"PUT /teams/:id":                        {Action: models.AuditTeamUpdated, Target: models.AuditTargetTeam},
+	"DELETE /teams/:id":                     {Action: models.AuditTeamDeleted, Target: models.AuditTargetTeam},
+	"POST /teams/:id/members":               {Action: models.AuditTeamMemberAdded, Target: models.AuditTargetUser},
+	"DELETE /teams/:id/members/:userId":     {Action: models.AuditTeamMemberRemoved, Target: models.AuditTargetUser, Param: "userId"},
+	"POST /teams/:id/projects":              {Action: models.AuditTeamProjectAdded, Target: models.AuditTargetProject},
+	"DELETE /teams/:id/projects/:projectId": {Action: models.AuditTeamProjectRemoved, Target: models.AuditTargetProject, Param: "projectId"},
+	"POST /teams/:id/roster":                {Action: models.AuditDancerAdded, Target: models.AuditTargetDancer},
+	"PUT /teams/:id/roster/:dancerId":       {Action: models.AuditDancerUpdated, Target: models.AuditTargetDancer, Param: "dancerId"},
+	"DELETE /teams/:id/roster/:dancerId":    {Action: models.AuditDancerRemoved, Target: models.AuditTargetDancer, Param: "dancerId"},
+
+	"POST /teams/:id/rehearsals":                        {Action: models.AuditRehearsalCreated, Target: models.AuditTargetRehearsal},
+	"PUT /teams/:id/rehearsals/:rehearsalId":            {Action: models.AuditRehearsalUpdated, Target: models.AuditTargetRehearsal, Param: "rehearsalId"},
+	"DELETE /teams/:id/rehearsals/:rehearsalId":         {Action: models.AuditRehearsalDeleted, Target: models.AuditTargetRehearsal, Param: "rehearsalId"},
+	"PUT /teams/:id/rehearsals/:rehearsalId/rsvp":       {Action: models.AuditRehearsalRSVP, Target: models.AuditTargetRehearsal, Param: "rehearsalId"},
+	"PUT /teams/:id/rehearsals/:rehearsalId/attendance": {Action: models.AuditAttendanceMarked, Target: models.AuditTargetRehearsal, Param: "rehearsalId"},
+	"POST /teams/:id/calendar-token":                    {Action: models.AuditCalendarTokenCreated, Target: models.AuditTargetTeam},
+	"DELETE /teams/:id/calendar-token":                  {Action: models.AuditCalendarTokenRevoked, Target: models.AuditTargetTeam},
+	"POST /users/me/calendar-token":                     {Action: models.AuditCalendarTokenCreated, Target: models.AuditTargetUser},
+	"DELETE /users/me/calendar-token":                   {Action: models.AuditCalendarTokenRevoked, Target: models.AuditTargetUser},
+	"PUT /notifications/preferences":                    {Action: models.AuditPreferencesSet, Target: models.AuditTargetUser},
+
+	"POST /teams/:id/webhooks":                                             {Action: models.AuditWebhookCreated, Target: models.AuditTargetWebhook},
+	"PUT /teams/:id/webhooks/:webhookId":                                   {Action: models.AuditWebhookUpdated, Target: models.AuditTargetWebhook, Param: "webhookId"},
+	"DELETE /teams/:id/webhooks/:webhookId":                                {Action: models.AuditWebhookDeleted, Target: models.AuditTargetWebhook, Param: "webhookId"},
+	"POST /teams/:id/webhooks/:webhookId/rotate-secret":                    {Action: models.AuditWebhookSecretRotated, Target: models.AuditTargetWebhook, Param: "webhookId"},
+	"POST /teams/:id/webhooks/:webhookId/test":                             {Action: models.AuditWebhookTested, Target: models.AuditTargetWebhook, Param: "webhookId"},
+	"POST /teams/:id/webhooks/:webhookId/deliveries/:deliveryId/redeliver": {Action: models.AuditWebhookRedelivered, Target: models.AuditTargetWebhook, Param: "webhookId"},
+	"POST /users/me/webhooks":                                              {Action: models.AuditWebhookCreated, Target: models.AuditTargetWebhook},
+	"PUT /users/me/webhooks/:webhookId":                                    {Action: models.AuditWebhookUpdated, Target: models.AuditTargetWebhook, Param: "webhookId"},
+	"DELETE /users/me/webhooks/:webhookId":                                 {Action: models.AuditWebhookDeleted, Target: models.AuditTargetWebhook, Param: "webhookId"},
+	"POST /users/me/webhooks/:webhookId/rotate-secret":                     {Action: models.AuditWebhookSecretRotated, Target: models.AuditTargetWebhook, Param: "webhookId"},
+	"POST /users/me/webhooks/:webhookId/test":                              {Action: models.AuditWebhookTested, Target: models.AuditTargetWebhook, Param: "webhookId"},
+	"POST /users/me/webhooks/:webhookId/deliveries/:deliveryId/redeliver":  {Action: models.AuditWebhookRedelivered, Target: models.AuditTargetWebhook, Param: "webhookId"},
+
+	"POST /models/upload": {Action: models.AuditModelUploaded, Target: models.AuditTargetModel},
+	"PUT /models/:id":     {Action: models.AuditModelUpdated, Target: models.AuditTargetModel, Param: "id"},
+	"DELETE /models/:id":  {Action: models.AuditModelDeleted, Target: models.AuditTargetModel, Param: "id"},
+	"POST /upload":        {Action: models.AuditFileUploaded, Target: models.AuditTargetFile},
+	"POST /upload/video":  {Action: models.AuditFileUploaded, Target: models.AuditTargetFile},
+}
+
+// UnauditedRoutes - изменяющие по методу маршруты, которые ничего не
+// меняют в общих данных, с причиной
+var UnauditedRoutes = map[string]string{
+	"POST /auth/login":                         "issues a token only",
+	"POST /notifications/read-all":             "personal read state",
+	"POST /notifications/:notificationId/read": "personal read state",
+	"POST /projects/:id/pose-comparison":       "computes a comparison only",
+	"POST /projects/:id/debug":                 "diagnostics only",
+	"POST /process-frame":                      "proxies frame processing",
+	"POST /test/test-save-keyframes":           "test route",
+}
+
+// projectAuditProjection - поля проекта, которые сравниваются в журнале аудита
+var projectAuditProjection = bson.M{
+	"name": 1, "title": 1, "description": 1, "owner": 1, "teamId": 1, "isPrivate": 1,
+	"duration": 1, "videoUrl": 1, "audioUrl": 1, "tags": 1, "updatedAt": 1,
+}
+
+// projectAuditState - краткое состояние проекта для журнала аудита
+func projectAuditState(project *models.Project) bson.M {
+	state := bson.M{
+		"name":        project.Name,
+		"title":       project.Title,
+		"description": project.Description,
+		"isPrivate":   project.IsPrivate,
+		"duration":    project.Duration,
+		"videoUrl":    project.VideoURL,
+		"audioUrl":    project.AudioURL,
+		"tags":        project.Tags,
+	}
+	if !project.TeamID.IsZero() {
+		state["teamId"] = project.TeamID
+	}
+	return state
+}
+
+// auditChanges оставляет в состояниях до и после только изменившиеся поля
+func auditChanges(before, after bson.M) (bson.M, bson.M) {
+	changedBefore, changedAfter := bson.M{}, bson.M{}
+	for key, value := range after {
+		if old, ok := before[key]; !ok || !reflect.DeepEqual(old, value) {
+			changedBefore[key] = before[key]
+			changedAfter[key] = value
+		}
+	}
+	for key, value := range before {
+		if _, ok := after[key]; !ok {
+			changedBefore[key] = value
+			changedAfter[key] = nil
+		}
+	}
+	return changedBefore, changedAfter
+}
+
+// Регистрирует ленты активности проекта и команды
+func RegisterActivityRoutes(router *gin.RouterGroup, cfg *config.Config) {
+	projectActivity := router.Group("/projects/:id/activity")
+	projectActivity.Use(middleware.JWTMiddleware(cfg))
+	{
+		projectActivity.GET("", middleware.CheckProjectIsPrivate(), getProjectActivity)
+	}
+
+	teamActivity := router.Group("/teams/:id/activity")
+	teamActivity.Use(middleware.JWTMiddleware(cfg))
+	{
+		teamActivity.GET("", middleware.CheckTeamAccess(), getTeamActivity)
+	}
+}
+
+// Возвращает журнал изменений проекта
+func getProjectActivity(c *gin.Context) {
+	projectID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid project ID format"})
+		return
+	}
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// Адреса и клиенты авторов видит только владелец проекта
+	owned, err := config.ProjectsCollection.CountDocuments(ctx, bson.M{"_id": projectID, "owner": userID})
+	if err != nil {
+		config.LogError("AUDIT", fmt.Errorf("failed to check owner of project %s: %w", projectID.Hex(), err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get activity"})
+		return
+	}
+	writeActivity(ctx, c, bson.M{"projectId": projectID}, owned > 0)
+}
+
+// Возвращает журнал изменений команды, её проектов и репетиций, включая
+// записи проектов, сделанные до их добавления в команду
+func getTeamActivity(c *gin.Context) {
+	teamID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid team ID format"})
+		return
+	}
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// Адреса и клиенты авторов видит только владелец команды
+	owned, err := config.TeamsCollection.CountDocuments(ctx, bson.M{"_id": teamID, "owner": userID})
+	if err != nil {
+		config.LogError("AUDIT", fmt.Errorf("failed to check owner of team %s: %w", teamID.Hex(), err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get activity"})
+		return
+	}
+	projectIDs, err := config.ProjectsCollection.Distinct(ctx, "_id", bson.M{"teamId": teamID})
+	if err != nil {
+		config.LogError("AUDIT", fmt.Errorf("failed to find projects of team %s: %w", teamID.Hex(), err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get activity"})
+		return
+	}
+	filter := bson.M{"teamId": teamID}
+	if len(projectIDs) > 0 {
+		filter = bson.M{"$or": []bson.M{filter, {"projectId": bson.M{"$in": projectIDs}}}}
+	}
+	writeActivity(ctx, c, filter, owned > 0)
+}
+
+// writeActivity отвечает страницей записей журнала, новые сначала.
+// Фильтры: ?action= (через запятую), ?actor=, ?targetType=, ?targetId=,
+// ?from= и ?to= (RFC3339); страница - ?limit= и ?offset=. IP и клиент
+// автора возвращаются только при showClient.
+func writeActivity(ctx context.Context, c *gin.Context, scope bson.M, showClient bool) {
+	filter := bson.M{}
+	for key, value := range scope {
+		filter[key] = value
+	}
+	if value := c.Query("action"); value != "" {
+		actions := strings.Split(value, ",")
+		for _, action := range actions {
+			if !models.IsAuditAction(action) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("unknown action %q", action)})
+				return
+			}
+		}
+		filter["action"] = bson.M{"$in": actions}
+	}
+	if value := c.Query("actor"); value != "" {
+		actorID, err := primitive.ObjectIDFromHex(value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid actor ID format"})
+			return
+		}
+		filter["actorId"] = actorID
+	}
+	if value := c.Query("targetType"); value != "" {
+		filter["targetType"] = value
+	}
+	if value := c.Query("targetId"); value != "" {
+		filter["targetId"] = value
+	}
+	createdAt := bson.M{}
+	for param, op := range map[string]string{"from": "$gte", "to": "$lt"} {
+		if value := c.Query(param); value != "" {
+			t, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": param + " must be an RFC3339 time"})
+				return
+			}
+			createdAt[op] = t
+		}
+	}
+	if len(createdAt) > 0 {
+		filter["createdAt"] = createdAt
+	}
+
+	limit, offset := models.DefaultAuditLimit, 0
+	var err error
+	if value := c.Query("limit"); value != "" {
+		if limit, err = strconv.Atoi(value); err != nil || limit < 1 || limit > models.MaxAuditLimit {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("limit must be between 1 and %d", models.MaxAuditLimit)})
+			return
+		}
+	}
+	if value := c.Query("offset"); value != "" {
+		if offset, err = strconv.Atoi(value); err != nil || offset < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "offset must be a non-negative integer"})
+			return
+		}
+	}
+
+	total, err := config.AuditLogCollection.CountDocuments(ctx, filter)
+	if err != nil {
+		config.LogError("AUDIT", fmt.Errorf("failed to count activity: %w", err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get activity"})
+		return
+	}
+	findOptions := options.Find().
+		SetSort(bson.D{{Key: "createdAt", Value: -1}, {Key: "_id", Value: -1}}).
+		SetSkip(int64(offset)).
+		SetLimit(int64(limit))
+	if !showClient {
+		findOptions.SetProjection(bson.M{"ip": 0, "userAgent": 0})
+	}
+	cursor, err := config.AuditLogCollection.Find(ctx, filter, findOptions)
+	if err != nil {
+		config.LogError("AUDIT", fmt.Errorf("failed to find activity: %w", err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get activity"})
+		return
+	}
+	events := []models.AuditEvent{}
+	if err := cursor.All(ctx, &events); err != nil {
+		config.LogError("AUDIT", fmt.Errorf("failed to decode activity: %w", err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get activity"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"events": events, "total": total})
+}
@@ -2,7 +2,6 @@ package routes
 
 import (
 	"context"
-	"fmt"
 	"log"
 	"net/http"
 	"time"
@@ -136,6 +135,7 @@ func register(cfg *config.Config) gin.HandlerFunc {
 		log.Printf("Token generated successfully for user: %s", user.Username)
 		
 		// Возвращаем пользователя и токен
+		middleware.Audit(c).ActorID = user.ID
 		c.JSON(http.StatusCreated, gin.H{
 			"user":  user.ToResponse(),
 			"token": token,
@@ -329,35 +329,5 @@ func createPreviewProjects(ctx context.Context, userID primitive.ObjectID) {
 		log.Printf("Preview project 2 already exists with ID: %s", preview2ID.Hex())
 	}
 
-	// Создаем записи в истории для доступа к проектам
-	historyEntry1 := models.CreateHistory(
-		userID,
-		preview1ID,
-		models.ActionProjectCreated,
-		fmt.Sprintf("Получен доступ к проекту '%s'", previewProject1.Name),
-	)
-	
-	historyEntry2 := models.CreateHistory(
-		userID,
-		preview2ID,
-		models.ActionProjectCreated,
-		fmt.Sprintf("Получен доступ к проекту '%s'", previewProject2.Name),
-	)
-	
-	historyCollection := config.GetCollection("histories")
-	_, err := historyCollection.InsertOne(ctx, historyEntry1)
-	if err != nil {
-		log.Printf("Failed to create history entry for preview project 1: %v", err)
-	} else {
-		log.Printf("Created history entry for preview project 1")
-	}
-	
-	_, err = historyCollection.InsertOne(ctx, historyEntry2)
-	if err != nil {
-		log.Printf("Failed to create history entry for preview project 2: %v", err)
-	} else {
-		log.Printf("Created history entry for preview project 2")
-	}
-	
 	log.Printf("Finished creating preview projects for user: %s", userID.Hex())
 } 
\ No newline at end of file
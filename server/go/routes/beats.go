@@ -0,0 +1,205 @@
+package routes
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kktjss/dance-flow/audio"
+	"github.com/kktjss/dance-flow/config"
+	"github.com/kktjss/dance-flow/middleware"
+	"github.com/kktjss/dance-flow/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Регистрирует маршруты сетки долей, найденной в аудио проекта
+func RegisterBeatRoutes(router *gin.RouterGroup, cfg *config.Config) {
+	beats := router.Group("/projects/:id/beats")
+	beats.Use(middleware.JWTMiddleware(cfg))
+	{
+		beats.GET("", middleware.CheckProjectIsPrivate(), getBeatGrid)
+		beats.POST("/detect", middleware.CheckProjectAccess(), detectBeats)
+		beats.DELETE("", middleware.CheckProjectAccess(), deleteBeatGrid)
+	}
+}
+
+// Возвращает сетку долей проекта (null, если аудио ещё не анализировалось)
+func getBeatGrid(c *gin.Context) {
+	projectID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid project ID format"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var project models.Project
+	err = config.ProjectsCollection.FindOne(ctx, bson.M{"_id": projectID},
+		options.FindOne().SetProjection(bson.M{"beatGrid": 1})).Decode(&project)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Project not found"})
+		} else {
+			config.LogError("BEATS", fmt.Errorf("failed to load beat grid of project %s: %w", projectID.Hex(), err))
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get beat grid"})
+		}
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"beatGrid": project.BeatGrid})
+}
+
+// Находит доли, темп и сильные доли в аудио проекта и сохраняет их как сетку
+// долей. Тело (все поля необязательны): audioUrl - файл из /uploads/audio
+// (по умолчанию аудио проекта), minBpm и maxBpm - диапазон темпа,
+// beatsPerBar - число долей в такте, applyTempoMap - заменить карту темпа
+// проекта постоянным темпом найденной сетки.
+func detectBeats(c *gin.Context) {
+	var input struct {
+		AudioURL      string  `json:"audioUrl"`
+		MinBPM        float64 `json:"minBpm"`
+		MaxBPM        float64 `json:"maxBpm"`
+		BeatsPerBar   int     `json:"beatsPerBar"`
+		ApplyTempoMap bool    `json:"applyTempoMap"`
+	}
+	// Тело может отсутствовать
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+	projectID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid project ID format"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+
+	if input.AudioURL == "" {
+		var project models.Project
+		err = config.ProjectsCollection.FindOne(ctx, bson.M{"_id": projectID},
+			options.FindOne().SetProjection(bson.M{"audioUrl": 1})).Decode(&project)
+		if err != nil {
+			if err == mongo.ErrNoDocuments {
+				c.JSON(http.StatusNotFound, gin.H{"error": "Project not found"})
+			} else {
+				config.LogError("BEATS", fmt.Errorf("failed to load project %s: %w", projectID.Hex(), err))
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get project"})
+			}
+			return
+		}
+		if project.AudioURL == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Project has no audio, pass audioUrl"})
+			return
+		}
+		input.AudioURL = project.AudioURL
+	}
+	audioPath, err := audioPathFromURL(input.AudioURL)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	file, err := os.Open(audioPath)
+	if err != nil {
+		config.LogError("BEATS", fmt.Errorf("failed to open audio %s: %w", audioPath, err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read audio file"})
+		return
+	}
+	clip, err := audio.Decode(file)
+	file.Close()
+	if errors.Is(err, audio.ErrUnsupportedFormat) {
+		c.JSON(http.StatusUnsupportedMediaType, gin.H{"error": err.Error() + ", upload the audio as WAV"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+		return
+	}
+
+	grid, err := audio.DetectBeats(clip, audio.Options{
+		MinBPM:      input.MinBPM,
+		MaxBPM:      input.MaxBPM,
+		BeatsPerBar: input.BeatsPerBar,
+	})
+	if err == audio.ErrInvalidRange {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Tempo range must be within %.0f-%.0f BPM and beats per bar within 1-%d",
+			models.MinTempoBPM, models.MaxTempoBPM, models.MaxBeatsPerBar)})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+		return
+	}
+	grid.AudioURL = input.AudioURL
+
+	set := bson.M{"beatGrid": grid, "updatedAt": time.Now()}
+	var tempoMap *models.TempoMap
+	if input.ApplyTempoMap {
+		derived := grid.TempoMap()
+		if err := derived.Validate(); err != nil {
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Detected tempo cannot be used as a tempo map: " + err.Error()})
+			return
+		}
+		tempoMap = &derived
+		set["tempoMap"] = tempoMap
+	}
+
+	result, err := config.ProjectsCollection.UpdateOne(ctx, bson.M{"_id": projectID}, bson.M{"$set": set})
+	if err != nil {
+		config.LogError("BEATS", fmt.Errorf("failed to save beat grid of project %s: %w", projectID.Hex(), err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save beat grid"})
+		return
+	}
+	if result.MatchedCount == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Project not found"})
+		return
+	}
+
+	description := fmt.Sprintf("Detected %d beats at %.1f BPM in project audio", len(grid.Beats), grid.BPM)
+	middleware.Audit(c).Summary = description
+	announceProjectUpdate(ctx, userID, projectID, description)
+
+	c.JSON(http.StatusOK, gin.H{"beatGrid": grid, "tempoMap": tempoMap})
+}
+
+// Удаляет сетку долей проекта
+func deleteBeatGrid(c *gin.Context) {
+	projectID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid project ID format"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	result, err := config.ProjectsCollection.UpdateOne(ctx, bson.M{"_id": projectID},
+		bson.M{"$unset": bson.M{"beatGrid": ""}, "$set": bson.M{"updatedAt": time.Now()}})
+	if err != nil {
+		config.LogError("BEATS", fmt.Errorf("failed to delete beat grid of project %s: %w", projectID.Hex(), err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete beat grid"})
+		return
+	}
+	if result.MatchedCount == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Project not found"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Beat grid deleted"})
+}
@@ -0,0 +1,215 @@
+package routes
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kktjss/dance-flow/bvh"
+	"github.com/kktjss/dance-flow/config"
+	"github.com/kktjss/dance-flow/middleware"
+	"github.com/kktjss/dance-flow/models"
+	"github.com/kktjss/dance-flow/posetrack"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Максимальный размер импортируемого BVH файла
+const maxBVHFileSize = bvh.MaxFileSize
+
+// Регистрирует маршруты экспорта и импорта движения в формате BVH
+func RegisterBVHRoutes(router *gin.RouterGroup, cfg *config.Config) {
+	motion := router.Group("/projects/:id/bvh")
+	motion.Use(middleware.JWTMiddleware(cfg))
+	{
+		motion.GET("", middleware.CheckProjectIsPrivate(), exportBVH)
+		motion.POST("", middleware.CheckProjectAccess(), importBVH)
+	}
+}
+
+// Экспортирует позы танцора в BVH файл. Источник задаётся параметрами
+// ?trackId= или ?personIndex=, частота кадров - ?fps= (по умолчанию 30).
+func exportBVH(c *gin.Context) {
+	projectID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid project ID format"})
+		return
+	}
+
+	source := posetrack.Source{TrackID: c.Query("trackId")}
+	if value := c.Query("personIndex"); value != "" {
+		source.PersonIndex, err = strconv.Atoi(value)
+		if err != nil || source.PersonIndex < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "personIndex must be a non-negative integer"})
+			return
+		}
+	}
+	opts := bvh.ExportOptions{FrameRate: bvh.DefaultFrameRate, Scale: bvh.DefaultScale}
+	if value := c.Query("fps"); value != "" {
+		opts.FrameRate, err = strconv.ParseFloat(value, 64)
+		if err != nil || opts.FrameRate <= 0 || opts.FrameRate > bvh.MaxFrameRate {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("fps must be between 0 and %.0f", bvh.MaxFrameRate)})
+			return
+		}
+	}
+	if value := c.Query("scale"); value != "" {
+		opts.Scale, err = strconv.ParseFloat(value, 64)
+		if err != nil || opts.Scale <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "scale must be a positive number"})
+			return
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+
+	sequence, ok := loadPoseSequence(ctx, c, projectID, source, "project")
+	if !ok {
+		return
+	}
+	duration := sequence.Frames[len(sequence.Frames)-1].Time - sequence.Frames[0].Time
+	if duration*opts.FrameRate >= bvh.MaxFrames {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Export would exceed %d frames, lower fps", bvh.MaxFrames)})
+		return
+	}
+
+	motion, err := bvh.FromSequence(sequence, opts)
+	if err != nil {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+		return
+	}
+
+	var buf bytes.Buffer
+	if err := motion.Write(&buf); err != nil {
+		config.LogError("BVH", fmt.Errorf("failed to write BVH for project %s: %w", projectID.Hex(), err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to export motion"})
+		return
+	}
+
+	name := fmt.Sprintf("person-%d", source.PersonIndex)
+	if source.TrackID != "" {
+		name = "track-" + source.TrackID
+	}
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s-%s.bvh"`, projectID.Hex(), name))
+	c.Data(http.StatusOK, "application/octet-stream", buf.Bytes())
+}
+
+// Импортирует BVH файл (multipart, поле "file") в новый трек поз проекта.
+// Необязательные поля формы: name, personIndex, skeleton, frameWidth/frameHeight
+// и scale (единиц BVH на высоту кадра; без него движение вписывается в кадр).
+func importBVH(c *gin.Context) {
+	projectID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid project ID format"})
+		return
+	}
+
+	var input struct {
+		Name        string  `form:"name"`
+		PersonIndex int     `form:"personIndex"`
+		Skeleton    string  `form:"skeleton"`
+		FrameWidth  int     `form:"frameWidth"`
+		FrameHeight int     `form:"frameHeight"`
+		Scale       float64 `form:"scale"`
+	}
+	if err := c.ShouldBind(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if input.Skeleton == "" {
+		input.Skeleton = models.SkeletonMediaPipe33
+	}
+	if _, err := models.GetSkeleton(input.Skeleton); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if input.PersonIndex < 0 || input.FrameWidth < 0 || input.FrameHeight < 0 || input.Scale < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "personIndex, frame size and scale must not be negative"})
+		return
+	}
+
+	header, err := c.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "BVH file is required"})
+		return
+	}
+	if header.Size > maxBVHFileSize {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "BVH file is too large"})
+		return
+	}
+	file, err := header.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read BVH file"})
+		return
+	}
+	defer file.Close()
+
+	motion, err := bvh.Parse(io.LimitReader(file, maxBVHFileSize))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	now := time.Now()
+	track := models.PoseTrack{
+		ID:          primitive.NewObjectID(),
+		ProjectID:   projectID,
+		Name:        input.Name,
+		PersonIndex: input.PersonIndex,
+		Skeleton:    input.Skeleton,
+		FrameWidth:  input.FrameWidth,
+		FrameHeight: input.FrameHeight,
+		CreatedBy:   userID,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	if track.Name == "" {
+		track.Name = strings.TrimSuffix(filepath.Base(header.Filename), filepath.Ext(header.Filename))
+	}
+	sequence := models.PoseSequence{FrameWidth: track.FrameWidth, FrameHeight: track.FrameHeight}
+
+	frames, err := bvh.ToFrames(motion, bvh.ImportOptions{
+		Skeleton: track.Skeleton,
+		Aspect:   sequence.Aspect(),
+		Scale:    input.Scale,
+	})
+	if errors.Is(err, bvh.ErrNoMappedJoints) {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid motion: " + err.Error()})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+
+	if _, err := config.PoseTracksCollection.InsertOne(ctx, track); err != nil {
+		config.LogError("BVH", fmt.Errorf("failed to create track: %w", err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create pose track"})
+		return
+	}
+	if err := posetrack.AppendFrames(ctx, &track, frames); err != nil {
+		config.LogError("BVH", fmt.Errorf("failed to write imported track %s: %w", track.ID.Hex(), err))
+		posetrack.DeleteTracks(ctx, []primitive.ObjectID{track.ID})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to write imported frames"})
+		return
+	}
+
+	middleware.Audit(c).TargetID = track.ID.Hex()
+	c.JSON(http.StatusCreated, track)
+}
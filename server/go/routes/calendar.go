@@ -0,0 +1,320 @@
+package routes
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kktjss/dance-flow/config"
+	"github.com/kktjss/dance-flow/ical"
+	"github.com/kktjss/dance-flow/middleware"
+	"github.com/kktjss/dance-flow/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Прошедшие репетиции остаются в календаре столько дней
+const calendarHistoryDays = 90
+
+// Регистрирует маршруты подписки на календарь репетиций. Сами календари
+// отдаются без JWT: календарные приложения передают только секретный токен
+// из адреса.
+func RegisterCalendarRoutes(router *gin.RouterGroup, cfg *config.Config) {
+	userTokens := router.Group("/users/me/calendar-token")
+	userTokens.Use(middleware.JWTMiddleware(cfg))
+	{
+		userTokens.POST("", createUserCalendarToken)
+		userTokens.DELETE("", revokeUserCalendarToken)
+	}
+
+	teamTokens := router.Group("/teams/:id/calendar-token")
+	teamTokens.Use(middleware.JWTMiddleware(cfg))
+	{
+		teamTokens.POST("", middleware.CheckTeamAccess(), createTeamCalendarToken)
+		teamTokens.DELETE("", middleware.CheckTeamAccess(), revokeTeamCalendarToken)
+	}
+
+	feeds := router.Group("/calendar")
+	{
+		feeds.GET("/users/:token", getUserCalendar)
+		feeds.GET("/teams/:token", getTeamCalendar)
+	}
+}
+
+// Создаёт токен подписки на личный календарь репетиций. Прежний токен
+// перестаёт действовать. Токен возвращается только в этом ответе.
+func createUserCalendarToken(c *gin.Context) {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+	token, hash, err := models.NewCalendarToken()
+	if err != nil {
+		config.LogError("CALENDAR", fmt.Errorf("failed to generate calendar token: %w", err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create calendar token"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	result, err := config.UsersCollection.UpdateOne(ctx, bson.M{"_id": userID},
+		bson.M{"$set": bson.M{"calendarTokenHash": hash, "updatedAt": time.Now()}})
+	if err != nil {
+		config.LogError("CALENDAR", fmt.Errorf("failed to save calendar token of user %s: %w", userID.Hex(), err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create calendar token"})
+		return
+	}
+	if result.MatchedCount == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"token": token, "url": calendarURL(c, "users", token)})
+}
+
+// Отзывает токен подписки на личный календарь
+func revokeUserCalendarToken(c *gin.Context) {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, err = config.UsersCollection.UpdateOne(ctx, bson.M{"_id": userID},
+		bson.M{"$unset": bson.M{"calendarTokenHash": ""}})
+	if err != nil {
+		config.LogError("CALENDAR", fmt.Errorf("failed to revoke calendar token of user %s: %w", userID.Hex(), err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke calendar token"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Calendar token revoked"})
+}
+
+// Создаёт токен подписки на календарь команды. Доступно владельцу и
+// редакторам команды, прежний токен перестаёт действовать.
+func createTeamCalendarToken(c *gin.Context) {
+	token, hash, err := models.NewCalendarToken()
+	if err != nil {
+		config.LogError("CALENDAR", fmt.Errorf("failed to generate calendar token: %w", err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create calendar token"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	team, ok := loadEditableTeam(ctx, c)
+	if !ok {
+		return
+	}
+	_, err = config.TeamsCollection.UpdateOne(ctx, bson.M{"_id": team.ID},
+		bson.M{"$set": bson.M{"calendarTokenHash": hash}})
+	if err != nil {
+		config.LogError("CALENDAR", fmt.Errorf("failed to save calendar token of team %s: %w", team.ID.Hex(), err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create calendar token"})
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"token": token, "url": calendarURL(c, "teams", token)})
+}
+
+// Отзывает токен подписки на календарь команды
+func revokeTeamCalendarToken(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	team, ok := loadEditableTeam(ctx, c)
+	if !ok {
+		return
+	}
+	_, err := config.TeamsCollection.UpdateOne(ctx, bson.M{"_id": team.ID},
+		bson.M{"$unset": bson.M{"calendarTokenHash": ""}})
+	if err != nil {
+		config.LogError("CALENDAR", fmt.Errorf("failed to revoke calendar token of team %s: %w", team.ID.Hex(), err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke calendar token"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Calendar token revoked"})
+}
+
+// Отдаёт личный календарь: репетиции команд пользователя, на которые он приглашён
+func getUserCalendar(c *gin.Context) {
+	hash := models.HashCalendarToken(calendarToken(c))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var user models.User
+	err := config.UsersCollection.FindOne(ctx, bson.M{"calendarTokenHash": hash}).Decode(&user)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Calendar not found"})
+		} else {
+			config.LogError("CALENDAR", fmt.Errorf("failed to find calendar user: %w", err))
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get calendar"})
+		}
+		return
+	}
+
+	cursor, err := config.TeamsCollection.Find(ctx, bson.M{"$or": []bson.M{
+		{"owner": user.ID},
+		{"members.userId": user.ID},
+	}})
+	if err != nil {
+		config.LogError("CALENDAR", fmt.Errorf("failed to find teams of user %s: %w", user.ID.Hex(), err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get calendar"})
+		return
+	}
+	var teams []models.Team
+	if err := cursor.All(ctx, &teams); err != nil {
+		config.LogError("CALENDAR", fmt.Errorf("failed to decode teams: %w", err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get calendar"})
+		return
+	}
+
+	// В общем календаре нескольких команд перед названием указывается команда
+	for i := range teams {
+		rehearsals := teams[i].Rehearsals[:0]
+		for _, rehearsal := range teams[i].Rehearsals {
+			if rehearsal.IsInvited(user.ID) {
+				if len(teams) > 1 {
+					rehearsal.Title = teams[i].Name + ": " + rehearsal.Title
+				}
+				rehearsals = append(rehearsals, rehearsal)
+			}
+		}
+		teams[i].Rehearsals = rehearsals
+	}
+	writeCalendar(ctx, c, "Dance Flow: "+user.Username, teams)
+}
+
+// Отдаёт календарь всех репетиций команды
+func getTeamCalendar(c *gin.Context) {
+	hash := models.HashCalendarToken(calendarToken(c))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var team models.Team
+	err := config.TeamsCollection.FindOne(ctx, bson.M{"calendarTokenHash": hash}).Decode(&team)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Calendar not found"})
+		} else {
+			config.LogError("CALENDAR", fmt.Errorf("failed to find calendar team: %w", err))
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get calendar"})
+		}
+		return
+	}
+	writeCalendar(ctx, c, team.Name, []models.Team{team})
+}
+
+// writeCalendar выводит репетиции команд за последние calendarHistoryDays
+// дней и все будущие. В описание события попадают проекты и части
+// повестки и заметки.
+func writeCalendar(ctx context.Context, c *gin.Context, name string, teams []models.Team) {
+	now := time.Now().UTC()
+	since := now.AddDate(0, 0, -calendarHistoryDays)
+
+	teamIDs := []primitive.ObjectID{}
+	projectIDs := []primitive.ObjectID{}
+	rehearsals := []models.Rehearsal{}
+	for _, team := range teams {
+		teamIDs = append(teamIDs, team.ID)
+		for _, rehearsal := range team.Rehearsals {
+			if rehearsal.End.Before(since) {
+				continue
+			}
+			rehearsals = append(rehearsals, rehearsal)
+			for _, item := range rehearsal.Agenda {
+				projectIDs = append(projectIDs, item.ProjectID)
+			}
+		}
+	}
+	sort.SliceStable(rehearsals, func(i, j int) bool { return rehearsals[i].Start.Before(rehearsals[j].Start) })
+
+	projects, err := rehearsalProjects(ctx, teamIDs, projectIDs)
+	if err != nil {
+		config.LogError("CALENDAR", fmt.Errorf("failed to load agenda projects: %w", err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get calendar"})
+		return
+	}
+
+	cal := ical.Calendar{Name: name, Events: make([]ical.Event, 0, len(rehearsals))}
+	for _, rehearsal := range rehearsals {
+		status := ical.StatusConfirmed
+		if rehearsal.Cancelled {
+			status = ical.StatusCancelled
+		}
+		cal.Events = append(cal.Events, ical.Event{
+			UID:         rehearsal.ID + "@dance-flow",
+			Summary:     rehearsal.Title,
+			Description: rehearsalDescription(rehearsal, projects),
+			Location:    rehearsal.Location,
+			Start:       rehearsal.Start,
+			End:         rehearsal.End,
+			Status:      status,
+			Updated:     rehearsal.UpdatedAt,
+			Sequence:    rehearsal.Sequence,
+		})
+	}
+
+	var body bytes.Buffer
+	if err := ical.Write(&body, cal, now); err != nil {
+		config.LogError("CALENDAR", fmt.Errorf("failed to write calendar: %w", err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get calendar"})
+		return
+	}
+	c.Header("Cache-Control", "private, max-age=300")
+	c.Data(http.StatusOK, "text/calendar; charset=utf-8", body.Bytes())
+}
+
+// rehearsalDescription перечисляет повестку репетиции и добавляет заметки.
+// Проекты, которые больше не принадлежат команде, пропускаются.
+func rehearsalDescription(rehearsal models.Rehearsal, projects map[primitive.ObjectID]models.Project) string {
+	lines := []string{}
+	for _, item := range rehearsal.Agenda {
+		project, ok := projects[item.ProjectID]
+		if !ok {
+			continue
+		}
+		line := "- " + projectDisplayName(&project)
+		if index := findTimelineSection(project.Sections, item.SectionID); item.SectionID != "" && index >= 0 {
+			line += ": " + project.Sections[index].Name
+		}
+		lines = append(lines, line)
+	}
+	if rehearsal.Notes != "" {
+		if len(lines) > 0 {
+			lines = append(lines, "")
+		}
+		lines = append(lines, rehearsal.Notes)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// calendarToken возвращает токен из адреса без расширения .ics
+func calendarToken(c *gin.Context) string {
+	return strings.TrimSuffix(c.Param("token"), ".ics")
+}
+
+// calendarURL строит адрес подписки для календарных приложений
+func calendarURL(c *gin.Context, kind, token string) string {
+	scheme := "http"
+	if c.Request.TLS != nil {
+		scheme = "https"
+	}
+	if proto := c.GetHeader("X-Forwarded-Proto"); proto != "" {
+		scheme = proto
+	}
+	return fmt.Sprintf("%s://%s/api/calendar/%s/%s.ics", scheme, c.Request.Host, kind, token)
+}
@@ -0,0 +1,250 @@
+package routes
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kktjss/dance-flow/config"
+	"github.com/kktjss/dance-flow/middleware"
+	"github.com/kktjss/dance-flow/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Регистрирует маршруты распределения ролей проекта между танцорами команды
+func RegisterCastingRoutes(router *gin.RouterGroup, cfg *config.Config) {
+	casting := router.Group("/projects/:id/casting")
+	casting.Use(middleware.JWTMiddleware(cfg))
+	{
+		casting.GET("", middleware.CheckProjectIsPrivate(), getProjectCasting)
+		casting.PUT("", middleware.CheckProjectAccess(), updateProjectCasting)
+		casting.DELETE("", middleware.CheckProjectAccess(), clearProjectCasting)
+	}
+}
+
+// castRole - элемент проекта и назначенный на него танцор
+type castRole struct {
+	ElementID   string         `json:"elementId"`
+	ElementName string         `json:"elementName,omitempty"`
+	DancerID    string         `json:"dancerId"`
+	Dancer      *models.Dancer `json:"dancer"`
+}
+
+// uncastElement - элемент проекта без назначенного танцора
+type uncastElement struct {
+	ID   string `json:"id"`
+	Name string `json:"name,omitempty"`
+}
+
+// Возвращает роли проекта с данными танцоров, элементы без танцоров и
+// состав команды проекта. Состав, как и маршруты /teams/:id/roster, виден
+// только участникам команды: читателям публичного проекта достаются роли
+// с именами танцоров.
+func getProjectCasting(c *gin.Context) {
+	project, roster, ok := loadCastingProject(c)
+	if !ok {
+		return
+	}
+	roles, uncast := resolveCasting(project, roster)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	response := gin.H{
+		"teamId":         project.TeamID,
+		"casting":        roles,
+		"uncastElements": uncast,
+	}
+	userID, err := middleware.GetUserID(c)
+	if err == nil && middleware.IsTeamMember(ctx, userID, project.TeamID) {
+		response["roster"] = sortedRoster(roster)
+	} else {
+		for i := range roles {
+			if dancer := roles[i].Dancer; dancer != nil {
+				roles[i].Dancer = &models.Dancer{ID: dancer.ID, Name: dancer.Name, Color: dancer.Color}
+			}
+		}
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// Заменяет распределение ролей целиком: так проект переводится на другой
+// состав без изменения элементов. Тело: casting - список {elementId, dancerId}.
+func updateProjectCasting(c *gin.Context) {
+	var input struct {
+		Casting []models.CastingEntry `json:"casting"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if input.Casting == nil {
+		input.Casting = []models.CastingEntry{}
+	}
+
+	project, roster, ok := loadCastingProject(c)
+	if !ok {
+		return
+	}
+	if project.TeamID.IsZero() {
+		c.JSON(http.StatusConflict, gin.H{"error": "Casting needs the project to belong to a team with a roster"})
+		return
+	}
+	if err := models.ValidateCasting(input.Casting, project.Elements, roster); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	project.Casting = input.Casting
+	if !saveProjectCasting(c, project, fmt.Sprintf("Recast project: %d roles", len(input.Casting))) {
+		return
+	}
+
+	roles, uncast := resolveCasting(project, roster)
+	c.JSON(http.StatusOK, gin.H{
+		"teamId":         project.TeamID,
+		"casting":        roles,
+		"uncastElements": uncast,
+	})
+}
+
+// Снимает всех танцоров с ролей проекта
+func clearProjectCasting(c *gin.Context) {
+	project, _, ok := loadCastingProject(c)
+	if !ok {
+		return
+	}
+	project.Casting = []models.CastingEntry{}
+	if !saveProjectCasting(c, project, "Cleared project casting") {
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Casting cleared"})
+}
+
+// loadCastingProject загружает проект из параметра :id и состав его команды
+func loadCastingProject(c *gin.Context) (*models.Project, []models.Dancer, bool) {
+	projectID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid project ID format"})
+		return nil, nil, false
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	project, err := loadProject(ctx, projectID)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Project not found"})
+		} else {
+			config.LogError("CASTING", fmt.Errorf("failed to load project %s: %w", projectID.Hex(), err))
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get project"})
+		}
+		return nil, nil, false
+	}
+
+	roster, err := projectRoster(ctx, project)
+	if err != nil {
+		config.LogError("CASTING", fmt.Errorf("failed to load roster of project %s: %w", projectID.Hex(), err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get team roster"})
+		return nil, nil, false
+	}
+	return project, roster, true
+}
+
+// projectRoster возвращает состав команды проекта (пустой для личного проекта)
+func projectRoster(ctx context.Context, project *models.Project) ([]models.Dancer, error) {
+	if project.TeamID.IsZero() {
+		return []models.Dancer{}, nil
+	}
+	var team models.Team
+	err := config.TeamsCollection.FindOne(ctx, bson.M{"_id": project.TeamID}).Decode(&team)
+	if err == mongo.ErrNoDocuments {
+		return []models.Dancer{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if team.Roster == nil {
+		team.Roster = []models.Dancer{}
+	}
+	return team.Roster, nil
+}
+
+// resolveCasting сопоставляет роли проекта с элементами и танцорами.
+// Роли удалённых элементов не возвращаются.
+func resolveCasting(project *models.Project, roster []models.Dancer) ([]castRole, []uncastElement) {
+	names := map[string]string{}
+	order := []string{}
+	for _, raw := range project.Elements {
+		element, ok := raw.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		id, _ := element["id"].(string)
+		if id == "" {
+			continue
+		}
+		names[id] = elementName(element)
+		order = append(order, id)
+	}
+
+	roles := []castRole{}
+	cast := map[string]bool{}
+	for _, entry := range project.Casting {
+		name, ok := names[entry.ElementID]
+		if !ok {
+			continue
+		}
+		role := castRole{ElementID: entry.ElementID, ElementName: name, DancerID: entry.DancerID}
+		if index := findDancer(roster, entry.DancerID); index >= 0 {
+			role.Dancer = &roster[index]
+		}
+		roles = append(roles, role)
+		cast[entry.ElementID] = true
+	}
+
+	uncast := []uncastElement{}
+	for _, id := range order {
+		if !cast[id] {
+			uncast = append(uncast, uncastElement{ID: id, Name: names[id]})
+		}
+	}
+	return roles, uncast
+}
+
+// elementName возвращает название элемента, заданное в редакторе
+func elementName(element map[string]interface{}) string {
+	if title, _ := element["title"].(string); title != "" {
+		return title
+	}
+	name, _ := element["name"].(string)
+	return name
+}
+
+// saveProjectCasting сохраняет распределение ролей и пишет историю
+func saveProjectCasting(c *gin.Context, project *models.Project, description string) bool {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return false
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, err = config.ProjectsCollection.UpdateOne(ctx, bson.M{"_id": project.ID},
+		bson.M{"$set": bson.M{"casting": project.Casting, "updatedAt": time.Now()}})
+	if err != nil {
+		config.LogError("CASTING", fmt.Errorf("failed to save casting of project %s: %w", project.ID.Hex(), err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save casting"})
+		return false
+	}
+
+	middleware.Audit(c).Summary = description
+	announceProjectUpdate(ctx, userID, project.ID, description)
+	return true
+}
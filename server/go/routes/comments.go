@@ -0,0 +1,664 @@
+package routes
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kktjss/dance-flow/config"
+	"github.com/kktjss/dance-flow/middleware"
+	"github.com/kktjss/dance-flow/models"
+	"github.com/kktjss/dance-flow/notify"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Регистрирует маршруты веток комментариев проекта. Комментировать может
+// любой, кто может просматривать проект.
+func RegisterCommentRoutes(router *gin.RouterGroup, cfg *config.Config) {
+	comments := router.Group("/projects/:id/comments")
+	comments.Use(middleware.JWTMiddleware(cfg))
+	{
+		comments.GET("", middleware.CheckProjectIsPrivate(), getCommentThreads)
+		comments.POST("", middleware.CheckProjectIsPrivate(), createCommentThread)
+		comments.GET("/:commentId", middleware.CheckProjectIsPrivate(), getCommentThread)
+		comments.PUT("/:commentId", middleware.CheckProjectIsPrivate(), updateComment)
+		comments.DELETE("/:commentId", middleware.CheckProjectIsPrivate(), deleteComment)
+		comments.POST("/:commentId/replies", middleware.CheckProjectIsPrivate(), replyToComment)
+		comments.POST("/:commentId/resolve", middleware.CheckProjectIsPrivate(), resolveCommentThread)
+		comments.POST("/:commentId/unresolve", middleware.CheckProjectIsPrivate(), unresolveCommentThread)
+	}
+}
+
+// commentAuthor - публичные данные автора или упомянутого пользователя
+type commentAuthor struct {
+	ID       primitive.ObjectID `json:"id"`
+	Username string             `json:"username"`
+	Name     string             `json:"name,omitempty"`
+}
+
+// Возвращает ветки проекта по времени постановки. Фильтры: ?status=open или
+// resolved, ?from= и ?to= - интервал в секундах, ?elementId=, ?author= и
+// ?mentions= - ID пользователя или me (упоминание в ветке или в ответах).
+// ?limit= и ?offset= - страница.
+func getCommentThreads(c *gin.Context) {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+	projectID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid project ID format"})
+		return
+	}
+
+	filter := bson.M{"projectId": projectID, "threadId": bson.M{"$exists": false}}
+	switch c.Query("status") {
+	case "", "all":
+	case "open":
+		filter["resolved"] = false
+	case "resolved":
+		filter["resolved"] = true
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "status must be open, resolved or all"})
+		return
+	}
+
+	timeRange := bson.M{}
+	for name, operator := range map[string]string{"from": "$gte", "to": "$lte"} {
+		if value := c.Query(name); value != "" {
+			seconds, err := strconv.ParseFloat(value, 64)
+			if err != nil || math.IsNaN(seconds) || math.IsInf(seconds, 0) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": name + " must be a number of seconds"})
+				return
+			}
+			timeRange[operator] = seconds
+		}
+	}
+	if len(timeRange) > 0 {
+		filter["time"] = timeRange
+	}
+	if elementID := c.Query("elementId"); elementID != "" {
+		filter["elementId"] = elementID
+	}
+	people := map[string]primitive.ObjectID{}
+	for _, name := range []string{"author", "mentions"} {
+		value := c.Query(name)
+		if value == "" {
+			continue
+		}
+		id := userID
+		if value != "me" {
+			if id, err = primitive.ObjectIDFromHex(value); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": name + " must be a user ID or me"})
+				return
+			}
+		}
+		people[name] = id
+	}
+	if id, ok := people["author"]; ok {
+		filter["authorId"] = id
+	}
+
+	limit, offset := models.DefaultCommentsLimit, 0
+	if value := c.Query("limit"); value != "" {
+		if limit, err = strconv.Atoi(value); err != nil || limit < 1 || limit > models.MaxCommentsLimit {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("limit must be between 1 and %d", models.MaxCommentsLimit)})
+			return
+		}
+	}
+	if value := c.Query("offset"); value != "" {
+		if offset, err = strconv.Atoi(value); err != nil || offset < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "offset must be a non-negative integer"})
+			return
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// Упоминание в ответе тоже относит ветку к упомянутому пользователю
+	if id, ok := people["mentions"]; ok {
+		threadIDs, err := config.CommentsCollection.Distinct(ctx, "threadId",
+			bson.M{"projectId": projectID, "mentions": id, "threadId": bson.M{"$exists": true}})
+		if err != nil {
+			config.LogError("COMMENTS", fmt.Errorf("failed to find mentions in project %s: %w", projectID.Hex(), err))
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get comments"})
+			return
+		}
+		filter["$or"] = []bson.M{{"mentions": id}, {"_id": bson.M{"$in": threadIDs}}}
+	}
+
+	total, err := config.CommentsCollection.CountDocuments(ctx, filter)
+	if err != nil {
+		config.LogError("COMMENTS", fmt.Errorf("failed to count comments of project %s: %w", projectID.Hex(), err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get comments"})
+		return
+	}
+	cursor, err := config.CommentsCollection.Find(ctx, filter, options.Find().
+		SetSort(bson.D{{Key: "time", Value: 1}, {Key: "createdAt", Value: 1}}).
+		SetSkip(int64(offset)).
+		SetLimit(int64(limit)))
+	if err != nil {
+		config.LogError("COMMENTS", fmt.Errorf("failed to find comments of project %s: %w", projectID.Hex(), err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get comments"})
+		return
+	}
+	threads := []models.Comment{}
+	if err := cursor.All(ctx, &threads); err != nil {
+		config.LogError("COMMENTS", fmt.Errorf("failed to decode comments: %w", err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get comments"})
+		return
+	}
+
+	users, err := commentUsers(ctx, threads)
+	if err != nil {
+		config.LogError("COMMENTS", fmt.Errorf("failed to load comment authors: %w", err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get comments"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"threads": threads, "total": total, "users": users})
+}
+
+// Возвращает ветку с ответами в порядке написания
+func getCommentThread(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	thread, ok := loadComment(ctx, c)
+	if !ok {
+		return
+	}
+	if !thread.IsThread() {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Comment thread not found"})
+		return
+	}
+
+	cursor, err := config.CommentsCollection.Find(ctx, bson.M{"threadId": thread.ID},
+		options.Find().SetSort(bson.D{{Key: "createdAt", Value: 1}, {Key: "_id", Value: 1}}))
+	if err != nil {
+		config.LogError("COMMENTS", fmt.Errorf("failed to find replies of comment %s: %w", thread.ID.Hex(), err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get comment thread"})
+		return
+	}
+	replies := []models.Comment{}
+	if err := cursor.All(ctx, &replies); err != nil {
+		config.LogError("COMMENTS", fmt.Errorf("failed to decode replies: %w", err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get comment thread"})
+		return
+	}
+
+	users, err := commentUsers(ctx, append([]models.Comment{*thread}, replies...))
+	if err != nil {
+		config.LogError("COMMENTS", fmt.Errorf("failed to load comment authors: %w", err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get comment thread"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"thread": thread, "replies": replies, "users": users})
+}
+
+// Открывает ветку. Тело: body - текст с @упоминаниями, time - момент в
+// секундах, elementId и region - необязательные элемент и область кадра
+// видео в долях его размеров.
+func createCommentThread(c *gin.Context) {
+	var input models.CommentInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if input.Time == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "time is required"})
+		return
+	}
+	if err := input.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	body, err := models.ValidateCommentBody(input.Body)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+	projectID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid project ID format"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	project, err := loadProject(ctx, projectID)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Project not found"})
+		} else {
+			config.LogError("COMMENTS", fmt.Errorf("failed to load project %s: %w", projectID.Hex(), err))
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get project"})
+		}
+		return
+	}
+	if input.ElementID != "" && !projectHasElement(project, input.ElementID) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Element %s not found in project", input.ElementID)})
+		return
+	}
+	mentions, ok := resolveCommentMentions(ctx, c, project, body)
+	if !ok {
+		return
+	}
+
+	now := time.Now()
+	comment := models.Comment{
+		ID:             primitive.NewObjectID(),
+		ProjectID:      projectID,
+		AuthorID:       userID,
+		Body:           body,
+		Time:           *input.Time,
+		ElementID:      input.ElementID,
+		Region:         input.Region,
+		Mentions:       mentions,
+		LastActivityAt: now,
+		CreatedAt:      now,
+	}
+	if _, err := config.CommentsCollection.InsertOne(ctx, comment); err != nil {
+		config.LogError("COMMENTS", fmt.Errorf("failed to create comment in project %s: %w", projectID.Hex(), err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create comment"})
+		return
+	}
+	notify.Mentioned(ctx, &comment, mentions)
+	middleware.Audit(c).TargetID = comment.ID.Hex()
+	c.JSON(http.StatusCreated, comment)
+}
+
+// Отвечает в ветке. Тело: body - текст с @упоминаниями. Ответ в решённой
+// ветке снова открывает её.
+func replyToComment(c *gin.Context) {
+	var input models.CommentInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	body, err := models.ValidateCommentBody(input.Body)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	thread, ok := loadComment(ctx, c)
+	if !ok {
+		return
+	}
+	if !thread.IsThread() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Replies go to the thread, not to another reply"})
+		return
+	}
+	if thread.ReplyCount >= models.MaxThreadReplies {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("A thread can have at most %d replies", models.MaxThreadReplies)})
+		return
+	}
+	project, err := loadProject(ctx, thread.ProjectID)
+	if err != nil {
+		config.LogError("COMMENTS", fmt.Errorf("failed to load project %s: %w", thread.ProjectID.Hex(), err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get project"})
+		return
+	}
+	mentions, ok := resolveCommentMentions(ctx, c, project, body)
+	if !ok {
+		return
+	}
+
+	now := time.Now()
+	reply := models.Comment{
+		ID:             primitive.NewObjectID(),
+		ProjectID:      thread.ProjectID,
+		ThreadID:       &thread.ID,
+		AuthorID:       userID,
+		Body:           body,
+		Time:           thread.Time,
+		ElementID:      thread.ElementID,
+		Mentions:       mentions,
+		LastActivityAt: now,
+		CreatedAt:      now,
+	}
+	if _, err := config.CommentsCollection.InsertOne(ctx, reply); err != nil {
+		config.LogError("COMMENTS", fmt.Errorf("failed to reply to comment %s: %w", thread.ID.Hex(), err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create reply"})
+		return
+	}
+	_, err = config.CommentsCollection.UpdateOne(ctx, bson.M{"_id": thread.ID}, bson.M{
+		"$inc":   bson.M{"replyCount": 1},
+		"$set":   bson.M{"lastActivityAt": now, "resolved": false},
+		"$unset": bson.M{"resolvedBy": "", "resolvedAt": ""},
+	})
+	if err != nil {
+		config.LogError("COMMENTS", fmt.Errorf("failed to update thread %s: %w", thread.ID.Hex(), err))
+	}
+	notify.Mentioned(ctx, &reply, mentions)
+	middleware.Audit(c).TargetID = reply.ID.Hex()
+	c.JSON(http.StatusCreated, reply)
+}
+
+// Изменяет текст комментария. Доступно только автору.
+func updateComment(c *gin.Context) {
+	var input models.CommentInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	body, err := models.ValidateCommentBody(input.Body)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	comment, ok := loadComment(ctx, c)
+	if !ok {
+		return
+	}
+	if comment.AuthorID != userID {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only the author can edit a comment"})
+		return
+	}
+	project, err := loadProject(ctx, comment.ProjectID)
+	if err != nil {
+		config.LogError("COMMENTS", fmt.Errorf("failed to load project %s: %w", comment.ProjectID.Hex(), err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get project"})
+		return
+	}
+	mentions, ok := resolveCommentMentions(ctx, c, project, body)
+	if !ok {
+		return
+	}
+
+	// Уведомляются только впервые упомянутые в этой правке
+	added := []primitive.ObjectID{}
+	for _, id := range mentions {
+		known := false
+		for _, previous := range comment.Mentions {
+			known = known || previous == id
+		}
+		if !known {
+			added = append(added, id)
+		}
+	}
+
+	now := time.Now()
+	comment.Body = body
+	comment.Mentions = mentions
+	comment.EditedAt = &now
+	_, err = config.CommentsCollection.UpdateOne(ctx, bson.M{"_id": comment.ID},
+		bson.M{"$set": bson.M{"body": body, "mentions": mentions, "editedAt": now}})
+	if err != nil {
+		config.LogError("COMMENTS", fmt.Errorf("failed to update comment %s: %w", comment.ID.Hex(), err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update comment"})
+		return
+	}
+	notify.Mentioned(ctx, comment, added)
+	c.JSON(http.StatusOK, comment)
+}
+
+// Удаляет комментарий, а для ветки - и все ответы. Доступно автору и
+// владельцу проекта.
+func deleteComment(c *gin.Context) {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	comment, ok := loadComment(ctx, c)
+	if !ok {
+		return
+	}
+	if comment.AuthorID != userID {
+		project, err := loadProject(ctx, comment.ProjectID)
+		if err != nil {
+			config.LogError("COMMENTS", fmt.Errorf("failed to load project %s: %w", comment.ProjectID.Hex(), err))
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get project"})
+			return
+		}
+		if project.Owner != userID {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Only the author or the project owner can delete a comment"})
+			return
+		}
+	}
+
+	filter := bson.M{"_id": comment.ID}
+	if comment.IsThread() {
+		filter = bson.M{"$or": []bson.M{{"_id": comment.ID}, {"threadId": comment.ID}}}
+	}
+	if _, err := config.CommentsCollection.DeleteMany(ctx, filter); err != nil {
+		config.LogError("COMMENTS", fmt.Errorf("failed to delete comment %s: %w", comment.ID.Hex(), err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete comment"})
+		return
+	}
+	if !comment.IsThread() {
+		_, err := config.CommentsCollection.UpdateOne(ctx, bson.M{"_id": *comment.ThreadID},
+			bson.M{"$inc": bson.M{"replyCount": -1}})
+		if err != nil {
+			config.LogError("COMMENTS", fmt.Errorf("failed to update thread %s: %w", comment.ThreadID.Hex(), err))
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Comment deleted"})
+}
+
+// Отмечает ветку решённой
+func resolveCommentThread(c *gin.Context) {
+	setCommentThreadResolved(c, true)
+}
+
+// Снова открывает решённую ветку
+func unresolveCommentThread(c *gin.Context) {
+	setCommentThreadResolved(c, false)
+}
+
+// setCommentThreadResolved меняет состояние ветки. Решать и открывать ветки
+// могут автор ветки и те, кто может изменять проект.
+func setCommentThreadResolved(c *gin.Context, resolved bool) {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	thread, ok := loadComment(ctx, c)
+	if !ok {
+		return
+	}
+	if !thread.IsThread() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Only threads can be resolved"})
+		return
+	}
+	if thread.AuthorID != userID {
+		project, err := loadProject(ctx, thread.ProjectID)
+		if err != nil {
+			config.LogError("COMMENTS", fmt.Errorf("failed to load project %s: %w", thread.ProjectID.Hex(), err))
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get project"})
+			return
+		}
+		if !middleware.CanEditProject(ctx, userID, project) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Only the thread author or project editors can resolve a thread"})
+			return
+		}
+	}
+
+	now := time.Now()
+	update := bson.M{
+		"$set":   bson.M{"resolved": false, "lastActivityAt": now},
+		"$unset": bson.M{"resolvedBy": "", "resolvedAt": ""},
+	}
+	thread.Resolved, thread.ResolvedBy, thread.ResolvedAt = false, nil, nil
+	if resolved {
+		update = bson.M{"$set": bson.M{"resolved": true, "resolvedBy": userID, "resolvedAt": now, "lastActivityAt": now}}
+		thread.Resolved, thread.ResolvedBy, thread.ResolvedAt = true, &userID, &now
+	}
+	thread.LastActivityAt = now
+	if _, err := config.CommentsCollection.UpdateOne(ctx, bson.M{"_id": thread.ID}, update); err != nil {
+		config.LogError("COMMENTS", fmt.Errorf("failed to resolve thread %s: %w", thread.ID.Hex(), err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update comment thread"})
+		return
+	}
+	c.JSON(http.StatusOK, thread)
+}
+
+// loadComment загружает комментарий из параметра :commentId и проверяет,
+// что он относится к проекту :id. При ошибке ответ уже отправлен.
+func loadComment(ctx context.Context, c *gin.Context) (*models.Comment, bool) {
+	projectID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid project ID format"})
+		return nil, false
+	}
+	commentID, err := primitive.ObjectIDFromHex(c.Param("commentId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid comment ID format"})
+		return nil, false
+	}
+
+	var comment models.Comment
+	err = config.CommentsCollection.FindOne(ctx, bson.M{"_id": commentID, "projectId": projectID}).Decode(&comment)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Comment not found"})
+		} else {
+			config.LogError("COMMENTS", fmt.Errorf("failed to load comment %s: %w", commentID.Hex(), err))
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get comment"})
+		}
+		return nil, false
+	}
+	return &comment, true
+}
+
+// resolveCommentMentions сопоставляет @упоминания в тексте с владельцем
+// проекта и участниками его команды. Упоминания других пользователей
+// остаются обычным текстом.
+func resolveCommentMentions(ctx context.Context, c *gin.Context, project *models.Project, body string) ([]primitive.ObjectID, bool) {
+	mentions := []primitive.ObjectID{}
+	names := models.ParseMentions(body)
+	if len(names) == 0 {
+		return mentions, true
+	}
+	if len(names) > models.MaxCommentMentions {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("A comment can mention at most %d people", models.MaxCommentMentions)})
+		return nil, false
+	}
+
+	candidates := []primitive.ObjectID{project.Owner}
+	if !project.TeamID.IsZero() {
+		var team models.Team
+		err := config.TeamsCollection.FindOne(ctx, bson.M{"_id": project.TeamID}).Decode(&team)
+		if err != nil && err != mongo.ErrNoDocuments {
+			config.LogError("COMMENTS", fmt.Errorf("failed to load team %s: %w", project.TeamID.Hex(), err))
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to resolve mentions"})
+			return nil, false
+		}
+		if err == nil {
+			candidates = append(candidates, team.Owner)
+			for _, member := range team.Members {
+				candidates = append(candidates, member.UserID)
+			}
+		}
+	}
+
+	users, err := findCommentUsers(ctx, candidates)
+	if err != nil {
+		config.LogError("COMMENTS", fmt.Errorf("failed to load mentioned users: %w", err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to resolve mentions"})
+		return nil, false
+	}
+	byName := map[string]primitive.ObjectID{}
+	for _, user := range users {
+		byName[strings.ToLower(user.Username)] = user.ID
+	}
+	seen := map[primitive.ObjectID]bool{}
+	for _, name := range names {
+		if id, ok := byName[strings.ToLower(name)]; ok && !seen[id] {
+			seen[id] = true
+			mentions = append(mentions, id)
+		}
+	}
+	return mentions, true
+}
+
+// commentUsers возвращает авторов и упомянутых пользователей комментариев по ID
+func commentUsers(ctx context.Context, comments []models.Comment) (map[string]commentAuthor, error) {
+	ids := []primitive.ObjectID{}
+	for _, comment := range comments {
+		ids = append(ids, comment.AuthorID)
+		ids = append(ids, comment.Mentions...)
+		if comment.ResolvedBy != nil {
+			ids = append(ids, *comment.ResolvedBy)
+		}
+	}
+	users, err := findCommentUsers(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	result := map[string]commentAuthor{}
+	for _, user := range users {
+		result[user.ID.Hex()] = commentAuthor{ID: user.ID, Username: user.Username, Name: user.Name}
+	}
+	return result, nil
+}
+
+// findCommentUsers загружает имена пользователей по ID
+func findCommentUsers(ctx context.Context, ids []primitive.ObjectID) ([]models.User, error) {
+	users := []models.User{}
+	if len(ids) == 0 {
+		return users, nil
+	}
+	cursor, err := config.UsersCollection.Find(ctx, bson.M{"_id": bson.M{"$in": ids}},
+		options.Find().SetProjection(bson.M{"username": 1, "name": 1}))
+	if err != nil {
+		return nil, err
+	}
+	if err := cursor.All(ctx, &users); err != nil {
+		return nil, err
+	}
+	return users, nil
+}
+
+// projectHasElement сообщает, что в проекте есть элемент с таким ID
+func projectHasElement(project *models.Project, id string) bool {
+	for _, raw := range project.Elements {
+		if element, ok := raw.(map[string]interface{}); ok && element["id"] == id {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,90 @@
+package routes
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/kktjss/dance-flow/config"
+	"github.com/kktjss/dance-flow/models"
+	"github.com/kktjss/dance-flow/notify"
+	"github.com/kktjss/dance-flow/webhook"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// webhookDispatcher доставляет события во внешние сервисы
+var webhookDispatcher *webhook.Dispatcher
+
+// publishWebhookEvent отправляет событие подписанным вебхукам. Ошибка
+// только записывается в журнал: запрос пользователя уже выполнен.
+func publishWebhookEvent(ctx context.Context, event webhook.Event) {
+	if webhookDispatcher == nil {
+		return
+	}
+	if _, err := webhookDispatcher.Publish(ctx, event); err != nil {
+		config.LogError("WEBHOOKS", fmt.Errorf("failed to publish %s event: %w", event.Type, err))
+	}
+}
+
+// projectWebhookEvent создаёт событие проекта для вебхуков его команды и владельца
+func projectWebhookEvent(eventType string, project *models.Project, actorID primitive.ObjectID, data interface{}) webhook.Event {
+	event := webhook.NewEvent(eventType, data)
+	projectID := project.ID
+	event.ProjectID = &projectID
+	if !project.TeamID.IsZero() {
+		teamID := project.TeamID
+		event.TeamID = &teamID
+	}
+	if !actorID.IsZero() {
+		event.ActorID = &actorID
+	}
+	event.UserID = project.Owner
+	return event
+}
+
+// projectEventData - данные событий проекта
+func projectEventData(project *models.Project, description string) bson.M {
+	data := bson.M{
+		"projectId": project.ID,
+		"name":      projectDisplayName(project),
+		"updatedAt": project.UpdatedAt,
+	}
+	if !project.TeamID.IsZero() {
+		data["teamId"] = project.TeamID
+	}
+	if description != "" {
+		data["description"] = description
+	}
+	return data
+}
+
+// announceProjectUpdate сообщает об изменении проекта участникам команды и
+// вебхукам
+func announceProjectUpdate(ctx context.Context, actorID, projectID primitive.ObjectID, description string) {
+	notify.TeamProjectUpdated(ctx, actorID, projectID, description)
+
+	var project models.Project
+	err := config.ProjectsCollection.FindOne(ctx, bson.M{"_id": projectID},
+		options.FindOne().SetProjection(bson.M{"name": 1, "title": 1, "owner": 1, "teamId": 1, "updatedAt": 1})).Decode(&project)
+	if err != nil {
+		config.LogError("WEBHOOKS", fmt.Errorf("failed to load project %s: %w", projectID.Hex(), err))
+		return
+	}
+	publishWebhookEvent(ctx, projectWebhookEvent(models.WebhookProjectUpdated, &project, actorID, projectEventData(&project, description)))
+}
+
+// teamMemberWebhookEvent создаёт событие состава команды
+func teamMemberWebhookEvent(eventType string, team *models.Team, actorID, userID primitive.ObjectID, role string) webhook.Event {
+	event := webhook.NewEvent(eventType, bson.M{
+		"teamId":   team.ID,
+		"teamName": team.Name,
+		"userId":   userID,
+		"role":     role,
+	})
+	teamID := team.ID
+	event.TeamID = &teamID
+	event.ActorID = &actorID
+	event.UserID = userID
+	return event
+}
@@ -0,0 +1,408 @@
+package routes
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kktjss/dance-flow/config"
+	"github.com/kktjss/dance-flow/formation"
+	"github.com/kktjss/dance-flow/middleware"
+	"github.com/kktjss/dance-flow/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Масштаб холста, на который выводятся позиции проекта в метрах
+const formationPixelsPerMetre = 100.0
+
+// Регистрирует маршруты печатных схем и проверки расстановки
+func RegisterFormationRoutes(router *gin.RouterGroup, cfg *config.Config) {
+	formations := router.Group("/projects/:id/formations")
+	formations.Use(middleware.JWTMiddleware(cfg))
+	{
+		formations.GET("", middleware.CheckProjectIsPrivate(), getFormations)
+		formations.GET("/conflicts", middleware.CheckProjectIsPrivate(), getFormationConflicts)
+		formations.POST("/transition", middleware.CheckProjectAccess(), planFormationTransition)
+	}
+}
+
+// Возвращает схемы расстановки элементов проекта. Моменты задаются параметром
+// ?times=0,12.5,30 (в секундах), без него - все моменты ключевых кадров.
+// Формат: ?format=pdf (по умолчанию), svg или json. Размер холста, в котором
+// заданы позиции, передаётся в ?stageWidth= и ?stageHeight= (только для
+// проектов в пикселях; у проектов в метрах берётся сцена проекта).
+func getFormations(c *gin.Context) {
+	projectID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid project ID format"})
+		return
+	}
+
+	format := c.DefaultQuery("format", "pdf")
+	if format != "pdf" && format != "svg" && format != "json" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "format must be pdf, svg or json"})
+		return
+	}
+	stage := formation.Stage{Width: defaultStageWidth, Height: defaultStageHeight, CenterLine: true}
+	for _, param := range []struct {
+		name  string
+		value *float64
+	}{{"stageWidth", &stage.Width}, {"stageHeight", &stage.Height}} {
+		name, value := param.name, param.value
+		raw := c.Query(name)
+		if raw == "" {
+			continue
+		}
+		parsed, err := strconv.ParseFloat(raw, 64)
+		if err != nil || !(parsed > 0) || math.IsInf(parsed, 0) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": name + " must be a positive number"})
+			return
+		}
+		*value = parsed
+	}
+
+	var times []float64
+	if raw := strings.TrimSpace(c.Query("times")); raw != "" {
+		for _, part := range strings.Split(raw, ",") {
+			t, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+			if err != nil || !(t >= 0) || math.IsInf(t, 0) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Invalid time %q", part)})
+				return
+			}
+			times = append(times, t)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	project, err := loadProject(ctx, projectID)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Project not found"})
+		} else {
+			config.LogError("FORMATIONS", fmt.Errorf("failed to load project %s: %w", projectID.Hex(), err))
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get project"})
+		}
+		return
+	}
+
+	// Размер холста из запроса используется только для проектов в пикселях
+	if view := stageFormationCanvas(project); view != nil {
+		stage = formationStage(view)
+	}
+
+	if times == nil {
+		times = formation.KeyframeTimes(project.Elements)
+		if len(times) == 0 {
+			times = []float64{0}
+		}
+	}
+	charts, err := formation.Build(project.Elements, times, stage)
+	if err == formation.ErrTooManyCharts {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("At most %d charts can be rendered at once, pass ?times=", formation.MaxCharts)})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if format == "json" {
+		c.JSON(http.StatusOK, gin.H{"stage": stage, "charts": charts})
+		return
+	}
+
+	title := project.Title
+	if title == "" {
+		title = project.Name
+	}
+	doc := &formation.Document{Title: title, Stage: stage, Charts: charts}
+
+	var buf bytes.Buffer
+	contentType := "application/pdf"
+	if format == "svg" {
+		contentType = "image/svg+xml"
+		err = formation.WriteSVG(&buf, doc)
+	} else {
+		err = formation.WritePDF(&buf, doc)
+	}
+	if err != nil {
+		config.LogError("FORMATIONS", fmt.Errorf("failed to render formations of project %s: %w", projectID.Hex(), err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to render formations"})
+		return
+	}
+
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s-formations.%s"`, projectID.Hex(), format))
+	c.Data(http.StatusOK, contentType, buf.Bytes())
+}
+
+// Проверяет расстановку на сближения элементов и пересечения их путей в одно
+// время. Параметры: ?minDistance= - минимальное расстояние между центрами в
+// единицах проекта (по умолчанию элементы не должны пересекаться), ?step= -
+// шаг выборки в секундах, ?from= и ?to= - интервал, ?elementIds=a,b - элементы.
+func getFormationConflicts(c *gin.Context) {
+	projectID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid project ID format"})
+		return
+	}
+
+	var opts formation.ConflictOptions
+	for _, param := range []struct {
+		name  string
+		value *float64
+	}{{"minDistance", &opts.MinDistance}, {"step", &opts.Step}, {"from", &opts.From}, {"to", &opts.To}} {
+		raw := c.Query(param.name)
+		if raw == "" {
+			continue
+		}
+		parsed, err := strconv.ParseFloat(raw, 64)
+		if err != nil || !(parsed >= 0) || math.IsInf(parsed, 0) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": param.name + " must be a non-negative number"})
+			return
+		}
+		*param.value = parsed
+	}
+	if raw := c.Query("elementIds"); raw != "" {
+		for _, id := range strings.Split(raw, ",") {
+			if id = strings.TrimSpace(id); id != "" {
+				opts.ElementIDs = append(opts.ElementIDs, id)
+			}
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	project, err := loadProject(ctx, projectID)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Project not found"})
+		} else {
+			config.LogError("FORMATIONS", fmt.Errorf("failed to load project %s: %w", projectID.Hex(), err))
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get project"})
+		}
+		return
+	}
+
+	// Проект в метрах проверяется на холсте сцены, расстояния переводятся обратно в метры
+	view := stageFormationCanvas(project)
+	scale := 1.0
+	if view != nil {
+		scale = view.Scale
+	}
+	minDistance := opts.MinDistance
+	opts.MinDistance *= scale
+
+	conflicts, err := formation.FindConflicts(project.Elements, opts)
+	if err == formation.ErrTooManySamples || err == formation.ErrTooManyElements {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error() + ", narrow the interval or increase the step"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if view != nil {
+		for i := range conflicts {
+			conflicts[i].Distance /= scale
+			conflicts[i].Required /= scale
+			position := view.ToStage(models.Position{X: conflicts[i].Position.X, Y: conflicts[i].Position.Y})
+			conflicts[i].Position = formation.Point{X: position.X, Y: position.Y}
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"units":       projectUnits(project),
+		"minDistance": minDistance,
+		"conflicts":   conflicts,
+	})
+}
+
+// Планирует переход между расстановками и записывает пути танцоров в
+// ключевые кадры. Тело: from и to - моменты расстановок A и B в секундах,
+// targets - точки расстановки B в единицах проекта (по умолчанию положения
+// танцоров в момент to), elementIds - танцоры, minDistance - минимальное
+// расстояние между центрами, dryRun - только вернуть план без сохранения.
+func planFormationTransition(c *gin.Context) {
+	projectID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid project ID format"})
+		return
+	}
+
+	var input struct {
+		From        *float64          `json:"from" binding:"required"`
+		To          *float64          `json:"to" binding:"required"`
+		Targets     []formation.Point `json:"targets"`
+		ElementIDs  []string          `json:"elementIds"`
+		MinDistance float64           `json:"minDistance"`
+		DryRun      bool              `json:"dryRun"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if *input.From < 0 || !(*input.To > *input.From) || math.IsInf(*input.To, 0) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "to must be after from"})
+		return
+	}
+	if input.MinDistance < 0 || math.IsInf(input.MinDistance, 0) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "minDistance must be a non-negative number"})
+		return
+	}
+	// Матрица стоимостей растёт как танцоры × точки: число точек ограничено так же, как танцоров
+	if len(input.Targets) > formation.MaxTransitionDancers {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("at most %d targets are allowed", formation.MaxTransitionDancers)})
+		return
+	}
+
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	project, err := loadProject(ctx, projectID)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Project not found"})
+		} else {
+			config.LogError("FORMATIONS", fmt.Errorf("failed to load project %s: %w", projectID.Hex(), err))
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get project"})
+		}
+		return
+	}
+
+	// Проект в метрах планируется на холсте сцены, результат переводится обратно в метры
+	view := stageFormationCanvas(project)
+	scale := 1.0
+	toCanvas := func(p formation.Point) formation.Point { return p }
+	toStage := func(p formation.Point) formation.Point { return p }
+	if view != nil {
+		scale = view.Scale
+		toCanvas = func(p formation.Point) formation.Point {
+			position := view.ToCanvas(models.Position{X: p.X, Y: p.Y})
+			return formation.Point{X: position.X, Y: position.Y}
+		}
+		toStage = func(p formation.Point) formation.Point {
+			position := view.ToStage(models.Position{X: p.X, Y: p.Y})
+			return formation.Point{X: position.X, Y: position.Y}
+		}
+	}
+	targets := make([]formation.Point, len(input.Targets))
+	for i, target := range input.Targets {
+		targets[i] = toCanvas(target)
+	}
+
+	transition, err := formation.PlanTransition(project.Elements, formation.TransitionOptions{
+		From:        *input.From,
+		To:          *input.To,
+		Targets:     targets,
+		MinDistance: input.MinDistance * scale,
+		ElementIDs:  input.ElementIDs,
+	})
+	if errors.Is(err, formation.ErrUnknownElement) || err == formation.ErrNotEnoughTargets ||
+		err == formation.ErrTooManyDancers || err == formation.ErrInvalidTransition {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	formation.ApplyTransition(project.Elements, transition)
+
+	// Оставшиеся сближения проверяются по записанным ключевым кадрам
+	dancerIDs := make([]string, 0, len(transition.Assignments))
+	for _, assignment := range transition.Assignments {
+		dancerIDs = append(dancerIDs, assignment.ElementID)
+	}
+	conflicts, err := formation.FindConflicts(project.Elements, formation.ConflictOptions{
+		MinDistance: input.MinDistance * scale,
+		From:        transition.From,
+		To:          transition.To,
+		ElementIDs:  dancerIDs,
+	})
+	if err != nil {
+		conflicts = []formation.Conflict{}
+	}
+
+	if view != nil {
+		models.ElementsToStage(project.Elements, *view)
+		transition.TotalDistance /= scale
+		for i := range transition.Assignments {
+			assignment := &transition.Assignments[i]
+			assignment.From, assignment.To = toStage(assignment.From), toStage(assignment.To)
+			assignment.Distance /= scale
+		}
+		for _, path := range transition.Paths {
+			for i := range path {
+				path[i].Position = toStage(path[i].Position)
+			}
+		}
+		for i := range conflicts {
+			conflicts[i].Distance /= scale
+			conflicts[i].Required /= scale
+			conflicts[i].Position = toStage(conflicts[i].Position)
+		}
+	}
+
+	// Предпросмотр ничего не меняет и в журнал не попадает
+	middleware.Audit(c).Skip = input.DryRun
+	if !input.DryRun {
+		if err := saveProjectElements(ctx, project, project.Elements); err != nil {
+			respondProjectSaveError(c, "FORMATIONS", project.ID, err, "Failed to save elements")
+			return
+		}
+		description := fmt.Sprintf("Planned transition of %d dancers from %s to %s",
+			len(transition.Assignments), formation.FormatTime(transition.From), formation.FormatTime(transition.To))
+		middleware.Audit(c).Summary = description
+		announceProjectUpdate(ctx, userID, project.ID, description)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"units":      projectUnits(project),
+		"dryRun":     input.DryRun,
+		"transition": transition,
+		"conflicts":  conflicts,
+		"elements":   project.Elements,
+	})
+}
+
+// stageFormationCanvas переводит элементы проекта в метрах на холст сцены,
+// обращённой к зрителям нижней стороной, как принято на печатных схемах.
+// Для проекта в пикселях возвращает nil и не меняет элементы.
+func stageFormationCanvas(project *models.Project) *models.CanvasView {
+	if !project.UsesStageUnits() {
+		return nil
+	}
+	printed := *project.Stage
+	printed.AudienceSide = models.AudienceBottom
+	view := printed.Canvas(printed.Width*formationPixelsPerMetre, printed.Depth*formationPixelsPerMetre)
+	models.ElementsToCanvas(project.Elements, view)
+	return &view
+}
+
+// formationStage описывает для схемы сцену, выведенную на холст view
+func formationStage(view *models.CanvasView) formation.Stage {
+	return formation.Stage{
+		Width:      view.Width,
+		Height:     view.Height,
+		Wing:       view.Stage.WingWidth * view.Scale,
+		Grid:       view.Stage.GridSpacing * view.Scale,
+		CenterLine: view.Stage.CenterLine,
+	}
+}
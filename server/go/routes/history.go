@@ -21,11 +21,11 @@ func RegisterHistoryRoutes(router *gin.RouterGroup, cfg *config.Config) {
 	historyGroup := router.Group("/history")
 	historyGroup.Use(middleware.AuthMiddleware(cfg))
 
+	// Записи создаёт только сервер: клиентский POST /history убран
 	historyGroup.GET("", getHistory)
-	historyGroup.POST("", createHistoryEntry)
 }
 
-// Получает записи истории пользователя
+// Получает последние действия пользователя из журнала аудита
 func getHistory(c *gin.Context) {
 	userID, exists := c.Get("userID")
 	if !exists || userID == nil {
@@ -42,17 +42,17 @@ func getHistory(c *gin.Context) {
 	}
 
 	// Настраиваем запрос для получения истории пользователя
-	collection := config.GetCollection("histories")
+	collection := config.AuditLogCollection
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
 	// Создаем параметры для сортировки и ограничения
 	findOptions := options.Find()
-	findOptions.SetSort(bson.M{"timestamp": -1})
+	findOptions.SetSort(bson.M{"createdAt": -1})
 	findOptions.SetLimit(50)
 
-	// Находим все записи истории для этого пользователя
-	cursor, err := collection.Find(ctx, bson.M{"userId": userObjID}, findOptions)
+	// Находим все действия этого пользователя
+	cursor, err := collection.Find(ctx, bson.M{"actorId": userObjID}, findOptions)
 	if err != nil {
 		log.Printf("[HISTORY] Error fetching history: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error fetching history"})
@@ -61,12 +61,16 @@ func getHistory(c *gin.Context) {
 	defer cursor.Close(ctx)
 
 	// Декодируем результаты
-	var historyEntries []models.History
-	if err := cursor.All(ctx, &historyEntries); err != nil {
+	var events []models.AuditEvent
+	if err := cursor.All(ctx, &events); err != nil {
 		log.Printf("[HISTORY] Error decoding history entries: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error processing history data"})
 		return
 	}
+	historyEntries := make([]models.History, len(events))
+	for i, event := range events {
+		historyEntries[i] = models.HistoryFromAudit(event)
+	}
 
 	// Заполняем заголовки проектов (аналогично populate в Mongoose)
 	populatedEntries, err := populateProjectTitles(ctx, historyEntries)
@@ -80,67 +84,6 @@ func getHistory(c *gin.Context) {
 	c.JSON(http.StatusOK, populatedEntries)
 }
 
-// Создает новую запись в истории
-func createHistoryEntry(c *gin.Context) {
-	var requestBody struct {
-		ProjectID   string `json:"projectId"`
-		Action      string `json:"action"`
-		Description string `json:"description"`
-	}
-
-	if err := c.ShouldBindJSON(&requestBody); err != nil {
-		log.Printf("[HISTORY] Error binding request: %v", err)
-		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid request format"})
-		return
-	}
-
-	userID, exists := c.Get("userID")
-	if !exists || userID == nil {
-		log.Printf("[HISTORY] Error: userID not found in context")
-		c.JSON(http.StatusUnauthorized, gin.H{"message": "Unauthorized"})
-		return
-	}
-	
-	userObjID, err := primitive.ObjectIDFromHex(userID.(string))
-	if err != nil {
-		log.Printf("[HISTORY] Error converting userID to ObjectID: %v", err)
-		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid user ID"})
-		return
-	}
-
-	projectObjID, err := primitive.ObjectIDFromHex(requestBody.ProjectID)
-	if err != nil {
-		log.Printf("[HISTORY] Error converting projectID to ObjectID: %v", err)
-		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid project ID"})
-		return
-	}
-
-	// Создаем запись в истории
-	entry := models.CreateHistory(
-		userObjID,
-		projectObjID,
-		requestBody.Action,
-		requestBody.Description,
-	)
-
-	// Сохраняем в базу данных
-	collection := config.GetCollection("histories")
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
-
-	result, err := collection.InsertOne(ctx, entry)
-	if err != nil {
-		log.Printf("[HISTORY] Error creating history entry: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error creating history entry"})
-		return
-	}
-
-	// Устанавливаем ID из результата вставки
-	entry.ID = result.InsertedID.(primitive.ObjectID)
-
-	c.JSON(http.StatusCreated, entry)
-}
-
 // Вспомогательная функция для заполнения заголовков проектов для записей истории
 func populateProjectTitles(ctx context.Context, entries []models.History) ([]map[string]interface{}, error) {
 	projectsCollection := config.GetCollection("projects")
@@ -34,6 +34,12 @@ func createDirectKeyframe(c *gin.Context) {
 		return
 	}
 
+	// Проверяем данные позы по схеме
+	if err := input.PoseData.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid pose data: " + err.Error()})
+		return
+	}
+
 	// Получаем ID пользователя из контекста
 	userID, err := middleware.GetUserID(c)
 	if err != nil {
@@ -92,6 +98,8 @@ func createDirectKeyframe(c *gin.Context) {
 		return
 	}
 
+	middleware.Audit(c).TargetID = keyframe.ID.Hex()
+	middleware.Audit(c).ProjectID = keyframe.ProjectID
 	c.JSON(http.StatusCreated, keyframe)
 }
 
@@ -138,6 +146,21 @@ func getProjectKeyframes(c *gin.Context) {
 		return
 	}
 
+	// Переводим позы в запрошенный формат скелета, если он указан
+	if skeleton := c.Query("skeleton"); skeleton != "" {
+		for i := range keyframes {
+			if keyframes[i].PoseData == nil {
+				continue
+			}
+			converted, err := keyframes[i].PoseData.ConvertSkeleton(skeleton)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			keyframes[i].PoseData = converted
+		}
+	}
+
 	c.JSON(http.StatusOK, keyframes)
 }
 
@@ -173,6 +196,10 @@ func updateKeyframe(c *gin.Context) {
 		update["$set"].(bson.M)["label"] = input.Label
 	}
 	if input.PoseData != nil {
+		if err := input.PoseData.Validate(); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid pose data: " + err.Error()})
+			return
+		}
 		update["$set"].(bson.M)["poseData"] = input.PoseData
 	}
 	if input.ImageData != "" {
@@ -225,6 +252,7 @@ func updateKeyframe(c *gin.Context) {
 		}
 	}
 
+	middleware.Audit(c).ProjectID = updatedKeyframe.ProjectID
 	c.JSON(http.StatusOK, updatedKeyframe)
 }
 
@@ -280,5 +308,6 @@ func deleteKeyframe(c *gin.Context) {
 		return
 	}
 
+	middleware.Audit(c).ProjectID = keyframe.ProjectID
 	c.JSON(http.StatusOK, gin.H{"message": "Keyframe deleted successfully"})
 } 
\ No newline at end of file
@@ -1,107 +1,132 @@
 package routes
 
 import (
+	"context"
 	"fmt"
 	"net/http"
 	"os"
 	"path/filepath"
+	"regexp"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 	"github.com/kktjss/dance-flow/config"
 	"github.com/kktjss/dance-flow/middleware"
+	"github.com/kktjss/dance-flow/models"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
-// Model представляет 3D модель в системе
-type Model struct {
-	ID           primitive.ObjectID `json:"id" bson:"_id"`
-	Name         string             `json:"name" bson:"name"`
-	Filename     string             `json:"filename" bson:"filename"`
-	OriginalName string             `json:"originalName" bson:"originalName"`
-	Size         int64              `json:"size" bson:"size"`
-	UserID       primitive.ObjectID `json:"userId" bson:"userId"`
-	CreatedAt    time.Time          `json:"createdAt" bson:"createdAt"`
-	URL          string             `json:"url" bson:"-"` // URL не хранится в базе данных
-}
+const modelsDir = "./uploads/models"
 
 // RegisterModelRoutes registers the routes for 3D models
 func RegisterModelRoutes(api *gin.RouterGroup, cfg *config.Config) {
-	models := api.Group("/models")
-	
+	modelsGroup := api.Group("/models")
+
 	// Create models directory if it doesn't exist
-	modelsDir := "./uploads/models"
 	if err := os.MkdirAll(modelsDir, 0755); err != nil {
 		config.LogError("MODELS", fmt.Errorf("failed to create models directory: %w", err))
 	}
-	
+
 	// Public endpoint for accessing model files without authentication
-	models.GET("/file/:filename", func(c *gin.Context) {
+	modelsGroup.GET("/file/:filename", func(c *gin.Context) {
 		filename := c.Param("filename")
 		filePath := filepath.Join(modelsDir, filename)
-		
+
 		// Log the request
 		fmt.Printf("Accessing model file: %s\n", filePath)
-		
+
 		// Check if file exists
 		if _, err := os.Stat(filePath); os.IsNotExist(err) {
 			fmt.Printf("Model file not found: %s\n", filePath)
 			c.JSON(http.StatusNotFound, gin.H{"error": "Model file not found"})
 			return
 		}
-		
+
 		// Set appropriate headers for GLB files
 		c.Header("Content-Type", "model/gltf-binary")
 		c.Header("Access-Control-Allow-Origin", "*")
 		c.Header("Cache-Control", "public, max-age=3600")
-		
+
 		// Serve the file
 		c.File(filePath)
 	})
 
 	// The following routes require authentication
-	authenticated := models.Group("")
+	authenticated := modelsGroup.Group("")
 	authenticated.Use(middleware.JWTMiddleware(cfg))
 
-	// Get all models for the current user
+	// Get models visible to the current user: own, shared with their teams and public
 	authenticated.GET("", func(c *gin.Context) {
-		userID, exists := c.Get("userID")
-		if !exists {
+		userObjectID, err := middleware.GetUserID(c)
+		if err != nil {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
 			return
 		}
 
-		// Convert userID to ObjectID
-		objectID, err := primitive.ObjectIDFromHex(userID.(string))
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		teamIDs, err := findUserTeamIDs(ctx, userObjectID)
 		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID format"})
+			config.LogError("MODELS", fmt.Errorf("error finding user teams: %w", err))
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve models"})
 			return
 		}
 
-		// Get models from database
-		collection := config.GetCollection("models")
-		cursor, err := collection.Find(c, bson.M{"userId": objectID})
-		if err != nil {
-			config.LogError("MODELS", fmt.Errorf("error finding models: %w", err))
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve models"})
+		// Build visibility filter depending on the requested scope
+		var visibility []bson.M
+		scope := c.DefaultQuery("scope", "all")
+		switch scope {
+		case "all":
+			visibility = []bson.M{
+				{"userId": userObjectID},
+				{"visibility": models.ModelVisibilityPublic},
+			}
+			if len(teamIDs) > 0 {
+				visibility = append(visibility, bson.M{
+					"visibility": models.ModelVisibilityTeam,
+					"teamId":     bson.M{"$in": teamIDs},
+				})
+			}
+		case "mine":
+			visibility = []bson.M{{"userId": userObjectID}}
+		case "team":
+			visibility = []bson.M{{
+				"visibility": models.ModelVisibilityTeam,
+				"teamId":     bson.M{"$in": teamIDs},
+			}}
+		case "public":
+			visibility = []bson.M{{"visibility": models.ModelVisibilityPublic}}
+		default:
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Scope must be one of: all, mine, team, public"})
 			return
 		}
-		defer cursor.Close(c)
 
-		// Decode models
-		var modelsList []Model
-		if err := cursor.All(c, &modelsList); err != nil {
-			config.LogError("MODELS", fmt.Errorf("error decoding models: %w", err))
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to decode models"})
+		filter := bson.M{"$or": visibility}
+		if err := applyModelSearchFilters(c, filter); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
+		// Narrow the library to one team; the visibility filter above still applies
+		if teamID := c.Query("teamId"); teamID != "" {
+			teamObjID, err := primitive.ObjectIDFromHex(teamID)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid team ID format"})
+				return
+			}
+			filter["teamId"] = teamObjID
+		}
 
-		// Add URL to each model
-		for i := range modelsList {
-			modelsList[i].URL = fmt.Sprintf("/uploads/models/%s", modelsList[i].Filename)
+		modelsList, err := findModels(ctx, filter)
+		if err != nil {
+			config.LogError("MODELS", fmt.Errorf("error finding models: %w", err))
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve models"})
+			return
 		}
 
 		c.JSON(http.StatusOK, modelsList)
@@ -109,16 +134,9 @@ func RegisterModelRoutes(api *gin.RouterGroup, cfg *config.Config) {
 
 	// Upload a new model
 	authenticated.POST("/upload", func(c *gin.Context) {
-		userID, exists := c.Get("userID")
-		if !exists {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
-			return
-		}
-
-		// Convert userID to ObjectID
-		objectID, err := primitive.ObjectIDFromHex(userID.(string))
+		objectID, err := middleware.GetUserID(c)
 		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID format"})
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
 			return
 		}
 
@@ -136,6 +154,22 @@ func RegisterModelRoutes(api *gin.RouterGroup, cfg *config.Config) {
 			return
 		}
 
+		// Validate sharing options before touching the disk
+		visibility := c.DefaultPostForm("visibility", models.ModelVisibilityPrivate)
+		if !models.IsValidModelVisibility(visibility) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Visibility must be one of: private, team, public"})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		teamObjectID, err := resolveModelTeam(ctx, objectID, visibility, c.PostForm("teamId"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
 		// Generate unique filename
 		uniqueID := uuid.New().String()
 		filename := uniqueID + ext
@@ -156,42 +190,81 @@ func RegisterModelRoutes(api *gin.RouterGroup, cfg *config.Config) {
 			modelName = modelName[:len(modelName)-len(ext)]
 		}
 
+		// Tags may come as repeated fields or as a comma-separated list
+		var tags []string
+		for _, value := range c.PostFormArray("tags") {
+			tags = append(tags, strings.Split(value, ",")...)
+		}
+
 		// Create model record
-		model := Model{
+		model := models.Model{
 			ID:           primitive.NewObjectID(),
 			Name:         modelName,
+			Description:  c.PostForm("description"),
 			Filename:     filename,
 			OriginalName: file.Filename,
 			Size:         file.Size,
 			UserID:       objectID,
+			TeamID:       teamObjectID,
+			Visibility:   visibility,
+			Tags:         models.NormalizeTags(tags),
 			CreatedAt:    time.Now(),
+			UpdatedAt:    time.Now(),
 			URL:          fmt.Sprintf("/uploads/models/%s", filename),
 		}
 
 		// Save to database
 		collection := config.GetCollection("models")
-		_, err = collection.InsertOne(c, model)
+		_, err = collection.InsertOne(ctx, model)
 		if err != nil {
 			config.LogError("MODELS", fmt.Errorf("error inserting model: %w", err))
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save model to database"})
 			return
 		}
 
+		middleware.Audit(c).TargetID = model.ID.Hex()
 		c.JSON(http.StatusCreated, model)
 	})
 
-	// Get a specific model
-	authenticated.GET("/:id", func(c *gin.Context) {
-		userID, exists := c.Get("userID")
-		if !exists {
+	// List all tags used by models visible to the current user
+	authenticated.GET("/tags", func(c *gin.Context) {
+		userObjectID, err := middleware.GetUserID(c)
+		if err != nil {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
 			return
 		}
 
-		// Convert userID to ObjectID
-		userObjectID, err := primitive.ObjectIDFromHex(userID.(string))
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		teamIDs, err := findUserTeamIDs(ctx, userObjectID)
+		if err != nil {
+			config.LogError("MODELS", fmt.Errorf("error finding user teams: %w", err))
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve tags"})
+			return
+		}
+
+		filter := bson.M{"$or": []bson.M{
+			{"userId": userObjectID},
+			{"visibility": models.ModelVisibilityPublic},
+			{"visibility": models.ModelVisibilityTeam, "teamId": bson.M{"$in": teamIDs}},
+		}}
+
+		tags, err := config.GetCollection("models").Distinct(ctx, "tags", filter)
 		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID format"})
+			config.LogError("MODELS", fmt.Errorf("error listing tags: %w", err))
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve tags"})
+			return
+		}
+
+		c.JSON(http.StatusOK, tags)
+	})
+
+	// Get a specific model
+	authenticated.GET("/:id", func(c *gin.Context) {
+		userObjectID, err := middleware.GetUserID(c)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
 			return
 		}
 
@@ -203,10 +276,13 @@ func RegisterModelRoutes(api *gin.RouterGroup, cfg *config.Config) {
 			return
 		}
 
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
 		// Get model from database
 		collection := config.GetCollection("models")
-		var model Model
-		err = collection.FindOne(c, bson.M{"_id": modelObjectID}).Decode(&model)
+		var model models.Model
+		err = collection.FindOne(ctx, bson.M{"_id": modelObjectID}).Decode(&model)
 		if err != nil {
 			if err == mongo.ErrNoDocuments {
 				c.JSON(http.StatusNotFound, gin.H{"error": "Model not found"})
@@ -217,8 +293,8 @@ func RegisterModelRoutes(api *gin.RouterGroup, cfg *config.Config) {
 			return
 		}
 
-		// Check if user owns this model
-		if model.UserID != userObjectID {
+		// Check if user may see this model
+		if !canReadModel(ctx, userObjectID, &model) {
 			c.JSON(http.StatusForbidden, gin.H{"error": "Not authorized to access this model"})
 			return
 		}
@@ -229,18 +305,115 @@ func RegisterModelRoutes(api *gin.RouterGroup, cfg *config.Config) {
 		c.JSON(http.StatusOK, model)
 	})
 
-	// Delete a model
-	authenticated.DELETE("/:id", func(c *gin.Context) {
-		userID, exists := c.Get("userID")
-		if !exists {
+	// Update model metadata and sharing settings
+	authenticated.PUT("/:id", func(c *gin.Context) {
+		userObjectID, err := middleware.GetUserID(c)
+		if err != nil {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
 			return
 		}
 
-		// Convert userID to ObjectID
-		userObjectID, err := primitive.ObjectIDFromHex(userID.(string))
+		modelObjectID, err := primitive.ObjectIDFromHex(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid model ID format"})
+			return
+		}
+
+		var input models.ModelUpdateInput
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		collection := config.GetCollection("models")
+		var model models.Model
+		err = collection.FindOne(ctx, bson.M{"_id": modelObjectID}).Decode(&model)
+		if err != nil {
+			if err == mongo.ErrNoDocuments {
+				c.JSON(http.StatusNotFound, gin.H{"error": "Model not found"})
+				return
+			}
+			config.LogError("MODELS", fmt.Errorf("error finding model: %w", err))
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve model"})
+			return
+		}
+
+		// Only the owner can change a model
+		if model.UserID != userObjectID {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Not authorized to update this model"})
+			return
+		}
+
+		update := bson.M{"updatedAt": time.Now()}
+		unset := bson.M{}
+
+		if input.Name != "" {
+			update["name"] = input.Name
+		}
+		if input.Description != nil {
+			update["description"] = *input.Description
+		}
+		if input.Tags != nil {
+			update["tags"] = models.NormalizeTags(input.Tags)
+		}
+
+		visibility := model.EffectiveVisibility()
+		if input.Visibility != "" {
+			if !models.IsValidModelVisibility(input.Visibility) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Visibility must be one of: private, team, public"})
+				return
+			}
+			visibility = input.Visibility
+			update["visibility"] = visibility
+		}
+
+		teamID := ""
+		if input.TeamID != nil {
+			teamID = *input.TeamID
+		} else if !model.TeamID.IsZero() {
+			teamID = model.TeamID.Hex()
+		}
+
+		teamObjectID, err := resolveModelTeam(ctx, userObjectID, visibility, teamID)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if teamObjectID.IsZero() {
+			unset["teamId"] = ""
+		} else {
+			update["teamId"] = teamObjectID
+		}
+
+		change := bson.M{"$set": update}
+		if len(unset) > 0 {
+			change["$unset"] = unset
+		}
+
+		if _, err := collection.UpdateOne(ctx, bson.M{"_id": modelObjectID}, change); err != nil {
+			config.LogError("MODELS", fmt.Errorf("error updating model: %w", err))
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update model"})
+			return
+		}
+
+		if err := collection.FindOne(ctx, bson.M{"_id": modelObjectID}).Decode(&model); err != nil {
+			config.LogError("MODELS", fmt.Errorf("error finding updated model: %w", err))
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve updated model"})
+			return
+		}
+		model.URL = fmt.Sprintf("/uploads/models/%s", model.Filename)
+
+		c.JSON(http.StatusOK, model)
+	})
+
+	// Delete a model
+	authenticated.DELETE("/:id", func(c *gin.Context) {
+		userObjectID, err := middleware.GetUserID(c)
 		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID format"})
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
 			return
 		}
 
@@ -254,7 +427,7 @@ func RegisterModelRoutes(api *gin.RouterGroup, cfg *config.Config) {
 
 		// Get model from database
 		collection := config.GetCollection("models")
-		var model Model
+		var model models.Model
 		err = collection.FindOne(c, bson.M{"_id": modelObjectID}).Decode(&model)
 		if err != nil {
 			if err == mongo.ErrNoDocuments {
@@ -289,4 +462,208 @@ func RegisterModelRoutes(api *gin.RouterGroup, cfg *config.Config) {
 
 		c.JSON(http.StatusOK, gin.H{"message": "Model deleted successfully"})
 	})
-} 
\ No newline at end of file
+}
+
+// getTeamModels returns the shared model library of a team
+func getTeamModels(c *gin.Context) {
+	teamObjID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid team ID format"})
+		return
+	}
+
+	// The team is fixed by the path and already checked by CheckTeamAccess
+	if teamID := c.Query("teamId"); teamID != "" && teamID != teamObjID.Hex() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "teamId does not match the team in the path"})
+		return
+	}
+
+	filter := bson.M{
+		"visibility": models.ModelVisibilityTeam,
+		"teamId":     teamObjID,
+	}
+	if err := applyModelSearchFilters(c, filter); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	modelsList, err := findModels(ctx, filter)
+	if err != nil {
+		config.LogError("MODELS", fmt.Errorf("error finding team models: %w", err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve team models"})
+		return
+	}
+
+	c.JSON(http.StatusOK, modelsList)
+}
+
+// modelProjectOwners matches projects whose references grant access to the model
+func modelProjectOwners(model *models.Model) []bson.M {
+	owners := []bson.M{{"owner": model.UserID}}
+	if model.EffectiveVisibility() == models.ModelVisibilityTeam && !model.TeamID.IsZero() {
+		owners = append(owners, bson.M{"teamId": model.TeamID})
+	}
+	return owners
+}
+
+// getProjectModels returns model records for the GLB files referenced by a project.
+// Anyone who can read the project can read the models of the project owner, models
+// shared with the project team and public models.
+func getProjectModels(c *gin.Context) {
+	projectObjID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid project ID format"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var project models.Project
+	err = config.ProjectsCollection.FindOne(ctx, bson.M{"_id": projectObjID},
+		options.FindOne().SetProjection(bson.M{"glbAnimations": 1, "owner": 1, "teamId": 1})).Decode(&project)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Project not found"})
+		return
+	}
+
+	filenames := make([]string, 0, len(project.GlbAnimations))
+	for _, animation := range project.GlbAnimations {
+		filenames = append(filenames, models.ModelFilenameFromURL(animation.URL))
+	}
+
+	modelsList := []models.Model{}
+	if len(filenames) > 0 {
+		visibility := []bson.M{
+			{"userId": project.Owner},
+			{"visibility": models.ModelVisibilityPublic},
+		}
+		if !project.TeamID.IsZero() {
+			visibility = append(visibility, bson.M{"visibility": models.ModelVisibilityTeam, "teamId": project.TeamID})
+		}
+		modelsList, err = findModels(ctx, bson.M{"filename": bson.M{"$in": filenames}, "$or": visibility})
+		if err != nil {
+			config.LogError("MODELS", fmt.Errorf("error finding project models: %w", err))
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve project models"})
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, modelsList)
+}
+
+// applyModelSearchFilters adds tag and text search conditions from the query string
+func applyModelSearchFilters(c *gin.Context, filter bson.M) error {
+	var tags []string
+	for _, value := range c.QueryArray("tag") {
+		tags = append(tags, strings.Split(value, ",")...)
+	}
+	if tags = models.NormalizeTags(tags); len(tags) > 0 {
+		filter["tags"] = bson.M{"$all": tags}
+	}
+
+	if search := strings.TrimSpace(c.Query("search")); search != "" {
+		pattern := regexp.QuoteMeta(search)
+		searchFilter := []bson.M{
+			{"name": bson.M{"$regex": pattern, "$options": "i"}},
+			{"description": bson.M{"$regex": pattern, "$options": "i"}},
+			{"originalName": bson.M{"$regex": pattern, "$options": "i"}},
+			{"tags": strings.ToLower(search)},
+		}
+
+		// The visibility filter already occupies $or, so combine through $and
+		if existing, ok := filter["$or"]; ok {
+			delete(filter, "$or")
+			filter["$and"] = []bson.M{{"$or": existing}, {"$or": searchFilter}}
+		} else {
+			filter["$or"] = searchFilter
+		}
+	}
+
+	return nil
+}
+
+// findModels loads models matching the filter and fills their URLs
+func findModels(ctx context.Context, filter bson.M) ([]models.Model, error) {
+	findOptions := options.Find().SetSort(bson.M{"createdAt": -1})
+	cursor, err := config.GetCollection("models").Find(ctx, filter, findOptions)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	modelsList := []models.Model{}
+	if err := cursor.All(ctx, &modelsList); err != nil {
+		return nil, err
+	}
+
+	for i := range modelsList {
+		modelsList[i].URL = fmt.Sprintf("/uploads/models/%s", modelsList[i].Filename)
+	}
+	return modelsList, nil
+}
+
+// resolveModelTeam validates the team a model is shared with
+func resolveModelTeam(ctx context.Context, userID primitive.ObjectID, visibility, teamID string) (primitive.ObjectID, error) {
+	if visibility != models.ModelVisibilityTeam {
+		return primitive.NilObjectID, nil
+	}
+	if teamID == "" {
+		return primitive.NilObjectID, fmt.Errorf("teamId is required for team visibility")
+	}
+
+	teamObjID, err := primitive.ObjectIDFromHex(teamID)
+	if err != nil {
+		return primitive.NilObjectID, fmt.Errorf("invalid team ID format")
+	}
+	if !middleware.IsTeamMember(ctx, userID, teamObjID) {
+		return primitive.NilObjectID, fmt.Errorf("you are not a member of this team")
+	}
+	return teamObjID, nil
+}
+
+// canReadModel checks whether the user may see a model: as its owner, through
+// sharing settings, or through a readable project that references its GLB file.
+// Only projects of the model's owner or of the team it is shared with count:
+// anyone can reference a file in their own project.
+func canReadModel(ctx context.Context, userID primitive.ObjectID, model *models.Model) bool {
+	if model.UserID == userID {
+		return true
+	}
+
+	switch model.EffectiveVisibility() {
+	case models.ModelVisibilityPublic:
+		return true
+	case models.ModelVisibilityTeam:
+		if middleware.IsTeamMember(ctx, userID, model.TeamID) {
+			return true
+		}
+	}
+
+	cursor, err := config.ProjectsCollection.Find(ctx,
+		bson.M{
+			"glbAnimations.url": bson.M{"$regex": regexp.QuoteMeta(model.Filename) + "$"},
+			"$or":               modelProjectOwners(model),
+		},
+		options.Find().SetProjection(bson.M{"owner": 1, "isPrivate": 1, "teamId": 1}),
+	)
+	if err != nil {
+		config.LogError("MODELS", fmt.Errorf("error finding projects referencing model: %w", err))
+		return false
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var project models.Project
+		if err := cursor.Decode(&project); err != nil {
+			continue
+		}
+		if middleware.CanReadProject(ctx, userID, &project) {
+			return true
+		}
+	}
+	return false
+}
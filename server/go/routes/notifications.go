@@ -0,0 +1,263 @@
+package routes
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kktjss/dance-flow/config"
+	"github.com/kktjss/dance-flow/middleware"
+	"github.com/kktjss/dance-flow/models"
+	"github.com/kktjss/dance-flow/notify"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Интервал пустых сообщений потока, чтобы прокси не закрывали соединение
+const notificationKeepAlive = 25 * time.Second
+
+// Регистрирует маршруты центра уведомлений текущего пользователя
+func RegisterNotificationRoutes(router *gin.RouterGroup, cfg *config.Config) {
+	notifications := router.Group("/notifications")
+	notifications.Use(middleware.JWTMiddleware(cfg))
+	{
+		notifications.GET("", getNotifications)
+		notifications.POST("/read-all", markAllNotificationsRead)
+		notifications.POST("/:notificationId/read", markNotificationRead)
+		notifications.GET("/preferences", getNotificationPreferences)
+		notifications.PUT("/preferences", updateNotificationPreferences)
+	}
+
+	// EventSource в браузере не умеет передавать заголовки, поэтому токен
+	// потока можно передать в ?token=
+	stream := router.Group("/notifications/stream")
+	stream.Use(streamTokenFromQuery, middleware.JWTMiddleware(cfg))
+	{
+		stream.GET("", streamNotifications)
+	}
+}
+
+// Возвращает уведомления пользователя, новые сначала. ?unread=true - только
+// непрочитанные, ?limit= и ?offset= - страница.
+func getNotifications(c *gin.Context) {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+	filter := bson.M{"userId": userID}
+	if c.Query("unread") == "true" {
+		filter["read"] = false
+	}
+	limit, offset := models.DefaultNotificationsLimit, 0
+	if value := c.Query("limit"); value != "" {
+		if limit, err = strconv.Atoi(value); err != nil || limit < 1 || limit > models.MaxNotificationsLimit {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("limit must be between 1 and %d", models.MaxNotificationsLimit)})
+			return
+		}
+	}
+	if value := c.Query("offset"); value != "" {
+		if offset, err = strconv.Atoi(value); err != nil || offset < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "offset must be a non-negative integer"})
+			return
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	cursor, err := config.NotificationsCollection.Find(ctx, filter, options.Find().
+		SetSort(bson.D{{Key: "updatedAt", Value: -1}, {Key: "_id", Value: -1}}).
+		SetSkip(int64(offset)).
+		SetLimit(int64(limit)))
+	if err != nil {
+		config.LogError("NOTIFICATIONS", fmt.Errorf("failed to find notifications of user %s: %w", userID.Hex(), err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get notifications"})
+		return
+	}
+	notifications := []models.Notification{}
+	if err := cursor.All(ctx, &notifications); err != nil {
+		config.LogError("NOTIFICATIONS", fmt.Errorf("failed to decode notifications: %w", err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get notifications"})
+		return
+	}
+	unread, err := config.NotificationsCollection.CountDocuments(ctx, bson.M{"userId": userID, "read": false})
+	if err != nil {
+		config.LogError("NOTIFICATIONS", fmt.Errorf("failed to count unread notifications of user %s: %w", userID.Hex(), err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get notifications"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"notifications": notifications, "unread": unread})
+}
+
+// Отмечает уведомление прочитанным
+func markNotificationRead(c *gin.Context) {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+	notificationID, err := primitive.ObjectIDFromHex(c.Param("notificationId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid notification ID format"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	result, err := config.NotificationsCollection.UpdateOne(ctx,
+		bson.M{"_id": notificationID, "userId": userID},
+		bson.M{"$set": bson.M{"read": true, "readAt": time.Now()}})
+	if err != nil {
+		config.LogError("NOTIFICATIONS", fmt.Errorf("failed to mark notification %s read: %w", notificationID.Hex(), err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update notification"})
+		return
+	}
+	if result.MatchedCount == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Notification not found"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Notification marked as read"})
+}
+
+// Отмечает прочитанными все уведомления пользователя
+func markAllNotificationsRead(c *gin.Context) {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	result, err := config.NotificationsCollection.UpdateMany(ctx,
+		bson.M{"userId": userID, "read": false},
+		bson.M{"$set": bson.M{"read": true, "readAt": time.Now()}})
+	if err != nil {
+		config.LogError("NOTIFICATIONS", fmt.Errorf("failed to mark notifications of user %s read: %w", userID.Hex(), err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update notifications"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"updated": result.ModifiedCount})
+}
+
+// Возвращает настройки уведомлений по всем типам
+func getNotificationPreferences(c *gin.Context) {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var user models.User
+	err = config.UsersCollection.FindOne(ctx, bson.M{"_id": userID},
+		options.FindOne().SetProjection(bson.M{"notificationPreferences": 1})).Decode(&user)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"preferences": user.NotificationPreferences.Resolved()})
+}
+
+// Включает и отключает типы уведомлений. Тело: preferences - {тип: bool};
+// неуказанные типы не меняются.
+func updateNotificationPreferences(c *gin.Context) {
+	var input struct {
+		Preferences models.NotificationPreferences `json:"preferences" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := models.ValidateNotificationPreferences(input.Preferences); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	set := bson.M{"updatedAt": time.Now()}
+	for kind, enabled := range input.Preferences {
+		set["notificationPreferences."+kind] = enabled
+	}
+	var user models.User
+	err = config.UsersCollection.FindOneAndUpdate(ctx, bson.M{"_id": userID}, bson.M{"$set": set},
+		options.FindOneAndUpdate().
+			SetReturnDocument(options.After).
+			SetProjection(bson.M{"notificationPreferences": 1})).Decode(&user)
+	if err != nil {
+		config.LogError("NOTIFICATIONS", fmt.Errorf("failed to save notification preferences of user %s: %w", userID.Hex(), err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save notification preferences"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"preferences": user.NotificationPreferences.Resolved()})
+}
+
+// Поток новых уведомлений (server-sent events). Сразу после подключения
+// приходит событие unread с числом непрочитанных, затем notification на
+// каждое новое или обновлённое уведомление.
+func streamNotifications(c *gin.Context) {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	unread, err := config.NotificationsCollection.CountDocuments(ctx, bson.M{"userId": userID, "read": false})
+	cancel()
+	if err != nil {
+		config.LogError("NOTIFICATIONS", fmt.Errorf("failed to count unread notifications of user %s: %w", userID.Hex(), err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to open notification stream"})
+		return
+	}
+
+	notifications, unsubscribe := notify.DefaultHub.Subscribe(userID)
+	defer unsubscribe()
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	// Отключает буферизацию ответа в nginx
+	c.Header("X-Accel-Buffering", "no")
+	c.SSEvent("unread", gin.H{"unread": unread})
+	c.Writer.Flush()
+
+	keepAlive := time.NewTicker(notificationKeepAlive)
+	defer keepAlive.Stop()
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case <-c.Request.Context().Done():
+			return false
+		case notification := <-notifications:
+			c.SSEvent("notification", notification)
+		case <-keepAlive.C:
+			io.WriteString(w, ": keep-alive\n\n")
+		}
+		return true
+	})
+}
+
+// streamTokenFromQuery переносит токен из ?token= в заголовок Authorization
+func streamTokenFromQuery(c *gin.Context) {
+	if token := c.Query("token"); token != "" && c.GetHeader("Authorization") == "" {
+		c.Request.Header.Set("Authorization", "Bearer "+token)
+	}
+	c.Next()
+}
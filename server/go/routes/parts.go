@@ -0,0 +1,289 @@
+package routes
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kktjss/dance-flow/config"
+	"github.com/kktjss/dance-flow/formation"
+	"github.com/kktjss/dance-flow/middleware"
+	"github.com/kktjss/dance-flow/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Регистрирует маршруты партий текущего пользователя: проектов, в которых
+// его танцор назначен на роль
+func RegisterPartRoutes(router *gin.RouterGroup, cfg *config.Config) {
+	parts := router.Group("/users/me/parts")
+	parts.Use(middleware.JWTMiddleware(cfg))
+	{
+		parts.GET("", getMyParts)
+		parts.GET("/:projectId", getMyPart)
+	}
+}
+
+// myPartSummary - проект, в котором у пользователя есть роль
+type myPartSummary struct {
+	ProjectID   primitive.ObjectID `json:"projectId"`
+	ProjectName string             `json:"projectName"`
+	TeamID      primitive.ObjectID `json:"teamId"`
+	TeamName    string             `json:"teamName"`
+	Dancer      models.Dancer      `json:"dancer"`
+	ElementID   string             `json:"elementId"`
+	UpdatedAt   time.Time          `json:"updatedAt"`
+}
+
+// myPartStep - шаг партии со счётом, частью постановки и отметками до
+// следующего шага
+type myPartStep struct {
+	formation.PartStep
+	Count   *models.MusicalPosition `json:"count,omitempty"`
+	Section string                  `json:"section,omitempty"`
+	Cues    []string                `json:"cues,omitempty"`
+}
+
+// Возвращает проекты, в которых танцоры, связанные с пользователем, назначены на роли
+func getMyParts(c *gin.Context) {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	teamCursor, err := config.TeamsCollection.Find(ctx, bson.M{"roster.userId": userID})
+	if err != nil {
+		config.LogError("PARTS", fmt.Errorf("failed to find teams of user %s: %w", userID.Hex(), err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get parts"})
+		return
+	}
+	var teams []models.Team
+	if err := teamCursor.All(ctx, &teams); err != nil {
+		config.LogError("PARTS", fmt.Errorf("failed to decode teams: %w", err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get parts"})
+		return
+	}
+
+	teamsByID := map[primitive.ObjectID]*models.Team{}
+	dancers := map[string]models.Dancer{}
+	teamIDs := []primitive.ObjectID{}
+	dancerIDs := []string{}
+	for i := range teams {
+		team := &teams[i]
+		// Пользователь мог покинуть команду после привязки к танцору
+		if !teamHasUser(team, userID) {
+			continue
+		}
+		if dancer := userDancer(team.Roster, userID); dancer != nil {
+			teamsByID[team.ID] = team
+			teamIDs = append(teamIDs, team.ID)
+			dancers[dancer.ID] = *dancer
+			dancerIDs = append(dancerIDs, dancer.ID)
+		}
+	}
+
+	parts := []myPartSummary{}
+	if len(teamIDs) == 0 {
+		c.JSON(http.StatusOK, gin.H{"parts": parts})
+		return
+	}
+
+	projectCursor, err := config.ProjectsCollection.Find(ctx,
+		bson.M{"teamId": bson.M{"$in": teamIDs}, "casting.dancerId": bson.M{"$in": dancerIDs}},
+		options.Find().SetProjection(bson.M{"name": 1, "title": 1, "teamId": 1, "casting": 1, "updatedAt": 1}))
+	if err != nil {
+		config.LogError("PARTS", fmt.Errorf("failed to find projects of user %s: %w", userID.Hex(), err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get parts"})
+		return
+	}
+	var projects []models.Project
+	if err := projectCursor.All(ctx, &projects); err != nil {
+		config.LogError("PARTS", fmt.Errorf("failed to decode projects: %w", err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get parts"})
+		return
+	}
+
+	for _, project := range projects {
+		team := teamsByID[project.TeamID]
+		if team == nil {
+			continue
+		}
+		for _, entry := range project.Casting {
+			dancer, ok := dancers[entry.DancerID]
+			if !ok {
+				continue
+			}
+			parts = append(parts, myPartSummary{
+				ProjectID:   project.ID,
+				ProjectName: projectDisplayName(&project),
+				TeamID:      team.ID,
+				TeamName:    team.Name,
+				Dancer:      dancer,
+				ElementID:   entry.ElementID,
+				UpdatedAt:   project.UpdatedAt,
+			})
+		}
+	}
+	sort.SliceStable(parts, func(i, j int) bool { return parts[i].UpdatedAt.After(parts[j].UpdatedAt) })
+	c.JSON(http.StatusOK, gin.H{"parts": parts})
+}
+
+// Возвращает партию пользователя в проекте для просмотра с телефона: по
+// каждому ключевому кадру его элемента - время, счёт по карте темпа,
+// позицию в единицах проекта, заметки, часть постановки, отметки до
+// следующего кадра и ближайших соседей (?neighbours=, по умолчанию 3)
+func getMyPart(c *gin.Context) {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+	projectID, err := primitive.ObjectIDFromHex(c.Param("projectId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid project ID format"})
+		return
+	}
+	neighbours := formation.DefaultPartNeighbours
+	if value := c.Query("neighbours"); value != "" {
+		neighbours, err = strconv.Atoi(value)
+		if err != nil || neighbours < 1 || neighbours > formation.MaxPartNeighbours {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("neighbours must be between 1 and %d", formation.MaxPartNeighbours)})
+			return
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	project, err := loadProject(ctx, projectID)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Project not found"})
+		} else {
+			config.LogError("PARTS", fmt.Errorf("failed to load project %s: %w", projectID.Hex(), err))
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get project"})
+		}
+		return
+	}
+	if !middleware.CanReadProject(ctx, userID, project) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You don't have access to this project"})
+		return
+	}
+	roster, err := projectRoster(ctx, project)
+	if err != nil {
+		config.LogError("PARTS", fmt.Errorf("failed to load roster of project %s: %w", projectID.Hex(), err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get team roster"})
+		return
+	}
+
+	dancer := userDancer(roster, userID)
+	elementID := ""
+	labels := map[string]string{}
+	for _, entry := range project.Casting {
+		if index := findDancer(roster, entry.DancerID); index >= 0 {
+			labels[entry.ElementID] = roster[index].Name
+		}
+		if dancer != nil && entry.DancerID == dancer.ID {
+			elementID = entry.ElementID
+		}
+	}
+	if elementID == "" {
+		c.JSON(http.StatusNotFound, gin.H{"error": "You are not cast in this project"})
+		return
+	}
+
+	// Проект в метрах строится на холсте сцены, координаты переводятся обратно
+	view := stageFormationCanvas(project)
+	steps, err := formation.BuildPart(project.Elements, formation.PartOptions{
+		ElementID:  elementID,
+		Neighbours: neighbours,
+		Labels:     labels,
+	})
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Your element is no longer in the project"})
+		return
+	}
+	if view != nil {
+		toStage := func(p formation.Point) formation.Point {
+			position := view.ToStage(models.Position{X: p.X, Y: p.Y})
+			return formation.Point{X: position.X, Y: position.Y}
+		}
+		for i := range steps {
+			steps[i].Center = toStage(steps[i].Center)
+			if steps[i].Next != nil {
+				next := toStage(*steps[i].Next)
+				steps[i].Next = &next
+			}
+			for j := range steps[i].Neighbours {
+				steps[i].Neighbours[j].Center = toStage(steps[i].Neighbours[j].Center)
+				steps[i].Neighbours[j].Distance /= view.Scale
+			}
+		}
+	}
+
+	tempoMap := project.TempoMap
+	if tempoMap != nil && tempoMap.Validate() != nil {
+		tempoMap = nil
+	}
+	part := make([]myPartStep, len(steps))
+	for i, step := range steps {
+		part[i] = myPartStep{PartStep: step}
+		if tempoMap != nil {
+			position := tempoMap.Position(step.Time)
+			part[i].Count = &position
+		}
+		for _, section := range project.Sections {
+			if step.Time >= section.Start && step.Time < section.End {
+				part[i].Section = section.Name
+				break
+			}
+		}
+		until := step.Time
+		if i+1 < len(steps) {
+			until = steps[i+1].Time
+		}
+		for _, cue := range project.Cues {
+			if cue.Time >= step.Time && (cue.Time < until || (i+1 == len(steps) && cue.Time == until)) {
+				part[i].Cues = append(part[i].Cues, cue.Name)
+			}
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"projectId":   project.ID,
+		"projectName": projectDisplayName(project),
+		"units":       projectUnits(project),
+		"dancer":      dancer,
+		"elementId":   elementID,
+		"tempoMap":    tempoMap,
+		"steps":       part,
+	})
+}
+
+// userDancer возвращает танцора состава, связанного с пользователем
+func userDancer(roster []models.Dancer, userID primitive.ObjectID) *models.Dancer {
+	for i := range roster {
+		if roster[i].UserID != nil && *roster[i].UserID == userID {
+			return &roster[i]
+		}
+	}
+	return nil
+}
+
+// projectDisplayName возвращает название проекта, как его показывает клиент
+func projectDisplayName(project *models.Project) string {
+	if project.Name != "" {
+		return project.Name
+	}
+	return project.Title
+}
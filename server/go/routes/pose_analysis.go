@@ -0,0 +1,481 @@
+package routes
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/kktjss/dance-flow/config"
+	"github.com/kktjss/dance-flow/middleware"
+	"github.com/kktjss/dance-flow/models"
+	"github.com/kktjss/dance-flow/poseanalysis"
+	"github.com/kktjss/dance-flow/posetrack"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Максимальное число кадров последовательности, участвующих в сравнении
+const maxComparisonFrames = 3000
+
+// Параметры извлечения ключевых кадров по умолчанию: размер сцены в пикселях
+// редактора и допустимое отклонение упрощённого пути от исходного
+const (
+	defaultStageWidth        = 800.0
+	defaultStageHeight       = 600.0
+	defaultPathTolerance     = 5.0
+	defaultDancerElementSize = 40.0
+	maxExtractedDancers      = 50
+)
+
+// Регистрирует маршруты анализа поз проекта
+func RegisterPoseAnalysisRoutes(router *gin.RouterGroup, cfg *config.Config) {
+	analysis := router.Group("/projects/:id")
+	analysis.Use(middleware.JWTMiddleware(cfg))
+	{
+		analysis.POST("/pose-comparison", middleware.CheckProjectIsPrivate(), comparePoses)
+		analysis.POST("/pose-filter", middleware.CheckProjectAccess(), filterPoses)
+		analysis.POST("/keyframes/extract", middleware.CheckProjectAccess(), extractKeyframes)
+	}
+}
+
+// Сравнивает позы проекта (запись студента) с эталонным проектом хореографа.
+// Источник поз в каждом проекте - трек (trackId) или ключевые кадры (personIndex).
+func comparePoses(c *gin.Context) {
+	projectID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid project ID format"})
+		return
+	}
+
+	var input struct {
+		ReferenceProjectID string                 `json:"referenceProjectId" binding:"required"`
+		Source             posetrack.Source       `json:"source"`
+		ReferenceSource    posetrack.Source       `json:"referenceSource"`
+		Sections           []poseanalysis.Section `json:"sections"`
+		TopDeviations      int                    `json:"topDeviations"`
+		MinDeviationGap    float64                `json:"minDeviationGap"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	for _, section := range input.Sections {
+		if section.End <= section.Start {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Section %q must end after it starts", section.Name)})
+			return
+		}
+	}
+	if input.TopDeviations < 0 || input.TopDeviations > 50 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "topDeviations must be between 0 and 50"})
+		return
+	}
+
+	referenceID, err := primitive.ObjectIDFromHex(input.ReferenceProjectID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid reference project ID format"})
+		return
+	}
+
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	// Эталон может лежать в чужом проекте: проверяем доступ на чтение
+	var reference models.Project
+	err = config.ProjectsCollection.FindOne(ctx, bson.M{"_id": referenceID},
+		options.FindOne().SetProjection(bson.M{"owner": 1, "teamId": 1, "isPrivate": 1})).Decode(&reference)
+	if err != nil || !middleware.CanReadProject(ctx, userID, &reference) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Reference project not found"})
+		return
+	}
+
+	actual, ok := loadPoseSequence(ctx, c, projectID, input.Source, "project")
+	if !ok {
+		return
+	}
+	expected, ok := loadPoseSequence(ctx, c, referenceID, input.ReferenceSource, "reference project")
+	if !ok {
+		return
+	}
+
+	actual.Frames = posetrack.Downsample(actual.Frames, maxComparisonFrames)
+	expected.Frames = posetrack.Downsample(expected.Frames, maxComparisonFrames)
+
+	result, err := poseanalysis.Compare(actual, expected, poseanalysis.CompareOptions{
+		Sections:        input.Sections,
+		TopDeviations:   input.TopDeviations,
+		MinDeviationGap: input.MinDeviationGap,
+	})
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+// Сглаживает позы проекта и сохраняет результат в новый трек. Исходные данные
+// не меняются, а параметры фильтрации сохраняются в треке для воспроизводимости.
+func filterPoses(c *gin.Context) {
+	projectID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid project ID format"})
+		return
+	}
+
+	var input struct {
+		Source posetrack.Source        `json:"source"`
+		Params models.PoseFilterParams `json:"params"`
+		Name   string                  `json:"name"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := poseanalysis.NormalizeFilterParams(&input.Params); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+
+	sequence, ok := loadPoseSequence(ctx, c, projectID, input.Source, "project")
+	if !ok {
+		return
+	}
+
+	now := time.Now()
+	track := models.PoseTrack{
+		ID:          primitive.NewObjectID(),
+		ProjectID:   projectID,
+		Name:        input.Name,
+		PersonIndex: input.Source.PersonIndex,
+		Skeleton:    sequence.Skeleton,
+		FrameWidth:  sequence.FrameWidth,
+		FrameHeight: sequence.FrameHeight,
+		Filter:      &input.Params,
+		CreatedBy:   userID,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	if input.Source.TrackID != "" {
+		// Наследуем описание исходного трека
+		var source models.PoseTrack
+		sourceID, _ := primitive.ObjectIDFromHex(input.Source.TrackID)
+		if err := config.PoseTracksCollection.FindOne(ctx, bson.M{"_id": sourceID}).Decode(&source); err == nil {
+			track.SourceTrackID = source.ID
+			track.PersonIndex = source.PersonIndex
+			track.SourceVideoURL = source.SourceVideoURL
+			if track.Name == "" {
+				track.Name = source.Name + " (" + input.Params.Smoothing + ")"
+			}
+		}
+	}
+	if track.Name == "" {
+		track.Name = fmt.Sprintf("Keyframes person %d (%s)", track.PersonIndex, input.Params.Smoothing)
+	}
+
+	frames, report := poseanalysis.FilterFrames(sequence.Frames, input.Params)
+
+	if _, err := config.PoseTracksCollection.InsertOne(ctx, track); err != nil {
+		config.LogError("POSE_ANALYSIS", fmt.Errorf("failed to create filtered track: %w", err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create pose track"})
+		return
+	}
+	if err := posetrack.AppendFrames(ctx, &track, frames); err != nil {
+		config.LogError("POSE_ANALYSIS", fmt.Errorf("failed to write filtered track %s: %w", track.ID.Hex(), err))
+		posetrack.DeleteTracks(ctx, []primitive.ObjectID{track.ID})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to write filtered frames"})
+		return
+	}
+
+	middleware.Audit(c).TargetID = track.ID.Hex()
+	c.JSON(http.StatusCreated, gin.H{
+		"track":  track,
+		"report": report,
+	})
+}
+
+// loadPoseSequence загружает позы проекта. При ошибке ответ уже отправлен.
+func loadPoseSequence(ctx context.Context, c *gin.Context, projectID primitive.ObjectID, source posetrack.Source, label string) (*models.PoseSequence, bool) {
+	sequence, err := posetrack.LoadSequence(ctx, projectID, source)
+	if err == posetrack.ErrInvalidTrackID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return nil, false
+	}
+	if errors.Is(err, posetrack.ErrNoPoseData) {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": fmt.Sprintf("No pose data found in %s", label)})
+		return nil, false
+	}
+	if err != nil {
+		config.LogError("POSE_ANALYSIS", fmt.Errorf("failed to load poses of %s %s: %w", label, projectID.Hex(), err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load pose data"})
+		return nil, false
+	}
+	return sequence, true
+}
+
+// keyframeExtractionDancer связывает источник поз с элементом сцены.
+// Без elementId используется элемент, ранее созданный из того же источника, или создаётся новый.
+type keyframeExtractionDancer struct {
+	Source    posetrack.Source `json:"source"`
+	ElementID string           `json:"elementId"`
+	Name      string           `json:"name"`
+}
+
+// Строит путь каждого танцора по позам и записывает его в ключевые кадры
+// элементов проекта. Путь упрощается с допуском tolerance (в пикселях сцены).
+// Если танцоры не указаны, используются все треки поз проекта.
+func extractKeyframes(c *gin.Context) {
+	projectID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid project ID format"})
+		return
+	}
+
+	var input struct {
+		Dancers     []keyframeExtractionDancer `json:"dancers"`
+		Tolerance   *float64                   `json:"tolerance"`
+		StageWidth  float64                    `json:"stageWidth"`
+		StageHeight float64                    `json:"stageHeight"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	tolerance := defaultPathTolerance
+	if input.Tolerance != nil {
+		tolerance = *input.Tolerance
+	}
+	if tolerance < 0 || math.IsNaN(tolerance) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "tolerance must not be negative"})
+		return
+	}
+	if input.StageWidth == 0 {
+		input.StageWidth = defaultStageWidth
+	}
+	if input.StageHeight == 0 {
+		input.StageHeight = defaultStageHeight
+	}
+	if input.StageWidth < 0 || input.StageHeight < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Stage size must be positive"})
+		return
+	}
+	if len(input.Dancers) > maxExtractedDancers {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("At most %d dancers can be extracted at once", maxExtractedDancers)})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+
+	dancers := input.Dancers
+	if len(dancers) == 0 {
+		cursor, err := config.PoseTracksCollection.Find(ctx, bson.M{"projectId": projectID},
+			options.Find().SetSort(bson.M{"createdAt": 1}).SetLimit(maxExtractedDancers))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get pose tracks"})
+			return
+		}
+		var tracks []models.PoseTrack
+		if err := cursor.All(ctx, &tracks); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to decode pose tracks"})
+			return
+		}
+		if len(tracks) == 0 {
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Project has no pose tracks"})
+			return
+		}
+		for _, track := range tracks {
+			dancers = append(dancers, keyframeExtractionDancer{
+				Source: posetrack.Source{TrackID: track.ID.Hex(), PersonIndex: track.PersonIndex},
+				Name:   track.Name,
+			})
+		}
+	}
+
+	project, err := loadProject(ctx, projectID)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Project not found"})
+		} else {
+			config.LogError("POSE_ANALYSIS", fmt.Errorf("failed to load project %s: %w", projectID.Hex(), err))
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get project"})
+		}
+		return
+	}
+
+	results := make([]gin.H, 0, len(dancers))
+	for i, dancer := range dancers {
+		sequence, ok := loadPoseSequence(ctx, c, projectID, dancer.Source, "project")
+		if !ok {
+			return
+		}
+		path, err := poseanalysis.Trajectory(sequence)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if len(path) == 0 {
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": fmt.Sprintf("Dancer %d is not visible in pose data", i)})
+			return
+		}
+
+		// Переводим путь в пиксели сцены до упрощения, чтобы допуск задавался в пикселях
+		for j := range path {
+			path[j].X *= input.StageWidth
+			path[j].Y *= input.StageHeight
+		}
+		simplified := poseanalysis.SimplifyPath(path, tolerance)
+
+		element, created := findDancerElement(project, dancer)
+		if element == nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("Element %q not found", dancer.ElementID)})
+			return
+		}
+		if project.UsesStageUnits() {
+			// Кадр видео считается холстом размера stageWidth x stageHeight
+			view := project.Stage.Canvas(input.StageWidth, input.StageHeight)
+			for j := range simplified {
+				point := view.ToStage(models.Position{X: simplified[j].X, Y: simplified[j].Y})
+				simplified[j].X, simplified[j].Y = point.X, point.Y
+			}
+		}
+		setPathKeyframes(element, simplified, project.UsesStageUnits())
+
+		results = append(results, gin.H{
+			"elementId":     element["id"],
+			"created":       created,
+			"source":        dancer.Source,
+			"pointCount":    len(path),
+			"keyframeCount": len(simplified),
+			"startTime":     simplified[0].Time,
+			"endTime":       simplified[len(simplified)-1].Time,
+		})
+	}
+
+	if err := saveProjectElements(ctx, project, project.Elements); err != nil {
+		respondProjectSaveError(c, "POSE_ANALYSIS", projectID, err, "Failed to save keyframes")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"tolerance": tolerance,
+		"dancers":   results,
+		"elements":  project.Elements,
+	})
+}
+
+// findDancerElement находит элемент для танцора или добавляет в проект новый.
+// Возвращает nil, если явно указанного элемента нет.
+func findDancerElement(project *models.Project, dancer keyframeExtractionDancer) (map[string]interface{}, bool) {
+	source := gin.H{"trackId": dancer.Source.TrackID, "personIndex": dancer.Source.PersonIndex}
+	for _, raw := range project.Elements {
+		element, ok := raw.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if dancer.ElementID != "" {
+			if element["id"] == dancer.ElementID {
+				return element, false
+			}
+			continue
+		}
+		if existing, ok := element["poseSource"].(map[string]interface{}); ok &&
+			existing["trackId"] == source["trackId"] &&
+			models.ConvertToFloat64(existing["personIndex"], -1) == float64(dancer.Source.PersonIndex) {
+			return element, false
+		}
+	}
+	if dancer.ElementID != "" {
+		return nil, false
+	}
+
+	name := dancer.Name
+	if name == "" {
+		name = fmt.Sprintf("Dancer %d", dancer.Source.PersonIndex+1)
+	}
+	size := defaultDancerElementSize
+	if project.UsesStageUnits() {
+		size = models.DefaultStageElementSize
+	}
+	element := map[string]interface{}{
+		"id":         "circle-" + uuid.New().String(),
+		"type":       "circle",
+		"content":    name,
+		"position":   map[string]interface{}{"x": 0.0, "y": 0.0},
+		"size":       map[string]interface{}{"width": size, "height": size},
+		"poseSource": map[string]interface{}(source),
+	}
+	// Нормализация дополняет стиль и ключевые кадры в той же карте
+	project.Elements = append(project.Elements, element)
+	project.NormalizeElements()
+	return element, true
+}
+
+// setPathKeyframes записывает путь в ключевые кадры элемента. Путь задаёт центр
+// элемента; ключевые кадры вне интервала пути сохраняются. В метрах сцены
+// позицией элемента и так служит центр, в пикселях - левый верхний угол.
+func setPathKeyframes(element map[string]interface{}, path []poseanalysis.TrajectoryPoint, stageUnits bool) {
+	halfWidth, halfHeight := defaultDancerElementSize/2, defaultDancerElementSize/2
+	if size, ok := element["size"].(map[string]interface{}); ok {
+		halfWidth = models.ConvertToFloat64(size["width"], defaultDancerElementSize) / 2
+		halfHeight = models.ConvertToFloat64(size["height"], defaultDancerElementSize) / 2
+	}
+	if stageUnits {
+		halfWidth, halfHeight = 0, 0
+	}
+	from, to := path[0].Time, path[len(path)-1].Time
+
+	keyframes := make([]interface{}, 0, len(path))
+	if existing, ok := element["keyframes"].([]interface{}); ok {
+		for _, raw := range existing {
+			keyframe, ok := raw.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			if t := models.ConvertToFloat64(keyframe["time"], -1); t < from || t > to {
+				keyframes = append(keyframes, keyframe)
+			}
+		}
+	}
+	for _, point := range path {
+		keyframes = append(keyframes, map[string]interface{}{
+			"time": point.Time,
+			"position": map[string]interface{}{
+				"x": point.X - halfWidth,
+				"y": point.Y - halfHeight,
+			},
+			"opacity": 1.0,
+			"scale":   1.0,
+		})
+	}
+	sort.SliceStable(keyframes, func(i, j int) bool {
+		a := models.ConvertToFloat64(keyframes[i].(map[string]interface{})["time"], 0)
+		b := models.ConvertToFloat64(keyframes[j].(map[string]interface{})["time"], 0)
+		return a < b
+	})
+
+	element["keyframes"] = keyframes
+	element["position"] = keyframes[0].(map[string]interface{})["position"]
+}
@@ -0,0 +1,323 @@
+package routes
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kktjss/dance-flow/config"
+	"github.com/kktjss/dance-flow/middleware"
+	"github.com/kktjss/dance-flow/models"
+	"github.com/kktjss/dance-flow/posetrack"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Ограничения на размер запросов к трекам
+const (
+	maxFramesPerWrite    = 5000
+	defaultOverviewLimit = 200
+	maxOverviewLimit     = 2000
+)
+
+// Регистрирует маршруты для треков поз проекта
+func RegisterPoseTrackRoutes(router *gin.RouterGroup, cfg *config.Config) {
+	tracks := router.Group("/projects/:id/pose-tracks")
+	tracks.Use(middleware.JWTMiddleware(cfg))
+	{
+		tracks.GET("", middleware.CheckProjectIsPrivate(), getPoseTracks)
+		tracks.POST("", middleware.CheckProjectAccess(), createPoseTrack)
+		tracks.GET("/:trackId", middleware.CheckProjectIsPrivate(), getPoseTrack)
+		tracks.DELETE("/:trackId", middleware.CheckProjectAccess(), deletePoseTrack)
+		tracks.POST("/:trackId/frames", middleware.CheckProjectAccess(), writePoseTrackFrames)
+		tracks.GET("/:trackId/frames", middleware.CheckProjectIsPrivate(), getPoseTrackFrames)
+		tracks.GET("/:trackId/overview", middleware.CheckProjectIsPrivate(), getPoseTrackOverview)
+	}
+}
+
+// Возвращает все треки поз проекта без кадров
+func getPoseTracks(c *gin.Context) {
+	projectID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid project ID format"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	opts := options.Find().SetSort(bson.M{"createdAt": 1})
+	cursor, err := config.PoseTracksCollection.Find(ctx, bson.M{"projectId": projectID}, opts)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get pose tracks"})
+		return
+	}
+	defer cursor.Close(ctx)
+
+	tracks := []models.PoseTrack{}
+	if err := cursor.All(ctx, &tracks); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to decode pose tracks"})
+		return
+	}
+
+	c.JSON(http.StatusOK, tracks)
+}
+
+// Создает пустой трек поз для одного танцора
+func createPoseTrack(c *gin.Context) {
+	projectID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid project ID format"})
+		return
+	}
+
+	var input models.PoseTrackCreateInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if input.Skeleton == "" {
+		input.Skeleton = models.SkeletonMediaPipe33
+	}
+	if _, err := models.GetSkeleton(input.Skeleton); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if input.PersonIndex < 0 || input.FrameWidth < 0 || input.FrameHeight < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "personIndex and frame size must not be negative"})
+		return
+	}
+
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	now := time.Now()
+	track := models.PoseTrack{
+		ID:             primitive.NewObjectID(),
+		ProjectID:      projectID,
+		Name:           input.Name,
+		PersonIndex:    input.PersonIndex,
+		Skeleton:       input.Skeleton,
+		FrameWidth:     input.FrameWidth,
+		FrameHeight:    input.FrameHeight,
+		SourceVideoURL: input.SourceVideoURL,
+		CreatedBy:      userID,
+		CreatedAt:      now,
+		UpdatedAt:      now,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if _, err := config.PoseTracksCollection.InsertOne(ctx, track); err != nil {
+		config.LogError("POSE_TRACK", fmt.Errorf("failed to create track: %w", err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create pose track"})
+		return
+	}
+
+	middleware.Audit(c).TargetID = track.ID.Hex()
+	c.JSON(http.StatusCreated, track)
+}
+
+// Возвращает метаданные трека
+func getPoseTrack(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	track, ok := findPoseTrack(ctx, c)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, track)
+}
+
+// Удаляет трек вместе со всеми кадрами
+func deletePoseTrack(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	track, ok := findPoseTrack(ctx, c)
+	if !ok {
+		return
+	}
+
+	if err := posetrack.DeleteTracks(ctx, []primitive.ObjectID{track.ID}); err != nil {
+		config.LogError("POSE_TRACK", fmt.Errorf("failed to delete track %s: %w", track.ID.Hex(), err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete pose track"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Pose track deleted successfully"})
+}
+
+// Записывает пакет кадров в трек. Кадры с тем же временем перезаписываются.
+func writePoseTrackFrames(c *gin.Context) {
+	var input models.PoseFramesInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if len(input.Frames) > maxFramesPerWrite {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("At most %d frames can be written at once", maxFramesPerWrite)})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	track, ok := findPoseTrack(ctx, c)
+	if !ok {
+		return
+	}
+
+	skeleton, err := models.GetSkeleton(track.Skeleton)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	for i := range input.Frames {
+		if err := input.Frames[i].Validate(skeleton); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid frame: " + err.Error()})
+			return
+		}
+	}
+
+	if err := posetrack.AppendFrames(ctx, track, input.Frames); err != nil {
+		config.LogError("POSE_TRACK", fmt.Errorf("failed to write frames to track %s: %w", track.ID.Hex(), err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to write frames"})
+		return
+	}
+
+	c.JSON(http.StatusOK, track)
+}
+
+// Возвращает кадры трека во временном окне ?from=&to= (в секундах)
+func getPoseTrackFrames(c *gin.Context) {
+	from, to, err := parseTimeWindow(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	track, ok := findPoseTrack(ctx, c)
+	if !ok {
+		return
+	}
+
+	frames, err := posetrack.ReadFrames(ctx, track, from, to)
+	if err != nil {
+		config.LogError("POSE_TRACK", fmt.Errorf("failed to read track %s: %w", track.ID.Hex(), err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read frames"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"trackId":  track.ID,
+		"skeleton": track.Skeleton,
+		"from":     from,
+		"to":       to,
+		"frames":   frames,
+	})
+}
+
+// Возвращает прореженный трек для обзора на таймлайне (?maxFrames=200)
+func getPoseTrackOverview(c *gin.Context) {
+	from, to, err := parseTimeWindow(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	maxFrames := defaultOverviewLimit
+	if value := c.Query("maxFrames"); value != "" {
+		maxFrames, err = strconv.Atoi(value)
+		if err != nil || maxFrames < 1 || maxFrames > maxOverviewLimit {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("maxFrames must be between 1 and %d", maxOverviewLimit)})
+			return
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	track, ok := findPoseTrack(ctx, c)
+	if !ok {
+		return
+	}
+
+	frames, err := posetrack.ReadFrames(ctx, track, from, to)
+	if err != nil {
+		config.LogError("POSE_TRACK", fmt.Errorf("failed to read track %s: %w", track.ID.Hex(), err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read frames"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"trackId":     track.ID,
+		"skeleton":    track.Skeleton,
+		"totalFrames": len(frames),
+		"frames":      posetrack.Downsample(frames, maxFrames),
+	})
+}
+
+// findPoseTrack загружает трек из параметров запроса и проверяет, что он принадлежит проекту.
+// При ошибке ответ уже отправлен.
+func findPoseTrack(ctx context.Context, c *gin.Context) (*models.PoseTrack, bool) {
+	projectID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid project ID format"})
+		return nil, false
+	}
+	trackID, err := primitive.ObjectIDFromHex(c.Param("trackId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid track ID format"})
+		return nil, false
+	}
+
+	var track models.PoseTrack
+	err = config.PoseTracksCollection.FindOne(ctx, bson.M{"_id": trackID, "projectId": projectID}).Decode(&track)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Pose track not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get pose track"})
+		}
+		return nil, false
+	}
+
+	return &track, true
+}
+
+// parseTimeWindow разбирает параметры ?from=&to=; по умолчанию окно не ограничено
+func parseTimeWindow(c *gin.Context) (float64, float64, error) {
+	from, to := 0.0, math.MaxFloat64
+	if value := c.Query("from"); value != "" {
+		parsed, err := strconv.ParseFloat(value, 64)
+		if err != nil || !(parsed >= 0) || math.IsInf(parsed, 0) {
+			return 0, 0, fmt.Errorf("from must be a non-negative number of seconds")
+		}
+		from = parsed
+	}
+	if value := c.Query("to"); value != "" {
+		parsed, err := strconv.ParseFloat(value, 64)
+		if err != nil || !(parsed >= from) || math.IsInf(parsed, 0) {
+			return 0, 0, fmt.Errorf("to must be a number of seconds not less than from")
+		}
+		to = parsed
+	}
+	return from, to, nil
+}
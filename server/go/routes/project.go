@@ -3,6 +3,7 @@ package routes
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"math"
@@ -13,8 +14,10 @@ import (
 	"github.com/kktjss/dance-flow/config"
 	"github.com/kktjss/dance-flow/middleware"
 	"github.com/kktjss/dance-flow/models"
+	"github.com/kktjss/dance-flow/posetrack"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
@@ -30,6 +33,7 @@ func RegisterProjectRoutes(router *gin.RouterGroup, cfg *config.Config) {
 		projects.GET("/:id", getProject)
 		projects.PUT("/:id", middleware.CheckProjectAccess(), updateProject)
 		projects.DELETE("/:id", middleware.CheckProjectAccess(), deleteProject)
+		projects.GET("/:id/models", middleware.CheckProjectIsPrivate(), getProjectModels)
 		
 		// Регистрируем тестовый эндпоинт, который не проверяет членство в командах
 		projects.GET("/test", getProjectsTest)
@@ -309,6 +313,16 @@ func createProject(c *gin.Context) {
 		project.TeamID = teamObjID
 	}
 
+	// Проект со сценой хранит позиции элементов в метрах
+	if input.Stage != nil {
+		if err := input.Stage.Validate(); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		project.Stage = input.Stage
+		project.Units = models.UnitsMetres
+	}
+
 	// Вставляем проект в базу данных
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
@@ -319,20 +333,13 @@ func createProject(c *gin.Context) {
 		return
 	}
 
-	// Добавляем запись в историю о создании проекта
-	historyEntry := models.CreateHistory(
-		userID,
-		project.ID,
-		models.ActionProjectCreated,
-		fmt.Sprintf("Created project '%s'", project.Name),
-	)
-	
-	historyCollection := config.GetCollection("histories")
-	_, err = historyCollection.InsertOne(ctx, historyEntry)
-	if err != nil {
-		// Логируем ошибку, но не прерываем запрос
-		config.LogError("PROJECT", fmt.Errorf("failed to create history entry: %w", err))
-	}
+	audit := middleware.Audit(c)
+	audit.TargetID = project.ID.Hex()
+	audit.ProjectID = project.ID
+	audit.Summary = fmt.Sprintf("Created project '%s'", project.Name)
+	audit.After = projectAuditState(&project)
+
+	publishWebhookEvent(ctx, projectWebhookEvent(models.WebhookProjectCreated, &project, userID, projectEventData(&project, "")))
 
 	c.JSON(http.StatusCreated, project)
 }
@@ -391,30 +398,36 @@ func updateProject(c *gin.Context) {
 		}
 		update["$set"].(bson.M)["teamId"] = teamObjID
 	}
+	// Привязываем ключевые кадры к счёту по карте темпа проекта
+	if input.SnapToCounts && input.Elements != nil {
+		if input.SnapDivision < 0 || input.SnapDivision > models.MaxSnapDivision {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("snapDivision must be 0 (whole counts) or between 1 and %d", models.MaxSnapDivision)})
+			return
+		}
+		tempoMap, err := projectTempoMap(projectObjID)
+		if err != nil {
+			if err == mongo.ErrNoDocuments {
+				c.JSON(http.StatusNotFound, gin.H{"error": "Project not found"})
+			} else {
+				config.LogError("PROJECT", fmt.Errorf("failed to load tempo map of project %s: %w", projectID, err))
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update project"})
+			}
+			return
+		}
+		if tempoMap == nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Project has no tempo map to snap keyframes to"})
+			return
+		}
+		tempoMap.SnapElementKeyframes(input.Elements, input.SnapDivision)
+	}
+
 	// Обрабатываем новые поля
 	if input.Elements != nil {
 		update["$set"].(bson.M)["elements"] = input.Elements
 		
 		// Также извлекаем ключевые кадры для каждого элемента и сохраняем в keyframesJson
-		keyframesData := make(map[string]interface{})
-		
-		for _, element := range input.Elements {
-			// Получаем доступ к элементу как к карте для извлечения ID и ключевых кадров
-			if elem, ok := element.(map[string]interface{}); ok {
-				if elemID, hasID := elem["id"].(string); hasID {
-					if keyframes, hasKeyframes := elem["keyframes"]; hasKeyframes {
-						keyframesData[elemID] = keyframes
-					}
-				}
-			}
-		}
-		
-		// Если у нас есть ключевые кадры, сериализуем в JSON и сохраняем
-		if len(keyframesData) > 0 {
-			keyframesJSON, err := json.Marshal(keyframesData)
-			if err == nil {
-				update["$set"].(bson.M)["keyframesJson"] = string(keyframesJSON)
-			}
+		if keyframesJSON, ok := elementKeyframesJSON(input.Elements); ok {
+			update["$set"].(bson.M)["keyframesJson"] = keyframesJSON
 		}
 	}
 	
@@ -435,19 +448,21 @@ func updateProject(c *gin.Context) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	result, err := config.ProjectsCollection.UpdateOne(
+	// Прежние значения полей нужны журналу аудита
+	var previous models.Project
+	err = config.ProjectsCollection.FindOneAndUpdate(
 		ctx,
 		bson.M{"_id": projectObjID},
 		update,
-	)
+		options.FindOneAndUpdate().SetProjection(projectAuditProjection),
+	).Decode(&previous)
 
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update project"})
+	if err == mongo.ErrNoDocuments {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Project not found"})
 		return
 	}
-
-	if result.MatchedCount == 0 {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Project not found"})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update project"})
 		return
 	}
 
@@ -459,6 +474,17 @@ func updateProject(c *gin.Context) {
 		return
 	}
 
+	before, after := auditChanges(projectAuditState(&previous), projectAuditState(&updatedProject))
+	if input.Elements != nil {
+		after["elements"] = len(input.Elements)
+	}
+	middleware.Audit(c).Before, middleware.Audit(c).After = before, after
+
+	// Сообщаем команде проекта об изменении
+	if userID, err := middleware.GetUserID(c); err == nil {
+		announceProjectUpdate(ctx, userID, projectObjID, "")
+	}
+
 	c.JSON(http.StatusOK, updatedProject)
 }
 
@@ -479,15 +505,35 @@ func deleteProject(c *gin.Context) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	result, err := config.ProjectsCollection.DeleteOne(ctx, bson.M{"_id": projectObjID})
+	// Название, владелец и команда удалённого проекта нужны для события
+	// вебхука и журнала аудита
+	var deleted models.Project
+	err = config.ProjectsCollection.FindOneAndDelete(ctx, bson.M{"_id": projectObjID},
+		options.FindOneAndDelete().SetProjection(projectAuditProjection)).Decode(&deleted)
+	if err == mongo.ErrNoDocuments {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Project not found"})
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete project"})
 		return
 	}
 
-	if result.DeletedCount == 0 {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Project not found"})
-		return
+	// Удаляем треки поз проекта, чтобы не оставлять осиротевшие блоки кадров
+	if err := posetrack.DeleteProjectTracks(ctx, projectObjID); err != nil {
+		config.LogError("PROJECT", fmt.Errorf("failed to delete pose tracks of project %s: %w", projectID, err))
+	}
+	if _, err := config.CommentsCollection.DeleteMany(ctx, bson.M{"projectId": projectObjID}); err != nil {
+		config.LogError("PROJECT", fmt.Errorf("failed to delete comments of project %s: %w", projectID, err))
+	}
+
+	audit := middleware.Audit(c)
+	audit.TeamID = deleted.TeamID
+	audit.Summary = fmt.Sprintf("Deleted project '%s'", projectDisplayName(&deleted))
+	audit.Before = projectAuditState(&deleted)
+
+	if userID, err := middleware.GetUserID(c); err == nil {
+		publishWebhookEvent(ctx, projectWebhookEvent(models.WebhookProjectDeleted, &deleted, userID, projectEventData(&deleted, "")))
 	}
 
 	c.JSON(http.StatusOK, gin.H{"message": "Project deleted successfully"})
@@ -790,4 +836,121 @@ func postProjectDebug(c *gin.Context) {
 
 	log.Printf("[DEBUG ROUTE] Sending save diagnostics")
 	c.JSON(http.StatusOK, diagnostics)
-} 
\ No newline at end of file
+} 
+
+// elementKeyframesJSON собирает ключевые кадры элементов в JSON вида {elementId: keyframes}
+// для поля keyframesJson. Возвращает false, если ключевых кадров нет.
+func elementKeyframesJSON(elements []interface{}) (string, bool) {
+	keyframesData := make(map[string]interface{})
+	for _, element := range elements {
+		// Получаем доступ к элементу как к карте для извлечения ID и ключевых кадров
+		if elem, ok := element.(map[string]interface{}); ok {
+			if elemID, hasID := elem["id"].(string); hasID {
+				if keyframes, hasKeyframes := elem["keyframes"]; hasKeyframes {
+					keyframesData[elemID] = keyframes
+				}
+			}
+		}
+	}
+	if len(keyframesData) == 0 {
+		return "", false
+	}
+
+	keyframesJSON, err := json.Marshal(keyframesData)
+	if err != nil {
+		return "", false
+	}
+	return string(keyframesJSON), true
+}
+
+// loadProject загружает проект с нормализованными элементами. Элементы
+// разбираются отдельно, как в getProject, потому что их формат не фиксирован.
+func loadProject(ctx context.Context, projectID primitive.ObjectID) (*models.Project, error) {
+	var rawProject bson.M
+	if err := config.ProjectsCollection.FindOne(ctx, bson.M{"_id": projectID}).Decode(&rawProject); err != nil {
+		return nil, err
+	}
+
+	elementsRaw, hasElements := rawProject["elements"]
+	delete(rawProject, "elements")
+
+	projectBytes, err := bson.Marshal(rawProject)
+	if err != nil {
+		return nil, err
+	}
+	var project models.Project
+	if err := bson.Unmarshal(projectBytes, &project); err != nil {
+		return nil, err
+	}
+
+	if hasElements {
+		if elemArray, ok := elementsRaw.(primitive.A); ok {
+			project.Elements = append([]interface{}{}, elemArray...)
+		} else {
+			project.Elements = []interface{}{elementsRaw}
+		}
+	}
+	project.NormalizeElements()
+
+	return &project, nil
+}
+
+// errProjectChanged - проект изменили между загрузкой и сохранением
+var errProjectChanged = errors.New("project was changed by another request, reload it and try again")
+
+// saveProjectElements сохраняет элементы загруженного проекта вместе с
+// keyframesJson, если проект не менялся после загрузки
+func saveProjectElements(ctx context.Context, project *models.Project, elements []interface{}) error {
+	set := bson.M{"elements": elements}
+	if keyframesJSON, ok := elementKeyframesJSON(elements); ok {
+		set["keyframesJson"] = keyframesJSON
+	}
+	return saveLoadedProject(ctx, project, set)
+}
+
+// saveLoadedProject применяет $set к проекту, загруженному через loadProject.
+// Обновление отбирается по updatedAt загруженного проекта, поэтому изменение
+// из другого запроса не затирается: тогда возвращается errProjectChanged, а
+// для удалённого проекта - mongo.ErrNoDocuments.
+func saveLoadedProject(ctx context.Context, project *models.Project, set bson.M) error {
+	// В базе время хранится с точностью до миллисекунд
+	updatedAt := time.Now().Truncate(time.Millisecond)
+	set["updatedAt"] = updatedAt
+
+	filter := bson.M{"_id": project.ID, "updatedAt": project.UpdatedAt}
+	if project.UpdatedAt.IsZero() {
+		// Старые проекты без updatedAt
+		filter["updatedAt"] = nil
+	}
+	result, err := config.ProjectsCollection.UpdateOne(ctx, filter, bson.M{"$set": set})
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		count, err := config.ProjectsCollection.CountDocuments(ctx, bson.M{"_id": project.ID},
+			options.Count().SetLimit(1))
+		if err != nil {
+			return err
+		}
+		if count == 0 {
+			return mongo.ErrNoDocuments
+		}
+		return errProjectChanged
+	}
+	project.UpdatedAt = updatedAt
+	return nil
+}
+
+// respondProjectSaveError отвечает на ошибку saveLoadedProject: 404 для
+// удалённого проекта, 409 для изменённого, иначе 500 с сообщением message
+func respondProjectSaveError(c *gin.Context, tag string, projectID primitive.ObjectID, err error, message string) {
+	switch err {
+	case mongo.ErrNoDocuments:
+		c.JSON(http.StatusNotFound, gin.H{"error": "Project not found"})
+	case errProjectChanged:
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		config.LogError(tag, fmt.Errorf("failed to save project %s: %w", projectID.Hex(), err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": message})
+	}
+}
@@ -0,0 +1,474 @@
+package routes
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/kktjss/dance-flow/bundle"
+	"github.com/kktjss/dance-flow/config"
+	"github.com/kktjss/dance-flow/middleware"
+	"github.com/kktjss/dance-flow/models"
+	"github.com/kktjss/dance-flow/posetrack"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Пути данных проекта внутри архива
+const (
+	bundleProjectPath    = "project.json"
+	bundleKeyframesPath  = "keyframes.json"
+	bundlePoseTracksPath = "pose_tracks.json"
+	bundleModelsPath     = "models.json"
+	bundleFramesDir      = "pose_tracks/"
+)
+
+// Максимальный размер импортируемого архива: не больше его распакованного
+// содержимого
+const maxBundleSize = bundle.MaxTotalSize
+
+// Регистрирует маршруты экспорта и импорта проекта
+func RegisterProjectBundleRoutes(router *gin.RouterGroup, cfg *config.Config) {
+	projects := router.Group("/projects")
+	projects.Use(middleware.JWTMiddleware(cfg))
+	{
+		projects.GET("/:id/export", middleware.CheckProjectIsPrivate(), exportProject)
+		projects.POST("/import", importProject)
+	}
+}
+
+// Выгружает проект в zip архив: данные проекта, ключевые кадры, треки поз,
+// используемые видео, аудио и GLB файлы и манифест с контрольными суммами
+func exportProject(c *gin.Context) {
+	projectID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid project ID format"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer cancel()
+
+	// Сначала собираем все данные из базы, чтобы ошибки можно было вернуть до начала передачи архива
+	project, err := loadProject(ctx, projectID)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Project not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get project"})
+		}
+		return
+	}
+	projectJSON, err := json.Marshal(project)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to serialize project"})
+		return
+	}
+
+	keyframes := []models.Keyframe{}
+	cursor, err := config.KeyframesCollection.Find(ctx, bson.M{"projectId": projectID})
+	if err == nil {
+		err = cursor.All(ctx, &keyframes)
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get keyframes"})
+		return
+	}
+
+	tracks := []models.PoseTrack{}
+	cursor, err = config.PoseTracksCollection.Find(ctx, bson.M{"projectId": projectID})
+	if err == nil {
+		err = cursor.All(ctx, &tracks)
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get pose tracks"})
+		return
+	}
+	trackData := make(map[string][]byte, len(tracks))
+	for i := range tracks {
+		frames, err := posetrack.ReadFrames(ctx, &tracks[i], 0, math.MaxFloat64)
+		if err == nil {
+			trackData[tracks[i].ID.Hex()], err = posetrack.Encode(frames)
+		}
+		if err != nil {
+			config.LogError("PROJECT_BUNDLE", fmt.Errorf("failed to read track %s: %w", tracks[i].ID.Hex(), err))
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read pose tracks"})
+			return
+		}
+	}
+
+	keyframesJSON, _ := json.Marshal(keyframes)
+	mediaURLs := bundle.MediaURLs(append(projectJSON, keyframesJSON...))
+
+	// Описания используемых GLB моделей, чтобы при импорте они появились в библиотеке
+	modelFiles := make([]string, 0)
+	for _, url := range mediaURLs {
+		if local := bundle.LocalPath(url); strings.HasPrefix(local, "uploads/models/") {
+			modelFiles = append(modelFiles, path.Base(local))
+		}
+	}
+	modelDocs := []models.Model{}
+	if len(modelFiles) > 0 {
+		cursor, err := config.GetCollection("models").Find(ctx, bson.M{"filename": bson.M{"$in": modelFiles}})
+		if err == nil {
+			err = cursor.All(ctx, &modelDocs)
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get models"})
+			return
+		}
+	}
+
+	filename := strings.Map(func(r rune) rune {
+		if r == '"' || r == '\\' || r == '/' || r < ' ' {
+			return '_'
+		}
+		return r
+	}, project.Name)
+	if filename == "" {
+		filename = projectID.Hex()
+	}
+	c.Header("Content-Type", "application/zip")
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.dfproj.zip"`, filename))
+	c.Status(http.StatusOK)
+
+	writer := bundle.NewWriter(c.Writer, projectID.Hex(), project.Name)
+	err = writeProjectBundle(writer, projectJSON, keyframes, tracks, trackData, modelDocs, mediaURLs)
+	if err == nil {
+		err = writer.Close()
+	}
+	if err != nil {
+		// Заголовки уже отправлены: обрываем архив, клиент получит повреждённый файл
+		config.LogError("PROJECT_BUNDLE", fmt.Errorf("failed to export project %s: %w", projectID.Hex(), err))
+		return
+	}
+	log.Printf("[PROJECT_BUNDLE] Exported project %s with %d keyframes, %d pose tracks and %d media files",
+		projectID.Hex(), len(keyframes), len(tracks), len(mediaURLs))
+}
+
+// writeProjectBundle записывает данные проекта и файлы в архив
+func writeProjectBundle(writer *bundle.Writer, projectJSON []byte, keyframes []models.Keyframe,
+	tracks []models.PoseTrack, trackData map[string][]byte, modelDocs []models.Model, mediaURLs []string) error {
+	if err := writer.WriteFile(bundleProjectPath, bytes.NewReader(projectJSON)); err != nil {
+		return err
+	}
+	if err := writer.WriteJSON(bundleKeyframesPath, keyframes); err != nil {
+		return err
+	}
+	if err := writer.WriteJSON(bundlePoseTracksPath, tracks); err != nil {
+		return err
+	}
+	for _, track := range tracks {
+		if err := writer.WriteFile(bundleFramesDir+track.ID.Hex()+".ptk", bytes.NewReader(trackData[track.ID.Hex()])); err != nil {
+			return err
+		}
+	}
+	if err := writer.WriteJSON(bundleModelsPath, modelDocs); err != nil {
+		return err
+	}
+
+	for _, url := range mediaURLs {
+		file, err := os.Open(bundle.LocalPath(url))
+		if err != nil {
+			// Отсутствующий файл не мешает сохранить остальной проект
+			log.Printf("[PROJECT_BUNDLE] Skipping missing media file %s: %v", url, err)
+			continue
+		}
+		err = writer.WriteMedia(url, bundle.MediaPath(url), file)
+		file.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Создаёт проект из архива экспорта (multipart, поле "file") под текущим пользователем.
+// Все идентификаторы и имена файлов генерируются заново, ссылки на них переписываются.
+func importProject(c *gin.Context) {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	header, err := c.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Project archive is required"})
+		return
+	}
+	if header.Size > maxBundleSize {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "Project archive is too large"})
+		return
+	}
+	file, err := header.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read project archive"})
+		return
+	}
+	defer file.Close()
+
+	archive, err := bundle.Open(file, header.Size)
+	if errors.Is(err, bundle.ErrUnsupportedVersion) {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer cancel()
+
+	imported := &projectImport{userID: userID, archive: archive}
+	project, err := imported.run(ctx)
+	if err != nil {
+		imported.rollback()
+		var invalid *bundleDataError
+		if errors.As(err, &invalid) || errors.Is(err, bundle.ErrInvalidBundle) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		config.LogError("PROJECT_BUNDLE", fmt.Errorf("failed to import project: %w", err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to import project"})
+		return
+	}
+
+	middleware.Audit(c).TargetID = project.ID.Hex()
+	middleware.Audit(c).ProjectID = project.ID
+	middleware.Audit(c).Summary = fmt.Sprintf("Imported project '%s'", project.Name)
+
+	log.Printf("[PROJECT_BUNDLE] Imported project %s from bundle of project %s for user %s",
+		project.ID.Hex(), archive.Manifest.ProjectID, userID.Hex())
+	project.NormalizeElements()
+	c.JSON(http.StatusCreated, project)
+}
+
+// bundleDataError - ошибка в содержимом архива, а не на стороне сервера
+type bundleDataError struct {
+	err error
+}
+
+func (e *bundleDataError) Error() string { return e.err.Error() }
+func (e *bundleDataError) Unwrap() error { return e.err }
+
+// projectImport восстанавливает проект из архива и запоминает созданное,
+// чтобы при ошибке удалить частично импортированные данные
+type projectImport struct {
+	userID  primitive.ObjectID
+	archive *bundle.Reader
+
+	projectID primitive.ObjectID
+	trackIDs  []primitive.ObjectID
+	modelIDs  []primitive.ObjectID
+	files     []string
+}
+
+func (imp *projectImport) run(ctx context.Context) (*models.Project, error) {
+	var keyframes []models.Keyframe
+	var tracks []models.PoseTrack
+	var modelDocs []models.Model
+	if err := imp.archive.ReadJSON(bundleKeyframesPath, &keyframes); err != nil {
+		return nil, err
+	}
+	if err := imp.archive.ReadJSON(bundlePoseTracksPath, &tracks); err != nil {
+		return nil, err
+	}
+	if err := imp.archive.ReadJSON(bundleModelsPath, &modelDocs); err != nil {
+		return nil, err
+	}
+	projectFile, err := imp.archive.Open(bundleProjectPath)
+	if err != nil {
+		return nil, err
+	}
+	projectJSON, err := io.ReadAll(projectFile)
+	projectFile.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	// Новые идентификаторы для всего, на что могут ссылаться данные проекта
+	imp.projectID = primitive.NewObjectID()
+	replacements := map[string]string{imp.archive.Manifest.ProjectID: imp.projectID.Hex()}
+	newTrackIDs := make(map[primitive.ObjectID]primitive.ObjectID, len(tracks))
+	for i := range keyframes {
+		newID := primitive.NewObjectID()
+		if !keyframes[i].ID.IsZero() {
+			replacements[keyframes[i].ID.Hex()] = newID.Hex()
+		}
+		keyframes[i].ID = newID
+	}
+	for i := range tracks {
+		if tracks[i].ID.IsZero() {
+			return nil, &bundleDataError{fmt.Errorf("pose track %d has no ID", i)}
+		}
+		newID := primitive.NewObjectID()
+		replacements[tracks[i].ID.Hex()] = newID.Hex()
+		newTrackIDs[tracks[i].ID] = newID
+	}
+
+	// Копируем файлы под новыми именами
+	modelFilenames := make(map[string]string)
+	for _, media := range imp.archive.Manifest.Media {
+		if !bundle.IsMediaURL(media.URL) {
+			return nil, &bundleDataError{fmt.Errorf("invalid media URL %q", media.URL)}
+		}
+		local := bundle.LocalPath(media.URL)
+		name := fmt.Sprintf("%d%s", time.Now().UnixNano(), path.Ext(local))
+		if strings.HasPrefix(local, "uploads/models/") {
+			name = uuid.New().String() + path.Ext(local)
+			modelFilenames[path.Base(local)] = name
+		}
+		if err := imp.copyMedia(media.Path, path.Join(path.Dir(local), name)); err != nil {
+			return nil, err
+		}
+		replacements[media.URL] = path.Join(path.Dir(media.URL), name)
+	}
+
+	var project models.Project
+	if err := json.Unmarshal(bundle.Replace(projectJSON, replacements), &project); err != nil {
+		return nil, &bundleDataError{fmt.Errorf("invalid project data: %w", err)}
+	}
+	now := time.Now()
+	project.ID = imp.projectID
+	project.Owner = imp.userID
+	project.TeamID = primitive.NilObjectID
+	project.CreatedAt = now
+	project.UpdatedAt = now
+	if _, err := config.ProjectsCollection.InsertOne(ctx, project); err != nil {
+		return nil, err
+	}
+
+	if len(keyframes) > 0 {
+		docs := make([]interface{}, len(keyframes))
+		for i := range keyframes {
+			keyframes[i].ProjectID = imp.projectID
+			keyframes[i].CreatedBy = imp.userID
+			if keyframes[i].PoseData != nil {
+				if err := keyframes[i].PoseData.Validate(); err != nil {
+					return nil, &bundleDataError{fmt.Errorf("keyframe %d: %w", i, err)}
+				}
+			}
+			docs[i] = keyframes[i]
+		}
+		if _, err := config.KeyframesCollection.InsertMany(ctx, docs); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, track := range tracks {
+		if err := imp.importTrack(ctx, track, newTrackIDs); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, model := range modelDocs {
+		filename, ok := modelFilenames[model.Filename]
+		if !ok {
+			continue
+		}
+		model.ID = primitive.NewObjectID()
+		model.Filename = filename
+		model.UserID = imp.userID
+		model.TeamID = primitive.NilObjectID
+		model.Visibility = models.ModelVisibilityPrivate
+		model.CreatedAt = now
+		model.UpdatedAt = now
+		if _, err := config.GetCollection("models").InsertOne(ctx, model); err != nil {
+			return nil, err
+		}
+		imp.modelIDs = append(imp.modelIDs, model.ID)
+	}
+
+	return &project, nil
+}
+
+// importTrack создаёт трек с новым идентификатором и записывает его кадры
+func (imp *projectImport) importTrack(ctx context.Context, track models.PoseTrack, newIDs map[primitive.ObjectID]primitive.ObjectID) error {
+	skeleton, err := models.GetSkeleton(track.Skeleton)
+	if err != nil {
+		return &bundleDataError{err}
+	}
+	framesFile, err := imp.archive.Open(bundleFramesDir + track.ID.Hex() + ".ptk")
+	if err != nil {
+		return err
+	}
+	data, err := io.ReadAll(framesFile)
+	framesFile.Close()
+	if err != nil {
+		return err
+	}
+	frames, err := posetrack.Decode(data, skeleton)
+	if err != nil {
+		return &bundleDataError{fmt.Errorf("pose track %s: %w", track.ID.Hex(), err)}
+	}
+
+	track.ID = newIDs[track.ID]
+	track.ProjectID = imp.projectID
+	track.SourceTrackID = newIDs[track.SourceTrackID]
+	track.CreatedBy = imp.userID
+	track.FrameCount, track.StartTime, track.EndTime = 0, 0, 0
+	if _, err := config.PoseTracksCollection.InsertOne(ctx, track); err != nil {
+		return err
+	}
+	imp.trackIDs = append(imp.trackIDs, track.ID)
+	return posetrack.AppendFrames(ctx, &track, frames)
+}
+
+// copyMedia извлекает файл архива в каталог загрузок
+func (imp *projectImport) copyMedia(archivePath, localPath string) error {
+	source, err := imp.archive.Open(archivePath)
+	if err != nil {
+		return err
+	}
+	defer source.Close()
+
+	if err := os.MkdirAll(filepath.Dir(localPath), 0755); err != nil {
+		return err
+	}
+	out, err := os.Create(localPath)
+	if err != nil {
+		return err
+	}
+	imp.files = append(imp.files, localPath)
+	if _, err := io.Copy(out, source); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// rollback удаляет всё, что успел создать неудавшийся импорт
+func (imp *projectImport) rollback() {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	if !imp.projectID.IsZero() {
+		config.ProjectsCollection.DeleteOne(ctx, bson.M{"_id": imp.projectID})
+		config.KeyframesCollection.DeleteMany(ctx, bson.M{"projectId": imp.projectID})
+	}
+	if err := posetrack.DeleteTracks(ctx, imp.trackIDs); err != nil {
+		config.LogError("PROJECT_BUNDLE", fmt.Errorf("failed to delete imported tracks: %w", err))
+	}
+	if len(imp.modelIDs) > 0 {
+		config.GetCollection("models").DeleteMany(ctx, bson.M{"_id": bson.M{"$in": imp.modelIDs}})
+	}
+	for _, file := range imp.files {
+		os.Remove(file)
+	}
+}
@@ -0,0 +1,470 @@
+package routes
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/kktjss/dance-flow/config"
+	"github.com/kktjss/dance-flow/middleware"
+	"github.com/kktjss/dance-flow/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Регистрирует маршруты репетиций команды
+func RegisterRehearsalRoutes(router *gin.RouterGroup, cfg *config.Config) {
+	rehearsals := router.Group("/teams/:id/rehearsals")
+	rehearsals.Use(middleware.JWTMiddleware(cfg))
+	{
+		rehearsals.GET("", middleware.CheckTeamAccess(), getTeamRehearsals)
+		rehearsals.POST("", middleware.CheckTeamAccess(), createTeamRehearsal)
+		rehearsals.GET("/:rehearsalId", middleware.CheckTeamAccess(), getTeamRehearsal)
+		rehearsals.PUT("/:rehearsalId", middleware.CheckTeamAccess(), updateTeamRehearsal)
+		rehearsals.DELETE("/:rehearsalId", middleware.CheckTeamAccess(), deleteTeamRehearsal)
+		rehearsals.PUT("/:rehearsalId/rsvp", middleware.CheckTeamAccess(), respondToRehearsal)
+		rehearsals.PUT("/:rehearsalId/attendance", middleware.CheckTeamAccess(), markRehearsalAttendance)
+	}
+}
+
+// Возвращает репетиции команды по времени начала. Необязательные ?from= и
+// ?to= (RFC 3339) ограничивают период.
+func getTeamRehearsals(c *gin.Context) {
+	var from, to time.Time
+	for name, target := range map[string]*time.Time{"from": &from, "to": &to} {
+		if value := c.Query(name); value != "" {
+			parsed, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": name + " must be an RFC 3339 time"})
+				return
+			}
+			*target = parsed
+		}
+	}
+
+	team, ok := loadRehearsalTeam(c)
+	if !ok {
+		return
+	}
+	rehearsals := []models.Rehearsal{}
+	for _, rehearsal := range team.Rehearsals {
+		if (!from.IsZero() && rehearsal.End.Before(from)) || (!to.IsZero() && rehearsal.Start.After(to)) {
+			continue
+		}
+		rehearsals = append(rehearsals, rehearsal)
+	}
+	sort.SliceStable(rehearsals, func(i, j int) bool { return rehearsals[i].Start.Before(rehearsals[j].Start) })
+	c.JSON(http.StatusOK, gin.H{"rehearsals": rehearsals})
+}
+
+// Возвращает репетицию
+func getTeamRehearsal(c *gin.Context) {
+	team, ok := loadRehearsalTeam(c)
+	if !ok {
+		return
+	}
+	index := findRehearsal(team.Rehearsals, c.Param("rehearsalId"))
+	if index < 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Rehearsal not found"})
+		return
+	}
+	c.JSON(http.StatusOK, team.Rehearsals[index])
+}
+
+// Планирует репетицию. Доступно владельцу и редакторам команды.
+func createTeamRehearsal(c *gin.Context) {
+	var input models.RehearsalInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if input.Start == nil || input.End == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "start and end are required"})
+		return
+	}
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	team, ok := loadEditableTeam(ctx, c)
+	if !ok {
+		return
+	}
+	if len(team.Rehearsals) >= models.MaxTeamRehearsals {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("A team can have at most %d rehearsals", models.MaxTeamRehearsals)})
+		return
+	}
+
+	now := time.Now()
+	rehearsal := models.Rehearsal{ID: uuid.New().String(), CreatedBy: userID, CreatedAt: now, UpdatedAt: now}
+	if !applyRehearsalInput(ctx, c, team, &input, &rehearsal) {
+		return
+	}
+
+	_, err = config.TeamsCollection.UpdateOne(ctx, bson.M{"_id": team.ID},
+		bson.M{"$push": bson.M{"rehearsals": rehearsal}, "$set": bson.M{"updatedAt": now}})
+	if err != nil {
+		config.LogError("REHEARSALS", fmt.Errorf("failed to add rehearsal to team %s: %w", team.ID.Hex(), err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create rehearsal"})
+		return
+	}
+	middleware.Audit(c).TargetID = rehearsal.ID
+	c.JSON(http.StatusCreated, rehearsal)
+}
+
+// Изменяет или отменяет (cancelled: true) репетицию. Доступно владельцу и
+// редакторам команды. Ответы и отметки посещаемости сохраняются.
+func updateTeamRehearsal(c *gin.Context) {
+	var input models.RehearsalInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	team, ok := loadEditableTeam(ctx, c)
+	if !ok {
+		return
+	}
+	index := findRehearsal(team.Rehearsals, c.Param("rehearsalId"))
+	if index < 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Rehearsal not found"})
+		return
+	}
+
+	rehearsal := team.Rehearsals[index]
+	if !applyRehearsalInput(ctx, c, team, &input, &rehearsal) {
+		return
+	}
+	rehearsal.Sequence++
+	rehearsal.UpdatedAt = time.Now()
+
+	// Ответы и посещаемость меняются отдельными запросами, поэтому
+	// перезаписываются только поля самой репетиции
+	set := bson.M{"updatedAt": rehearsal.UpdatedAt}
+	for field, value := range map[string]interface{}{
+		"title":     rehearsal.Title,
+		"start":     rehearsal.Start,
+		"end":       rehearsal.End,
+		"location":  rehearsal.Location,
+		"notes":     rehearsal.Notes,
+		"agenda":    rehearsal.Agenda,
+		"invited":   rehearsal.Invited,
+		"cancelled": rehearsal.Cancelled,
+		"sequence":  rehearsal.Sequence,
+		"updatedAt": rehearsal.UpdatedAt,
+	} {
+		set["rehearsals.$."+field] = value
+	}
+	result, err := config.TeamsCollection.UpdateOne(ctx,
+		bson.M{"_id": team.ID, "rehearsals.id": rehearsal.ID}, bson.M{"$set": set})
+	if err != nil {
+		config.LogError("REHEARSALS", fmt.Errorf("failed to update rehearsal %s: %w", rehearsal.ID, err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update rehearsal"})
+		return
+	}
+	if result.MatchedCount == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Rehearsal not found"})
+		return
+	}
+	c.JSON(http.StatusOK, rehearsal)
+}
+
+// Удаляет репетицию. Доступно владельцу и редакторам команды.
+func deleteTeamRehearsal(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	team, ok := loadEditableTeam(ctx, c)
+	if !ok {
+		return
+	}
+	rehearsalID := c.Param("rehearsalId")
+	result, err := config.TeamsCollection.UpdateOne(ctx,
+		bson.M{"_id": team.ID, "rehearsals.id": rehearsalID},
+		bson.M{"$pull": bson.M{"rehearsals": bson.M{"id": rehearsalID}}, "$set": bson.M{"updatedAt": time.Now()}})
+	if err != nil {
+		config.LogError("REHEARSALS", fmt.Errorf("failed to delete rehearsal %s: %w", rehearsalID, err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete rehearsal"})
+		return
+	}
+	if result.MatchedCount == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Rehearsal not found"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Rehearsal deleted"})
+}
+
+// Записывает ответ текущего пользователя на приглашение.
+// Тело: status - going, maybe или declined, comment - необязательный комментарий.
+func respondToRehearsal(c *gin.Context) {
+	var input struct {
+		Status  string `json:"status" binding:"required"`
+		Comment string `json:"comment"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	team, ok := loadRehearsalTeam(c)
+	if !ok {
+		return
+	}
+	index := findRehearsal(team.Rehearsals, c.Param("rehearsalId"))
+	if index < 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Rehearsal not found"})
+		return
+	}
+	rehearsal := team.Rehearsals[index]
+	if !rehearsal.IsInvited(userID) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You are not invited to this rehearsal"})
+		return
+	}
+	if rehearsal.Cancelled {
+		c.JSON(http.StatusConflict, gin.H{"error": "Rehearsal is cancelled"})
+		return
+	}
+	if err := rehearsal.SetRSVP(userID, input.Status, input.Comment, time.Now()); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	for _, response := range rehearsal.Responses {
+		if response.UserID != userID {
+			continue
+		}
+		if err := upsertRehearsalRecord(ctx, team.ID, rehearsal.ID, "responses", userID, response); err != nil {
+			config.LogError("REHEARSALS", fmt.Errorf("failed to save RSVP to rehearsal %s: %w", rehearsal.ID, err))
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save response"})
+			return
+		}
+	}
+	c.JSON(http.StatusOK, rehearsal)
+}
+
+// Отмечает посещаемость. Доступно владельцу и редакторам команды.
+// Тело: attendance - список {userId, status}, status - present, late,
+// absent или excused.
+func markRehearsalAttendance(c *gin.Context) {
+	var input struct {
+		Attendance []struct {
+			UserID string `json:"userId"`
+			Status string `json:"status"`
+		} `json:"attendance" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	markedBy, err := middleware.GetUserID(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	team, ok := loadEditableTeam(ctx, c)
+	if !ok {
+		return
+	}
+	index := findRehearsal(team.Rehearsals, c.Param("rehearsalId"))
+	if index < 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Rehearsal not found"})
+		return
+	}
+	rehearsal := team.Rehearsals[index]
+
+	now := time.Now()
+	marked := []primitive.ObjectID{}
+	for _, entry := range input.Attendance {
+		userID, err := primitive.ObjectIDFromHex(entry.UserID)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Invalid user ID %q", entry.UserID)})
+			return
+		}
+		if !teamHasUser(team, userID) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("User %s is not a member of the team", entry.UserID)})
+			return
+		}
+		if err := rehearsal.MarkAttendance(userID, entry.Status, markedBy, now); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		marked = append(marked, userID)
+	}
+
+	for _, record := range rehearsal.Attendance {
+		for _, userID := range marked {
+			if record.UserID != userID {
+				continue
+			}
+			if err := upsertRehearsalRecord(ctx, team.ID, rehearsal.ID, "attendance", userID, record); err != nil {
+				config.LogError("REHEARSALS", fmt.Errorf("failed to save attendance of rehearsal %s: %w", rehearsal.ID, err))
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save attendance"})
+				return
+			}
+			break
+		}
+	}
+	c.JSON(http.StatusOK, rehearsal)
+}
+
+// loadRehearsalTeam загружает команду из параметра :id для чтения репетиций
+func loadRehearsalTeam(c *gin.Context) (*models.Team, bool) {
+	teamID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid team ID format"})
+		return nil, false
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var team models.Team
+	err = config.TeamsCollection.FindOne(ctx, bson.M{"_id": teamID}).Decode(&team)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Team not found"})
+		} else {
+			config.LogError("REHEARSALS", fmt.Errorf("failed to load team %s: %w", teamID.Hex(), err))
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get team"})
+		}
+		return nil, false
+	}
+	return &team, true
+}
+
+// applyRehearsalInput переносит поля в репетицию и проверяет её: проекты
+// повестки должны принадлежать команде, части - существовать в проектах,
+// приглашённые - состоять в команде
+func applyRehearsalInput(ctx context.Context, c *gin.Context, team *models.Team, input *models.RehearsalInput, rehearsal *models.Rehearsal) bool {
+	if err := input.Apply(rehearsal); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return false
+	}
+	if err := rehearsal.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return false
+	}
+	for _, userID := range rehearsal.Invited {
+		if !teamHasUser(team, userID) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Invited user %s is not a member of the team", userID.Hex())})
+			return false
+		}
+	}
+	if len(rehearsal.Agenda) == 0 {
+		return true
+	}
+
+	projectIDs := []primitive.ObjectID{}
+	for _, item := range rehearsal.Agenda {
+		projectIDs = append(projectIDs, item.ProjectID)
+	}
+	projects, err := rehearsalProjects(ctx, []primitive.ObjectID{team.ID}, projectIDs)
+	if err != nil {
+		config.LogError("REHEARSALS", fmt.Errorf("failed to load agenda projects: %w", err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check agenda"})
+		return false
+	}
+	for _, item := range rehearsal.Agenda {
+		project, ok := projects[item.ProjectID]
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Project %s is not a project of the team", item.ProjectID.Hex())})
+			return false
+		}
+		if item.SectionID != "" && findTimelineSection(project.Sections, item.SectionID) < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Section %s not found in project %s", item.SectionID, item.ProjectID.Hex())})
+			return false
+		}
+	}
+	return true
+}
+
+// rehearsalProjects загружает названия и разметку проектов команд по идентификаторам
+func rehearsalProjects(ctx context.Context, teamIDs, ids []primitive.ObjectID) (map[primitive.ObjectID]models.Project, error) {
+	projects := map[primitive.ObjectID]models.Project{}
+	if len(ids) == 0 {
+		return projects, nil
+	}
+	cursor, err := config.ProjectsCollection.Find(ctx,
+		bson.M{"_id": bson.M{"$in": ids}, "teamId": bson.M{"$in": teamIDs}},
+		options.Find().SetProjection(bson.M{"name": 1, "title": 1, "teamId": 1, "sections": 1}))
+	if err != nil {
+		return nil, err
+	}
+	var found []models.Project
+	if err := cursor.All(ctx, &found); err != nil {
+		return nil, err
+	}
+	for _, project := range found {
+		projects[project.ID] = project
+	}
+	return projects, nil
+}
+
+// upsertRehearsalRecord заменяет запись пользователя в списке field
+// (ответы или посещаемость) репетиции или добавляет её. Каждое изменение -
+// один атомарный запрос, поэтому одновременные ответы разных участников не
+// теряются.
+func upsertRehearsalRecord(ctx context.Context, teamID primitive.ObjectID, rehearsalID, field string, userID primitive.ObjectID, record interface{}) error {
+	// Не больше двух попыток: запись могла появиться между запросами
+	for attempt := 0; attempt < 2; attempt++ {
+		result, err := config.TeamsCollection.UpdateOne(ctx,
+			bson.M{"_id": teamID, "rehearsals": bson.M{"$elemMatch": bson.M{"id": rehearsalID, field + ".userId": userID}}},
+			bson.M{"$set": bson.M{"rehearsals.$[r]." + field + ".$[u]": record}},
+			options.Update().SetArrayFilters(options.ArrayFilters{Filters: []interface{}{
+				bson.M{"r.id": rehearsalID},
+				bson.M{"u.userId": userID},
+			}}))
+		if err != nil {
+			return err
+		}
+		if result.MatchedCount > 0 {
+			return nil
+		}
+
+		result, err = config.TeamsCollection.UpdateOne(ctx,
+			bson.M{"_id": teamID, "rehearsals": bson.M{"$elemMatch": bson.M{"id": rehearsalID, field + ".userId": bson.M{"$ne": userID}}}},
+			bson.M{"$push": bson.M{"rehearsals.$." + field: record}})
+		if err != nil {
+			return err
+		}
+		if result.MatchedCount > 0 {
+			return nil
+		}
+	}
+	return fmt.Errorf("rehearsal %s not found", rehearsalID)
+}
+
+func findRehearsal(rehearsals []models.Rehearsal, id string) int {
+	for i := range rehearsals {
+		if rehearsals[i].ID == id {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,259 @@
+package routes
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/kktjss/dance-flow/config"
+	"github.com/kktjss/dance-flow/middleware"
+	"github.com/kktjss/dance-flow/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Регистрирует маршруты состава танцоров команды
+func RegisterRosterRoutes(router *gin.RouterGroup, cfg *config.Config) {
+	roster := router.Group("/teams/:id/roster")
+	roster.Use(middleware.JWTMiddleware(cfg))
+	{
+		roster.GET("", middleware.CheckTeamAccess(), getTeamRoster)
+		roster.POST("", middleware.CheckTeamAccess(), createTeamDancer)
+		roster.PUT("/:dancerId", middleware.CheckTeamAccess(), updateTeamDancer)
+		roster.DELETE("/:dancerId", middleware.CheckTeamAccess(), deleteTeamDancer)
+	}
+}
+
+// Возвращает состав команды, упорядоченный по имени
+func getTeamRoster(c *gin.Context) {
+	teamID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid team ID format"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var team models.Team
+	if err := config.TeamsCollection.FindOne(ctx, bson.M{"_id": teamID}).Decode(&team); err != nil {
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Team not found"})
+		} else {
+			config.LogError("ROSTER", fmt.Errorf("failed to load team %s: %w", teamID.Hex(), err))
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get team"})
+		}
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"roster": sortedRoster(team.Roster)})
+}
+
+// Добавляет танцора в состав. Доступно владельцу и редакторам команды.
+func createTeamDancer(c *gin.Context) {
+	var input models.DancerInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	team, ok := loadEditableTeam(ctx, c)
+	if !ok {
+		return
+	}
+	if len(team.Roster) >= models.MaxRosterSize {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("A team roster can have at most %d dancers", models.MaxRosterSize)})
+		return
+	}
+
+	now := time.Now()
+	dancer := models.Dancer{ID: uuid.New().String(), CreatedAt: now, UpdatedAt: now}
+	if !applyDancerInput(c, team, &input, &dancer) {
+		return
+	}
+
+	_, err := config.TeamsCollection.UpdateOne(ctx, bson.M{"_id": team.ID},
+		bson.M{"$push": bson.M{"roster": dancer}, "$set": bson.M{"updatedAt": now}})
+	if err != nil {
+		config.LogError("ROSTER", fmt.Errorf("failed to add dancer to team %s: %w", team.ID.Hex(), err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add dancer"})
+		return
+	}
+	middleware.Audit(c).TargetID = dancer.ID
+	c.JSON(http.StatusCreated, dancer)
+}
+
+// Изменяет танцора. Доступно владельцу и редакторам команды.
+func updateTeamDancer(c *gin.Context) {
+	var input models.DancerInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	team, ok := loadEditableTeam(ctx, c)
+	if !ok {
+		return
+	}
+	index := findDancer(team.Roster, c.Param("dancerId"))
+	if index < 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Dancer not found"})
+		return
+	}
+
+	dancer := team.Roster[index]
+	if !applyDancerInput(c, team, &input, &dancer) {
+		return
+	}
+	dancer.UpdatedAt = time.Now()
+
+	result, err := config.TeamsCollection.UpdateOne(ctx,
+		bson.M{"_id": team.ID, "roster.id": dancer.ID},
+		bson.M{"$set": bson.M{"roster.$": dancer, "updatedAt": dancer.UpdatedAt}})
+	if err != nil {
+		config.LogError("ROSTER", fmt.Errorf("failed to update dancer %s: %w", dancer.ID, err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update dancer"})
+		return
+	}
+	if result.MatchedCount == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Dancer not found"})
+		return
+	}
+	c.JSON(http.StatusOK, dancer)
+}
+
+// Удаляет танцора из состава и снимает его со всех ролей в проектах команды
+func deleteTeamDancer(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	team, ok := loadEditableTeam(ctx, c)
+	if !ok {
+		return
+	}
+	dancerID := c.Param("dancerId")
+	if findDancer(team.Roster, dancerID) < 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Dancer not found"})
+		return
+	}
+
+	_, err := config.TeamsCollection.UpdateOne(ctx, bson.M{"_id": team.ID},
+		bson.M{"$pull": bson.M{"roster": bson.M{"id": dancerID}}, "$set": bson.M{"updatedAt": time.Now()}})
+	if err != nil {
+		config.LogError("ROSTER", fmt.Errorf("failed to delete dancer %s: %w", dancerID, err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete dancer"})
+		return
+	}
+
+	result, err := config.ProjectsCollection.UpdateMany(ctx,
+		bson.M{"teamId": team.ID, "casting.dancerId": dancerID},
+		bson.M{"$pull": bson.M{"casting": bson.M{"dancerId": dancerID}}})
+	if err != nil {
+		config.LogError("ROSTER", fmt.Errorf("failed to uncast dancer %s: %w", dancerID, err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Dancer deleted, but failed to remove them from project casting"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Dancer deleted", "projectsUpdated": result.ModifiedCount})
+}
+
+// loadEditableTeam загружает команду из параметра :id, если пользователь -
+// её владелец или редактор
+func loadEditableTeam(ctx context.Context, c *gin.Context) (*models.Team, bool) {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return nil, false
+	}
+	teamID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid team ID format"})
+		return nil, false
+	}
+
+	var team models.Team
+	err = config.TeamsCollection.FindOne(ctx, bson.M{
+		"_id": teamID,
+		"$or": []bson.M{
+			{"owner": userID},
+			{"members": bson.M{"$elemMatch": bson.M{"userId": userID, "role": "editor"}}},
+		},
+	}).Decode(&team)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Only team owner or editors can change the roster"})
+		} else {
+			config.LogError("ROSTER", fmt.Errorf("failed to load team %s: %w", teamID.Hex(), err))
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get team"})
+		}
+		return nil, false
+	}
+	return &team, true
+}
+
+// applyDancerInput переносит поля в танцора и проверяет его. Связанный
+// пользователь должен состоять в команде и не быть связан с другим танцором.
+func applyDancerInput(c *gin.Context, team *models.Team, input *models.DancerInput, dancer *models.Dancer) bool {
+	if err := input.Apply(dancer); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return false
+	}
+	if err := dancer.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return false
+	}
+	if dancer.UserID == nil {
+		return true
+	}
+	if !teamHasUser(team, *dancer.UserID) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Linked user must be a member of the team"})
+		return false
+	}
+	for _, other := range team.Roster {
+		if other.ID != dancer.ID && other.UserID != nil && *other.UserID == *dancer.UserID {
+			c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("User is already linked to dancer %q", other.Name)})
+			return false
+		}
+	}
+	return true
+}
+
+// teamHasUser сообщает, что пользователь - владелец или участник команды
+func teamHasUser(team *models.Team, userID primitive.ObjectID) bool {
+	if team.Owner == userID {
+		return true
+	}
+	for _, member := range team.Members {
+		if member.UserID == userID {
+			return true
+		}
+	}
+	return false
+}
+
+func findDancer(roster []models.Dancer, id string) int {
+	for i := range roster {
+		if roster[i].ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+func sortedRoster(roster []models.Dancer) []models.Dancer {
+	sorted := append([]models.Dancer{}, roster...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return strings.ToLower(sorted[i].Name) < strings.ToLower(sorted[j].Name)
+	})
+	return sorted
+}
@@ -0,0 +1,286 @@
+package routes
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kktjss/dance-flow/config"
+	"github.com/kktjss/dance-flow/middleware"
+	"github.com/kktjss/dance-flow/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Максимальный размер холста, для которого пересчитываются координаты
+const maxCanvasSize = 100000.0
+
+// Регистрирует маршруты сцены проекта и перевода координат
+func RegisterStageRoutes(router *gin.RouterGroup, cfg *config.Config) {
+	stage := router.Group("/projects/:id/stage")
+	stage.Use(middleware.JWTMiddleware(cfg))
+	{
+		stage.GET("", middleware.CheckProjectIsPrivate(), getStage)
+		stage.PUT("", middleware.CheckProjectAccess(), updateStage)
+		stage.POST("/migrate", middleware.CheckProjectAccess(), migrateStage)
+		stage.GET("/canvas", middleware.CheckProjectIsPrivate(), getCanvasElements)
+		stage.PUT("/canvas", middleware.CheckProjectAccess(), saveCanvasElements)
+	}
+}
+
+// Возвращает сцену проекта и единицы координат элементов. Для проекта
+// без сцены возвращается сцена по умолчанию.
+func getStage(c *gin.Context) {
+	project, ok := loadStageProject(c)
+	if !ok {
+		return
+	}
+
+	stage := models.DefaultStage()
+	if project.Stage != nil {
+		stage = *project.Stage
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"units":    projectUnits(project),
+		"stage":    stage,
+		"migrated": project.UsesStageUnits(),
+	})
+}
+
+// Изменяет размеры сцены. Позиции элементов в метрах при этом не меняются,
+// у проекта в пикселях сцена сохраняется для последующего перевода.
+func updateStage(c *gin.Context) {
+	projectID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid project ID format"})
+		return
+	}
+
+	var stage models.Stage
+	if err := c.ShouldBindJSON(&stage); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := stage.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	result, err := config.ProjectsCollection.UpdateOne(ctx, bson.M{"_id": projectID},
+		bson.M{"$set": bson.M{"stage": stage, "updatedAt": time.Now()}})
+	if err != nil {
+		config.LogError("STAGE", fmt.Errorf("failed to update stage of project %s: %w", projectID.Hex(), err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update stage"})
+		return
+	}
+	if result.MatchedCount == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Project not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, stage)
+}
+
+// Переводит позиции и размеры элементов проекта из пикселей холста в метры
+// сцены. Размер холста, на котором создавался проект, передаётся в
+// canvasWidth/canvasHeight (по умолчанию 800x600), сцена - в stage
+// (по умолчанию сохранённая сцена проекта или сцена по умолчанию).
+func migrateStage(c *gin.Context) {
+	var input struct {
+		CanvasWidth  float64       `json:"canvasWidth"`
+		CanvasHeight float64       `json:"canvasHeight"`
+		Stage        *models.Stage `json:"stage"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if input.CanvasWidth == 0 {
+		input.CanvasWidth = models.DefaultCanvasWidth
+	}
+	if input.CanvasHeight == 0 {
+		input.CanvasHeight = models.DefaultCanvasHeight
+	}
+	if !validCanvasSize(input.CanvasWidth) || !validCanvasSize(input.CanvasHeight) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Canvas size must be positive"})
+		return
+	}
+
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+	project, ok := loadStageProject(c)
+	if !ok {
+		return
+	}
+	if project.UsesStageUnits() {
+		c.JSON(http.StatusConflict, gin.H{"error": "Project positions are already in stage coordinates"})
+		return
+	}
+
+	stage := models.DefaultStage()
+	if input.Stage != nil {
+		stage = *input.Stage
+	} else if project.Stage != nil {
+		stage = *project.Stage
+	}
+	if err := stage.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	view := stage.Canvas(input.CanvasWidth, input.CanvasHeight)
+	models.ElementsToStage(project.Elements, view)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	set := bson.M{
+		"elements":  project.Elements,
+		"units":     models.UnitsMetres,
+		"stage":     stage,
+		"updatedAt": time.Now(),
+	}
+	if keyframesJSON, ok := elementKeyframesJSON(project.Elements); ok {
+		set["keyframesJson"] = keyframesJSON
+	}
+	// Условие на единицы защищает от повторного перевода при одновременных запросах
+	result, err := config.ProjectsCollection.UpdateOne(ctx,
+		bson.M{"_id": project.ID, "units": bson.M{"$ne": models.UnitsMetres}},
+		bson.M{"$set": set})
+	if err != nil {
+		config.LogError("STAGE", fmt.Errorf("failed to migrate project %s: %w", project.ID.Hex(), err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to migrate project"})
+		return
+	}
+	if result.MatchedCount == 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Project positions are already in stage coordinates"})
+		return
+	}
+
+	description := fmt.Sprintf("Converted element positions to a %.1fx%.1f m stage", stage.Width, stage.Depth)
+	middleware.Audit(c).Summary = description
+	announceProjectUpdate(ctx, userID, project.ID, description)
+
+	c.JSON(http.StatusOK, gin.H{
+		"units":    models.UnitsMetres,
+		"stage":    stage,
+		"scale":    view.Scale,
+		"elements": project.Elements,
+	})
+}
+
+// Возвращает элементы проекта в пикселях холста ?width= x ?height=
+func getCanvasElements(c *gin.Context) {
+	width, height, ok := canvasSizeQuery(c)
+	if !ok {
+		return
+	}
+	project, ok := loadStageProject(c)
+	if !ok {
+		return
+	}
+	if !project.UsesStageUnits() {
+		c.JSON(http.StatusConflict, gin.H{"error": "Project positions are in canvas pixels, migrate it first"})
+		return
+	}
+
+	view := project.Stage.Canvas(width, height)
+	models.ElementsToCanvas(project.Elements, view)
+	c.JSON(http.StatusOK, gin.H{"view": view, "elements": project.Elements})
+}
+
+// Сохраняет элементы, заданные в пикселях холста ?width= x ?height=,
+// переводя их в метры сцены
+func saveCanvasElements(c *gin.Context) {
+	width, height, ok := canvasSizeQuery(c)
+	if !ok {
+		return
+	}
+	var input struct {
+		Elements []interface{} `json:"elements" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	project, ok := loadStageProject(c)
+	if !ok {
+		return
+	}
+	if !project.UsesStageUnits() {
+		c.JSON(http.StatusConflict, gin.H{"error": "Project positions are in canvas pixels, migrate it first"})
+		return
+	}
+
+	// Элементы в пикселях нормализуются с пиксельными значениями по умолчанию
+	canvasProject := models.Project{Elements: input.Elements}
+	canvasProject.NormalizeElements()
+	models.ElementsToStage(canvasProject.Elements, project.Stage.Canvas(width, height))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if err := saveProjectElements(ctx, project, canvasProject.Elements); err != nil {
+		respondProjectSaveError(c, "STAGE", project.ID, err, "Failed to save elements")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"elements": canvasProject.Elements})
+}
+
+// loadStageProject загружает проект из параметра :id, отвечая ошибкой при неудаче
+func loadStageProject(c *gin.Context) (*models.Project, bool) {
+	projectID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid project ID format"})
+		return nil, false
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	project, err := loadProject(ctx, projectID)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Project not found"})
+		} else {
+			config.LogError("STAGE", fmt.Errorf("failed to load project %s: %w", projectID.Hex(), err))
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get project"})
+		}
+		return nil, false
+	}
+	return project, true
+}
+
+// canvasSizeQuery читает размер холста из параметров ?width= и ?height=
+func canvasSizeQuery(c *gin.Context) (float64, float64, bool) {
+	width, errWidth := strconv.ParseFloat(c.Query("width"), 64)
+	height, errHeight := strconv.ParseFloat(c.Query("height"), 64)
+	if errWidth != nil || errHeight != nil || !validCanvasSize(width) || !validCanvasSize(height) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "width and height of the canvas are required"})
+		return 0, 0, false
+	}
+	return width, height, true
+}
+
+func validCanvasSize(size float64) bool {
+	return size > 0 && size <= maxCanvasSize && !math.IsNaN(size)
+}
+
+// projectUnits возвращает единицы позиций элементов проекта
+func projectUnits(project *models.Project) string {
+	if project.UsesStageUnits() {
+		return models.UnitsMetres
+	}
+	return models.UnitsPixels
+}
@@ -10,6 +10,7 @@ import (
 	"github.com/kktjss/dance-flow/config"
 	"github.com/kktjss/dance-flow/middleware"
 	"github.com/kktjss/dance-flow/models"
+	"github.com/kktjss/dance-flow/notify"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo/options"
@@ -36,6 +37,9 @@ func RegisterTeamRoutes(router *gin.RouterGroup, cfg *config.Config) {
 		teams.POST("/:id/projects", middleware.CheckTeamAccess(), addProjectToTeam)
 		teams.DELETE("/:id/projects/:projectId", middleware.CheckTeamAccess(), removeProjectFromTeam)
 		teams.GET("/:id/projects/:projectId/viewer", middleware.CheckTeamAccess(), getTeamProjectViewer)
+
+		// Библиотека 3D моделей команды
+		teams.GET("/:id/models", middleware.CheckTeamAccess(), getTeamModels)
 		
 		// Добавляем тестовый эндпоинт
 		teams.GET("/test", func(c *gin.Context) {
@@ -86,6 +90,32 @@ func getTeams(c *gin.Context) {
 	c.JSON(http.StatusOK, teams)
 }
 
+// findUserTeamIDs возвращает ID команд, где пользователь является владельцем или участником
+func findUserTeamIDs(ctx context.Context, userID primitive.ObjectID) ([]primitive.ObjectID, error) {
+	cursor, err := config.TeamsCollection.Find(ctx, bson.M{
+		"$or": []bson.M{
+			{"owner": userID},
+			{"members.userId": userID},
+		},
+	}, options.Find().SetProjection(bson.M{"_id": 1}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	teamIDs := []primitive.ObjectID{}
+	for cursor.Next(ctx) {
+		var team struct {
+			ID primitive.ObjectID `bson:"_id"`
+		}
+		if err := cursor.Decode(&team); err != nil {
+			return nil, err
+		}
+		teamIDs = append(teamIDs, team.ID)
+	}
+	return teamIDs, cursor.Err()
+}
+
 // Возвращает одну команду по ID, если у пользователя есть доступ
 func getTeam(c *gin.Context) {
 	teamID := c.Param("id")
@@ -220,6 +250,7 @@ func createTeam(c *gin.Context) {
 		// Логируем ошибку, но продолжаем - мы все еще создали команду
 	}
 
+	middleware.Audit(c).TargetID = team.ID.Hex()
 	c.JSON(http.StatusCreated, team)
 }
 
@@ -355,6 +386,10 @@ func deleteTeam(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete team"})
 		return
 	}
+	if err := deleteWebhooks(ctx, bson.M{"teamId": teamObjID}); err != nil {
+		config.LogError("TEAMS", fmt.Errorf("failed to delete team webhooks: %w", err))
+	}
+	middleware.Audit(c).Before = bson.M{"name": team.Name}
 
 	c.JSON(http.StatusOK, gin.H{"message": "Team deleted successfully"})
 }
@@ -507,6 +542,12 @@ func addTeamMember(c *gin.Context) {
 		// Логируем ошибку, но продолжаем - мы все еще добавили участника в команду
 	}
 
+	// Сообщаем новому участнику о добавлении в команду
+	notify.TeamMemberAdded(ctx, currentUserID, &team, userObjID, input.Role)
+	publishWebhookEvent(ctx, teamMemberWebhookEvent(models.WebhookMemberAdded, &team, currentUserID, userObjID, input.Role))
+	middleware.Audit(c).TargetID = userObjID.Hex()
+	middleware.Audit(c).After = bson.M{"role": input.Role}
+
 	// Возвращаем обновленную команду
 	err = config.TeamsCollection.FindOne(ctx, bson.M{"_id": teamObjID}).Decode(&team)
 	if err != nil {
@@ -572,6 +613,14 @@ func removeTeamMember(c *gin.Context) {
 		return
 	}
 
+	// Роль удаляемого участника нужна для события вебхука
+	removedRole := ""
+	for _, member := range team.Members {
+		if member.UserID == userObjIDToRemove {
+			removedRole = member.Role
+		}
+	}
+
 	// Удаляем участника из команды
 	_, err = config.TeamsCollection.UpdateOne(
 		ctx,
@@ -598,6 +647,11 @@ func removeTeamMember(c *gin.Context) {
 		// Логируем ошибку, но продолжаем - мы все еще удалили участника из команды
 	}
 
+	middleware.Audit(c).Before = bson.M{"role": removedRole}
+	if removedRole != "" {
+		publishWebhookEvent(ctx, teamMemberWebhookEvent(models.WebhookMemberRemoved, &team, currentUserID, userObjIDToRemove, removedRole))
+	}
+
 	// Возвращаем обновленную команду
 	err = config.TeamsCollection.FindOne(ctx, bson.M{"_id": teamObjID}).Decode(&team)
 	if err != nil {
@@ -730,17 +784,24 @@ func addProjectToTeam(c *gin.Context) {
 		return
 	}
 
-	// Обновляем проект, чтобы он принадлежал команде
+	// Обновляем проект, чтобы он принадлежал команде. Роли ссылаются на
+	// состав прежней команды, поэтому при переходе они снимаются.
+	projectUpdate := bson.M{"$set": bson.M{"teamId": teamObjID, "updatedAt": time.Now()}}
+	if project.TeamID != teamObjID {
+		projectUpdate["$unset"] = bson.M{"casting": ""}
+	}
 	_, err = config.ProjectsCollection.UpdateOne(
 		ctx,
 		bson.M{"_id": projectObjID},
-		bson.M{"$set": bson.M{"teamId": teamObjID, "updatedAt": time.Now()}},
+		projectUpdate,
 	)
 	if err != nil {
 		config.LogError("TEAMS", fmt.Errorf("failed to update project: %w", err))
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update project"})
 		return
 	}
+	middleware.Audit(c).TargetID = projectObjID.Hex()
+	middleware.Audit(c).ProjectID = projectObjID
 
 	// Возвращаем обновленную команду
 	err = config.TeamsCollection.FindOne(ctx, bson.M{"_id": teamObjID}).Decode(&team)
@@ -820,7 +881,7 @@ func removeProjectFromTeam(c *gin.Context) {
 	_, err = config.ProjectsCollection.UpdateOne(
 		ctx,
 		bson.M{"_id": projectObjID},
-		bson.M{"$unset": bson.M{"teamId": ""}, "$set": bson.M{"updatedAt": time.Now()}},
+		bson.M{"$unset": bson.M{"teamId": "", "casting": ""}, "$set": bson.M{"updatedAt": time.Now()}},
 	)
 	if err != nil {
 		config.LogError("TEAMS", fmt.Errorf("failed to update project: %w", err))
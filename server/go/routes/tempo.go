@@ -0,0 +1,330 @@
+package routes
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kktjss/dance-flow/config"
+	"github.com/kktjss/dance-flow/middleware"
+	"github.com/kktjss/dance-flow/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Ограничения запросов к карте темпа
+const (
+	maxTempoConversions = 1000
+	maxTempoGridPoints  = 20000
+	defaultGridDuration = 60.0
+)
+
+// Регистрирует маршруты карты темпа и перевода времени в такты и счёт
+func RegisterTempoRoutes(router *gin.RouterGroup, cfg *config.Config) {
+	tempo := router.Group("/projects/:id/tempo")
+	tempo.Use(middleware.JWTMiddleware(cfg))
+	{
+		tempo.GET("", middleware.CheckProjectIsPrivate(), getTempoMap)
+		tempo.PUT("", middleware.CheckProjectAccess(), updateTempoMap)
+		tempo.DELETE("", middleware.CheckProjectAccess(), deleteTempoMap)
+		tempo.GET("/convert", middleware.CheckProjectIsPrivate(), convertTempo)
+		tempo.GET("/grid", middleware.CheckProjectIsPrivate(), getTempoGrid)
+	}
+}
+
+// Возвращает карту темпа проекта (null, если она не задана)
+func getTempoMap(c *gin.Context) {
+	projectID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid project ID format"})
+		return
+	}
+	tempoMap, ok := loadTempoMap(c, projectID)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"tempoMap": tempoMap})
+}
+
+// Задаёт карту темпа проекта. Время ключевых кадров при этом не меняется.
+func updateTempoMap(c *gin.Context) {
+	projectID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid project ID format"})
+		return
+	}
+
+	var tempoMap models.TempoMap
+	if err := c.ShouldBindJSON(&tempoMap); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := tempoMap.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	result, err := config.ProjectsCollection.UpdateOne(ctx, bson.M{"_id": projectID},
+		bson.M{"$set": bson.M{"tempoMap": tempoMap, "updatedAt": time.Now()}})
+	if err != nil {
+		config.LogError("TEMPO", fmt.Errorf("failed to update tempo map of project %s: %w", projectID.Hex(), err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update tempo map"})
+		return
+	}
+	if result.MatchedCount == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Project not found"})
+		return
+	}
+
+	description := fmt.Sprintf("Set tempo map: %g BPM, %d/%d", tempoMap.BPM, tempoMap.BeatsPerBar, tempoMap.BeatUnit)
+	middleware.Audit(c).Summary = description
+	announceProjectUpdate(ctx, userID, projectID, description)
+
+	c.JSON(http.StatusOK, tempoMap)
+}
+
+// Удаляет карту темпа проекта
+func deleteTempoMap(c *gin.Context) {
+	projectID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid project ID format"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	result, err := config.ProjectsCollection.UpdateOne(ctx, bson.M{"_id": projectID},
+		bson.M{"$unset": bson.M{"tempoMap": ""}, "$set": bson.M{"updatedAt": time.Now()}})
+	if err != nil {
+		config.LogError("TEMPO", fmt.Errorf("failed to delete tempo map of project %s: %w", projectID.Hex(), err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete tempo map"})
+		return
+	}
+	if result.MatchedCount == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Project not found"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Tempo map deleted"})
+}
+
+// Переводит время в такты и счёт и обратно. Варианты запроса:
+// ?seconds=1.5,12 - моменты в секундах; ?bar=5&beat=3 - такт и доля в нём;
+// ?eight=3&count=5 - восьмёрка и счёт в ней. Доля и счёт могут быть дробными.
+func convertTempo(c *gin.Context) {
+	projectID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid project ID format"})
+		return
+	}
+
+	var seconds []float64
+	var bar, eight int
+	inBar, count := 1.0, 1.0
+	mode := ""
+	switch {
+	case c.Query("seconds") != "":
+		mode = "seconds"
+		parts := strings.Split(c.Query("seconds"), ",")
+		if len(parts) > maxTempoConversions {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("At most %d moments can be converted at once", maxTempoConversions)})
+			return
+		}
+		for _, part := range parts {
+			t, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+			if err != nil || math.IsNaN(t) || math.IsInf(t, 0) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Invalid time %q", part)})
+				return
+			}
+			seconds = append(seconds, t)
+		}
+	case c.Query("bar") != "":
+		mode = "bar"
+		if bar, err = strconv.Atoi(c.Query("bar")); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "bar must be an integer"})
+			return
+		}
+		if inBar, err = parseCountQuery(c, "beat"); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	case c.Query("eight") != "":
+		mode = "eight"
+		if eight, err = strconv.Atoi(c.Query("eight")); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "eight must be an integer"})
+			return
+		}
+		if count, err = parseCountQuery(c, "count"); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Pass ?seconds=, ?bar=&beat= or ?eight=&count="})
+		return
+	}
+
+	tempoMap, ok := loadTempoMap(c, projectID)
+	if !ok {
+		return
+	}
+	if tempoMap == nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "Project has no tempo map"})
+		return
+	}
+
+	positions := make([]models.MusicalPosition, 0, len(seconds))
+	switch mode {
+	case "seconds":
+		for _, t := range seconds {
+			positions = append(positions, tempoMap.Position(t))
+		}
+	case "bar":
+		positions = append(positions, tempoMap.PositionOfBeat(tempoMap.BarBeat(bar, inBar)))
+	default:
+		positions = append(positions, tempoMap.PositionOfBeat(tempoMap.CountBeat(eight, count)))
+	}
+	c.JSON(http.StatusOK, gin.H{"positions": positions})
+}
+
+// Возвращает сетку счёта для шкалы времени: моменты долей (или их частей
+// при ?division=2..16) в интервале ?from= .. ?to= секунд. По умолчанию
+// интервал - длительность проекта.
+func getTempoGrid(c *gin.Context) {
+	projectID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid project ID format"})
+		return
+	}
+
+	division := 1
+	if raw := c.Query("division"); raw != "" {
+		division, err = strconv.Atoi(raw)
+		if err != nil || division < 1 || division > models.MaxSnapDivision {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("division must be between 1 and %d", models.MaxSnapDivision)})
+			return
+		}
+	}
+	from, to := 0.0, -1.0
+	for _, param := range []struct {
+		name  string
+		value *float64
+	}{{"from", &from}, {"to", &to}} {
+		raw := c.Query(param.name)
+		if raw == "" {
+			continue
+		}
+		parsed, err := strconv.ParseFloat(raw, 64)
+		// NaN не проходит сравнение, иначе сетка долей строилась бы без конца
+		if err != nil || !(parsed >= 0) || math.IsInf(parsed, 0) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": param.name + " must be a non-negative number"})
+			return
+		}
+		*param.value = parsed
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var project models.Project
+	err = config.ProjectsCollection.FindOne(ctx, bson.M{"_id": projectID},
+		options.FindOne().SetProjection(bson.M{"tempoMap": 1, "duration": 1})).Decode(&project)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Project not found"})
+		} else {
+			config.LogError("TEMPO", fmt.Errorf("failed to load project %s: %w", projectID.Hex(), err))
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get project"})
+		}
+		return
+	}
+	if project.TempoMap == nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "Project has no tempo map"})
+		return
+	}
+	if to < 0 {
+		to = float64(project.Duration)
+		if to <= 0 {
+			to = defaultGridDuration
+		}
+	}
+	if to < from {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "to must not be before from"})
+		return
+	}
+
+	tempoMap := project.TempoMap
+	step := 1 / float64(division)
+	first := math.Ceil(tempoMap.BeatAt(from)*float64(division)-1e-9) / float64(division)
+	last := tempoMap.BeatAt(to)
+	if (last-first)/step >= maxTempoGridPoints {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Grid is too dense, narrow the interval or lower the division"})
+		return
+	}
+
+	grid := []models.MusicalPosition{}
+	for k := 0; ; k++ {
+		beat := first + float64(k)*step
+		if beat > last+1e-9 {
+			break
+		}
+		grid = append(grid, tempoMap.PositionOfBeat(beat))
+	}
+	c.JSON(http.StatusOK, gin.H{"tempoMap": tempoMap, "division": division, "grid": grid})
+}
+
+// loadTempoMap загружает карту темпа проекта, отвечая ошибкой при неудаче
+func loadTempoMap(c *gin.Context, projectID primitive.ObjectID) (*models.TempoMap, bool) {
+	tempoMap, err := projectTempoMap(projectID)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Project not found"})
+		} else {
+			config.LogError("TEMPO", fmt.Errorf("failed to load tempo map of project %s: %w", projectID.Hex(), err))
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get tempo map"})
+		}
+		return nil, false
+	}
+	return tempoMap, true
+}
+
+// projectTempoMap возвращает карту темпа проекта или nil, если она не задана
+func projectTempoMap(projectID primitive.ObjectID) (*models.TempoMap, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var project models.Project
+	err := config.ProjectsCollection.FindOne(ctx, bson.M{"_id": projectID},
+		options.FindOne().SetProjection(bson.M{"tempoMap": 1})).Decode(&project)
+	if err != nil {
+		return nil, err
+	}
+	return project.TempoMap, nil
+}
+
+// parseCountQuery читает долю или счёт (с единицы, по умолчанию 1)
+func parseCountQuery(c *gin.Context, name string) (float64, error) {
+	raw := c.Query(name)
+	if raw == "" {
+		return 1, nil
+	}
+	value, err := strconv.ParseFloat(raw, 64)
+	if err != nil || math.IsNaN(value) || math.IsInf(value, 0) || value < 1 {
+		return 0, fmt.Errorf("%s must be a number starting from 1", name)
+	}
+	return value, nil
+}
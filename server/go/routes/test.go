@@ -3,13 +3,14 @@ package routes
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"io"
 	"log"
 	"net/http"
-	"net/url"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/kktjss/dance-flow/analyzer"
 	"github.com/kktjss/dance-flow/config"
 	"github.com/kktjss/dance-flow/middleware"
 	"go.mongodb.org/mongo-driver/bson"
@@ -24,74 +25,70 @@ func RegisterTestRoutes(router *gin.RouterGroup, cfg *config.Config) {
 	testGroup.POST("/test-save-keyframes", testSaveKeyframes)
 	
 	// Добавляем прокси-маршрут для process-frame
+	getAnalyzerClient(cfg)
 	router.POST("/process-frame", proxyProcessFrame)
+	// Состояние серверов содержит их внутренние адреса, поэтому только для вошедших
+	router.GET("/analyzer/status", middleware.JWTMiddleware(cfg), getAnalyzerStatus)
 }
 
 // proxyProcessFrame перенаправляет запросы на Python сервер
 func proxyProcessFrame(c *gin.Context) {
 	log.Println("[PROXY] Forwarding /api/process-frame request to Python server")
 	
-	// Создаем целевой URL
-	target, err := url.Parse("http://127.0.0.1:8000/process-frame")
+	// Буферизуем тело, чтобы запрос можно было повторить на другом сервере
+	body, err := io.ReadAll(io.LimitReader(c.Request.Body, maxProxyBodySize+1))
 	if err != nil {
-		log.Printf("[PROXY] Error parsing target URL: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"message": "Proxy error"})
+		log.Printf("[PROXY] Error reading request body: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Failed to read request body"})
 		return
 	}
-	
-	// Копируем параметры запроса
-	query := target.Query()
-	for k, v := range c.Request.URL.Query() {
-		for _, vv := range v {
-			query.Add(k, vv)
-		}
-	}
-	target.RawQuery = query.Encode()
-	
-	// Создаем HTTP клиент
-	client := &http.Client{
-		Timeout: 30 * time.Second,
-	}
-	
-	// Создаем новый запрос
-	req, err := http.NewRequest(c.Request.Method, target.String(), c.Request.Body)
-	if err != nil {
-		log.Printf("[PROXY] Error creating request: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"message": "Proxy error"})
+	if len(body) > maxProxyBodySize {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"message": "Frame is too large"})
 		return
 	}
 	
 	// Копируем заголовки
+	header := http.Header{}
 	for k, v := range c.Request.Header {
-		if k != "Content-Length" { // Пропускаем Content-Length, так как он будет установлен автоматически
-			for _, vv := range v {
-				req.Header.Add(k, vv)
-			}
+		if k != "Content-Length" && k != "Authorization" { // Content-Length будет установлен автоматически
+			header[k] = v
 		}
 	}
 	
-	// Отправляем запрос
-	resp, err := client.Do(req)
+	// Распознавание кадра не меняет состояние сервера, поэтому запрос можно повторять
+	resp, err := analyzerClient.Do(c.Request.Context(), analyzer.Request{
+		Method:     c.Request.Method,
+		Path:       "/process-frame",
+		Query:      c.Request.URL.Query(),
+		Header:     header,
+		Body:       body,
+		Idempotent: true,
+	})
+	var unavailable *analyzer.UnavailableError
+	if errors.As(err, &unavailable) {
+		log.Printf("[PROXY] Analyzer unavailable: %v", err)
+		respondAnalyzerUnavailable(c, unavailable)
+		return
+	}
 	if err != nil {
 		log.Printf("[PROXY] Error forwarding request: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"message": "Proxy error", "error": err.Error()})
+		c.JSON(http.StatusBadGateway, gin.H{"message": "Proxy error", "error": err.Error()})
 		return
 	}
-	defer resp.Body.Close()
 	
 	// Копируем заголовки ответа
 	for k, v := range resp.Header {
+		if k == "Content-Length" {
+			continue
+		}
 		for _, vv := range v {
 			c.Header(k, vv)
 		}
 	}
 	
-	// Устанавливаем код состояния
+	// Устанавливаем код состояния и копируем тело ответа
 	c.Status(resp.StatusCode)
-	
-	// Копируем тело ответа
-	_, err = io.Copy(c.Writer, resp.Body)
-	if err != nil {
+	if _, err := c.Writer.Write(resp.Body); err != nil {
 		log.Printf("[PROXY] Error copying response: %v", err)
 	}
 }
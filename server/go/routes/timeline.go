@@ -0,0 +1,544 @@
+package routes
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/kktjss/dance-flow/config"
+	"github.com/kktjss/dance-flow/middleware"
+	"github.com/kktjss/dance-flow/models"
+	"github.com/kktjss/dance-flow/timeline"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Регистрирует маршруты разметки шкалы времени: секций и отметок
+func RegisterTimelineRoutes(router *gin.RouterGroup, cfg *config.Config) {
+	tl := router.Group("/projects/:id/timeline")
+	tl.Use(middleware.JWTMiddleware(cfg))
+	{
+		tl.GET("", middleware.CheckProjectIsPrivate(), getTimeline)
+
+		tl.POST("/sections", middleware.CheckProjectAccess(), createTimelineSection)
+		tl.PUT("/sections/:sectionId", middleware.CheckProjectAccess(), updateTimelineSection)
+		tl.DELETE("/sections/:sectionId", middleware.CheckProjectAccess(), deleteTimelineSection)
+		tl.POST("/sections/:sectionId/copy", middleware.CheckProjectAccess(), copyTimelineSection)
+		tl.POST("/sections/:sectionId/repeat", middleware.CheckProjectAccess(), repeatTimelineSection)
+
+		tl.POST("/cues", middleware.CheckProjectAccess(), createTimelineCue)
+		tl.PUT("/cues/:cueId", middleware.CheckProjectAccess(), updateTimelineCue)
+		tl.DELETE("/cues/:cueId", middleware.CheckProjectAccess(), deleteTimelineCue)
+		tl.POST("/cues/:cueId/shift", middleware.CheckProjectAccess(), shiftAfterTimelineCue)
+	}
+}
+
+// Возвращает секции и отметки проекта, упорядоченные по времени
+func getTimeline(c *gin.Context) {
+	project, ok := loadTimelineMarkers(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"sections": project.Sections, "cues": project.Cues})
+}
+
+// Создаёт секцию
+func createTimelineSection(c *gin.Context) {
+	var input models.TimelineSectionInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if input.Start == nil || input.End == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "start and end are required"})
+		return
+	}
+	section := models.TimelineSection{ID: uuid.New().String()}
+	input.Apply(&section)
+	if err := section.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	project, ok := loadTimelineMarkers(c)
+	if !ok {
+		return
+	}
+	if len(project.Sections) >= models.MaxTimelineSections {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("A project can have at most %d sections", models.MaxTimelineSections)})
+		return
+	}
+	if !updateTimelineMarkers(c, project.ID, bson.M{"$push": bson.M{"sections": section}}) {
+		return
+	}
+	middleware.Audit(c).TargetID = section.ID
+	c.JSON(http.StatusCreated, section)
+}
+
+// Изменяет секцию. Ключевые кадры при этом не меняются.
+func updateTimelineSection(c *gin.Context) {
+	var input models.TimelineSectionInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	project, ok := loadTimelineMarkers(c)
+	if !ok {
+		return
+	}
+	index := findTimelineSection(project.Sections, c.Param("sectionId"))
+	if index < 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Section not found"})
+		return
+	}
+
+	section := project.Sections[index]
+	input.Apply(&section)
+	if err := section.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	result, err := config.ProjectsCollection.UpdateOne(ctx,
+		bson.M{"_id": project.ID, "sections.id": section.ID},
+		bson.M{"$set": bson.M{"sections.$": section, "updatedAt": time.Now()}})
+	if err != nil {
+		config.LogError("TIMELINE", fmt.Errorf("failed to update section %s: %w", section.ID, err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update section"})
+		return
+	}
+	if result.MatchedCount == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Section not found"})
+		return
+	}
+	c.JSON(http.StatusOK, section)
+}
+
+// Удаляет секцию. Ключевые кадры внутри неё остаются.
+func deleteTimelineSection(c *gin.Context) {
+	projectID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid project ID format"})
+		return
+	}
+	deleteTimelineMarker(c, projectID, "sections", c.Param("sectionId"), "Section")
+}
+
+// Создаёт отметку
+func createTimelineCue(c *gin.Context) {
+	var input models.TimelineCueInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if input.Time == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "time is required"})
+		return
+	}
+	cue := models.TimelineCue{ID: uuid.New().String()}
+	input.Apply(&cue)
+	if err := cue.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	project, ok := loadTimelineMarkers(c)
+	if !ok {
+		return
+	}
+	if len(project.Cues) >= models.MaxTimelineCues {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("A project can have at most %d cues", models.MaxTimelineCues)})
+		return
+	}
+	if !updateTimelineMarkers(c, project.ID, bson.M{"$push": bson.M{"cues": cue}}) {
+		return
+	}
+	middleware.Audit(c).TargetID = cue.ID
+	c.JSON(http.StatusCreated, cue)
+}
+
+// Изменяет отметку
+func updateTimelineCue(c *gin.Context) {
+	var input models.TimelineCueInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	project, ok := loadTimelineMarkers(c)
+	if !ok {
+		return
+	}
+	index := findTimelineCue(project.Cues, c.Param("cueId"))
+	if index < 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Cue not found"})
+		return
+	}
+
+	cue := project.Cues[index]
+	input.Apply(&cue)
+	if err := cue.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	result, err := config.ProjectsCollection.UpdateOne(ctx,
+		bson.M{"_id": project.ID, "cues.id": cue.ID},
+		bson.M{"$set": bson.M{"cues.$": cue, "updatedAt": time.Now()}})
+	if err != nil {
+		config.LogError("TIMELINE", fmt.Errorf("failed to update cue %s: %w", cue.ID, err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update cue"})
+		return
+	}
+	if result.MatchedCount == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Cue not found"})
+		return
+	}
+	c.JSON(http.StatusOK, cue)
+}
+
+// Удаляет отметку
+func deleteTimelineCue(c *gin.Context) {
+	projectID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid project ID format"})
+		return
+	}
+	deleteTimelineMarker(c, projectID, "cues", c.Param("cueId"), "Cue")
+}
+
+// Копирует движение секции в момент to (секунды) и создаёт там секцию
+// с тем же цветом и именем name (по умолчанию «<имя> (copy)»). Ключевые
+// кадры на месте копии заменяются.
+func copyTimelineSection(c *gin.Context) {
+	var input struct {
+		To   *float64 `json:"to" binding:"required"`
+		Name string   `json:"name"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	project, section, ok := loadTimelineSection(c)
+	if !ok {
+		return
+	}
+
+	written, err := timeline.CopyRange(project.Elements, section.Start, section.End, *input.To)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	copied := section
+	copied.ID = uuid.New().String()
+	copied.Name = input.Name
+	if copied.Name == "" {
+		copied.Name = section.Name + " (copy)"
+	}
+	copied.Start = *input.To
+	copied.End = *input.To + section.End - section.Start
+	if err := copied.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if len(project.Sections) >= models.MaxTimelineSections {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("A project can have at most %d sections", models.MaxTimelineSections)})
+		return
+	}
+	project.Sections = append(project.Sections, copied)
+
+	description := fmt.Sprintf("Copied section %q to %.2fs", section.Name, *input.To)
+	if !saveTimelineEdit(c, project, description) {
+		return
+	}
+	middleware.Audit(c).TargetID = copied.ID
+	c.JSON(http.StatusOK, gin.H{
+		"section":          copied,
+		"keyframesWritten": written,
+		"sections":         project.Sections,
+		"cues":             project.Cues,
+		"elements":         project.Elements,
+	})
+}
+
+// Повторяет секцию times раз сразу после её конца и создаёт секции для
+// повторов. При shift: true всё, что идёт после секции, сдвигается на длину
+// повторов, иначе повторы заменяют ключевые кадры после секции.
+func repeatTimelineSection(c *gin.Context) {
+	var input struct {
+		Times int  `json:"times" binding:"required"`
+		Shift bool `json:"shift"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if input.Times < 1 || input.Times > timeline.MaxRepeats {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("times must be between 1 and %d", timeline.MaxRepeats)})
+		return
+	}
+	project, section, ok := loadTimelineSection(c)
+	if !ok {
+		return
+	}
+
+	length := section.End - section.Start
+	written, err := timeline.Repeat(project.Elements, section.Start, section.End, input.Times, input.Shift)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if input.Shift {
+		project.Sections, project.Cues = timeline.ShiftMarkers(project.Sections, project.Cues,
+			section.End, length*float64(input.Times))
+	}
+	repeats := make([]models.TimelineSection, 0, input.Times)
+	for k := 1; k <= input.Times; k++ {
+		repeat := section
+		repeat.ID = uuid.New().String()
+		repeat.Name = fmt.Sprintf("%s (%d)", section.Name, k+1)
+		repeat.Start = section.End + length*float64(k-1)
+		repeat.End = repeat.Start + length
+		if err := repeat.Validate(); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		repeats = append(repeats, repeat)
+	}
+	project.Sections = append(project.Sections, repeats...)
+	if len(project.Sections) > models.MaxTimelineSections {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("A project can have at most %d sections", models.MaxTimelineSections)})
+		return
+	}
+
+	description := fmt.Sprintf("Repeated section %q %d times", section.Name, input.Times)
+	if !saveTimelineEdit(c, project, description) {
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"repeats":          repeats,
+		"keyframesWritten": written,
+		"sections":         project.Sections,
+		"cues":             project.Cues,
+		"elements":         project.Elements,
+	})
+}
+
+// Сдвигает на by секунд всё, что начинается в момент отметки и позже:
+// ключевые кадры, секции и отметки (включая саму отметку). При
+// отрицательном сдвиге ключевые кадры перед отметкой на длину сдвига удаляются.
+func shiftAfterTimelineCue(c *gin.Context) {
+	var input struct {
+		By *float64 `json:"by" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if math.IsNaN(*input.By) || math.IsInf(*input.By, 0) || *input.By == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "by must be a non-zero number of seconds"})
+		return
+	}
+	project, ok := loadTimelineProject(c)
+	if !ok {
+		return
+	}
+	index := findTimelineCue(project.Cues, c.Param("cueId"))
+	if index < 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Cue not found"})
+		return
+	}
+	cue := project.Cues[index]
+
+	moved, err := timeline.Shift(project.Elements, cue.Time, *input.By)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	project.Sections, project.Cues = timeline.ShiftMarkers(project.Sections, project.Cues, cue.Time, *input.By)
+
+	description := fmt.Sprintf("Shifted timeline after cue %q by %+.2fs", cue.Name, *input.By)
+	if !saveTimelineEdit(c, project, description) {
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"keyframesMoved": moved,
+		"sections":       project.Sections,
+		"cues":           project.Cues,
+		"elements":       project.Elements,
+	})
+}
+
+// loadTimelineMarkers загружает только разметку проекта из параметра :id
+func loadTimelineMarkers(c *gin.Context) (*models.Project, bool) {
+	projectID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid project ID format"})
+		return nil, false
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var project models.Project
+	err = config.ProjectsCollection.FindOne(ctx, bson.M{"_id": projectID},
+		options.FindOne().SetProjection(bson.M{"sections": 1, "cues": 1})).Decode(&project)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Project not found"})
+		} else {
+			config.LogError("TIMELINE", fmt.Errorf("failed to load timeline of project %s: %w", projectID.Hex(), err))
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get timeline"})
+		}
+		return nil, false
+	}
+	sortTimelineMarkers(&project)
+	return &project, true
+}
+
+// loadTimelineProject загружает проект целиком для операций над ключевыми кадрами
+func loadTimelineProject(c *gin.Context) (*models.Project, bool) {
+	projectID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid project ID format"})
+		return nil, false
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	project, err := loadProject(ctx, projectID)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Project not found"})
+		} else {
+			config.LogError("TIMELINE", fmt.Errorf("failed to load project %s: %w", projectID.Hex(), err))
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get project"})
+		}
+		return nil, false
+	}
+	sortTimelineMarkers(project)
+	return project, true
+}
+
+// loadTimelineSection загружает проект и секцию из параметра :sectionId
+func loadTimelineSection(c *gin.Context) (*models.Project, models.TimelineSection, bool) {
+	project, ok := loadTimelineProject(c)
+	if !ok {
+		return nil, models.TimelineSection{}, false
+	}
+	index := findTimelineSection(project.Sections, c.Param("sectionId"))
+	if index < 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Section not found"})
+		return nil, models.TimelineSection{}, false
+	}
+	return project, project.Sections[index], true
+}
+
+// saveTimelineEdit сохраняет элементы и разметку после операции и пишет историю
+func saveTimelineEdit(c *gin.Context, project *models.Project, description string) bool {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return false
+	}
+	sortTimelineMarkers(project)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	set := bson.M{
+		"elements": project.Elements,
+		"sections": project.Sections,
+		"cues":     project.Cues,
+	}
+	if keyframesJSON, ok := elementKeyframesJSON(project.Elements); ok {
+		set["keyframesJson"] = keyframesJSON
+	}
+	if err := saveLoadedProject(ctx, project, set); err != nil {
+		respondProjectSaveError(c, "TIMELINE", project.ID, err, "Failed to save project")
+		return false
+	}
+
+	middleware.Audit(c).Summary = description
+	announceProjectUpdate(ctx, userID, project.ID, description)
+	return true
+}
+
+// updateTimelineMarkers применяет изменение разметки к проекту
+func updateTimelineMarkers(c *gin.Context, projectID primitive.ObjectID, update bson.M) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	update["$set"] = bson.M{"updatedAt": time.Now()}
+	result, err := config.ProjectsCollection.UpdateOne(ctx, bson.M{"_id": projectID}, update)
+	if err != nil {
+		config.LogError("TIMELINE", fmt.Errorf("failed to update timeline of project %s: %w", projectID.Hex(), err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update timeline"})
+		return false
+	}
+	if result.MatchedCount == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Project not found"})
+		return false
+	}
+	return true
+}
+
+// deleteTimelineMarker удаляет секцию или отметку по идентификатору
+func deleteTimelineMarker(c *gin.Context, projectID primitive.ObjectID, field, id, label string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	result, err := config.ProjectsCollection.UpdateOne(ctx,
+		bson.M{"_id": projectID, field + ".id": id},
+		bson.M{"$pull": bson.M{field: bson.M{"id": id}}, "$set": bson.M{"updatedAt": time.Now()}})
+	if err != nil {
+		config.LogError("TIMELINE", fmt.Errorf("failed to delete %s %s: %w", field, id, err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete " + field})
+		return
+	}
+	if result.MatchedCount == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": label + " not found"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": label + " deleted"})
+}
+
+func sortTimelineMarkers(project *models.Project) {
+	if project.Sections == nil {
+		project.Sections = []models.TimelineSection{}
+	}
+	if project.Cues == nil {
+		project.Cues = []models.TimelineCue{}
+	}
+	sort.SliceStable(project.Sections, func(i, j int) bool { return project.Sections[i].Start < project.Sections[j].Start })
+	sort.SliceStable(project.Cues, func(i, j int) bool { return project.Cues[i].Time < project.Cues[j].Time })
+}
+
+func findTimelineSection(sections []models.TimelineSection, id string) int {
+	for i := range sections {
+		if sections[i].ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+func findTimelineCue(cues []models.TimelineCue, id string) int {
+	for i := range cues {
+		if cues[i].ID == id {
+			return i
+		}
+	}
+	return -1
+}
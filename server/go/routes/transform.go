@@ -0,0 +1,148 @@
+package routes
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kktjss/dance-flow/config"
+	"github.com/kktjss/dance-flow/middleware"
+	"github.com/kktjss/dance-flow/models"
+	"github.com/kktjss/dance-flow/timeline"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Регистрирует маршрут массового преобразования элементов проекта
+func RegisterTransformRoutes(router *gin.RouterGroup, cfg *config.Config) {
+	transform := router.Group("/projects/:id/transform")
+	transform.Use(middleware.JWTMiddleware(cfg))
+	{
+		transform.POST("", middleware.CheckProjectAccess(), transformProject)
+	}
+}
+
+// Применяет к элементам проекта сдвиг и растяжение времени, отражение,
+// поворот и перенос за одно сохранение. Тело: elementIds - элементы (по
+// умолчанию все), from и to - окно ключевых кадров в секундах, ripple -
+// сдвинуть кадры после окна вслед за его концом, operations - операции по
+// порядку, dryRun - вернуть результат без сохранения. Точки и расстояния
+// задаются в единицах проекта; поворот - по часовой стрелке на схеме со
+// зрителями внизу. Без center отражение и поворот идут вокруг центра сцены,
+// а в проекте в пикселях - вокруг центра выбранных элементов.
+func transformProject(c *gin.Context) {
+	projectID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid project ID format"})
+		return
+	}
+
+	var input struct {
+		ElementIDs []string             `json:"elementIds"`
+		From       *float64             `json:"from"`
+		To         *float64             `json:"to"`
+		Ripple     bool                 `json:"ripple"`
+		Operations []timeline.Operation `json:"operations" binding:"required"`
+		DryRun     bool                 `json:"dryRun"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	transform := timeline.Transform{
+		ElementIDs: input.ElementIDs,
+		From:       input.From,
+		To:         input.To,
+		Ripple:     input.Ripple,
+		Operations: input.Operations,
+	}
+	if err := transform.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	project, err := loadProject(ctx, projectID)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Project not found"})
+		} else {
+			config.LogError("TRANSFORM", fmt.Errorf("failed to load project %s: %w", projectID.Hex(), err))
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get project"})
+		}
+		return
+	}
+
+	// Проект в метрах преобразуется на холсте сцены и переводится обратно;
+	// ось Y сцены направлена вглубь, а холста - к зрителям
+	view := stageFormationCanvas(project)
+	var center timeline.Point
+	if view != nil {
+		for i := range transform.Operations {
+			op := &transform.Operations[i]
+			if op.Center != nil {
+				position := view.ToCanvas(models.Position{X: op.Center.X, Y: op.Center.Y})
+				op.Center = &timeline.Point{X: position.X, Y: position.Y}
+			}
+			op.DX, op.DY = op.DX*view.Scale, -op.DY*view.Scale
+		}
+		position := view.ToCanvas(models.Position{X: 0, Y: view.Stage.Depth / 2})
+		center = timeline.Point{X: position.X, Y: position.Y}
+	} else if selection, ok := timeline.SelectionCenter(project.Elements, transform); ok {
+		center = selection
+	} else {
+		center = timeline.Point{X: models.DefaultCanvasWidth / 2, Y: models.DefaultCanvasHeight / 2}
+	}
+
+	result, err := timeline.Apply(project.Elements, transform, center)
+	if errors.Is(err, timeline.ErrUnknownElement) || err == timeline.ErrNothingSelected {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err == timeline.ErrNegativeTime {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if view != nil {
+		models.ElementsToStage(project.Elements, *view)
+	}
+
+	// Предпросмотр ничего не меняет и в журнал не попадает
+	middleware.Audit(c).Skip = input.DryRun
+	if !input.DryRun {
+		if err := saveProjectElements(ctx, project, project.Elements); err != nil {
+			respondProjectSaveError(c, "TRANSFORM", project.ID, err, "Failed to save elements")
+			return
+		}
+		types := make([]string, len(transform.Operations))
+		for i, op := range transform.Operations {
+			types[i] = op.Type
+		}
+		description := fmt.Sprintf("Transformed %d elements (%s)", result.Elements, strings.Join(types, ", "))
+		middleware.Audit(c).Summary = description
+		announceProjectUpdate(ctx, userID, project.ID, description)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"units":    projectUnits(project),
+		"dryRun":   input.DryRun,
+		"result":   result,
+		"elements": project.Elements,
+	})
+}
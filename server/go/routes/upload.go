@@ -1,10 +1,13 @@
 package routes
 
 import (
+	"errors"
 	"fmt"
 	"io"
+	"mime/multipart"
 	"net/http"
 	"os"
+	"path"
 	"path/filepath"
 	"strings"
 	"time"
@@ -24,65 +27,110 @@ func RegisterUploadRoutes(router *gin.RouterGroup, cfg *config.Config) {
 	}
 }
 
+// Directory and allowed extensions for uploaded videos
+const videosDir = "uploads/videos"
+
+var allowedVideoExts = map[string]bool{
+	".mp4": true,
+	".mov": true,
+	".avi": true,
+	".wmv": true,
+	".mkv": true,
+}
+
+// Directory for uploaded audio files
+const audioDir = "uploads/audio"
+
+var errInvalidVideoType = errors.New("Invalid file type. Allowed types: mp4, mov, avi, wmv, mkv")
+
 // uploadVideo handles video file uploads
 func uploadVideo(c *gin.Context) {
-	// Check if the uploads directory exists, if not create it
-	uploadDir := "uploads/videos"
-	if err := os.MkdirAll(uploadDir, 0755); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create upload directory"})
+	// Get the file from the request
+	header, err := c.FormFile("video")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No file provided"})
 		return
 	}
 
-	// Get the file from the request
-	file, header, err := c.Request.FormFile("video")
+	fileURL, err := saveVideoFile(header)
+	if err == errInvalidVideoType {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "No file provided"})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
-	defer file.Close()
 
+	// Return the file URL
+	middleware.Audit(c).TargetID = fileURL
+	c.JSON(http.StatusOK, gin.H{
+		"url":      fileURL,
+		"filename": path.Base(fileURL),
+		"success":  true,
+	})
+}
+
+// saveVideoFile validates the video extension, stores the file under a unique
+// name and returns its public URL
+func saveVideoFile(header *multipart.FileHeader) (string, error) {
 	// Validate file type
-	filename := header.Filename
-	ext := strings.ToLower(filepath.Ext(filename))
-	allowedExts := map[string]bool{
-		".mp4": true,
-		".mov": true,
-		".avi": true,
-		".wmv": true,
-		".mkv": true,
+	ext := strings.ToLower(filepath.Ext(header.Filename))
+	if !allowedVideoExts[ext] {
+		return "", errInvalidVideoType
 	}
 
-	if !allowedExts[ext] {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid file type. Allowed types: mp4, mov, avi, wmv, mkv"})
-		return
+	// Check if the uploads directory exists, if not create it
+	if err := os.MkdirAll(videosDir, 0755); err != nil {
+		return "", errors.New("Failed to create upload directory")
+	}
+
+	file, err := header.Open()
+	if err != nil {
+		return "", errors.New("Failed to read uploaded file")
 	}
+	defer file.Close()
 
 	// Create a unique filename using timestamp
 	newFilename := fmt.Sprintf("%d%s", time.Now().UnixNano(), ext)
-	filePath := filepath.Join(uploadDir, newFilename)
-
-	// Create the file on the server
-	out, err := os.Create(filePath)
+	out, err := os.Create(filepath.Join(videosDir, newFilename))
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create file"})
-		return
+		return "", errors.New("Failed to create file")
 	}
 	defer out.Close()
 
 	// Copy the file data to the new file
-	_, err = io.Copy(out, file)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save file"})
-		return
+	if _, err := io.Copy(out, file); err != nil {
+		return "", errors.New("Failed to save file")
 	}
 
-	// Return the file URL
-	fileURL := "/uploads/videos/" + newFilename
-	c.JSON(http.StatusOK, gin.H{
-		"url":      fileURL,
-		"filename": newFilename,
-		"success":  true,
-	})
+	return "/uploads/videos/" + newFilename, nil
+}
+
+// videoPathFromURL maps a public /uploads/videos URL to the local file path
+func videoPathFromURL(fileURL string) (string, error) {
+	if !strings.HasPrefix(fileURL, "/uploads/videos/") {
+		return "", errors.New("Only videos uploaded to this server can be analyzed")
+	}
+
+	filePath := filepath.Join(videosDir, path.Base(fileURL))
+	if _, err := os.Stat(filePath); err != nil {
+		return "", errors.New("Video file not found")
+	}
+	return filePath, nil
+}
+
+// audioPathFromURL maps a public /uploads/audio URL to the local file path
+func audioPathFromURL(fileURL string) (string, error) {
+	if !strings.HasPrefix(fileURL, "/uploads/audio/") {
+		return "", errors.New("Only audio uploaded to this server can be analyzed")
+	}
+
+	filePath := filepath.Join(audioDir, path.Base(fileURL))
+	if _, err := os.Stat(filePath); err != nil {
+		return "", errors.New("Audio file not found")
+	}
+	return filePath, nil
 }
 
 // uploadFile handles general file uploads including audio
@@ -114,7 +162,7 @@ func uploadFile(c *gin.Context) {
 	}
 	
 	if audioExts[ext] {
-		uploadDir = "uploads/audio"
+		uploadDir = audioDir
 		allowedExts = audioExts
 	} else {
 		// For other file types
@@ -156,6 +204,7 @@ func uploadFile(c *gin.Context) {
 	
 	// Return the file URL
 	fileURL := fmt.Sprintf("/%s/%s", uploadDir, newFilename)
+	middleware.Audit(c).TargetID = fileURL
 	c.JSON(http.StatusOK, gin.H{
 		"url":      fileURL,
 		"filename": newFilename,
@@ -261,6 +261,16 @@ func deleteCurrentUser(c *gin.Context) {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
+	// Журнал аудита не удаляется вместе с учётной записью, поэтому имя
+	// автора записывается заранее
+	var account models.User
+	if err := config.UsersCollection.FindOne(ctx, bson.M{"_id": userID}).Decode(&account); err == nil {
+		middleware.Audit(c).ActorName = account.Name
+		if account.Name == "" {
+			middleware.Audit(c).ActorName = account.Username
+		}
+	}
+
 	// 1. Удаляем пользователя из всех команд, где он является участником
 	_, err = config.TeamsCollection.UpdateMany(
 		ctx,
@@ -316,13 +326,21 @@ func deleteCurrentUser(c *gin.Context) {
 	}
 
 	// 4. Удаляем записи истории пользователя
-	_, err = config.GetCollection("history").DeleteMany(ctx, bson.M{"userId": userID})
+	_, err = config.HistoryCollection.DeleteMany(ctx, bson.M{"userId": userID})
 	if err != nil {
 		config.LogError("USERS", fmt.Errorf("failed to delete user's history: %w", err))
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete account"})
 		return
 	}
 
+	// Удаляем уведомления пользователя
+	if _, err := config.NotificationsCollection.DeleteMany(ctx, bson.M{"userId": userID}); err != nil {
+		config.LogError("USERS", fmt.Errorf("failed to delete user's notifications: %w", err))
+	}
+	if err := deleteWebhooks(ctx, bson.M{"userId": userID}); err != nil {
+		config.LogError("USERS", fmt.Errorf("failed to delete user's webhooks: %w", err))
+	}
+
 	// 5. Удаляем команды, где пользователь является владельцем
 	_, err = config.TeamsCollection.DeleteMany(ctx, bson.M{"owner": userID})
 	if err != nil {
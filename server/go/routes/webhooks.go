@@ -0,0 +1,466 @@
+package routes
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kktjss/dance-flow/config"
+	"github.com/kktjss/dance-flow/middleware"
+	"github.com/kktjss/dance-flow/models"
+	"github.com/kktjss/dance-flow/webhook"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Размер страницы журнала доставок
+const (
+	defaultDeliveriesLimit = 50
+	maxDeliveriesLimit     = 200
+)
+
+// Регистрирует маршруты вебхуков команды и текущего пользователя
+func RegisterWebhookRoutes(router *gin.RouterGroup, cfg *config.Config) {
+	webhookDispatcher = webhook.NewDispatcher(webhook.MongoStore{},
+		webhook.NewClient(cfg.WebhookTimeout, cfg.WebhookAllowPrivate), cfg.WebhookWorkers)
+
+	// Продолжаем доставки, прерванные перезапуском сервера
+	if config.DB != nil {
+		webhookDispatcher.StartPolling()
+	}
+
+	teamWebhooks := router.Group("/teams/:id/webhooks")
+	teamWebhooks.Use(middleware.JWTMiddleware(cfg), middleware.CheckTeamAccess())
+	registerWebhookHandlers(teamWebhooks)
+
+	userWebhooks := router.Group("/users/me/webhooks")
+	userWebhooks.Use(middleware.JWTMiddleware(cfg))
+	registerWebhookHandlers(userWebhooks)
+}
+
+// registerWebhookHandlers подключает обработчики, общие для вебхуков
+// команды и пользователя
+func registerWebhookHandlers(group *gin.RouterGroup) {
+	group.GET("", getWebhooks)
+	group.POST("", createWebhook)
+	group.GET("/:webhookId", getWebhook)
+	group.PUT("/:webhookId", updateWebhook)
+	group.DELETE("/:webhookId", deleteWebhook)
+	group.POST("/:webhookId/rotate-secret", rotateWebhookSecret)
+	group.POST("/:webhookId/test", testWebhook)
+	group.GET("/:webhookId/deliveries", getWebhookDeliveries)
+	group.POST("/:webhookId/deliveries/:deliveryId/redeliver", redeliverWebhook)
+}
+
+// webhookOwner возвращает условие выборки вебхуков владельца из пути
+// запроса: команды (/teams/:id) или текущего пользователя. Вебхуками
+// команды управляют только её владелец и редакторы.
+func webhookOwner(ctx context.Context, c *gin.Context) (bson.M, bool) {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return nil, false
+	}
+	if c.Param("id") == "" {
+		return bson.M{"userId": userID}, true
+	}
+
+	teamID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid team ID format"})
+		return nil, false
+	}
+	count, err := config.TeamsCollection.CountDocuments(ctx, bson.M{
+		"_id": teamID,
+		"$or": []bson.M{
+			{"owner": userID},
+			{"members": bson.M{"$elemMatch": bson.M{"userId": userID, "role": "editor"}}},
+		},
+	})
+	if err != nil {
+		config.LogError("WEBHOOKS", fmt.Errorf("failed to check team %s: %w", teamID.Hex(), err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get team"})
+		return nil, false
+	}
+	if count == 0 {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only team owner or editors can manage webhooks"})
+		return nil, false
+	}
+	return bson.M{"teamId": teamID}, true
+}
+
+// loadWebhook загружает вебхук владельца из пути запроса
+func loadWebhook(ctx context.Context, c *gin.Context) (*models.Webhook, bool) {
+	owner, ok := webhookOwner(ctx, c)
+	if !ok {
+		return nil, false
+	}
+	webhookID, err := primitive.ObjectIDFromHex(c.Param("webhookId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid webhook ID format"})
+		return nil, false
+	}
+
+	filter := bson.M{"_id": webhookID}
+	for key, value := range owner {
+		filter[key] = value
+	}
+	var hook models.Webhook
+	err = config.WebhooksCollection.FindOne(ctx, filter).Decode(&hook)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Webhook not found"})
+		} else {
+			config.LogError("WEBHOOKS", fmt.Errorf("failed to load webhook %s: %w", webhookID.Hex(), err))
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get webhook"})
+		}
+		return nil, false
+	}
+	return &hook, true
+}
+
+// webhookWithSecret - ответ, в котором секрет показывается один раз
+type webhookWithSecret struct {
+	*models.Webhook
+	Secret string `json:"secret"`
+}
+
+// Возвращает вебхуки владельца
+func getWebhooks(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	owner, ok := webhookOwner(ctx, c)
+	if !ok {
+		return
+	}
+	cursor, err := config.WebhooksCollection.Find(ctx, owner, options.Find().SetSort(bson.M{"createdAt": 1}))
+	if err != nil {
+		config.LogError("WEBHOOKS", fmt.Errorf("failed to find webhooks: %w", err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get webhooks"})
+		return
+	}
+	hooks := []models.Webhook{}
+	if err := cursor.All(ctx, &hooks); err != nil {
+		config.LogError("WEBHOOKS", fmt.Errorf("failed to decode webhooks: %w", err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get webhooks"})
+		return
+	}
+	c.JSON(http.StatusOK, hooks)
+}
+
+// Создаёт вебхук. Секрет для проверки подписи возвращается только в этом
+// ответе и при смене секрета.
+func createWebhook(c *gin.Context) {
+	var input models.WebhookInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid webhook data: " + err.Error()})
+		return
+	}
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	owner, ok := webhookOwner(ctx, c)
+	if !ok {
+		return
+	}
+
+	now := time.Now()
+	hook := models.Webhook{Active: true, CreatedBy: userID, CreatedAt: now, UpdatedAt: now}
+	if teamID, ok := owner["teamId"].(primitive.ObjectID); ok {
+		hook.TeamID = teamID
+	} else {
+		hook.UserID = userID
+	}
+	input.Apply(&hook)
+	if err := hook.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	count, err := config.WebhooksCollection.CountDocuments(ctx, owner)
+	if err != nil {
+		config.LogError("WEBHOOKS", fmt.Errorf("failed to count webhooks: %w", err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create webhook"})
+		return
+	}
+	if count >= models.MaxWebhooksPerOwner {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("At most %d webhooks are allowed", models.MaxWebhooksPerOwner)})
+		return
+	}
+
+	if hook.Secret, err = models.NewWebhookSecret(); err != nil {
+		config.LogError("WEBHOOKS", fmt.Errorf("failed to generate webhook secret: %w", err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create webhook"})
+		return
+	}
+	hook.ID = primitive.NewObjectID()
+	if _, err := config.WebhooksCollection.InsertOne(ctx, hook); err != nil {
+		config.LogError("WEBHOOKS", fmt.Errorf("failed to insert webhook: %w", err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create webhook"})
+		return
+	}
+	middleware.Audit(c).TargetID = hook.ID.Hex()
+	middleware.Audit(c).After = bson.M{"url": hook.URL, "events": hook.Events}
+	c.JSON(http.StatusCreated, webhookWithSecret{Webhook: &hook, Secret: hook.Secret})
+}
+
+// Возвращает вебхук
+func getWebhook(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	hook, ok := loadWebhook(ctx, c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, hook)
+}
+
+// Изменяет адрес, события, описание или активность вебхука
+func updateWebhook(c *gin.Context) {
+	var input models.WebhookInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid webhook data: " + err.Error()})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	hook, ok := loadWebhook(ctx, c)
+	if !ok {
+		return
+	}
+	input.Apply(hook)
+	if err := hook.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	hook.UpdatedAt = time.Now()
+
+	_, err := config.WebhooksCollection.UpdateOne(ctx, bson.M{"_id": hook.ID}, bson.M{"$set": bson.M{
+		"url":         hook.URL,
+		"events":      hook.Events,
+		"active":      hook.Active,
+		"description": hook.Description,
+		"updatedAt":   hook.UpdatedAt,
+	}})
+	if err != nil {
+		config.LogError("WEBHOOKS", fmt.Errorf("failed to update webhook %s: %w", hook.ID.Hex(), err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update webhook"})
+		return
+	}
+	c.JSON(http.StatusOK, hook)
+}
+
+// Удаляет вебхук вместе с журналом доставок
+func deleteWebhook(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	hook, ok := loadWebhook(ctx, c)
+	if !ok {
+		return
+	}
+	if _, err := config.WebhooksCollection.DeleteOne(ctx, bson.M{"_id": hook.ID}); err != nil {
+		config.LogError("WEBHOOKS", fmt.Errorf("failed to delete webhook %s: %w", hook.ID.Hex(), err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete webhook"})
+		return
+	}
+	if _, err := config.WebhookDeliveriesCollection.DeleteMany(ctx, bson.M{"webhookId": hook.ID}); err != nil {
+		config.LogError("WEBHOOKS", fmt.Errorf("failed to delete deliveries of webhook %s: %w", hook.ID.Hex(), err))
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Webhook deleted successfully"})
+}
+
+// Заменяет секрет вебхука. Прежний секрет перестаёт действовать сразу,
+// в том числе для ожидающих повтора доставок.
+func rotateWebhookSecret(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	hook, ok := loadWebhook(ctx, c)
+	if !ok {
+		return
+	}
+	secret, err := models.NewWebhookSecret()
+	if err != nil {
+		config.LogError("WEBHOOKS", fmt.Errorf("failed to generate webhook secret: %w", err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to rotate secret"})
+		return
+	}
+	hook.Secret = secret
+	hook.UpdatedAt = time.Now()
+	_, err = config.WebhooksCollection.UpdateOne(ctx, bson.M{"_id": hook.ID},
+		bson.M{"$set": bson.M{"secret": hook.Secret, "updatedAt": hook.UpdatedAt}})
+	if err != nil {
+		config.LogError("WEBHOOKS", fmt.Errorf("failed to rotate secret of webhook %s: %w", hook.ID.Hex(), err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to rotate secret"})
+		return
+	}
+	c.JSON(http.StatusOK, webhookWithSecret{Webhook: hook, Secret: hook.Secret})
+}
+
+// Отправляет вебхуку тестовое событие ping и возвращает результат попытки.
+// Тестовое событие не повторяется, но попадает в журнал доставок.
+func testWebhook(c *gin.Context) {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	hook, ok := loadWebhook(ctx, c)
+	if !ok {
+		return
+	}
+	event := webhook.NewEvent(models.WebhookPing, bson.M{"webhookId": hook.ID, "events": hook.Events})
+	if !hook.TeamID.IsZero() {
+		event.TeamID = &hook.TeamID
+	}
+	event.ActorID = &userID
+
+	delivery, err := webhookDispatcher.Send(ctx, hook, event)
+	if err != nil {
+		config.LogError("WEBHOOKS", fmt.Errorf("failed to send test event to webhook %s: %w", hook.ID.Hex(), err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to send test event"})
+		return
+	}
+	c.JSON(http.StatusOK, delivery)
+}
+
+// Возвращает журнал доставок вебхука, новые сначала. ?status= отбирает
+// доставки по статусу, ?limit= и ?offset= - страница.
+func getWebhookDeliveries(c *gin.Context) {
+	filter := bson.M{}
+	if status := c.Query("status"); status != "" {
+		if status != models.DeliveryPending && status != models.DeliverySucceeded && status != models.DeliveryFailed {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "status must be pending, succeeded or failed"})
+			return
+		}
+		filter["status"] = status
+	}
+	limit, offset := defaultDeliveriesLimit, 0
+	var err error
+	if value := c.Query("limit"); value != "" {
+		if limit, err = strconv.Atoi(value); err != nil || limit < 1 || limit > maxDeliveriesLimit {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("limit must be between 1 and %d", maxDeliveriesLimit)})
+			return
+		}
+	}
+	if value := c.Query("offset"); value != "" {
+		if offset, err = strconv.Atoi(value); err != nil || offset < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "offset must be a non-negative integer"})
+			return
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	hook, ok := loadWebhook(ctx, c)
+	if !ok {
+		return
+	}
+	filter["webhookId"] = hook.ID
+
+	total, err := config.WebhookDeliveriesCollection.CountDocuments(ctx, filter)
+	if err != nil {
+		config.LogError("WEBHOOKS", fmt.Errorf("failed to count deliveries of webhook %s: %w", hook.ID.Hex(), err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get deliveries"})
+		return
+	}
+	cursor, err := config.WebhookDeliveriesCollection.Find(ctx, filter, options.Find().
+		SetSort(bson.D{{Key: "createdAt", Value: -1}, {Key: "_id", Value: -1}}).
+		SetSkip(int64(offset)).
+		SetLimit(int64(limit)))
+	if err != nil {
+		config.LogError("WEBHOOKS", fmt.Errorf("failed to find deliveries of webhook %s: %w", hook.ID.Hex(), err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get deliveries"})
+		return
+	}
+	deliveries := []models.WebhookDelivery{}
+	if err := cursor.All(ctx, &deliveries); err != nil {
+		config.LogError("WEBHOOKS", fmt.Errorf("failed to decode deliveries of webhook %s: %w", hook.ID.Hex(), err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get deliveries"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"deliveries": deliveries, "total": total})
+}
+
+// Повторно отправляет доставку с тем же телом и ID события, чтобы
+// получатель мог отбросить дубликат
+func redeliverWebhook(c *gin.Context) {
+	deliveryID, err := primitive.ObjectIDFromHex(c.Param("deliveryId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid delivery ID format"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	hook, ok := loadWebhook(ctx, c)
+	if !ok {
+		return
+	}
+	if !hook.Active {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Webhook is disabled"})
+		return
+	}
+
+	var delivery models.WebhookDelivery
+	err = config.WebhookDeliveriesCollection.FindOne(ctx, bson.M{"_id": deliveryID, "webhookId": hook.ID}).Decode(&delivery)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Delivery not found"})
+		} else {
+			config.LogError("WEBHOOKS", fmt.Errorf("failed to load delivery %s: %w", deliveryID.Hex(), err))
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get delivery"})
+		}
+		return
+	}
+	if delivery.Status == models.DeliveryPending {
+		c.JSON(http.StatusConflict, gin.H{"error": "Delivery is still pending"})
+		return
+	}
+
+	if err := webhookDispatcher.Redeliver(ctx, &delivery); err != nil {
+		config.LogError("WEBHOOKS", fmt.Errorf("failed to redeliver %s: %w", deliveryID.Hex(), err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to redeliver"})
+		return
+	}
+	c.JSON(http.StatusAccepted, delivery)
+}
+
+// deleteWebhooks удаляет вебхуки, подходящие под условие, вместе с их
+// журналами доставок
+func deleteWebhooks(ctx context.Context, filter bson.M) error {
+	ids, err := config.WebhooksCollection.Distinct(ctx, "_id", filter)
+	if err != nil {
+		return err
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+	if _, err := config.WebhookDeliveriesCollection.DeleteMany(ctx, bson.M{"webhookId": bson.M{"$in": ids}}); err != nil {
+		return err
+	}
+	_, err = config.WebhooksCollection.DeleteMany(ctx, bson.M{"_id": bson.M{"$in": ids}})
+	return err
+}
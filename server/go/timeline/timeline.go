@@ -0,0 +1,295 @@
+// Package timeline переписывает время ключевых кадров элементов и разметку
+// шкалы времени при копировании, повторе и сдвиге частей постановки
+package timeline
+
+import (
+	"errors"
+	"math"
+	"sort"
+
+	"github.com/kktjss/dance-flow/models"
+)
+
+// MaxRepeats ограничивает число повторов секции за одну операцию
+const MaxRepeats = 32
+
+// Допуск при сравнении моментов времени, с
+const timeEpsilon = 1e-9
+
+// Ошибки операций над шкалой времени
+var (
+	ErrInvalidRange = errors.New("range must end after it starts")
+	ErrNegativeTime = errors.New("operation would move keyframes before the start of the timeline")
+	ErrRepeatCount  = errors.New("repeat count is out of range")
+)
+
+// CopyRange копирует движение элементов на отрезке [start, end] в отрезок
+// той же длины, начинающийся в target. Ключевые кадры целевого отрезка
+// заменяются; на его границах ставятся кадры с состоянием элемента в начале
+// и в конце исходного отрезка, поэтому движение повторяется точно. Элементы
+// без ключевых кадров не меняются. Возвращает число записанных кадров.
+func CopyRange(elements []interface{}, start, end, target float64) (int, error) {
+	if !(end > start) || start < 0 || math.IsInf(end, 0) {
+		return 0, ErrInvalidRange
+	}
+	if target < 0 || math.IsNaN(target) || math.IsInf(target, 0) {
+		return 0, ErrNegativeTime
+	}
+	return copyRange(elements, start, end, target, false), nil
+}
+
+// copyRange выполняет CopyRange. При keepStart кадр в момент target не
+// заменяется и начальное состояние копии туда не пишется: так повтор
+// продолжает движение из конца предыдущего прохода.
+func copyRange(elements []interface{}, start, end, target float64, keepStart bool) int {
+	written := 0
+	for _, raw := range elements {
+		element, ok := raw.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		keyframes, others := splitKeyframes(element)
+		if len(keyframes) == 0 {
+			continue
+		}
+
+		// Снимок исходного отрезка с граничными кадрами
+		from := start - timeEpsilon
+		copies := []map[string]interface{}{}
+		if keepStart {
+			from = start + timeEpsilon
+		} else if !hasKeyframeAt(keyframes, start) {
+			copies = append(copies, stateAt(keyframes, start))
+		}
+		for _, kf := range keyframes {
+			if t := keyframeTime(kf); t >= from && t <= end+timeEpsilon {
+				copies = append(copies, deepCopy(kf).(map[string]interface{}))
+			}
+		}
+		if !hasKeyframeAt(keyframes, end) {
+			copies = append(copies, stateAt(keyframes, end))
+		}
+
+		length := end - start
+		kept := keyframes[:0:0]
+		for _, kf := range keyframes {
+			if t := keyframeTime(kf); t < target+from-start || t > target+length+timeEpsilon {
+				kept = append(kept, kf)
+			}
+		}
+		for _, kf := range copies {
+			kf["time"] = roundTime(keyframeTime(kf) - start + target)
+			kept = append(kept, kf)
+		}
+		written += len(copies)
+		setKeyframes(element, kept, others)
+	}
+	return written
+}
+
+// Repeat повторяет отрезок [start, end] times раз сразу после его конца.
+// Если shift, кадры после конца отрезка сначала сдвигаются на длину
+// повторов, иначе повторы заменяют их. Кадр в конце каждого прохода
+// сохраняется, и следующий повтор ведёт из него к кадрам отрезка.
+func Repeat(elements []interface{}, start, end float64, times int, shift bool) (int, error) {
+	if !(end > start) || start < 0 || math.IsInf(end, 0) {
+		return 0, ErrInvalidRange
+	}
+	if times < 1 || times > MaxRepeats {
+		return 0, ErrRepeatCount
+	}
+	length := end - start
+	if shift {
+		shiftKeyframes(elements, end, length*float64(times), false)
+	}
+	written := 0
+	for k := 0; k < times; k++ {
+		written += copyRange(elements, start, end, end+length*float64(k), true)
+	}
+	return written, nil
+}
+
+// Shift сдвигает на by секунд ключевые кадры с моментом не раньше at.
+// При отрицательном сдвиге кадры на отрезке [at+by, at) удаляются: их место
+// занимают сдвинутые. Возвращает число сдвинутых кадров.
+func Shift(elements []interface{}, at, by float64) (int, error) {
+	if math.IsNaN(at) || math.IsNaN(by) || math.IsInf(by, 0) || at+by < 0 {
+		return 0, ErrNegativeTime
+	}
+	return shiftKeyframes(elements, at, by, true), nil
+}
+
+func shiftKeyframes(elements []interface{}, at, by float64, inclusive bool) int {
+	moved := 0
+	after := func(t float64) bool {
+		if inclusive {
+			return t >= at-timeEpsilon
+		}
+		return t > at+timeEpsilon
+	}
+	for _, raw := range elements {
+		element, ok := raw.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		keyframes, others := splitKeyframes(element)
+		if len(keyframes) == 0 {
+			continue
+		}
+		kept := keyframes[:0:0]
+		for _, kf := range keyframes {
+			t := keyframeTime(kf)
+			switch {
+			case after(t):
+				kf["time"] = roundTime(t + by)
+				moved++
+			case by < 0 && t >= at+by-timeEpsilon:
+				continue
+			}
+			kept = append(kept, kf)
+		}
+		setKeyframes(element, kept, others)
+	}
+	return moved
+}
+
+// ShiftMarkers сдвигает разметку так же, как Shift сдвигает кадры: секции
+// и отметки, начинающиеся не раньше at, переносятся, секции, захватывающие
+// at, растягиваются или сжимаются. При отрицательном сдвиге отметки и секции
+// внутри удалённого отрезка удаляются.
+func ShiftMarkers(sections []models.TimelineSection, cues []models.TimelineCue, at, by float64) ([]models.TimelineSection, []models.TimelineCue) {
+	cut := at + by
+	shiftedSections := make([]models.TimelineSection, 0, len(sections))
+	for _, s := range sections {
+		if by < 0 && s.Start >= cut-timeEpsilon && s.Start < at-timeEpsilon && s.End <= at+timeEpsilon {
+			continue
+		}
+		switch {
+		case s.Start >= at-timeEpsilon:
+			s.Start = roundTime(s.Start + by)
+		case by < 0 && s.Start >= cut-timeEpsilon:
+			s.Start = roundTime(cut)
+		}
+		switch {
+		case s.End > at+timeEpsilon:
+			s.End = roundTime(s.End + by)
+		case by < 0 && s.End > cut+timeEpsilon:
+			s.End = roundTime(cut)
+		}
+		if s.End > s.Start {
+			shiftedSections = append(shiftedSections, s)
+		}
+	}
+
+	shiftedCues := make([]models.TimelineCue, 0, len(cues))
+	for _, c := range cues {
+		if c.Time >= at-timeEpsilon {
+			c.Time = roundTime(c.Time + by)
+		} else if by < 0 && c.Time >= cut-timeEpsilon {
+			continue
+		}
+		shiftedCues = append(shiftedCues, c)
+	}
+	return shiftedSections, shiftedCues
+}
+
+// splitKeyframes возвращает ключевые кадры элемента, упорядоченные по
+// времени, и записи без корректного времени, которые сохраняются как есть
+func splitKeyframes(element map[string]interface{}) ([]map[string]interface{}, []interface{}) {
+	raw, _ := element["keyframes"].([]interface{})
+	keyframes := make([]map[string]interface{}, 0, len(raw))
+	var others []interface{}
+	for _, item := range raw {
+		kf, ok := item.(map[string]interface{})
+		if !ok || math.IsNaN(keyframeTime(kf)) {
+			others = append(others, item)
+			continue
+		}
+		keyframes = append(keyframes, kf)
+	}
+	sort.SliceStable(keyframes, func(i, j int) bool { return keyframeTime(keyframes[i]) < keyframeTime(keyframes[j]) })
+	return keyframes, others
+}
+
+func setKeyframes(element map[string]interface{}, keyframes []map[string]interface{}, others []interface{}) {
+	sort.SliceStable(keyframes, func(i, j int) bool { return keyframeTime(keyframes[i]) < keyframeTime(keyframes[j]) })
+	result := make([]interface{}, 0, len(keyframes)+len(others))
+	for _, kf := range keyframes {
+		result = append(result, kf)
+	}
+	element["keyframes"] = append(result, others...)
+}
+
+func keyframeTime(kf map[string]interface{}) float64 {
+	t := models.ConvertToFloat64(kf["time"], math.NaN())
+	if math.IsInf(t, 0) {
+		return math.NaN()
+	}
+	return t
+}
+
+func hasKeyframeAt(keyframes []map[string]interface{}, t float64) bool {
+	for _, kf := range keyframes {
+		if math.Abs(keyframeTime(kf)-t) <= timeEpsilon {
+			return true
+		}
+	}
+	return false
+}
+
+// stateAt возвращает кадр с состоянием элемента в момент t: позиция,
+// прозрачность и масштаб интерполируются линейно, как в редакторе,
+// остальные поля берутся из предыдущего кадра
+func stateAt(keyframes []map[string]interface{}, t float64) map[string]interface{} {
+	i := sort.Search(len(keyframes), func(i int) bool { return keyframeTime(keyframes[i]) > t })
+	if i == 0 || i == len(keyframes) {
+		if i == len(keyframes) {
+			i--
+		}
+		state := deepCopy(keyframes[i]).(map[string]interface{})
+		state["time"] = t
+		return state
+	}
+
+	a, b := keyframes[i-1], keyframes[i]
+	ratio := (t - keyframeTime(a)) / (keyframeTime(b) - keyframeTime(a))
+	lerp := func(from, to float64) float64 { return from + (to-from)*ratio }
+	state := deepCopy(a).(map[string]interface{})
+	state["time"] = t
+	state["opacity"] = lerp(models.ConvertToFloat64(a["opacity"], 1), models.ConvertToFloat64(b["opacity"], 1))
+	state["scale"] = lerp(models.ConvertToFloat64(a["scale"], 1), models.ConvertToFloat64(b["scale"], 1))
+	posA, okA := a["position"].(map[string]interface{})
+	posB, okB := b["position"].(map[string]interface{})
+	if okA && okB {
+		state["position"] = map[string]interface{}{
+			"x": lerp(models.ConvertToFloat64(posA["x"], 0), models.ConvertToFloat64(posB["x"], 0)),
+			"y": lerp(models.ConvertToFloat64(posA["y"], 0), models.ConvertToFloat64(posB["y"], 0)),
+		}
+	}
+	return state
+}
+
+// deepCopy копирует вложенные карты и массивы, чтобы копии кадров
+// не делили данные с исходными
+func deepCopy(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		copied := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			copied[key] = deepCopy(item)
+		}
+		return copied
+	case []interface{}:
+		copied := make([]interface{}, len(v))
+		for i, item := range v {
+			copied[i] = deepCopy(item)
+		}
+		return copied
+	}
+	return value
+}
+
+// roundTime убирает ошибки округления сложения моментов
+func roundTime(t float64) float64 {
+	return math.Round(t*1e6) / 1e6
+}
@@ -0,0 +1,436 @@
+package timeline
+
+import (
+	"errors"
+	"fmt"
+	"math"
+
+	"github.com/kktjss/dance-flow/models"
+)
+
+// Виды операций преобразования
+const (
+	OpShift     = "shift"
+	OpScale     = "scale"
+	OpMirror    = "mirror"
+	OpRotate    = "rotate"
+	OpTranslate = "translate"
+)
+
+// Оси отражения: x - слева направо, y - от авансцены вглубь
+const (
+	AxisX = "x"
+	AxisY = "y"
+)
+
+// Ограничения преобразований
+const (
+	MaxTransformOperations = 20
+	MaxTimeScale           = 100.0
+)
+
+// Ошибки преобразований
+var (
+	ErrInvalidOperation = errors.New("invalid transform operation")
+	ErrUnknownElement   = errors.New("element not found")
+	ErrNothingSelected  = errors.New("no elements or keyframes match the selection")
+)
+
+// Point - точка холста в пикселях
+type Point struct {
+	X float64 `json:"x"`
+	Y float64 `json:"y"`
+}
+
+// Operation - одна операция преобразования.
+//
+// shift сдвигает время на By секунд; scale растягивает время в Factor раз
+// относительно момента Pivot (по умолчанию начало окна); mirror отражает
+// позиции относительно линии через Center по оси Axis; rotate поворачивает
+// позиции на Degrees по часовой стрелке вокруг Center; translate переносит
+// позиции на (DX, DY).
+type Operation struct {
+	Type    string   `json:"type"`
+	By      float64  `json:"by,omitempty"`
+	Factor  float64  `json:"factor,omitempty"`
+	Pivot   *float64 `json:"pivot,omitempty"`
+	Axis    string   `json:"axis,omitempty"`
+	Degrees float64  `json:"degrees,omitempty"`
+	Center  *Point   `json:"center,omitempty"`
+	DX      float64  `json:"dx,omitempty"`
+	DY      float64  `json:"dy,omitempty"`
+}
+
+// Transform - набор операций над выбранными элементами. Операции
+// применяются по порядку к ключевым кадрам с моментом в окне [From, To];
+// без окна - ко всем кадрам. Позиции - левый верхний угол элемента на
+// холсте, пространственные операции применяются к центру элемента.
+type Transform struct {
+	ElementIDs []string
+	From       *float64
+	To         *float64
+	// Ripple сдвигает кадры после To на столько, на сколько операции
+	// времени сдвинули конец окна
+	Ripple     bool
+	Operations []Operation
+}
+
+// TransformResult описывает изменения, сделанные преобразованием
+type TransformResult struct {
+	Elements  int `json:"elements"`
+	Keyframes int `json:"keyframes"`
+	Rippled   int `json:"rippled"`
+	Removed   int `json:"removed"`
+}
+
+// Validate проверяет окно и операции
+func (tr *Transform) Validate() error {
+	if tr.From != nil && (math.IsNaN(*tr.From) || math.IsInf(*tr.From, 0) || *tr.From < 0) {
+		return fmt.Errorf("%w: from must be a non-negative time", ErrInvalidOperation)
+	}
+	if tr.To != nil && (math.IsNaN(*tr.To) || math.IsInf(*tr.To, 0) || (tr.From != nil && *tr.To < *tr.From)) {
+		return fmt.Errorf("%w: to must not be before from", ErrInvalidOperation)
+	}
+	if tr.Ripple && tr.To == nil {
+		return fmt.Errorf("%w: ripple needs the end of the window", ErrInvalidOperation)
+	}
+	if len(tr.Operations) == 0 || len(tr.Operations) > MaxTransformOperations {
+		return fmt.Errorf("%w: between 1 and %d operations are required", ErrInvalidOperation, MaxTransformOperations)
+	}
+	for i := range tr.Operations {
+		if err := tr.Operations[i].validate(); err != nil {
+			return fmt.Errorf("%w: operation %d: %s", ErrInvalidOperation, i+1, err)
+		}
+	}
+	return nil
+}
+
+func (op *Operation) validate() error {
+	finite := func(values ...float64) bool {
+		for _, v := range values {
+			if math.IsNaN(v) || math.IsInf(v, 0) {
+				return false
+			}
+		}
+		return true
+	}
+	if op.Center != nil && !finite(op.Center.X, op.Center.Y) {
+		return errors.New("center must be a finite point")
+	}
+	switch op.Type {
+	case OpShift:
+		if !finite(op.By) {
+			return errors.New("by must be a number of seconds")
+		}
+	case OpScale:
+		if !finite(op.Factor) || op.Factor <= 0 || op.Factor > MaxTimeScale {
+			return fmt.Errorf("factor must be between 0 and %.0f", MaxTimeScale)
+		}
+		if op.Pivot != nil && !finite(*op.Pivot) {
+			return errors.New("pivot must be a number of seconds")
+		}
+	case OpMirror:
+		if op.Axis == "" {
+			op.Axis = AxisX
+		}
+		if op.Axis != AxisX && op.Axis != AxisY {
+			return errors.New("axis must be x or y")
+		}
+	case OpRotate:
+		if !finite(op.Degrees) {
+			return errors.New("degrees must be a number")
+		}
+	case OpTranslate:
+		if !finite(op.DX, op.DY) {
+			return errors.New("dx and dy must be numbers")
+		}
+	default:
+		return fmt.Errorf("unknown type %q", op.Type)
+	}
+	return nil
+}
+
+// spatial сообщает, что операция меняет позиции, а не время
+func (op Operation) spatial() bool {
+	return op.Type == OpMirror || op.Type == OpRotate || op.Type == OpTranslate
+}
+
+// retime возвращает момент t после операции времени
+func (op Operation) retime(t, from float64) float64 {
+	switch op.Type {
+	case OpShift:
+		return t + op.By
+	case OpScale:
+		pivot := from
+		if op.Pivot != nil {
+			pivot = *op.Pivot
+		}
+		return pivot + (t-pivot)*op.Factor
+	}
+	return t
+}
+
+// move возвращает точку p после пространственной операции
+func (op Operation) move(p, center Point) Point {
+	switch op.Type {
+	case OpMirror:
+		if op.Axis == AxisY {
+			return Point{X: p.X, Y: 2*center.Y - p.Y}
+		}
+		return Point{X: 2*center.X - p.X, Y: p.Y}
+	case OpRotate:
+		// Ось Y холста направлена вниз, поэтому положительный угол
+		// поворачивает по часовой стрелке
+		sin, cos := math.Sincos(op.Degrees * math.Pi / 180)
+		dx, dy := p.X-center.X, p.Y-center.Y
+		return Point{X: center.X + dx*cos - dy*sin, Y: center.Y + dx*sin + dy*cos}
+	case OpTranslate:
+		return Point{X: p.X + op.DX, Y: p.Y + op.DY}
+	}
+	return p
+}
+
+// transformTarget - выбранный элемент и его ключевые кадры
+type transformTarget struct {
+	element map[string]interface{}
+	frames  []map[string]interface{}
+	others  []interface{}
+}
+
+// Apply применяет преобразование к элементам. Пространственные операции
+// без Center вращают и отражают вокруг center - центра сцены или выборки.
+// Кадры, на место которых встали преобразованные кадры, удаляются. Элементы
+// без ключевых кадров при преобразовании без окна переносятся целиком. При
+// ошибке элементы не меняются.
+func Apply(elements []interface{}, tr Transform, center Point) (TransformResult, error) {
+	var result TransformResult
+	if err := tr.Validate(); err != nil {
+		return result, err
+	}
+
+	work := deepCopy(elements).([]interface{})
+	targets, err := selectTargets(work, tr)
+	if err != nil {
+		return result, err
+	}
+
+	from, to := 0.0, math.Inf(1)
+	if tr.From != nil {
+		from = *tr.From
+	}
+	if tr.To != nil {
+		to = *tr.To
+	}
+
+	for _, target := range targets {
+		keyframes := target.frames
+		if len(keyframes) == 0 {
+			if tr.From == nil && tr.To == nil && moveStaticElement(target.element, tr.Operations, center) {
+				result.Elements++
+			}
+			continue
+		}
+		moved := map[int]bool{}
+		var minTime, maxTime = math.Inf(1), math.Inf(-1)
+		for i, kf := range keyframes {
+			t := keyframeTime(kf)
+			if t < from-timeEpsilon || t > to+timeEpsilon {
+				continue
+			}
+			for _, op := range tr.Operations {
+				if op.spatial() {
+					c := center
+					if op.Center != nil {
+						c = *op.Center
+					}
+					setKeyframeCenter(target.element, kf, op.move(keyframeCenter(target.element, kf), c))
+				} else {
+					t = op.retime(t, from)
+				}
+			}
+			if t < -timeEpsilon {
+				return TransformResult{}, ErrNegativeTime
+			}
+			kf["time"] = roundTime(math.Max(t, 0))
+			moved[i] = true
+			minTime, maxTime = math.Min(minTime, t), math.Max(maxTime, t)
+			result.Keyframes++
+		}
+
+		// Кадры после окна сдвигаются вслед за его концом
+		if tr.Ripple {
+			end := to
+			for _, op := range tr.Operations {
+				end = op.retime(end, from)
+			}
+			if delta := end - to; math.Abs(delta) > timeEpsilon {
+				for i, kf := range keyframes {
+					if moved[i] || keyframeTime(kf) <= to+timeEpsilon {
+						continue
+					}
+					t := keyframeTime(kf) + delta
+					if t < -timeEpsilon {
+						return TransformResult{}, ErrNegativeTime
+					}
+					kf["time"] = roundTime(math.Max(t, 0))
+					moved[i] = true
+					minTime, maxTime = math.Min(minTime, t), math.Max(maxTime, t)
+					result.Rippled++
+				}
+			}
+		}
+
+		// Нетронутые кадры внутри нового отрезка сдвинутых кадров удаляются
+		kept := keyframes[:0:0]
+		for i, kf := range keyframes {
+			if !moved[i] {
+				t := keyframeTime(kf)
+				if t >= minTime-timeEpsilon && t <= maxTime+timeEpsilon {
+					result.Removed++
+					continue
+				}
+			}
+			kept = append(kept, kf)
+		}
+		if len(moved) > 0 {
+			result.Elements++
+		}
+		setKeyframes(target.element, kept, target.others)
+		syncElementPosition(target.element, kept)
+	}
+	if result.Elements == 0 {
+		return TransformResult{}, ErrNothingSelected
+	}
+	// Результат переносится в исходные карты, чтобы ссылки на элементы остались верны
+	for i, raw := range elements {
+		element, ok := raw.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		for key := range element {
+			delete(element, key)
+		}
+		for key, value := range work[i].(map[string]interface{}) {
+			element[key] = value
+		}
+	}
+	return result, nil
+}
+
+// selectTargets находит элементы из ElementIDs (все элементы, если список пуст)
+func selectTargets(elements []interface{}, tr Transform) ([]transformTarget, error) {
+	wanted := map[string]bool{}
+	for _, id := range tr.ElementIDs {
+		wanted[id] = true
+	}
+	found := map[string]bool{}
+	targets := []transformTarget{}
+	for _, raw := range elements {
+		element, ok := raw.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		id, _ := element["id"].(string)
+		if len(wanted) > 0 && !wanted[id] {
+			continue
+		}
+		found[id] = true
+		keyframes, others := splitKeyframes(element)
+		targets = append(targets, transformTarget{element: element, frames: keyframes, others: others})
+	}
+	for _, id := range tr.ElementIDs {
+		if !found[id] {
+			return nil, fmt.Errorf("%w: %s", ErrUnknownElement, id)
+		}
+	}
+	return targets, nil
+}
+
+// SelectionCenter возвращает центр прямоугольника, охватывающего центры
+// выбранных элементов в кадрах окна преобразования (для элементов без
+// кадров - в их позиции)
+func SelectionCenter(elements []interface{}, tr Transform) (Point, bool) {
+	targets, err := selectTargets(elements, tr)
+	if err != nil {
+		return Point{}, false
+	}
+	minX, minY := math.Inf(1), math.Inf(1)
+	maxX, maxY := math.Inf(-1), math.Inf(-1)
+	for _, target := range targets {
+		frames := target.frames
+		if len(frames) == 0 && tr.From == nil && tr.To == nil {
+			if _, ok := target.element["position"].(map[string]interface{}); ok {
+				frames = []map[string]interface{}{{"position": target.element["position"]}}
+			}
+		}
+		for _, kf := range frames {
+			t := keyframeTime(kf)
+			if (tr.From != nil && t < *tr.From-timeEpsilon) || (tr.To != nil && t > *tr.To+timeEpsilon) {
+				continue
+			}
+			p := keyframeCenter(target.element, kf)
+			minX, maxX = math.Min(minX, p.X), math.Max(maxX, p.X)
+			minY, maxY = math.Min(minY, p.Y), math.Max(maxY, p.Y)
+		}
+	}
+	if math.IsInf(minX, 0) {
+		return Point{}, false
+	}
+	return Point{X: (minX + maxX) / 2, Y: (minY + maxY) / 2}, true
+}
+
+// moveStaticElement применяет пространственные операции к позиции элемента
+// без ключевых кадров
+func moveStaticElement(element map[string]interface{}, operations []Operation, center Point) bool {
+	if _, ok := element["position"].(map[string]interface{}); !ok {
+		return false
+	}
+	state := map[string]interface{}{"position": element["position"]}
+	moved := false
+	for _, op := range operations {
+		if !op.spatial() {
+			continue
+		}
+		c := center
+		if op.Center != nil {
+			c = *op.Center
+		}
+		setKeyframeCenter(element, state, op.move(keyframeCenter(element, state), c))
+		moved = true
+	}
+	element["position"] = state["position"]
+	return moved
+}
+
+// keyframeCenter возвращает центр элемента в кадре с учётом масштаба кадра
+func keyframeCenter(element, kf map[string]interface{}) Point {
+	position, _ := kf["position"].(map[string]interface{})
+	width, height := elementHalfSize(element, kf)
+	return Point{
+		X: models.ConvertToFloat64(position["x"], 0) + width,
+		Y: models.ConvertToFloat64(position["y"], 0) + height,
+	}
+}
+
+func setKeyframeCenter(element, kf map[string]interface{}, center Point) {
+	width, height := elementHalfSize(element, kf)
+	kf["position"] = map[string]interface{}{"x": center.X - width, "y": center.Y - height}
+}
+
+func elementHalfSize(element, kf map[string]interface{}) (float64, float64) {
+	size, _ := element["size"].(map[string]interface{})
+	scale := models.ConvertToFloat64(kf["scale"], 1)
+	return models.ConvertToFloat64(size["width"], 0) * scale / 2,
+		models.ConvertToFloat64(size["height"], 0) * scale / 2
+}
+
+// syncElementPosition ставит элемент в позицию его первого ключевого кадра,
+// как это делает редактор
+func syncElementPosition(element map[string]interface{}, keyframes []map[string]interface{}) {
+	if len(keyframes) == 0 {
+		return
+	}
+	if position, ok := keyframes[0]["position"].(map[string]interface{}); ok {
+		element["position"] = map[string]interface{}{"x": position["x"], "y": position["y"]}
+	}
+}
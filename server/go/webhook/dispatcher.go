@@ -0,0 +1,372 @@
+// Package webhook доставляет события команд и проектов во внешние сервисы.
+// Каждая доставка хранится в базе: неудачные попытки повторяются с
+// экспоненциальной задержкой, в том числе после перезапуска сервера.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kktjss/dance-flow/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Параметры повторов
+const (
+	// MaxAttempts - число попыток доставки, после которого она считается неудачной
+	MaxAttempts  = 6
+	baseBackoff  = 30 * time.Second
+	maxBackoff   = 2 * time.Hour
+	claimLease   = 2 * time.Minute
+	pollInterval = 15 * time.Second
+	pollBatch    = 100
+	// Сколько байт ответа сохраняется в журнале доставок
+	maxResponseBody = 1024
+)
+
+// ErrPrivateAddress возвращается при попытке доставки на адрес локальной сети
+var ErrPrivateAddress = errors.New("webhook URL resolves to a private or loopback address")
+
+// Event - событие, отправляемое вебхукам. TeamID и UserID определяют
+// получателей: вебхуки команды и вебхуки пользователя.
+type Event struct {
+	ID        string              `json:"id"`
+	Type      string              `json:"type"`
+	CreatedAt time.Time           `json:"createdAt"`
+	TeamID    *primitive.ObjectID `json:"teamId,omitempty"`
+	ProjectID *primitive.ObjectID `json:"projectId,omitempty"`
+	ActorID   *primitive.ObjectID `json:"actorId,omitempty"`
+	Data      interface{}         `json:"data"`
+	UserID    primitive.ObjectID  `json:"-"`
+}
+
+// NewEvent создаёт событие с новым ID
+func NewEvent(eventType string, data interface{}) Event {
+	return Event{ID: uuid.New().String(), Type: eventType, CreatedAt: time.Now().UTC(), Data: data}
+}
+
+// Backoff возвращает задержку перед попыткой attempt+1 после attempt
+// неудачных: 30 с, 1 мин, 2 мин и так далее, но не больше 2 ч
+func Backoff(attempt int) time.Duration {
+	if attempt < 1 {
+		attempt = 1
+	}
+	delay := baseBackoff
+	for i := 1; i < attempt && delay < maxBackoff; i++ {
+		delay *= 2
+	}
+	if delay > maxBackoff {
+		delay = maxBackoff
+	}
+	return delay
+}
+
+// NewClient создаёт HTTP клиент доставки. Перенаправления не выполняются,
+// а без allowPrivate запрещены соединения с адресами локальной сети, чтобы
+// вебхук нельзя было направить на внутренние сервисы.
+func NewClient(timeout time.Duration, allowPrivate bool) *http.Client {
+	dialer := &net.Dialer{Timeout: timeout}
+	if !allowPrivate {
+		dialer.Control = func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); ip == nil || !isPublicIP(ip) {
+				return ErrPrivateAddress
+			}
+			return nil
+		}
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = dialer.DialContext
+	transport.Proxy = nil
+	return &http.Client{
+		Timeout:   timeout,
+		Transport: transport,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+func isPublicIP(ip net.IP) bool {
+	return !(ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() || ip.IsLinkLocalUnicast() ||
+		ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() || ip.IsMulticast())
+}
+
+// Dispatcher создаёт доставки событий и выполняет их в пуле воркеров
+type Dispatcher struct {
+	store  Store
+	client *http.Client
+	// Now возвращает текущее время; подменяется в тестах
+	Now func() time.Time
+
+	queue chan primitive.ObjectID
+	ctx   context.Context
+	stop  context.CancelFunc
+	wg    sync.WaitGroup
+}
+
+// NewDispatcher создаёт диспетчер и запускает workers воркеров. Отложенные
+// доставки выполняются после StartPolling.
+func NewDispatcher(store Store, client *http.Client, workers int) *Dispatcher {
+	if workers < 1 {
+		workers = 1
+	}
+	ctx, stop := context.WithCancel(context.Background())
+	d := &Dispatcher{
+		store:  store,
+		client: client,
+		Now:    time.Now,
+		queue:  make(chan primitive.ObjectID, 256),
+		ctx:    ctx,
+		stop:   stop,
+	}
+	for i := 0; i < workers; i++ {
+		d.wg.Add(1)
+		go d.worker()
+	}
+	return d
+}
+
+// StartPolling запускает опрос доставок, срок повтора которых наступил,
+// включая прерванные перезапуском сервера
+func (d *Dispatcher) StartPolling() {
+	d.wg.Add(1)
+	go d.poll()
+}
+
+// Stop останавливает воркеров. Незавершённые доставки продолжатся после
+// перезапуска.
+func (d *Dispatcher) Stop() {
+	d.stop()
+	d.wg.Wait()
+}
+
+// Publish создаёт доставки события всем подписанным вебхукам и ставит их в
+// очередь. Возвращает число доставок.
+func (d *Dispatcher) Publish(ctx context.Context, event Event) (int, error) {
+	var teamID primitive.ObjectID
+	if event.TeamID != nil {
+		teamID = *event.TeamID
+	}
+	hooks, err := d.store.Subscribers(ctx, teamID, event.UserID, event.Type)
+	if err != nil {
+		return 0, err
+	}
+	created := 0
+	for i := range hooks {
+		delivery, err := d.newDelivery(ctx, &hooks[i], event, d.Now())
+		if err != nil {
+			return created, err
+		}
+		d.enqueue(delivery.ID)
+		created++
+	}
+	return created, nil
+}
+
+// Send сразу выполняет одну попытку доставки события вебхуку и возвращает
+// доставку с её результатом. Используется для тестового события, которое
+// не повторяется.
+func (d *Dispatcher) Send(ctx context.Context, hook *models.Webhook, event Event) (*models.WebhookDelivery, error) {
+	// Срок попытки отодвинут, чтобы доставку не забрал опрос
+	delivery, err := d.newDelivery(ctx, hook, event, d.Now().Add(claimLease))
+	if err != nil {
+		return nil, err
+	}
+	d.attempt(ctx, hook, delivery, 1)
+	if err := d.store.UpdateDelivery(ctx, delivery); err != nil {
+		return nil, err
+	}
+	return delivery, nil
+}
+
+// Redeliver снова ставит доставку в очередь с новым набором попыток
+func (d *Dispatcher) Redeliver(ctx context.Context, delivery *models.WebhookDelivery) error {
+	now := d.Now()
+	delivery.Status = models.DeliveryPending
+	delivery.NextAttemptAt = &now
+	delivery.Attempts = []models.WebhookAttempt{}
+	delivery.UpdatedAt = now
+	if err := d.store.UpdateDelivery(ctx, delivery); err != nil {
+		return err
+	}
+	d.enqueue(delivery.ID)
+	return nil
+}
+
+func (d *Dispatcher) newDelivery(ctx context.Context, hook *models.Webhook, event Event, next time.Time) (*models.WebhookDelivery, error) {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return nil, err
+	}
+	now := d.Now()
+	delivery := &models.WebhookDelivery{
+		WebhookID:     hook.ID,
+		EventID:       event.ID,
+		Event:         event.Type,
+		Payload:       string(payload),
+		Status:        models.DeliveryPending,
+		Attempts:      []models.WebhookAttempt{},
+		NextAttemptAt: &next,
+		CreatedAt:     now,
+		UpdatedAt:     now,
+	}
+	if err := d.store.CreateDelivery(ctx, delivery); err != nil {
+		return nil, err
+	}
+	return delivery, nil
+}
+
+func (d *Dispatcher) enqueue(id primitive.ObjectID) {
+	select {
+	case d.queue <- id:
+	default:
+		// Очередь заполнена: доставку подберёт опрос
+	}
+}
+
+func (d *Dispatcher) worker() {
+	defer d.wg.Done()
+	for {
+		select {
+		case <-d.ctx.Done():
+			return
+		case id := <-d.queue:
+			d.process(id)
+		}
+	}
+}
+
+// poll периодически ставит в очередь доставки, срок повтора которых наступил
+func (d *Dispatcher) poll() {
+	defer d.wg.Done()
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+	for {
+		ids, err := d.store.Due(d.ctx, d.Now(), pollBatch)
+		if err != nil && d.ctx.Err() == nil {
+			log.Printf("[WEBHOOK] Failed to find due deliveries: %v", err)
+		}
+		for _, id := range ids {
+			select {
+			case d.queue <- id:
+			case <-d.ctx.Done():
+				return
+			}
+		}
+		select {
+		case <-d.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// process выполняет очередную попытку доставки, если её ещё никто не забрал
+func (d *Dispatcher) process(id primitive.ObjectID) {
+	now := d.Now()
+	delivery, err := d.store.Claim(d.ctx, id, now, now.Add(claimLease))
+	if err != nil || delivery == nil {
+		return
+	}
+
+	hook, err := d.store.Webhook(d.ctx, delivery.WebhookID)
+	switch {
+	case err == ErrWebhookNotFound:
+		d.abandon(delivery, "webhook was deleted")
+		return
+	case err != nil:
+		// Попытка не выполнялась: доставка повторится после аренды
+		return
+	case !hook.Active:
+		d.abandon(delivery, "webhook is disabled")
+		return
+	}
+
+	d.attempt(d.ctx, hook, delivery, MaxAttempts)
+	if err := d.store.UpdateDelivery(d.ctx, delivery); err != nil {
+		log.Printf("[WEBHOOK] Failed to save delivery %s: %v", delivery.ID.Hex(), err)
+	}
+}
+
+// attempt отправляет запрос и записывает попытку. После maxAttempts
+// неудачных попыток доставка считается неудачной, иначе назначается повтор.
+func (d *Dispatcher) attempt(ctx context.Context, hook *models.Webhook, delivery *models.WebhookDelivery, maxAttempts int) {
+	started := d.Now()
+	record := models.WebhookAttempt{At: started}
+	statusCode, body, err := d.post(ctx, hook, delivery, started)
+	record.DurationMs = d.Now().Sub(started).Milliseconds()
+	record.StatusCode = statusCode
+	record.ResponseBody = body
+	if err == nil && (statusCode < 200 || statusCode > 299) {
+		err = fmt.Errorf("unexpected response status %d", statusCode)
+	}
+	if err != nil {
+		record.Error = err.Error()
+	}
+
+	delivery.Attempts = append(delivery.Attempts, record)
+	delivery.UpdatedAt = d.Now()
+	switch {
+	case err == nil:
+		delivery.Status = models.DeliverySucceeded
+		delivery.NextAttemptAt = nil
+	case len(delivery.Attempts) >= maxAttempts:
+		delivery.Status = models.DeliveryFailed
+		delivery.NextAttemptAt = nil
+	default:
+		next := started.Add(Backoff(len(delivery.Attempts)))
+		delivery.NextAttemptAt = &next
+	}
+}
+
+// post отправляет подписанное тело доставки
+func (d *Dispatcher) post(ctx context.Context, hook *models.Webhook, delivery *models.WebhookDelivery, at time.Time) (int, string, error) {
+	body := []byte(delivery.Payload)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, hook.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, "", err
+	}
+	timestamp := at.Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "DanceFlow-Webhooks/1.0")
+	req.Header.Set(HeaderEvent, delivery.Event)
+	req.Header.Set(HeaderDelivery, delivery.ID.Hex())
+	req.Header.Set(HeaderTimestamp, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(HeaderSignature, Sign(hook.Secret, timestamp, body))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, "", err
+	}
+	defer resp.Body.Close()
+	response, _ := io.ReadAll(io.LimitReader(resp.Body, maxResponseBody))
+	return resp.StatusCode, string(bytes.ToValidUTF8(response, nil)), nil
+}
+
+// abandon завершает доставку без попытки
+func (d *Dispatcher) abandon(delivery *models.WebhookDelivery, reason string) {
+	now := d.Now()
+	delivery.Status = models.DeliveryFailed
+	delivery.NextAttemptAt = nil
+	delivery.UpdatedAt = now
+	delivery.Attempts = append(delivery.Attempts, models.WebhookAttempt{At: now, Error: reason})
+	if err := d.store.UpdateDelivery(d.ctx, delivery); err != nil {
+		log.Printf("[WEBHOOK] Failed to save delivery %s: %v", delivery.ID.Hex(), err)
+	}
+}
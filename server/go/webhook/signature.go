@@ -0,0 +1,32 @@
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"strconv"
+)
+
+// Заголовки запроса вебхука
+const (
+	HeaderEvent     = "X-DanceFlow-Event"
+	HeaderDelivery  = "X-DanceFlow-Delivery"
+	HeaderTimestamp = "X-DanceFlow-Timestamp"
+	HeaderSignature = "X-DanceFlow-Signature"
+)
+
+// Sign возвращает подпись тела запроса: "sha256=" и HMAC-SHA256 строки
+// "<timestamp>.<body>" с секретом вебхука. Время в подписи не даёт
+// повторно отправить перехваченный запрос.
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify проверяет подпись так, как это должен делать получатель
+func Verify(secret, signature string, timestamp int64, body []byte) bool {
+	return hmac.Equal([]byte(signature), []byte(Sign(secret, timestamp, body)))
+}
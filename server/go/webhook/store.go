@@ -0,0 +1,134 @@
+package webhook
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/kktjss/dance-flow/config"
+	"github.com/kktjss/dance-flow/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Ошибки хранилища
+var (
+	ErrWebhookNotFound  = errors.New("webhook not found")
+	ErrDeliveryNotFound = errors.New("webhook delivery not found")
+)
+
+// Store хранит вебхуки и их доставки
+type Store interface {
+	// Subscribers возвращает активные вебхуки команды teamID и пользователя
+	// userID, подписанные на событие. Нулевой ID пропускается.
+	Subscribers(ctx context.Context, teamID, userID primitive.ObjectID, event string) ([]models.Webhook, error)
+	Webhook(ctx context.Context, id primitive.ObjectID) (*models.Webhook, error)
+	CreateDelivery(ctx context.Context, delivery *models.WebhookDelivery) error
+	UpdateDelivery(ctx context.Context, delivery *models.WebhookDelivery) error
+	// Claim забирает ожидающую доставку, срок попытки которой наступил,
+	// откладывая следующую попытку до until. Возвращает nil, если доставку
+	// уже забрали или она не ожидает.
+	Claim(ctx context.Context, id primitive.ObjectID, now, until time.Time) (*models.WebhookDelivery, error)
+	// Due возвращает ожидающие доставки, срок попытки которых наступил
+	Due(ctx context.Context, now time.Time, limit int) ([]primitive.ObjectID, error)
+}
+
+// MongoStore хранит вебхуки в коллекциях webhooks и webhookDeliveries
+type MongoStore struct{}
+
+// Subscribers возвращает активные вебхуки, подписанные на событие
+func (MongoStore) Subscribers(ctx context.Context, teamID, userID primitive.ObjectID, event string) ([]models.Webhook, error) {
+	owners := []bson.M{}
+	if !teamID.IsZero() {
+		owners = append(owners, bson.M{"teamId": teamID})
+	}
+	if !userID.IsZero() {
+		owners = append(owners, bson.M{"userId": userID})
+	}
+	if len(owners) == 0 {
+		return nil, nil
+	}
+	cursor, err := config.WebhooksCollection.Find(ctx, bson.M{"$or": owners, "active": true, "events": event})
+	if err != nil {
+		return nil, err
+	}
+	var hooks []models.Webhook
+	if err := cursor.All(ctx, &hooks); err != nil {
+		return nil, err
+	}
+	return hooks, nil
+}
+
+// Webhook загружает вебхук по ID
+func (MongoStore) Webhook(ctx context.Context, id primitive.ObjectID) (*models.Webhook, error) {
+	var hook models.Webhook
+	err := config.WebhooksCollection.FindOne(ctx, bson.M{"_id": id}).Decode(&hook)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrWebhookNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &hook, nil
+}
+
+// CreateDelivery сохраняет новую доставку
+func (MongoStore) CreateDelivery(ctx context.Context, delivery *models.WebhookDelivery) error {
+	if delivery.ID.IsZero() {
+		delivery.ID = primitive.NewObjectID()
+	}
+	_, err := config.WebhookDeliveriesCollection.InsertOne(ctx, delivery)
+	return err
+}
+
+// UpdateDelivery сохраняет доставку целиком
+func (MongoStore) UpdateDelivery(ctx context.Context, delivery *models.WebhookDelivery) error {
+	result, err := config.WebhookDeliveriesCollection.ReplaceOne(ctx, bson.M{"_id": delivery.ID}, delivery)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrDeliveryNotFound
+	}
+	return nil
+}
+
+// Claim забирает доставку одним атомарным запросом
+func (MongoStore) Claim(ctx context.Context, id primitive.ObjectID, now, until time.Time) (*models.WebhookDelivery, error) {
+	var delivery models.WebhookDelivery
+	err := config.WebhookDeliveriesCollection.FindOneAndUpdate(ctx,
+		bson.M{"_id": id, "status": models.DeliveryPending, "nextAttemptAt": bson.M{"$lte": now}},
+		bson.M{"$set": bson.M{"nextAttemptAt": until}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&delivery)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &delivery, nil
+}
+
+// Due возвращает ожидающие доставки по сроку попытки
+func (MongoStore) Due(ctx context.Context, now time.Time, limit int) ([]primitive.ObjectID, error) {
+	cursor, err := config.WebhookDeliveriesCollection.Find(ctx,
+		bson.M{"status": models.DeliveryPending, "nextAttemptAt": bson.M{"$lte": now}},
+		options.Find().
+			SetSort(bson.M{"nextAttemptAt": 1}).
+			SetLimit(int64(limit)).
+			SetProjection(bson.M{"_id": 1}))
+	if err != nil {
+		return nil, err
+	}
+	var deliveries []models.WebhookDelivery
+	if err := cursor.All(ctx, &deliveries); err != nil {
+		return nil, err
+	}
+	ids := make([]primitive.ObjectID, len(deliveries))
+	for i := range deliveries {
+		ids[i] = deliveries[i].ID
+	}
+	return ids, nil
+}
@@ -0,0 +1,139 @@
+// Package webhooktest содержит хранилище вебхуков в памяти для тестов
+package webhooktest
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/kktjss/dance-flow/models"
+	"github.com/kktjss/dance-flow/webhook"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// MemoryStore хранит вебхуки в памяти и реализует webhook.Store
+type MemoryStore struct {
+	mu         sync.Mutex
+	webhooks   map[primitive.ObjectID]models.Webhook
+	deliveries map[primitive.ObjectID]models.WebhookDelivery
+}
+
+// NewMemoryStore создаёт пустое хранилище в памяти
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		webhooks:   map[primitive.ObjectID]models.Webhook{},
+		deliveries: map[primitive.ObjectID]models.WebhookDelivery{},
+	}
+}
+
+// AddWebhook сохраняет вебхук
+func (s *MemoryStore) AddWebhook(hook models.Webhook) models.Webhook {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if hook.ID.IsZero() {
+		hook.ID = primitive.NewObjectID()
+	}
+	s.webhooks[hook.ID] = hook
+	return hook
+}
+
+// Deliveries возвращает доставки вебхука в порядке создания
+func (s *MemoryStore) Deliveries(webhookID primitive.ObjectID) []models.WebhookDelivery {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	result := []models.WebhookDelivery{}
+	for _, delivery := range s.deliveries {
+		if delivery.WebhookID == webhookID {
+			result = append(result, delivery)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].CreatedAt.Before(result[j].CreatedAt) })
+	return result
+}
+
+// Subscribers возвращает активные вебхуки, подписанные на событие
+func (s *MemoryStore) Subscribers(ctx context.Context, teamID, userID primitive.ObjectID, event string) ([]models.Webhook, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var hooks []models.Webhook
+	for _, hook := range s.webhooks {
+		owned := (!teamID.IsZero() && hook.TeamID == teamID) || (!userID.IsZero() && hook.UserID == userID)
+		if owned && hook.Active && hook.Subscribed(event) {
+			hooks = append(hooks, hook)
+		}
+	}
+	return hooks, nil
+}
+
+// Webhook загружает вебхук по ID
+func (s *MemoryStore) Webhook(ctx context.Context, id primitive.ObjectID) (*models.Webhook, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	hook, ok := s.webhooks[id]
+	if !ok {
+		return nil, webhook.ErrWebhookNotFound
+	}
+	return &hook, nil
+}
+
+// CreateDelivery сохраняет новую доставку
+func (s *MemoryStore) CreateDelivery(ctx context.Context, delivery *models.WebhookDelivery) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if delivery.ID.IsZero() {
+		delivery.ID = primitive.NewObjectID()
+	}
+	s.deliveries[delivery.ID] = copyDelivery(*delivery)
+	return nil
+}
+
+// UpdateDelivery сохраняет доставку целиком
+func (s *MemoryStore) UpdateDelivery(ctx context.Context, delivery *models.WebhookDelivery) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.deliveries[delivery.ID]; !ok {
+		return webhook.ErrDeliveryNotFound
+	}
+	s.deliveries[delivery.ID] = copyDelivery(*delivery)
+	return nil
+}
+
+// Claim забирает ожидающую доставку, срок попытки которой наступил
+func (s *MemoryStore) Claim(ctx context.Context, id primitive.ObjectID, now, until time.Time) (*models.WebhookDelivery, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delivery, ok := s.deliveries[id]
+	if !ok || delivery.Status != models.DeliveryPending || delivery.NextAttemptAt == nil || delivery.NextAttemptAt.After(now) {
+		return nil, nil
+	}
+	delivery.NextAttemptAt = &until
+	s.deliveries[id] = delivery
+	claimed := copyDelivery(delivery)
+	return &claimed, nil
+}
+
+// Due возвращает ожидающие доставки, срок попытки которых наступил
+func (s *MemoryStore) Due(ctx context.Context, now time.Time, limit int) ([]primitive.ObjectID, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var ids []primitive.ObjectID
+	for id, delivery := range s.deliveries {
+		if len(ids) >= limit {
+			break
+		}
+		if delivery.Status == models.DeliveryPending && delivery.NextAttemptAt != nil && !delivery.NextAttemptAt.After(now) {
+			ids = append(ids, id)
+		}
+	}
+	return ids, nil
+}
+
+func copyDelivery(delivery models.WebhookDelivery) models.WebhookDelivery {
+	delivery.Attempts = append([]models.WebhookAttempt(nil), delivery.Attempts...)
+	if delivery.NextAttemptAt != nil {
+		next := *delivery.NextAttemptAt
+		delivery.NextAttemptAt = &next
+	}
+	return delivery
+}
@@ -0,0 +1,274 @@
+package unit
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kktjss/dance-flow/analyzer"
+	"github.com/kktjss/dance-flow/jobs"
+	"github.com/kktjss/dance-flow/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// fakeFrameSource выдаёт синтетические кадры вместо декодирования видео
+type fakeFrameSource struct {
+	duration float64
+}
+
+func (s fakeFrameSource) Duration(ctx context.Context, path string) (float64, error) {
+	return s.duration, nil
+}
+
+func (s fakeFrameSource) Extract(ctx context.Context, path string, sampleRate float64, emit func(jobs.Frame) error) error {
+	count := int(s.duration * sampleRate)
+	for i := 0; i < count; i++ {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		image := []byte(fmt.Sprintf("frame-%d", i))
+		if err := emit(jobs.Frame{Time: float64(i) / sampleRate, Image: image}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// newTestRunner создает исполнителя задач с хранилищем и приёмником в памяти
+func newTestRunner(t *testing.T, a analyzer.Analyzer, duration float64) (*jobs.Runner, *jobs.MemoryStore, *jobs.MemorySink) {
+	store := jobs.NewMemoryStore()
+	sink := jobs.NewMemorySink()
+	runner := jobs.NewRunner(store, a, fakeFrameSource{duration: duration}, sink, 2)
+	runner.BatchSize = 5
+	t.Cleanup(runner.Stop)
+	return runner, store, sink
+}
+
+// waitForStatus ожидает, пока задача перейдёт в указанный статус
+func waitForStatus(t *testing.T, store *jobs.MemoryStore, id primitive.ObjectID, status string) *models.AnalysisJob {
+	var job *models.AnalysisJob
+	require.Eventually(t, func() bool {
+		var err error
+		job, err = store.Get(context.Background(), id)
+		return err == nil && job.Status == status
+	}, 5*time.Second, 10*time.Millisecond, "Задача должна перейти в статус %s", status)
+	return job
+}
+
+// TestAnalysisJob_Completes проверяет полный цикл задачи с фейковым анализатором
+func TestAnalysisJob_Completes(t *testing.T) {
+	runner, store, sink := newTestRunner(t, &analyzer.Fake{Persons: 2}, 4)
+
+	job := &models.AnalysisJob{ProjectID: primitive.NewObjectID(), SampleRate: 5, PersonIndex: 1}
+	require.NoError(t, runner.Submit(context.Background(), job))
+
+	done := waitForStatus(t, store, job.ID, models.JobStatusCompleted)
+	assert.Equal(t, 100.0, done.Progress)
+	assert.Equal(t, 20, done.FramesTotal)
+	assert.Equal(t, 20, done.FramesProcessed)
+	assert.Equal(t, 20, done.PosesDetected)
+	assert.Equal(t, 1, done.Attempts)
+	require.False(t, done.TrackID.IsZero())
+
+	frames := sink.Frames(done.TrackID)
+	require.Len(t, frames, 20)
+	assert.InDelta(t, 0.2, frames[1].Time, 1e-9)
+	assert.Len(t, frames[0].Joints, 33)
+	assert.Greater(t, frames[0].Joints[0].X, 0.5, "Должна сохраняться поза второго танцора")
+}
+
+// TestAnalysisJob_PersonNotDetected проверяет задачу, где нужного танцора нет в кадре
+func TestAnalysisJob_PersonNotDetected(t *testing.T) {
+	runner, store, sink := newTestRunner(t, &analyzer.Fake{Persons: 1}, 1)
+
+	job := &models.AnalysisJob{ProjectID: primitive.NewObjectID(), SampleRate: 10, PersonIndex: 3}
+	require.NoError(t, runner.Submit(context.Background(), job))
+
+	done := waitForStatus(t, store, job.ID, models.JobStatusCompleted)
+	assert.Equal(t, 10, done.FramesProcessed)
+	assert.Zero(t, done.PosesDetected)
+	assert.Empty(t, sink.Frames(done.TrackID))
+}
+
+// TestAnalysisJob_FailAndRetry проверяет сохранение ошибки и повторный запуск
+func TestAnalysisJob_FailAndRetry(t *testing.T) {
+	fake := &analyzer.Fake{FailOn: func(call int) error {
+		if call == 7 {
+			return errors.New("analyzer unavailable")
+		}
+		return nil
+	}}
+	runner, store, sink := newTestRunner(t, fake, 2)
+
+	job := &models.AnalysisJob{ProjectID: primitive.NewObjectID(), SampleRate: 5}
+	require.NoError(t, runner.Submit(context.Background(), job))
+
+	failed := waitForStatus(t, store, job.ID, models.JobStatusFailed)
+	assert.Contains(t, failed.Error, "analyzer unavailable")
+	assert.Less(t, failed.Progress, 100.0)
+	assert.Len(t, sink.Frames(failed.TrackID), 5, "Сохраняются кадры из завершённых пакетов")
+
+	_, err := runner.Retry(context.Background(), primitive.NewObjectID())
+	assert.ErrorIs(t, err, jobs.ErrJobNotFound)
+
+	retried, err := runner.Retry(context.Background(), job.ID)
+	require.NoError(t, err)
+	assert.Empty(t, retried.Error)
+
+	done := waitForStatus(t, store, job.ID, models.JobStatusCompleted)
+	assert.Equal(t, 2, done.Attempts)
+	assert.Equal(t, failed.TrackID, done.TrackID, "Повтор пишет в тот же трек")
+	assert.Len(t, sink.Frames(done.TrackID), 10)
+
+	_, err = runner.Retry(context.Background(), job.ID)
+	assert.ErrorIs(t, err, jobs.ErrJobNotRetryable)
+}
+
+// TestAnalysisJob_Cancel проверяет отмену выполняющейся задачи
+func TestAnalysisJob_Cancel(t *testing.T) {
+	runner, store, _ := newTestRunner(t, &analyzer.Fake{Delay: 20 * time.Millisecond}, 60)
+
+	job := &models.AnalysisJob{ProjectID: primitive.NewObjectID(), SampleRate: 5}
+	require.NoError(t, runner.Submit(context.Background(), job))
+	waitForStatus(t, store, job.ID, models.JobStatusRunning)
+
+	_, err := runner.Cancel(context.Background(), job.ID)
+	require.NoError(t, err)
+
+	cancelled := waitForStatus(t, store, job.ID, models.JobStatusCancelled)
+	assert.NotNil(t, cancelled.FinishedAt)
+	assert.Less(t, cancelled.FramesProcessed, cancelled.FramesTotal)
+
+	_, err = runner.Cancel(context.Background(), job.ID)
+	assert.ErrorIs(t, err, jobs.ErrJobFinished)
+}
+
+// TestSplitJPEGStream проверяет разбиение потока ffmpeg на кадры
+func TestSplitJPEGStream(t *testing.T) {
+	first := []byte{0xFF, 0xD8, 0x01, 0x02, 0xFF, 0xD9}
+	second := []byte{0xFF, 0xD8, 0x03, 0xFF, 0x00, 0xFF, 0xD9}
+	stream := append(append([]byte{0x00}, first...), second...)
+
+	var frames [][]byte
+	err := jobs.SplitJPEGStream(bytes.NewReader(stream), func(image []byte) error {
+		frames = append(frames, image)
+		return nil
+	})
+	require.NoError(t, err)
+	require.Len(t, frames, 2)
+	assert.Equal(t, first, frames[0])
+	assert.Equal(t, second, frames[1])
+
+	err = jobs.SplitJPEGStream(bytes.NewReader(first[:4]), func([]byte) error { return nil })
+	assert.Error(t, err, "Обрезанный кадр должен вызывать ошибку")
+}
+
+// blockingFrameSource выдаёт один кадр и ждёт release, не реагируя на отмену,
+// как ffmpeg, который дочитывает уже запущенный вывод
+type blockingFrameSource struct {
+	release chan struct{}
+}
+
+func (s blockingFrameSource) Duration(ctx context.Context, path string) (float64, error) {
+	return 1, nil
+}
+
+func (s blockingFrameSource) Extract(ctx context.Context, path string, sampleRate float64, emit func(jobs.Frame) error) error {
+	if err := emit(jobs.Frame{Image: []byte("frame")}); err != nil {
+		return err
+	}
+	<-s.release
+	return nil
+}
+
+// TestAnalysisJob_CancelBeforeFinish проверяет, что воркер, дошедший до конца
+// после отмены, не перезаписывает статус задачи
+func TestAnalysisJob_CancelBeforeFinish(t *testing.T) {
+	store := jobs.NewMemoryStore()
+	source := blockingFrameSource{release: make(chan struct{})}
+	runner := jobs.NewRunner(store, &analyzer.Fake{}, source, jobs.NewMemorySink(), 1)
+	t.Cleanup(runner.Stop)
+	var finished []string
+	runner.OnFinish = func(job *models.AnalysisJob) { finished = append(finished, job.Status) }
+
+	job := &models.AnalysisJob{ProjectID: primitive.NewObjectID(), SampleRate: 1}
+	require.NoError(t, runner.Submit(context.Background(), job))
+	waitForStatus(t, store, job.ID, models.JobStatusRunning)
+
+	cancelled, err := runner.Cancel(context.Background(), job.ID)
+	require.NoError(t, err)
+	assert.Equal(t, models.JobStatusCancelled, cancelled.Status)
+	stored, err := store.Get(context.Background(), job.ID)
+	require.NoError(t, err)
+	assert.Equal(t, models.JobStatusCancelled, stored.Status, "Отмена сохраняется сразу")
+
+	close(source.release)
+	runner.Stop()
+
+	stored, err = store.Get(context.Background(), job.ID)
+	require.NoError(t, err)
+	assert.Equal(t, models.JobStatusCancelled, stored.Status)
+	assert.Equal(t, []string{models.JobStatusCancelled}, finished)
+}
+
+// TestAnalysisJob_StopRequeues проверяет возврат выполняющейся задачи в очередь при остановке
+func TestAnalysisJob_StopRequeues(t *testing.T) {
+	store := jobs.NewMemoryStore()
+	runner := jobs.NewRunner(store, &analyzer.Fake{Delay: 20 * time.Millisecond}, fakeFrameSource{duration: 60}, jobs.NewMemorySink(), 1)
+
+	job := &models.AnalysisJob{ProjectID: primitive.NewObjectID(), SampleRate: 5}
+	require.NoError(t, runner.Submit(context.Background(), job))
+	waitForStatus(t, store, job.ID, models.JobStatusRunning)
+	runner.Stop()
+
+	stored, err := store.Get(context.Background(), job.ID)
+	require.NoError(t, err)
+	assert.Equal(t, models.JobStatusQueued, stored.Status)
+	assert.Equal(t, 1, stored.Attempts)
+	assert.Nil(t, stored.StartedAt)
+}
+
+// TestAnalysisJob_AnalyzerQuery проверяет запрос задачи к серверу анализа:
+// флаги передаются числами, а ответ 429 повторяется позже, не роняя задачу
+func TestAnalysisJob_AnalyzerQuery(t *testing.T) {
+	var mu sync.Mutex
+	var queries []string
+	limited := false
+	server := newAnalyzerServer(t, func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		queries = append(queries, r.URL.RawQuery)
+		first := !limited
+		limited = true
+		mu.Unlock()
+		if first {
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		okHandler(w, r)
+	})
+	client := analyzer.NewClient(analyzer.Options{URLs: []string{server.URL}})
+
+	store := jobs.NewMemoryStore()
+	runner := jobs.NewRunner(store, client, fakeFrameSource{duration: 1}, jobs.NewMemorySink(), 1)
+	t.Cleanup(runner.Stop)
+
+	job := &models.AnalysisJob{ProjectID: primitive.NewObjectID(), SampleRate: 2}
+	require.NoError(t, runner.Submit(context.Background(), job))
+	done := waitForStatus(t, store, job.ID, models.JobStatusCompleted)
+	assert.Equal(t, 2, done.FramesProcessed)
+
+	mu.Lock()
+	defer mu.Unlock()
+	require.Len(t, queries, 3, "Кадр, получивший 429, отправляется повторно")
+	for _, query := range queries {
+		assert.Equal(t, "draw=0&image=0&overlay=0", query)
+	}
+}
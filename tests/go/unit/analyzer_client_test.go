@@ -0,0 +1,198 @@
+package unit
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/kktjss/dance-flow/analyzer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newAnalyzerServer создает тестовый сервер анализа с заданным ответом на /process-frame
+func newAnalyzerServer(t *testing.T, handler http.HandlerFunc) *httptest.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"status":"ok"}`))
+	})
+	mux.HandleFunc("/process-frame", handler)
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func okHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Write([]byte(analyzerResponse))
+}
+
+// testRequest - идемпотентный запрос распознавания кадра
+var testRequest = analyzer.Request{Method: http.MethodPost, Path: "/process-frame", Idempotent: true}
+
+// TestAnalyzerClient_ProcessFrame проверяет разбор ответа через клиента
+func TestAnalyzerClient_ProcessFrame(t *testing.T) {
+	server := newAnalyzerServer(t, okHandler)
+	client := analyzer.NewClient(analyzer.Options{URLs: []string{server.URL}})
+
+	pd, err := client.ProcessFrame(context.Background(), []byte("jpeg"))
+	require.NoError(t, err)
+	require.Len(t, pd.Poses, 1)
+	assert.Equal(t, 1280, pd.FrameWidth)
+}
+
+// TestAnalyzerClient_FailoverToHealthyBackend проверяет повтор на другом сервере
+func TestAnalyzerClient_FailoverToHealthyBackend(t *testing.T) {
+	var failedCalls atomic.Int32
+	broken := newAnalyzerServer(t, func(w http.ResponseWriter, r *http.Request) {
+		failedCalls.Add(1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	})
+	healthy := newAnalyzerServer(t, okHandler)
+
+	client := analyzer.NewClient(analyzer.Options{
+		URLs:         []string{broken.URL, healthy.URL},
+		MaxRetries:   2,
+		RetryBackoff: time.Millisecond,
+	})
+
+	for i := 0; i < 4; i++ {
+		resp, err := client.Do(context.Background(), testRequest)
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, healthy.URL, resp.Backend)
+	}
+	assert.LessOrEqual(t, int(failedCalls.Load()), 4)
+}
+
+// TestAnalyzerClient_NoRetryForClientErrors проверяет, что ошибки запроса не повторяются
+func TestAnalyzerClient_NoRetryForClientErrors(t *testing.T) {
+	var calls atomic.Int32
+	server := newAnalyzerServer(t, func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusBadRequest)
+	})
+	client := analyzer.NewClient(analyzer.Options{URLs: []string{server.URL}, MaxRetries: 3, RetryBackoff: time.Millisecond})
+
+	resp, err := client.Do(context.Background(), testRequest)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	assert.Equal(t, int32(1), calls.Load())
+
+	var gatewayCalls atomic.Int32
+	gateway := newAnalyzerServer(t, func(w http.ResponseWriter, r *http.Request) {
+		gatewayCalls.Add(1)
+		w.WriteHeader(http.StatusBadGateway)
+	})
+	client = analyzer.NewClient(analyzer.Options{URLs: []string{gateway.URL}, MaxRetries: 3, RetryBackoff: time.Millisecond})
+
+	notIdempotent := testRequest
+	notIdempotent.Idempotent = false
+	resp, err = client.Do(context.Background(), notIdempotent)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusBadGateway, resp.StatusCode)
+	assert.Equal(t, int32(1), gatewayCalls.Load(), "Неидемпотентный запрос не повторяется")
+}
+
+// TestAnalyzerClient_CircuitBreaker проверяет быстрый отказ при недоступном сервере
+func TestAnalyzerClient_CircuitBreaker(t *testing.T) {
+	var calls atomic.Int32
+	var down atomic.Bool
+	down.Store(true)
+	server := newAnalyzerServer(t, func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		if down.Load() {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		okHandler(w, r)
+	})
+
+	client := analyzer.NewClient(analyzer.Options{
+		URLs:             []string{server.URL},
+		MaxRetries:       0,
+		BreakerThreshold: 3,
+		BreakerCooldown:  100 * time.Millisecond,
+	})
+
+	for i := 0; i < 3; i++ {
+		resp, err := client.Do(context.Background(), testRequest)
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusBadGateway, resp.StatusCode)
+	}
+
+	// Выключатель разомкнут: запрос не доходит до сервера
+	_, err := client.Do(context.Background(), testRequest)
+	var unavailable *analyzer.UnavailableError
+	require.True(t, errors.As(err, &unavailable))
+	assert.Greater(t, unavailable.RetryAfter, time.Duration(0))
+	assert.Equal(t, int32(3), calls.Load())
+	assert.Equal(t, "open", client.Status()[0].Breaker)
+
+	// После паузы пробный запрос замыкает выключатель
+	down.Store(false)
+	time.Sleep(120 * time.Millisecond)
+	resp, err := client.Do(context.Background(), testRequest)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "closed", client.Status()[0].Breaker)
+}
+
+// TestAnalyzerClient_HealthCheck проверяет исключение сервера, не прошедшего проверку здоровья
+func TestAnalyzerClient_HealthCheck(t *testing.T) {
+	server := newAnalyzerServer(t, okHandler)
+	client := analyzer.NewClient(analyzer.Options{URLs: []string{server.URL, "http://127.0.0.1:1"}})
+
+	client.CheckHealth(context.Background())
+	statuses := client.Status()
+	require.Len(t, statuses, 2)
+	assert.True(t, statuses[0].Healthy)
+	assert.False(t, statuses[1].Healthy)
+
+	for i := 0; i < 3; i++ {
+		resp, err := client.Do(context.Background(), testRequest)
+		require.NoError(t, err)
+		assert.Equal(t, server.URL, resp.Backend)
+	}
+
+	server.Close()
+	client.CheckHealth(context.Background())
+	_, err := client.Do(context.Background(), testRequest)
+	var unavailable *analyzer.UnavailableError
+	assert.True(t, errors.As(err, &unavailable), "Без здоровых серверов запрос отклоняется сразу")
+}
+
+// TestAnalyzerClient_ConcurrencyLimit проверяет ограничение числа одновременных запросов
+func TestAnalyzerClient_ConcurrencyLimit(t *testing.T) {
+	var current, peak atomic.Int32
+	server := newAnalyzerServer(t, func(w http.ResponseWriter, r *http.Request) {
+		n := current.Add(1)
+		for {
+			p := peak.Load()
+			if n <= p || peak.CompareAndSwap(p, n) {
+				break
+			}
+		}
+		time.Sleep(20 * time.Millisecond)
+		current.Add(-1)
+		okHandler(w, r)
+	})
+	client := analyzer.NewClient(analyzer.Options{URLs: []string{server.URL}, MaxConcurrency: 2})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := client.Do(context.Background(), testRequest)
+			assert.NoError(t, err)
+		}()
+	}
+	wg.Wait()
+	assert.LessOrEqual(t, peak.Load(), int32(2))
+}
@@ -0,0 +1,124 @@
+package unit
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/kktjss/dance-flow/audio"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// wavBytes записывает 16-битный PCM WAV из отсчётов по каналам
+func wavBytes(rate, channels int, samples []float64) []byte {
+	var data bytes.Buffer
+	for _, s := range samples {
+		binary.Write(&data, binary.LittleEndian, int16(math.Max(-1, math.Min(1, s))*32767))
+	}
+	var buf bytes.Buffer
+	buf.WriteString("RIFF")
+	binary.Write(&buf, binary.LittleEndian, uint32(36+8+2+data.Len()))
+	buf.WriteString("WAVE")
+	// Посторонний блок нечётной длины перед fmt
+	buf.WriteString("LIST")
+	binary.Write(&buf, binary.LittleEndian, uint32(1))
+	buf.Write([]byte{0, 0})
+	buf.WriteString("fmt ")
+	for _, field := range []interface{}{
+		uint32(16), uint16(1), uint16(channels), uint32(rate),
+		uint32(rate * channels * 2), uint16(channels * 2), uint16(16),
+	} {
+		binary.Write(&buf, binary.LittleEndian, field)
+	}
+	buf.WriteString("data")
+	binary.Write(&buf, binary.LittleEndian, uint32(data.Len()))
+	buf.Write(data.Bytes())
+	return buf.Bytes()
+}
+
+// clickTrack синтезирует стерео-запись: тишина до offset, затем доли с
+// темпом bpm; на первой доле такта - низкий удар, на остальных - щелчок
+func clickTrack(rate int, bpm, offset, duration float64) []float64 {
+	random := rand.New(rand.NewSource(1))
+	samples := make([]float64, int(duration*float64(rate))*2)
+	period := 60 / bpm
+	for beat := 0; offset+float64(beat)*period < duration; beat++ {
+		start := int((offset + float64(beat)*period) * float64(rate))
+		for i := 0; i < rate/10 && start+i < len(samples)/2; i++ {
+			t := float64(i) / float64(rate)
+			var value float64
+			if beat%4 == 0 {
+				value = 0.9 * math.Sin(2*math.Pi*60*t) * math.Exp(-t*30)
+			} else {
+				value = 0.4 * (random.Float64()*2 - 1) * math.Exp(-t*200)
+			}
+			samples[2*(start+i)] += value
+			samples[2*(start+i)+1] += value
+		}
+	}
+	// Слабый шум, чтобы между ударами не было цифровой тишины
+	for i := range samples {
+		samples[i] += 0.001 * (random.Float64()*2 - 1)
+	}
+	return samples
+}
+
+// TestAudioDetectBeats проверяет темп, доли и сильные доли синтетической записи
+func TestAudioDetectBeats(t *testing.T) {
+	clip, err := audio.Decode(bytes.NewReader(wavBytes(44100, 2, clickTrack(44100, 128, 1.25, 20))))
+	require.NoError(t, err)
+	assert.InDelta(t, 20, clip.Duration(), 0.01)
+	assert.InDelta(t, 11025, clip.SampleRate, 1e-9)
+
+	grid, err := audio.DetectBeats(clip, audio.Options{})
+	require.NoError(t, err)
+	assert.InDelta(t, 128, grid.BPM, 0.5)
+	assert.InDelta(t, 1.25, grid.Offset, 0.02)
+	assert.InDelta(t, 1.25, grid.Beats[0], 0.02, "доли в начальной тишине отброшены")
+	require.NotEmpty(t, grid.Downbeats)
+	assert.InDelta(t, 1.25+4*60.0/128, grid.Downbeats[1], 0.02)
+	assert.Greater(t, grid.Confidence, 0.3)
+	assert.InDelta(t, 1.25, grid.Onsets[0], 0.02)
+
+	tempoMap := grid.TempoMap()
+	require.NoError(t, tempoMap.Validate())
+	assert.InDelta(t, 128, tempoMap.BPM, 0.5)
+}
+
+// TestAudioDecode проверяет разбор заголовков и неподдерживаемые форматы
+func TestAudioDecode(t *testing.T) {
+	clip, err := audio.Decode(bytes.NewReader(wavBytes(8000, 1, []float64{0, 0.5, -0.5, 1})))
+	require.NoError(t, err)
+	assert.Equal(t, 8000.0, clip.SampleRate)
+	require.Len(t, clip.Samples, 4)
+	assert.InDelta(t, 0.5, clip.Samples[1], 1e-4)
+	assert.InDelta(t, -0.5, clip.Samples[2], 1e-4)
+
+	_, err = audio.Decode(bytes.NewReader([]byte("ID3\x03\x00\x00\x00\x00\x00\x00\x00\x00")))
+	assert.ErrorIs(t, err, audio.ErrUnsupportedFormat)
+	_, err = audio.Decode(bytes.NewReader([]byte("fLaC\x00\x00\x00\x22")))
+	assert.ErrorIs(t, err, audio.ErrUnsupportedFormat)
+
+	truncated := wavBytes(8000, 1, []float64{0, 0.5})
+	_, err = audio.Decode(bytes.NewReader(truncated[:30]))
+	assert.ErrorIs(t, err, audio.ErrInvalidWAV)
+
+	// Размер data не кратен размеру кадра, а за данными идёт большой блок:
+	// чтение должно остановиться на конце данных
+	padded := wavBytes(8000, 1, []float64{0, 0.5, -0.5})
+	binary.LittleEndian.PutUint32(padded[len(padded)-10:], 7)
+	padded = append(padded, 0)
+	padded = append(padded, "LIST\x00\x00\x04\x00"...)
+	padded = append(padded, make([]byte, 256*1024)...)
+	reader := bytes.NewReader(padded)
+	odd, err := audio.Decode(reader)
+	require.NoError(t, err)
+	assert.Len(t, odd.Samples, 3)
+	assert.Greater(t, reader.Len(), 128*1024, "Блоки после data не читаются")
+
+	_, err = audio.DetectBeats(clip, audio.Options{})
+	assert.ErrorIs(t, err, audio.ErrTooShort)
+}
@@ -0,0 +1,63 @@
+package unit
+
+import (
+	"testing"
+	"time"
+
+	"github.com/kktjss/dance-flow/models"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// TestAuditActions проверяет список действий для фильтра ленты
+func TestAuditActions(t *testing.T) {
+	seen := map[string]bool{}
+	for _, action := range models.AuditActions {
+		assert.False(t, seen[action], action)
+		seen[action] = true
+		assert.True(t, models.IsAuditAction(action))
+	}
+	assert.False(t, models.IsAuditAction("project.renamed"))
+	assert.False(t, models.IsAuditAction(""))
+}
+
+// TestHistoryFromAudit проверяет построение истории пользователя из журнала
+func TestHistoryFromAudit(t *testing.T) {
+	now := time.Now()
+	projectID := primitive.NewObjectID()
+	teamID := primitive.NewObjectID()
+	event := models.AuditEvent{
+		ID:        primitive.NewObjectID(),
+		ActorID:   primitive.NewObjectID(),
+		Action:    models.AuditProjectCreated,
+		ProjectID: projectID,
+		Summary:   "Created project 'Finale'",
+		CreatedAt: now,
+	}
+
+	history := models.HistoryFromAudit(event)
+	assert.Equal(t, event.ID, history.ID)
+	assert.Equal(t, event.ActorID, history.UserID)
+	assert.Equal(t, projectID, history.ProjectID)
+	assert.Equal(t, models.ActionProjectCreated, history.Action)
+	assert.Equal(t, "Created project 'Finale'", history.Description)
+	assert.Equal(t, now, history.Timestamp)
+
+	event.Action = models.AuditStageUpdated
+	event.Summary = ""
+	history = models.HistoryFromAudit(event)
+	assert.Equal(t, models.ActionProjectUpdated, history.Action)
+	assert.Equal(t, models.AuditStageUpdated, history.Description)
+
+	event.TeamID = teamID
+	assert.Equal(t, models.ActionTeamProjectUpdated, models.HistoryFromAudit(event).Action)
+
+	event.Action = models.AuditProjectDeleted
+	assert.Equal(t, models.AuditProjectDeleted, models.HistoryFromAudit(event).Action)
+
+	event = models.AuditEvent{Action: models.AuditTeamMemberAdded, TeamID: teamID}
+	assert.Equal(t, models.ActionTeamMemberAdded, models.HistoryFromAudit(event).Action)
+
+	event = models.AuditEvent{Action: models.AuditWebhookCreated, TeamID: teamID}
+	assert.Equal(t, models.AuditWebhookCreated, models.HistoryFromAudit(event).Action)
+}
@@ -0,0 +1,299 @@
+package unit
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/kktjss/dance-flow/bvh"
+	"github.com/kktjss/dance-flow/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// sampleBVH - скелет в позе T, как у экспорта, с несколькими кадрами движения:
+// танцор смещается, поворачивается и сгибает руки и колени
+func sampleBVH(frames int) string {
+	var b strings.Builder
+	b.WriteString(`HIERARCHY
+ROOT Hips
+{
+	OFFSET 0 0 0
+	CHANNELS 6 Xposition Yposition Zposition Zrotation Xrotation Yrotation
+	JOINT LeftUpLeg
+	{
+		OFFSET 9 0 0
+		CHANNELS 3 Zrotation Xrotation Yrotation
+		JOINT LeftLeg
+		{
+			OFFSET 0 -21 0
+			CHANNELS 3 Zrotation Xrotation Yrotation
+			JOINT LeftFoot
+			{
+				OFFSET 0 -20 0
+				CHANNELS 3 Zrotation Xrotation Yrotation
+				End Site
+				{
+					OFFSET 0 -3 8
+				}
+			}
+		}
+	}
+	JOINT RightUpLeg
+	{
+		OFFSET -9 0 0
+		CHANNELS 3 Zrotation Xrotation Yrotation
+		JOINT RightLeg
+		{
+			OFFSET 0 -21 0
+			CHANNELS 3 Zrotation Xrotation Yrotation
+			JOINT RightFoot
+			{
+				OFFSET 0 -20 0
+				CHANNELS 3 Zrotation Xrotation Yrotation
+				End Site
+				{
+					OFFSET 0 -3 8
+				}
+			}
+		}
+	}
+	JOINT Chest
+	{
+		OFFSET 0 27 0
+		CHANNELS 3 Zrotation Xrotation Yrotation
+		JOINT Head
+		{
+			OFFSET 0 11 0
+			CHANNELS 3 Zrotation Xrotation Yrotation
+			End Site
+			{
+				OFFSET 0 10 0
+			}
+		}
+		JOINT LeftArm
+		{
+			OFFSET 11 0 0
+			CHANNELS 3 Zrotation Xrotation Yrotation
+			JOINT LeftForeArm
+			{
+				OFFSET 14 0 0
+				CHANNELS 3 Zrotation Xrotation Yrotation
+				JOINT LeftHand
+				{
+					OFFSET 13 0 0
+					CHANNELS 3 Zrotation Xrotation Yrotation
+				}
+			}
+		}
+		JOINT RightArm
+		{
+			OFFSET -11 0 0
+			CHANNELS 3 Zrotation Xrotation Yrotation
+			JOINT RightForeArm
+			{
+				OFFSET -14 0 0
+				CHANNELS 3 Zrotation Xrotation Yrotation
+				JOINT RightHand
+				{
+					OFFSET -13 0 0
+					CHANNELS 3 Zrotation Xrotation Yrotation
+				}
+			}
+		}
+	}
+}
+MOTION
+`)
+	fmt.Fprintf(&b, "Frames: %d\nFrame Time: 0.040000\n", frames)
+	for i := 0; i < frames; i++ {
+		t := float64(i) / float64(frames)
+		values := []float64{
+			-20 + 40*t, 50, -10 * t, 5 * t, 0, 60 * t, // Hips
+			0, 0, 0, 30 * t, 0, 0, 0, 0, 0, // левая нога
+			0, 0, 0, -40 * t, 0, 0, 0, 0, 0, // правая нога
+			0, -15 * t, 0, 0, 0, 0, // Chest и Head
+			-60 * t, 0, 0, 0, 0, 20 + 50*t, 0, 0, 0, // левая рука
+			45 * t, 0, 0, 10, 20 * t, 0, 0, 0, 0, // правая рука
+		}
+		for j, v := range values {
+			if j > 0 {
+				b.WriteByte(' ')
+			}
+			fmt.Fprintf(&b, "%.4f", v)
+		}
+		b.WriteByte('\n')
+	}
+	return b.String()
+}
+
+// TestBVHParseWrite проверяет, что запись разобранного файла даёт то же движение
+func TestBVHParseWrite(t *testing.T) {
+	motion, err := bvh.Parse(strings.NewReader(sampleBVH(10)))
+	require.NoError(t, err)
+	assert.Len(t, motion.Joints(), 15)
+	assert.Equal(t, 48, motion.ChannelCount())
+	assert.InDelta(t, 0.04, motion.FrameTime, 1e-9)
+
+	var buf bytes.Buffer
+	require.NoError(t, motion.Write(&buf))
+	again, err := bvh.Parse(&buf)
+	require.NoError(t, err)
+	require.Len(t, again.Frames, len(motion.Frames))
+	for i := range motion.Frames {
+		assert.InDeltaSlice(t, motion.Frames[i], again.Frames[i], 1e-4)
+	}
+	assert.Equal(t, motion.Positions(9), again.Positions(9))
+}
+
+// TestBVHParseErrors проверяет отклонение повреждённых файлов
+func TestBVHParseErrors(t *testing.T) {
+	valid := sampleBVH(2)
+	tests := map[string]string{
+		"Пустой файл":                    "",
+		"Нет иерархии":                   "MOTION\nFrames: 0\nFrame Time: 0.1\n",
+		"Неизвестный канал":              strings.Replace(valid, "Zrotation Xrotation Yrotation", "Wrotation Xrotation Yrotation", 1),
+		"Не хватает значений":            strings.TrimSpace(valid[:len(valid)-20]),
+		"Нулевое время кадра":            strings.Replace(valid, "Frame Time: 0.040000", "Frame Time: 0", 1),
+		"Нечисловое значение":            strings.Replace(valid, "OFFSET 9 0 0", "OFFSET nine 0 0", 1),
+		"Незакрытая иерархия":            valid[:strings.Index(valid, "MOTION")-3],
+		"Кадров меньше, чем в заголовке": strings.Replace(valid, "Frames: 2", fmt.Sprintf("Frames: %d", bvh.MaxFrames), 1),
+	}
+	for name, data := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := bvh.Parse(strings.NewReader(data))
+			assert.ErrorIs(t, err, bvh.ErrInvalidFormat)
+		})
+	}
+}
+
+// TestBVHPoseRoundTrip проверяет импорт BVH в позы и обратный экспорт:
+// суставы восстановленного движения совпадают с исходными
+func TestBVHPoseRoundTrip(t *testing.T) {
+	original, err := bvh.Parse(strings.NewReader(sampleBVH(25)))
+	require.NoError(t, err)
+
+	frames, err := bvh.ToFrames(original, bvh.ImportOptions{Scale: bvh.DefaultScale})
+	require.NoError(t, err)
+	require.Len(t, frames, 25)
+	assert.InDelta(t, 0.96, frames[24].Time, 1e-9)
+
+	skeleton, _ := models.GetSkeleton(models.SkeletonMediaPipe33)
+	nose := frames[0].Joints[skeleton.JointIndex("nose")]
+	assert.Equal(t, 1.0, nose.Visibility)
+	assert.Equal(t, 0.0, frames[0].Joints[skeleton.JointIndex("left_eye")].Visibility)
+
+	sequence := &models.PoseSequence{Skeleton: models.SkeletonMediaPipe33, Frames: frames}
+	exported, err := bvh.FromSequence(sequence, bvh.ExportOptions{FrameRate: 25, Scale: bvh.DefaultScale})
+	require.NoError(t, err)
+	require.Len(t, exported.Frames, 25)
+	assert.InDelta(t, 0.04, exported.FrameTime, 1e-9)
+
+	// Длины костей восстановлены по данным
+	joints := exported.Joints()
+	assert.Equal(t, "Hips", joints[0].Name)
+	assert.InDelta(t, 9, joints[1].Offset[0], 1e-3)
+	assert.InDelta(t, -21, joints[2].Offset[1], 1e-3)
+
+	for i := range exported.Frames {
+		expected := original.Positions(i)
+		actual := exported.Positions(i)
+		for name, position := range expected {
+			got := actual[name]
+			assert.InDeltaSlice(t, position[:], got[:], 1e-2, "frame %d joint %s", i, name)
+		}
+	}
+
+	// Повторный импорт через текст даёт те же позы
+	var buf bytes.Buffer
+	require.NoError(t, exported.Write(&buf))
+	parsed, err := bvh.Parse(&buf)
+	require.NoError(t, err)
+	again, err := bvh.ToFrames(parsed, bvh.ImportOptions{Scale: bvh.DefaultScale})
+	require.NoError(t, err)
+	for i := range frames {
+		for j, joint := range frames[i].Joints {
+			assert.InDelta(t, joint.X, again[i].Joints[j].X, 1e-3)
+			assert.InDelta(t, joint.Y, again[i].Joints[j].Y, 1e-3)
+		}
+	}
+}
+
+// TestBVHExportResample проверяет интерполяцию поз на частоту кадров экспорта
+func TestBVHExportResample(t *testing.T) {
+	original, err := bvh.Parse(strings.NewReader(sampleBVH(11)))
+	require.NoError(t, err)
+	frames, err := bvh.ToFrames(original, bvh.ImportOptions{Scale: bvh.DefaultScale})
+	require.NoError(t, err)
+
+	sequence := &models.PoseSequence{Skeleton: models.SkeletonMediaPipe33, Frames: frames}
+	exported, err := bvh.FromSequence(sequence, bvh.ExportOptions{FrameRate: 50})
+	require.NoError(t, err)
+	assert.Len(t, exported.Frames, 21)
+
+	// Корень движется равномерно, поэтому промежуточный кадр лежит посередине
+	first := exported.Positions(0)["Hips"]
+	middle := exported.Positions(1)["Hips"]
+	second := exported.Positions(2)["Hips"]
+	assert.InDelta(t, (first[0]+second[0])/2, middle[0], 1e-3)
+}
+
+// TestBVHExportHiddenStart проверяет экспорт, когда танцор появляется не с первого кадра
+func TestBVHExportHiddenStart(t *testing.T) {
+	original, err := bvh.Parse(strings.NewReader(sampleBVH(10)))
+	require.NoError(t, err)
+	frames, err := bvh.ToFrames(original, bvh.ImportOptions{Scale: bvh.DefaultScale})
+	require.NoError(t, err)
+	for _, frame := range frames[:3] {
+		for j := range frame.Joints {
+			frame.Joints[j].Visibility = 0
+		}
+	}
+
+	sequence := &models.PoseSequence{Skeleton: models.SkeletonMediaPipe33, Frames: frames}
+	exported, err := bvh.FromSequence(sequence, bvh.ExportOptions{FrameRate: 25, Scale: bvh.DefaultScale})
+	require.NoError(t, err)
+	require.Len(t, exported.Frames, 10)
+	// Начальные кадры повторяют первую видимую позу, а не ставят танцора в начало координат
+	assert.NotZero(t, exported.Frames[3][1])
+	for i := 0; i < 3; i++ {
+		assert.Equal(t, exported.Frames[3], exported.Frames[i])
+	}
+
+	for _, frame := range frames {
+		for j := range frame.Joints {
+			frame.Joints[j].Visibility = 0
+		}
+	}
+	_, err = bvh.FromSequence(sequence, bvh.ExportOptions{FrameRate: 25})
+	assert.Error(t, err)
+}
+
+// TestBVHImportFitsFrame проверяет, что без масштаба движение вписывается в кадр
+func TestBVHImportFitsFrame(t *testing.T) {
+	motion, err := bvh.Parse(strings.NewReader(sampleBVH(5)))
+	require.NoError(t, err)
+	// Переводим движение в миллиметры: без масштаба результат не должен зависеть от единиц
+	for _, joint := range motion.Joints() {
+		joint.Offset = bvh.Vec3{joint.Offset[0] * 10, joint.Offset[1] * 10, joint.Offset[2] * 10}
+	}
+	for _, frame := range motion.Frames {
+		frame[0], frame[1], frame[2] = frame[0]*10, frame[1]*10, frame[2]*10
+	}
+
+	frames, err := bvh.ToFrames(motion, bvh.ImportOptions{Aspect: 16.0 / 9})
+	require.NoError(t, err)
+	for _, frame := range frames {
+		for _, joint := range frame.Joints {
+			if joint.Visibility == 0 {
+				continue
+			}
+			assert.True(t, joint.X >= 0.05 && joint.X <= 0.95 && joint.Y >= 0.05 && joint.Y <= 0.95,
+				"joint %s at (%.3f, %.3f) is outside the frame", joint.Name, joint.X, joint.Y)
+		}
+	}
+
+	_, err = bvh.ToFrames(&bvh.Motion{Root: &bvh.Joint{Name: "Prop"}, FrameTime: 1, Frames: [][]float64{{}}}, bvh.ImportOptions{})
+	assert.ErrorIs(t, err, bvh.ErrNoMappedJoints)
+}
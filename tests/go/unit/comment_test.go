@@ -0,0 +1,96 @@
+package unit
+
+import (
+	"math"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kktjss/dance-flow/models"
+	"github.com/kktjss/dance-flow/routes"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+// TestParseMentions проверяет разбор @упоминаний в тексте комментария
+func TestParseMentions(t *testing.T) {
+	assert.Equal(t, []string{"anna", "boris_k", "Вера"},
+		models.ParseMentions("@anna, посмотри. @boris_k и @Вера: вход на 5 раньше @Anna."))
+	assert.Equal(t, []string{"j.doe"}, models.ParseMentions("Спасибо, @j.doe."))
+	assert.Empty(t, models.ParseMentions("пишите на team@example.com"))
+	assert.Empty(t, models.ParseMentions("@ и ничего"))
+}
+
+// TestCommentInputValidate проверяет момент времени и область кадра
+func TestCommentInputValidate(t *testing.T) {
+	at := 12.5
+	input := models.CommentInput{Time: &at, Region: &models.CommentRegion{X: 0.1, Y: 0.2, Width: 0.5, Height: 0.3}}
+	assert.NoError(t, input.Validate())
+
+	negative, nan := -1.0, math.NaN()
+	assert.Error(t, (&models.CommentInput{Time: &negative}).Validate())
+	assert.Error(t, (&models.CommentInput{Time: &nan}).Validate())
+	assert.Error(t, (&models.CommentInput{Region: &models.CommentRegion{X: 0.8, Width: 0.5, Height: 0.1}}).Validate())
+	assert.Error(t, (&models.CommentInput{Region: &models.CommentRegion{X: 0.1, Y: 0.1}}).Validate())
+	assert.Error(t, (&models.CommentInput{Region: &models.CommentRegion{X: -0.1, Width: 0.5, Height: 0.5}}).Validate())
+}
+
+// TestValidateCommentBody проверяет обрезку и длину текста
+func TestValidateCommentBody(t *testing.T) {
+	body, err := models.ValidateCommentBody("  руки выше на 3-4  ")
+	require.NoError(t, err)
+	assert.Equal(t, "руки выше на 3-4", body)
+
+	_, err = models.ValidateCommentBody(" \n ")
+	assert.Error(t, err)
+	_, err = models.ValidateCommentBody(strings.Repeat("я", models.MaxCommentLength+1))
+	assert.Error(t, err)
+}
+
+// TestCommentThreadResolveAccess проверяет, кто может решать ветки обсуждения
+func TestCommentThreadResolveAccess(t *testing.T) {
+	projectID := primitive.NewObjectID()
+	ownerID := primitive.NewObjectID()
+	authorID := primitive.NewObjectID()
+	threadID := primitive.NewObjectID()
+	project := publicProjectDoc(projectID, ownerID)
+	thread := bson.D{
+		{Key: "_id", Value: threadID},
+		{Key: "projectId", Value: projectID},
+		{Key: "authorId", Value: authorID},
+		{Key: "body", Value: "Lift is late"},
+		{Key: "createdAt", Value: time.Now()},
+	}
+	path := "/api/projects/" + projectID.Hex() + "/comments/" + threadID.Hex() + "/resolve"
+
+	runWithMockDB(t, "thread author", func(mt *mtest.T) {
+		router, cfg := newTestRouter(t, routes.RegisterCommentRoutes)
+		mt.AddMockResponses(mockCursor("projects", project), mockCursor("comments", thread), mockWrite(1, 1))
+
+		w := serveJSON(t, router, http.MethodPost, path, testToken(t, cfg, authorID), nil)
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		assert.Len(t, sentCommands(mt, "update", "comments"), 1)
+	})
+
+	runWithMockDB(t, "project owner", func(mt *mtest.T) {
+		router, cfg := newTestRouter(t, routes.RegisterCommentRoutes)
+		mt.AddMockResponses(mockCursor("projects", project), mockCursor("comments", thread),
+			mockCursor("projects", project), mockWrite(1, 1))
+
+		w := serveJSON(t, router, http.MethodPost, path, testToken(t, cfg, ownerID), nil)
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	})
+
+	runWithMockDB(t, "read-only viewer", func(mt *mtest.T) {
+		router, cfg := newTestRouter(t, routes.RegisterCommentRoutes)
+		mt.AddMockResponses(mockCursor("projects", project), mockCursor("comments", thread), mockCursor("projects", project))
+
+		w := serveJSON(t, router, http.MethodPost, path, testToken(t, cfg, primitive.NewObjectID()), nil)
+		assert.Equal(t, http.StatusForbidden, w.Code, w.Body.String())
+		assert.Empty(t, sentCommands(mt, "update", "comments"))
+	})
+}
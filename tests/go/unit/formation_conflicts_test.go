@@ -0,0 +1,131 @@
+package unit
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/kktjss/dance-flow/formation"
+	"github.com/kktjss/dance-flow/routes"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+// dancer создаёт элемент 20x20 с ключевыми кадрами позиции центра (время, x, y)
+func dancer(id string, points ...[3]float64) map[string]interface{} {
+	keyframes := []interface{}{}
+	for _, p := range points {
+		keyframes = append(keyframes, map[string]interface{}{
+			"time":     p[0],
+			"position": map[string]interface{}{"x": p[1] - 10, "y": p[2] - 10},
+		})
+	}
+	return map[string]interface{}{
+		"id":        id,
+		"type":      "circle",
+		"position":  map[string]interface{}{"x": points[0][1] - 10, "y": points[0][2] - 10},
+		"size":      map[string]interface{}{"width": 20.0, "height": 20.0},
+		"keyframes": keyframes,
+	}
+}
+
+// TestFormationConflictsCrossing проверяет встречное движение через одну точку
+func TestFormationConflictsCrossing(t *testing.T) {
+	elements := []interface{}{
+		dancer("a", [3]float64{0, 0, 100}, [3]float64{4, 200, 100}),
+		dancer("b", [3]float64{0, 200, 100}, [3]float64{4, 0, 100}),
+		dancer("c", [3]float64{0, 100, 0}, [3]float64{4, 100, 0}),
+	}
+
+	// Шаг больше интервала: сближение всё равно находится между выборками
+	conflicts, err := formation.FindConflicts(elements, formation.ConflictOptions{Step: 10})
+	require.NoError(t, err)
+	require.Len(t, conflicts, 1)
+	conflict := conflicts[0]
+	assert.Equal(t, [2]string{"a", "b"}, conflict.ElementIDs)
+	assert.InDelta(t, 2, conflict.Time, 1e-9)
+	assert.InDelta(t, 0, conflict.Distance, 1e-9)
+	assert.InDelta(t, 20, conflict.Required, 1e-9)
+	assert.Equal(t, formation.Point{X: 100, Y: 100}, conflict.Position)
+
+	// Встречное движение по одной линии - сближение, встреча под углом - пересечение
+	assert.Equal(t, formation.ConflictOverlap, conflict.Type)
+	elements[2] = dancer("c", [3]float64{0, 100, 0}, [3]float64{4, 100, 200})
+	conflicts, err = formation.FindConflicts(elements, formation.ConflictOptions{})
+	require.NoError(t, err)
+	require.Len(t, conflicts, 3)
+	for _, conflict := range conflicts {
+		expected := formation.ConflictCrossing
+		if conflict.ElementIDs == [2]string{"a", "b"} {
+			expected = formation.ConflictOverlap
+		}
+		assert.Equal(t, expected, conflict.Type, "%v", conflict.ElementIDs)
+		assert.InDelta(t, 2, conflict.Time, 1e-9)
+	}
+}
+
+// TestFormationConflictsDistance проверяет интервал конфликта и минимальное расстояние
+func TestFormationConflictsDistance(t *testing.T) {
+	elements := []interface{}{
+		dancer("a", [3]float64{0, 0, 0}, [3]float64{10, 0, 0}),
+		// b подходит к a на 30 с 2 по 4 секунду и уходит к 6-й
+		dancer("b", [3]float64{0, 100, 0}, [3]float64{2, 30, 0}, [3]float64{4, 30, 0}, [3]float64{6, 100, 0}),
+		map[string]interface{}{
+			"id":       "label",
+			"type":     "text",
+			"content":  "a",
+			"position": map[string]interface{}{"x": -10.0, "y": -10.0},
+			"size":     map[string]interface{}{"width": 20.0, "height": 20.0},
+		},
+	}
+
+	conflicts, err := formation.FindConflicts(elements, formation.ConflictOptions{})
+	require.NoError(t, err)
+	assert.Empty(t, conflicts, "элементы не пересекаются, подпись над a не проверяется")
+
+	conflicts, err = formation.FindConflicts(elements, formation.ConflictOptions{MinDistance: 50, Step: 0.5})
+	require.NoError(t, err)
+	require.Len(t, conflicts, 1)
+	conflict := conflicts[0]
+	assert.Equal(t, formation.ConflictOverlap, conflict.Type)
+	// Расстояние 50 достигается при x = 100 - 35t и x = 30 + 35(t-4)
+	assert.InDelta(t, 50.0/35, conflict.StartTime, 1e-9)
+	assert.InDelta(t, 4+20.0/35, conflict.EndTime, 1e-9)
+	assert.InDelta(t, 30, conflict.Distance, 1e-9)
+	assert.InDelta(t, 50, conflict.Required, 1e-9)
+
+	// Проверка только части интервала и только выбранных элементов
+	conflicts, err = formation.FindConflicts(elements, formation.ConflictOptions{MinDistance: 50, From: 4, To: 10})
+	require.NoError(t, err)
+	require.Len(t, conflicts, 1)
+	assert.InDelta(t, 4, conflicts[0].StartTime, 1e-9)
+
+	conflicts, err = formation.FindConflicts(elements, formation.ConflictOptions{MinDistance: 50, ElementIDs: []string{"a", "label"}})
+	require.NoError(t, err)
+	assert.Len(t, conflicts, 1, "текстовый элемент проверяется, если указан явно")
+
+	_, err = formation.FindConflicts(elements, formation.ConflictOptions{From: 0, To: 1000, Step: 0.01})
+	assert.ErrorIs(t, err, formation.ErrTooManySamples)
+}
+
+// TestFormationQueryBounds проверяет отклонение нечисловых моментов и границ
+func TestFormationQueryBounds(t *testing.T) {
+	projectID := primitive.NewObjectID()
+	base := "/api/projects/" + projectID.Hex() + "/formations"
+	for _, path := range []string{
+		base + "?format=json&times=0,NaN",
+		base + "?format=json&times=Inf",
+		base + "/conflicts?minDistance=NaN",
+		base + "/conflicts?from=NaN",
+		base + "/conflicts?to=NaN",
+	} {
+		runWithMockDB(t, path, func(mt *mtest.T) {
+			router, cfg := newTestRouter(t, routes.RegisterFormationRoutes)
+			mt.AddMockResponses(mockCursor("projects", publicProjectDoc(projectID, primitive.NewObjectID())))
+
+			w := serveJSON(t, router, http.MethodGet, path, testToken(t, cfg, primitive.NewObjectID()), nil)
+			assert.Equal(t, http.StatusBadRequest, w.Code, w.Body.String())
+		})
+	}
+}
@@ -0,0 +1,66 @@
+package unit
+
+import (
+	"testing"
+
+	"github.com/kktjss/dance-flow/formation"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// partElement - элемент 20x20, левый верхний угол которого проходит точки кадров
+func partElement(id string, frames ...[3]float64) map[string]interface{} {
+	keyframes := []interface{}{}
+	for _, f := range frames {
+		keyframes = append(keyframes, map[string]interface{}{
+			"time":     f[0],
+			"position": map[string]interface{}{"x": f[1], "y": f[2]},
+			"opacity":  1.0,
+			"scale":    1.0,
+		})
+	}
+	return map[string]interface{}{
+		"id":        id,
+		"title":     id,
+		"size":      map[string]interface{}{"width": 20.0, "height": 20.0},
+		"position":  map[string]interface{}{"x": frames[0][1], "y": frames[0][2]},
+		"keyframes": keyframes,
+	}
+}
+
+// TestFormationPart проверяет шаги партии, заметки и соседей
+func TestFormationPart(t *testing.T) {
+	me := partElement("me", [3]float64{0, 90, 90}, [3]float64{4, 190, 90})
+	me["keyframes"].([]interface{})[1].(map[string]interface{})["notes"] = "turn on 5"
+	elements := []interface{}{
+		me,
+		partElement("left", [3]float64{0, 40, 90}),
+		partElement("front", [3]float64{0, 90, 190}, [3]float64{4, 190, 140}),
+		partElement("far", [3]float64{0, 500, 500}),
+	}
+
+	steps, err := formation.BuildPart(elements, formation.PartOptions{
+		ElementID:  "me",
+		Neighbours: 2,
+		Labels:     map[string]string{"left": "Anna"},
+	})
+	require.NoError(t, err)
+	require.Len(t, steps, 2)
+
+	assert.Equal(t, formation.Point{X: 100, Y: 100}, steps[0].Center)
+	require.NotNil(t, steps[0].Next)
+	assert.Equal(t, formation.Point{X: 200, Y: 100}, *steps[0].Next)
+	require.Len(t, steps[0].Neighbours, 2)
+	assert.Equal(t, "Anna", steps[0].Neighbours[0].Label)
+	assert.Equal(t, "left", steps[0].Neighbours[0].Direction)
+	assert.InDelta(t, 50, steps[0].Neighbours[0].Distance, 1e-9)
+	assert.Equal(t, "downstage", steps[0].Neighbours[1].Direction)
+
+	assert.Equal(t, "turn on 5", steps[1].Notes)
+	assert.Nil(t, steps[1].Next)
+	assert.Equal(t, "front", steps[1].Neighbours[0].ID)
+	assert.InDelta(t, 50, steps[1].Neighbours[0].Distance, 1e-9)
+
+	_, err = formation.BuildPart(elements, formation.PartOptions{ElementID: "missing"})
+	assert.ErrorIs(t, err, formation.ErrUnknownElement)
+}
@@ -0,0 +1,170 @@
+package unit
+
+import (
+	"bytes"
+	"compress/zlib"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/kktjss/dance-flow/formation"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// formationElements - два танцора: первый идёт вправо, второй стоит на месте
+func formationElements() []interface{} {
+	return []interface{}{
+		map[string]interface{}{
+			"id":       "circle-1",
+			"type":     "circle",
+			"title":    "Анна <solo>",
+			"position": map[string]interface{}{"x": 0.0, "y": 0.0},
+			"size":     map[string]interface{}{"width": 40.0, "height": 40.0},
+			"style":    map[string]interface{}{"backgroundColor": "#f00", "opacity": 1.0},
+			"keyframes": []interface{}{
+				map[string]interface{}{"time": 4.0, "position": map[string]interface{}{"x": 380.0, "y": 80.0}},
+				map[string]interface{}{"time": 0.0, "position": map[string]interface{}{"x": 80.0, "y": 80.0}},
+				map[string]interface{}{"time": 6.0, "position": map[string]interface{}{"x": 380.0, "y": 80.0}, "opacity": 0.0},
+			},
+		},
+		map[string]interface{}{
+			"id":        "rect-1",
+			"type":      "rectangle",
+			"content":   "Борис",
+			"position":  map[string]interface{}{"x": 400.0, "y": 300.0},
+			"size":      map[string]interface{}{"width": 20.0, "height": 30.0},
+			"style":     map[string]interface{}{"backgroundColor": "rgb(0, 128, 255)"},
+			"keyframes": []interface{}{},
+		},
+		map[string]interface{}{
+			"id":      "image-1",
+			"type":    "image",
+			"content": "/uploads/files/logo.png",
+		},
+	}
+}
+
+// TestFormationBuild проверяет интерполяцию позиций и направление движения
+func TestFormationBuild(t *testing.T) {
+	elements := formationElements()
+	assert.Equal(t, []float64{0, 4, 6}, formation.KeyframeTimes(elements))
+
+	stage := formation.Stage{Width: 800, Height: 600}
+	charts, err := formation.Build(elements, []float64{0, 2, 4, 6}, stage)
+	require.NoError(t, err)
+	require.Len(t, charts, 4)
+
+	start := charts[0].Markers[0]
+	assert.Equal(t, "Анна <solo>", start.Label)
+	assert.Equal(t, formation.Point{X: 100, Y: 100}, start.Center)
+	require.NotNil(t, start.Next)
+	assert.Equal(t, formation.Point{X: 400, Y: 100}, *start.Next)
+	assert.Equal(t, "#ff0000", start.Color.Hex())
+
+	middle := charts[1].Markers[0]
+	assert.InDelta(t, 250, middle.Center.X, 1e-9)
+	assert.Equal(t, formation.Point{X: 400, Y: 100}, *middle.Next)
+
+	// После последнего перемещения стрелки нет, а исчезнувший элемент не выводится
+	assert.Nil(t, charts[2].Markers[0].Next)
+	require.Len(t, charts[3].Markers, 2)
+	assert.Equal(t, "rect-1", charts[3].Markers[0].ID)
+
+	static := charts[0].Markers[1]
+	assert.Equal(t, "Борис", static.Label)
+	assert.Equal(t, formation.Point{X: 410, Y: 315}, static.Center)
+	assert.Nil(t, static.Next)
+	assert.Equal(t, "#0080ff", static.Color.Hex())
+
+	// Ссылка на изображение не становится подписью
+	assert.Equal(t, "", charts[0].Markers[2].Label)
+
+	_, err = formation.Build(elements, make([]float64, formation.MaxCharts+1), stage)
+	assert.ErrorIs(t, err, formation.ErrTooManyCharts)
+}
+
+// TestFormationSVG проверяет вывод листов в SVG
+func TestFormationSVG(t *testing.T) {
+	charts, err := formation.Build(formationElements(), []float64{0, 65.5}, formation.Stage{Width: 800, Height: 600})
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	doc := &formation.Document{Title: "Вальс & танго", Stage: formation.Stage{Width: 800, Height: 600}, Charts: charts}
+	require.NoError(t, formation.WriteSVG(&buf, doc))
+	svg := buf.String()
+
+	assert.True(t, strings.HasPrefix(svg, "<?xml"))
+	assert.Equal(t, 2, strings.Count(svg, `<g id="chart-`))
+	assert.Contains(t, svg, "Вальс &amp; танго")
+	assert.Contains(t, svg, "Анна &lt;solo&gt;")
+	assert.Contains(t, svg, "1:05.50")
+	assert.Contains(t, svg, `fill="#ff0000"`)
+	assert.Contains(t, svg, "<polygon", "для движущегося элемента рисуется стрелка")
+
+	err = formation.WriteSVG(&buf, &formation.Document{Stage: formation.Stage{Width: 800, Height: 600}})
+	assert.ErrorIs(t, err, formation.ErrNoCharts)
+	err = formation.WriteSVG(&buf, &formation.Document{Charts: charts})
+	assert.ErrorIs(t, err, formation.ErrInvalidStage)
+}
+
+// TestFormationPDF проверяет структуру многостраничного PDF
+func TestFormationPDF(t *testing.T) {
+	charts, err := formation.Build(formationElements(), []float64{0, 2, 4}, formation.Stage{Width: 800, Height: 600})
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	doc := &formation.Document{Title: "Вальс", Stage: formation.Stage{Width: 800, Height: 600}, Charts: charts}
+	require.NoError(t, formation.WritePDF(&buf, doc))
+	pdf := buf.Bytes()
+
+	assert.True(t, bytes.HasPrefix(pdf, []byte("%PDF-1.4")))
+	assert.True(t, bytes.HasSuffix(pdf, []byte("%%EOF\n")))
+	assert.Contains(t, string(pdf), "/Count 3")
+	assert.Equal(t, 3, strings.Count(string(pdf), "/Type /Page "))
+
+	// Смещения в таблице xref указывают на начало объектов
+	startxref := regexp.MustCompile(`startxref\n(\d+)`).FindSubmatch(pdf)
+	require.NotNil(t, startxref)
+	xref, _ := strconv.Atoi(string(startxref[1]))
+	require.True(t, bytes.HasPrefix(pdf[xref:], []byte("xref\n")))
+	entries := regexp.MustCompile(`(\d{10}) 00000 n `).FindAllSubmatch(pdf[xref:], -1)
+	require.Len(t, entries, 4+2*3)
+	for i, entry := range entries {
+		offset, _ := strconv.Atoi(string(entry[1]))
+		assert.True(t, bytes.HasPrefix(pdf[offset:], []byte(strconv.Itoa(i+1)+" 0 obj")), "object %d", i+1)
+	}
+
+	// Подписи в содержимом страницы транслитерированы для стандартного шрифта
+	stream := regexp.MustCompile(`(?s)stream\n(.*?)\nendstream`).FindSubmatch(pdf)
+	require.NotNil(t, stream)
+	zr, err := zlib.NewReader(bytes.NewReader(stream[1]))
+	require.NoError(t, err)
+	content, err := io.ReadAll(zr)
+	require.NoError(t, err)
+	assert.Contains(t, string(content), "(Anna <solo>) Tj")
+	assert.Contains(t, string(content), "(Boris) Tj")
+	assert.Contains(t, string(content), "(Zriteli) Tj")
+	assert.Contains(t, string(content), "(0:00.00) Tj")
+}
+
+// TestFormationParseColor проверяет разбор цветов CSS
+func TestFormationParseColor(t *testing.T) {
+	tests := map[string]string{
+		"#abc":                 "#aabbcc",
+		"#12345678":            "#123456",
+		"RED":                  "#ff0000",
+		"rgba(10, 20, 30, .5)": "#0a141e",
+	}
+	for input, expected := range tests {
+		color, ok := formation.ParseColor(input)
+		require.True(t, ok, input)
+		assert.Equal(t, expected, color.Hex())
+	}
+	for _, input := range []string{"", "#12", "url(#x)", "rgb(1,2)", "rgb(300,0,0)", `"/><script>`} {
+		_, ok := formation.ParseColor(input)
+		assert.False(t, ok, input)
+	}
+}
@@ -0,0 +1,109 @@
+package unit
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kktjss/dance-flow/formation"
+	"github.com/kktjss/dance-flow/routes"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+// TestFormationAssign проверяет назначения с наименьшей суммой
+func TestFormationAssign(t *testing.T) {
+	cost := [][]float64{
+		{4, 1, 3},
+		{2, 0, 5},
+		{3, 2, 2},
+	}
+	assert.Equal(t, []int{1, 0, 2}, formation.Assign(cost))
+
+	// Строк меньше, чем столбцов: лишний столбец остаётся свободным
+	assert.Equal(t, []int{2, 0}, formation.Assign([][]float64{{5, 9, 1}, {1, 3, 7}}))
+	assert.Empty(t, formation.Assign(nil))
+}
+
+// TestFormationTransition проверяет назначение точек и обход стоящего танцора
+func TestFormationTransition(t *testing.T) {
+	elements := []interface{}{
+		dancer("a", [3]float64{0, 0, 100}),
+		dancer("c", [3]float64{0, 100, 110}),
+		dancer("d", [3]float64{0, 0, 300}),
+	}
+	targets := []formation.Point{{X: 200, Y: 100}, {X: 100, Y: 110}, {X: 0, Y: 400}}
+
+	transition, err := formation.PlanTransition(elements, formation.TransitionOptions{From: 2, To: 6, Targets: targets})
+	require.NoError(t, err)
+	require.Len(t, transition.Assignments, 3)
+	assert.Equal(t, formation.Point{X: 200, Y: 100}, transition.Assignments[0].To)
+	assert.Equal(t, formation.Point{X: 100, Y: 110}, transition.Assignments[1].To)
+	assert.InDelta(t, 300, transition.TotalDistance, 1e-9)
+	assert.Empty(t, transition.Unresolved)
+
+	// c стоит на пути a, поэтому a обходит его через промежуточную точку
+	path := transition.Paths["a"]
+	require.Len(t, path, 3)
+	assert.Equal(t, formation.Waypoint{Time: 2, Position: formation.Point{X: 0, Y: 100}}, path[0])
+	assert.InDelta(t, 4, path[1].Time, 1e-9)
+	assert.InDelta(t, 100, path[1].Position.X, 1e-9)
+	assert.Equal(t, formation.Waypoint{Time: 6, Position: formation.Point{X: 200, Y: 100}}, path[2])
+
+	formation.ApplyTransition(elements, transition)
+	keyframes := elements[0].(map[string]interface{})["keyframes"].([]interface{})
+	// Кадр в момент 0 сохраняется, пути записываются левым верхним углом
+	require.Len(t, keyframes, 4)
+	last := keyframes[3].(map[string]interface{})
+	assert.Equal(t, 6.0, last["time"])
+	assert.Equal(t, map[string]interface{}{"x": 190.0, "y": 90.0}, last["position"])
+
+	conflicts, err := formation.FindConflicts(elements, formation.ConflictOptions{From: 2, To: 6})
+	require.NoError(t, err)
+	assert.Empty(t, conflicts)
+
+	_, err = formation.PlanTransition(elements, formation.TransitionOptions{From: 2, To: 6, Targets: targets[:2]})
+	assert.ErrorIs(t, err, formation.ErrNotEnoughTargets)
+	_, err = formation.PlanTransition(elements, formation.TransitionOptions{From: 2, To: 6, ElementIDs: []string{"x"}})
+	assert.ErrorIs(t, err, formation.ErrUnknownElement)
+}
+
+// TestFormationTransitionReassign проверяет, что встречный обмен местами
+// заменяется назначением без движения
+func TestFormationTransitionReassign(t *testing.T) {
+	elements := []interface{}{
+		dancer("a", [3]float64{0, 0, 100}, [3]float64{4, 200, 100}),
+		dancer("b", [3]float64{0, 200, 100}, [3]float64{4, 0, 100}),
+	}
+	transition, err := formation.PlanTransition(elements, formation.TransitionOptions{From: 0, To: 4})
+	require.NoError(t, err)
+	assert.InDelta(t, 0, transition.TotalDistance, 1e-9)
+	assert.Equal(t, formation.Point{X: 0, Y: 100}, transition.Assignments[0].To)
+
+	formation.ApplyTransition(elements, transition)
+	conflicts, err := formation.FindConflicts(elements, formation.ConflictOptions{})
+	require.NoError(t, err)
+	assert.Empty(t, conflicts)
+}
+
+// TestFormationTransitionTargetLimit проверяет ограничение числа точек новой расстановки
+func TestFormationTransitionTargetLimit(t *testing.T) {
+	targets := make([]formation.Point, formation.MaxTransitionDancers+1)
+
+	_, err := formation.PlanTransition([]interface{}{dancer("a", [3]float64{0, 0, 0})},
+		formation.TransitionOptions{From: 0, To: 1, Targets: targets})
+	assert.ErrorIs(t, err, formation.ErrTooManyDancers)
+
+	projectID := primitive.NewObjectID()
+	runWithMockDB(t, "route", func(mt *mtest.T) {
+		router, cfg := newTestRouter(t, routes.RegisterFormationRoutes)
+		mt.AddMockResponses(mockCount("projects", 1))
+
+		w := serveJSON(t, router, http.MethodPost, "/api/projects/"+projectID.Hex()+"/formations/transition",
+			testToken(t, cfg, primitive.NewObjectID()), gin.H{"from": 0, "to": 1, "targets": targets})
+		assert.Equal(t, http.StatusBadRequest, w.Code, w.Body.String())
+		assert.Empty(t, sentCommands(mt, "find", "projects"))
+	})
+}
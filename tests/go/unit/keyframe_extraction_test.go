@@ -0,0 +1,88 @@
+package unit
+
+import (
+	"testing"
+
+	"github.com/kktjss/dance-flow/models"
+	"github.com/kktjss/dance-flow/poseanalysis"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestSimplifyPathStraightLine проверяет, что равномерное движение по прямой сводится к двум точкам
+func TestSimplifyPathStraightLine(t *testing.T) {
+	points := make([]poseanalysis.TrajectoryPoint, 50)
+	for i := range points {
+		points[i] = poseanalysis.TrajectoryPoint{Time: float64(i) / 10, X: float64(i) * 4, Y: 100}
+	}
+
+	simplified := poseanalysis.SimplifyPath(points, 1)
+	require.Len(t, simplified, 2)
+	assert.Equal(t, points[0], simplified[0])
+	assert.Equal(t, points[len(points)-1], simplified[1])
+}
+
+// TestSimplifyPathCorner проверяет, что поворот пути сохраняется, а мелкое дрожание - нет
+func TestSimplifyPathCorner(t *testing.T) {
+	var points []poseanalysis.TrajectoryPoint
+	for i := 0; i <= 20; i++ {
+		jitter := float64(i%2) * 0.5
+		points = append(points, poseanalysis.TrajectoryPoint{Time: float64(i), X: float64(i) * 10, Y: jitter})
+	}
+	for i := 1; i <= 20; i++ {
+		points = append(points, poseanalysis.TrajectoryPoint{Time: float64(20 + i), X: 200, Y: float64(i) * 10})
+	}
+
+	simplified := poseanalysis.SimplifyPath(points, 2)
+	require.Len(t, simplified, 3)
+	assert.Equal(t, 20.0, simplified[1].Time)
+	assert.Equal(t, 200.0, simplified[1].X)
+
+	// Нулевой допуск сохраняет все точки, которые не лежат точно на отрезках
+	assert.Greater(t, len(poseanalysis.SimplifyPath(points, 0)), 3)
+}
+
+// TestSimplifyPathKeepsPause проверяет, что остановка на месте не теряется,
+// хотя все точки лежат на одной прямой
+func TestSimplifyPathKeepsPause(t *testing.T) {
+	var points []poseanalysis.TrajectoryPoint
+	for i := 0; i <= 10; i++ {
+		points = append(points, poseanalysis.TrajectoryPoint{Time: float64(i), X: float64(i) * 10})
+	}
+	for i := 1; i <= 10; i++ {
+		points = append(points, poseanalysis.TrajectoryPoint{Time: float64(10 + i), X: 100})
+	}
+
+	simplified := poseanalysis.SimplifyPath(points, 1)
+	require.Len(t, simplified, 3)
+	assert.Equal(t, 10.0, simplified[1].Time)
+}
+
+// TestTrajectory проверяет выбор точки опоры: середина стоп, иначе бёдра, иначе кадр пропускается
+func TestTrajectory(t *testing.T) {
+	joint := func(name string, x, y, visibility float64) models.Joint {
+		return models.Joint{Name: name, X: x, Y: y, Visibility: visibility}
+	}
+	sequence := &models.PoseSequence{
+		Skeleton: models.SkeletonMediaPipe33,
+		Frames: []models.PoseFrame{
+			{Time: 0, Joints: []models.Joint{
+				joint("left_ankle", 0.4, 0.9, 0.9), joint("right_ankle", 0.6, 0.9, 0.9),
+				joint("left_hip", 0.45, 0.5, 0.9), joint("right_hip", 0.55, 0.5, 0.9),
+			}},
+			{Time: 1, Joints: []models.Joint{
+				joint("left_ankle", 0.4, 0.9, 0.1), joint("right_ankle", 0.6, 0.9, 0.1),
+				joint("left_hip", 0.2, 0.5, 0.9), joint("right_hip", 0.4, 0.5, 0.9),
+			}},
+			{Time: 2, Joints: []models.Joint{joint("nose", 0.5, 0.1, 0.9)}},
+		},
+	}
+
+	path, err := poseanalysis.Trajectory(sequence)
+	require.NoError(t, err)
+	require.Len(t, path, 2)
+	assert.InDelta(t, 0.5, path[0].X, 1e-9)
+	assert.InDelta(t, 0.9, path[0].Y, 1e-9)
+	assert.InDelta(t, 0.3, path[1].X, 1e-9)
+	assert.InDelta(t, 0.5, path[1].Y, 1e-9)
+}
@@ -0,0 +1,273 @@
+package unit
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kktjss/dance-flow/models"
+	"github.com/kktjss/dance-flow/routes"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func modelDoc(id, owner, team primitive.ObjectID, visibility string) bson.D {
+	doc := bson.D{
+		{Key: "_id", Value: id},
+		{Key: "name", Value: "Waltz"},
+		{Key: "filename", Value: "waltz.glb"},
+		{Key: "userId", Value: owner},
+		{Key: "visibility", Value: visibility},
+		{Key: "createdAt", Value: time.Now()},
+	}
+	if !team.IsZero() {
+		doc = append(doc, bson.E{Key: "teamId", Value: team})
+	}
+	return doc
+}
+
+// lastModelsFilter возвращает фильтр последнего запроса к коллекции моделей
+func lastModelsFilter(t *testing.T, mt *mtest.T) bson.M {
+	t.Helper()
+	finds := sentCommands(mt, "find", "models")
+	require.NotEmpty(t, finds)
+	return decodeRaw(t, finds[len(finds)-1].Lookup("filter").Document())
+}
+
+// TestModelLibraryVisibility проверяет, какие модели попадают в личную библиотеку
+func TestModelLibraryVisibility(t *testing.T) {
+	userID := primitive.NewObjectID()
+	teamID := primitive.NewObjectID()
+
+	runWithMockDB(t, "all scopes", func(mt *mtest.T) {
+		router, cfg := newTestRouter(t, routes.RegisterModelRoutes)
+		mt.AddMockResponses(
+			mockCursor("teams", bson.D{{Key: "_id", Value: teamID}}),
+			mockCursor("models", modelDoc(primitive.NewObjectID(), userID, primitive.NilObjectID, models.ModelVisibilityPrivate)),
+		)
+
+		w := serveJSON(t, router, http.MethodGet, "/api/models", testToken(t, cfg, userID), nil)
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		assert.Contains(t, w.Body.String(), "/uploads/models/waltz.glb")
+
+		filter := lastModelsFilter(t, mt)
+		visibility := filter["$or"].(primitive.A)
+		require.Len(t, visibility, 3)
+		assert.Equal(t, bson.M{"userId": userID}, visibility[0])
+		assert.Equal(t, bson.M{"visibility": models.ModelVisibilityPublic}, visibility[1])
+		assert.Equal(t, bson.M{
+			"visibility": models.ModelVisibilityTeam,
+			"teamId":     bson.M{"$in": primitive.A{teamID}},
+		}, visibility[2])
+	})
+
+	runWithMockDB(t, "team filter keeps visibility", func(mt *mtest.T) {
+		router, cfg := newTestRouter(t, routes.RegisterModelRoutes)
+		otherTeam := primitive.NewObjectID()
+		mt.AddMockResponses(mockCursor("teams"), mockCursor("models"))
+
+		w := serveJSON(t, router, http.MethodGet, "/api/models?teamId="+otherTeam.Hex(), testToken(t, cfg, userID), nil)
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+		filter := lastModelsFilter(t, mt)
+		assert.Equal(t, otherTeam, filter["teamId"])
+		// Без членства в команде остаются только свои и публичные модели
+		assert.Len(t, filter["$or"], 2)
+	})
+
+	runWithMockDB(t, "invalid scope", func(mt *mtest.T) {
+		router, cfg := newTestRouter(t, routes.RegisterModelRoutes)
+		mt.AddMockResponses(mockCursor("teams"))
+
+		w := serveJSON(t, router, http.MethodGet, "/api/models?scope=everything", testToken(t, cfg, userID), nil)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Empty(t, sentCommands(mt, "find", "models"))
+	})
+}
+
+// TestModelLibrarySearch проверяет поиск по тексту и тегам
+func TestModelLibrarySearch(t *testing.T) {
+	userID := primitive.NewObjectID()
+
+	runWithMockDB(t, "search and tags", func(mt *mtest.T) {
+		router, cfg := newTestRouter(t, routes.RegisterModelRoutes)
+		mt.AddMockResponses(mockCursor("teams"), mockCursor("models"))
+
+		w := serveJSON(t, router, http.MethodGet, "/api/models?scope=mine&search=Waltz.&tag=Ballroom,%20solo&tag=ballroom",
+			testToken(t, cfg, userID), nil)
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+		filter := lastModelsFilter(t, mt)
+		assert.Equal(t, bson.M{"$all": primitive.A{"ballroom", "solo"}}, filter["tags"])
+		assert.NotContains(t, filter, "$or")
+
+		and := filter["$and"].(primitive.A)
+		require.Len(t, and, 2)
+		assert.Equal(t, bson.M{"$or": primitive.A{bson.M{"userId": userID}}}, and[0])
+		search := and[1].(bson.M)["$or"].(primitive.A)
+		require.Len(t, search, 4)
+		assert.Equal(t, bson.M{"name": bson.M{"$regex": `Waltz\.`, "$options": "i"}}, search[0])
+		assert.Equal(t, bson.M{"tags": "waltz."}, search[3])
+	})
+}
+
+// TestTeamModelLibrary проверяет библиотеку команды
+func TestTeamModelLibrary(t *testing.T) {
+	userID := primitive.NewObjectID()
+	teamID := primitive.NewObjectID()
+	team := bson.D{{Key: "_id", Value: teamID}, {Key: "owner", Value: userID}}
+
+	runWithMockDB(t, "team models", func(mt *mtest.T) {
+		router, cfg := newTestRouter(t, routes.RegisterTeamRoutes)
+		mt.AddMockResponses(
+			mockCursor("teams", team),
+			mockCursor("models", modelDoc(primitive.NewObjectID(), primitive.NewObjectID(), teamID, models.ModelVisibilityTeam)),
+		)
+
+		w := serveJSON(t, router, http.MethodGet, "/api/teams/"+teamID.Hex()+"/models?search=waltz&teamId="+teamID.Hex(),
+			testToken(t, cfg, userID), nil)
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+		filter := lastModelsFilter(t, mt)
+		assert.Equal(t, models.ModelVisibilityTeam, filter["visibility"])
+		assert.Equal(t, teamID, filter["teamId"])
+		assert.Len(t, filter["$or"], 4)
+	})
+
+	runWithMockDB(t, "other team in query", func(mt *mtest.T) {
+		router, cfg := newTestRouter(t, routes.RegisterTeamRoutes)
+		mt.AddMockResponses(mockCursor("teams", team))
+
+		w := serveJSON(t, router, http.MethodGet, "/api/teams/"+teamID.Hex()+"/models?teamId="+primitive.NewObjectID().Hex(),
+			testToken(t, cfg, userID), nil)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Empty(t, sentCommands(mt, "find", "models"))
+	})
+}
+
+// TestModelSharing проверяет смену видимости модели
+func TestModelSharing(t *testing.T) {
+	ownerID := primitive.NewObjectID()
+	teamID := primitive.NewObjectID()
+	modelID := primitive.NewObjectID()
+	path := "/api/models/" + modelID.Hex()
+	private := modelDoc(modelID, ownerID, primitive.NilObjectID, models.ModelVisibilityPrivate)
+
+	runWithMockDB(t, "share with team", func(mt *mtest.T) {
+		router, cfg := newTestRouter(t, routes.RegisterModelRoutes)
+		mt.AddMockResponses(
+			mockCursor("models", private),
+			mockCount("teams", 1),
+			mockWrite(1, 1),
+			mockCursor("models", modelDoc(modelID, ownerID, teamID, models.ModelVisibilityTeam)),
+		)
+
+		w := serveJSON(t, router, http.MethodPut, path, testToken(t, cfg, ownerID),
+			gin.H{"visibility": models.ModelVisibilityTeam, "teamId": teamID.Hex(), "tags": []string{" Solo ", "solo"}})
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+		updates := sentCommands(mt, "update", "models")
+		require.Len(t, updates, 1)
+		update := decodeRaw(t, updates[0].Lookup("updates", "0", "u").Document())
+		set := update["$set"].(bson.M)
+		assert.Equal(t, models.ModelVisibilityTeam, set["visibility"])
+		assert.Equal(t, teamID, set["teamId"])
+		assert.Equal(t, primitive.A{"solo"}, set["tags"])
+		assert.NotContains(t, update, "$unset")
+	})
+
+	runWithMockDB(t, "make private again", func(mt *mtest.T) {
+		router, cfg := newTestRouter(t, routes.RegisterModelRoutes)
+		mt.AddMockResponses(
+			mockCursor("models", modelDoc(modelID, ownerID, teamID, models.ModelVisibilityTeam)),
+			mockWrite(1, 1),
+			mockCursor("models", private),
+		)
+
+		w := serveJSON(t, router, http.MethodPut, path, testToken(t, cfg, ownerID),
+			gin.H{"visibility": models.ModelVisibilityPrivate})
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+		update := decodeRaw(t, sentCommands(mt, "update", "models")[0].Lookup("updates", "0", "u").Document())
+		assert.Equal(t, bson.M{"teamId": ""}, update["$unset"])
+	})
+
+	runWithMockDB(t, "team of another user", func(mt *mtest.T) {
+		router, cfg := newTestRouter(t, routes.RegisterModelRoutes)
+		mt.AddMockResponses(mockCursor("models", private), mockCount("teams", 0))
+
+		w := serveJSON(t, router, http.MethodPut, path, testToken(t, cfg, ownerID),
+			gin.H{"visibility": models.ModelVisibilityTeam, "teamId": teamID.Hex()})
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Empty(t, sentCommands(mt, "update", "models"))
+	})
+
+	runWithMockDB(t, "not the owner", func(mt *mtest.T) {
+		router, cfg := newTestRouter(t, routes.RegisterModelRoutes)
+		mt.AddMockResponses(mockCursor("models", private))
+
+		w := serveJSON(t, router, http.MethodPut, path, testToken(t, cfg, primitive.NewObjectID()),
+			gin.H{"visibility": models.ModelVisibilityPublic})
+		assert.Equal(t, http.StatusForbidden, w.Code)
+		assert.Empty(t, sentCommands(mt, "update", "models"))
+	})
+}
+
+// TestModelReadThroughProject проверяет доступ к модели через проекты, которые на неё ссылаются
+func TestModelReadThroughProject(t *testing.T) {
+	ownerID := primitive.NewObjectID()
+	readerID := primitive.NewObjectID()
+	modelID := primitive.NewObjectID()
+	path := "/api/models/" + modelID.Hex()
+	private := modelDoc(modelID, ownerID, primitive.NilObjectID, models.ModelVisibilityPrivate)
+
+	// projectsFilter возвращает фильтр поиска проектов со ссылкой на модель
+	projectsFilter := func(t *testing.T, mt *mtest.T) bson.M {
+		finds := sentCommands(mt, "find", "projects")
+		require.Len(t, finds, 1)
+		return decodeRaw(t, finds[0].Lookup("filter").Document())
+	}
+
+	runWithMockDB(t, "project of the model owner", func(mt *mtest.T) {
+		router, cfg := newTestRouter(t, routes.RegisterModelRoutes)
+		project := publicProjectDoc(primitive.NewObjectID(), ownerID)
+		mt.AddMockResponses(mockCursor("models", private), mockCursor("projects", project))
+
+		w := serveJSON(t, router, http.MethodGet, path, testToken(t, cfg, readerID), nil)
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		assert.Equal(t, primitive.A{bson.M{"owner": ownerID}}, projectsFilter(t, mt)["$or"])
+	})
+
+	runWithMockDB(t, "own project does not grant access", func(mt *mtest.T) {
+		router, cfg := newTestRouter(t, routes.RegisterModelRoutes)
+		// Проект читателя со ссылкой на чужую модель не проходит фильтр по владельцу
+		mt.AddMockResponses(mockCursor("models", private), mockCursor("projects"))
+
+		w := serveJSON(t, router, http.MethodGet, path, testToken(t, cfg, readerID), nil)
+		assert.Equal(t, http.StatusForbidden, w.Code)
+		owners := projectsFilter(t, mt)["$or"].(primitive.A)
+		assert.NotContains(t, owners, bson.M{"owner": readerID})
+	})
+
+	runWithMockDB(t, "project models list", func(mt *mtest.T) {
+		router, cfg := newTestRouter(t, routes.RegisterProjectRoutes)
+		projectID := primitive.NewObjectID()
+		projectOwner := primitive.NewObjectID()
+		project := append(publicProjectDoc(projectID, projectOwner), bson.E{Key: "glbAnimations", Value: bson.A{
+			bson.D{{Key: "url", Value: "/uploads/models/waltz.glb"}},
+		}})
+		mt.AddMockResponses(mockCursor("projects", project), mockCursor("projects", project), mockCursor("models"))
+
+		w := serveJSON(t, router, http.MethodGet, "/api/projects/"+projectID.Hex()+"/models", testToken(t, cfg, readerID), nil)
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		filter := lastModelsFilter(t, mt)
+		assert.Equal(t, primitive.A{
+			bson.M{"userId": projectOwner},
+			bson.M{"visibility": models.ModelVisibilityPublic},
+		}, filter["$or"])
+	})
+}
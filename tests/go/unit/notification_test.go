@@ -0,0 +1,66 @@
+package unit
+
+import (
+	"testing"
+
+	"github.com/kktjss/dance-flow/models"
+	"github.com/kktjss/dance-flow/notify"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// TestNotificationPreferences проверяет, что неуказанные типы включены
+func TestNotificationPreferences(t *testing.T) {
+	var empty models.NotificationPreferences
+	assert.True(t, empty.Enabled(models.NotificationMention))
+
+	prefs := models.NotificationPreferences{models.NotificationTeamProjectUpdated: false}
+	assert.False(t, prefs.Enabled(models.NotificationTeamProjectUpdated))
+	assert.True(t, prefs.Enabled(models.NotificationTeamMemberAdded))
+	assert.Equal(t, models.NotificationPreferences{
+		models.NotificationTeamMemberAdded:    true,
+		models.NotificationTeamProjectUpdated: false,
+		models.NotificationMention:            true,
+	}, prefs.Resolved())
+
+	assert.NoError(t, models.ValidateNotificationPreferences(prefs))
+	assert.Error(t, models.ValidateNotificationPreferences(models.NotificationPreferences{"digest": true}))
+}
+
+// TestHubPublish проверяет доставку уведомлений в потоки получателя
+func TestHubPublish(t *testing.T) {
+	hub := notify.NewHub()
+	anna, boris := primitive.NewObjectID(), primitive.NewObjectID()
+
+	first, closeFirst := hub.Subscribe(anna)
+	second, closeSecond := hub.Subscribe(anna)
+	other, closeOther := hub.Subscribe(boris)
+	defer closeOther()
+	assert.Equal(t, 2, hub.Streams(anna))
+
+	hub.Publish(models.Notification{UserID: anna, Message: "hello"})
+	for _, stream := range []<-chan models.Notification{first, second} {
+		select {
+		case n := <-stream:
+			assert.Equal(t, "hello", n.Message)
+		default:
+			t.Fatal("notification was not delivered")
+		}
+	}
+	assert.Len(t, other, 0)
+
+	closeFirst()
+	closeFirst()
+	assert.Equal(t, 1, hub.Streams(anna))
+	closeSecond()
+	assert.Equal(t, 0, hub.Streams(anna))
+
+	// Переполненный поток не блокирует отправку
+	slow, closeSlow := hub.Subscribe(boris)
+	defer closeSlow()
+	for i := 0; i < 100; i++ {
+		hub.Publish(models.Notification{UserID: boris})
+	}
+	require.NotEmpty(t, slow)
+}
@@ -0,0 +1,130 @@
+package unit
+
+import (
+	"math"
+	"testing"
+
+	"github.com/kktjss/dance-flow/models"
+	"github.com/kktjss/dance-flow/poseanalysis"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// armPose создает позу COCO, где оба локтя согнуты на угол elbow (в градусах)
+func armPose(elbow float64) []models.Joint {
+	skeleton, _ := models.GetSkeleton(models.SkeletonCOCO17)
+	positions := map[string][2]float64{
+		"left_shoulder":  {0.4, 0.3},
+		"right_shoulder": {0.6, 0.3},
+		"left_elbow":     {0.4, 0.45},
+		"right_elbow":    {0.6, 0.45},
+		"left_hip":       {0.42, 0.6},
+		"right_hip":      {0.58, 0.6},
+		"left_knee":      {0.42, 0.75},
+		"right_knee":     {0.58, 0.75},
+		"left_ankle":     {0.42, 0.9},
+		"right_ankle":    {0.58, 0.9},
+	}
+	// Предплечье поворачивается относительно направления на плечо
+	rad := elbow * math.Pi / 180
+	positions["left_wrist"] = [2]float64{0.4 - 0.15*math.Sin(rad), 0.45 - 0.15*math.Cos(rad)}
+	positions["right_wrist"] = [2]float64{0.6 + 0.15*math.Sin(rad), 0.45 - 0.15*math.Cos(rad)}
+
+	joints := make([]models.Joint, len(skeleton.Joints))
+	for i, name := range skeleton.Joints {
+		joints[i] = models.Joint{Name: name}
+		if p, ok := positions[name]; ok {
+			joints[i].X, joints[i].Y, joints[i].Visibility = p[0], p[1], 1
+		}
+	}
+	return joints
+}
+
+// armSequence создает последовательность, где угол локтя меняется по функции времени
+func armSequence(duration, fps float64, elbowAt func(t float64) float64) *models.PoseSequence {
+	sequence := &models.PoseSequence{Skeleton: models.SkeletonCOCO17}
+	for i := 0; float64(i) <= duration*fps; i++ {
+		t := float64(i) / fps
+		sequence.Frames = append(sequence.Frames, models.PoseFrame{Time: t, Joints: armPose(elbowAt(t))})
+	}
+	return sequence
+}
+
+// TestFrameAngles проверяет вычисление угла в локте
+func TestFrameAngles(t *testing.T) {
+	skeleton, _ := models.GetSkeleton(models.SkeletonCOCO17)
+	angles := poseanalysis.FrameAngles(armPose(90), skeleton, 1)
+	require.Len(t, angles, len(poseanalysis.Angles))
+	assert.InDelta(t, 90, angles[0], 1e-6)
+	assert.InDelta(t, 90, angles[1], 1e-6)
+	assert.InDelta(t, 180, angles[6], 1e-6, "Прямая нога")
+
+	joints := armPose(90)
+	joints[skeleton.JointIndex("left_wrist")].Visibility = 0
+	angles = poseanalysis.FrameAngles(joints, skeleton, 1)
+	assert.True(t, math.IsNaN(angles[0]), "Невидимый сустав не участвует в расчёте")
+}
+
+// TestAlign проверяет выравнивание DTW
+func TestAlign(t *testing.T) {
+	a := []float64{0, 1, 2, 3, 2, 1, 0}
+	b := []float64{0, 0, 1, 1, 2, 2, 3, 3, 2, 2, 1, 1, 0, 0}
+	dist := func(i, j int) float64 { return math.Abs(a[i] - b[j]) }
+
+	path, total := poseanalysis.Align(len(a), len(b), 2, dist)
+	assert.Zero(t, total, "Растянутая во времени копия выравнивается без потерь")
+	assert.Equal(t, poseanalysis.Pair{I: 0, J: 0}, path[0])
+	assert.Equal(t, poseanalysis.Pair{I: len(a) - 1, J: len(b) - 1}, path[len(path)-1])
+	for k := 1; k < len(path); k++ {
+		di, dj := path[k].I-path[k-1].I, path[k].J-path[k-1].J
+		assert.True(t, di >= 0 && dj >= 0 && di+dj > 0 && di <= 1 && dj <= 1, "Путь монотонный и непрерывный")
+	}
+}
+
+// TestCompare проверяет оценку сходства и поиск отклонений
+func TestCompare(t *testing.T) {
+	reference := armSequence(4, 10, func(t float64) float64 { return 90 + 60*math.Sin(t*math.Pi/2) })
+
+	t.Run("Та же хореография медленнее", func(t *testing.T) {
+		slower := armSequence(6, 10, func(t float64) float64 { return 90 + 60*math.Sin(t/1.5*math.Pi/2) })
+		result, err := poseanalysis.Compare(slower, reference, poseanalysis.CompareOptions{})
+		require.NoError(t, err)
+		assert.Greater(t, result.Score, 95.0)
+		require.Len(t, result.Sections, 1)
+		assert.Equal(t, "full", result.Sections[0].Name)
+	})
+
+	t.Run("Ошибка во второй секции", func(t *testing.T) {
+		wrong := armSequence(4, 10, func(t float64) float64 {
+			if t >= 2 && t <= 3 {
+				return 20
+			}
+			return 90 + 60*math.Sin(t*math.Pi/2)
+		})
+		result, err := poseanalysis.Compare(wrong, reference, poseanalysis.CompareOptions{
+			Sections: []poseanalysis.Section{
+				{Name: "A", Start: 0, End: 1.9},
+				{Name: "B", Start: 2, End: 4},
+			},
+			TopDeviations: 3,
+		})
+		require.NoError(t, err)
+		require.Len(t, result.Sections, 2)
+		assert.Greater(t, result.Sections[0].Score, 95.0)
+		assert.Less(t, result.Sections[1].Score, result.Sections[0].Score)
+
+		require.NotEmpty(t, result.Deviations)
+		worst := result.Deviations[0]
+		assert.GreaterOrEqual(t, worst.Time, 2.0)
+		assert.LessOrEqual(t, worst.Time, 3.0)
+		assert.Contains(t, []string{"left_elbow", "right_elbow"}, worst.Angles[0].Angle)
+		for i := 1; i < len(result.Deviations); i++ {
+			assert.GreaterOrEqual(t, math.Abs(result.Deviations[i].Time-worst.Time), 0.5, "Отклонения не должны повторять один момент")
+		}
+	})
+
+	t.Run("Пустая последовательность", func(t *testing.T) {
+		_, err := poseanalysis.Compare(&models.PoseSequence{Skeleton: models.SkeletonCOCO17}, reference, poseanalysis.CompareOptions{})
+		assert.Error(t, err)
+	})
+}
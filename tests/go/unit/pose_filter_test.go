@@ -0,0 +1,137 @@
+package unit
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/kktjss/dance-flow/models"
+	"github.com/kktjss/dance-flow/poseanalysis"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// noisyFrames создает кадры с одним суставом, движущимся по синусоиде с шумом
+func noisyFrames(count int, noise float64) ([]models.PoseFrame, []float64) {
+	rng := rand.New(rand.NewSource(1))
+	frames := make([]models.PoseFrame, count)
+	truth := make([]float64, count)
+	for i := range frames {
+		t := float64(i) / 30
+		truth[i] = 0.5 + 0.1*math.Sin(t*2)
+		frames[i] = models.PoseFrame{
+			Time: t,
+			Joints: []models.Joint{{
+				Name:       "nose",
+				X:          truth[i] + rng.NormFloat64()*noise,
+				Y:          0.3,
+				Visibility: 0.9,
+			}},
+		}
+	}
+	return frames, truth
+}
+
+func rmsError(frames []models.PoseFrame, truth []float64) float64 {
+	sum := 0.0
+	for i, frame := range frames {
+		d := frame.Joints[0].X - truth[i]
+		sum += d * d
+	}
+	return math.Sqrt(sum / float64(len(frames)))
+}
+
+// TestNormalizeFilterParams проверяет значения по умолчанию и отклонение неверных параметров
+func TestNormalizeFilterParams(t *testing.T) {
+	params := models.PoseFilterParams{}
+	require.NoError(t, poseanalysis.NormalizeFilterParams(&params))
+	assert.Equal(t, models.SmoothingOneEuro, params.Smoothing)
+	assert.Positive(t, params.MinCutoff)
+	assert.Positive(t, params.MaxGap)
+	require.NotNil(t, params.MaxVelocity)
+	assert.Positive(t, *params.MaxVelocity)
+	require.NotNil(t, params.MinVisibility)
+	assert.Equal(t, poseanalysis.MinVisibility, *params.MinVisibility)
+
+	tests := []struct {
+		name   string
+		params models.PoseFilterParams
+	}{
+		{name: "Неизвестный метод", params: models.PoseFilterParams{Smoothing: "median"}},
+		{name: "Отрицательный параметр", params: models.PoseFilterParams{Beta: -1}},
+		{name: "Слишком длинный пропуск", params: models.PoseFilterParams{MaxGap: 60}},
+		{name: "Порог видимости больше 1", params: models.PoseFilterParams{MinVisibility: floatPtr(1.5)}},
+		{name: "Отрицательная скорость", params: models.PoseFilterParams{MaxVelocity: floatPtr(-1)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Error(t, poseanalysis.NormalizeFilterParams(&tt.params))
+		})
+	}
+}
+
+// TestFilterFrames_Smoothing проверяет, что оба фильтра уменьшают дрожание
+func TestFilterFrames_Smoothing(t *testing.T) {
+	frames, truth := noisyFrames(300, 0.01)
+	before := rmsError(frames, truth)
+
+	for _, smoothing := range []string{models.SmoothingOneEuro, models.SmoothingKalman} {
+		t.Run(smoothing, func(t *testing.T) {
+			params := models.PoseFilterParams{Smoothing: smoothing}
+			require.NoError(t, poseanalysis.NormalizeFilterParams(&params))
+
+			filtered, report := poseanalysis.FilterFrames(frames, params)
+			require.Len(t, filtered, len(frames))
+			assert.Equal(t, len(frames), report.SamplesSmoothed)
+			assert.Less(t, rmsError(filtered, truth), before*0.8)
+		})
+	}
+
+	assert.Equal(t, before, rmsError(frames, truth), "Исходные кадры не должны меняться")
+}
+
+// TestFilterFrames_GapsAndOutliers проверяет отбраковку выбросов и заполнение пропусков
+func TestFilterFrames_GapsAndOutliers(t *testing.T) {
+	frames, _ := noisyFrames(60, 0)
+	frames[10].Joints[0].X = 0.95 // скачок за кадр - выброс
+	for i := 20; i < 25; i++ {
+		frames[i].Joints[0].Visibility = 0 // короткий пропуск
+	}
+	for i := 40; i < 58; i++ {
+		frames[i].Joints[0].Visibility = 0 // длинный пропуск
+	}
+
+	params := models.PoseFilterParams{Smoothing: models.SmoothingNone, MaxGap: 0.3}
+	require.NoError(t, poseanalysis.NormalizeFilterParams(&params))
+	filtered, report := poseanalysis.FilterFrames(frames, params)
+
+	assert.Equal(t, 1, report.OutliersRemoved)
+	assert.Equal(t, 6, report.GapsFilled, "Заполняются выброс и короткий пропуск")
+
+	assert.InDelta(t, (frames[9].Joints[0].X+frames[11].Joints[0].X)/2, filtered[10].Joints[0].X, 1e-9)
+	assert.Greater(t, filtered[22].Joints[0].Visibility, 0.0)
+	assert.Zero(t, filtered[45].Joints[0].Visibility, "Длинный пропуск не заполняется")
+}
+
+// TestFilterFrames_DisabledThresholds проверяет, что явный 0 отключает
+// отбраковку выбросов и порог видимости
+func TestFilterFrames_DisabledThresholds(t *testing.T) {
+	frames, _ := noisyFrames(30, 0)
+	frames[10].Joints[0].X = 0.95
+	frames[20].Joints[0].Visibility = 0.1
+
+	params := models.PoseFilterParams{Smoothing: models.SmoothingNone, MaxVelocity: floatPtr(0), MinVisibility: floatPtr(0)}
+	require.NoError(t, poseanalysis.NormalizeFilterParams(&params))
+	assert.Zero(t, *params.MaxVelocity)
+	assert.Zero(t, *params.MinVisibility)
+
+	filtered, report := poseanalysis.FilterFrames(frames, params)
+	assert.Zero(t, report.OutliersRemoved)
+	assert.Zero(t, report.GapsFilled)
+	assert.Equal(t, 0.95, filtered[10].Joints[0].X)
+	assert.Equal(t, 0.1, filtered[20].Joints[0].Visibility)
+}
+
+func floatPtr(v float64) *float64 {
+	return &v
+}
@@ -0,0 +1,210 @@
+package unit
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/kktjss/dance-flow/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// analyzerResponse повторяет формат ответа Python сервера /process-frame
+const analyzerResponse = `{
+	"frame_width": 1280,
+	"frame_height": 720,
+	"num_poses": 1,
+	"poses": [{
+		"landmarks": [
+			{"x": 0.5, "y": 0.2, "z": -0.1, "visibility": 0.99},
+			{"x": 0.51, "y": 0.19, "z": -0.1, "visibility": 0.98}
+		],
+		"visibility_score": 0.9
+	}]
+}`
+
+// TestPoseData_ParseAnalyzerResponse проверяет разбор ответа анализатора
+func TestPoseData_ParseAnalyzerResponse(t *testing.T) {
+	var pd models.PoseData
+	require.NoError(t, json.Unmarshal([]byte(analyzerResponse), &pd))
+	require.NoError(t, pd.Validate())
+
+	assert.Equal(t, models.PoseSchemaVersion, pd.SchemaVersion)
+	assert.Equal(t, models.SkeletonMediaPipe33, pd.Skeleton)
+	assert.Equal(t, 1280, pd.FrameWidth)
+	require.Len(t, pd.Poses, 1)
+	require.Len(t, pd.Poses[0].Joints, 33, "Отсутствующие суставы должны быть дополнены")
+
+	nose, ok := pd.Poses[0].Joint("nose")
+	require.True(t, ok)
+	assert.InDelta(t, 0.5, nose.X, 1e-9)
+
+	ankle, ok := pd.Poses[0].Joint("left_ankle")
+	require.True(t, ok)
+	assert.Zero(t, ankle.Visibility)
+}
+
+// TestPoseData_Validate проверяет отклонение некорректных данных
+func TestPoseData_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    models.PoseData
+		wantErr bool
+	}{
+		{
+			name: "Корректная поза COCO",
+			data: models.PoseData{
+				Skeleton: models.SkeletonCOCO17,
+				Poses:    []models.Pose{{Joints: []models.Joint{{Name: "nose", X: 0.4, Y: 0.3, Visibility: 1}}}},
+			},
+		},
+		{
+			name:    "Неизвестный скелет",
+			data:    models.PoseData{Skeleton: "openpose-25"},
+			wantErr: true,
+		},
+		{
+			name:    "Будущая версия схемы",
+			data:    models.PoseData{SchemaVersion: models.PoseSchemaVersion + 1},
+			wantErr: true,
+		},
+		{
+			name:    "Отрицательная версия схемы",
+			data:    models.PoseData{SchemaVersion: -1},
+			wantErr: true,
+		},
+		{
+			name: "Сустав не из скелета",
+			data: models.PoseData{
+				Skeleton: models.SkeletonCOCO17,
+				Poses:    []models.Pose{{Joints: []models.Joint{{Name: "left_heel", X: 0.4, Y: 0.3}}}},
+			},
+			wantErr: true,
+		},
+		{
+			name: "Видимость вне диапазона",
+			data: models.PoseData{
+				Poses: []models.Pose{{Joints: []models.Joint{{Name: "nose", X: 0.4, Y: 0.3, Visibility: 1.5}}}},
+			},
+			wantErr: true,
+		},
+		{
+			name: "Координаты в пикселях вместо нормализованных",
+			data: models.PoseData{
+				Poses: []models.Pose{{Joints: []models.Joint{{Name: "nose", X: 640, Y: 360}}}},
+			},
+			wantErr: true,
+		},
+		{
+			name: "Повторяющийся индекс человека",
+			data: models.PoseData{
+				Poses: []models.Pose{{PersonIndex: 1}, {PersonIndex: 1}},
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.data.Validate()
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+// TestPoseData_BSONRoundTrip проверяет компактное хранение в MongoDB
+func TestPoseData_BSONRoundTrip(t *testing.T) {
+	var pd models.PoseData
+	require.NoError(t, json.Unmarshal([]byte(analyzerResponse), &pd))
+	require.NoError(t, pd.Validate())
+
+	keyframe := models.Keyframe{Label: "test", PoseData: &pd}
+	data, err := bson.Marshal(keyframe)
+	require.NoError(t, err)
+
+	var decoded models.Keyframe
+	require.NoError(t, bson.Unmarshal(data, &decoded))
+	require.NotNil(t, decoded.PoseData)
+	require.Len(t, decoded.PoseData.Poses, 1)
+	assert.Equal(t, pd.FrameHeight, decoded.PoseData.FrameHeight)
+
+	for i, joint := range pd.Poses[0].Joints {
+		got := decoded.PoseData.Poses[0].Joints[i]
+		assert.Equal(t, joint.Name, got.Name)
+		assert.InDelta(t, joint.X, got.X, 1e-6)
+		assert.InDelta(t, joint.Visibility, got.Visibility, 1e-6)
+	}
+}
+
+// TestPoseData_LegacyBSON проверяет чтение старых документов с произвольным poseData
+func TestPoseData_LegacyBSON(t *testing.T) {
+	legacy := bson.M{
+		"label": "old",
+		"poseData": bson.A{
+			bson.M{"x": 0.3, "y": 0.4, "z": 0.0, "visibility": 0.8},
+		},
+	}
+	data, err := bson.Marshal(legacy)
+	require.NoError(t, err)
+
+	var decoded models.Keyframe
+	require.NoError(t, bson.Unmarshal(data, &decoded))
+	require.NotNil(t, decoded.PoseData)
+	require.Len(t, decoded.PoseData.Poses, 1)
+	assert.InDelta(t, 0.3, decoded.PoseData.Poses[0].Joints[0].X, 1e-9)
+}
+
+// TestPoseData_ParseTyped проверяет распознавание типизированной схемы
+func TestPoseData_ParseTyped(t *testing.T) {
+	// Без schemaVersion схема распознаётся по joints, а не читается как ответ анализатора
+	pd, err := models.ParsePoseData([]byte(`{"skeleton":"coco-17","poses":[{"personIndex":0,"joints":[{"name":"nose","x":0.4,"y":0.3,"visibility":1}]}]}`))
+	require.NoError(t, err)
+	require.Len(t, pd.Poses, 1)
+	require.Len(t, pd.Poses[0].Joints, 1)
+	assert.Equal(t, "nose", pd.Poses[0].Joints[0].Name)
+	require.NoError(t, pd.Validate())
+	assert.Equal(t, models.PoseSchemaVersion, pd.SchemaVersion)
+
+	for _, version := range []string{"0", "-1", "null"} {
+		_, err := models.ParsePoseData([]byte(`{"schemaVersion":` + version + `,"poses":[]}`))
+		assert.Error(t, err, version)
+	}
+}
+
+// TestPoseData_LegacyBSONInvalid проверяет, что нераспознанный старый poseData
+// возвращает ошибку, а не пустые позы
+func TestPoseData_LegacyBSONInvalid(t *testing.T) {
+	data, err := bson.Marshal(bson.M{"label": "old", "poseData": "broken"})
+	require.NoError(t, err)
+
+	var decoded models.Keyframe
+	assert.Error(t, bson.Unmarshal(data, &decoded))
+}
+
+// TestPoseData_ConvertSkeleton проверяет преобразование между форматами скелета
+func TestPoseData_ConvertSkeleton(t *testing.T) {
+	var pd models.PoseData
+	require.NoError(t, json.Unmarshal([]byte(analyzerResponse), &pd))
+	require.NoError(t, pd.Validate())
+	pd.Poses[0].Joints[27] = models.Joint{Name: "left_ankle", X: 0.45, Y: 0.9, Visibility: 0.7}
+
+	coco, err := pd.ConvertSkeleton(models.SkeletonCOCO17)
+	require.NoError(t, err)
+	require.Len(t, coco.Poses[0].Joints, 17)
+	ankle, ok := coco.Poses[0].Joint("left_ankle")
+	require.True(t, ok)
+	assert.InDelta(t, 0.9, ankle.Y, 1e-9)
+
+	back, err := coco.ConvertSkeleton(models.SkeletonMediaPipe33)
+	require.NoError(t, err)
+	require.Len(t, back.Poses[0].Joints, 33)
+	heel, ok := back.Poses[0].Joint("left_heel")
+	require.True(t, ok)
+	assert.InDelta(t, 0.9, heel.Y, 1e-9, "Пятка приближается лодыжкой")
+	assert.Zero(t, heel.Visibility, "Приближённый сустав помечается невидимым")
+}
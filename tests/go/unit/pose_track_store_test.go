@@ -0,0 +1,185 @@
+package unit
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kktjss/dance-flow/models"
+	"github.com/kktjss/dance-flow/posetrack"
+	"github.com/kktjss/dance-flow/routes"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+// chunkDoc кодирует кадры в документ блока трека
+func chunkDoc(t *testing.T, trackID primitive.ObjectID, frames []models.PoseFrame) bson.D {
+	data, err := posetrack.Encode(frames)
+	require.NoError(t, err)
+	return bson.D{
+		{Key: "_id", Value: primitive.NewObjectID()},
+		{Key: "trackId", Value: trackID},
+		{Key: "startTime", Value: frames[0].Time},
+		{Key: "endTime", Value: frames[len(frames)-1].Time},
+		{Key: "frameCount", Value: len(frames)},
+		{Key: "data", Value: primitive.Binary{Data: data}},
+	}
+}
+
+// mockTrackStats - ответ агрегации статистики трека
+func mockTrackStats(frameCount int32, start, end float64) bson.D {
+	return mockCursor("poseTrackChunks", bson.D{
+		{Key: "_id", Value: nil},
+		{Key: "frameCount", Value: frameCount},
+		{Key: "startTime", Value: start},
+		{Key: "endTime", Value: end},
+	})
+}
+
+// mockStoredTrack - ответ findAndModify с сохранённым документом трека
+func mockStoredTrack(trackID primitive.ObjectID, frameCount int32) bson.D {
+	return mtest.CreateSuccessResponse(bson.E{Key: "value", Value: bson.D{
+		{Key: "_id", Value: trackID},
+		{Key: "skeleton", Value: models.SkeletonCOCO17},
+		{Key: "frameCount", Value: frameCount},
+	}})
+}
+
+// TestPoseTrack_AppendFrames проверяет, какие блоки перепаковываются при дописывании
+// и что запись идёт под блокировкой трека
+func TestPoseTrack_AppendFrames(t *testing.T) {
+	trackID := primitive.NewObjectID()
+	newTrack := func() *models.PoseTrack {
+		return &models.PoseTrack{ID: trackID, Skeleton: models.SkeletonCOCO17}
+	}
+
+	runWithMockDB(t, "full previous chunk is kept", func(mt *mtest.T) {
+		previous := chunkDoc(t, trackID, makeTrackFrames(t, posetrack.ChunkSize, 0))
+		mt.AddMockResponses(
+			mockWrite(1, 1),
+			mockCursor("poseTrackChunks"),
+			mockCursor("poseTrackChunks", previous),
+			mtest.CreateSuccessResponse(),
+			mockTrackStats(posetrack.ChunkSize+30, 0, 21),
+			mockStoredTrack(trackID, posetrack.ChunkSize+30),
+			mockWrite(1, 1),
+		)
+
+		track := newTrack()
+		require.NoError(t, posetrack.AppendFrames(context.Background(), track, makeTrackFrames(t, 30, 20)))
+		assert.Equal(t, posetrack.ChunkSize+30, track.FrameCount)
+
+		// Полный блок не удаляется и не перепаковывается
+		assert.Empty(t, sentCommands(mt, "delete", "poseTrackChunks"))
+		finds := sentCommands(mt, "find", "poseTrackChunks")
+		require.Len(t, finds, 2)
+		last := decodeRaw(t, finds[1])
+		assert.Equal(t, bson.M{"endTime": int32(-1)}, last["sort"])
+		assert.EqualValues(t, 1, last["limit"])
+
+		updates := sentCommands(mt, "update", "poseTracks")
+		require.Len(t, updates, 2)
+		lock := decodeRaw(t, updates[0].Lookup("updates", "0").Document())
+		assert.Contains(t, lock["q"], "$or")
+		token := lock["u"].(bson.M)["$set"].(bson.M)["appendLock"]
+		unlock := decodeRaw(t, updates[1].Lookup("updates", "0").Document())
+		assert.Equal(t, token, unlock["q"].(bson.M)["appendLock"])
+		assert.Contains(t, unlock["u"], "$unset")
+	})
+
+	runWithMockDB(t, "incomplete previous chunk is merged", func(mt *mtest.T) {
+		previous := chunkDoc(t, trackID, makeTrackFrames(t, 100, 0))
+		mt.AddMockResponses(
+			mockWrite(1, 1),
+			mockCursor("poseTrackChunks"),
+			mockCursor("poseTrackChunks", previous),
+			mtest.CreateSuccessResponse(),
+			mockWrite(1, 1),
+			mockTrackStats(130, 0, 5),
+			mockStoredTrack(trackID, 130),
+			mockWrite(1, 1),
+		)
+
+		require.NoError(t, posetrack.AppendFrames(context.Background(), newTrack(), makeTrackFrames(t, 30, 4)))
+
+		deletes := sentCommands(mt, "delete", "poseTrackChunks")
+		require.Len(t, deletes, 1)
+		filter := decodeRaw(t, deletes[0].Lookup("deletes", "0", "q").Document())
+		assert.Equal(t, bson.M{"$in": primitive.A{previous.Map()["_id"]}}, filter["_id"])
+	})
+
+	runWithMockDB(t, "busy track", func(mt *mtest.T) {
+		mt.AddMockResponses(
+			mockWrite(0, 0),
+			mockCount("poseTracks", 1),
+			mockWrite(1, 1),
+			mockCursor("poseTrackChunks"),
+			mockCursor("poseTrackChunks"),
+			mtest.CreateSuccessResponse(),
+			mockTrackStats(30, 0, 1),
+			mockStoredTrack(trackID, 30),
+			mockWrite(1, 1),
+		)
+
+		require.NoError(t, posetrack.AppendFrames(context.Background(), newTrack(), makeTrackFrames(t, 30, 0)))
+		assert.Len(t, sentCommands(mt, "update", "poseTracks"), 3)
+	})
+
+	runWithMockDB(t, "deleted track", func(mt *mtest.T) {
+		mt.AddMockResponses(mockWrite(0, 0), mockCount("poseTracks", 0))
+
+		err := posetrack.AppendFrames(context.Background(), newTrack(), makeTrackFrames(t, 30, 0))
+		assert.ErrorIs(t, err, posetrack.ErrTrackNotFound)
+		assert.Empty(t, sentCommands(mt, "find", "poseTrackChunks"))
+	})
+}
+
+// TestPoseTrackRoutes проверяет ответ записи кадров и границы окна чтения
+func TestPoseTrackRoutes(t *testing.T) {
+	projectID := primitive.NewObjectID()
+	trackID := primitive.NewObjectID()
+	path := "/api/projects/" + projectID.Hex() + "/pose-tracks/" + trackID.Hex() + "/frames"
+	track := bson.D{
+		{Key: "_id", Value: trackID},
+		{Key: "projectId", Value: projectID},
+		{Key: "skeleton", Value: models.SkeletonCOCO17},
+		{Key: "frameCount", Value: 0},
+	}
+
+	runWithMockDB(t, "write returns stored track", func(mt *mtest.T) {
+		router, cfg := newTestRouter(t, routes.RegisterPoseTrackRoutes)
+		mt.AddMockResponses(
+			mockCount("projects", 1),
+			mockCursor("poseTracks", track),
+			mockWrite(1, 1),
+			mockCursor("poseTrackChunks"),
+			mockCursor("poseTrackChunks"),
+			mtest.CreateSuccessResponse(),
+			mockTrackStats(30, 0, 1),
+			mockStoredTrack(trackID, 30),
+			mockWrite(1, 1),
+		)
+
+		w := serveJSON(t, router, http.MethodPost, path, testToken(t, cfg, primitive.NewObjectID()),
+			gin.H{"frames": makeTrackFrames(t, 30, 0)})
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		var response models.PoseTrack
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		assert.Equal(t, 30, response.FrameCount)
+	})
+
+	for _, query := range []string{"from=NaN", "to=NaN", "to=Inf"} {
+		runWithMockDB(t, query, func(mt *mtest.T) {
+			router, cfg := newTestRouter(t, routes.RegisterPoseTrackRoutes)
+			mt.AddMockResponses(mockCursor("projects", publicProjectDoc(projectID, primitive.NewObjectID())))
+
+			w := serveJSON(t, router, http.MethodGet, path+"?"+query, testToken(t, cfg, primitive.NewObjectID()), nil)
+			assert.Equal(t, http.StatusBadRequest, w.Code, w.Body.String())
+		})
+	}
+}
@@ -0,0 +1,130 @@
+package unit
+
+import (
+	"testing"
+
+	"github.com/kktjss/dance-flow/models"
+	"github.com/kktjss/dance-flow/posetrack"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// makeTrackFrames создаёт кадры с плавно движущимися суставами (30 fps)
+func makeTrackFrames(t *testing.T, count int, start float64) []models.PoseFrame {
+	skeleton, err := models.GetSkeleton(models.SkeletonCOCO17)
+	require.NoError(t, err)
+
+	frames := make([]models.PoseFrame, count)
+	for f := range frames {
+		joints := make([]models.Joint, len(skeleton.Joints))
+		for i, name := range skeleton.Joints {
+			joints[i] = models.Joint{
+				Name:       name,
+				X:          0.3 + 0.001*float64(f) + 0.01*float64(i),
+				Y:          0.5 - 0.0005*float64(f),
+				Z:          -0.1,
+				Visibility: 0.9,
+			}
+		}
+		frames[f] = models.PoseFrame{Time: start + float64(f)/30, Joints: joints}
+	}
+	return frames
+}
+
+// TestPoseTrack_EncodeDecode проверяет сжатие и восстановление кадров
+func TestPoseTrack_EncodeDecode(t *testing.T) {
+	skeleton, err := models.GetSkeleton(models.SkeletonCOCO17)
+	require.NoError(t, err)
+	frames := makeTrackFrames(t, 300, 1.5)
+
+	data, err := posetrack.Encode(frames)
+	require.NoError(t, err)
+	assert.Less(t, len(data), len(frames)*len(skeleton.Joints)*4*8/4, "Данные должны сжиматься")
+
+	decoded, err := posetrack.Decode(data, skeleton)
+	require.NoError(t, err)
+	require.Len(t, decoded, len(frames))
+
+	for f := range frames {
+		assert.InDelta(t, frames[f].Time, decoded[f].Time, 1e-3)
+		for i, joint := range frames[f].Joints {
+			got := decoded[f].Joints[i]
+			assert.Equal(t, joint.Name, got.Name)
+			assert.InDelta(t, joint.X, got.X, 1e-4)
+			assert.InDelta(t, joint.Y, got.Y, 1e-4)
+			assert.InDelta(t, joint.Visibility, got.Visibility, 1e-3)
+		}
+	}
+}
+
+// TestPoseTrack_DecodeCorrupted проверяет отказ на повреждённых данных
+func TestPoseTrack_DecodeCorrupted(t *testing.T) {
+	skeleton, err := models.GetSkeleton(models.SkeletonCOCO17)
+	require.NoError(t, err)
+
+	_, err = posetrack.Decode([]byte("garbage"), skeleton)
+	assert.Error(t, err)
+
+	data, err := posetrack.Encode(makeTrackFrames(t, 10, 0))
+	require.NoError(t, err)
+	_, err = posetrack.Decode(data[:len(data)/2], skeleton)
+	assert.Error(t, err)
+}
+
+// TestPoseTrack_Merge проверяет, что новые кадры заменяют кадры с тем же временем
+func TestPoseTrack_Merge(t *testing.T) {
+	existing := makeTrackFrames(t, 10, 0)
+	incoming := makeTrackFrames(t, 5, 8.0/30)
+	for i := range incoming {
+		incoming[i].Joints[0].X = 0.99
+	}
+
+	merged := posetrack.Merge(existing, incoming)
+	require.Len(t, merged, 13)
+	for i := 1; i < len(merged); i++ {
+		assert.Less(t, merged[i-1].Time, merged[i].Time)
+	}
+	assert.InDelta(t, 0.3, merged[0].Joints[0].X, 1e-9)
+	assert.InDelta(t, 0.99, merged[8].Joints[0].X, 1e-9)
+}
+
+// TestPoseTrack_Downsample проверяет прореживание для обзора
+func TestPoseTrack_Downsample(t *testing.T) {
+	frames := makeTrackFrames(t, 1000, 0)
+
+	tests := []struct {
+		name      string
+		maxFrames int
+		wantLen   int
+	}{
+		{name: "Прореживание до 100 кадров", maxFrames: 100, wantLen: 100},
+		{name: "Лимит больше числа кадров", maxFrames: 5000, wantLen: 1000},
+		{name: "Один кадр", maxFrames: 1, wantLen: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := posetrack.Downsample(frames, tt.maxFrames)
+			require.Len(t, result, tt.wantLen)
+			assert.Equal(t, frames[0].Time, result[0].Time)
+			if tt.wantLen > 1 {
+				assert.Equal(t, frames[len(frames)-1].Time, result[len(result)-1].Time)
+			}
+		})
+	}
+}
+
+// TestPoseTrack_SplitAndRange проверяет разбиение на блоки и выборку по времени
+func TestPoseTrack_SplitAndRange(t *testing.T) {
+	frames := makeTrackFrames(t, 1300, 0)
+
+	chunks := posetrack.Split(frames, posetrack.ChunkSize)
+	require.Len(t, chunks, 3)
+	assert.Len(t, chunks[2], 100)
+
+	window := posetrack.Range(frames, 1.0, 2.0)
+	require.NotEmpty(t, window)
+	assert.GreaterOrEqual(t, window[0].Time, 1.0)
+	assert.LessOrEqual(t, window[len(window)-1].Time, 2.0)
+	assert.Len(t, window, 31)
+}
@@ -0,0 +1,230 @@
+package unit
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/kktjss/dance-flow/bundle"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// buildBundle создает архив проекта с данными, медиафайлом и манифестом
+func buildBundle(t *testing.T) []byte {
+	var buf bytes.Buffer
+	w := bundle.NewWriter(&buf, "64b7f0c2a1b2c3d4e5f60718", "Вальс")
+	require.NoError(t, w.WriteJSON("project.json", map[string]interface{}{"name": "Вальс"}))
+	require.NoError(t, w.WriteFile("pose_tracks/a.ptk", strings.NewReader("frames")))
+	require.NoError(t, w.WriteMedia("/uploads/audio/1.mp3", bundle.MediaPath("/uploads/audio/1.mp3"), strings.NewReader("music")))
+	assert.Error(t, w.WriteFile("project.json", strings.NewReader("again")), "повторный путь должен отклоняться")
+	require.NoError(t, w.Close())
+	return buf.Bytes()
+}
+
+// rewriteBundle пересобирает архив, позволяя изменить файлы и манифест
+func rewriteBundle(t *testing.T, data []byte, change func(name string, content []byte) []byte) []byte {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		require.NoError(t, err)
+		content, err := io.ReadAll(rc)
+		rc.Close()
+		require.NoError(t, err)
+
+		content = change(f.Name, content)
+		if content == nil {
+			continue
+		}
+		out, err := zw.Create(f.Name)
+		require.NoError(t, err)
+		_, err = out.Write(content)
+		require.NoError(t, err)
+	}
+	require.NoError(t, zw.Close())
+	return buf.Bytes()
+}
+
+func changeManifest(t *testing.T, change func(m *bundle.Manifest)) func(string, []byte) []byte {
+	return func(name string, content []byte) []byte {
+		if name != bundle.ManifestPath {
+			return content
+		}
+		var manifest bundle.Manifest
+		require.NoError(t, json.Unmarshal(content, &manifest))
+		change(&manifest)
+		content, err := json.Marshal(manifest)
+		require.NoError(t, err)
+		return content
+	}
+}
+
+// TestBundleRoundTrip проверяет запись и чтение архива с манифестом и контрольными суммами
+func TestBundleRoundTrip(t *testing.T) {
+	data := buildBundle(t)
+
+	archive, err := bundle.Open(bytes.NewReader(data), int64(len(data)))
+	require.NoError(t, err)
+	assert.Equal(t, bundle.Format, archive.Manifest.Format)
+	assert.Equal(t, bundle.Version, archive.Manifest.Version)
+	assert.Equal(t, "64b7f0c2a1b2c3d4e5f60718", archive.Manifest.ProjectID)
+	require.Len(t, archive.Manifest.Files, 3)
+	assert.Equal(t, []bundle.MediaEntry{{URL: "/uploads/audio/1.mp3", Path: "media/audio/1.mp3"}}, archive.Manifest.Media)
+	assert.Equal(t, []string{"pose_tracks/a.ptk"}, archive.Paths("pose_tracks/"))
+
+	var project map[string]interface{}
+	require.NoError(t, archive.ReadJSON("project.json", &project))
+	assert.Equal(t, "Вальс", project["name"])
+
+	rc, err := archive.Open("media/audio/1.mp3")
+	require.NoError(t, err)
+	content, _ := io.ReadAll(rc)
+	rc.Close()
+	assert.Equal(t, "music", string(content))
+
+	assert.False(t, archive.Has(bundle.ManifestPath))
+	_, err = archive.Open("missing.json")
+	assert.ErrorIs(t, err, bundle.ErrInvalidBundle)
+}
+
+// TestBundleValidation проверяет отклонение поврежденных и несовместимых архивов
+func TestBundleValidation(t *testing.T) {
+	data := buildBundle(t)
+
+	tests := []struct {
+		name   string
+		change func(string, []byte) []byte
+		err    error
+	}{
+		{
+			name: "Измененный файл",
+			change: func(name string, content []byte) []byte {
+				if name == "pose_tracks/a.ptk" {
+					return []byte("frameZ")
+				}
+				return content
+			},
+			err: bundle.ErrChecksumMismatch,
+		},
+		{
+			name: "Нет манифеста",
+			change: func(name string, content []byte) []byte {
+				if name == bundle.ManifestPath {
+					return nil
+				}
+				return content
+			},
+			err: bundle.ErrInvalidBundle,
+		},
+		{
+			name: "Нет файла из манифеста",
+			change: func(name string, content []byte) []byte {
+				if name == "project.json" {
+					return nil
+				}
+				return content
+			},
+			err: bundle.ErrInvalidBundle,
+		},
+		{
+			name:   "Новая версия",
+			change: changeManifest(t, func(m *bundle.Manifest) { m.Version = bundle.Version + 1 }),
+			err:    bundle.ErrUnsupportedVersion,
+		},
+		{
+			name:   "Чужой формат",
+			change: changeManifest(t, func(m *bundle.Manifest) { m.Format = "other" }),
+			err:    bundle.ErrInvalidBundle,
+		},
+		{
+			name:   "Файл не описан в манифесте",
+			change: changeManifest(t, func(m *bundle.Manifest) { m.Files = m.Files[1:] }),
+			err:    bundle.ErrInvalidBundle,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			changed := rewriteBundle(t, data, tt.change)
+			_, err := bundle.Open(bytes.NewReader(changed), int64(len(changed)))
+			assert.ErrorIs(t, err, tt.err)
+		})
+	}
+
+	_, err := bundle.Open(strings.NewReader("not a zip"), 9)
+	assert.ErrorIs(t, err, bundle.ErrInvalidBundle)
+}
+
+// TestBundleSizeLimits проверяет, что архив с огромными распакованными
+// размерами отклоняется по заголовкам, без распаковки
+func TestBundleSizeLimits(t *testing.T) {
+	build := func(sizes ...uint64) []byte {
+		var buf bytes.Buffer
+		zw := zip.NewWriter(&buf)
+		for i, size := range sizes {
+			// Заголовок заявляет size байт, а сжатых данных почти нет
+			w, err := zw.CreateRaw(&zip.FileHeader{
+				Name:               fmt.Sprintf("pose_tracks/%d.ptk", i),
+				Method:             zip.Deflate,
+				CompressedSize64:   2,
+				UncompressedSize64: size,
+			})
+			require.NoError(t, err)
+			_, err = w.Write([]byte{0x03, 0x00})
+			require.NoError(t, err)
+		}
+		require.NoError(t, zw.Close())
+		return buf.Bytes()
+	}
+
+	tests := []struct {
+		name  string
+		sizes []uint64
+	}{
+		{name: "Слишком большой файл", sizes: []uint64{bundle.MaxEntrySize + 1}},
+		{name: "Слишком большой архив", sizes: []uint64{bundle.MaxEntrySize, bundle.MaxEntrySize, bundle.MaxEntrySize, bundle.MaxEntrySize, 1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := build(tt.sizes...)
+			_, err := bundle.Open(bytes.NewReader(data), int64(len(data)))
+			assert.ErrorIs(t, err, bundle.ErrInvalidBundle)
+			assert.NotContains(t, err.Error(), "manifest")
+		})
+	}
+}
+
+// TestBundleMediaURLs проверяет поиск ссылок на файлы и их подмену
+func TestBundleMediaURLs(t *testing.T) {
+	data := []byte(`{"videoUrl":"/uploads/videos/17.mp4","audioUrl":"http://localhost:5000/uploads/audio/18.mp3",` +
+		`"glbAnimations":[{"url":"/api/uploads/models/a-b.glb"}],"keyframesJson":"{\"el\":[{\"modelPath\":\"/models/file/c.glb\"}]}",` +
+		`"other":"/uploads/videos/../secret","again":"/uploads/videos/17.mp4"}`)
+
+	urls := bundle.MediaURLs(data)
+	assert.Equal(t, []string{"/models/file/c.glb", "/uploads/audio/18.mp3", "/uploads/models/a-b.glb", "/uploads/videos/17.mp4"}, urls)
+
+	assert.Equal(t, "uploads/models/c.glb", bundle.LocalPath("/models/file/c.glb"))
+	assert.Equal(t, "uploads/videos/17.mp4", bundle.LocalPath("/uploads/videos/17.mp4"))
+	assert.Equal(t, "media/models/c.glb", bundle.MediaPath("/models/file/c.glb"))
+
+	assert.True(t, bundle.IsMediaURL("/uploads/audio/18.mp3"))
+	assert.False(t, bundle.IsMediaURL("/uploads/audio/../../etc/passwd"))
+	assert.False(t, bundle.IsMediaURL("/etc/passwd"))
+
+	replaced := bundle.Replace(data, map[string]string{
+		"/uploads/videos/17.mp4": "/uploads/videos/99.mp4",
+		"/models/file/c.glb":     "/models/file/d.glb",
+		"":                       "ignored",
+	})
+	assert.Contains(t, string(replaced), `"videoUrl":"/uploads/videos/99.mp4"`)
+	assert.Contains(t, string(replaced), `"again":"/uploads/videos/99.mp4"`)
+	assert.Contains(t, string(replaced), `\"modelPath\":\"/models/file/d.glb\"`)
+	assert.NotContains(t, string(replaced), "ignored")
+}
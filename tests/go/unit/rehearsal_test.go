@@ -0,0 +1,122 @@
+package unit
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kktjss/dance-flow/ical"
+	"github.com/kktjss/dance-flow/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// TestRehearsalValidate проверяет время, повестку и приглашённых репетиции
+func TestRehearsalValidate(t *testing.T) {
+	start := time.Date(2024, 5, 10, 18, 0, 0, 0, time.FixedZone("MSK", 3*3600))
+	end := start.Add(2 * time.Hour)
+	memberID := primitive.NewObjectID()
+	rehearsal := models.Rehearsal{ID: "r1"}
+	input := models.RehearsalInput{
+		Title:   " Прогон ",
+		Start:   &start,
+		End:     &end,
+		Invited: []string{memberID.Hex(), memberID.Hex()},
+	}
+	require.NoError(t, input.Apply(&rehearsal))
+	require.NoError(t, rehearsal.Validate())
+	assert.Equal(t, "Прогон", rehearsal.Title)
+	assert.Equal(t, time.UTC, rehearsal.Start.Location())
+	assert.Equal(t, []primitive.ObjectID{memberID}, rehearsal.Invited)
+	assert.NotNil(t, rehearsal.Agenda)
+	assert.True(t, rehearsal.IsInvited(memberID))
+	assert.False(t, rehearsal.IsInvited(primitive.NewObjectID()))
+
+	// Пустой список приглашённых - вся команда
+	assert.True(t, (&models.Rehearsal{}).IsInvited(primitive.NewObjectID()))
+
+	bad := "nope"
+	assert.Error(t, (&models.RehearsalInput{Invited: []string{bad}}).Apply(&rehearsal))
+	assert.Error(t, (&models.Rehearsal{Title: "Backwards", Start: end, End: start}).Validate())
+	assert.Error(t, (&models.Rehearsal{Title: "Marathon", Start: start, End: start.Add(25 * time.Hour)}).Validate())
+	assert.Error(t, (&models.Rehearsal{Title: " ", Start: start, End: end}).Validate())
+	assert.Error(t, (&models.Rehearsal{Title: "No project", Start: start, End: end,
+		Agenda: []models.RehearsalItem{{SectionID: "s1"}}}).Validate())
+}
+
+// TestRehearsalResponses проверяет, что ответы и отметки заменяют прежние
+func TestRehearsalResponses(t *testing.T) {
+	userID := primitive.NewObjectID()
+	editorID := primitive.NewObjectID()
+	at := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	rehearsal := models.Rehearsal{}
+
+	require.NoError(t, rehearsal.SetRSVP(userID, models.RSVPMaybe, "", at))
+	require.NoError(t, rehearsal.SetRSVP(userID, models.RSVPGoing, " опоздаю ", at.Add(time.Hour)))
+	require.Len(t, rehearsal.Responses, 1)
+	assert.Equal(t, models.RSVPGoing, rehearsal.Responses[0].Status)
+	assert.Equal(t, "опоздаю", rehearsal.Responses[0].Comment)
+	assert.Error(t, rehearsal.SetRSVP(userID, "yes", "", at))
+
+	require.NoError(t, rehearsal.MarkAttendance(userID, models.AttendanceAbsent, editorID, at))
+	require.NoError(t, rehearsal.MarkAttendance(userID, models.AttendanceLate, editorID, at))
+	require.Len(t, rehearsal.Attendance, 1)
+	assert.Equal(t, models.AttendanceLate, rehearsal.Attendance[0].Status)
+	assert.Equal(t, editorID, rehearsal.Attendance[0].MarkedBy)
+	assert.Error(t, rehearsal.MarkAttendance(userID, "sick", editorID, at))
+}
+
+// TestCalendarToken проверяет, что хеш токена воспроизводим и не равен токену
+func TestCalendarToken(t *testing.T) {
+	token, hash, err := models.NewCalendarToken()
+	require.NoError(t, err)
+	assert.Len(t, token, 64)
+	assert.NotEqual(t, token, hash)
+	assert.Equal(t, hash, models.HashCalendarToken(token))
+
+	other, _, err := models.NewCalendarToken()
+	require.NoError(t, err)
+	assert.NotEqual(t, token, other)
+}
+
+// TestICalWrite проверяет экранирование, перенос строк и статус событий
+func TestICalWrite(t *testing.T) {
+	start := time.Date(2024, 5, 10, 15, 0, 0, 0, time.UTC)
+	now := time.Date(2024, 5, 1, 9, 30, 0, 0, time.UTC)
+	var out bytes.Buffer
+	err := ical.Write(&out, ical.Calendar{
+		Name: "Студия",
+		Events: []ical.Event{{
+			UID:         "r1@dance-flow",
+			Summary:     "Прогон; финал, поклон",
+			Description: "- Вальс: Кода\n\n" + strings.Repeat("Повторить связку. ", 10),
+			Location:    "Зал 2",
+			Start:       start,
+			End:         start.Add(2 * time.Hour),
+			Status:      ical.StatusCancelled,
+			Updated:     now,
+			Sequence:    3,
+		}},
+	}, now)
+	require.NoError(t, err)
+
+	text := out.String()
+	assert.True(t, strings.HasPrefix(text, "BEGIN:VCALENDAR\r\n"))
+	assert.True(t, strings.HasSuffix(text, "END:VCALENDAR\r\n"))
+	assert.Contains(t, text, "X-WR-CALNAME:Студия\r\n")
+	assert.Contains(t, text, "DTSTART:20240510T150000Z\r\n")
+	assert.Contains(t, text, "STATUS:CANCELLED\r\n")
+	assert.Contains(t, text, "SEQUENCE:3\r\n")
+	assert.Contains(t, text, `SUMMARY:Прогон\; финал\, поклон`)
+
+	for _, line := range strings.Split(strings.TrimSuffix(text, "\r\n"), "\r\n") {
+		assert.LessOrEqual(t, len(line), 75, line)
+		assert.True(t, strings.ToValidUTF8(line, "") == line, "folded inside a character: %q", line)
+	}
+
+	// После снятия переносов описание восстанавливается целиком
+	unfolded := strings.ReplaceAll(text, "\r\n ", "")
+	assert.Contains(t, unfolded, `DESCRIPTION:- Вальс: Кода\n\nПовторить связку.`)
+}
@@ -0,0 +1,143 @@
+package unit
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/kktjss/dance-flow/models"
+	"github.com/kktjss/dance-flow/routes"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+// TestDancerValidate проверяет поля танцора и привязку к пользователю
+func TestDancerValidate(t *testing.T) {
+	height := 172.0
+	userID := primitive.NewObjectID().Hex()
+	dancer := models.Dancer{ID: "d1"}
+	input := models.DancerInput{Name: " Anna ", Height: &height, UserID: &userID}
+	require.NoError(t, input.Apply(&dancer))
+	require.NoError(t, dancer.Validate())
+	assert.Equal(t, "Anna", dancer.Name)
+	assert.Equal(t, models.DefaultDancerColor, dancer.Color)
+	require.NotNil(t, dancer.UserID)
+	assert.Equal(t, userID, dancer.UserID.Hex())
+
+	// Пустой userId отвязывает пользователя, остальные поля не меняются
+	unlink := ""
+	require.NoError(t, (&models.DancerInput{UserID: &unlink}).Apply(&dancer))
+	assert.Nil(t, dancer.UserID)
+	assert.Equal(t, 172.0, dancer.Height)
+
+	bad := "not-an-id"
+	assert.Error(t, (&models.DancerInput{UserID: &bad}).Apply(&dancer))
+	assert.Error(t, (&models.Dancer{Name: "Tall", Height: 300}).Validate())
+	assert.Error(t, (&models.Dancer{Name: "Color", Color: "blue"}).Validate())
+	assert.Error(t, (&models.Dancer{Name: "  "}).Validate())
+}
+
+// TestValidateCasting проверяет распределение ролей по составу
+func TestValidateCasting(t *testing.T) {
+	elements := []interface{}{
+		map[string]interface{}{"id": "e1"},
+		map[string]interface{}{"id": "e2"},
+	}
+	roster := []models.Dancer{{ID: "d1", Name: "Anna"}, {ID: "d2", Name: "Boris"}}
+
+	assert.NoError(t, models.ValidateCasting([]models.CastingEntry{
+		{ElementID: "e1", DancerID: "d2"},
+		{ElementID: "e2", DancerID: "d1"},
+	}, elements, roster))
+	assert.NoError(t, models.ValidateCasting(nil, elements, roster))
+
+	assert.Error(t, models.ValidateCasting([]models.CastingEntry{{ElementID: "e3", DancerID: "d1"}}, elements, roster))
+	assert.Error(t, models.ValidateCasting([]models.CastingEntry{{ElementID: "e1", DancerID: "d3"}}, elements, roster))
+	assert.Error(t, models.ValidateCasting([]models.CastingEntry{
+		{ElementID: "e1", DancerID: "d1"},
+		{ElementID: "e1", DancerID: "d2"},
+	}, elements, roster))
+	assert.Error(t, models.ValidateCasting([]models.CastingEntry{
+		{ElementID: "e1", DancerID: "d1"},
+		{ElementID: "e2", DancerID: "d1"},
+	}, elements, roster))
+}
+
+// TestProjectCastingRosterVisibility проверяет, что состав команды с ростом
+// и заметками виден только участникам команды публичного проекта
+func TestProjectCastingRosterVisibility(t *testing.T) {
+	userID := primitive.NewObjectID()
+	teamID := primitive.NewObjectID()
+	projectID := primitive.NewObjectID()
+	project := bson.D{
+		{Key: "_id", Value: projectID},
+		{Key: "name", Value: "Finale"},
+		{Key: "owner", Value: primitive.NewObjectID()},
+		{Key: "teamId", Value: teamID},
+		{Key: "isPrivate", Value: false},
+		{Key: "elements", Value: bson.A{bson.D{{Key: "id", Value: "el-1"}, {Key: "name", Value: "Lead"}}}},
+		{Key: "casting", Value: bson.A{bson.D{{Key: "elementId", Value: "el-1"}, {Key: "dancerId", Value: "d1"}}}},
+	}
+	team := bson.D{
+		{Key: "_id", Value: teamID},
+		{Key: "roster", Value: bson.A{bson.D{
+			{Key: "id", Value: "d1"},
+			{Key: "name", Value: "Anna"},
+			{Key: "color", Value: "#ff0000"},
+			{Key: "height", Value: 172.0},
+			{Key: "notes", Value: "knee injury"},
+			{Key: "userId", Value: primitive.NewObjectID()},
+		}}},
+	}
+	path := "/api/projects/" + projectID.Hex() + "/casting"
+
+	type castingResponse struct {
+		Casting []struct {
+			ElementID string         `json:"elementId"`
+			Dancer    *models.Dancer `json:"dancer"`
+		} `json:"casting"`
+		Roster []models.Dancer `json:"roster"`
+	}
+
+	for _, tc := range []struct {
+		name   string
+		member int32
+	}{
+		{"team member", 1},
+		{"reader of public project", 0},
+	} {
+		runWithMockDB(t, tc.name, func(mt *mtest.T) {
+			router, cfg := newTestRouter(t, routes.RegisterCastingRoutes)
+			mt.AddMockResponses(
+				mockCursor("projects", project),
+				mockCursor("projects", project),
+				mockCursor("teams", team),
+				mockCount("teams", tc.member),
+			)
+
+			w := serveJSON(t, router, http.MethodGet, path, testToken(t, cfg, userID), nil)
+			require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+			var response castingResponse
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+			require.Len(t, response.Casting, 1)
+			dancer := response.Casting[0].Dancer
+			require.NotNil(t, dancer)
+			assert.Equal(t, "Anna", dancer.Name)
+
+			if tc.member > 0 {
+				require.Len(t, response.Roster, 1)
+				assert.Equal(t, "knee injury", dancer.Notes)
+				return
+			}
+			assert.Nil(t, response.Roster)
+			assert.Equal(t, "#ff0000", dancer.Color)
+			assert.Zero(t, dancer.Height)
+			assert.Empty(t, dancer.Notes)
+			assert.Nil(t, dancer.UserID)
+		})
+	}
+}
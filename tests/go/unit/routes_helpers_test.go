@@ -0,0 +1,145 @@
+package unit
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/kktjss/dance-flow/config"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+// Вспомогательные функции для тестов обработчиков: маршруты поднимаются на
+// gin, а MongoDB заменяется заглушкой драйвера, которая отдаёт заранее
+// добавленные ответы и запоминает отправленные команды.
+
+// runWithMockDB выполняет тест с базой на заглушке mtest
+func runWithMockDB(t *testing.T, name string, callback func(mt *mtest.T)) {
+	t.Helper()
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	defer mt.Close()
+	if config.Logger == nil {
+		// Ошибки обработчиков пишутся в лог, файл логов тестам не нужен
+		config.Logger = log.New(io.Discard, "", 0)
+	}
+	mt.Run(name, func(mt *mtest.T) {
+		config.UseDatabase(mt.DB)
+		callback(mt)
+	})
+}
+
+// newTestRouter регистрирует маршруты под /api во временном каталоге, чтобы
+// каталоги загрузок не создавались рядом с тестами
+func newTestRouter(t *testing.T, register ...func(*gin.RouterGroup, *config.Config)) (*gin.Engine, *config.Config) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	wd, err := os.Getwd()
+	require.NoError(t, err)
+	require.NoError(t, os.Chdir(t.TempDir()))
+	defer os.Chdir(wd)
+
+	cfg := &config.Config{JWTSecret: "test-secret", JWTExpiration: "1h"}
+	router := gin.New()
+	api := router.Group("/api")
+	for _, r := range register {
+		r(api, cfg)
+	}
+	return router, cfg
+}
+
+// testToken подписывает токен пользователя так же, как при входе
+func testToken(t *testing.T, cfg *config.Config, userID primitive.ObjectID) string {
+	t.Helper()
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"id":  userID.Hex(),
+		"exp": time.Now().Add(time.Hour).Unix(),
+	}).SignedString([]byte(cfg.JWTSecret))
+	require.NoError(t, err)
+	return token
+}
+
+// serveJSON выполняет запрос к маршрутам; body кодируется в JSON
+func serveJSON(t *testing.T, router *gin.Engine, method, path, token string, body interface{}) *httptest.ResponseRecorder {
+	t.Helper()
+	var reader *bytes.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		require.NoError(t, err)
+		reader = bytes.NewReader(data)
+	} else {
+		reader = bytes.NewReader(nil)
+	}
+
+	req := httptest.NewRequest(method, path, reader)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+// publicProjectDoc - публичный проект владельца owner, который проходит проверку чтения
+func publicProjectDoc(id, owner primitive.ObjectID) bson.D {
+	return bson.D{
+		{Key: "_id", Value: id},
+		{Key: "name", Value: "Finale"},
+		{Key: "owner", Value: owner},
+		{Key: "isPrivate", Value: false},
+	}
+}
+
+// mockCursor - ответ на find или aggregate с одной порцией документов
+func mockCursor(collection string, docs ...bson.D) bson.D {
+	return mtest.CreateCursorResponse(0, "db."+collection, mtest.FirstBatch, docs...)
+}
+
+// mockCount - ответ на CountDocuments
+func mockCount(collection string, n int32) bson.D {
+	return mockCursor(collection, bson.D{{Key: "n", Value: n}})
+}
+
+// mockWrite - ответ на update или delete
+func mockWrite(matched, modified int32) bson.D {
+	return mtest.CreateSuccessResponse(
+		bson.E{Key: "n", Value: matched},
+		bson.E{Key: "nModified", Value: modified},
+	)
+}
+
+// sentCommands возвращает отправленные команды с указанным именем
+// ("find", "update", ...) для коллекции
+func sentCommands(mt *mtest.T, name, collection string) []bson.Raw {
+	var commands []bson.Raw
+	for _, e := range mt.GetAllStartedEvents() {
+		if e.CommandName != name {
+			continue
+		}
+		if coll, ok := e.Command.Lookup(name).StringValueOK(); ok && coll == collection {
+			commands = append(commands, e.Command)
+		}
+	}
+	return commands
+}
+
+// decodeRaw переводит документ команды в bson.M для проверок
+func decodeRaw(t *testing.T, raw bson.Raw) bson.M {
+	t.Helper()
+	var doc bson.M
+	require.NoError(t, bson.Unmarshal(raw, &doc))
+	return doc
+}
@@ -0,0 +1,128 @@
+package unit
+
+import (
+	"testing"
+
+	"github.com/kktjss/dance-flow/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestStageCanvasView проверяет перевод координат сцены в пиксели холста
+func TestStageCanvasView(t *testing.T) {
+	stage := models.Stage{Width: 10, Depth: 5}
+	require.NoError(t, stage.Validate())
+	assert.Equal(t, models.AudienceBottom, stage.AudienceSide)
+
+	// Сцена 10x5 м вписывается в холст 800x600 по ширине: 80 пикселей в метре
+	view := stage.Canvas(800, 600)
+	assert.InDelta(t, 80, view.Scale, 1e-9)
+	assert.InDelta(t, 100, view.Top, 1e-9)
+
+	// Центр авансцены - середина нижнего края сцены на холсте
+	assert.Equal(t, models.Position{X: 400, Y: 500}, view.ToCanvas(models.Position{X: 0, Y: 0}))
+	// Справа из зала и в глубине сцены - правый верхний угол
+	assert.Equal(t, models.Position{X: 800, Y: 100}, view.ToCanvas(models.Position{X: 5, Y: 5}))
+
+	tests := map[string]models.Position{
+		models.AudienceBottom: {X: 800, Y: 100},
+		models.AudienceTop:    {X: 0, Y: 500},
+		models.AudienceLeft:   {X: 550, Y: 600},
+		models.AudienceRight:  {X: 250, Y: 0},
+	}
+	for side, corner := range tests {
+		t.Run(side, func(t *testing.T) {
+			stage := models.Stage{Width: 10, Depth: 5, AudienceSide: side}
+			view := stage.Canvas(800, 600)
+			point := view.ToCanvas(models.Position{X: 5, Y: 5})
+			assert.InDelta(t, corner.X, point.X, 1e-9)
+			assert.InDelta(t, corner.Y, point.Y, 1e-9)
+
+			original := models.Position{X: -1.25, Y: 3.5}
+			back := view.ToStage(view.ToCanvas(original))
+			assert.InDelta(t, original.X, back.X, 1e-9)
+			assert.InDelta(t, original.Y, back.Y, 1e-9)
+		})
+	}
+}
+
+// TestStageValidate проверяет ограничения размеров сцены
+func TestStageValidate(t *testing.T) {
+	valid := models.DefaultStage()
+	require.NoError(t, valid.Validate())
+
+	invalid := []models.Stage{
+		{Width: 0, Depth: 5},
+		{Width: 10, Depth: -1},
+		{Width: 200, Depth: 5},
+		{Width: 10, Depth: 5, GridSpacing: -1},
+		{Width: 10, Depth: 5, GridSpacing: 20},
+		{Width: 10, Depth: 5, WingWidth: 60},
+		{Width: 10, Depth: 5, AudienceSide: "behind"},
+	}
+	for _, stage := range invalid {
+		assert.Error(t, stage.Validate(), "%+v", stage)
+	}
+}
+
+// TestStageElementsMigration проверяет перевод элементов из пикселей в метры и обратно
+func TestStageElementsMigration(t *testing.T) {
+	position := map[string]interface{}{"x": 380.0, "y": 280.0}
+	project := models.Project{Elements: []interface{}{
+		map[string]interface{}{
+			"id":       "circle-1",
+			"type":     "circle",
+			"position": position,
+			"size":     map[string]interface{}{"width": 40.0, "height": 40.0},
+			"keyframes": []interface{}{
+				// Элемент и первый ключевой кадр ссылаются на одну карту позиции
+				map[string]interface{}{"time": 0.0, "position": position},
+				map[string]interface{}{"time": 2.0, "position": map[string]interface{}{"x": 780.0, "y": 80.0}, "scale": 0.5},
+			},
+		},
+	}}
+	project.NormalizeElements()
+
+	stage := models.Stage{Width: 10, Depth: 5}
+	require.NoError(t, stage.Validate())
+	view := stage.Canvas(800, 600)
+	models.ElementsToStage(project.Elements, view)
+
+	element := project.Elements[0].(map[string]interface{})
+	assert.Equal(t, map[string]interface{}{"width": 0.5, "height": 0.5}, element["size"])
+	// Центр (400, 300) - середина сцены по ширине и на 2.5 м от авансцены
+	assert.Equal(t, map[string]interface{}{"x": 0.0, "y": 2.5}, element["position"])
+	keyframes := element["keyframes"].([]interface{})
+	assert.Equal(t, map[string]interface{}{"x": 0.0, "y": 2.5}, keyframes[0].(map[string]interface{})["position"])
+	// У уменьшенного вдвое элемента центр смещён на четверть размера; точка
+	// выше сцены на холсте переходит за её заднюю границу
+	second := keyframes[1].(map[string]interface{})["position"].(map[string]interface{})
+	assert.InDelta(t, 4.875, second["x"], 1e-9)
+	assert.InDelta(t, 5.125, second["y"], 1e-9)
+
+	models.ElementsToCanvas(project.Elements, view)
+	assert.Equal(t, map[string]interface{}{"width": 40.0, "height": 40.0}, element["size"])
+	assert.InDeltaMapValues(t, map[string]interface{}{"x": 380.0, "y": 280.0}, element["position"], 1e-9)
+	second = keyframes[1].(map[string]interface{})["position"].(map[string]interface{})
+	assert.InDeltaMapValues(t, map[string]interface{}{"x": 780.0, "y": 80.0}, second, 1e-9)
+}
+
+// TestStageElementDefaults проверяет значения по умолчанию в единицах проекта
+func TestStageElementDefaults(t *testing.T) {
+	stage := models.DefaultStage()
+	project := models.Project{
+		Units:    models.UnitsMetres,
+		Stage:    &stage,
+		Elements: []interface{}{map[string]interface{}{"id": "a", "type": "circle"}},
+	}
+	project.NormalizeElements()
+	element := project.Elements[0].(map[string]interface{})
+	assert.Equal(t, map[string]interface{}{"x": 0.0, "y": 4.0}, element["position"])
+	assert.Equal(t, map[string]interface{}{"width": 0.5, "height": 0.5}, element["size"])
+
+	legacy := models.Project{Elements: []interface{}{map[string]interface{}{"id": "a", "type": "circle"}}}
+	legacy.NormalizeElements()
+	element = legacy.Elements[0].(map[string]interface{})
+	assert.Equal(t, map[string]interface{}{"x": 100.0, "y": 100.0}, element["position"])
+	assert.False(t, legacy.UsesStageUnits())
+}
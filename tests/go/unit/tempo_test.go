@@ -0,0 +1,116 @@
+package unit
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/kktjss/dance-flow/models"
+	"github.com/kktjss/dance-flow/routes"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+// testTempoMap - 120 BPM 4/4 с первой долей на 0.5 с и 60 BPM 3/4 с третьего такта
+func testTempoMap(t *testing.T) *models.TempoMap {
+	tempoMap := &models.TempoMap{
+		BPM:     120,
+		Offset:  0.5,
+		Changes: []models.TempoChange{{Bar: 3, BPM: 60, BeatsPerBar: 3}},
+	}
+	require.NoError(t, tempoMap.Validate())
+	return tempoMap
+}
+
+// TestTempoPosition проверяет перевод секунд в такты и счёт и обратно
+func TestTempoPosition(t *testing.T) {
+	tempoMap := testTempoMap(t)
+	assert.Equal(t, 4, tempoMap.BeatsPerBar)
+	assert.Equal(t, 4, tempoMap.BeatUnit)
+	assert.Equal(t, 8, tempoMap.CountsPerPhrase)
+
+	// Третий такт начинается после восьми долей по 0.5 с
+	position := tempoMap.Position(4.5)
+	assert.InDelta(t, 8, position.Beat, 1e-9)
+	assert.Equal(t, 3, position.Bar)
+	assert.InDelta(t, 1, position.BeatInBar, 1e-9)
+	assert.Equal(t, 2, position.Eight)
+	assert.InDelta(t, 1, position.Count, 1e-9)
+	assert.Equal(t, 60.0, position.BPM)
+
+	position = tempoMap.Position(6)
+	assert.Equal(t, 3, position.Bar)
+	assert.InDelta(t, 2.5, position.BeatInBar, 1e-9)
+	assert.InDelta(t, 2.5, position.Count, 1e-9)
+
+	// До первой сильной доли - затакт
+	position = tempoMap.Position(0.25)
+	assert.Equal(t, 0, position.Bar)
+	assert.InDelta(t, 4.5, position.BeatInBar, 1e-9)
+	assert.Equal(t, 0, position.Eight)
+	assert.InDelta(t, 8.5, position.Count, 1e-9)
+
+	// Такт 4 в размере 3/4, доля 2
+	assert.InDelta(t, 8.5, tempoMap.SecondsAt(tempoMap.BarBeat(4, 2)), 1e-9)
+	// Третья восьмёрка, счёт 5
+	assert.InDelta(t, 16.5, tempoMap.PositionOfBeat(tempoMap.CountBeat(3, 5)).Seconds, 1e-9)
+	for _, seconds := range []float64{0, 1.3, 4.5, 7.25, 30} {
+		assert.InDelta(t, seconds, tempoMap.SecondsAt(tempoMap.BeatAt(seconds)), 1e-9)
+	}
+}
+
+// TestTempoSnap проверяет привязку ключевых кадров к счёту
+func TestTempoSnap(t *testing.T) {
+	tempoMap := testTempoMap(t)
+	assert.InDelta(t, 1.5, tempoMap.Snap(1.3, 1), 1e-9)
+	assert.InDelta(t, 1.25, tempoMap.Snap(1.3, 2), 1e-9)
+
+	elements := []interface{}{
+		map[string]interface{}{
+			"id": "a",
+			"keyframes": []interface{}{
+				map[string]interface{}{"time": 1.3, "label": "first"},
+				map[string]interface{}{"time": 1.4, "label": "second"},
+				map[string]interface{}{"time": 4.5},
+			},
+		},
+	}
+	assert.Equal(t, 2, tempoMap.SnapElementKeyframes(elements, 1))
+	keyframes := elements[0].(map[string]interface{})["keyframes"].([]interface{})
+	require.Len(t, keyframes, 2, "кадры на одном счёте объединяются")
+	assert.Equal(t, map[string]interface{}{"time": 1.5, "label": "second"}, keyframes[0])
+	assert.Equal(t, 4.5, keyframes[1].(map[string]interface{})["time"])
+}
+
+// TestTempoValidate проверяет ограничения карты темпа
+func TestTempoValidate(t *testing.T) {
+	invalid := []models.TempoMap{
+		{BPM: 0},
+		{BPM: 1000},
+		{BPM: 120, BeatsPerBar: 64},
+		{BPM: 120, BeatUnit: 3},
+		{BPM: 120, Offset: -1},
+		{BPM: 120, Changes: []models.TempoChange{{Bar: 1, BPM: 90}}},
+		{BPM: 120, Changes: []models.TempoChange{{Bar: 5, BPM: 90}, {Bar: 5, BPM: 100}}},
+		{BPM: 120, Changes: []models.TempoChange{{Bar: 5, BPM: 5}}},
+	}
+	for _, tempoMap := range invalid {
+		assert.Error(t, tempoMap.Validate(), "%+v", tempoMap)
+	}
+}
+
+// TestTempoGridBounds проверяет отклонение нечисловых границ сетки долей
+func TestTempoGridBounds(t *testing.T) {
+	projectID := primitive.NewObjectID()
+	for _, query := range []string{"from=NaN", "to=NaN", "from=-1", "to=Inf"} {
+		runWithMockDB(t, query, func(mt *mtest.T) {
+			router, cfg := newTestRouter(t, routes.RegisterTempoRoutes)
+			mt.AddMockResponses(mockCursor("projects", publicProjectDoc(projectID, primitive.NewObjectID())))
+
+			w := serveJSON(t, router, http.MethodGet, "/api/projects/"+projectID.Hex()+"/tempo/grid?"+query,
+				testToken(t, cfg, primitive.NewObjectID()), nil)
+			assert.Equal(t, http.StatusBadRequest, w.Code, w.Body.String())
+		})
+	}
+}
@@ -0,0 +1,124 @@
+package unit
+
+import (
+	"testing"
+
+	"github.com/kktjss/dance-flow/models"
+	"github.com/kktjss/dance-flow/timeline"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// timelineElement - элемент, идущий по x от 0 до 100 за первые 10 секунд
+func timelineElement() map[string]interface{} {
+	return map[string]interface{}{
+		"id": "dancer",
+		"keyframes": []interface{}{
+			map[string]interface{}{"time": 0.0, "position": map[string]interface{}{"x": 0.0, "y": 0.0}, "opacity": 1.0, "scale": 1.0},
+			map[string]interface{}{"time": 10.0, "position": map[string]interface{}{"x": 100.0, "y": 0.0}, "opacity": 1.0, "scale": 1.0},
+			map[string]interface{}{"time": 20.0, "position": map[string]interface{}{"x": 100.0, "y": 50.0}, "opacity": 0.5, "scale": 1.0},
+		},
+	}
+}
+
+func timelineTimes(element map[string]interface{}) []float64 {
+	times := []float64{}
+	for _, raw := range element["keyframes"].([]interface{}) {
+		times = append(times, raw.(map[string]interface{})["time"].(float64))
+	}
+	return times
+}
+
+func timelineX(element map[string]interface{}, index int) float64 {
+	kf := element["keyframes"].([]interface{})[index].(map[string]interface{})
+	return kf["position"].(map[string]interface{})["x"].(float64)
+}
+
+// TestTimelineCopyRange проверяет копирование движения с граничными кадрами
+func TestTimelineCopyRange(t *testing.T) {
+	element := timelineElement()
+	elements := []interface{}{element}
+
+	written, err := timeline.CopyRange(elements, 2, 4, 30)
+	require.NoError(t, err)
+	assert.Equal(t, 2, written)
+	assert.Equal(t, []float64{0, 10, 20, 30, 32}, timelineTimes(element))
+	assert.InDelta(t, 20, timelineX(element, 3), 1e-9)
+	assert.InDelta(t, 40, timelineX(element, 4), 1e-9)
+
+	// Копия поверх существующих кадров заменяет их
+	written, err = timeline.CopyRange(elements, 0, 10, 15)
+	require.NoError(t, err)
+	assert.Equal(t, 2, written)
+	assert.Equal(t, []float64{0, 10, 15, 25, 30, 32}, timelineTimes(element))
+
+	_, err = timeline.CopyRange(elements, 4, 2, 30)
+	assert.ErrorIs(t, err, timeline.ErrInvalidRange)
+}
+
+// TestTimelineRepeat проверяет повтор секции со сдвигом последующих кадров
+func TestTimelineRepeat(t *testing.T) {
+	element := timelineElement()
+	keyframes := element["keyframes"].([]interface{})
+	element["keyframes"] = append(keyframes, map[string]interface{}{
+		"time": 5.0, "position": map[string]interface{}{"x": 20.0, "y": 0.0}, "opacity": 1.0, "scale": 1.0,
+	})
+
+	written, err := timeline.Repeat([]interface{}{element}, 0, 10, 2, true)
+	require.NoError(t, err)
+	assert.Equal(t, 4, written)
+	assert.Equal(t, []float64{0, 5, 10, 15, 20, 25, 30, 40}, timelineTimes(element))
+	// Конец первого прохода сохраняется, повторы идут из него
+	assert.InDelta(t, 100, timelineX(element, 2), 1e-9)
+	assert.InDelta(t, 20, timelineX(element, 3), 1e-9)
+	assert.InDelta(t, 100, timelineX(element, 4), 1e-9)
+	assert.InDelta(t, 100, timelineX(element, 6), 1e-9)
+
+	_, err = timeline.Repeat([]interface{}{element}, 0, 10, timeline.MaxRepeats+1, false)
+	assert.ErrorIs(t, err, timeline.ErrRepeatCount)
+}
+
+// TestTimelineShift проверяет сдвиг кадров и разметки после отметки
+func TestTimelineShift(t *testing.T) {
+	element := timelineElement()
+	moved, err := timeline.Shift([]interface{}{element}, 10, 5)
+	require.NoError(t, err)
+	assert.Equal(t, 2, moved)
+	assert.Equal(t, []float64{0, 15, 25}, timelineTimes(element))
+
+	// Отрицательный сдвиг удаляет кадры перед отметкой
+	moved, err = timeline.Shift([]interface{}{element}, 25, -12)
+	require.NoError(t, err)
+	assert.Equal(t, 1, moved)
+	assert.Equal(t, []float64{0, 13}, timelineTimes(element))
+
+	_, err = timeline.Shift([]interface{}{element}, 5, -6)
+	assert.ErrorIs(t, err, timeline.ErrNegativeTime)
+
+	sections := []models.TimelineSection{
+		{ID: "intro", Start: 0, End: 10},
+		{ID: "verse", Start: 10, End: 20},
+		{ID: "bridge", Start: 6, End: 8},
+	}
+	cues := []models.TimelineCue{{ID: "lights", Time: 7}, {ID: "drop", Time: 12}}
+	sections, cues = timeline.ShiftMarkers(sections, cues, 10, -4)
+	require.Len(t, sections, 2)
+	assert.Equal(t, 6.0, sections[0].End)
+	assert.Equal(t, 6.0, sections[1].Start)
+	assert.Equal(t, 16.0, sections[1].End)
+	require.Len(t, cues, 1)
+	assert.Equal(t, 8.0, cues[0].Time)
+}
+
+// TestTimelineSectionValidate проверяет проверку секций и отметок
+func TestTimelineSectionValidate(t *testing.T) {
+	section := models.TimelineSection{Name: "  Chorus ", Start: 4, End: 12}
+	require.NoError(t, section.Validate())
+	assert.Equal(t, "Chorus", section.Name)
+	assert.Equal(t, models.DefaultSectionColor, section.Color)
+
+	assert.Error(t, (&models.TimelineSection{Name: "Bad", Start: 5, End: 5}).Validate())
+	assert.Error(t, (&models.TimelineSection{Start: 0, End: 1}).Validate())
+	assert.Error(t, (&models.TimelineSection{Name: "Bad", Start: 0, End: 1, Color: "red"}).Validate())
+	assert.Error(t, (&models.TimelineCue{Name: "Bad", Time: -1}).Validate())
+}
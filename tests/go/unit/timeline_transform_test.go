@@ -0,0 +1,168 @@
+package unit
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kktjss/dance-flow/routes"
+	"github.com/kktjss/dance-flow/timeline"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+// transformElement - элемент 20x20 с кадрами в 0, 10 и 20 секунд
+func transformElement(id string) map[string]interface{} {
+	element := timelineElement()
+	element["id"] = id
+	element["size"] = map[string]interface{}{"width": 20.0, "height": 20.0}
+	return element
+}
+
+func timelineY(element map[string]interface{}, index int) float64 {
+	kf := element["keyframes"].([]interface{})[index].(map[string]interface{})
+	return kf["position"].(map[string]interface{})["y"].(float64)
+}
+
+// TestTimelineTransformRetime проверяет сдвиг после момента и растяжение окна
+func TestTimelineTransformRetime(t *testing.T) {
+	element := transformElement("a")
+	from := 10.0
+	result, err := timeline.Apply([]interface{}{element}, timeline.Transform{
+		From:       &from,
+		Operations: []timeline.Operation{{Type: timeline.OpShift, By: 2}},
+	}, timeline.Point{})
+	require.NoError(t, err)
+	assert.Equal(t, 2, result.Keyframes)
+	assert.Equal(t, []float64{0, 12, 22}, timelineTimes(element))
+
+	// Растяжение первых 12 секунд вдвое сдвигает остальное
+	start, end := 0.0, 12.0
+	result, err = timeline.Apply([]interface{}{element}, timeline.Transform{
+		From:       &start,
+		To:         &end,
+		Ripple:     true,
+		Operations: []timeline.Operation{{Type: timeline.OpScale, Factor: 2}},
+	}, timeline.Point{})
+	require.NoError(t, err)
+	assert.Equal(t, 2, result.Keyframes)
+	assert.Equal(t, 1, result.Rippled)
+	assert.Equal(t, []float64{0, 24, 34}, timelineTimes(element))
+
+	// Сдвиг назад поглощает кадры, на место которых встаёт окно
+	result, err = timeline.Apply([]interface{}{element}, timeline.Transform{
+		From:       &end,
+		Operations: []timeline.Operation{{Type: timeline.OpShift, By: -24}},
+	}, timeline.Point{})
+	require.NoError(t, err)
+	assert.Equal(t, 1, result.Removed)
+	assert.Equal(t, []float64{0, 10}, timelineTimes(element))
+}
+
+// TestTimelineTransformSpatial проверяет отражение, поворот и перенос центров
+func TestTimelineTransformSpatial(t *testing.T) {
+	a, b := transformElement("a"), transformElement("b")
+	elements := []interface{}{a, b}
+
+	// Центры кадров a: (10,10), (110,10), (110,60)
+	center, ok := timeline.SelectionCenter(elements, timeline.Transform{ElementIDs: []string{"a"}})
+	require.True(t, ok)
+	assert.Equal(t, timeline.Point{X: 60, Y: 35}, center)
+
+	_, err := timeline.Apply(elements, timeline.Transform{
+		ElementIDs: []string{"a"},
+		Operations: []timeline.Operation{{Type: timeline.OpMirror, Axis: timeline.AxisX}},
+	}, center)
+	require.NoError(t, err)
+	assert.InDelta(t, 100, timelineX(a, 0), 1e-9)
+	assert.InDelta(t, 0, timelineX(a, 1), 1e-9)
+	assert.InDelta(t, 0, timelineX(b, 0), 1e-9)
+	assert.Equal(t, 100.0, a["position"].(map[string]interface{})["x"])
+
+	_, err = timeline.Apply(elements, timeline.Transform{
+		ElementIDs: []string{"b"},
+		Operations: []timeline.Operation{
+			{Type: timeline.OpRotate, Degrees: 90, Center: &timeline.Point{X: 10, Y: 10}},
+			{Type: timeline.OpTranslate, DX: 5, DY: -5},
+		},
+	}, timeline.Point{})
+	require.NoError(t, err)
+	// По часовой стрелке на холсте точка справа от центра уходит вниз
+	assert.InDelta(t, 5, timelineX(b, 1), 1e-9)
+	assert.InDelta(t, 95, timelineY(b, 1), 1e-9)
+}
+
+// TestTimelineTransformErrors проверяет, что ошибка не меняет элементы
+func TestTimelineTransformErrors(t *testing.T) {
+	element := transformElement("a")
+	elements := []interface{}{element}
+
+	_, err := timeline.Apply(elements, timeline.Transform{
+		Operations: []timeline.Operation{{Type: timeline.OpMirror}, {Type: timeline.OpShift, By: -5}},
+	}, timeline.Point{X: 1000})
+	assert.ErrorIs(t, err, timeline.ErrNegativeTime)
+	assert.Equal(t, []float64{0, 10, 20}, timelineTimes(element))
+	assert.InDelta(t, 0, timelineX(element, 0), 1e-9)
+
+	_, err = timeline.Apply(elements, timeline.Transform{
+		ElementIDs: []string{"missing"},
+		Operations: []timeline.Operation{{Type: timeline.OpShift, By: 1}},
+	}, timeline.Point{})
+	assert.ErrorIs(t, err, timeline.ErrUnknownElement)
+
+	_, err = timeline.Apply(elements, timeline.Transform{
+		Operations: []timeline.Operation{{Type: timeline.OpScale, Factor: 0}},
+	}, timeline.Point{})
+	assert.ErrorIs(t, err, timeline.ErrInvalidOperation)
+}
+
+// TestTransformProjectSave проверяет, что преобразование сохраняется только
+// поверх загруженной версии проекта
+func TestTransformProjectSave(t *testing.T) {
+	userID := primitive.NewObjectID()
+	projectID := primitive.NewObjectID()
+	loadedAt := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	project := bson.D{
+		{Key: "_id", Value: projectID},
+		{Key: "name", Value: "Finale"},
+		{Key: "owner", Value: userID},
+		{Key: "updatedAt", Value: loadedAt},
+		{Key: "elements", Value: bson.A{transformElement("a")}},
+	}
+	path := "/api/projects/" + projectID.Hex() + "/transform"
+	body := gin.H{"operations": []timeline.Operation{{Type: timeline.OpShift, By: 2}}}
+
+	for _, tc := range []struct {
+		name     string
+		matched  int32
+		existing int32
+		status   int
+	}{
+		{"saved", 1, 1, http.StatusOK},
+		{"changed meanwhile", 0, 1, http.StatusConflict},
+		{"deleted meanwhile", 0, 0, http.StatusNotFound},
+	} {
+		runWithMockDB(t, tc.name, func(mt *mtest.T) {
+			router, cfg := newTestRouter(t, routes.RegisterTransformRoutes)
+			mt.AddMockResponses(
+				mockCount("projects", 1),
+				mockCursor("projects", project),
+				mockWrite(tc.matched, tc.matched),
+				mockCount("projects", tc.existing),
+			)
+
+			w := serveJSON(t, router, http.MethodPost, path, testToken(t, cfg, userID), body)
+			assert.Equal(t, tc.status, w.Code, w.Body.String())
+
+			updates := sentCommands(mt, "update", "projects")
+			require.Len(t, updates, 1)
+			filter := decodeRaw(t, updates[0].Lookup("updates", "0", "q").Document())
+			assert.Equal(t, projectID, filter["_id"])
+			assert.Equal(t, primitive.NewDateTimeFromTime(loadedAt), filter["updatedAt"])
+		})
+	}
+}